@@ -1,12 +1,47 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/0x4d31/galah/internal/app"
 
+	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		var run func([]string) error
+		switch os.Args[1] {
+		case "cache":
+			run = app.RunCache
+		case "suricata":
+			run = app.RunSuricata
+		case "har":
+			run = app.RunHAR
+		case "stix":
+			run = app.RunSTIX
+		case "eval":
+			run = app.RunEval
+		case "finetune":
+			run = app.RunFinetune
+		case "replay":
+			run = app.RunReplay
+		case "test":
+			run = app.RunTest
+		case "warmup":
+			run = app.RunWarmup
+		}
+		if run != nil {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	app := app.App{}
 	app.Run()
 }
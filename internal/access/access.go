@@ -0,0 +1,229 @@
+// Package access implements the allow and deny lists of the source IPs, with
+// CIDR ranges and expiring entries.
+package access
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is an entry of an access list: a CIDR range, or a single address,
+// expiring at Expires if not zero.
+type Entry struct {
+	Prefix  netip.Prefix `json:"cidr"`
+	Expires time.Time    `json:"expires,omitempty"`
+	Comment string       `json:"comment,omitempty"`
+	// Configured is true for the entries of the configuration, replaced when
+	// it is reloaded, and false for the ones added at runtime.
+	Configured bool `json:"configured"`
+}
+
+// expired reports whether the entry has expired at now.
+func (e Entry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires)
+}
+
+// ParsePrefix parses a CIDR range, or a single IPv4 or IPv6 address.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ParseEntries parses the entries of the configuration: the CIDR ranges or
+// addresses, each optionally followed by its RFC 3339 expiry time.
+func ParseEntries(lines []string) ([]Entry, error) {
+	var entries []Entry
+	for _, line := range lines {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("invalid access list entry %q", line)
+		}
+		prefix, err := ParsePrefix(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid access list entry %q: %w", line, err)
+		}
+		e := Entry{Prefix: prefix, Configured: true}
+		if len(fields) == 2 {
+			if e.Expires, err = time.Parse(time.RFC3339, fields[1]); err != nil {
+				return nil, fmt.Errorf("invalid expiry time of the access list entry %q: %w", line, err)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// LoadFile loads the entries of the file, one per line, with the comments
+// starting with #.
+func LoadFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ParseEntries(lines)
+}
+
+// List is a list of CIDR ranges, with the entries of the configuration and
+// the ones added at runtime. The expired entries are ignored, and dropped
+// when the list changes.
+type List struct {
+	now func() time.Time
+
+	mu      sync.RWMutex
+	entries map[netip.Prefix]Entry
+}
+
+// NewList creates a List with the configured entries.
+func NewList(entries []Entry) *List {
+	l := &List{now: time.Now, entries: make(map[netip.Prefix]Entry)}
+	l.Replace(entries)
+	return l
+}
+
+// Replace replaces the configured entries of the list, keeping the ones added
+// at runtime.
+func (l *List) Replace(entries []Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for p, e := range l.entries {
+		if e.Configured {
+			delete(l.entries, p)
+		}
+	}
+	for _, e := range entries {
+		e.Configured = true
+		l.entries[e.Prefix] = e
+	}
+	l.expire()
+}
+
+// Add adds the entry to the list at runtime, replacing the entry of the same
+// range.
+func (l *List) Add(e Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.Configured = false
+	l.entries[e.Prefix] = e
+	l.expire()
+}
+
+// Remove removes the entry of the range, and reports whether it was listed.
+func (l *List) Remove(p netip.Prefix) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.entries[p]
+	delete(l.entries, p)
+	l.expire()
+	return ok
+}
+
+// expire drops the expired entries.
+func (l *List) expire() {
+	now := l.now()
+	for p, e := range l.entries {
+		if e.expired(now) {
+			delete(l.entries, p)
+		}
+	}
+}
+
+// Contains reports whether the IP address is in a range of the list.
+func (l *List) Contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	now := l.now()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, e := range l.entries {
+		if e.Prefix.Contains(addr) && !e.expired(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Entries returns the entries of the list, sorted by range.
+func (l *List) Entries() []Entry {
+	now := l.now()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	entries := make([]Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		if !e.expired(now) {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].Prefix, entries[j].Prefix
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c < 0
+		}
+		return a.Bits() < b.Bits()
+	})
+	return entries
+}
+
+// Len returns the number of entries of the list.
+func (l *List) Len() int {
+	now := l.now()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	n := 0
+	for _, e := range l.entries {
+		if !e.expired(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// Lists are the allow and deny lists of the sources.
+type Lists struct {
+	Allow *List
+	Deny  *List
+}
+
+// Allowed reports whether the source IP is allowed: in the allow list, if not
+// empty, and not in the deny list, which takes precedence.
+func (ls *Lists) Allowed(ip string) bool {
+	if ls.Deny.Contains(ip) {
+		return false
+	}
+	return ls.Allow.Len() == 0 || ls.Allow.Contains(ip)
+}
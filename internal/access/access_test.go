@@ -0,0 +1,91 @@
+package access
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLists(t *testing.T) {
+	now := time.Date(2024, 5, 26, 19, 0, 0, 0, time.UTC)
+	entries, err := ParseEntries([]string{
+		"10.0.0.0/8 # internal",
+		"",
+		"2001:db8::/32 2024-05-26T20:00:00Z",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deny := NewList(nil)
+	deny.now = func() time.Time { return now }
+	deny.Replace(entries)
+	allow := NewList(nil)
+	ls := &Lists{Allow: allow, Deny: deny}
+
+	for ip, allowed := range map[string]bool{
+		"10.1.2.3":          false,
+		"::ffff:10.1.2.3":   false,
+		"2001:db8::1":       false,
+		"192.0.2.1":         true,
+		"2001:db9::1":       true,
+		"not an ip address": true,
+	} {
+		if got := ls.Allowed(ip); got != allowed {
+			t.Errorf("Expected %s allowed: %t, got %t", ip, allowed, got)
+		}
+	}
+
+	now = now.Add(time.Hour)
+	if !ls.Allowed("2001:db8::1") {
+		t.Error("Expected the expired entry to be ignored")
+	}
+
+	allow.Add(Entry{Prefix: mustParsePrefix(t, "192.0.2.0/24")})
+	if ls.Allowed("198.51.100.1") || !ls.Allowed("192.0.2.1") {
+		t.Error("Expected only the sources of the allow list to be allowed")
+	}
+	deny.Add(Entry{Prefix: mustParsePrefix(t, "192.0.2.1")})
+	if ls.Allowed("192.0.2.1") || !ls.Allowed("192.0.2.2") {
+		t.Error("Expected the deny list to take precedence")
+	}
+
+	// The entries added at runtime are kept.
+	deny.Replace(nil)
+	if got := deny.Entries(); len(got) != 1 || got[0].Prefix.String() != "192.0.2.1/32" || got[0].Configured {
+		t.Errorf("Expected the runtime entry to be kept, got %v", got)
+	}
+	if !deny.Remove(mustParsePrefix(t, "192.0.2.1/32")) || deny.Len() != 0 {
+		t.Error("Expected the entry to be removed")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.txt")
+	if err := os.WriteFile(path, []byte("# scanners\n192.0.2.7\n198.51.100.0/24 2030-01-01T00:00:00Z\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Prefix.String() != "192.0.2.7/32" || entries[1].Expires.Year() != 2030 {
+		t.Errorf("Unexpected entries %v", entries)
+	}
+
+	for _, line := range []string{"192.0.2.300", "192.0.2.0/24 tomorrow", "192.0.2.1 2030-01-01T00:00:00Z extra"} {
+		if _, err := ParseEntries([]string{line}); err == nil {
+			t.Errorf("Expected an error for %q", line)
+		}
+	}
+}
+
+func mustParsePrefix(t *testing.T, s string) netip.Prefix {
+	t.Helper()
+	p, err := ParsePrefix(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -0,0 +1,375 @@
+// Package alert sends notifications to Slack, Discord or generic webhooks
+// when the events of the honeypot match the alert rules.
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	queueSize    = 256
+	sendTimeout  = 10 * time.Second
+	maxMessage   = 1900
+	maxThrottled = 100_000
+
+	// DefaultThrottle is the default interval between the alerts of a rule
+	// for a source.
+	DefaultThrottle = 10 * time.Minute
+	// DefaultMaxPerMinute is the default maximum number of alerts sent per
+	// minute.
+	DefaultMaxPerMinute = 10
+)
+
+// The types of webhooks.
+const (
+	TypeSlack   = "slack"
+	TypeDiscord = "discord"
+	TypeGeneric = "generic"
+)
+
+// Webhook is a destination of the alerts. Slack and Discord webhooks get a
+// chat message, and generic webhooks the alert and its event as JSON.
+type Webhook struct {
+	Type string
+	URL  string
+}
+
+// Rule is a condition of the events triggering an alert. An event matches
+// if it is the first event from its source country (NewCountry), has any of
+// the Tags, or has a request URI matching Path; the conditions set must all
+// match. Throttle overrides the interval between the alerts of the rule for
+// a source.
+type Rule struct {
+	Name       string
+	NewCountry bool
+	Tags       []string
+	Path       string
+	Throttle   time.Duration
+
+	path *regexp.Regexp
+}
+
+// Config configures an Alerter. An alert of a rule is sent at most once per
+// Throttle for a source, and at most MaxPerMinute alerts are sent per
+// minute; the alerts throttled are counted in the next alert of the rule.
+type Config struct {
+	Rules        []Rule
+	Webhooks     []Webhook
+	Throttle     time.Duration
+	MaxPerMinute int
+	Sensor       string
+}
+
+// Alert is an alert of a rule, sent to the webhooks.
+type Alert struct {
+	Rule      string          `json:"rule"`
+	Message   string          `json:"message"`
+	Time      time.Time       `json:"time"`
+	Sensor    string          `json:"sensor,omitempty"`
+	SrcIP     string          `json:"srcIP"`
+	Country   string          `json:"country,omitempty"`
+	Tags      []string        `json:"tags,omitempty"`
+	Throttled int             `json:"throttled,omitempty"`
+	Event     json.RawMessage `json:"event"`
+}
+
+// event is the part of the events matched by the rules.
+type event struct {
+	SrcIP  string   `json:"srcIP"`
+	Tags   []string `json:"tags"`
+	SrcGeo struct {
+		Country     string `json:"country"`
+		CountryCode string `json:"countryCode"`
+	} `json:"srcGeo"`
+	HTTPRequest struct {
+		Method  string `json:"method"`
+		Request string `json:"request"`
+	} `json:"httpRequest"`
+}
+
+// Alerter is a logrus hook of the event logger sending the alerts of the
+// events matching the rules, in the background.
+type Alerter struct {
+	cfg    Config
+	client *http.Client
+	logger *logrus.Logger
+
+	mu        sync.Mutex
+	countries map[string]bool
+	last      map[string]time.Time
+	throttled map[string]int
+	window    time.Time
+	sent      int
+
+	queue   chan Alert
+	done    chan struct{}
+	dropped sync.Once
+}
+
+// New returns an Alerter of the configuration, logging the errors sending
+// the alerts to logger.
+func New(cfg Config, logger *logrus.Logger) (*Alerter, error) {
+	if len(cfg.Webhooks) == 0 {
+		return nil, fmt.Errorf("no webhooks for the alerts")
+	}
+	for _, w := range cfg.Webhooks {
+		switch w.Type {
+		case TypeSlack, TypeDiscord, TypeGeneric:
+		default:
+			return nil, fmt.Errorf("unknown webhook type %q (slack, discord or generic)", w.Type)
+		}
+		if w.URL == "" {
+			return nil, fmt.Errorf("no URL for the %s webhook", w.Type)
+		}
+	}
+	rules := make([]Rule, len(cfg.Rules))
+	for i, r := range cfg.Rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("alert rule %d has no name", i)
+		}
+		if !r.NewCountry && len(r.Tags) == 0 && r.Path == "" {
+			return nil, fmt.Errorf("alert rule %q has no conditions", r.Name)
+		}
+		if r.Path != "" {
+			re, err := regexp.Compile(r.Path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path of the alert rule %q: %w", r.Name, err)
+			}
+			r.path = re
+		}
+		rules[i] = r
+	}
+	cfg.Rules = rules
+	if cfg.Throttle <= 0 {
+		cfg.Throttle = DefaultThrottle
+	}
+	if cfg.MaxPerMinute <= 0 {
+		cfg.MaxPerMinute = DefaultMaxPerMinute
+	}
+
+	a := &Alerter{
+		cfg:       cfg,
+		client:    &http.Client{Timeout: sendTimeout},
+		logger:    logger,
+		countries: make(map[string]bool),
+		last:      make(map[string]time.Time),
+		throttled: make(map[string]int),
+		queue:     make(chan Alert, queueSize),
+		done:      make(chan struct{}),
+	}
+	go a.run()
+	return a, nil
+}
+
+// Levels returns the levels of the events matched by the rules.
+func (a *Alerter) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire matches the event against the rules, queueing the alerts to send.
+func (a *Alerter) Fire(entry *logrus.Entry) error {
+	if len(a.cfg.Rules) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(entry.Data)
+	if err != nil {
+		return err
+	}
+	var e event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return err
+	}
+	if e.SrcIP == "" {
+		return nil
+	}
+
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	newCountry := false
+	if c := e.SrcGeo.CountryCode; c != "" && !a.countries[c] {
+		a.countries[c] = true
+		newCountry = true
+	}
+	for _, r := range a.cfg.Rules {
+		if !r.matches(e, newCountry) {
+			continue
+		}
+		alert, ok := a.throttle(r, e.SrcIP, now)
+		if !ok {
+			continue
+		}
+		alert.Time = entry.Time
+		alert.Sensor = a.cfg.Sensor
+		alert.SrcIP = e.SrcIP
+		alert.Country = e.SrcGeo.Country
+		alert.Tags = e.Tags
+		alert.Event = data
+		alert.Message = message(r, e, alert.Throttled)
+		a.enqueue(alert)
+	}
+	return nil
+}
+
+// Notify queues an alert of the honeypot itself rather than of an event, e.g.
+// when the LLM budget is spent. It isn't throttled.
+func (a *Alerter) Notify(name, msg string) {
+	a.enqueue(Alert{
+		Rule:    name,
+		Message: fmt.Sprintf("Galah alert %q: %s", name, msg),
+		Time:    time.Now(),
+		Sensor:  a.cfg.Sensor,
+	})
+}
+
+func (a *Alerter) enqueue(alert Alert) {
+	select {
+	case a.queue <- alert:
+	default:
+		a.dropped.Do(func() {
+			a.logger.Errorf("the alert queue is full, dropping the alerts")
+		})
+	}
+}
+
+func (r Rule) matches(e event, newCountry bool) bool {
+	if r.NewCountry && !newCountry {
+		return false
+	}
+	if len(r.Tags) > 0 && !hasAny(e.Tags, r.Tags) {
+		return false
+	}
+	if r.path != nil && !r.path.MatchString(e.HTTPRequest.Request) {
+		return false
+	}
+	return true
+}
+
+func hasAny(tags, wanted []string) bool {
+	for _, t := range tags {
+		for _, w := range wanted {
+			if strings.EqualFold(t, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// throttle returns the alert of the rule for the source, or false if it is
+// throttled. It must be called with a.mu held.
+func (a *Alerter) throttle(r Rule, srcIP string, now time.Time) (Alert, bool) {
+	interval := r.Throttle
+	if interval <= 0 {
+		interval = a.cfg.Throttle
+	}
+	key := r.Name + "\x00" + srcIP
+	if last, ok := a.last[key]; ok && now.Sub(last) < interval {
+		a.throttled[r.Name]++
+		return Alert{}, false
+	}
+	if now.Sub(a.window) >= time.Minute {
+		a.window, a.sent = now, 0
+	}
+	if a.sent >= a.cfg.MaxPerMinute {
+		a.throttled[r.Name]++
+		return Alert{}, false
+	}
+	if len(a.last) >= maxThrottled {
+		for k, t := range a.last {
+			if now.Sub(t) >= interval {
+				delete(a.last, k)
+			}
+		}
+		if len(a.last) >= maxThrottled {
+			a.last = make(map[string]time.Time)
+		}
+	}
+	a.last[key] = now
+	a.sent++
+	alert := Alert{Rule: r.Name, Throttled: a.throttled[r.Name]}
+	delete(a.throttled, r.Name)
+	return alert, true
+}
+
+func message(r Rule, e event, throttled int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Galah alert %q: %s", r.Name, e.SrcIP)
+	if c := e.SrcGeo.Country; c != "" {
+		fmt.Fprintf(&b, " (%s)", c)
+	}
+	if e.HTTPRequest.Method != "" {
+		fmt.Fprintf(&b, " %s %s", e.HTTPRequest.Method, e.HTTPRequest.Request)
+	}
+	if len(e.Tags) > 0 {
+		fmt.Fprintf(&b, " [%s]", strings.Join(e.Tags, ", "))
+	}
+	if throttled > 0 {
+		fmt.Fprintf(&b, " (%d similar alerts throttled)", throttled)
+	}
+	s := b.String()
+	if len(s) > maxMessage {
+		s = s[:maxMessage] + "..."
+	}
+	return s
+}
+
+// Close sends the queued alerts.
+func (a *Alerter) Close() error {
+	close(a.queue)
+	<-a.done
+	return nil
+}
+
+func (a *Alerter) run() {
+	defer close(a.done)
+	for alert := range a.queue {
+		for _, w := range a.cfg.Webhooks {
+			if err := a.send(w, alert); err != nil {
+				a.logger.Errorf("error sending the alert %q to the %s webhook: %s", alert.Rule, w.Type, err)
+			}
+		}
+	}
+}
+
+func (a *Alerter) send(w Webhook, alert Alert) error {
+	var payload any
+	switch w.Type {
+	case TypeSlack:
+		payload = map[string]string{"text": alert.Message}
+	case TypeDiscord:
+		payload = map[string]string{"content": alert.Message}
+	default:
+		payload = alert
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
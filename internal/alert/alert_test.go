@@ -0,0 +1,133 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAlerter(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string][]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], string(b))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	a, err := New(Config{
+		Rules: []Rule{
+			{Name: "new-country", NewCountry: true},
+			{Name: "rce", Tags: []string{"rce"}},
+			{Name: "wp-login", Path: `^/wp-login\.php`, Tags: []string{"scanner"}},
+		},
+		Webhooks: []Webhook{
+			{Type: TypeSlack, URL: srv.URL + "/slack"},
+			{Type: TypeGeneric, URL: srv.URL + "/generic"},
+		},
+		Sensor: "sensor-1",
+	}, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	l.AddHook(a)
+	log := func(srcIP, country, uri string, tags ...string) {
+		l.WithFields(logrus.Fields{
+			"srcIP":       srcIP,
+			"srcGeo":      &enrich.GeoInfo{Country: country, CountryCode: country[:2]},
+			"tags":        tags,
+			"httpRequest": map[string]string{"method": "GET", "request": uri},
+		}).Info("successfulResponse")
+	}
+	log("192.0.2.1", "AU", "/cgi-bin/;id", "rce")
+	// Throttled for the source.
+	log("192.0.2.1", "AU", "/cgi-bin/;uname", "rce")
+	log("192.0.2.2", "AU", "/wp-login.php")
+	log("192.0.2.2", "AU", "/wp-login.php", "scanner")
+	log("192.0.2.3", "NZ", "/", "rce")
+	a.Close()
+
+	if got := len(received["/slack"]); got != 5 {
+		t.Fatalf("Expected 5 Slack alerts, got %d: %v", got, received["/slack"])
+	}
+	var msg struct{ Text string }
+	json.Unmarshal([]byte(received["/slack"][4]), &msg)
+	if !strings.Contains(msg.Text, `"rce": 192.0.2.3 (NZ) GET /`) || !strings.Contains(msg.Text, "(1 similar alerts throttled)") {
+		t.Errorf("Unexpected Slack message %q", msg.Text)
+	}
+	var alert Alert
+	json.Unmarshal([]byte(received["/generic"][3]), &alert)
+	if alert.Rule != "new-country" || alert.Sensor != "sensor-1" || alert.Country != "NZ" || len(alert.Event) == 0 {
+		t.Errorf("Unexpected generic alert %+v", alert)
+	}
+	var rules []string
+	for _, b := range received["/generic"] {
+		var a Alert
+		json.Unmarshal([]byte(b), &a)
+		rules = append(rules, a.Rule)
+	}
+	if got := strings.Join(rules, ","); got != "new-country,rce,wp-login,new-country,rce" {
+		t.Errorf("Unexpected alerts %s", got)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	var received []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received = append(received, string(b))
+	}))
+	defer srv.Close()
+
+	a, err := New(Config{Webhooks: []Webhook{{Type: TypeDiscord, URL: srv.URL}}}, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Notify("budget", "the daily LLM budget is spent")
+	a.Close()
+
+	var msg struct{ Content string }
+	if len(received) != 1 || json.Unmarshal([]byte(received[0]), &msg) != nil || msg.Content != `Galah alert "budget": the daily LLM budget is spent` {
+		t.Errorf("Unexpected Discord messages %v", received)
+	}
+}
+
+func TestMaxPerMinute(t *testing.T) {
+	a := &Alerter{cfg: Config{Throttle: DefaultThrottle, MaxPerMinute: 2}, last: map[string]time.Time{}, throttled: map[string]int{}}
+	r := Rule{Name: "rce"}
+	now := time.Now()
+	for i, want := range []bool{true, true, false} {
+		if _, ok := a.throttle(r, fmt.Sprintf("192.0.2.%d", i), now); ok != want {
+			t.Errorf("throttle() of alert %d = %v, want %v", i, ok, want)
+		}
+	}
+	if alert, ok := a.throttle(r, "192.0.2.9", now.Add(time.Minute)); !ok || alert.Throttled != 1 {
+		t.Errorf("Expected an alert counting 1 throttled alert after a minute, got %+v, %v", alert, ok)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, cfg := range []Config{
+		{},
+		{Webhooks: []Webhook{{Type: "teams", URL: "http://example.com"}}},
+		{Webhooks: []Webhook{{Type: TypeSlack, URL: "http://example.com"}}, Rules: []Rule{{Name: "empty"}}},
+		{Webhooks: []Webhook{{Type: TypeSlack, URL: "http://example.com"}}, Rules: []Rule{{Name: "bad", Path: "("}}},
+	} {
+		if _, err := New(cfg, logrus.New()); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+}
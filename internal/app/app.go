@@ -2,33 +2,92 @@ package app
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/0x4d31/galah/internal/access"
+	"github.com/0x4d31/galah/internal/alert"
 	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/capture"
+	"github.com/0x4d31/galah/internal/cluster"
 	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/eventstore"
+	"github.com/0x4d31/galah/internal/honeytoken"
+	"github.com/0x4d31/galah/internal/limiter"
 	el "github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/internal/metrics"
 	"github.com/0x4d31/galah/internal/server"
+	"github.com/0x4d31/galah/internal/session"
+	"github.com/0x4d31/galah/internal/stats"
+	"github.com/0x4d31/galah/internal/tracing"
 	"github.com/0x4d31/galah/pkg/enrich"
 	"github.com/0x4d31/galah/pkg/llm"
 	"github.com/alexflint/go-arg"
 	"github.com/sirupsen/logrus"
 	"github.com/tmc/langchaingo/llms"
+	"go.opentelemetry.io/otel"
 )
 
 // App contains the core components and dependencies of the application.
 type App struct {
-	Cache       *sql.DB
-	Config      *config.Config
-	EnrichCache *enrich.Enricher
-	EventLogger *el.Logger
-	Hostname    string
-	LLMConfig   llm.Config
-	Logger      *logrus.Logger
-	Model       llms.Model
-	Servers     map[uint16]*http.Server
+	Cache             cache.Store
+	Consistency       *cache.SourceResponses
+	Config            *config.Config
+	EnrichCache       *enrich.Enricher
+	EventLogger       *el.Logger
+	EventStore        *eventstore.Store
+	Fallback          llm.Chain
+	HeaderPins        *server.HeaderPins
+	History           *llm.History
+	Hostname          string
+	Latency           *llm.LatencyEstimator
+	LLMConfig         llm.Config
+	Limiter           *limiter.Limiter
+	Logger            *logrus.Logger
+	Metrics           *metrics.Metrics
+	Model             llms.Model
+	NewModel          func(context.Context, llm.Config) (llms.Model, error)
+	Profile           *llm.ServerProfile
+	RateLimiter       *limiter.RateLimiter
+	Recent            *el.RecentEvents
+	Rules             server.StaticRules
+	StaticArtifacts   *server.StaticArtifacts
+	PayloadSignatures []llm.PayloadSignature
+	Runtime           *server.Runtime
+	Emulations        []*llm.Emulation
+	Personas          map[uint16]*server.Persona
+	Routes            []server.ModelRoute
+	VirtualHosts      []server.VirtualHost
+	Semantic          *cache.SemanticIndex
+	Servers           map[string]*http.Server
+	Signatures        *stats.Signatures
+	Tarpit            *server.Tarpit
+	Scanners          *server.ScannerDetection
+	TrustedProxies    *server.TrustedProxies
+	Pipeline          *server.Pipeline
+	Sessions          *session.Tracker
+	CookieSessions    *server.CookieSessions
+	Cluster           *cluster.Cluster
+	Uploads           *server.Uploads
+	Capture           *capture.Capturer
+	Honeytokens       *honeytoken.Honeytokens
+	AccessLists       *access.Lists
+	Budget            *llm.Budget
+	Moderator         *llm.Moderator
+	Alerter           *alert.Alerter
+	Tracing           *tracing.Provider
+	Usage             *llm.UsageTracker
+	Variation         *llm.Variation
+
+	// wrap wraps the models initialized after the primary's, and reloadMu
+	// serializes the reloads of the configuration.
+	wrap     func(llms.Model, string) llms.Model
+	reloadMu sync.Mutex
 }
 
 var logger *logrus.Logger
@@ -37,6 +96,9 @@ const (
 	version   = "1.0"
 	cacheSize = 1_000_000
 	lookupTTL = 1 * time.Hour
+	// recentEvents is the number of events kept for the admin API and the
+	// dashboard.
+	recentEvents = 1000
 	// sessionTTL = 2 * time.Minute
 )
 
@@ -57,17 +119,96 @@ func (a *App) Run() error {
 	}
 
 	srv := server.Server{
-		Cache:         a.Cache,
-		CacheDuration: args.CacheDuration,
-		Interface:     args.Interface,
-		Config:        a.Config,
-		EventLogger:   a.EventLogger,
-		LLMConfig:     a.LLMConfig,
-		Logger:        a.Logger,
-		Model:         a.Model,
+		Cache:             a.Cache,
+		CacheDuration:     args.CacheDuration,
+		Consistency:       a.Consistency,
+		Interface:         args.Interface,
+		Config:            a.Config,
+		ConfigFile:        args.ConfigFile,
+		EventLogger:       a.EventLogger,
+		EventStore:        a.EventStore,
+		Fallback:          a.Fallback,
+		HeaderPins:        a.HeaderPins,
+		History:           a.History,
+		Latency:           a.Latency,
+		LLMConfig:         a.LLMConfig,
+		Limiter:           a.Limiter,
+		Logger:            a.Logger,
+		Metrics:           a.Metrics,
+		Model:             a.Model,
+		NewModel:          a.NewModel,
+		Profile:           a.Profile,
+		RateLimiter:       a.RateLimiter,
+		Recent:            a.Recent,
+		Rules:             a.Rules,
+		StaticArtifacts:   a.StaticArtifacts,
+		PayloadSignatures: a.PayloadSignatures,
+		Runtime:           a.Runtime,
+		Emulations:        a.Emulations,
+		Personas:          a.Personas,
+		Routes:            a.Routes,
+		VirtualHosts:      a.VirtualHosts,
+		Semantic:          a.Semantic,
+		ShutdownTimeout:   args.ShutdownTimeout,
+		Signatures:        a.Signatures,
+		Tarpit:            a.Tarpit,
+		Scanners:          a.Scanners,
+		TrustedProxies:    a.TrustedProxies,
+		Pipeline:          a.Pipeline,
+		Sessions:          a.Sessions,
+		CookieSessions:    a.CookieSessions,
+		Cluster:           a.Cluster,
+		Uploads:           a.Uploads,
+		Capture:           a.Capture,
+		Honeytokens:       a.Honeytokens,
+		AccessLists:       a.AccessLists,
+		QueueOverflow:     args.QueueOverflow,
+		Budget:            a.Budget,
+		Moderator:         a.Moderator,
+		Tracing:           a.Tracing,
+		Usage:             a.Usage,
+		Variation:         a.Variation,
+		WebSockets:        server.NewWebSocketSessions(),
 	}
 
 	srv.ListenForShutdownSignals()
+	srv.ListenForInvalidationSignals()
+	srv.ListenForReloadSignals(a.reload)
+	if args.ConfigWatch > 0 {
+		go a.watchConfig(context.Background(), args.ConfigWatch)
+	}
+	if args.StatsAddr != "" {
+		go func() {
+			if err := srv.StartStatsServer(args.StatsAddr, args.AdminToken); err != nil {
+				logger.Errorf("error starting the stats server: %s", err)
+			}
+		}()
+	}
+	if args.ManagementAddr != "" {
+		var dashboardToken string
+		if args.Dashboard {
+			dashboardToken = args.AdminToken
+		}
+		go func() {
+			if err := srv.StartManagementServer(args.ManagementAddr, dashboardToken); err != nil {
+				logger.Errorf("error starting the management server: %s", err)
+			}
+		}()
+	}
+	if args.AdminAddr != "" {
+		go func() {
+			if err := srv.StartAdminServer(args.AdminAddr, args.AdminToken); err != nil {
+				logger.Errorf("error starting the admin server: %s", err)
+			}
+		}()
+	}
+	if args.MetricsAddr != "" {
+		go func() {
+			if err := srv.StartMetricsServer(args.MetricsAddr); err != nil {
+				logger.Errorf("error starting the metrics server: %s", err)
+			}
+		}()
+	}
 	if err := srv.StartServers(); err != nil {
 		logger.Fatalf("application failed to start: %s", err)
 	}
@@ -83,47 +224,628 @@ func (a *App) init() error {
 		return fmt.Errorf("error loading config: %s", err)
 	}
 
+	headers, err := parseHeaders(args.LLMHeaders)
+	if err != nil {
+		return err
+	}
+
 	modelConfig := llm.Config{
-		Provider:      args.LLMProvider,
-		Model:         args.LLMModel,
-		ServerURL:     args.LLMServerURL,
-		Temperature:   args.LLMTemperature,
-		APIKey:        args.LLMAPIKey,
-		CloudProject:  args.LLMCloudProject,
-		CloudLocation: args.LLMCloudLocation,
+		Provider:             args.LLMProvider,
+		Model:                args.LLMModel,
+		ServerURL:            args.LLMServerURL,
+		Temperature:          args.LLMTemperature,
+		Seed:                 args.LLMSeed,
+		TopP:                 args.LLMTopP,
+		FrequencyPenalty:     args.LLMFrequency,
+		PresencePenalty:      args.LLMPresence,
+		StopSequences:        args.LLMStop,
+		SafetyThreshold:      args.LLMSafety,
+		KeepAlive:            args.OllamaKeepAlive,
+		NumCtx:               args.OllamaNumCtx,
+		APIKey:               args.LLMAPIKey,
+		CloudProject:         args.LLMCloudProject,
+		CloudLocation:        args.LLMCloudLocation,
+		Deployment:           args.LLMDeployment,
+		APIVersion:           args.LLMAPIVersion,
+		Headers:              headers,
+		Stream:               args.LLMStream,
+		StreamAbortThreshold: args.LLMStreamAbort,
+		MaxRequestCost:       args.LLMMaxCost,
+		MaxTokens:            args.LLMMaxTokens,
+		Timeout:              args.LLMTimeout,
+		ToolCalling:          args.LLMToolCalling,
+		JSONCorrections:      args.LLMCorrections,
+		HTMLContent:          args.LLMHTMLContent,
+	}
+	if err := llm.CheckHTMLContent(modelConfig.HTMLContent); err != nil {
+		return err
+	}
+	caps := llm.CapabilitiesFor(modelConfig.Provider)
+	if modelConfig.Seed != 0 && !caps.Seed {
+		logger.Warnf("the %s provider doesn't support the sampling seed, the responses aren't deterministic", modelConfig.Provider)
+	}
+	if modelConfig.TopP > 0 && !caps.TopP {
+		logger.Warnf("the %s provider doesn't support top_p, it is ignored", modelConfig.Provider)
+	}
+	if (modelConfig.FrequencyPenalty != 0 || modelConfig.PresencePenalty != 0) && !caps.Penalties {
+		logger.Warnf("the %s provider doesn't support the frequency and presence penalties, they are ignored", modelConfig.Provider)
+	}
+	if modelConfig.SafetyThreshold != "" && modelConfig.Provider != "googleai" && modelConfig.Provider != "gcp-vertex" {
+		logger.Warnln("the safety threshold only applies to the googleai and gcp-vertex providers, it is ignored")
+	}
+	if len(modelConfig.StopSequences) > 0 && !caps.Stop {
+		logger.Warnf("the %s provider doesn't support the stop sequences, they are ignored", modelConfig.Provider)
 	}
 	model, err := llm.New(ctx, modelConfig)
 	if err != nil {
 		return fmt.Errorf("error initializing the LLM client: %s", err)
 	}
+	if args.OllamaPreload && modelConfig.Provider == "ollama" {
+		logger.Infof("loading the Ollama model %s", modelConfig.Model)
+		if err := llm.PreloadOllama(ctx, modelConfig); err != nil {
+			logger.Warnf("error loading the Ollama model %s: %s", modelConfig.Model, err)
+		}
+	}
+	usage := llm.NewUsageTracker()
+	var tokenLimiter *llm.TokenLimiter
+	if args.MaxTPM > 0 {
+		tokenLimiter = llm.NewTokenLimiter(args.MaxTPM)
+	}
+	if cfg.Cluster.Enabled {
+		if a.Cluster, err = initCluster(cfg.Cluster); err != nil {
+			return err
+		}
+	}
+	budget, err := a.initBudget(cfg.Budget)
+	if err != nil {
+		return err
+	}
+	wrap := func(model llms.Model, name string) llms.Model {
+		model = usage.Wrap(model, name)
+		if tokenLimiter != nil {
+			model = tokenLimiter.Wrap(model, name)
+		}
+		if args.BreakerThreshold > 0 {
+			model = llm.NewCircuitBreaker(args.BreakerThreshold, args.BreakerCooldown).Wrap(model)
+		}
+		// The spent budget doesn't count as a failure of the provider.
+		if budget != nil {
+			model = budget.Wrap(model, name)
+		}
+		return model
+	}
+	model = wrap(model, modelConfig.Model)
+
+	fallback, err := initFallback(ctx, cfg.Fallback, modelConfig, wrap)
+	if err != nil {
+		return err
+	}
+
+	settings, err := loadSettings(ctx, cfg, modelConfig, map[string]llms.Model{modelConfig.Model: model}, wrap)
+	if err != nil {
+		return err
+	}
 
-	cache, err := cache.InitializeCache(args.CacheDBFile)
+	db, err := cache.InitializeCache(args.CacheDBFile)
 	if err != nil {
 		return fmt.Errorf("error initializing the cache database: %s", err)
 	}
+	var store cache.Store = db
+	// The instances of a cluster share the cache of its Redis server.
+	redisURL := args.CacheRedisURL
+	if redisURL == "" && a.Cluster != nil {
+		redisURL = cfg.Cluster.RedisURL
+	}
+	if redisURL != "" {
+		var ttl time.Duration
+		if args.CacheDuration > 0 {
+			ttl = time.Duration(args.CacheDuration) * time.Hour
+		}
+		if store, err = cache.NewRedisStore(redisURL, ttl); err != nil {
+			return fmt.Errorf("error initializing the redis cache: %s", err)
+		}
+	}
+
+	var semantic *cache.SemanticIndex
+	if args.EmbeddingModel != "" && args.CacheDuration != 0 {
+		embeddingConfig := modelConfig
+		embeddingConfig.Model = args.EmbeddingModel
+		embedder, err := llm.NewEmbedder(ctx, embeddingConfig)
+		if err != nil {
+			return fmt.Errorf("error initializing the embedding client: %s", err)
+		}
+		semantic, err = cache.NewSemanticIndex(db.DB, embedder, cfg.SemanticCache.Threshold, cfg.SemanticCache.MaxEntries)
+		if err != nil {
+			return fmt.Errorf("error initializing the semantic cache: %s", err)
+		}
+	}
 
 	enrichCache := enrich.New(enrich.Config{
 		CacheSize: cacheSize,
 		CacheTTL:  lookupTTL,
 	})
+	if err := enrichCache.LoadGeoIP(args.GeoIPCityDB, args.GeoIPASNDB); err != nil {
+		return err
+	}
+	if tc := cfg.ThreatIntel; len(tc.Feeds) > 0 {
+		var feeds []enrich.Feed
+		for _, fc := range tc.Feeds {
+			apiKey := fc.APIKey
+			if fc.APIKeyEnv != "" {
+				apiKey = os.Getenv(fc.APIKeyEnv)
+			}
+			feed, err := enrich.NewFeed(enrich.FeedConfig{Type: fc.Type, URL: fc.URL, APIKey: apiKey, MinScore: fc.MinScore}, nil)
+			if err != nil {
+				return err
+			}
+			feeds = append(feeds, feed)
+		}
+		enrichCache.SetThreatIntel(enrich.NewThreatIntel(feeds, cacheSize, tc.CacheTTL, tc.Timeout))
+	}
+
+	if tc := cfg.Tracing; tc.Endpoint != "" {
+		provider, err := tracing.NewProvider(tracing.Config{
+			Endpoint:    tc.Endpoint,
+			Headers:     tc.Headers,
+			ServiceName: tc.ServiceName,
+			Version:     version,
+			SampleRatio: tc.SampleRatio,
+		}, logger)
+		if err != nil {
+			return err
+		}
+		otel.SetTracerProvider(provider)
+		a.Tracing = provider
+	}
 
 	eventLogger, err := el.New(args.EventLogFile, modelConfig, enrichCache, logger)
 	if err != nil {
 		return err
 	}
+	if err := eventLogger.SetFormat(args.EventLogFormat); err != nil {
+		return err
+	}
+	if rc := cfg.EventLogRotation; rc.MaxSizeMB > 0 || rc.Interval > 0 {
+		rotate, err := rotateConfig(rc, logger)
+		if err != nil {
+			return err
+		}
+		if err := eventLogger.SetRotation(args.EventLogFile, rotate); err != nil {
+			return err
+		}
+	}
+	if rc := cfg.EventRedaction; rc.Enabled {
+		if err := eventLogger.SetRedaction(redactConfig(rc)); err != nil {
+			return err
+		}
+	}
+	if len(cfg.AttackTechniques) > 0 {
+		eventLogger.SetTechniques(cfg.AttackTechniques)
+	}
+	if sc := cfg.Sessions; sc.Enabled {
+		a.Sessions = session.NewTracker(session.Config{
+			Timeout:     sc.Timeout,
+			MaxSessions: sc.MaxSessions,
+			Threshold:   sc.Threshold,
+			OnFlagged:   a.sessionFlagged,
+		})
+		eventLogger.Sessions = a.Sessions
+	}
+	if err := a.addEventOutputs(eventLogger, cfg.EventOutputs); err != nil {
+		return err
+	}
+	if err := a.addAlerts(eventLogger, cfg.Alerts); err != nil {
+		return err
+	}
+
+	if hc := cfg.RequestHistory; hc.Size > 0 {
+		a.History = llm.NewHistory(llm.HistoryConfig{
+			Size:           hc.Size,
+			TTL:            hc.TTL,
+			MaxSources:     hc.MaxSources,
+			SessionCookies: hc.SessionCookies,
+			Excerpt:        hc.Excerpt,
+		})
+	}
+
+	if cc := cfg.Consistency; cc.Enabled {
+		a.Consistency = cache.NewSourceResponses(cc.MaxEntries, cc.TTL)
+	}
 
-	a.Cache = cache
+	a.Cache = store
+	a.Semantic = semantic
 	a.Config = cfg
 	a.EnrichCache = enrichCache
 	a.EventLogger = eventLogger
+	a.Fallback = fallback
 	a.LLMConfig = modelConfig
+	if cfg.Deadline.Enabled {
+		a.Latency = llm.NewLatencyEstimator()
+	}
+	a.Limiter = limiter.New(limiter.Config{
+		MaxConcurrent:          args.MaxConcurrent,
+		MaxConcurrentPerSource: args.MaxPerSource,
+		MaxQueue:               args.MaxQueue,
+		QueueTimeout:           args.QueueTimeout,
+	})
+	if err := server.CheckQueueOverflow(args.QueueOverflow); err != nil {
+		return err
+	}
+	if a.RateLimiter, err = server.NewRateLimiter(cfg.RateLimit); err != nil {
+		return err
+	}
+	a.Tarpit = server.NewTarpit(cfg.Tarpit)
+	if a.Scanners, err = server.NewScannerDetection(cfg.ScannerDetection); err != nil {
+		return err
+	}
+	if a.TrustedProxies, err = server.NewTrustedProxies(cfg.TrustedProxies); err != nil {
+		return err
+	}
+	if a.Pipeline, err = server.NewPipeline(cfg.Response); err != nil {
+		return err
+	}
+	a.HeaderPins = server.NewHeaderPins()
+	if cfg.CookieSessions.Enabled {
+		a.CookieSessions = server.NewCookieSessions(cfg.CookieSessions, a.Cluster)
+	}
+	if a.Uploads, err = server.NewUploads(cfg.Uploads); err != nil {
+		return err
+	}
+	if pc := cfg.PacketCapture; pc.Enabled {
+		if pc.FlaggedSessions && !cfg.Sessions.Enabled {
+			logger.Warnln("the flagged sessions are not captured, as the sessions are disabled")
+		}
+		if a.Capture, err = openCapture(pc, cfg.Ports); err != nil {
+			return err
+		}
+	}
+	if hc := cfg.Honeytokens; hc.Enabled {
+		secret := hc.Secret
+		if hc.SecretEnv != "" {
+			secret = os.Getenv(hc.SecretEnv)
+		}
+		a.Honeytokens, err = honeytoken.New(honeytoken.Config{
+			Kinds:      hc.Kinds,
+			Secret:     secret,
+			File:       hc.File,
+			BaseURL:    hc.BaseURL,
+			PathPrefix: hc.PathPrefix,
+			MaxTokens:  hc.MaxTokens,
+			OnUsed:     a.honeytokenUsed,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if a.AccessLists, err = server.NewAccessLists(cfg.AccessLists); err != nil {
+		return err
+	}
 	a.Logger = logger
 	a.Model = model
-	a.Servers = make(map[uint16]*http.Server)
+	a.Profile = settings.Profile
+	a.Rules = settings.Rules
+	a.StaticArtifacts = settings.StaticArtifacts
+	a.PayloadSignatures = settings.PayloadSignatures
+	a.Emulations = settings.Emulations
+	a.Personas = settings.Personas
+	a.Routes = settings.Routes
+	a.VirtualHosts = settings.VirtualHosts
+	a.Runtime = server.NewRuntime()
+	a.wrap = wrap
+	a.Servers = make(map[string]*http.Server)
+	a.Usage = usage
+	a.Budget = budget
+	if args.MetricsAddr != "" {
+		a.Metrics = metrics.New(usage)
+	}
+	if args.AdminAddr != "" || args.Dashboard {
+		if args.AdminToken == "" {
+			return fmt.Errorf("the admin API and the dashboard require a token (--admin-token)")
+		}
+		a.Recent = el.NewRecentEvents(recentEvents)
+		eventLogger.EventLogger.AddHook(a.Recent)
+	}
+	if args.AdminAddr != "" {
+		a.NewModel = func(ctx context.Context, c llm.Config) (llms.Model, error) {
+			model, err := llm.New(ctx, c)
+			if err != nil {
+				return nil, err
+			}
+			return wrap(model, c.Model), nil
+		}
+	}
+	if vc := cfg.Response.Variation; vc.Enabled {
+		seed := vc.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		a.Variation = llm.NewVariation(seed)
+	}
+	if mc := cfg.Response.Moderation; mc.Enabled {
+		if a.Moderator, err = initModerator(mc, modelConfig, fallback, settings); err != nil {
+			return err
+		}
+	}
+	if args.SignatureStats > 0 {
+		a.Signatures = stats.NewSignatures(args.SignatureStats)
+	}
 
 	return nil
 }
 
+// initModerator returns the moderator of the generated responses, checking
+// for the API keys of the providers.
+func initModerator(mc config.ModerationConfig, primary llm.Config, fallback llm.Chain, settings *server.Settings) (*llm.Moderator, error) {
+	keys := []string{primary.APIKey}
+	for _, p := range fallback {
+		keys = append(keys, p.Config.APIKey)
+	}
+	for _, p := range settings.Personas {
+		keys = append(keys, p.LLMConfig.APIKey)
+	}
+	for _, vh := range settings.VirtualHosts {
+		keys = append(keys, vh.Persona.LLMConfig.APIKey)
+	}
+	moderator, err := llm.NewModerator(llm.ModerationConfig{
+		Checks:    mc.Checks,
+		APIKeys:   keys,
+		Patterns:  mc.Patterns,
+		Hostnames: mc.Hostnames,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error initializing the moderation: %s", err)
+	}
+	return moderator, nil
+}
+
+// initBudget returns the LLM budget of the configuration, or nil if no budget
+// is set.
+func (a *App) initBudget(bc config.BudgetConfig) (*llm.Budget, error) {
+	loc := time.UTC
+	if bc.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(bc.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid budget timezone: %s", err)
+		}
+	}
+	budget := llm.BudgetConfig{
+		DailyCost:     bc.DailyCost,
+		DailyTokens:   bc.DailyTokens,
+		MonthlyCost:   bc.MonthlyCost,
+		MonthlyTokens: bc.MonthlyTokens,
+		Location:      loc,
+	}
+	if a.Cluster != nil {
+		budget.Shared = a.Cluster
+	}
+	return llm.NewBudget(budget, a.budgetExceeded), nil
+}
+
+// initCluster returns the cluster of the instances sharing the Redis server
+// of the configuration, or of the cache.
+func initCluster(cc config.ClusterConfig) (*cluster.Cluster, error) {
+	url := cc.RedisURL
+	if url == "" {
+		url = args.CacheRedisURL
+	}
+	if url == "" {
+		return nil, fmt.Errorf("the cluster mode requires a Redis server (cluster.redis_url or --cache-redis-url)")
+	}
+	c, err := cluster.New(cluster.Config{RedisURL: url, LockTimeout: cc.LockTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to the cluster: %s", err)
+	}
+	return c, nil
+}
+
+// budgetExceeded warns and alerts that the LLM budget of the period is spent.
+func (a *App) budgetExceeded(period string, usage llm.BudgetPeriod) {
+	msg := fmt.Sprintf("the %s LLM budget is spent (%d tokens, $%.2f estimated), only the cached and static responses are served until the next period", period, usage.Tokens, usage.Cost)
+	logger.Warnln(msg)
+	if a.Alerter != nil {
+		a.Alerter.Notify("budget", msg)
+	}
+}
+
+// sessionFlagged warns of the flagged session and sends its alert.
+func (a *App) sessionFlagged(info session.Info) {
+	msg := fmt.Sprintf("the session %s of %s (%d requests since %s) scored %d, beyond automated scanning", info.ID, info.Source, info.Requests, info.Start.Format(time.RFC3339), info.Score)
+	logger.Warnln(msg)
+	if a.Alerter != nil {
+		a.Alerter.Notify("session", msg)
+	}
+	if a.Capture != nil {
+		if path, err := a.Capture.Flag(info.ID, info.Source); err != nil {
+			logger.Errorf("error capturing the packets of the session %s: %s", info.ID, err)
+		} else if path != "" {
+			logger.Infof("capturing the packets of the session %s to %s", info.ID, path)
+		}
+	}
+}
+
+// honeytokenUsed warns of the use of the honeytoken and sends its alert.
+func (a *App) honeytokenUsed(use honeytoken.Use) {
+	t := use.Token
+	msg := fmt.Sprintf("the %s honeytoken %s, issued to %s for %s on %s, was used by %s", t.Kind, t.ID, t.Source, t.Path, t.Issued.Format(time.RFC3339), use.Source)
+	logger.Warnln(msg)
+	if a.Alerter != nil {
+		a.Alerter.Notify("honeytoken", msg)
+	}
+}
+
+// openCapture opens the packet capture of the traffic of the ports, read from
+// the interface served on if the configuration sets none.
+func openCapture(pc config.PacketCaptureConfig, ports []config.PortConfig) (*capture.Capturer, error) {
+	iface := pc.Interface
+	if iface == "" {
+		iface = args.Interface
+	}
+	cfg := capture.Config{
+		Interface:       iface,
+		CapturePorts:    pc.Ports,
+		FlaggedSessions: pc.FlaggedSessions,
+		Directory:       pc.Directory,
+		Snaplen:         pc.Snaplen,
+		MaxFileSize:     pc.MaxFileSize,
+		MaxDuration:     pc.MaxDuration,
+		Buffer:          pc.Buffer,
+	}
+	for _, p := range ports {
+		if !slices.Contains(cfg.Ports, p.Port) {
+			cfg.Ports = append(cfg.Ports, p.Port)
+		}
+	}
+	c, err := capture.Open(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the packet capture: %s", err)
+	}
+	return c, nil
+}
+
+// initFallback initializes the fallback chain of providers. Each provider
+// shares the primary's settings except for the ones set in its configuration,
+// and its model is wrapped like the primary's.
+func initFallback(ctx context.Context, providers []config.LLMProviderConfig, primary llm.Config, wrap func(llms.Model, string) llms.Model) (llm.Chain, error) {
+	var chain llm.Chain
+	for _, pc := range providers {
+		c := primary
+		c.Provider = pc.Provider
+		c.Model = pc.Model
+		c.ServerURL = pc.ServerURL
+		c.APIKey = pc.APIKey
+		if pc.APIKeyEnv != "" {
+			c.APIKey = os.Getenv(pc.APIKeyEnv)
+		}
+		c.CloudProject = pc.CloudProject
+		c.CloudLocation = pc.CloudLocation
+		c.Deployment = ""
+		c.Headers = nil
+
+		model, err := llm.New(ctx, c)
+		if err != nil {
+			return nil, fmt.Errorf("error initializing the fallback LLM client %s/%s: %s", c.Provider, c.Model, err)
+		}
+		chain = append(chain, llm.Provider{Config: c, Model: wrap(model, c.Model)})
+	}
+	return chain, nil
+}
+
+// initPersonas initializes the personas of the ports and of the virtual
+// hosts. A persona uses the primary provider, with its own model if set; the
+// models are wrapped like the primary's and shared by the personas using the
+// same one. models holds the initialized models by name.
+func initPersonas(ctx context.Context, cfg *config.Config, primary llm.Config, models map[string]llms.Model, wrap func(llms.Model, string) llms.Model) (map[uint16]*server.Persona, []server.VirtualHost, error) {
+	personas := make(map[uint16]*server.Persona)
+	for _, pc := range cfg.Ports {
+		if pc.Persona == nil {
+			continue
+		}
+		// The listeners of a port share its persona.
+		if _, ok := personas[pc.Port]; ok {
+			return nil, nil, fmt.Errorf("several personas for port %d", pc.Port)
+		}
+		p, err := newPersona(ctx, cfg, *pc.Persona, primary, models, wrap)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error initializing the persona of port %d: %s", pc.Port, err)
+		}
+		personas[pc.Port] = p
+	}
+
+	var vhosts []server.VirtualHost
+	for _, vc := range cfg.VirtualHosts {
+		if len(vc.Hosts) == 0 {
+			return nil, nil, fmt.Errorf("virtual host without hosts")
+		}
+		vcfg := *cfg
+		// The virtual hosts of a port have distinct responses.
+		vcfg.CacheKey.Headers = append([]string{"Host"}, cfg.CacheKey.Headers...)
+		p, err := newPersona(ctx, &vcfg, vc.PersonaConfig, primary, models, wrap)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error initializing the persona of virtual host %s: %s", vc.Hosts[0], err)
+		}
+		vhosts = append(vhosts, server.VirtualHost{Hosts: vc.Hosts, Persona: p})
+	}
+	return personas, vhosts, nil
+}
+
+// initRoutes initializes the model routes, whose models of the primary
+// provider are wrapped like the primary's and shared with the personas using
+// the same one. models holds the initialized models by name.
+func initRoutes(ctx context.Context, cfg config.ModelRoutingConfig, primary llm.Config, models map[string]llms.Model, wrap func(llms.Model, string) llms.Model) ([]server.ModelRoute, error) {
+	var routes []server.ModelRoute
+	for i, rc := range cfg.Routes {
+		if rc.Model == "" {
+			return nil, fmt.Errorf("model route %d (%q) without a model", i+1, rc.Name)
+		}
+		m, ok := models[rc.Model]
+		if !ok {
+			c := primary
+			c.Model = rc.Model
+			var err error
+			if m, err = llm.New(ctx, c); err != nil {
+				return nil, fmt.Errorf("error initializing the LLM client of model route %q: %s", rc.Name, err)
+			}
+			m = wrap(m, c.Model)
+			models[c.Model] = m
+		}
+		routes = append(routes, server.ModelRoute{Config: rc, Model: m})
+	}
+	return routes, nil
+}
+
+// newPersona returns the persona overriding the configuration and the primary
+// provider's settings. models holds the models by name.
+func newPersona(ctx context.Context, cfg *config.Config, pc config.PersonaConfig, primary llm.Config, models map[string]llms.Model, wrap func(llms.Model, string) llms.Model) (*server.Persona, error) {
+	pcfg := *cfg
+	if pc.SystemPrompt != "" {
+		pcfg.SystemPrompt = pc.SystemPrompt
+	}
+	if sp := pc.ServerProfile; sp.Name != "" || sp.Description != "" || len(sp.Headers) > 0 {
+		pcfg.ServerProfile = sp
+	}
+	if pc.ResponseLatency != nil {
+		pcfg.ResponseLatency = *pc.ResponseLatency
+	}
+	profile, err := llm.ResolveServerProfile(pcfg.ServerProfile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading the server profile: %s", err)
+	}
+
+	c := primary
+	if pc.Model != "" {
+		c.Model = pc.Model
+	}
+	if pc.Temperature != nil {
+		c.Temperature = *pc.Temperature
+	}
+	m, ok := models[c.Model]
+	if !ok {
+		if m, err = llm.New(ctx, c); err != nil {
+			return nil, fmt.Errorf("error initializing the LLM client: %s", err)
+		}
+		m = wrap(m, c.Model)
+		models[c.Model] = m
+	}
+
+	return &server.Persona{Config: &pcfg, LLMConfig: c, Model: m, Profile: profile}, nil
+}
+
+// parseHeaders parses "Name: value" headers into a map.
+func parseHeaders(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	headers := make(map[string]string, len(values))
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid LLM header %q, expected \"Name: value\"", v)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
 func logLevel(level string) error {
 	l, err := logrus.ParseLevel(level)
 	if err != nil {
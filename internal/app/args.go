@@ -1,17 +1,128 @@
 package app
 
+import (
+	"time"
+
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
 var args struct {
-	LLMProvider      string  `arg:"-p,--provider,env:LLM_PROVIDER,required" help:"LLM provider (openai, googleai, gcp-vertex, anthropic, cohere, ollama)"`
-	LLMModel         string  `arg:"-m,--model,env:LLM_MODEL,required" help:"LLM model (e.g. gpt-3.5-turbo-1106, gemini-1.5-pro-preview-0409)"`
-	LLMServerURL     string  `arg:"-u,--server-url,env:LLM_SERVER_URL" help:"LLM Server URL (required for Ollama)"`
-	LLMTemperature   float64 `arg:"-t,--temperature,env:LLM_TEMPERATURE" help:"LLM sampling temperature (0-2). Higher values make the output more random" default:"1"`
-	LLMAPIKey        string  `arg:"-k,--api-key,env:LLM_API_KEY" help:"LLM API Key"`
-	LLMCloudLocation string  `arg:"--cloud-location,env:LLM_CLOUD_LOCATION" help:"LLM cloud location region (required for GCP's Vertex AI)"`
-	LLMCloudProject  string  `arg:"--cloud-project,env:LLM_CLOUD_PROJECT" help:"LLM cloud project ID (required for GCP's Vertex AI)"`
-	Interface        string  `arg:"-i,--interface" help:"interface to serve on"`
-	ConfigFile       string  `arg:"-c,--config-file" help:"Path to config file" default:"config/config.yaml"`
-	EventLogFile     string  `arg:"-o,--event-log-file" help:"Path to event log file" default:"event_log.json"`
-	CacheDBFile      string  `arg:"-f,--cache-db-file" help:"Path to database file for response caching" default:"cache.db"`
-	CacheDuration    int     `arg:"-d,--cache-duration" help:"Cache duration for generated responses (in hours). Use 0 to disable caching, and -1 for unlimited caching (no expiration)." default:"24"`
-	LogLevel         string  `arg:"-l,--log-level" help:"Log level (debug, info, error, fatal)" default:"info"`
+	LLMProvider      string        `arg:"-p,--provider,env:LLM_PROVIDER,required" help:"LLM provider (openai, azure-openai, googleai, gcp-vertex, anthropic, cohere, ollama, bedrock, mistral, openai-compatible)"`
+	LLMModel         string        `arg:"-m,--model,env:LLM_MODEL,required" help:"LLM model (e.g. gpt-3.5-turbo-1106, gemini-1.5-pro-preview-0409)"`
+	LLMServerURL     string        `arg:"-u,--server-url,env:LLM_SERVER_URL" help:"LLM Server URL (required for Ollama and openai-compatible, and the endpoint for Azure OpenAI)"`
+	LLMTemperature   float64       `arg:"-t,--temperature,env:LLM_TEMPERATURE" help:"LLM sampling temperature (0-2). Higher values make the output more random" default:"1"`
+	LLMSeed          int           `arg:"--seed,env:LLM_SEED" help:"LLM sampling seed, so that the same prompts generate the same responses (openai, azure-openai, openai-compatible, ollama and mistral only). Use 0 for none." default:"0"`
+	LLMTopP          float64       `arg:"--top-p,env:LLM_TOP_P" help:"LLM nucleus sampling probability (anthropic, googleai, gcp-vertex, bedrock and ollama only). Use 0 for the provider's default." default:"0"`
+	LLMFrequency     float64       `arg:"--frequency-penalty,env:LLM_FREQUENCY_PENALTY" help:"LLM frequency penalty (-2 to 2) of the tokens by their count in the output (openai, azure-openai, openai-compatible and ollama only). Use 0 for the provider's default." default:"0"`
+	LLMPresence      float64       `arg:"--presence-penalty,env:LLM_PRESENCE_PENALTY" help:"LLM presence penalty (-2 to 2) of the tokens already in the output (openai, azure-openai, openai-compatible and ollama only). Use 0 for the provider's default." default:"0"`
+	LLMSafety        string        `arg:"--safety-threshold,env:LLM_SAFETY_THRESHOLD" help:"Threshold of the safety filters of the Gemini models, which otherwise block the responses to the exploit requests: block_none, block_only_high, block_medium_and_above or block_low_and_above (googleai and gcp-vertex only). Defaults to block_only_high."`
+	LLMStop          []string      `arg:"--stop,separate,env:LLM_STOP" help:"Sequence ending the LLM generation, e.g. the text some models append after the JSON object (not supported by cohere and mistral, can be repeated)"`
+	LLMAPIKey        string        `arg:"-k,--api-key,env:LLM_API_KEY" help:"LLM API Key"`
+	LLMHeaders       []string      `arg:"--llm-header,separate,env:LLM_HEADERS" help:"Extra HTTP header sent to the LLM server, as \"Name: value\" (openai-compatible only, can be repeated)"`
+	LLMDeployment    string        `arg:"--deployment,env:LLM_DEPLOYMENT" help:"Azure OpenAI deployment name (defaults to the model)"`
+	LLMAPIVersion    string        `arg:"--api-version,env:LLM_API_VERSION" help:"Azure OpenAI API version" default:"2024-02-01"`
+	LLMCloudLocation string        `arg:"--cloud-location,env:LLM_CLOUD_LOCATION" help:"LLM cloud location region (required for GCP's Vertex AI, and the AWS region for Bedrock)"`
+	LLMCloudProject  string        `arg:"--cloud-project,env:LLM_CLOUD_PROJECT" help:"LLM cloud project ID (required for GCP's Vertex AI)"`
+	LLMStream        bool          `arg:"--stream,env:LLM_STREAM" help:"Stream the LLM output and abort early if it is not JSON"`
+	LLMStreamAbort   int           `arg:"--stream-abort-threshold,env:LLM_STREAM_ABORT_THRESHOLD" help:"Number of streamed bytes without an opening JSON brace before aborting the generation. Use 0 to disable early abort." default:"64"`
+	LLMToolCalling   bool          `arg:"--tool-calling,env:LLM_TOOL_CALLING" help:"Request the response through a function call with a JSON schema instead of JSON mode (openai and azure-openai only)"`
+	LLMCorrections   int           `arg:"--json-corrections,env:LLM_JSON_CORRECTIONS" help:"Number of times an invalid JSON response is sent back to the LLM with the validation error to be corrected. Use 0 to disable corrections." default:"2"`
+	LLMHTMLContent   string        `arg:"--html-content,env:LLM_HTML_CONTENT" help:"Handling of the LLM outputs that are HTML documents instead of the JSON response: invalid_json (corrected like the other invalid JSON), body (served as the body of a text/html response) or provider_error (treated as a gateway error page, with the error policy's action for provider_response)" default:"invalid_json"`
+	LLMTimeout       time.Duration `arg:"--llm-timeout,env:LLM_TIMEOUT" help:"Maximum time to wait for each LLM call (e.g. 20s). On timeout, the error policy's action for llm_timeout is taken. Use 0 for no timeout." default:"0"`
+	LLMMaxTokens     int           `arg:"--max-tokens,env:LLM_MAX_TOKENS" help:"Maximum number of tokens the LLM may generate per response. Use 0 for the provider's default." default:"0"`
+	LLMMaxCost       float64       `arg:"--max-request-cost,env:LLM_MAX_REQUEST_COST" help:"Maximum estimated cost (in USD) of a single generation. The generations whose prompt alone reaches it are refused, and the number of output tokens is capped to stay under it, or with --stream the generation is cancelled when it is reached. Use 0 for no limit." default:"0"`
+	OllamaKeepAlive  string        `arg:"--ollama-keep-alive,env:OLLAMA_KEEP_ALIVE" help:"Time the Ollama model stays loaded in memory after each request (e.g. 30m), indefinitely if negative (e.g. -1). Defaults to the server's 5m."`
+	OllamaNumCtx     int           `arg:"--ollama-num-ctx,env:OLLAMA_NUM_CTX" help:"Context window of the Ollama model, in tokens. Use 0 for the server's default." default:"0"`
+	OllamaPreload    bool          `arg:"--ollama-preload,env:OLLAMA_PRELOAD" help:"Load the Ollama model into memory on startup, so that the first request doesn't wait for it to load"`
+	Interface        string        `arg:"-i,--interface" help:"interface to serve on"`
+	ConfigFile       string        `arg:"-c,--config-file" help:"Path to config file" default:"config/config.yaml"`
+	ConfigWatch      time.Duration `arg:"--config-watch,env:CONFIG_WATCH" help:"Interval (e.g. 5s) to check the config and static rules files for changes and reload them without restarting the listeners. Disabled if 0; SIGHUP always reloads them."`
+	ShutdownTimeout  time.Duration `arg:"--shutdown-timeout,env:SHUTDOWN_TIMEOUT" help:"Time given to the in-flight requests and LLM generations to complete on SIGTERM, before the event outputs are flushed." default:"30s"`
+	EventLogFile     string        `arg:"-o,--event-log-file" help:"Path to event log file" default:"event_log.json"`
+	EventLogFormat   string        `arg:"--event-log-format,env:EVENT_LOG_FORMAT" help:"Format of the event log: json, or ecs for the Elastic Common Schema" default:"json"`
+	CacheDBFile      string        `arg:"-f,--cache-db-file" help:"Path to database file for response caching" default:"cache.db"`
+	CacheRedisURL    string        `arg:"--cache-redis-url,env:CACHE_REDIS_URL" help:"URL of a Redis server (e.g. redis://:password@localhost:6379/0) to cache the responses in, instead of the cache database file, to share them between instances"`
+	CacheDuration    int           `arg:"-d,--cache-duration" help:"Cache duration for generated responses (in hours). Use 0 to disable caching, and -1 for unlimited caching (no expiration)." default:"24"`
+	EmbeddingModel   string        `arg:"--embedding-model,env:LLM_EMBEDDING_MODEL" help:"Embedding model of the LLM provider (e.g. text-embedding-3-small) used to reuse the cached responses of similar requests. Disabled if empty."`
+	MaxConcurrent    int           `arg:"--max-concurrent" help:"Maximum number of concurrent LLM generations. Use 0 for no limit." default:"0"`
+	MaxPerSource     int           `arg:"--max-concurrent-per-source" help:"Maximum number of concurrent LLM generations per source IP. Use 0 for no limit." default:"0"`
+	MaxQueue         int           `arg:"--max-queue,env:MAX_QUEUE" help:"Maximum number of LLM generations waiting for one of the --max-concurrent slots. Use 0 for no limit." default:"0"`
+	QueueTimeout     time.Duration `arg:"--queue-timeout,env:QUEUE_TIMEOUT" help:"Maximum time an LLM generation waits for one of the --max-concurrent slots (e.g. 10s). Use 0 for no timeout." default:"0"`
+	QueueOverflow    string        `arg:"--queue-overflow,env:QUEUE_OVERFLOW" help:"Response to the requests over the concurrency limits or the queue: unavailable (a 503), static (the previously generated response, even if expired, or the static response of the error policy) or drop (close the connection)" default:"unavailable"`
+	MaxTPM           int           `arg:"--max-tpm,env:LLM_MAX_TPM" help:"Maximum estimated number of LLM tokens per minute. Generations are delayed to stay under the limit. Use 0 for no limit." default:"0"`
+	BreakerThreshold int           `arg:"--breaker-threshold" help:"Number of consecutive failures of an LLM provider after which it is no longer called until the cooldown elapses. Use 0 to disable the circuit breaker." default:"0"`
+	BreakerCooldown  time.Duration `arg:"--breaker-cooldown" help:"Time an LLM provider is not called after its circuit breaker opens (e.g. 30s)." default:"30s"`
+	SignatureStats   int           `arg:"--signature-stats" help:"Number of distinct generated responses to track for duplicate analysis. Use 0 to disable tracking." default:"0"`
+	StatsAddr        string        `arg:"--stats-addr" help:"Address (e.g. 127.0.0.1:8889) to serve the token usage, estimated cost and response statistics on, at /stats, and the cache management API, at /cache, authenticated with --admin-token (not served without it). Disabled if empty."`
+	MetricsAddr      string        `arg:"--metrics-addr,env:METRICS_ADDR" help:"Address (e.g. 127.0.0.1:9090) to serve the Prometheus metrics on, at /metrics. Disabled if empty."`
+	ManagementAddr   string        `arg:"--management-addr,env:MANAGEMENT_ADDR" help:"Address (e.g. 0.0.0.0:8888) to serve the health and readiness checks on, at /healthz and /readyz. Disabled if empty."`
+	AdminAddr        string        `arg:"--admin-addr,env:ADMIN_ADDR" help:"Address (e.g. 127.0.0.1:8890) to serve the admin API on, at /api, to query the stats and recent events, flush the cache, toggle the personas and switch the model at runtime. Disabled if empty."`
+	AdminToken       string        `arg:"--admin-token,env:ADMIN_TOKEN" help:"Token required by the admin API and the dashboard, as a bearer token or the password of the basic authentication."`
+	Dashboard        bool          `arg:"--dashboard,env:DASHBOARD" help:"Serve the web dashboard of the events on the management address, at /dashboard/."`
+	GeoIPCityDB      string        `arg:"--geoip-city-db,env:GEOIP_CITY_DB" help:"Path to a MaxMind or DB-IP city (or country) database, in the MMDB format, to add the country and city of the source IPs to the events"`
+	GeoIPASNDB       string        `arg:"--geoip-asn-db,env:GEOIP_ASN_DB" help:"Path to a MaxMind or DB-IP ASN database, in the MMDB format, to add the autonomous system number and organization of the source IPs to the events"`
+	LogLevel         string        `arg:"-l,--log-level" help:"Log level (debug, info, error, fatal)" default:"info"`
+}
+
+// llmArgs are the settings of the LLM provider of the offline commands.
+type llmArgs struct {
+	LLMProvider      string        `arg:"-p,--provider,env:LLM_PROVIDER,required" help:"LLM provider (openai, azure-openai, googleai, gcp-vertex, anthropic, cohere, ollama, bedrock, mistral, openai-compatible)"`
+	LLMModel         string        `arg:"-m,--model,env:LLM_MODEL,required" help:"LLM model (e.g. gpt-3.5-turbo-1106, gemini-1.5-pro-preview-0409)"`
+	LLMServerURL     string        `arg:"-u,--server-url,env:LLM_SERVER_URL" help:"LLM Server URL (required for Ollama and openai-compatible, and the endpoint for Azure OpenAI)"`
+	LLMTemperature   float64       `arg:"-t,--temperature,env:LLM_TEMPERATURE" help:"LLM sampling temperature (0-2). Higher values make the output more random" default:"1"`
+	LLMSeed          int           `arg:"--seed,env:LLM_SEED" help:"LLM sampling seed (openai, azure-openai, openai-compatible, ollama and mistral only). Use 0 for none." default:"0"`
+	LLMTopP          float64       `arg:"--top-p,env:LLM_TOP_P" help:"LLM nucleus sampling probability (anthropic, googleai, gcp-vertex, bedrock and ollama only). Use 0 for the provider's default." default:"0"`
+	LLMFrequency     float64       `arg:"--frequency-penalty,env:LLM_FREQUENCY_PENALTY" help:"LLM frequency penalty (-2 to 2) of the tokens by their count in the output (openai, azure-openai, openai-compatible and ollama only). Use 0 for the provider's default." default:"0"`
+	LLMPresence      float64       `arg:"--presence-penalty,env:LLM_PRESENCE_PENALTY" help:"LLM presence penalty (-2 to 2) of the tokens already in the output (openai, azure-openai, openai-compatible and ollama only). Use 0 for the provider's default." default:"0"`
+	LLMSafety        string        `arg:"--safety-threshold,env:LLM_SAFETY_THRESHOLD" help:"Threshold of the safety filters of the Gemini models, which otherwise block the responses to the exploit requests: block_none, block_only_high, block_medium_and_above or block_low_and_above (googleai and gcp-vertex only). Defaults to block_only_high."`
+	LLMStop          []string      `arg:"--stop,separate,env:LLM_STOP" help:"Sequence ending the LLM generation, e.g. the text some models append after the JSON object (not supported by cohere and mistral, can be repeated)"`
+	LLMAPIKey        string        `arg:"-k,--api-key,env:LLM_API_KEY" help:"LLM API Key"`
+	LLMHeaders       []string      `arg:"--llm-header,separate,env:LLM_HEADERS" help:"Extra HTTP header sent to the LLM server, as \"Name: value\" (openai-compatible only, can be repeated)"`
+	LLMDeployment    string        `arg:"--deployment,env:LLM_DEPLOYMENT" help:"Azure OpenAI deployment name (defaults to the model)"`
+	LLMAPIVersion    string        `arg:"--api-version,env:LLM_API_VERSION" help:"Azure OpenAI API version" default:"2024-02-01"`
+	LLMCloudLocation string        `arg:"--cloud-location,env:LLM_CLOUD_LOCATION" help:"LLM cloud location region (required for GCP's Vertex AI, and the AWS region for Bedrock)"`
+	LLMCloudProject  string        `arg:"--cloud-project,env:LLM_CLOUD_PROJECT" help:"LLM cloud project ID (required for GCP's Vertex AI)"`
+	LLMToolCalling   bool          `arg:"--tool-calling,env:LLM_TOOL_CALLING" help:"Request the response through a function call with a JSON schema instead of JSON mode (openai and azure-openai only)"`
+	LLMCorrections   int           `arg:"--json-corrections,env:LLM_JSON_CORRECTIONS" help:"Number of times an invalid JSON response is sent back to the LLM with the validation error to be corrected" default:"2"`
+	LLMHTMLContent   string        `arg:"--html-content,env:LLM_HTML_CONTENT" help:"Handling of the LLM outputs that are HTML documents instead of the JSON response: invalid_json, body or provider_error" default:"invalid_json"`
+	LLMTimeout       time.Duration `arg:"--llm-timeout,env:LLM_TIMEOUT" help:"Maximum time to wait for each LLM call (e.g. 20s). Use 0 for no timeout." default:"0"`
+	LLMMaxTokens     int           `arg:"--max-tokens,env:LLM_MAX_TOKENS" help:"Maximum number of tokens the LLM may generate per response. Use 0 for the provider's default." default:"0"`
+	OllamaKeepAlive  string        `arg:"--ollama-keep-alive,env:OLLAMA_KEEP_ALIVE" help:"Time the Ollama model stays loaded in memory after each request (e.g. 30m), indefinitely if negative (e.g. -1). Defaults to the server's 5m."`
+	OllamaNumCtx     int           `arg:"--ollama-num-ctx,env:OLLAMA_NUM_CTX" help:"Context window of the Ollama model, in tokens. Use 0 for the server's default." default:"0"`
+}
+
+// modelConfig returns the configuration of the LLM provider of the arguments.
+func (a llmArgs) modelConfig() (llm.Config, error) {
+	headers, err := parseHeaders(a.LLMHeaders)
+	if err != nil {
+		return llm.Config{}, err
+	}
+	if err := llm.CheckHTMLContent(a.LLMHTMLContent); err != nil {
+		return llm.Config{}, err
+	}
+	return llm.Config{
+		Provider:         a.LLMProvider,
+		Model:            a.LLMModel,
+		ServerURL:        a.LLMServerURL,
+		Temperature:      a.LLMTemperature,
+		Seed:             a.LLMSeed,
+		TopP:             a.LLMTopP,
+		FrequencyPenalty: a.LLMFrequency,
+		PresencePenalty:  a.LLMPresence,
+		StopSequences:    a.LLMStop,
+		SafetyThreshold:  a.LLMSafety,
+		KeepAlive:        a.OllamaKeepAlive,
+		NumCtx:           a.OllamaNumCtx,
+		APIKey:           a.LLMAPIKey,
+		CloudProject:     a.LLMCloudProject,
+		CloudLocation:    a.LLMCloudLocation,
+		Deployment:       a.LLMDeployment,
+		APIVersion:       a.LLMAPIVersion,
+		Headers:          headers,
+		MaxTokens:        a.LLMMaxTokens,
+		Timeout:          a.LLMTimeout,
+		ToolCalling:      a.LLMToolCalling,
+		JSONCorrections:  a.LLMCorrections,
+		HTMLContent:      a.LLMHTMLContent,
+	}, nil
 }
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/alexflint/go-arg"
+)
+
+type cacheFilterArgs struct {
+	Port   string `arg:"--port" help:"Only the responses of the port"`
+	Method string `arg:"--method" help:"Only the responses of the method"`
+	Path   string `arg:"--path" help:"Only the responses of the paths matching the pattern (e.g. /wp-*)"`
+	Host   string `arg:"--host" help:"Only the responses generated for the host"`
+	Source string `arg:"--source" help:"Only the responses generated for the source IP"`
+}
+
+func (f cacheFilterArgs) filter() cache.Filter {
+	return cache.Filter{Port: f.Port, Method: f.Method, Path: f.Path, Host: f.Host, Source: f.Source}
+}
+
+type cacheArgs struct {
+	List          *cacheFilterArgs `arg:"subcommand:list" help:"List the cached responses"`
+	Purge         *cacheFilterArgs `arg:"subcommand:purge" help:"Invalidate the cached responses; all of them without filters"`
+	CacheDBFile   string           `arg:"-f,--cache-db-file" help:"Path to database file for response caching" default:"cache.db"`
+	CacheRedisURL string           `arg:"--cache-redis-url,env:CACHE_REDIS_URL" help:"URL of the Redis server the responses are cached in"`
+}
+
+// RunCache runs the cache management command ("galah cache") with the given
+// command-line arguments.
+func RunCache(argv []string) error {
+	var a cacheArgs
+	p, err := arg.NewParser(arg.Config{Program: "galah cache"}, &a)
+	if err != nil {
+		return err
+	}
+	if err := p.Parse(argv); err != nil {
+		if err == arg.ErrHelp {
+			p.WriteHelp(os.Stdout)
+			return nil
+		}
+		p.WriteUsage(os.Stderr)
+		return err
+	}
+	if p.Subcommand() == nil {
+		p.WriteUsage(os.Stderr)
+		return fmt.Errorf("a command is required")
+	}
+
+	var store cache.Store
+	if a.CacheRedisURL != "" {
+		store, err = cache.NewRedisStore(a.CacheRedisURL, 0)
+	} else {
+		store, err = cache.InitializeCache(a.CacheDBFile)
+	}
+	if err != nil {
+		return fmt.Errorf("error opening the cache: %s", err)
+	}
+	defer store.Close()
+
+	switch {
+	case a.List != nil:
+		entries, err := cache.List(store, a.List.filter())
+		if err != nil {
+			return err
+		}
+		printCacheEntries(os.Stdout, entries)
+	case a.Purge != nil:
+		n, err := cache.InvalidateMatching(store, a.Purge.filter())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("invalidated %d cached responses\n", n)
+	}
+	return nil
+}
+
+func printCacheEntries(w io.Writer, entries []cache.Entry) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CACHED AT\tKEY\tHOST\tSOURCE\tSIZE")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", e.CachedAt.Format(time.RFC3339), e.Key, e.Host, e.Source, e.Size)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRunCache(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "cache.db")
+	store, err := cache.InitializeCache(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"8080_/admin", "8080_POST /login", "8443_/wp-login.php"} {
+		if err := store.Set(cache.Entry{Key: key, Source: "203.0.113.7", CachedAt: time.Now()}, []byte(`{"body": "ok"}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	// The commands share the cache database, in their order.
+	tests := []struct {
+		name      string
+		argv      []string
+		wantErr   string
+		wantOut   []string
+		unwantOut []string
+	}{
+		{name: "help", argv: []string{"--help"}, wantOut: []string{"Usage: galah cache"}},
+		{name: "noCommand", argv: []string{"-f", dbFile}, wantErr: "a command is required"},
+		{name: "unknownCommand", argv: []string{"-f", dbFile, "show"}, wantErr: "show"},
+		{name: "list", argv: []string{"-f", dbFile, "list"}, wantOut: []string{"CACHED AT", "8080_/admin", "8080_POST /login", "8443_/wp-login.php"}},
+		{name: "listPath", argv: []string{"-f", dbFile, "list", "--path", "/wp-*"}, wantOut: []string{"8443_/wp-login.php"}, unwantOut: []string{"8080_/admin"}},
+		{name: "listMethod", argv: []string{"-f", dbFile, "list", "--method", "post"}, wantOut: []string{"8080_POST /login"}, unwantOut: []string{"8080_/admin"}},
+		{name: "purgePort", argv: []string{"-f", dbFile, "purge", "--port", "8080"}, wantOut: []string{"invalidated 2 cached responses"}},
+		{name: "listPurged", argv: []string{"-f", dbFile, "list"}, wantOut: []string{"8443_/wp-login.php"}, unwantOut: []string{"8080_"}},
+		{name: "purgeAll", argv: []string{"-f", dbFile, "purge"}, wantOut: []string{"invalidated 1 cached responses"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := captureStdout(t, func() error { return RunCache(tt.argv) })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RunCache() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("RunCache() error = %v", err)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out, want) {
+					t.Errorf("output = %q, want %q in it", out, want)
+				}
+			}
+			for _, unwant := range tt.unwantOut {
+				if strings.Contains(out, unwant) {
+					t.Errorf("output = %q, want no %q in it", out, unwant)
+				}
+			}
+		})
+	}
+}
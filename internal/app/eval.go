@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/eval"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/alexflint/go-arg"
+)
+
+type evalArgs struct {
+	Corpus string `arg:"positional,required" help:"Path to a raw HTTP request file, or a directory of them (the recorded fixtures, .json files, are also replayed)"`
+	llmArgs
+	ConfigFile     string  `arg:"-c,--config-file" help:"Path to the config file of the prompts to evaluate" default:"config/config.yaml"`
+	Output         string  `arg:"-w,--output" help:"Path to the JSON report file to write. The report is printed if empty."`
+	MinValid       float64 `arg:"--min-valid" help:"Minimum ratio (0-1) of valid JSON responses, under which the evaluation fails" default:"0"`
+	MinHeaderScore float64 `arg:"--min-header-score" help:"Minimum mean header plausibility score (0-1) of the valid responses, under which the evaluation fails" default:"0"`
+}
+
+// RunEval runs the offline evaluation command ("galah eval") with the given
+// command-line arguments.
+func RunEval(argv []string) error {
+	var a evalArgs
+	p, err := arg.NewParser(arg.Config{Program: "galah eval"}, &a)
+	if err != nil {
+		return err
+	}
+	if err := p.Parse(argv); err != nil {
+		if err == arg.ErrHelp {
+			p.WriteHelp(os.Stdout)
+			return nil
+		}
+		p.WriteUsage(os.Stderr)
+		return err
+	}
+
+	cfg, err := config.LoadConfig(a.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("error loading config: %s", err)
+	}
+	corpus, err := eval.LoadCorpus(a.Corpus)
+	if err != nil {
+		return fmt.Errorf("error loading the corpus: %s", err)
+	}
+	if len(corpus) == 0 {
+		return fmt.Errorf("no requests in the corpus %s", a.Corpus)
+	}
+	modelConfig, err := a.modelConfig()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	model, err := llm.New(ctx, modelConfig)
+	if err != nil {
+		return fmt.Errorf("error initializing the LLM client: %s", err)
+	}
+
+	report := eval.Run(ctx, eval.Config{Config: cfg, LLMConfig: modelConfig, Model: model}, corpus)
+
+	var out io.Writer = os.Stdout
+	if a.Output != "" {
+		f, err := os.Create(a.Output)
+		if err != nil {
+			return fmt.Errorf("error creating the report file: %s", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return fmt.Errorf("error writing the report: %s", err)
+	}
+
+	s := report.Summary
+	fmt.Fprintf(os.Stderr, "evaluated %d requests: %d valid (%.1f%%), header score %.2f, latency mean %s, p50 %s, p95 %s, max %s\n",
+		s.Requests, s.Valid, 100*s.ValidRatio, s.HeaderScore,
+		s.LatencyMean.Round(time.Millisecond), s.LatencyP50.Round(time.Millisecond), s.LatencyP95.Round(time.Millisecond), s.LatencyMax.Round(time.Millisecond))
+	if s.ValidRatio < a.MinValid {
+		return fmt.Errorf("the ratio of valid responses %.2f is under the minimum %.2f", s.ValidRatio, a.MinValid)
+	}
+	if s.HeaderScore < a.MinHeaderScore {
+		return fmt.Errorf("the header score %.2f is under the minimum %.2f", s.HeaderScore, a.MinHeaderScore)
+	}
+	return nil
+}
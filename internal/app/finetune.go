@@ -0,0 +1,77 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/finetune"
+	"github.com/alexflint/go-arg"
+)
+
+type finetuneArgs struct {
+	cacheFilterArgs
+	LLMProvider     string `arg:"-p,--provider" help:"LLM provider of the model to fine-tune, whose prompts are exported (e.g. ollama, openai)" default:"ollama"`
+	ConfigFile      string `arg:"-c,--config-file" help:"Path to the config file of the prompts" default:"config/config.yaml"`
+	CacheDBFile     string `arg:"-f,--cache-db-file" help:"Path to database file for response caching" default:"cache.db"`
+	CacheRedisURL   string `arg:"--cache-redis-url,env:CACHE_REDIS_URL" help:"URL of the Redis server the responses are cached in"`
+	Output          string `arg:"-w,--output" help:"Path to the JSONL file to write. The examples are printed if empty."`
+	MaxResponseSize int    `arg:"--max-response-size" help:"Maximum size, in bytes, of the exported responses. Use 0 for no limit." default:"0"`
+}
+
+// RunFinetune runs the fine-tuning dataset export command ("galah
+// finetune") with the given command-line arguments.
+func RunFinetune(argv []string) error {
+	var a finetuneArgs
+	p, err := arg.NewParser(arg.Config{Program: "galah finetune"}, &a)
+	if err != nil {
+		return err
+	}
+	if err := p.Parse(argv); err != nil {
+		if err == arg.ErrHelp {
+			p.WriteHelp(os.Stdout)
+			return nil
+		}
+		p.WriteUsage(os.Stderr)
+		return err
+	}
+
+	cfg, err := config.LoadConfig(a.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("error loading config: %s", err)
+	}
+	var store cache.Store
+	if a.CacheRedisURL != "" {
+		store, err = cache.NewRedisStore(a.CacheRedisURL, 0)
+	} else {
+		store, err = cache.InitializeCache(a.CacheDBFile)
+	}
+	if err != nil {
+		return fmt.Errorf("error opening the cache: %s", err)
+	}
+	defer store.Close()
+
+	var out io.Writer = os.Stdout
+	if a.Output != "" {
+		f, err := os.Create(a.Output)
+		if err != nil {
+			return fmt.Errorf("error creating the dataset file: %s", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	stats, err := finetune.Export(store, out, finetune.Config{
+		Config:          cfg,
+		Provider:        a.LLMProvider,
+		Filter:          a.filter(),
+		MaxResponseSize: a.MaxResponseSize,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d examples (skipped %d invalid, %d too large and %d duplicate responses)\n",
+		stats.Exported, stats.Invalid, stats.TooLarge, stats.Duplicates)
+	return nil
+}
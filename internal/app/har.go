@@ -0,0 +1,70 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/0x4d31/galah/internal/har"
+	"github.com/alexflint/go-arg"
+)
+
+type harArgs struct {
+	EventLogFile string `arg:"-o,--event-log-file" help:"Path to event log file (in the json format)" default:"event_log.json"`
+	Output       string `arg:"-w,--output" help:"Path to the HAR file to write. The HAR log is printed if empty."`
+	SrcIP        string `arg:"--src-ip" help:"Only export the requests of this source IP"`
+	Session      string `arg:"--session" help:"Only export the requests of this session ID (see the sessions configuration)"`
+	Host         string `arg:"--host" help:"Host (and port) of the URLs of the requests. Defaults to the sensor name and port of the events."`
+}
+
+// RunHAR runs the HAR export command ("galah har") with the given
+// command-line arguments.
+func RunHAR(argv []string) error {
+	var a harArgs
+	p, err := arg.NewParser(arg.Config{Program: "galah har"}, &a)
+	if err != nil {
+		return err
+	}
+	if err := p.Parse(argv); err != nil {
+		if err == arg.ErrHelp {
+			p.WriteHelp(os.Stdout)
+			return nil
+		}
+		p.WriteUsage(os.Stderr)
+		return err
+	}
+
+	in, err := os.Open(a.EventLogFile)
+	if err != nil {
+		return fmt.Errorf("error opening the event log: %s", err)
+	}
+	defer in.Close()
+
+	archive, err := har.FromEventLog(in, har.Config{
+		SrcIP:   a.SrcIP,
+		Session: a.Session,
+		Host:    a.Host,
+		Version: version,
+	})
+	if err != nil {
+		return fmt.Errorf("error reading the event log: %s", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if a.Output != "" {
+		f, err := os.Create(a.Output)
+		if err != nil {
+			return fmt.Errorf("error creating the HAR file: %s", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(archive); err != nil {
+		return fmt.Errorf("error writing the HAR log: %s", err)
+	}
+	fmt.Fprintf(os.Stderr, "exported %d requests\n", len(archive.Log.Entries))
+	return nil
+}
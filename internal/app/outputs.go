@@ -0,0 +1,281 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/0x4d31/galah/internal/alert"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/eventstore"
+	"github.com/0x4d31/galah/internal/kafka"
+	el "github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/internal/s3"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	s3UploadTimeout = 5 * time.Minute
+	s3UploadRetries = 3
+)
+
+// addEventOutputs adds the hooks sending the events to the outputs of the
+// configuration, in addition to the event log file. The event store of the
+// database output is kept in a.EventStore.
+func (a *App) addEventOutputs(eventLogger *el.Logger, outputs config.EventOutputsConfig) error {
+	if sc := outputs.Syslog; sc.Address != "" {
+		hook, err := el.NewSyslogHook(el.SyslogConfig{
+			Network:            sc.Network,
+			Address:            sc.Address,
+			Format:             sc.Format,
+			Facility:           sc.Facility,
+			AppName:            sc.AppName,
+			CAFile:             sc.CAFile,
+			InsecureSkipVerify: sc.InsecureSkipVerify,
+			Version:            version,
+		}, logger)
+		if err != nil {
+			return err
+		}
+		eventLogger.EventLogger.AddHook(hook)
+	}
+	if kc := outputs.Kafka; len(kc.Brokers) > 0 {
+		acks := kafka.AcksLeader
+		switch kc.Acks {
+		case "", "leader":
+		case "all":
+			acks = kafka.AcksAll
+		case "none":
+			acks = kafka.AcksNone
+		default:
+			return fmt.Errorf("invalid Kafka acks %q (leader, all or none)", kc.Acks)
+		}
+		var sasl *kafka.SASL
+		if kc.SASL.Mechanism != "" {
+			password := kc.SASL.Password
+			if kc.SASL.PasswordEnv != "" {
+				password = os.Getenv(kc.SASL.PasswordEnv)
+			}
+			sasl = &kafka.SASL{Mechanism: kc.SASL.Mechanism, Username: kc.SASL.Username, Password: password}
+		}
+		hook, err := el.NewKafkaHook(el.KafkaConfig{
+			Brokers:            kc.Brokers,
+			Topic:              kc.Topic,
+			Acks:               acks,
+			Format:             kc.Format,
+			BatchSize:          kc.BatchSize,
+			FlushInterval:      kc.FlushInterval,
+			TLS:                kc.TLS.Enabled,
+			CAFile:             kc.TLS.CAFile,
+			InsecureSkipVerify: kc.TLS.InsecureSkipVerify,
+			SASL:               sasl,
+			Version:            version,
+		}, logger)
+		if err != nil {
+			return err
+		}
+		eventLogger.EventLogger.AddHook(hook)
+	}
+	if ec := outputs.Elasticsearch; ec.URL != "" {
+		password, apiKey := ec.Password, ec.APIKey
+		if ec.PasswordEnv != "" {
+			password = os.Getenv(ec.PasswordEnv)
+		}
+		if ec.APIKeyEnv != "" {
+			apiKey = os.Getenv(ec.APIKeyEnv)
+		}
+		hook, err := el.NewElasticsearchHook(el.ElasticsearchConfig{
+			URL:                ec.URL,
+			Index:              ec.Index,
+			IndexDateFormat:    ec.IndexDateFormat,
+			Format:             ec.Format,
+			SkipTemplate:       ec.SkipTemplate,
+			BatchSize:          ec.BatchSize,
+			FlushInterval:      ec.FlushInterval,
+			MaxRetries:         ec.MaxRetries,
+			Username:           ec.Username,
+			Password:           password,
+			APIKey:             apiKey,
+			CAFile:             ec.CAFile,
+			InsecureSkipVerify: ec.InsecureSkipVerify,
+		}, logger)
+		if err != nil {
+			return err
+		}
+		eventLogger.EventLogger.AddHook(hook)
+	}
+	if dc := outputs.Database; dc.Driver != "" {
+		dsn := dc.DSN
+		if dc.DSNEnv != "" {
+			dsn = os.Getenv(dc.DSNEnv)
+		}
+		store, err := eventstore.Open(dc.Driver, dsn, dc.SessionTimeout)
+		if err != nil {
+			return fmt.Errorf("error opening the event store: %w", err)
+		}
+		eventLogger.EventLogger.AddHook(el.NewEventStoreHook(store, logger))
+		a.EventStore = store
+	}
+	if gc := outputs.GRPC; gc.Address != "" {
+		token := gc.Token
+		if gc.TokenEnv != "" {
+			token = os.Getenv(gc.TokenEnv)
+		}
+		if token == "" {
+			logger.Warnln("the gRPC event stream has no token, any client can stream the events")
+		}
+		hook, err := el.NewGRPCHook(el.GRPCConfig{
+			Address:     gc.Address,
+			Token:       token,
+			Certificate: gc.Certificate,
+			Key:         gc.Key,
+			Buffer:      gc.Buffer,
+		}, logger)
+		if err != nil {
+			return err
+		}
+		eventLogger.EventLogger.AddHook(hook)
+	}
+	return nil
+}
+
+// addAlerts adds the hook sending the alerts of the configuration, enabled if
+// rules or webhooks are set. The webhooks without rules get the alerts of the
+// honeypot itself, such as the budget alerts.
+func (a *App) addAlerts(eventLogger *el.Logger, ac config.AlertsConfig) error {
+	if len(ac.Rules) == 0 && len(ac.Webhooks) == 0 {
+		return nil
+	}
+	sensor, _ := os.Hostname()
+	cfg := alert.Config{
+		Throttle:     ac.Throttle,
+		MaxPerMinute: ac.MaxPerMinute,
+		Sensor:       sensor,
+	}
+	for _, wc := range ac.Webhooks {
+		url := wc.URL
+		if wc.URLEnv != "" {
+			url = os.Getenv(wc.URLEnv)
+		}
+		cfg.Webhooks = append(cfg.Webhooks, alert.Webhook{Type: wc.Type, URL: url})
+	}
+	for _, rc := range ac.Rules {
+		cfg.Rules = append(cfg.Rules, alert.Rule{
+			Name:       rc.Name,
+			NewCountry: rc.NewCountry,
+			Tags:       rc.Tags,
+			Path:       rc.Path,
+			Throttle:   rc.Throttle,
+		})
+	}
+	alerter, err := alert.New(cfg, logger)
+	if err != nil {
+		return err
+	}
+	eventLogger.EventLogger.AddHook(alerter)
+	a.Alerter = alerter
+	return nil
+}
+
+// redactConfig returns the redaction of the events of the configuration, of
+// the default headers and fields if none is set.
+func redactConfig(rc config.RedactionConfig) el.RedactConfig {
+	cfg := el.RedactConfig{
+		Headers:     rc.Headers,
+		Fields:      rc.Fields,
+		Patterns:    rc.Patterns,
+		Replacement: rc.Replacement,
+	}
+	if len(cfg.Headers) == 0 {
+		cfg.Headers = el.DefaultRedactedHeaders
+	}
+	if len(cfg.Fields) == 0 {
+		cfg.Fields = el.DefaultRedactedFields
+	}
+	return cfg
+}
+
+// rotateConfig returns the rotation of the event log of the configuration,
+// uploading the rotated files to S3 if a bucket is set.
+func rotateConfig(rc config.RotationConfig, logger *logrus.Logger) (el.RotateConfig, error) {
+	cfg := el.RotateConfig{
+		MaxSize:    int64(rc.MaxSizeMB) << 20,
+		Interval:   rc.Interval,
+		MaxBackups: rc.MaxBackups,
+		Compress:   rc.Compress,
+	}
+	sc := rc.S3
+	if sc.Bucket == "" {
+		return cfg, nil
+	}
+	client := &s3.Client{
+		Endpoint:   sc.Endpoint,
+		Region:     sc.Region,
+		Bucket:     sc.Bucket,
+		PathStyle:  sc.PathStyle,
+		HTTPClient: &http.Client{Timeout: s3UploadTimeout},
+	}
+	accessKeyID, secretAccessKey, sessionToken := sc.AccessKeyID, sc.SecretAccessKey, ""
+	if sc.AccessKeyIDEnv != "" {
+		accessKeyID = os.Getenv(sc.AccessKeyIDEnv)
+	}
+	if sc.SecretAccessKeyEnv != "" {
+		secretAccessKey = os.Getenv(sc.SecretAccessKeyEnv)
+	}
+	if sc.SessionTokenEnv != "" {
+		sessionToken = os.Getenv(sc.SessionTokenEnv)
+	}
+	if accessKeyID != "" {
+		client.Credentials = credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, sessionToken)
+	} else {
+		// The credentials are otherwise loaded from the standard AWS
+		// credential chain, as for Bedrock.
+		var loadOpts []func(*awsconfig.LoadOptions) error
+		if sc.Region != "" {
+			loadOpts = append(loadOpts, awsconfig.WithRegion(sc.Region))
+		}
+		awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), loadOpts...)
+		if err != nil {
+			return cfg, fmt.Errorf("error loading the AWS configuration: %w", err)
+		}
+		client.Credentials = awsCfg.Credentials
+		if client.Region == "" {
+			client.Region = awsCfg.Region
+		}
+	}
+	cfg.Archive = func(path string) error {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		contentType := "application/x-ndjson"
+		if strings.HasSuffix(path, ".gz") {
+			contentType = "application/gzip"
+		}
+		key := sc.Prefix + filepath.Base(path)
+		// The uploads are retried, as the rotated file is otherwise only
+		// uploaded by hand.
+		for attempt := 0; ; attempt++ {
+			err = client.PutObject(context.Background(), key, body, contentType)
+			if err == nil || attempt == s3UploadRetries {
+				break
+			}
+			time.Sleep(time.Duration(attempt+1) * 5 * time.Second)
+		}
+		if err != nil {
+			return fmt.Errorf("error uploading to s3://%s/%s: %w", sc.Bucket, key, err)
+		}
+		logger.Infof("uploaded the rotated event log to s3://%s/%s", sc.Bucket, key)
+		if sc.DeleteAfterUpload {
+			return os.Remove(path)
+		}
+		return nil
+	}
+	return cfg, nil
+}
@@ -0,0 +1,180 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	el "github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAddEventOutputs(t *testing.T) {
+	logger = logrus.New()
+	logger.SetOutput(io.Discard)
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer es.Close()
+	dir := t.TempDir()
+
+	tests := []struct {
+		name       string
+		outputs    config.EventOutputsConfig
+		wantHooks  int
+		wantErr    bool
+		wantStored bool
+	}{
+		{name: "none"},
+		{
+			name:      "syslog",
+			outputs:   config.EventOutputsConfig{Syslog: config.SyslogOutputConfig{Address: "127.0.0.1:514"}},
+			wantHooks: 1,
+		},
+		{
+			name:    "syslogUnknownNetwork",
+			outputs: config.EventOutputsConfig{Syslog: config.SyslogOutputConfig{Address: "127.0.0.1:514", Network: "sctp"}},
+			wantErr: true,
+		},
+		{
+			name:      "kafka",
+			outputs:   config.EventOutputsConfig{Kafka: config.KafkaOutputConfig{Brokers: []string{"127.0.0.1:9092"}, Topic: "galah", Acks: "all"}},
+			wantHooks: 1,
+		},
+		{
+			name:    "kafkaInvalidAcks",
+			outputs: config.EventOutputsConfig{Kafka: config.KafkaOutputConfig{Brokers: []string{"127.0.0.1:9092"}, Topic: "galah", Acks: "some"}},
+			wantErr: true,
+		},
+		{
+			name:    "kafkaNoTopic",
+			outputs: config.EventOutputsConfig{Kafka: config.KafkaOutputConfig{Brokers: []string{"127.0.0.1:9092"}}},
+			wantErr: true,
+		},
+		{
+			name:      "elasticsearch",
+			outputs:   config.EventOutputsConfig{Elasticsearch: config.ElasticsearchOutputConfig{URL: es.URL}},
+			wantHooks: 1,
+		},
+		{
+			name:    "elasticsearchUnknownFormat",
+			outputs: config.EventOutputsConfig{Elasticsearch: config.ElasticsearchOutputConfig{URL: es.URL, Format: "cef"}},
+			wantErr: true,
+		},
+		{
+			name:       "database",
+			outputs:    config.EventOutputsConfig{Database: config.DatabaseOutputConfig{Driver: "sqlite3", DSN: filepath.Join(dir, "events.db")}},
+			wantHooks:  1,
+			wantStored: true,
+		},
+		{
+			name:    "databaseUnsupportedDriver",
+			outputs: config.EventOutputsConfig{Database: config.DatabaseOutputConfig{Driver: "mysql"}},
+			wantErr: true,
+		},
+		{
+			name:      "grpc",
+			outputs:   config.EventOutputsConfig{GRPC: config.GRPCOutputConfig{Address: "127.0.0.1:0", Token: "secret"}},
+			wantHooks: 1,
+		},
+		{
+			name:    "grpcMissingCertificate",
+			outputs: config.EventOutputsConfig{GRPC: config.GRPCOutputConfig{Address: "127.0.0.1:0", Certificate: filepath.Join(dir, "missing.pem"), Key: filepath.Join(dir, "missing.key")}},
+			wantErr: true,
+		},
+		{
+			name: "all",
+			outputs: config.EventOutputsConfig{
+				Syslog:   config.SyslogOutputConfig{Address: "127.0.0.1:514"},
+				Kafka:    config.KafkaOutputConfig{Brokers: []string{"127.0.0.1:9092"}, Topic: "galah"},
+				Database: config.DatabaseOutputConfig{Driver: "sqlite3", DSN: filepath.Join(dir, "all.db")},
+				GRPC:     config.GRPCOutputConfig{Address: "127.0.0.1:0", Token: "secret"},
+			},
+			wantHooks:  4,
+			wantStored: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventLogger, err := el.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer eventLogger.Close()
+
+			var a App
+			err = a.addEventOutputs(eventLogger, tt.outputs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("addEventOutputs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if a.EventStore != nil {
+				defer a.EventStore.Close()
+			}
+			if got := len(eventLogger.EventLogger.Hooks[logrus.InfoLevel]); got != tt.wantHooks {
+				t.Errorf("hooks = %d, want %d", got, tt.wantHooks)
+			}
+			if got := a.EventStore != nil; got != tt.wantStored {
+				t.Errorf("event store set = %v, want %v", got, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestRotateConfig(t *testing.T) {
+	var uploaded string
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploaded = r.Method + " " + r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer storage.Close()
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+
+	cfg, err := rotateConfig(config.RotationConfig{MaxSizeMB: 1, MaxBackups: 3}, l)
+	if err != nil {
+		t.Fatalf("rotateConfig() error = %v", err)
+	}
+	if cfg.MaxSize != 1<<20 || cfg.MaxBackups != 3 || cfg.Archive != nil {
+		t.Errorf("rotateConfig() = %+v, want 1 MiB, 3 backups and no archive", cfg)
+	}
+
+	rc := config.RotationConfig{MaxSizeMB: 1}
+	rc.S3 = config.S3ArchiveConfig{
+		Endpoint:          storage.URL,
+		Region:            "us-east-1",
+		Bucket:            "events",
+		Prefix:            "galah/",
+		PathStyle:         true,
+		AccessKeyID:       "AKIDEXAMPLE",
+		SecretAccessKey:   "secret",
+		DeleteAfterUpload: true,
+	}
+	cfg, err = rotateConfig(rc, l)
+	if err != nil {
+		t.Fatalf("rotateConfig() error = %v", err)
+	}
+	if cfg.Archive == nil {
+		t.Fatal("rotateConfig() has no archive with the bucket set")
+	}
+	rotated := filepath.Join(t.TempDir(), "event_log.json.1")
+	if err := os.WriteFile(rotated, []byte("{}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Archive(rotated); err != nil {
+		t.Fatalf("Archive() error = %v", err)
+	}
+	if want := "PUT /events/galah/event_log.json.1"; uploaded != want {
+		t.Errorf("upload = %q, want %q", uploaded, want)
+	}
+	if _, err := os.Stat(rotated); !os.IsNotExist(err) {
+		t.Errorf("the uploaded file isn't deleted: %v", err)
+	}
+}
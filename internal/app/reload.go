@@ -0,0 +1,194 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/server"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// loadSettings loads the settings of the requests from the configuration:
+// the server profile, the personas, the model routes, the emulations, the
+// static rules and the static artifacts. models holds the initialized models
+// by name.
+func loadSettings(ctx context.Context, cfg *config.Config, primary llm.Config, models map[string]llms.Model, wrap func(llms.Model, string) llms.Model) (*server.Settings, error) {
+	profile, err := llm.ResolveServerProfile(cfg.ServerProfile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading server profile: %s", err)
+	}
+
+	if err := server.ValidatePromptVariants(cfg.PromptVariants); err != nil {
+		return nil, fmt.Errorf("error loading the prompt variants: %s", err)
+	}
+
+	if err := server.CheckStreaming(cfg.Response); err != nil {
+		return nil, fmt.Errorf("error loading the response settings: %s", err)
+	}
+
+	personas, vhosts, err := initPersonas(ctx, cfg, primary, models, wrap)
+	if err != nil {
+		return nil, err
+	}
+
+	routes, err := initRoutes(ctx, cfg.ModelRouting, primary, models, wrap)
+	if err != nil {
+		return nil, err
+	}
+
+	emulations, err := llm.ResolveEmulations(cfg.Emulations)
+	if err != nil {
+		return nil, fmt.Errorf("error loading the emulations: %s", err)
+	}
+
+	var ruleConfigs []config.StaticRuleConfig
+	if cfg.StaticRulesFile != "" {
+		if ruleConfigs, err = config.LoadStaticRules(cfg.StaticRulesFile); err != nil {
+			return nil, fmt.Errorf("error loading the static rules: %s", err)
+		}
+	}
+	// The artifacts of the emulations are answered after the static rules.
+	for _, e := range emulations {
+		for _, artifact := range e.Artifacts {
+			if artifact.Name != "" {
+				artifact.Name = e.Name + "/" + artifact.Name
+			}
+			ruleConfigs = append(ruleConfigs, artifact)
+		}
+	}
+	rules, err := server.NewStaticRules(ruleConfigs)
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts, err := server.NewStaticArtifacts(cfg.StaticArtifacts)
+	if err != nil {
+		return nil, err
+	}
+
+	signatures, err := llm.NewPayloadSignatures(cfg.Classification.Signatures)
+	if err != nil {
+		return nil, fmt.Errorf("error loading the payload signatures: %s", err)
+	}
+
+	return &server.Settings{
+		Config:            cfg,
+		Profile:           profile,
+		Rules:             rules,
+		StaticArtifacts:   artifacts,
+		Emulations:        emulations,
+		Personas:          personas,
+		VirtualHosts:      vhosts,
+		PayloadSignatures: signatures,
+		Routes:            routes,
+	}, nil
+}
+
+// current returns the settings of the requests in use.
+func (a *App) current() *server.Settings {
+	if st := a.Runtime.Settings(); st != nil {
+		return st
+	}
+	return &server.Settings{
+		Config:          a.Config,
+		Profile:         a.Profile,
+		Rules:           a.Rules,
+		StaticArtifacts: a.StaticArtifacts,
+		Emulations:      a.Emulations,
+		Personas:        a.Personas,
+		VirtualHosts:    a.VirtualHosts,
+		Routes:          a.Routes,
+	}
+}
+
+// reload reloads the configuration file, the static rules file and the
+// access list files, and applies the settings of the requests: the prompts,
+// the server profile, the personas, the model routes, the emulations, the static rules, the
+// static artifacts and the access lists, keeping the entries added with the admin API. The listeners, the cache and
+// the other components are kept, and their changes need a restart. The
+// settings in use are kept if the configuration is invalid.
+func (a *App) reload() error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	cfg, err := config.LoadConfig(args.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("error loading config: %s", err)
+	}
+
+	current := a.current()
+	// The models of the personas and routes are reused, with their usage and
+	// circuit breaker state.
+	models := map[string]llms.Model{a.LLMConfig.Model: a.Model}
+	for _, p := range current.Personas {
+		models[p.LLMConfig.Model] = p.Model
+	}
+	for _, vh := range current.VirtualHosts {
+		models[vh.Persona.LLMConfig.Model] = vh.Persona.Model
+	}
+	for _, route := range current.Routes {
+		models[route.Config.Model] = route.Model
+	}
+	settings, err := loadSettings(context.Background(), cfg, a.LLMConfig, models, a.wrap)
+	if err != nil {
+		return err
+	}
+	allow, deny, err := server.LoadAccessLists(cfg.AccessLists)
+	if err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(cfg.Ports, current.Config.Ports) || !reflect.DeepEqual(cfg.Profiles, current.Config.Profiles) {
+		logger.Warnln("the changes of the ports and TLS profiles are applied after a restart")
+	}
+	a.Runtime.SetSettings(settings)
+	a.AccessLists.Allow.Replace(allow)
+	a.AccessLists.Deny.Replace(deny)
+	logger.Infof("reloaded the configuration from %s", args.ConfigFile)
+	return nil
+}
+
+// watchConfig reloads the configuration when the configuration file, the
+// static rules file or an access list file is modified, checked every
+// interval, until the context is done.
+func (a *App) watchConfig(ctx context.Context, interval time.Duration) {
+	files := func() map[string]time.Time {
+		mtimes := make(map[string]time.Time)
+		cfg := a.current().Config
+		for _, file := range []string{args.ConfigFile, cfg.StaticRulesFile, cfg.AccessLists.AllowFile, cfg.AccessLists.DenyFile} {
+			if file == "" {
+				continue
+			}
+			// The missing files have the zero time.
+			var mtime time.Time
+			if fi, err := os.Stat(file); err == nil {
+				mtime = fi.ModTime()
+			}
+			mtimes[file] = mtime
+		}
+		return mtimes
+	}
+
+	mtimes := files()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if reflect.DeepEqual(files(), mtimes) {
+			continue
+		}
+		if err := a.reload(); err != nil {
+			logger.Errorf("error reloading the configuration: %s", err)
+		}
+		mtimes = files()
+	}
+}
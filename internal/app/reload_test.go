@@ -0,0 +1,217 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/access"
+	"github.com/0x4d31/galah/internal/config"
+	el "github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/internal/server"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// stubModel answers every prompt with the same JSON response.
+type stubModel struct{}
+
+func (stubModel) GenerateContent(_ context.Context, _ []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		Content: `{"headers": {"Content-Type": "text/plain"}, "body": "ok"}`,
+	}}}, nil
+}
+
+func (m stubModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// testConfig returns the configuration of the tests with the system prompt.
+func testConfig(systemPrompt string) string {
+	return "system_prompt: " + systemPrompt + "\n" +
+		"user_prompt: \"Request: %q\"\n" +
+		"ports:\n  - port: 8080\n    protocol: HTTP\n"
+}
+
+// writeConfig writes the configuration file of the tests, and sets it as the
+// configuration file of the arguments.
+func writeConfig(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	configFile := args.ConfigFile
+	args.ConfigFile = file
+	t.Cleanup(func() { args.ConfigFile = configFile })
+}
+
+// newReloadApp returns the app of the configuration file, initialized like
+// by init for the reloads.
+func newReloadApp(t *testing.T, file string) *App {
+	t.Helper()
+	logger = logrus.New()
+	logger.SetOutput(io.Discard)
+
+	cfg, err := config.LoadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	llmConfig := llm.Config{Provider: "openai", Model: "gpt-4o"}
+	wrap := func(model llms.Model, _ string) llms.Model { return model }
+	settings, err := loadSettings(context.Background(), cfg, llmConfig, map[string]llms.Model{llmConfig.Model: stubModel{}}, wrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &App{
+		Config:      cfg,
+		LLMConfig:   llmConfig,
+		Logger:      logger,
+		Model:       stubModel{},
+		Profile:     settings.Profile,
+		Rules:       settings.Rules,
+		Personas:    settings.Personas,
+		Runtime:     server.NewRuntime(),
+		AccessLists: &access.Lists{Allow: access.NewList(nil), Deny: access.NewList(nil)},
+		wrap:        wrap,
+	}
+}
+
+func TestReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, file, testConfig("old prompt"))
+	a := newReloadApp(t, file)
+
+	writeConfig(t, file, testConfig("new prompt"))
+	if err := a.reload(); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	if got := a.current().Config.SystemPrompt; got != "new prompt" {
+		t.Errorf("system prompt = %q, want the reloaded %q", got, "new prompt")
+	}
+	if a.Runtime.Settings() == nil {
+		t.Error("the reloaded settings aren't used by the servers")
+	}
+}
+
+func TestReloadInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "invalidYAML", content: "system_prompt: [\n"},
+		{name: "invalidServerProfile", content: testConfig("new prompt") + "server_profile:\n  name: unknown\n"},
+		{name: "missingStaticRules", content: testConfig("new prompt") + "static_rules_file: missing.yaml\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "config.yaml")
+			writeConfig(t, file, testConfig("old prompt"))
+			a := newReloadApp(t, file)
+
+			writeConfig(t, file, tt.content)
+			if err := a.reload(); err == nil {
+				t.Fatal("reload() succeeded, want an error")
+			}
+			if got := a.current().Config.SystemPrompt; got != "old prompt" {
+				t.Errorf("system prompt = %q, want the old %q", got, "old prompt")
+			}
+			if a.Runtime.Settings() != nil {
+				t.Error("the settings of the invalid configuration are used")
+			}
+		})
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, file, testConfig("old prompt"))
+	a := newReloadApp(t, file)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.watchConfig(ctx, 10*time.Millisecond)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if err := os.WriteFile(file, []byte(testConfig("new prompt")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// The modification time is moved forward until the reload, as the file
+	// may be modified before the watch starts.
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 1; a.current().Config.SystemPrompt != "new prompt"; i++ {
+		if time.Now().After(deadline) {
+			t.Fatal("the modified configuration wasn't reloaded")
+		}
+		modified := time.Now().Add(time.Duration(i) * time.Second)
+		if err := os.Chtimes(file, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestReloadDuringRequests(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, file, testConfig("old prompt"))
+	a := newReloadApp(t, file)
+
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	eventLogger, err := el.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &server.Server{
+		Config:      a.Config,
+		EventLogger: eventLogger,
+		LLMConfig:   a.LLMConfig,
+		Logger:      l,
+		Model:       a.Model,
+		Profile:     a.Profile,
+		Personas:    a.Personas,
+		Rules:       a.Rules,
+		Runtime:     a.Runtime,
+	}
+	handler := srv.SetupServer(a.Config.Ports[0]).Handler
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				handler.ServeHTTP(w, r)
+				if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "ok") {
+					t.Errorf("response = %d %q, want the generated body", w.Code, w.Body.String())
+				}
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := os.WriteFile(file, []byte(testConfig("prompt "+strings.Repeat("x", i))), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.reload(); err != nil {
+			t.Errorf("reload() error = %v", err)
+		}
+	}
+	wg.Wait()
+}
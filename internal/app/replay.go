@@ -0,0 +1,215 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/server"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/alexflint/go-arg"
+	"github.com/sirupsen/logrus"
+	"github.com/tmc/langchaingo/llms"
+)
+
+type replayArgs struct {
+	Input string `arg:"positional" help:"Path to the file of the raw HTTP requests, read from the standard input if empty or -. The bodies of the requests need their Content-Length, as on the wire." default:"-"`
+	llmArgs
+	ConfigFile string `arg:"-c,--config-file" help:"Path to config file" default:"config/config.yaml"`
+	Port       uint16 `arg:"--port" help:"Port the requests are replayed as received on, for its persona" default:"8080"`
+	Source     string `arg:"--source" help:"Source IP of the requests, for the prompt variants and the honeytokens" default:"192.0.2.1"`
+	LogLevel   string `arg:"-l,--log-level" help:"Log level (debug, info, error, fatal)" default:"error"`
+}
+
+// RunReplay runs the dry run command ("galah replay") with the given
+// command-line arguments: the prompts of the requests are built and their
+// responses generated as by the honeypot, and printed, without serving any
+// port.
+func RunReplay(argv []string) error {
+	var a replayArgs
+	p, err := arg.NewParser(arg.Config{Program: "galah replay"}, &a)
+	if err != nil {
+		return err
+	}
+	if err := p.Parse(argv); err != nil {
+		if err == arg.ErrHelp {
+			p.WriteHelp(os.Stdout)
+			return nil
+		}
+		p.WriteUsage(os.Stderr)
+		return err
+	}
+
+	log := logrus.New()
+	level, err := logrus.ParseLevel(a.LogLevel)
+	if err != nil {
+		return fmt.Errorf("error setting log level: %s", err)
+	}
+	log.SetLevel(level)
+
+	var in io.Reader = os.Stdin
+	if a.Input != "" && a.Input != "-" {
+		f, err := os.Open(a.Input)
+		if err != nil {
+			return fmt.Errorf("error opening the requests: %s", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	requests, err := readRequests(in, a.Source)
+	if err != nil {
+		return fmt.Errorf("error reading the requests: %s", err)
+	}
+
+	cfg, err := config.LoadConfig(a.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("error loading config: %s", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	srv, err := newOfflineServer(ctx, cfg, a.llmArgs, log)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for i, r := range requests {
+		fmt.Printf("=== %s %s (%d/%d)\n", r.Method, r.RequestURI, i+1, len(requests))
+		replay, err := srv.Replay(r.WithContext(ctx), a.Port)
+		printReplay(os.Stdout, replay, err, false)
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of the %d requests failed", failed, len(requests))
+	}
+	return nil
+}
+
+// newOfflineServer returns the server of the offline commands, generating
+// the responses of the configuration with the LLM provider of the arguments.
+func newOfflineServer(ctx context.Context, cfg *config.Config, a llmArgs, log *logrus.Logger) (*server.Server, error) {
+	modelConfig, err := a.modelConfig()
+	if err != nil {
+		return nil, err
+	}
+	model, err := llm.New(ctx, modelConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing the LLM client: %s", err)
+	}
+	wrap := func(model llms.Model, _ string) llms.Model { return model }
+	fallback, err := initFallback(ctx, cfg.Fallback, modelConfig, wrap)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := loadSettings(ctx, cfg, modelConfig, map[string]llms.Model{modelConfig.Model: model}, wrap)
+	if err != nil {
+		return nil, err
+	}
+	return &server.Server{
+		Config:            settings.Config,
+		Fallback:          fallback,
+		LLMConfig:         modelConfig,
+		Logger:            log,
+		Model:             model,
+		Profile:           settings.Profile,
+		Rules:             settings.Rules,
+		StaticArtifacts:   settings.StaticArtifacts,
+		PayloadSignatures: settings.PayloadSignatures,
+		Emulations:        settings.Emulations,
+		Personas:          settings.Personas,
+		Routes:            settings.Routes,
+		VirtualHosts:      settings.VirtualHosts,
+	}, nil
+}
+
+// readRequests reads the raw HTTP requests of the source until the end of
+// the input.
+func readRequests(in io.Reader, source string) ([]*http.Request, error) {
+	br := bufio.NewReader(in)
+	var requests []*http.Request
+	for {
+		// The requests may be separated by blank lines.
+		for {
+			b, err := br.Peek(1)
+			if err != nil || (b[0] != '\r' && b[0] != '\n') {
+				break
+			}
+			br.Discard(1)
+		}
+		r, err := http.ReadRequest(br)
+		if errors.Is(err, io.EOF) {
+			return requests, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.RemoteAddr = net.JoinHostPort(source, "49152")
+		requests = append(requests, r)
+	}
+}
+
+// printReplay prints the prompt, the raw output and the response of the
+// replay, or its error, and the validation of the output if validate is true.
+func printReplay(w io.Writer, replay *server.Replay, err error, validate bool) {
+	if replay != nil {
+		for _, m := range replay.Messages {
+			fmt.Fprintf(w, "--- %s\n", m.Role)
+			for _, part := range m.Parts {
+				if t, ok := part.(llms.TextContent); ok {
+					fmt.Fprintln(w, t.Text)
+				}
+			}
+		}
+		if replay.Raw != "" {
+			fmt.Fprintf(w, "--- raw response (%s %s)\n%s\n", replay.Served.Provider, replay.Served.Model, replay.Raw)
+		}
+		if validate {
+			printValidation(w, replay)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(w, "--- error\n%s\n\n", err)
+		return
+	}
+
+	resp := replay.Response
+	status := resp.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	fmt.Fprintf(w, "--- response\nHTTP/1.1 %d %s\n", status, http.StatusText(status))
+	keys := make([]string, 0, len(resp.Headers))
+	for key := range resp.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s: %s\n", key, resp.Headers[key])
+	}
+	body, err := resp.DecodedBody()
+	switch {
+	case err != nil:
+		fmt.Fprintf(w, "\n[invalid %s body: %s]\n\n", resp.Encoding, err)
+	case !utf8.Valid(body):
+		fmt.Fprintf(w, "\n[%d bytes of binary body]\n\n", len(body))
+	default:
+		fmt.Fprintf(w, "\n%s\n\n", body)
+	}
+}
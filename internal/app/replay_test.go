@@ -0,0 +1,148 @@
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// modelContent is the output of the model of the tests.
+const modelContent = `{"headers": {"Content-Type": "text/html", "Server": "nginx"}, "body": "<h1>It works</h1>"}`
+
+// newModelServer returns the URL of an OpenAI-compatible server answering the
+// completions with the content, and the count of the completions.
+func newModelServer(t *testing.T, content string) (string, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{
+				"message":       map[string]string{"role": "assistant", "content": content},
+				"finish_reason": "stop",
+			}},
+		})
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL + "/v1", &calls
+}
+
+// captureStdout returns what f prints to the standard output, and its error.
+func captureStdout(t *testing.T, f func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	ferr := f()
+	os.Stdout = stdout
+	w.Close()
+	return <-out, ferr
+}
+
+// writeTestConfig writes the configuration of the tests and returns its path.
+func writeTestConfig(t *testing.T) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte(testConfig("You are a web server.")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestReadRequests(t *testing.T) {
+	raw := "GET /admin HTTP/1.1\r\nHost: example.com\r\n\r\n" +
+		"\r\n\n" +
+		"POST /login HTTP/1.1\r\nHost: example.com\r\nContent-Length: 9\r\n\r\nuser=root"
+	requests, err := readRequests(strings.NewReader(raw), "203.0.113.7")
+	if err != nil {
+		t.Fatalf("readRequests() error = %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("readRequests() = %d requests, want 2", len(requests))
+	}
+	if r := requests[0]; r.Method != http.MethodGet || r.RequestURI != "/admin" || r.Host != "example.com" {
+		t.Errorf("first request = %s %s (%s), want GET /admin (example.com)", r.Method, r.RequestURI, r.Host)
+	}
+	r := requests[1]
+	body, _ := io.ReadAll(r.Body)
+	if r.Method != http.MethodPost || string(body) != "user=root" || r.ContentLength != 9 {
+		t.Errorf("second request = %s %q (%d bytes), want POST %q", r.Method, body, r.ContentLength, "user=root")
+	}
+	if r.RemoteAddr != "203.0.113.7:49152" {
+		t.Errorf("remote address = %q, want the source", r.RemoteAddr)
+	}
+
+	if _, err := readRequests(strings.NewReader("NOT A REQUEST\r\n\r\n"), "203.0.113.7"); err == nil {
+		t.Error("readRequests() of an invalid request succeeded, want an error")
+	}
+}
+
+func TestRunReplay(t *testing.T) {
+	configFile := writeTestConfig(t)
+	serverURL, calls := newModelServer(t, modelContent)
+	requests := filepath.Join(t.TempDir(), "requests.txt")
+	raw := "GET /admin HTTP/1.1\r\nHost: example.com\r\n\r\nGET /.env HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	if err := os.WriteFile(requests, []byte(raw), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	model := []string{"--provider", "openai-compatible", "--model", "local", "--server-url", serverURL, "--config-file", configFile}
+
+	tests := []struct {
+		name     string
+		argv     []string
+		wantErr  string
+		wantOut  []string
+		wantCall int32
+	}{
+		{name: "help", argv: []string{"--help"}, wantOut: []string{"Usage: galah replay"}},
+		{name: "missingProvider", argv: []string{requests, "--model", "local"}, wantErr: "--provider"},
+		{name: "unknownFlag", argv: append([]string{requests, "--unknown"}, model...), wantErr: "unknown"},
+		{name: "invalidLogLevel", argv: append([]string{requests, "--log-level", "loud"}, model...), wantErr: "error setting log level"},
+		{name: "missingInput", argv: append([]string{filepath.Join(t.TempDir(), "missing.txt")}, model...), wantErr: "error opening the requests"},
+		{name: "missingConfig", argv: []string{requests, "--provider", "openai-compatible", "--model", "local", "--server-url", serverURL, "--config-file", filepath.Join(t.TempDir(), "missing.yaml")}, wantErr: "error loading config"},
+		{name: "unsupportedProvider", argv: []string{requests, "--provider", "unknown", "--model", "local", "--config-file", configFile}, wantErr: "error initializing the LLM client"},
+		{
+			name:     "replay",
+			argv:     append([]string{requests}, model...),
+			wantOut:  []string{"=== GET /admin (1/2)", "=== GET /.env (2/2)", "--- system\nYou are a web server.", "HTTP/1.1 200 OK", "Server: nginx", "<h1>It works</h1>"},
+			wantCall: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := calls.Load()
+			out, err := captureStdout(t, func() error { return RunReplay(tt.argv) })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RunReplay() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("RunReplay() error = %v", err)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out, want) {
+					t.Errorf("output = %q, want %q in it", out, want)
+				}
+			}
+			if got := calls.Load() - before; got != tt.wantCall {
+				t.Errorf("completions = %d, want %d", got, tt.wantCall)
+			}
+		})
+	}
+}
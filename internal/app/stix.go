@@ -0,0 +1,100 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/0x4d31/galah/internal/stix"
+	"github.com/alexflint/go-arg"
+)
+
+type stixArgs struct {
+	EventLogFile    string        `arg:"-o,--event-log-file" help:"Path to event log file (in the json format)" default:"event_log.json"`
+	Output          string        `arg:"-w,--output" help:"Path to the STIX bundle to write. The bundle is printed if empty and not pushed to a TAXII server."`
+	Identity        string        `arg:"--identity" help:"Name of the identity producing the indicators" default:"galah"`
+	Since           time.Duration `arg:"--since" help:"Only export the indicators of the events of this last duration (e.g. 24h). Use 0 for all the events." default:"0"`
+	MinHits         int           `arg:"--min-hits" help:"Minimum number of requests of a source IP to export it, unless it used a honeytoken" default:"1"`
+	TAXIIURL        string        `arg:"--taxii-url,env:TAXII_URL" help:"URL of the TAXII 2.1 API root to push the bundle to"`
+	TAXIICollection string        `arg:"--taxii-collection,env:TAXII_COLLECTION" help:"ID of the TAXII collection to push the bundle to"`
+	TAXIIUsername   string        `arg:"--taxii-username,env:TAXII_USERNAME" help:"Username of the TAXII server"`
+	TAXIIPassword   string        `arg:"--taxii-password,env:TAXII_PASSWORD" help:"Password of the TAXII server"`
+	TAXIIToken      string        `arg:"--taxii-token,env:TAXII_TOKEN" help:"Bearer token of the TAXII server, if no username and password are set"`
+}
+
+// RunSTIX runs the STIX export command ("galah stix") with the given
+// command-line arguments.
+func RunSTIX(argv []string) error {
+	var a stixArgs
+	p, err := arg.NewParser(arg.Config{Program: "galah stix"}, &a)
+	if err != nil {
+		return err
+	}
+	if err := p.Parse(argv); err != nil {
+		if err == arg.ErrHelp {
+			p.WriteHelp(os.Stdout)
+			return nil
+		}
+		p.WriteUsage(os.Stderr)
+		return err
+	}
+	if (a.TAXIIURL == "") != (a.TAXIICollection == "") {
+		p.WriteUsage(os.Stderr)
+		return fmt.Errorf("--taxii-url and --taxii-collection must be set together")
+	}
+
+	in, err := os.Open(a.EventLogFile)
+	if err != nil {
+		return fmt.Errorf("error opening the event log: %s", err)
+	}
+	defer in.Close()
+
+	cfg := stix.Config{Identity: a.Identity, MinHits: a.MinHits}
+	if a.Since > 0 {
+		cfg.Since = time.Now().Add(-a.Since)
+	}
+	bundle, err := stix.FromEventLog(in, cfg)
+	if err != nil {
+		return fmt.Errorf("error reading the event log: %s", err)
+	}
+
+	if a.Output != "" || a.TAXIIURL == "" {
+		var out io.Writer = os.Stdout
+		if a.Output != "" {
+			f, err := os.Create(a.Output)
+			if err != nil {
+				return fmt.Errorf("error creating the STIX bundle: %s", err)
+			}
+			defer f.Close()
+			out = f
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(bundle); err != nil {
+			return fmt.Errorf("error writing the STIX bundle: %s", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "exported %d objects\n", len(bundle.Objects))
+
+	if a.TAXIIURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		status, err := stix.Push(ctx, &http.Client{}, stix.TAXIIConfig{
+			URL:        a.TAXIIURL,
+			Collection: a.TAXIICollection,
+			Username:   a.TAXIIUsername,
+			Password:   a.TAXIIPassword,
+			Token:      a.TAXIIToken,
+		}, bundle)
+		if err != nil {
+			return fmt.Errorf("error pushing the STIX bundle: %s", err)
+		}
+		fmt.Fprintf(os.Stderr, "pushed the bundle to the TAXII collection %s: %s, %d succeeded, %d failed, %d pending\n",
+			a.TAXIICollection, status.Status, status.SuccessCount, status.FailureCount, status.PendingCount)
+	}
+	return nil
+}
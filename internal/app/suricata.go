@@ -0,0 +1,69 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/0x4d31/galah/internal/rulegen"
+	"github.com/alexflint/go-arg"
+)
+
+type suricataArgs struct {
+	EventLogFile string   `arg:"-o,--event-log-file" help:"Path to event log file" default:"event_log.json"`
+	Output       string   `arg:"-w,--output" help:"Path to the rules file to write. The rules are printed if empty."`
+	MinHits      int      `arg:"--min-hits" help:"Minimum number of requests of a method and path to generate its rule" default:"1"`
+	PayloadsOnly bool     `arg:"--payloads-only" help:"Only generate the rules of requests carrying exploit payloads"`
+	IgnorePaths  []string `arg:"--ignore-path,separate" help:"Path not to generate rules for (can be repeated; defaults to /, /favicon.ico, /robots.txt and /sitemap.xml)"`
+	SID          int      `arg:"--sid" help:"SID of the first rule" default:"1000000"`
+}
+
+// RunSuricata runs the rule generation command ("galah suricata") with the
+// given command-line arguments.
+func RunSuricata(argv []string) error {
+	var a suricataArgs
+	p, err := arg.NewParser(arg.Config{Program: "galah suricata"}, &a)
+	if err != nil {
+		return err
+	}
+	if err := p.Parse(argv); err != nil {
+		if err == arg.ErrHelp {
+			p.WriteHelp(os.Stdout)
+			return nil
+		}
+		p.WriteUsage(os.Stderr)
+		return err
+	}
+
+	in, err := os.Open(a.EventLogFile)
+	if err != nil {
+		return fmt.Errorf("error opening the event log: %s", err)
+	}
+	defer in.Close()
+
+	var out io.Writer = os.Stdout
+	if a.Output != "" {
+		f, err := os.Create(a.Output)
+		if err != nil {
+			return fmt.Errorf("error creating the rules file: %s", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	ignored := a.IgnorePaths
+	if len(ignored) == 0 {
+		ignored = rulegen.DefaultIgnoredPaths
+	}
+	n, err := rulegen.Generate(in, out, rulegen.Config{
+		MinHits:      a.MinHits,
+		PayloadsOnly: a.PayloadsOnly,
+		IgnoredPaths: ignored,
+		SID:          a.SID,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "generated %d rules\n", n)
+	return nil
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/server"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/alexflint/go-arg"
+	"github.com/sirupsen/logrus"
+)
+
+type testArgs struct {
+	Path    string   `arg:"positional" help:"Path (and query) of the request" default:"/"`
+	Method  string   `arg:"-X,--method" help:"Method of the request" default:"GET"`
+	Headers []string `arg:"-H,--header,separate" help:"Header of the request, as \"Name: value\" (can be repeated). The Host header defaults to localhost and the port."`
+	Body    string   `arg:"-b,--body" help:"Body of the request, read from the file of the name if prefixed with @"`
+	llmArgs
+	ConfigFile string `arg:"-c,--config-file" help:"Path to config file" default:"config/config.yaml"`
+	Port       uint16 `arg:"--port" help:"Port the request is received on, for its persona" default:"8080"`
+	Source     string `arg:"--source" help:"Source IP of the request, for the prompt variants and the honeytokens" default:"192.0.2.1"`
+	LogLevel   string `arg:"-l,--log-level" help:"Log level (debug, info, error, fatal)" default:"error"`
+}
+
+// RunTest runs the test command ("galah test") with the given command-line
+// arguments: the request of the arguments is answered as by the honeypot,
+// like a request replayed (see RunReplay), and its prompt, the raw output of
+// the model, the validation of the output and the response are printed.
+func RunTest(argv []string) error {
+	var a testArgs
+	p, err := arg.NewParser(arg.Config{Program: "galah test"}, &a)
+	if err != nil {
+		return err
+	}
+	if err := p.Parse(argv); err != nil {
+		if err == arg.ErrHelp {
+			p.WriteHelp(os.Stdout)
+			return nil
+		}
+		p.WriteUsage(os.Stderr)
+		return err
+	}
+
+	log := logrus.New()
+	level, err := logrus.ParseLevel(a.LogLevel)
+	if err != nil {
+		return fmt.Errorf("error setting log level: %s", err)
+	}
+	log.SetLevel(level)
+
+	raw, err := a.rawRequest()
+	if err != nil {
+		return err
+	}
+	requests, err := readRequests(strings.NewReader(raw), a.Source)
+	if err != nil {
+		return fmt.Errorf("error reading the request: %s", err)
+	}
+	if len(requests) != 1 {
+		return fmt.Errorf("invalid request")
+	}
+
+	cfg, err := config.LoadConfig(a.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("error loading config: %s", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	srv, err := newOfflineServer(ctx, cfg, a.llmArgs, log)
+	if err != nil {
+		return err
+	}
+	replay, err := srv.Replay(requests[0].WithContext(ctx), a.Port)
+	printReplay(os.Stdout, replay, err, true)
+	return err
+}
+
+// rawRequest returns the request of the arguments, as on the wire.
+func (a testArgs) rawRequest() (string, error) {
+	body := a.Body
+	if name, ok := strings.CutPrefix(body, "@"); ok {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("error reading the body: %s", err)
+		}
+		body = string(b)
+	}
+	path := a.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", strings.ToUpper(a.Method), path)
+	host := false
+	for _, h := range a.Headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return "", fmt.Errorf("invalid header %q, expected \"Name: value\"", h)
+		}
+		name = strings.TrimSpace(name)
+		if strings.EqualFold(name, "Content-Length") {
+			continue
+		}
+		host = host || strings.EqualFold(name, "Host")
+		fmt.Fprintf(&b, "%s: %s\r\n", name, strings.TrimSpace(value))
+	}
+	if !host {
+		fmt.Fprintf(&b, "Host: localhost:%d\r\n", a.Port)
+	}
+	if body != "" {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n", len(body))
+	}
+	b.WriteString("\r\n" + body)
+	return b.String(), nil
+}
+
+// printValidation prints the validation of the outputs of the model, and of
+// the body of the response generated against its Content-Type.
+func printValidation(w io.Writer, replay *server.Replay) {
+	fmt.Fprintln(w, "--- validation")
+	for i, output := range replay.Outputs {
+		fmt.Fprintf(w, "output %d: %s\n", i+1, outputValidation(output))
+	}
+	if replay.Response == nil {
+		return
+	}
+	if replay.ContentMismatch != nil {
+		fmt.Fprintf(w, "body: mismatching its Content-Type (%s)\n", replay.ContentMismatch)
+	} else {
+		fmt.Fprintln(w, "body: matching its Content-Type")
+	}
+}
+
+// outputValidation returns the validation of the output of the model as a
+// JSON response: valid, repaired (see llm.RepairJSON) or invalid.
+func outputValidation(output string) string {
+	_, err := llm.ParseJSONResponse(output)
+	if err == nil {
+		return "valid JSON"
+	}
+	if repaired, ok := llm.RepairJSON(output); ok {
+		if _, rerr := llm.ParseJSONResponse(repaired); rerr == nil {
+			return fmt.Sprintf("repaired JSON (%s)", err)
+		}
+	}
+	return fmt.Sprintf("invalid JSON (%s)", err)
+}
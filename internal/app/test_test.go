@@ -0,0 +1,178 @@
+package app
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRawRequest(t *testing.T) {
+	body := filepath.Join(t.TempDir(), "body.json")
+	if err := os.WriteFile(body, []byte(`{"user": "root"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    testArgs
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "defaultHost",
+			args: testArgs{Path: "admin", Method: "get", Port: 8080},
+			want: "GET /admin HTTP/1.1\r\nHost: localhost:8080\r\n\r\n",
+		},
+		{
+			name: "headersAndBody",
+			args: testArgs{
+				Path:    "/login?next=/",
+				Method:  "POST",
+				Headers: []string{"Host: example.com", "Content-Type:  application/x-www-form-urlencoded ", "Content-Length: 1"},
+				Body:    "user=root",
+				Port:    8080,
+			},
+			want: "POST /login?next=/ HTTP/1.1\r\nHost: example.com\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 9\r\n\r\nuser=root",
+		},
+		{
+			name: "bodyFile",
+			args: testArgs{Path: "/api", Method: "PUT", Body: "@" + body, Port: 443},
+			want: "PUT /api HTTP/1.1\r\nHost: localhost:443\r\nContent-Length: 16\r\n\r\n{\"user\": \"root\"}",
+		},
+		{name: "invalidHeader", args: testArgs{Path: "/", Method: "GET", Headers: []string{"X-Test"}}, wantErr: true},
+		{name: "emptyHeaderName", args: testArgs{Path: "/", Method: "GET", Headers: []string{": value"}}, wantErr: true},
+		{name: "missingBodyFile", args: testArgs{Path: "/", Method: "POST", Body: "@" + body + ".missing"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.args.rawRequest()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("rawRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("rawRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{name: "valid", output: modelContent, want: "valid JSON"},
+		{name: "repaired", output: `{"headers": {"Server": "nginx"}, "body": "ok",}`, want: "repaired JSON"},
+		{name: "invalid", output: "It works", want: "invalid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := outputValidation(tt.output); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("outputValidation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewOfflineServer(t *testing.T) {
+	serverURL, _ := newModelServer(t, modelContent)
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	model := llmArgs{LLMProvider: "openai-compatible", LLMModel: "local", LLMServerURL: serverURL, LLMHTMLContent: "invalid_json"}
+
+	cfg, err := config.LoadConfig(writeTestConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := newOfflineServer(context.Background(), cfg, model, log)
+	if err != nil {
+		t.Fatalf("newOfflineServer() error = %v", err)
+	}
+	if srv.Config != cfg || srv.Model == nil || srv.LLMConfig.Model != "local" {
+		t.Errorf("newOfflineServer() = %+v, want the server of the configuration and the model", srv)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*config.Config, *llmArgs)
+		wantErr string
+	}{
+		{name: "unsupportedProvider", modify: func(_ *config.Config, a *llmArgs) { a.LLMProvider = "unknown" }, wantErr: "error initializing the LLM client"},
+		{name: "invalidHTMLContent", modify: func(_ *config.Config, a *llmArgs) { a.LLMHTMLContent = "text" }, wantErr: "text"},
+		{name: "invalidLLMHeader", modify: func(_ *config.Config, a *llmArgs) { a.LLMHeaders = []string{"X-Title"} }, wantErr: "X-Title"},
+		{name: "unknownServerProfile", modify: func(c *config.Config, _ *llmArgs) { c.ServerProfile.Name = "unknown" }, wantErr: "error loading server profile"},
+		{name: "missingStaticRules", modify: func(c *config.Config, _ *llmArgs) { c.StaticRulesFile = filepath.Join(t.TempDir(), "rules.yaml") }, wantErr: "error loading the static rules"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.LoadConfig(writeTestConfig(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := model
+			tt.modify(cfg, &a)
+			if _, err := newOfflineServer(context.Background(), cfg, a, log); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newOfflineServer() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunTest(t *testing.T) {
+	configFile := writeTestConfig(t)
+	serverURL, calls := newModelServer(t, modelContent)
+	model := []string{"--provider", "openai-compatible", "--model", "local", "--server-url", serverURL, "--config-file", configFile}
+
+	tests := []struct {
+		name     string
+		argv     []string
+		wantErr  string
+		wantOut  []string
+		wantCall int32
+	}{
+		{name: "help", argv: []string{"--help"}, wantOut: []string{"Usage: galah test"}},
+		{name: "missingModel", argv: []string{"/admin", "--provider", "openai-compatible"}, wantErr: "--model"},
+		{name: "invalidLogLevel", argv: append([]string{"/admin", "--log-level", "loud"}, model...), wantErr: "error setting log level"},
+		{name: "invalidHeader", argv: append([]string{"/admin", "-H", "X-Test"}, model...), wantErr: "invalid header"},
+		{name: "invalidMethod", argv: append([]string{"/admin", "-X", "GET /"}, model...), wantErr: "error reading the request"},
+		{name: "missingConfig", argv: []string{"/admin", "--provider", "openai-compatible", "--model", "local", "--server-url", serverURL, "--config-file", filepath.Join(t.TempDir(), "missing.yaml")}, wantErr: "error loading config"},
+		{name: "missingServerURL", argv: []string{"/admin", "--provider", "openai-compatible", "--model", "local", "--config-file", configFile}, wantErr: "error initializing the LLM client"},
+		{
+			name:     "request",
+			argv:     append([]string{"/login", "-X", "POST", "-H", "Host: example.com", "-b", "user=root"}, model...),
+			wantOut:  []string{"POST /login HTTP/1.1", "Host: example.com", "user=root", "--- raw response (openai-compatible local)", "--- validation\noutput 1: valid JSON\nbody: matching its Content-Type", "HTTP/1.1 200 OK", "<h1>It works</h1>"},
+			wantCall: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := calls.Load()
+			out, err := captureStdout(t, func() error { return RunTest(tt.argv) })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RunTest() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("RunTest() error = %v", err)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out, want) {
+					t.Errorf("output = %q, want %q in it", out, want)
+				}
+			}
+			if got := calls.Load() - before; got != tt.wantCall {
+				t.Errorf("completions = %d, want %d", got, tt.wantCall)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/server"
+	"github.com/alexflint/go-arg"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+// warmupSource is the source address of the warm-up requests.
+const warmupSource = "192.0.2.1:49152"
+
+type warmupArgs struct {
+	llmArgs
+	ConfigFile    string   `arg:"-c,--config-file" help:"Path to config file" default:"config/config.yaml"`
+	CacheDBFile   string   `arg:"-f,--cache-db-file" help:"Path to database file for response caching" default:"cache.db"`
+	CacheRedisURL string   `arg:"--cache-redis-url,env:CACHE_REDIS_URL" help:"URL of a Redis server to cache the responses in, instead of the cache database file"`
+	CacheDuration int      `arg:"-d,--cache-duration" help:"Cache duration for generated responses (in hours). Use -1 for unlimited caching (no expiration)." default:"24"`
+	PathsFile     string   `arg:"--paths-file" help:"Path to a file of the requests to warm up, one path (or method and path, e.g. POST /login) per line. Defaults to the paths commonly probed by the scanners."`
+	Ports         []uint16 `arg:"--port,separate" help:"Port to warm up, for its persona (can be repeated; defaults to all the configured ports)"`
+	Force         bool     `arg:"--force" help:"Generate the responses again even if they are cached"`
+	Concurrency   int      `arg:"--concurrency" help:"Number of responses generated concurrently" default:"1"`
+	LogLevel      string   `arg:"-l,--log-level" help:"Log level (debug, info, error, fatal)" default:"error"`
+}
+
+// warmupRequest is a request of the warm-up.
+type warmupRequest struct {
+	method, path string
+}
+
+// RunWarmup runs the cache warm-up command ("galah warmup") with the given
+// command-line arguments: the responses to the common requests of the
+// scanners are generated and cached for each port and virtual host, so the
+// honeypot answers them without generation latency from the start.
+func RunWarmup(argv []string) error {
+	var a warmupArgs
+	p, err := arg.NewParser(arg.Config{Program: "galah warmup"}, &a)
+	if err != nil {
+		return err
+	}
+	if err := p.Parse(argv); err != nil {
+		if err == arg.ErrHelp {
+			p.WriteHelp(os.Stdout)
+			return nil
+		}
+		p.WriteUsage(os.Stderr)
+		return err
+	}
+	if a.CacheDuration == 0 {
+		return fmt.Errorf("the cache duration must not be 0")
+	}
+
+	log := logrus.New()
+	level, err := logrus.ParseLevel(a.LogLevel)
+	if err != nil {
+		return fmt.Errorf("error setting log level: %s", err)
+	}
+	log.SetLevel(level)
+
+	requests, err := warmupRequests(a.PathsFile)
+	if err != nil {
+		return fmt.Errorf("error reading the paths: %s", err)
+	}
+	cfg, err := config.LoadConfig(a.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("error loading config: %s", err)
+	}
+	ports := a.Ports
+	if len(ports) == 0 {
+		for _, pc := range cfg.Ports {
+			if !slices.Contains(ports, pc.Port) {
+				ports = append(ports, pc.Port)
+			}
+		}
+	}
+
+	var store cache.Store
+	if a.CacheRedisURL != "" {
+		var ttl time.Duration
+		if a.CacheDuration > 0 {
+			ttl = time.Duration(a.CacheDuration) * time.Hour
+		}
+		store, err = cache.NewRedisStore(a.CacheRedisURL, ttl)
+	} else {
+		store, err = cache.InitializeCache(a.CacheDBFile)
+	}
+	if err != nil {
+		return fmt.Errorf("error opening the cache: %s", err)
+	}
+	defer store.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	srv, err := newOfflineServer(ctx, cfg, a.llmArgs, log)
+	if err != nil {
+		return err
+	}
+	srv.Cache = store
+	srv.CacheDuration = a.CacheDuration
+
+	// The requests of the virtual hosts are warmed up for each of their host
+	// names, except the wildcards.
+	hosts := []string{""}
+	for _, vh := range srv.VirtualHosts {
+		for _, host := range vh.Hosts {
+			if !strings.HasPrefix(host, "*.") {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	failed := 0
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(a.Concurrency, 1))
+	for _, port := range ports {
+		for _, host := range hosts {
+			for _, req := range requests {
+				port, host, req := port, host, req
+				g.Go(func() error {
+					results, err := srv.Warmup(newWarmupRequest(gctx, req, host), port, a.Force)
+					mu.Lock()
+					defer mu.Unlock()
+					target := req.method + " " + req.path
+					if host != "" {
+						target += " (" + host + ")"
+					}
+					if err != nil {
+						failed++
+						fmt.Printf("port %d %s: error: %s\n", port, target, err)
+						return nil
+					}
+					for _, result := range results {
+						counts[result]++
+					}
+					fmt.Printf("port %d %s: %s\n", port, target, strings.Join(results, ", "))
+					return nil
+				})
+			}
+		}
+	}
+	g.Wait()
+
+	fmt.Fprintf(os.Stderr, "generated %d responses (%d already cached, %d static, %d failed)\n",
+		counts[server.WarmupGenerated], counts[server.WarmupCached], counts[server.WarmupStatic], failed)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// warmupRequests returns the requests of the paths file, or of the default
+// warm-up paths if empty.
+func warmupRequests(path string) ([]warmupRequest, error) {
+	var requests []warmupRequest
+	if path == "" {
+		for _, p := range server.DefaultWarmupPaths {
+			requests = append(requests, warmupRequest{method: http.MethodGet, path: p})
+		}
+		return requests, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		req := warmupRequest{method: http.MethodGet, path: line}
+		if method, p, ok := strings.Cut(line, " "); ok {
+			req = warmupRequest{method: strings.ToUpper(method), path: strings.TrimSpace(p)}
+		}
+		if !strings.HasPrefix(req.path, "/") {
+			return nil, fmt.Errorf("invalid path %q", req.path)
+		}
+		requests = append(requests, req)
+	}
+	return requests, scanner.Err()
+}
+
+// newWarmupRequest returns the request of the warm-up for the host, with the
+// headers of a common client.
+func newWarmupRequest(ctx context.Context, req warmupRequest, host string) *http.Request {
+	r, _ := http.NewRequestWithContext(ctx, req.method, req.path, nil)
+	r.RequestURI = req.path
+	r.Host = host
+	r.RemoteAddr = warmupSource
+	r.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36")
+	r.Header.Set("Accept", "*/*")
+	return r
+}
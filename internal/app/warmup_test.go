@@ -0,0 +1,128 @@
+package app
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/server"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestWarmupRequests(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	requests, err := warmupRequests("")
+	if err != nil {
+		t.Fatalf("warmupRequests() error = %v", err)
+	}
+	if len(requests) != len(server.DefaultWarmupPaths) || requests[0] != (warmupRequest{method: http.MethodGet, path: server.DefaultWarmupPaths[0]}) {
+		t.Errorf("warmupRequests() = %v, want the GET of the default paths", requests)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    []warmupRequest
+		wantErr bool
+	}{
+		{
+			name: "paths",
+			path: write("paths.txt", "# scanners\n/admin\n\npost /login\n  /.env  \n"),
+			want: []warmupRequest{{"GET", "/admin"}, {"POST", "/login"}, {"GET", "/.env"}},
+		},
+		{name: "relativePath", path: write("relative.txt", "admin\n"), wantErr: true},
+		{name: "missingFile", path: filepath.Join(dir, "missing.txt"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := warmupRequests(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("warmupRequests() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("warmupRequests() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunWarmup(t *testing.T) {
+	configFile := writeTestConfig(t)
+	serverURL, calls := newModelServer(t, modelContent)
+	dir := t.TempDir()
+	paths := filepath.Join(dir, "paths.txt")
+	if err := os.WriteFile(paths, []byte("/admin\n/.env\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	argv := func(extra ...string) []string {
+		return append([]string{
+			"--provider", "openai-compatible", "--model", "local", "--server-url", serverURL,
+			"--config-file", configFile, "--cache-db-file", filepath.Join(dir, "cache.db"), "--paths-file", paths,
+		}, extra...)
+	}
+
+	// The runs share the cache database, in their order.
+	tests := []struct {
+		name     string
+		argv     []string
+		wantErr  string
+		wantOut  []string
+		wantCall int32
+	}{
+		{name: "help", argv: []string{"--help"}, wantOut: []string{"Usage: galah warmup"}},
+		{name: "noCacheDuration", argv: argv("--cache-duration", "0"), wantErr: "the cache duration must not be 0"},
+		{name: "invalidLogLevel", argv: argv("--log-level", "loud"), wantErr: "error setting log level"},
+		{name: "invalidPorts", argv: argv("--port", "http"), wantErr: "--port"},
+		{name: "missingPaths", argv: argv("--paths-file", filepath.Join(dir, "missing.txt")), wantErr: "error reading the paths"},
+		{
+			name:     "generate",
+			argv:     argv(),
+			wantOut:  []string{"port 8080 GET /admin: generated", "port 8080 GET /.env: generated"},
+			wantCall: 2,
+		},
+		{
+			name:    "cached",
+			argv:    argv("--concurrency", "2"),
+			wantOut: []string{"port 8080 GET /admin: cached", "port 8080 GET /.env: cached"},
+		},
+		{
+			name:     "force",
+			argv:     argv("--force", "--port", "8080"),
+			wantOut:  []string{"port 8080 GET /admin: generated", "port 8080 GET /.env: generated"},
+			wantCall: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := calls.Load()
+			out, err := captureStdout(t, func() error { return RunWarmup(tt.argv) })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RunWarmup() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("RunWarmup() error = %v", err)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out, want) {
+					t.Errorf("output = %q, want %q in it", out, want)
+				}
+			}
+			if got := calls.Load() - before; got != tt.wantCall {
+				t.Errorf("completions = %d, want %d", got, tt.wantCall)
+			}
+		})
+	}
+}
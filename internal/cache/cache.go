@@ -3,7 +3,10 @@ package cache
 import (
 	"database/sql"
 	"errors"
+	"net"
 	"net/http"
+	"path"
+	"strings"
 	"sync"
 	"time"
 )
@@ -11,11 +14,61 @@ import (
 var (
 	ErrCacheMiss    = errors.New("not found in cache")
 	ErrCacheExpired = errors.New("cached record is expired")
-	mutex           sync.Mutex
 )
 
+// Entry describes a cached response. Host and Source are the Host header
+// and source IP of the request the response was generated for. TTL is the
+// time after which the store may drop the entry (0 for the store's default,
+// negative for never).
+type Entry struct {
+	Key      string        `json:"key"`
+	Host     string        `json:"host,omitempty"`
+	Source   string        `json:"source,omitempty"`
+	CachedAt time.Time     `json:"cachedAt"`
+	Size     int           `json:"size"`
+	TTL      time.Duration `json:"-"`
+}
+
+// Store is a backend of the response cache.
+type Store interface {
+	// Get returns the response cached under the key and the time it was
+	// cached, or ErrCacheMiss.
+	Get(key string) ([]byte, time.Time, error)
+	// Set caches the response under the entry's key.
+	Set(entry Entry, resp []byte) error
+	// List returns the cached entries.
+	List() ([]Entry, error)
+	// Delete removes the response cached under the key and returns the
+	// number of removed records.
+	Delete(key string) (int64, error)
+	// DeleteAll removes all the cached responses and returns the number of
+	// removed records.
+	DeleteAll() (int64, error)
+	Close() error
+}
+
+// Pinger is implemented by the stores that can check they are available,
+// e.g. that the Redis server answers.
+type Pinger interface {
+	Ping() error
+}
+
+// Ping checks the store is available, if it implements Pinger.
+func Ping(store Store) error {
+	if p, ok := store.(Pinger); ok {
+		return p.Ping()
+	}
+	return nil
+}
+
+// SQLiteStore is a Store in a local SQLite database.
+type SQLiteStore struct {
+	*sql.DB
+	mu sync.Mutex
+}
+
 // InitializeCache sets up the response cache with the given file path.
-func InitializeCache(path string) (*sql.DB, error) {
+func InitializeCache(path string) (*SQLiteStore, error) {
 	db, err := sql.Open("sqlite3", path)
 	if err != nil {
 		return nil, err
@@ -32,57 +85,276 @@ func InitializeCache(path string) (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := addColumns(db, "cache", "host TEXT", "source TEXT"); err != nil {
+		return nil, err
+	}
 
-	return db, nil
+	return &SQLiteStore{DB: db}, nil
 }
 
-// CheckCache verifies if the given key exists in the cache.
-func CheckCache(client *sql.DB, r *http.Request, port string, cacheDuration int) ([]byte, error) {
-	// Check if caching is disabled
-	if cacheDuration == 0 {
-		return nil, nil
+// addColumns adds the columns missing from a table created by an older
+// version.
+func addColumns(db *sql.DB, table string, columns ...string) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	cacheKey := GetCacheKey(r, port)
+	for _, column := range columns {
+		name, _, _ := strings.Cut(column, " ")
+		if existing[name] {
+			continue
+		}
+		if _, err := db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// Get implements Store.
+func (s *SQLiteStore) Get(key string) ([]byte, time.Time, error) {
 	var response []byte
 	var cachedAt time.Time
-	row := client.QueryRow("SELECT cachedAt, response FROM cache WHERE key = ? ORDER BY cachedAt DESC LIMIT 1", cacheKey)
+	row := s.QueryRow("SELECT cachedAt, response FROM cache WHERE key = ? ORDER BY cachedAt DESC LIMIT 1", key)
 	err := row.Scan(&cachedAt, &response)
 	if err == sql.ErrNoRows {
-		return nil, ErrCacheMiss
-	} else if err != nil {
+		return nil, time.Time{}, ErrCacheMiss
+	}
+	return response, cachedAt, err
+}
+
+// Set implements Store. Expired entries are kept, see CheckKey.
+func (s *SQLiteStore) Set(entry Entry, resp []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	currentTime := time.Now()
+	_, err := s.Exec("INSERT OR REPLACE INTO cache (cachedAt, key, response, host, source) VALUES (?, ?, ?, ?, ?)", currentTime, entry.Key, resp, entry.Host, entry.Source)
+	return err
+}
+
+// List implements Store. Only the latest record of each key is listed.
+func (s *SQLiteStore) List() ([]Entry, error) {
+	rows, err := s.Query(`
+	SELECT key, COALESCE(host, ''), COALESCE(source, ''), cachedAt, LENGTH(response) FROM cache c
+	WHERE cachedAt = (SELECT MAX(cachedAt) FROM cache WHERE key = c.key)
+	ORDER BY cachedAt DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.Key, &e.Host, &e.Source, &e.CachedAt, &e.Size); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Delete implements Store.
+func (s *SQLiteStore) Delete(key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.Exec("DELETE FROM cache WHERE key = ?", key)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteAll implements Store.
+func (s *SQLiteStore) DeleteAll() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.Exec("DELETE FROM cache")
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CheckCache verifies if the given key exists in the cache.
+func CheckCache(client Store, r *http.Request, port string, cacheDuration int) ([]byte, error) {
+	return CheckKey(client, GetCacheKey(r, port), cacheDuration)
+}
+
+// CheckKey verifies if the given cache key exists in the cache.
+func CheckKey(client Store, cacheKey string, cacheDuration int) ([]byte, error) {
+	return CheckKeyTTL(client, cacheKey, DurationTTL(cacheDuration))
+}
+
+// CheckKeyTTL verifies if the given cache key exists in the cache and was
+// cached less than ttl ago. A ttl of 0 disables the cache, and a negative
+// ttl never expires.
+func CheckKeyTTL(client Store, cacheKey string, ttl time.Duration) ([]byte, error) {
+	// Check if caching is disabled
+	if ttl == 0 {
+		return nil, nil
+	}
+
+	response, cachedAt, err := client.Get(cacheKey)
+	if err != nil {
 		return nil, err
 	}
 
 	// Check if unlimited caching is enabled (i.e., no expiration)
-	if cacheDuration == -1 {
+	if ttl < 0 {
 		return response, nil
 	}
 
 	// Check if the cached record has expired
-	if time.Since(cachedAt) > time.Duration(cacheDuration)*time.Hour {
+	if time.Since(cachedAt) > ttl {
 		return nil, ErrCacheExpired
 	}
 
-	return response, err
+	return response, nil
 }
 
-// GetCacheKey constructs a cache key based on the provided parameters.
+// DurationTTL returns the TTL of a cache duration in hours, where -1 is
+// unlimited.
+func DurationTTL(cacheDuration int) time.Duration {
+	if cacheDuration < 0 {
+		return -1
+	}
+	return time.Duration(cacheDuration) * time.Hour
+}
+
+// GetCacheKey constructs a cache key based on the provided parameters, with
+// the default normalization, see RequestKey.
 func GetCacheKey(r *http.Request, port string) string {
-	return port + "_" + r.URL.String()
+	return RequestKey(r, port, KeyConfig{})
 }
 
 // StoreResponse saves the response in the cache with the specified key.
-func StoreResponse(client *sql.DB, key string, resp []byte) error {
-	mutex.Lock()
-	defer mutex.Unlock()
+func StoreResponse(client Store, key string, resp []byte) error {
+	return client.Set(Entry{Key: key}, resp)
+}
 
-	currentTime := time.Now()
-	_, err := client.Exec("INSERT OR REPLACE INTO cache (cachedAt, key, response) VALUES (?, ?, ?)", currentTime, key, resp)
+// StoreRequestResponse saves the response generated for the request in the
+// cache with the specified key, along with the host and source of the
+// request. The store may drop it after ttl.
+func StoreRequestResponse(client Store, r *http.Request, key string, resp []byte, ttl time.Duration) error {
+	source, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		return err
+		source = r.RemoteAddr
 	}
+	return client.Set(Entry{Key: key, Host: r.Host, Source: source, TTL: ttl}, resp)
+}
 
-	return nil
+// InvalidateAll removes all the cached responses, so they are generated again.
+// It returns the number of removed records.
+func InvalidateAll(client Store) (int64, error) {
+	return client.DeleteAll()
+}
+
+// Invalidate removes the cached responses of the request with the given
+// signature, i.e. the cache key returned by GetCacheKey. It returns the
+// number of removed records.
+func Invalidate(client Store, signature string) (int64, error) {
+	return client.Delete(signature)
+}
+
+// Filter selects cached entries. Empty fields match any entry. Path is a
+// pattern matched against the path of the cached request, see MatchPath.
+type Filter struct {
+	Port   string
+	Method string
+	Path   string
+	Host   string
+	Source string
+}
+
+// Match reports whether the entry matches the filter.
+func (f Filter) Match(e Entry) bool {
+	port, method, p := parseKey(e.Key)
+	if f.Port != "" && f.Port != port {
+		return false
+	}
+	if f.Method != "" && !strings.EqualFold(f.Method, method) {
+		return false
+	}
+	if f.Path != "" && !MatchPath(f.Path, p) {
+		return false
+	}
+	if f.Host != "" && !strings.EqualFold(f.Host, e.Host) {
+		return false
+	}
+	return f.Source == "" || f.Source == e.Source
+}
+
+// List returns the cached entries matching the filter, most recent first.
+func List(client Store, f Filter) ([]Entry, error) {
+	entries, err := client.List()
+	if err != nil {
+		return nil, err
+	}
+	matching := entries[:0]
+	for _, e := range entries {
+		if f.Match(e) {
+			matching = append(matching, e)
+		}
+	}
+	return matching, nil
+}
+
+// InvalidateMatching removes the cached responses matching the filter. It
+// returns the number of removed records.
+func InvalidateMatching(client Store, f Filter) (int64, error) {
+	if f == (Filter{}) {
+		return InvalidateAll(client)
+	}
+	entries, err := List(client, f)
+	if err != nil {
+		return 0, err
+	}
+	var removed int64
+	for _, e := range entries {
+		n, err := client.Delete(e.Key)
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+// MatchPath reports whether the request path matches the path.Match pattern.
+// A trailing * also matches subdirectories, e.g. /wp-* matches
+// /wp-admin/index.php.
+func MatchPath(pattern, p string) bool {
+	if ok, _ := path.Match(pattern, p); ok {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(pattern, "*")
+	if !ok {
+		return false
+	}
+	for dir := path.Dir(p); ; dir = path.Dir(dir) {
+		if ok, _ := path.Match(prefix+"*", dir); ok {
+			return true
+		}
+		if dir == "/" || dir == "." {
+			return false
+		}
+	}
 }
@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestInvalidate(t *testing.T) {
+	db, err := InitializeCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	index := httptest.NewRequest("GET", "/index.php", nil)
+	login := httptest.NewRequest("GET", "/login.php", nil)
+	for _, r := range []string{GetCacheKey(index, "8080"), GetCacheKey(login, "8080")} {
+		if err := StoreResponse(db, r, []byte(`{"headers":{},"body":"ok"}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := Invalidate(db, GetCacheKey(index, "8080"))
+	if err != nil || n != 1 {
+		t.Fatalf("Invalidate() = %d, %v, want 1 record", n, err)
+	}
+	if _, err := CheckCache(db, index, "8080", -1); err != ErrCacheMiss {
+		t.Errorf("Expected invalidated entry to be regenerated, got %v", err)
+	}
+	if resp, err := CheckCache(db, login, "8080", -1); err != nil || resp == nil {
+		t.Errorf("Expected other entry to stay cached, got %v", err)
+	}
+
+	n, err = InvalidateAll(db)
+	if err != nil || n != 1 {
+		t.Fatalf("InvalidateAll() = %d, %v, want 1 record", n, err)
+	}
+	if _, err := CheckCache(db, login, "8080", -1); err != ErrCacheMiss {
+		t.Errorf("Expected all entries to be regenerated, got %v", err)
+	}
+}
+
+func TestInvalidateConcurrent(t *testing.T) {
+	db, err := InitializeCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := httptest.NewRequest("GET", fmt.Sprintf("/page%d", i), nil)
+			key := GetCacheKey(r, "8080")
+			if err := StoreResponse(db, key, []byte("{}")); err != nil {
+				t.Error(err)
+			}
+			if _, err := CheckCache(db, r, "8080", -1); err != nil && err != ErrCacheMiss {
+				t.Error(err)
+			}
+			if i%5 == 0 {
+				if _, err := InvalidateAll(db); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestInvalidateMatching(t *testing.T) {
+	db, err := InitializeCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	requests := []struct {
+		port, target, host, source string
+	}{
+		{"8080", "/wp-login.php", "blog.example.com", "192.0.2.1"},
+		{"8080", "/wp-admin/?x=1", "blog.example.com", "192.0.2.2"},
+		{"443", "/wp-login.php", "shop.example.com", "192.0.2.1"},
+		{"443", "/index.php", "shop.example.com", "192.0.2.3"},
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest("GET", req.target, nil)
+		r.Host = req.host
+		r.RemoteAddr = req.source + ":1234"
+		if err := StoreRequestResponse(db, r, GetCacheKey(r, req.port), []byte("{}"), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A second record of the same key is listed once.
+	if err := StoreResponse(db, "443_/index.php", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		filter Filter
+		want   int
+	}{
+		{Filter{}, 4},
+		{Filter{Path: "/wp-*"}, 3},
+		{Filter{Path: "/wp-admin/"}, 1},
+		{Filter{Port: "443"}, 2},
+		{Filter{Host: "Blog.Example.com"}, 2},
+		{Filter{Source: "192.0.2.1"}, 2},
+		{Filter{Path: "/wp-login.php", Host: "shop.example.com"}, 1},
+	}
+	for _, tt := range tests {
+		entries, err := List(db, tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != tt.want {
+			t.Errorf("List(%+v) returned %d entries, want %d", tt.filter, len(entries), tt.want)
+		}
+	}
+
+	n, err := InvalidateMatching(db, Filter{Source: "192.0.2.1"})
+	if err != nil || n != 2 {
+		t.Fatalf("InvalidateMatching() = %d, %v, want 2 records", n, err)
+	}
+	entries, err := List(db, Filter{})
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Expected 2 entries left, got %d, %v", len(entries), err)
+	}
+	if entries[0].Key != "443_/index.php" || entries[0].Host != "" {
+		t.Errorf("Expected the latest record first, got %+v", entries[0])
+	}
+}
+
+func TestInitializeCacheMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE cache (id INTEGER PRIMARY KEY AUTOINCREMENT, cachedAt DATETIME, key TEXT, response TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO cache (cachedAt, key, response) VALUES (?, ?, ?)", time.Now(), "80_/", "{}"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := InitializeCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	entries, err := List(store, Filter{})
+	if err != nil || len(entries) != 1 || entries[0].Key != "80_/" {
+		t.Errorf("Expected the existing entry to be kept, got %+v, %v", entries, err)
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/wp-login.php", "/wp-login.php", true},
+		{"/wp-*", "/wp-login.php", true},
+		{"/wp-*", "/wp-admin/includes/file.php", true},
+		{"/api/*", "/api/v1/users", true},
+		{"/api/*", "/apis", false},
+		{"/wp-*", "/blog/wp-login.php", false},
+		{"/*.php", "/admin/index.php", false},
+	}
+	for _, tt := range tests {
+		if got := MatchPath(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("MatchPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/bluele/gcache"
+)
+
+// defaultSourceResponses is the number of remembered responses if not set.
+const defaultSourceResponses = 10_000
+
+// SourceResponses remembers the response served to each source for each
+// request, so a source requesting the same resource again is served the
+// exact same response, including its generated values (e.g. the session IDs
+// and the variations applied after the generation). The number of
+// remembered responses is bounded, and the least recently used ones are
+// evicted first.
+type SourceResponses struct {
+	responses gcache.Cache
+}
+
+// NewSourceResponses returns a SourceResponses remembering up to size
+// responses (10,000 if 0) for ttl (forever if 0).
+func NewSourceResponses(size int, ttl time.Duration) *SourceResponses {
+	if size <= 0 {
+		size = defaultSourceResponses
+	}
+	builder := gcache.New(size).LRU()
+	if ttl > 0 {
+		builder = builder.Expiration(ttl)
+	}
+	return &SourceResponses{responses: builder.Build()}
+}
+
+// Get returns the response served to the source for the cache key.
+func (s *SourceResponses) Get(source, key string) ([]byte, bool) {
+	val, err := s.responses.Get(source + "\n" + key)
+	if err != nil {
+		return nil, false
+	}
+	resp, ok := val.([]byte)
+	return resp, ok
+}
+
+// Set remembers the response served to the source for the cache key.
+func (s *SourceResponses) Set(source, key string, resp []byte) {
+	_ = s.responses.Set(source+"\n"+key, resp)
+}
@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSourceResponses(t *testing.T) {
+	s := NewSourceResponses(2, 50*time.Millisecond)
+
+	s.Set("192.0.2.1", "80_/", []byte("a"))
+	s.Set("192.0.2.2", "80_/", []byte("b"))
+	if resp, ok := s.Get("192.0.2.1", "80_/"); !ok || string(resp) != "a" {
+		t.Errorf("Get() = %q, %v, want %q", resp, ok, "a")
+	}
+	if _, ok := s.Get("192.0.2.1", "80_/admin"); ok {
+		t.Error("Expected no response for another resource")
+	}
+
+	// The least recently used response is evicted.
+	s.Set("192.0.2.3", "80_/", []byte("c"))
+	if _, ok := s.Get("192.0.2.2", "80_/"); ok {
+		t.Error("Expected the least recently used response to be evicted")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := s.Get("192.0.2.1", "80_/"); ok {
+		t.Error("Expected the response to expire")
+	}
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DefaultIgnoredParams are the query parameters left out of the cache keys
+// by default: cache busters, random tokens and tracking parameters that
+// don't change the response. A trailing * matches any suffix.
+var DefaultIgnoredParams = []string{"_", "cb", "t", "ts", "timestamp", "nocache", "rand", "random", "nonce", "utm_*"}
+
+// KeyConfig controls the normalization of the requests into cache keys.
+// Headers are the request headers included in the keys (e.g. Accept), and
+// IgnoredParams the query parameters left out of them (DefaultIgnoredParams
+// if nil).
+type KeyConfig struct {
+	Headers       []string
+	IgnoredParams []string
+}
+
+// RequestKey returns the cache key of the request: the port, the method (for
+// methods other than GET), the path, the sorted query parameters
+// that aren't ignored and the values of the selected headers. Requests that
+// differ only by other headers (e.g. the User-Agent), the order of their
+// query parameters or ignored parameters share a key.
+func RequestKey(r *http.Request, port string, conf KeyConfig) string {
+	ignored := conf.IgnoredParams
+	if ignored == nil {
+		ignored = DefaultIgnoredParams
+	}
+
+	var b strings.Builder
+	b.WriteString(port)
+	b.WriteByte('_')
+	if r.Method != http.MethodGet && r.Method != "" {
+		b.WriteString(r.Method)
+		b.WriteByte(' ')
+	}
+	b.WriteString(normalizePath(r.URL))
+	if query := normalizeQuery(r.URL.Query(), ignored); query != "" {
+		b.WriteByte('?')
+		b.WriteString(query)
+	}
+
+	names := make([]string, 0, len(conf.Headers))
+	for _, h := range conf.Headers {
+		names = append(names, http.CanonicalHeaderKey(h))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.Join(r.Header.Values(name), ", ")
+		if name == "Host" {
+			value = strings.ToLower(r.Host)
+		}
+		if value != "" {
+			b.WriteString("\n" + name + ": " + value)
+		}
+	}
+	return b.String()
+}
+
+// normalizePath returns the escaped path of the URL. Dot segments and
+// repeated slashes are kept, as path traversal probes need their own
+// responses. Absolute URLs (e.g. of proxy requests) keep their scheme and
+// host.
+func normalizePath(u *url.URL) string {
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if u.Host != "" {
+		return u.Scheme + "://" + strings.ToLower(u.Host) + p
+	}
+	return p
+}
+
+// normalizeQuery returns the encoded query without the ignored parameters,
+// sorted by key. The order of the values of a key is kept.
+func normalizeQuery(query url.Values, ignored []string) string {
+	for key := range query {
+		if isIgnoredParam(key, ignored) {
+			delete(query, key)
+		}
+	}
+	return query.Encode()
+}
+
+func isIgnoredParam(key string, ignored []string) bool {
+	key = strings.ToLower(key)
+	for _, p := range ignored {
+		p = strings.ToLower(p)
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == p {
+			return true
+		}
+	}
+	return false
+}
+
+// parseKey returns the port, the method and the path of a cache key.
+func parseKey(key string) (port, method, rawPath string) {
+	port, rest, _ := strings.Cut(key, "_")
+	rest, _, _ = strings.Cut(rest, "\n")
+	method = http.MethodGet
+	if m, target, ok := strings.Cut(rest, " "); ok && !strings.HasPrefix(rest, "/") {
+		method, rest = m, target
+	}
+	if u, err := url.Parse(rest); err == nil {
+		rest = u.Path
+	}
+	return port, method, rest
+}
+
+// KeyRequest returns the request of the entry, as far as its key records it:
+// the method, the target and the selected headers, with the host and the
+// source of the entry. The other headers and the body of the request aren't
+// recorded.
+func KeyRequest(e Entry) (*http.Request, error) {
+	_, rest, _ := strings.Cut(e.Key, "_")
+	target, headers, _ := strings.Cut(rest, "\n")
+	method := http.MethodGet
+	if m, t, ok := strings.Cut(target, " "); ok && !strings.HasPrefix(target, "/") {
+		method, target = m, t
+	}
+	r, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.RequestURI = target
+	for _, line := range strings.Split(headers, "\n") {
+		if name, value, ok := strings.Cut(line, ": "); ok {
+			r.Header.Add(name, value)
+		}
+	}
+	if host := r.Header.Get("Host"); host != "" {
+		r.Host = host
+		r.Header.Del("Host")
+	}
+	if e.Host != "" {
+		r.Host = e.Host
+	}
+	if e.Source != "" {
+		r.RemoteAddr = net.JoinHostPort(e.Source, "0")
+	}
+	return r, nil
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		header map[string]string
+		conf   KeyConfig
+		want   string
+	}{
+		{
+			name:   "get",
+			method: "GET",
+			target: "/index.php",
+			want:   "8080_/index.php",
+		},
+		{
+			name:   "otherMethod",
+			method: "POST",
+			target: "/login.php",
+			want:   "8080_POST /login.php",
+		},
+		{
+			name:   "sortedQueryWithoutCacheBusters",
+			method: "GET",
+			target: "/search?q=test&_=1712345678&a=1&utm_source=x&TS=99",
+			want:   "8080_/search?a=1&q=test",
+		},
+		{
+			name:   "configuredIgnoredParams",
+			method: "GET",
+			target: "/search?q=test&_=1712345678&session=abc",
+			conf:   KeyConfig{IgnoredParams: []string{"sess*"}},
+			want:   "8080_/search?_=1712345678&q=test",
+		},
+		{
+			name:   "pathTraversalIsKept",
+			method: "GET",
+			target: "/cgi-bin/.%2e/.%2e/etc/passwd",
+			want:   "8080_/cgi-bin/.%2e/.%2e/etc/passwd",
+		},
+		{
+			name:   "selectedHeaders",
+			method: "GET",
+			target: "/",
+			header: map[string]string{"Accept": "application/json", "User-Agent": "curl/8.0"},
+			conf:   KeyConfig{Headers: []string{"host", "accept"}},
+			want:   "8080_/\nAccept: application/json\nHost: example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			if got := RequestKey(r, "8080", tt.conf); got != tt.want {
+				t.Errorf("RequestKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Requests differing only by their User-Agent share a key.
+	a := httptest.NewRequest("GET", "/?b=2&a=1", nil)
+	a.Header.Set("User-Agent", "Mozilla/5.0")
+	b := httptest.NewRequest("GET", "/?a=1&b=2&nocache=123", nil)
+	b.Header.Set("User-Agent", "zgrab/0.x")
+	if GetCacheKey(a, "80") != GetCacheKey(b, "80") {
+		t.Errorf("Expected the same key, got %q and %q", GetCacheKey(a, "80"), GetCacheKey(b, "80"))
+	}
+}
+
+func TestFilterMethod(t *testing.T) {
+	post := Entry{Key: RequestKey(httptest.NewRequest("POST", "/wp-login.php?x=1", nil), "80", KeyConfig{Headers: []string{"Host"}})}
+	get := Entry{Key: GetCacheKey(httptest.NewRequest("GET", "/wp-login.php", nil), "80")}
+
+	f := Filter{Method: "post", Path: "/wp-login.php"}
+	if !f.Match(post) || f.Match(get) {
+		t.Errorf("Expected the filter to only match the POST entry")
+	}
+	if f := (Filter{Method: "GET", Port: "80"}); !f.Match(get) {
+		t.Errorf("Expected the filter to match the GET entry")
+	}
+}
+
+func TestKeyRequest(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/login?b=2&a=1", nil)
+	r.Header.Set("Accept", "application/json")
+	key := RequestKey(r, "8080", KeyConfig{Headers: []string{"Accept"}})
+
+	got, err := KeyRequest(Entry{Key: key, Host: "shop.example.com", Source: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Method != "POST" || got.RequestURI != "/api/login?a=1&b=2" || got.URL.Query().Get("a") != "1" {
+		t.Errorf("Expected the method and target of the key, got %s %s", got.Method, got.RequestURI)
+	}
+	if got.Header.Get("Accept") != "application/json" || got.Host != "shop.example.com" || got.RemoteAddr != "192.0.2.1:0" {
+		t.Errorf("Expected the headers, host and source of the entry, got %v, %q and %q", got.Header, got.Host, got.RemoteAddr)
+	}
+}
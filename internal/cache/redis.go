@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// redisKeyPrefix prefixes the keys of the cached responses in Redis.
+	redisKeyPrefix = "galah:cache:"
+	redisTimeout   = 5 * time.Second
+	redisPoolSize  = 16
+)
+
+// RedisStore is a Store in a Redis server, shared by several honeypot
+// instances. Responses are stored with the time they were cached, and expire
+// in Redis after the TTL, if set.
+type RedisStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisStore returns a Store in the Redis server at the given URL, e.g.
+// redis://:password@localhost:6379/0 (rediss:// for TLS). Responses expire
+// after the given TTL, or never if it's 0.
+func NewRedisStore(rawURL string, ttl time.Duration) (*RedisStore, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	opts.DialTimeout = redisTimeout
+	opts.ReadTimeout = redisTimeout
+	opts.WriteTimeout = redisTimeout
+	opts.PoolSize = redisPoolSize
+
+	s := &RedisStore{client: redis.NewClient(opts), ttl: ttl}
+	// Check the connection.
+	if err := s.Ping(); err != nil {
+		s.client.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get implements Store.
+func (s *RedisStore) Get(key string) ([]byte, time.Time, error) {
+	value, err := s.client.Get(context.Background(), redisKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, time.Time{}, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	entry, resp, err := parseRedisValue(key, value)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return resp, entry.CachedAt, nil
+}
+
+// parseRedisValue parses a cached value: a line with the time the response
+// was cached in Unix nanoseconds, the host and the source of the request,
+// separated by spaces, followed by the response.
+func parseRedisValue(key string, value []byte) (Entry, []byte, error) {
+	line, resp, found := strings.Cut(string(value), "\n")
+	fields := strings.Split(line, " ")
+	nanos, err := strconv.ParseInt(fields[0], 10, 64)
+	if !found || err != nil {
+		return Entry{}, nil, fmt.Errorf("invalid cached value for %q", key)
+	}
+	entry := Entry{Key: key, CachedAt: time.Unix(0, nanos), Size: len(resp)}
+	if len(fields) == 3 {
+		entry.Host, entry.Source = fields[1], fields[2]
+	}
+	return entry, []byte(resp), nil
+}
+
+// Set implements Store. The entry's TTL overrides the store's.
+func (s *RedisStore) Set(entry Entry, resp []byte) error {
+	line := strings.Join([]string{
+		strconv.FormatInt(time.Now().UnixNano(), 10),
+		strings.ReplaceAll(entry.Host, " ", ""),
+		strings.ReplaceAll(entry.Source, " ", ""),
+	}, " ")
+	ttl := s.ttl
+	if entry.TTL != 0 {
+		ttl = entry.TTL
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	return s.client.Set(context.Background(), redisKeyPrefix+entry.Key, line+"\n"+string(resp), ttl).Err()
+}
+
+// List implements Store.
+func (s *RedisStore) List() ([]Entry, error) {
+	var entries []Entry
+	err := s.scan(func(keys []string) error {
+		for _, k := range keys {
+			value, err := s.client.Get(context.Background(), k).Bytes()
+			if errors.Is(err, redis.Nil) {
+				// Expired or deleted since the scan.
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			entry, _, err := parseRedisValue(strings.TrimPrefix(k, redisKeyPrefix), value)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CachedAt.After(entries[j].CachedAt) })
+	return entries, err
+}
+
+// Delete implements Store.
+func (s *RedisStore) Delete(key string) (int64, error) {
+	return s.client.Del(context.Background(), redisKeyPrefix+key).Result()
+}
+
+// DeleteAll implements Store.
+func (s *RedisStore) DeleteAll() (int64, error) {
+	var deleted int64
+	err := s.scan(func(keys []string) error {
+		n, err := s.client.Del(context.Background(), keys...).Result()
+		deleted += n
+		return err
+	})
+	return deleted, err
+}
+
+// scan calls fn with each page of the keys of the cached responses.
+func (s *RedisStore) scan(fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := s.client.Scan(context.Background(), cursor, redisKeyPrefix+"*", 1000).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if cursor = next; cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// Client returns the client of the Redis server, for the other state shared
+// in the server (see the cluster package).
+func (s *RedisStore) Client() *redis.Client {
+	return s.client
+}
+
+// Ping checks the Redis server answers.
+func (s *RedisStore) Ping() error {
+	return s.client.Ping(context.Background()).Err()
+}
+
+// Close closes the connections to the Redis server.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisStore(t *testing.T) {
+	m := miniredis.RunT(t)
+	m.RequireAuth("secret")
+	addr := m.Addr()
+
+	if _, err := NewRedisStore("redis://:wrong@"+addr, 0); err == nil {
+		t.Fatal("Expected an error with a wrong password")
+	}
+	store, err := NewRedisStore("redis://:secret@"+addr, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := Ping(store); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+
+	index := httptest.NewRequest("GET", "/index.php", nil)
+	if _, err := CheckCache(store, index, "8080", 1); err != ErrCacheMiss {
+		t.Fatalf("Expected %v, got %v", ErrCacheMiss, err)
+	}
+	resp := "{\"headers\":{},\"body\":\"line 1\\nline 2\"}"
+	if err := StoreResponse(store, GetCacheKey(index, "8080"), []byte(resp)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := CheckCache(store, index, "8080", 1)
+	if err != nil || string(got) != resp {
+		t.Errorf("CheckCache() = %q, %v, want %q", got, err, resp)
+	}
+
+	entries, err := List(store, Filter{Path: "/index.php"})
+	if err != nil || len(entries) != 1 || entries[0].Key != "8080_/index.php" || entries[0].Size != len(resp) {
+		t.Errorf("List() = %+v, %v", entries, err)
+	}
+
+	// The other instances share the cache.
+	other, err := NewRedisStore("redis://:secret@"+addr, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := CheckCache(other, index, "8080", 1); err != nil || string(got) != resp {
+		t.Errorf("Expected the response to be shared, got %q, %v", got, err)
+	}
+
+	if ttl := m.TTL(redisKeyPrefix + GetCacheKey(index, "8080")); ttl != time.Hour {
+		t.Errorf("Expected the response expiring after the TTL, got %s", ttl)
+	}
+	m.Set("unrelated", "value")
+	n, err := InvalidateAll(store)
+	if err != nil || n != 1 {
+		t.Fatalf("InvalidateAll() = %d, %v, want 1 record", n, err)
+	}
+	if !m.Exists("unrelated") {
+		t.Error("Expected the keys of other applications to be kept")
+	}
+	if _, err := CheckCache(store, index, "8080", -1); err != ErrCacheMiss {
+		t.Errorf("Expected all entries to be regenerated, got %v", err)
+	}
+}
+
+func TestNewRedisStoreURL(t *testing.T) {
+	for _, rawURL := range []string{"http://localhost", "redis://localhost/db"} {
+		if _, err := NewRedisStore(rawURL, 0); err == nil {
+			t.Errorf("Expected an error for %q", rawURL)
+		}
+	}
+}
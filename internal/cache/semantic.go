@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxSemanticBody is the maximum number of body bytes included in the
+	// text of a request that is embedded.
+	maxSemanticBody = 2048
+	// defaultSemanticThreshold is the similarity threshold used if none is
+	// configured.
+	defaultSemanticThreshold = 0.95
+)
+
+// Embedder returns the embedding vector of a text.
+type Embedder interface {
+	EmbedQuery(ctx context.Context, text string) ([]float32, error)
+}
+
+// SemanticIndex finds the cached responses of requests that are similar to a
+// new request, by the cosine similarity of the embeddings of the normalized
+// requests. The embeddings are kept in memory and stored in the cache
+// database. When the index is full, the oldest embeddings are evicted first.
+type SemanticIndex struct {
+	db         *sql.DB
+	embedder   Embedder
+	threshold  float64
+	maxEntries int
+
+	mu      sync.RWMutex
+	entries []semanticEntry
+}
+
+type semanticEntry struct {
+	key    string
+	port   string
+	vector []float32
+}
+
+// NewSemanticIndex returns a semantic index of the responses cached in db,
+// loading the stored embeddings. Responses are reused for requests whose
+// similarity is at least threshold (0.95 if 0).
+func NewSemanticIndex(db *sql.DB, embedder Embedder, threshold float64, maxEntries int) (*SemanticIndex, error) {
+	if threshold <= 0 {
+		threshold = defaultSemanticThreshold
+	}
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS embeddings (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		key TEXT UNIQUE,
+		port TEXT,
+		vector BLOB
+	)
+`)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &SemanticIndex{db: db, embedder: embedder, threshold: threshold, maxEntries: maxEntries}
+	rows, err := db.Query("SELECT key, port, vector FROM embeddings ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e semanticEntry
+		var vector []byte
+		if err := rows.Scan(&e.key, &e.port, &vector); err != nil {
+			return nil, err
+		}
+		e.vector = decodeVector(vector)
+		idx.entries = append(idx.entries, e)
+	}
+	return idx, rows.Err()
+}
+
+// Lookup returns the cache key of the most similar request on the same
+// port, and the embedding of the request to add it to the index once its
+// response is generated. It returns ErrCacheMiss if no request is similar
+// enough.
+func (idx *SemanticIndex) Lookup(ctx context.Context, r *http.Request, port string) (string, []float32, error) {
+	vector, err := idx.embedder.EmbedQuery(ctx, SemanticText(r))
+	if err != nil {
+		return "", nil, err
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	best, bestKey := -1.0, ""
+	for _, e := range idx.entries {
+		if e.port != port {
+			continue
+		}
+		if sim := cosineSimilarity(vector, e.vector); sim > best {
+			best, bestKey = sim, e.key
+		}
+	}
+	if bestKey == "" || best < idx.threshold {
+		return "", vector, ErrCacheMiss
+	}
+	return bestKey, vector, nil
+}
+
+// Add indexes the embedding of the request whose response is cached under
+// the given key.
+func (idx *SemanticIndex) Add(key, port string, vector []float32) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for i, e := range idx.entries {
+		if e.key == key {
+			idx.entries = append(idx.entries[:i], idx.entries[i+1:]...)
+			break
+		}
+	}
+	idx.entries = append(idx.entries, semanticEntry{key: key, port: port, vector: vector})
+	if _, err := idx.db.Exec("INSERT OR REPLACE INTO embeddings (key, port, vector) VALUES (?, ?, ?)", key, port, encodeVector(vector)); err != nil {
+		return err
+	}
+
+	if idx.maxEntries > 0 && len(idx.entries) > idx.maxEntries {
+		evicted := idx.entries[:len(idx.entries)-idx.maxEntries]
+		idx.entries = append([]semanticEntry(nil), idx.entries[len(evicted):]...)
+		for _, e := range evicted {
+			if _, err := idx.db.Exec("DELETE FROM embeddings WHERE key = ?", e.key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SemanticText returns the normalized text of the request that is embedded:
+// the method, the lower-cased path, the sorted query parameters and the
+// start of the body. Headers are left out, as they vary between clients.
+func SemanticText(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(strings.ToLower(r.URL.Path))
+
+	query := r.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range query[k] {
+			b.WriteString("\n" + k + "=" + v)
+		}
+	}
+
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err == nil && len(body) > 0 {
+			if len(body) > maxSemanticBody {
+				body = body[:maxSemanticBody]
+			}
+			if decoded, err := url.QueryUnescape(string(body)); err == nil {
+				body = []byte(decoded)
+			}
+			b.WriteString("\n\n")
+			b.Write(body)
+		}
+	}
+	return b.String()
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// wordEmbedder embeds a text as the counts of the given words.
+type wordEmbedder []string
+
+func (e wordEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	vector := make([]float32, len(e))
+	for i, w := range e {
+		vector[i] = float32(strings.Count(text, w))
+	}
+	return vector, nil
+}
+
+func TestSemanticIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	db, err := InitializeCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	embedder := wordEmbedder{"wp-login", "admin", "phpmyadmin", "id="}
+	idx, err := NewSemanticIndex(db.DB, embedder, 0.9, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := httptest.NewRequest("GET", "/wp-login.php?id=1", nil)
+	if _, _, err := idx.Lookup(context.Background(), login, "80"); err != ErrCacheMiss {
+		t.Fatalf("Expected a miss on an empty index, got %v", err)
+	}
+	_, vector, _ := idx.Lookup(context.Background(), login, "80")
+	if err := idx.Add(GetCacheKey(login, "80"), "80", vector); err != nil {
+		t.Fatal(err)
+	}
+
+	similar := httptest.NewRequest("GET", "/WP-LOGIN.php?id=2", nil)
+	key, _, err := idx.Lookup(context.Background(), similar, "80")
+	if err != nil || key != GetCacheKey(login, "80") {
+		t.Errorf("Expected the similar request to match %q, got %q, %v", GetCacheKey(login, "80"), key, err)
+	}
+	if _, _, err := idx.Lookup(context.Background(), similar, "8080"); err != ErrCacheMiss {
+		t.Errorf("Expected a miss on another port, got %v", err)
+	}
+	different := httptest.NewRequest("GET", "/phpmyadmin/", nil)
+	if _, _, err := idx.Lookup(context.Background(), different, "80"); err != ErrCacheMiss {
+		t.Errorf("Expected a miss for a different request, got %v", err)
+	}
+
+	// The oldest entries are evicted, and the index is reloaded from the database.
+	for _, path := range []string{"/phpmyadmin/", "/admin/"} {
+		r := httptest.NewRequest("GET", path, nil)
+		_, vector, _ := idx.Lookup(context.Background(), r, "80")
+		if err := idx.Add(GetCacheKey(r, "80"), "80", vector); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reloaded, err := NewSemanticIndex(db.DB, embedder, 0.9, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(reloaded.entries))
+	}
+	if _, _, err := reloaded.Lookup(context.Background(), similar, "80"); err != ErrCacheMiss {
+		t.Errorf("Expected the evicted entry to miss, got %v", err)
+	}
+	if key, _, err := reloaded.Lookup(context.Background(), different, "80"); err != nil || key != "80_/phpmyadmin/" {
+		t.Errorf("Expected a match for %q, got %q, %v", "80_/phpmyadmin/", key, err)
+	}
+}
+
+func TestSemanticText(t *testing.T) {
+	r := httptest.NewRequest("POST", "/Login?b=2&a=1", strings.NewReader("user=admin%40example.com"))
+	r.Header.Set("User-Agent", "curl/8.0")
+
+	want := "POST /login\na=1\nb=2\n\nuser=admin@example.com"
+	if got := SemanticText(r); got != want {
+		t.Errorf("SemanticText() = %q, want %q", got, want)
+	}
+	if got := SemanticText(r); got != want {
+		t.Errorf("Expected the body to be readable again, got %q", got)
+	}
+}
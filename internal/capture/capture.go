@@ -0,0 +1,398 @@
+// Package capture records the packets of the honeypot traffic into PCAP
+// files: the traffic of the captured ports and of the flagged sessions, with
+// the packets of their sources buffered until they are flagged.
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/sirupsen/logrus"
+)
+
+// Default settings of the capture.
+const (
+	DefaultInterface   = "any"
+	DefaultDirectory   = "pcaps"
+	DefaultSnaplen     = 65535
+	DefaultMaxFileSize = 100 << 20
+	DefaultMaxDuration = time.Hour
+	DefaultBuffer      = 1000
+)
+
+// Limits of the buffered packets: the number of sources and the total size.
+const (
+	maxSources  = 1000
+	maxBuffered = 64 << 20
+)
+
+// Sizes of the headers of the PCAP files and packets.
+const (
+	fileHeaderSize   = 24
+	packetHeaderSize = 16
+)
+
+// Config configures a Capturer. The packets of the TCP traffic of the Ports
+// of the honeypot are read from Interface (DefaultInterface if empty),
+// truncated to Snaplen bytes (DefaultSnaplen if 0). The traffic of the
+// CapturePorts is written to files rotated after MaxFileSize bytes
+// (DefaultMaxFileSize if 0) or MaxDuration (DefaultMaxDuration if 0), and
+// if FlaggedSessions is true, the traffic of a flagged session is written to
+// a file closed after the same limits. The last Buffer packets (DefaultBuffer
+// if 0) of each source are then buffered to be written when its session is
+// flagged. The files are written to Directory (DefaultDirectory if empty).
+type Config struct {
+	Interface       string
+	Ports           []uint16
+	CapturePorts    []uint16
+	FlaggedSessions bool
+	Directory       string
+	Snaplen         int
+	MaxFileSize     int64
+	MaxDuration     time.Duration
+	Buffer          int
+}
+
+// Source is a source of packets, such as a live capture.
+type Source interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+	LinkType() layers.LinkType
+	Close()
+}
+
+// packet is a packet read from the source.
+type packet struct {
+	data []byte
+	ci   gopacket.CaptureInfo
+}
+
+// file is a PCAP file being written.
+type file struct {
+	f     *os.File
+	w     *pcapgo.Writer
+	path  string
+	size  int64
+	start time.Time
+}
+
+// Capturer writes the packets of a source to the PCAP files, safe for
+// concurrent use.
+type Capturer struct {
+	cfg    Config
+	src    Source
+	logger *logrus.Logger
+
+	ports   map[uint16]bool
+	capture map[uint16]bool
+
+	mu       sync.Mutex
+	buffers  map[string][]packet
+	lastSeen map[string]time.Time
+	buffered int64
+	sessions map[string]*file
+	files    map[uint16]*file
+	closed   bool
+	done     chan struct{}
+}
+
+// New returns a capturer of the packets of the source, read until it is
+// closed, and creates the directory of the files.
+func New(cfg Config, src Source, logger *logrus.Logger) (*Capturer, error) {
+	cfg = cfg.withDefaults()
+	if err := os.MkdirAll(cfg.Directory, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating the capture directory: %s", err)
+	}
+
+	c := &Capturer{
+		cfg:      cfg,
+		src:      src,
+		logger:   logger,
+		ports:    make(map[uint16]bool),
+		capture:  make(map[uint16]bool),
+		buffers:  make(map[string][]packet),
+		lastSeen: make(map[string]time.Time),
+		sessions: make(map[string]*file),
+		files:    make(map[uint16]*file),
+		done:     make(chan struct{}),
+	}
+	for _, port := range cfg.Ports {
+		c.ports[port] = true
+	}
+	for _, port := range cfg.CapturePorts {
+		c.ports[port], c.capture[port] = true, true
+	}
+	go c.read()
+	return c, nil
+}
+
+// withDefaults returns the configuration with the defaults of the settings
+// not set.
+func (cfg Config) withDefaults() Config {
+	if cfg.Interface == "" {
+		cfg.Interface = DefaultInterface
+	}
+	if cfg.Directory == "" {
+		cfg.Directory = DefaultDirectory
+	}
+	if cfg.Snaplen <= 0 {
+		cfg.Snaplen = DefaultSnaplen
+	}
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = DefaultMaxFileSize
+	}
+	if cfg.MaxDuration <= 0 {
+		cfg.MaxDuration = DefaultMaxDuration
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = DefaultBuffer
+	}
+	return cfg
+}
+
+// filter returns the BPF filter of the TCP traffic of the ports.
+func filter(ports []uint16) string {
+	if len(ports) == 0 {
+		return "tcp"
+	}
+	f := "tcp and ("
+	for i, port := range ports {
+		if i > 0 {
+			f += " or "
+		}
+		f += fmt.Sprintf("port %d", port)
+	}
+	return f + ")"
+}
+
+// read handles the packets of the source until it is closed.
+func (c *Capturer) read() {
+	defer close(c.done)
+	for {
+		data, ci, err := c.src.ReadPacketData()
+		if err != nil {
+			if errors.Is(err, io.EOF) || c.isClosed() {
+				return
+			}
+			c.logger.Errorf("error reading the captured packets: %s", err)
+			return
+		}
+		c.handle(packet{data: data, ci: ci})
+	}
+}
+
+func (c *Capturer) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// handle writes the packet to the files of its port and session, or buffers
+// it.
+func (c *Capturer) handle(p packet) {
+	source, port, ok := c.endpoints(p.data)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	if c.capture[port] {
+		c.writePort(port, p)
+	}
+	if f, ok := c.sessions[source]; ok {
+		if !c.write(f, p) {
+			c.closeFile(f)
+			delete(c.sessions, source)
+		}
+		return
+	}
+	if c.cfg.FlaggedSessions {
+		c.buffer(source, p)
+	}
+}
+
+// endpoints returns the remote source and the honeypot port of the packet.
+func (c *Capturer) endpoints(data []byte) (string, uint16, bool) {
+	pkt := gopacket.NewPacket(data, c.src.LinkType(), gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	network := pkt.NetworkLayer()
+	tcp, ok := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if network == nil || !ok {
+		return "", 0, false
+	}
+	src, dst := network.NetworkFlow().Endpoints()
+	switch {
+	case c.ports[uint16(tcp.DstPort)]:
+		return src.String(), uint16(tcp.DstPort), true
+	case c.ports[uint16(tcp.SrcPort)]:
+		return dst.String(), uint16(tcp.SrcPort), true
+	}
+	return "", 0, false
+}
+
+// buffer keeps the packet among the last packets of the source, dropping the
+// packets of the least recently seen sources beyond the limits. It must be
+// called with c.mu held.
+func (c *Capturer) buffer(source string, p packet) {
+	p.data = append([]byte{}, p.data...)
+	buf := append(c.buffers[source], p)
+	c.buffered += int64(len(p.data))
+	if len(buf) > c.cfg.Buffer {
+		for _, dropped := range buf[:len(buf)-c.cfg.Buffer] {
+			c.buffered -= int64(len(dropped.data))
+		}
+		buf = append([]packet{}, buf[len(buf)-c.cfg.Buffer:]...)
+	}
+	c.buffers[source] = buf
+	c.lastSeen[source] = p.ci.Timestamp
+
+	for len(c.buffers) > 1 && (len(c.buffers) > maxSources || c.buffered > maxBuffered) {
+		var oldest string
+		for s, t := range c.lastSeen {
+			if s != source && (oldest == "" || t.Before(c.lastSeen[oldest])) {
+				oldest = s
+			}
+		}
+		c.drop(oldest)
+	}
+}
+
+// drop drops the buffered packets of the source. It must be called with c.mu
+// held.
+func (c *Capturer) drop(source string) {
+	for _, p := range c.buffers[source] {
+		c.buffered -= int64(len(p.data))
+	}
+	delete(c.buffers, source)
+	delete(c.lastSeen, source)
+}
+
+// Flag starts the capture of the session of the source, writing its buffered
+// packets to the file of the session, and returns the path of the file. The
+// capture ends at the limits of the files, or when a session of the source is
+// flagged again. The sessions aren't captured, and the path is empty, unless
+// FlaggedSessions is true.
+func (c *Capturer) Flag(id, source string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.cfg.FlaggedSessions {
+		return "", nil
+	}
+	if c.closed {
+		return "", errors.New("the capture is closed")
+	}
+	if f, ok := c.sessions[source]; ok {
+		c.closeFile(f)
+	}
+	f, err := c.create(fmt.Sprintf("session-%s.pcap", id), time.Now())
+	if err != nil {
+		return "", err
+	}
+	c.sessions[source] = f
+	for _, p := range c.buffers[source] {
+		if !c.write(f, p) {
+			break
+		}
+	}
+	c.drop(source)
+	return f.path, nil
+}
+
+// writePort writes the packet to the file of the port, rotated at the limits.
+// It must be called with c.mu held.
+func (c *Capturer) writePort(port uint16, p packet) {
+	f := c.files[port]
+	if f != nil && !c.write(f, p) {
+		c.closeFile(f)
+		f = nil
+	}
+	if f == nil {
+		var err error
+		name := fmt.Sprintf("port-%d-%s.pcap", port, p.ci.Timestamp.UTC().Format("20060102T150405.000000000Z"))
+		if f, err = c.create(name, p.ci.Timestamp); err != nil {
+			c.logger.Errorf("error creating the capture file: %s", err)
+			delete(c.files, port)
+			return
+		}
+		c.files[port] = f
+		c.write(f, p)
+	}
+}
+
+// create creates the named file and writes its header.
+func (c *Capturer) create(name string, start time.Time) (*file, error) {
+	path := filepath.Join(c.cfg.Directory, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	w := pcapgo.NewWriterNanos(f)
+	if err := w.WriteFileHeader(uint32(c.cfg.Snaplen), c.src.LinkType()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &file{f: f, w: w, path: path, size: fileHeaderSize, start: start}, nil
+}
+
+// write writes the packet to the file, truncated to the snaplen, and reports
+// whether the file is within its limits.
+func (c *Capturer) write(f *file, p packet) bool {
+	data := p.data
+	if len(data) > c.cfg.Snaplen {
+		data = data[:c.cfg.Snaplen]
+	}
+	size := f.size + packetHeaderSize + int64(len(data))
+	if size > c.cfg.MaxFileSize || p.ci.Timestamp.Sub(f.start) >= c.cfg.MaxDuration {
+		return false
+	}
+	ci := p.ci
+	ci.CaptureLength = len(data)
+	if err := f.w.WritePacket(ci, data); err != nil {
+		c.logger.Errorf("error writing the capture file %s: %s", f.path, err)
+		return false
+	}
+	f.size = size
+	return true
+}
+
+func (c *Capturer) closeFile(f *file) {
+	if err := f.f.Close(); err != nil {
+		c.logger.Errorf("error closing the capture file %s: %s", f.path, err)
+	}
+}
+
+// Close stops the capture and closes the files.
+func (c *Capturer) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	c.src.Close()
+	<-c.done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for _, f := range c.sessions {
+		errs = append(errs, f.f.Close())
+	}
+	for _, f := range c.files {
+		errs = append(errs, f.f.Close())
+	}
+	c.sessions, c.files = nil, nil
+	return errors.Join(errs...)
+}
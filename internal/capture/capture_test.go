@@ -0,0 +1,174 @@
+package capture
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/sirupsen/logrus"
+)
+
+var start = time.Date(2024, 5, 26, 19, 0, 0, 0, time.UTC)
+
+// testSource is a source of no packets, until it is closed.
+type testSource struct {
+	closed chan struct{}
+}
+
+func newTestSource() *testSource {
+	return &testSource{closed: make(chan struct{})}
+}
+
+func (s *testSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	<-s.closed
+	return nil, gopacket.CaptureInfo{}, io.EOF
+}
+
+func (s *testSource) LinkType() layers.LinkType { return layers.LinkTypeEthernet }
+
+func (s *testSource) Close() { close(s.closed) }
+
+// testPacket returns a packet from the source IP and port to the destination
+// IP and port.
+func testPacket(t *testing.T, src, dst string, srcPort, dstPort uint16, at time.Time) packet {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ipv4 := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst)}
+	tcp := &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: layers.TCPPort(dstPort), PSH: true, ACK: true}
+	if err := tcp.SetNetworkLayerForChecksum(ipv4); err != nil {
+		t.Fatal(err)
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ipv4, tcp, gopacket.Payload("GET / HTTP/1.1\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	return packet{data: data, ci: gopacket.CaptureInfo{Timestamp: at, CaptureLength: len(data), Length: len(data)}}
+}
+
+// countPackets returns the number of packets of the PCAP file.
+func countPackets(t *testing.T, path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for {
+		if _, _, err := r.ReadPacketData(); err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+func TestCapturePorts(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(Config{CapturePorts: []uint16{8080}, Ports: []uint16{8443}, Directory: dir, MaxDuration: time.Minute}, newTestSource(), logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.handle(testPacket(t, "192.0.2.1", "198.51.100.1", 40000, 8080, start))
+	c.handle(testPacket(t, "198.51.100.1", "192.0.2.1", 8080, 40000, start.Add(time.Second)))
+	c.handle(testPacket(t, "192.0.2.1", "198.51.100.1", 40001, 8443, start.Add(2*time.Second)))
+	c.handle(testPacket(t, "192.0.2.1", "198.51.100.1", 40000, 9999, start.Add(3*time.Second)))
+	// The file of the port is rotated after a minute.
+	c.handle(testPacket(t, "192.0.2.1", "198.51.100.1", 40000, 8080, start.Add(2*time.Minute)))
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "port-8080-*.pcap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files of the port, got %v", files)
+	}
+	if n := countPackets(t, files[0]); n != 2 {
+		t.Errorf("Expected the 2 packets of the connection to the port in the first file, got %d", n)
+	}
+	if n := countPackets(t, files[1]); n != 1 {
+		t.Errorf("Expected 1 packet in the rotated file, got %d", n)
+	}
+}
+
+func TestCaptureFlaggedSession(t *testing.T) {
+	dir := t.TempDir()
+	packetSize := int64(packetHeaderSize + len(testPacket(t, "192.0.2.1", "198.51.100.1", 40000, 8080, start).data))
+	c, err := New(Config{
+		Ports:           []uint16{8080},
+		FlaggedSessions: true,
+		Directory:       dir,
+		Buffer:          2,
+		MaxFileSize:     fileHeaderSize + 4*packetSize,
+	}, newTestSource(), logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		c.handle(testPacket(t, "192.0.2.1", "198.51.100.1", 40000, 8080, start.Add(time.Duration(i)*time.Second)))
+	}
+	c.handle(testPacket(t, "192.0.2.2", "198.51.100.1", 40000, 8080, start))
+
+	path, err := c.Flag("s1", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "session-s1.pcap"); path != want {
+		t.Errorf("Expected the session captured to %s, got %s", want, path)
+	}
+	// The file of the session is closed after 4 packets.
+	for i := 0; i < 3; i++ {
+		c.handle(testPacket(t, "198.51.100.1", "192.0.2.1", 8080, 40000, time.Now()))
+	}
+	c.handle(testPacket(t, "192.0.2.2", "198.51.100.1", 40000, 8080, time.Now()))
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countPackets(t, path); n != 4 {
+		t.Errorf("Expected the 2 buffered packets and 2 packets of the session, got %d", n)
+	}
+	if len(c.buffers) != 1 || len(c.buffers["192.0.2.2"]) != 2 {
+		t.Errorf("Expected the packets of the other source buffered, got %v", c.buffers)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "port-*")); len(files) != 0 {
+		t.Errorf("Expected no file of the ports not captured, got %v", files)
+	}
+}
+
+func TestFlagDisabled(t *testing.T) {
+	c, err := New(Config{Ports: []uint16{8080}, Directory: t.TempDir()}, newTestSource(), logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.handle(testPacket(t, "192.0.2.1", "198.51.100.1", 40000, 8080, start))
+	if path, err := c.Flag("s1", "192.0.2.1"); path != "" || err != nil {
+		t.Errorf("Expected no capture of the sessions, got %q %v", path, err)
+	}
+	if len(c.buffers) != 0 {
+		t.Errorf("Expected no buffered packets, got %v", c.buffers)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	if got, want := filter([]uint16{8080, 8443}), "tcp and (port 8080 or port 8443)"; got != want {
+		t.Errorf("Expected the filter %q, got %q", want, got)
+	}
+}
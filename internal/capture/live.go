@@ -0,0 +1,57 @@
+package capture
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/sirupsen/logrus"
+)
+
+// liveTimeout is the read timeout of the live captures, after which they
+// check whether they were closed.
+const liveTimeout = time.Second
+
+// liveSource is a live capture, reading until it is closed.
+type liveSource struct {
+	handle *pcap.Handle
+}
+
+func (s liveSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	for {
+		data, ci, err := s.handle.ReadPacketData()
+		if err != pcap.NextErrorTimeoutExpired {
+			return data, ci, err
+		}
+	}
+}
+
+func (s liveSource) LinkType() layers.LinkType {
+	return s.handle.LinkType()
+}
+
+func (s liveSource) Close() {
+	s.handle.Close()
+}
+
+// Open returns the capturer of the live traffic of the interface of the
+// configuration.
+func Open(cfg Config, logger *logrus.Logger) (*Capturer, error) {
+	cfg = cfg.withDefaults()
+	h, err := pcap.OpenLive(cfg.Interface, int32(cfg.Snaplen), false, liveTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the capture of %s: %s", cfg.Interface, err)
+	}
+	if err := h.SetBPFFilter(filter(append(cfg.Ports, cfg.CapturePorts...))); err != nil {
+		h.Close()
+		return nil, fmt.Errorf("error setting the capture filter: %s", err)
+	}
+	c, err := New(cfg, liveSource{h}, logger)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,188 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	mrand "math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/bluele/gcache"
+)
+
+const (
+	// defaultCACommonName and defaultCAOrganization are the subject of the
+	// generated CA if not configured.
+	defaultCACommonName   = "Default Company Ltd Root CA"
+	defaultCAOrganization = "Default Company Ltd"
+	// defaultServerName is the name of the generated certificate served to
+	// clients without SNI when there is no default certificate.
+	defaultServerName = "localhost"
+	// cacheSize is the number of generated certificates kept.
+	cacheSize = 1000
+	// validity is the validity period of the generated certificates.
+	validity = 398 * 24 * time.Hour
+	// maxBackdate is the maximum age of the generated certificates, so they
+	// don't all look freshly issued.
+	maxBackdate = 180 * 24 * time.Hour
+)
+
+// Generator generates certificates on the fly for the server names requested
+// by the clients, signed by a CA. The generated certificates are cached.
+type Generator struct {
+	ca       *x509.Certificate
+	caKey    crypto.Signer
+	fallback *tls.Certificate
+	certs    gcache.Cache
+}
+
+// NewGenerator returns a generator signing the certificates with the
+// configured CA. fallback, if not nil, is served to the clients without SNI.
+func NewGenerator(cc config.CAConfig, fallback *tls.Certificate) (*Generator, error) {
+	g := &Generator{fallback: fallback}
+	var err error
+	if cc.Certificate != "" || cc.Key != "" {
+		g.ca, g.caKey, err = loadCA(cc.Certificate, cc.Key)
+	} else {
+		g.ca, g.caKey, err = newCA(cc.CommonName, cc.Organization)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	g.certs = gcache.New(cacheSize).LRU().LoaderFunc(func(key interface{}) (interface{}, error) {
+		return g.generate(key.(string))
+	}).Build()
+	return g, nil
+}
+
+// GetCertificate returns the certificate for the server name of the client,
+// for use as tls.Config.GetCertificate.
+func (g *Generator) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name == "" {
+		if g.fallback != nil {
+			return g.fallback, nil
+		}
+		name = defaultServerName
+	}
+	cert, err := g.certs.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return cert.(*tls.Certificate), nil
+}
+
+// TLSConfig returns a TLS configuration serving the generated certificates.
+func (g *Generator) TLSConfig() *tls.Config {
+	return &tls.Config{GetCertificate: g.GetCertificate}
+}
+
+// generate returns a new certificate for the server name.
+func (g *Generator) generate(name string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	notBefore := time.Now().Add(-time.Duration(mrand.Int63n(int64(maxBackdate)))).Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{name}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, g.ca, key.Public(), g.caKey)
+	if err != nil {
+		return nil, fmt.Errorf("error generating the certificate for %s: %s", name, err)
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, g.ca.Raw},
+		PrivateKey:  key,
+	}, nil
+}
+
+// loadCA loads the CA certificate and key from PEM files.
+func loadCA(certFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading the CA: %s", err)
+	}
+	ca, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing the CA certificate: %s", err)
+	}
+	if !ca.IsCA {
+		return nil, nil, fmt.Errorf("the certificate of %s is not a CA", certFile)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("unsupported CA key type")
+	}
+	return ca, key, nil
+}
+
+// newCA generates a CA with the given subject, or the default one.
+func newCA(commonName, organization string) (*x509.Certificate, crypto.Signer, error) {
+	if commonName == "" {
+		commonName = defaultCACommonName
+	}
+	if organization == "" {
+		organization = defaultCAOrganization
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	notBefore := time.Now().Add(-5 * 365 * 24 * time.Hour).Truncate(24 * time.Hour)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{organization}},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(20 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating the CA: %s", err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca, key, nil
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,84 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+)
+
+func TestGetCertificate(t *testing.T) {
+	g, err := NewGenerator(config.CAConfig{Organization: "Example Inc"}, nil)
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	cert, err := g.GetCertificate(&tls.ClientHelloInfo{ServerName: "Shop.Example.com"})
+	if err != nil {
+		t.Fatalf("GetCertificate() error = %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(g.ca)
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: "shop.example.com", Roots: roots}); err != nil {
+		t.Errorf("Expected a certificate valid for shop.example.com, got %v", err)
+	}
+	if g.ca.Subject.Organization[0] != "Example Inc" || g.ca.Subject.CommonName != defaultCACommonName {
+		t.Errorf("Expected the configured CA subject, got %s", g.ca.Subject)
+	}
+
+	again, err := g.GetCertificate(&tls.ClientHelloInfo{ServerName: "shop.example.com"})
+	if err != nil || again != cert {
+		t.Errorf("Expected the cached certificate, got %v", err)
+	}
+
+	noSNI, err := g.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf, _ := x509.ParseCertificate(noSNI.Certificate[0]); leaf.Subject.CommonName != defaultServerName {
+		t.Errorf("Expected a certificate for %s without SNI, got %s", defaultServerName, leaf.Subject.CommonName)
+	}
+}
+
+func TestNewGeneratorLoadsCA(t *testing.T) {
+	ca, key, err := newCA("Test CA", "Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fallback := &tls.Certificate{}
+	g, err := NewGenerator(config.CAConfig{Certificate: certFile, Key: keyFile}, fallback)
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	if g.ca.Subject.CommonName != "Test CA" {
+		t.Errorf("Expected the loaded CA, got %s", g.ca.Subject)
+	}
+	if cert, _ := g.GetCertificate(&tls.ClientHelloInfo{}); cert != fallback {
+		t.Errorf("Expected the fallback certificate without SNI")
+	}
+
+	if _, err := NewGenerator(config.CAConfig{Certificate: certFile, Key: filepath.Join(dir, "missing.pem")}, nil); err == nil {
+		t.Errorf("Expected an error for a missing CA key")
+	}
+}
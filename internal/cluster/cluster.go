@@ -0,0 +1,187 @@
+// Package cluster shares the state of several honeypot instances in a Redis
+// server, so that a fleet behaves as one emulated application: the responses
+// to the same request are generated once, the cookie sessions started by an
+// instance are known to the others, and the budget usage is counted for all
+// the instances.
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultLockTimeout is the default time a generation lock is held, and the
+// other instances wait for its response.
+const DefaultLockTimeout = 30 * time.Second
+
+// Prefixes of the keys of the shared state in Redis.
+const (
+	lockKeyPrefix    = "galah:lock:"
+	sessionKeyPrefix = "galah:session:"
+	budgetKeyPrefix  = "galah:budget:"
+)
+
+// budgetRetention is how long the budget counters of a period are kept after
+// its start, longer than the longest period.
+const budgetRetention = 32 * 24 * time.Hour
+
+// unlockScript deletes a lock only if it's still held with the token, not
+// after it expired and was taken by another instance.
+var unlockScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Config configures a Cluster: the URL of the Redis server (see
+// cache.NewRedisStore) and the LockTimeout of the generations
+// (DefaultLockTimeout if 0).
+type Config struct {
+	RedisURL    string
+	LockTimeout time.Duration
+}
+
+// Cluster is the state shared by the honeypot instances.
+type Cluster struct {
+	redis       *redis.Client
+	node        string
+	lockTimeout time.Duration
+}
+
+// Session is the state of a cookie session shared by the instances.
+type Session struct {
+	Started  time.Time
+	Requests int
+	User     string
+}
+
+// New returns the cluster of the instances sharing the Redis server of the
+// configuration.
+func New(cfg Config) (*Cluster, error) {
+	if cfg.LockTimeout <= 0 {
+		cfg.LockTimeout = DefaultLockTimeout
+	}
+	store, err := cache.NewRedisStore(cfg.RedisURL, 0)
+	if err != nil {
+		return nil, err
+	}
+	node, err := os.Hostname()
+	if err != nil {
+		node = "galah"
+	}
+	return &Cluster{redis: store.Client(), node: node, lockTimeout: cfg.LockTimeout}, nil
+}
+
+// LockTimeout returns the time a generation lock is held at most.
+func (c *Cluster) LockTimeout() time.Duration {
+	return c.lockTimeout
+}
+
+// Lock takes the generation lock of the cache key, for the lock timeout at
+// most so that the lock of an instance that stopped expires. It returns the
+// function releasing the lock, and false if another instance holds it.
+func (c *Cluster) Lock(key string) (func(), bool, error) {
+	k := lockKeyPrefix + hashKey(key)
+	b := make([]byte, 8)
+	rand.Read(b)
+	token := c.node + "/" + hex.EncodeToString(b)
+	ok, err := c.redis.SetNX(context.Background(), k, token, c.lockTimeout).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return func() {
+		unlockScript.Run(context.Background(), c.redis, []string{k}, token)
+	}, true, nil
+}
+
+// StartSession records the new cookie session of the identifier, which
+// expires after timeout without requests.
+func (c *Cluster) StartSession(id string, started time.Time, timeout time.Duration) error {
+	k := sessionKeyPrefix + id
+	if err := c.redis.HSet(context.Background(), k, "started", started.UnixNano(), "requests", 0).Err(); err != nil {
+		return err
+	}
+	return c.expire(k, timeout)
+}
+
+// Session returns the cookie session of the identifier, and false if it is
+// unknown or has expired.
+func (c *Cluster) Session(id string) (Session, bool, error) {
+	fields, err := c.redis.HGetAll(context.Background(), sessionKeyPrefix+id).Result()
+	if err != nil || len(fields) == 0 {
+		return Session{}, false, err
+	}
+	var s Session
+	nanos, _ := strconv.ParseInt(fields["started"], 10, 64)
+	s.Started = time.Unix(0, nanos)
+	s.Requests, _ = strconv.Atoi(fields["requests"])
+	s.User = fields["user"]
+	return s, true, nil
+}
+
+// CountSessionRequest counts a request of the cookie session of the
+// identifier, whose timeout restarts.
+func (c *Cluster) CountSessionRequest(id string, timeout time.Duration) error {
+	k := sessionKeyPrefix + id
+	if err := c.redis.HIncrBy(context.Background(), k, "requests", 1).Err(); err != nil {
+		return err
+	}
+	return c.expire(k, timeout)
+}
+
+// SetSessionUser logs the cookie session of the identifier in as the user.
+func (c *Cluster) SetSessionUser(id, user string, timeout time.Duration) error {
+	k := sessionKeyPrefix + id
+	if err := c.redis.HSet(context.Background(), k, "user", user).Err(); err != nil {
+		return err
+	}
+	return c.expire(k, timeout)
+}
+
+// AddUsage adds the tokens and the estimated cost of a generation to the
+// budget period of the name ("daily" or "monthly") starting at start, and
+// returns the usage of the period by all the instances. It implements
+// llm.BudgetCounter.
+func (c *Cluster) AddUsage(period string, start time.Time, tokens int, cost float64) (int, float64, error) {
+	k := budgetKeyPrefix + period + ":" + strconv.FormatInt(start.Unix(), 10)
+	total, err := c.redis.HIncrBy(context.Background(), k, "tokens", int64(tokens)).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	// The cost is counted in integer microdollars, summed exactly.
+	micros, err := c.redis.HIncrBy(context.Background(), k, "cost", int64(cost*1e6)).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := c.expire(k, budgetRetention); err != nil {
+		return 0, 0, err
+	}
+	return int(total), float64(micros) / 1e6, nil
+}
+
+// Close closes the connections to the Redis server.
+func (c *Cluster) Close() error {
+	return c.redis.Close()
+}
+
+func (c *Cluster) expire(key string, ttl time.Duration) error {
+	if err := c.redis.PExpire(context.Background(), key, ttl).Err(); err != nil {
+		return fmt.Errorf("error setting the expiry of %s: %w", key, err)
+	}
+	return nil
+}
+
+// hashKey returns the hash of the cache key, shorter than the keys with
+// headers or bodies.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
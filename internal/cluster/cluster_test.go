@@ -0,0 +1,97 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestLock(t *testing.T) {
+	m := miniredis.RunT(t)
+	a, err := New(Config{RedisURL: "redis://" + m.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := New(Config{RedisURL: "redis://" + m.Addr(), LockTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if a.LockTimeout() != DefaultLockTimeout {
+		t.Errorf("Expected the default lock timeout, got %s", a.LockTimeout())
+	}
+
+	unlock, ok, err := a.Lock("8080_/index.php")
+	if err != nil || !ok {
+		t.Fatalf("Lock() = %v, %v, want the lock", ok, err)
+	}
+	if _, ok, _ := b.Lock("8080_/index.php"); ok {
+		t.Error("Expected the lock held by the other instance")
+	}
+	if _, ok, _ := b.Lock("8080_/admin"); !ok {
+		t.Error("Expected the lock of another key")
+	}
+
+	// The lock taken by another instance after expiring isn't released.
+	if ttl := m.TTL(lockKeyPrefix + hashKey("8080_/index.php")); ttl != DefaultLockTimeout {
+		t.Errorf("Expected the lock expiring after the lock timeout, got %s", ttl)
+	}
+	m.Set(lockKeyPrefix+hashKey("8080_/index.php"), "other")
+	unlock()
+	if _, ok, _ := b.Lock("8080_/index.php"); ok {
+		t.Error("Expected the lock of the other instance kept")
+	}
+}
+
+func TestSessions(t *testing.T) {
+	m := miniredis.RunT(t)
+	c, err := New(Config{RedisURL: "redis://" + m.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, ok, err := c.Session("unknown"); ok || err != nil {
+		t.Errorf("Session() = %v, %v, want an unknown session", ok, err)
+	}
+	started := time.Now().Truncate(time.Second)
+	if err := c.StartSession("abc", started, 30*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.CountSessionRequest("abc", 30*time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.SetSessionUser("abc", "admin", 30*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	s, ok, err := c.Session("abc")
+	if err != nil || !ok || !s.Started.Equal(started) || s.Requests != 2 || s.User != "admin" {
+		t.Errorf("Session() = %+v, %v, %v", s, ok, err)
+	}
+	if got := m.TTL(sessionKeyPrefix + "abc"); got != 30*time.Minute {
+		t.Errorf("Expected the session expiring after its timeout, got %s", got)
+	}
+}
+
+func TestAddUsage(t *testing.T) {
+	m := miniredis.RunT(t)
+	c, err := New(Config{RedisURL: "redis://" + m.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	day := time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC)
+	c.AddUsage("daily", day, 1000, 0.25)
+	tokens, cost, err := c.AddUsage("daily", day, 500, 0.5)
+	if err != nil || tokens != 1500 || cost != 0.75 {
+		t.Errorf("AddUsage() = %d, %v, %v, want 1500, 0.75", tokens, cost, err)
+	}
+	if tokens, _, _ := c.AddUsage("daily", day.AddDate(0, 0, 1), 100, 0); tokens != 100 {
+		t.Errorf("Expected the next day counted apart, got %d tokens", tokens)
+	}
+}
@@ -2,29 +2,903 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config holds the configuration file settings for the application.
 type Config struct {
-	SystemPrompt string               `yaml:"system_prompt"`
-	UserPrompt   string               `yaml:"user_prompt"`
-	Ports        []PortConfig         `yaml:"ports"`
-	Profiles     map[string]TLSConfig `yaml:"profiles"`
+	SystemPrompt       string                 `yaml:"system_prompt"`
+	UserPrompt         string                 `yaml:"user_prompt"`
+	PromptVariants     []PromptVariantConfig  `yaml:"prompt_variants"`
+	Ports              []PortConfig           `yaml:"ports"`
+	Profiles           map[string]TLSConfig   `yaml:"profiles"`
+	RequestHistory     HistoryConfig          `yaml:"request_history"`
+	Response           ResponseConfig         `yaml:"response"`
+	ErrorPolicy        ErrorPolicyConfig      `yaml:"error_policy"`
+	ServerProfile      ServerProfileConfig    `yaml:"server_profile"`
+	ExpectContinue     string                 `yaml:"expect_continue"`
+	Metadata           map[string]string      `yaml:"metadata"`
+	AuthChallenges     []AuthChallengeConfig  `yaml:"auth_challenges"`
+	Deadline           DeadlineConfig         `yaml:"deadline"`
+	ResponseLatency    LatencyProfileConfig   `yaml:"response_latency"`
+	Fallback           []LLMProviderConfig    `yaml:"llm_fallback"`
+	ModelRouting       ModelRoutingConfig     `yaml:"model_routing"`
+	Examples           []ExampleConfig        `yaml:"examples"`
+	MaxRequestTokens   int                    `yaml:"max_request_tokens"`
+	MaxRequestBodySize int                    `yaml:"max_request_body_size"`
+	PromptInjection    PromptInjectionConfig  `yaml:"prompt_injection"`
+	Classification     ClassificationConfig   `yaml:"classification"`
+	SemanticCache      SemanticCacheConfig    `yaml:"semantic_cache"`
+	CacheTTLs          []CacheTTLConfig       `yaml:"cache_ttls"`
+	CacheKey           CacheKeyConfig         `yaml:"cache_key"`
+	Consistency        ConsistencyConfig      `yaml:"consistency"`
+	AccessLists        AccessListsConfig      `yaml:"access_lists"`
+	TrustedProxies     TrustedProxiesConfig   `yaml:"trusted_proxies"`
+	Budget             BudgetConfig           `yaml:"budget"`
+	RateLimit          RateLimitConfig        `yaml:"rate_limit"`
+	Tarpit             TarpitConfig           `yaml:"tarpit"`
+	ScannerDetection   ScannerDetectionConfig `yaml:"scanner_detection"`
+	Sessions           SessionsConfig         `yaml:"sessions"`
+	CookieSessions     CookieSessionsConfig   `yaml:"cookie_sessions"`
+	Cluster            ClusterConfig          `yaml:"cluster"`
+	Uploads            UploadsConfig          `yaml:"uploads"`
+	PacketCapture      PacketCaptureConfig    `yaml:"packet_capture"`
+	Honeytokens        HoneytokensConfig      `yaml:"honeytokens"`
+	StaticRulesFile    string                 `yaml:"static_rules_file"`
+	StaticArtifacts    StaticArtifactsConfig  `yaml:"static_artifacts"`
+	Emulations         []EmulationConfig      `yaml:"emulations"`
+	VirtualHosts       []VirtualHostConfig    `yaml:"virtual_hosts"`
+	WebSocket          WebSocketConfig        `yaml:"websocket"`
+	ThreatIntel        ThreatIntelConfig      `yaml:"threat_intel"`
+	EventOutputs       EventOutputsConfig     `yaml:"event_outputs"`
+	EventLogRotation   RotationConfig         `yaml:"event_log_rotation"`
+	EventRedaction     RedactionConfig        `yaml:"event_redaction"`
+	AttackTechniques   map[string][]string    `yaml:"attack_techniques"`
+	Alerts             AlertsConfig           `yaml:"alerts"`
+	Tracing            TracingConfig          `yaml:"tracing"`
 }
 
-// TLSConfig contains TLS-related settings.
-type TLSConfig struct {
+// TracingConfig configures the OpenTelemetry traces of the requests,
+// exported to the OTLP/HTTP collector at Endpoint if set, with the Headers
+// set (e.g. for authentication). SampleRatio is the ratio of the requests
+// traced, all of them if 0.
+type TracingConfig struct {
+	Endpoint    string            `yaml:"endpoint"`
+	Headers     map[string]string `yaml:"headers"`
+	ServiceName string            `yaml:"service_name"`
+	SampleRatio float64           `yaml:"sample_ratio"`
+}
+
+// AlertsConfig configures the alerts sent to the webhooks when the events
+// match the rules, enabled if rules are set. An alert of a rule is sent at
+// most once per Throttle for a source, and at most MaxPerMinute alerts are
+// sent per minute.
+type AlertsConfig struct {
+	Webhooks     []WebhookConfig   `yaml:"webhooks"`
+	Rules        []AlertRuleConfig `yaml:"rules"`
+	Throttle     time.Duration     `yaml:"throttle"`
+	MaxPerMinute int               `yaml:"max_per_minute"`
+}
+
+// WebhookConfig configures a webhook of the alerts: slack, discord or
+// generic. The URL can be read from the environment variable named by
+// URLEnv.
+type WebhookConfig struct {
+	Type   string `yaml:"type"`
+	URL    string `yaml:"url"`
+	URLEnv string `yaml:"url_env"`
+}
+
+// AlertRuleConfig configures an alert rule, matching the first event from a
+// source country if NewCountry is true, the events with any of the Tags, and
+// the requests with a URI matching the Path regular expression. The
+// conditions set must all match.
+type AlertRuleConfig struct {
+	Name       string        `yaml:"name"`
+	NewCountry bool          `yaml:"new_country"`
+	Tags       []string      `yaml:"tags"`
+	Path       string        `yaml:"path"`
+	Throttle   time.Duration `yaml:"throttle"`
+}
+
+// RotationConfig configures the rotation of the event log, enabled if
+// MaxSizeMB or Interval is set. Only the MaxBackups most recent rotated files
+// are kept, if set, compressed with gzip if Compress is true. The rotated
+// files are uploaded to S3 if a bucket is set.
+type RotationConfig struct {
+	MaxSizeMB  int             `yaml:"max_size_mb"`
+	Interval   time.Duration   `yaml:"interval"`
+	MaxBackups int             `yaml:"max_backups"`
+	Compress   bool            `yaml:"compress"`
+	S3         S3ArchiveConfig `yaml:"s3"`
+}
+
+// RedactionConfig configures the redaction of the credentials, cookies and
+// tokens of the events before they are written to the event log and the
+// outputs. The values of the Headers and of the Fields of the queries, forms
+// and JSON bodies are replaced with Replacement ("[REDACTED]" if empty), as
+// are the matches of the Patterns, regular expressions. The default headers
+// and fields are redacted if none is set.
+type RedactionConfig struct {
+	Enabled     bool     `yaml:"enabled"`
+	Headers     []string `yaml:"headers"`
+	Fields      []string `yaml:"fields"`
+	Patterns    []string `yaml:"patterns"`
+	Replacement string   `yaml:"replacement"`
+}
+
+// S3ArchiveConfig configures the uploads of the rotated event logs to
+// S3-compatible storage, under Prefix in Bucket. Endpoint is the URL of a
+// S3-compatible service (e.g. MinIO), addressing the bucket in the path of
+// the URLs if PathStyle is true. The credentials can be read from the
+// environment variables named by AccessKeyIDEnv, SecretAccessKeyEnv and
+// SessionTokenEnv, and are otherwise loaded from the standard AWS credential
+// chain. The uploaded files are removed if DeleteAfterUpload is true.
+type S3ArchiveConfig struct {
+	Bucket             string `yaml:"bucket"`
+	Prefix             string `yaml:"prefix"`
+	Region             string `yaml:"region"`
+	Endpoint           string `yaml:"endpoint"`
+	PathStyle          bool   `yaml:"path_style"`
+	AccessKeyID        string `yaml:"access_key_id"`
+	AccessKeyIDEnv     string `yaml:"access_key_id_env"`
+	SecretAccessKey    string `yaml:"secret_access_key"`
+	SecretAccessKeyEnv string `yaml:"secret_access_key_env"`
+	SessionTokenEnv    string `yaml:"session_token_env"`
+	DeleteAfterUpload  bool   `yaml:"delete_after_upload"`
+}
+
+// EventOutputsConfig configures the outputs the events are sent to, in
+// addition to the event log file.
+type EventOutputsConfig struct {
+	Syslog        SyslogOutputConfig        `yaml:"syslog"`
+	Kafka         KafkaOutputConfig         `yaml:"kafka"`
+	Elasticsearch ElasticsearchOutputConfig `yaml:"elasticsearch"`
+	Database      DatabaseOutputConfig      `yaml:"database"`
+	GRPC          GRPCOutputConfig          `yaml:"grpc"`
+}
+
+// SyslogOutputConfig configures the syslog output of the events, enabled if
+// Address is set. Network is udp (the default), tcp or tls, and Format json
+// (the default), ecs or cef. CAFile is the PEM file of the CAs verifying the
+// certificate of the server over TLS (the system's if empty).
+type SyslogOutputConfig struct {
+	Address            string `yaml:"address"`
+	Network            string `yaml:"network"`
+	Format             string `yaml:"format"`
+	Facility           string `yaml:"facility"`
+	AppName            string `yaml:"app_name"`
+	CAFile             string `yaml:"ca_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// KafkaOutputConfig configures the Kafka output of the events, enabled if
+// Brokers is set. Acks is leader (the default), all or none, and Format json
+// (the default), ecs or cef. The events are sent in batches of up to
+// BatchSize events, at least every FlushInterval.
+type KafkaOutputConfig struct {
+	Brokers       []string      `yaml:"brokers"`
+	Topic         string        `yaml:"topic"`
+	Acks          string        `yaml:"acks"`
+	Format        string        `yaml:"format"`
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	TLS           struct {
+		Enabled            bool   `yaml:"enabled"`
+		CAFile             string `yaml:"ca_file"`
+		InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	} `yaml:"tls"`
+	// SASL is the authentication to the brokers, with the PLAIN,
+	// SCRAM-SHA-256 or SCRAM-SHA-512 mechanism. The password can be read
+	// from the environment variable named by PasswordEnv.
+	SASL struct {
+		Mechanism   string `yaml:"mechanism"`
+		Username    string `yaml:"username"`
+		Password    string `yaml:"password"`
+		PasswordEnv string `yaml:"password_env"`
+	} `yaml:"sasl"`
+}
+
+// ElasticsearchOutputConfig configures the Elasticsearch (or OpenSearch)
+// output of the events, enabled if URL is set. The events are indexed in
+// Index, suffixed by their date in IndexDateFormat (a Go time layout) if
+// set, formatted in Format: ecs (the default) or json. The index template is
+// installed on start unless SkipTemplate is true. The bulk requests of up to
+// BatchSize events, sent at least every FlushInterval, are retried up to
+// MaxRetries times when the cluster is overloaded. The API key and password
+// can be read from the environment variables named by APIKeyEnv and
+// PasswordEnv.
+type ElasticsearchOutputConfig struct {
+	URL                string        `yaml:"url"`
+	Index              string        `yaml:"index"`
+	IndexDateFormat    string        `yaml:"index_date_format"`
+	Format             string        `yaml:"format"`
+	SkipTemplate       bool          `yaml:"skip_template"`
+	BatchSize          int           `yaml:"batch_size"`
+	FlushInterval      time.Duration `yaml:"flush_interval"`
+	MaxRetries         int           `yaml:"max_retries"`
+	Username           string        `yaml:"username"`
+	Password           string        `yaml:"password"`
+	PasswordEnv        string        `yaml:"password_env"`
+	APIKey             string        `yaml:"api_key"`
+	APIKeyEnv          string        `yaml:"api_key_env"`
+	CAFile             string        `yaml:"ca_file"`
+	InsecureSkipVerify bool          `yaml:"insecure_skip_verify"`
+}
+
+// DatabaseOutputConfig configures the relational event store of the events
+// and sessions, enabled if Driver (sqlite3 or postgres) is set. The DSN is a
+// database file for SQLite and a postgres:// URL for PostgreSQL, and can be
+// read from the environment variable named by DSNEnv. The events of a source
+// belong to the same session until it is idle for SessionTimeout.
+type DatabaseOutputConfig struct {
+	Driver         string        `yaml:"driver"`
+	DSN            string        `yaml:"dsn"`
+	DSNEnv         string        `yaml:"dsn_env"`
+	SessionTimeout time.Duration `yaml:"session_timeout"`
+}
+
+// GRPCOutputConfig configures the gRPC event stream, enabled if Address is set,
+// streaming the events and the session summaries to the consumers (see the
+// eventsapi package), over TLS if Certificate and Key are set. The consumers
+// authenticate with the bearer Token, read from the environment variable
+// named by TokenEnv if set. Up to Buffer events (default 256) are buffered per
+// consumer.
+type GRPCOutputConfig struct {
+	Address     string `yaml:"address"`
+	Token       string `yaml:"token"`
+	TokenEnv    string `yaml:"token_env"`
 	Certificate string `yaml:"certificate"`
 	Key         string `yaml:"key"`
+	Buffer      int    `yaml:"buffer"`
+}
+
+// ThreatIntelConfig configures the threat intelligence feeds queried for the
+// source IP of the events. Their verdicts are cached for CacheTTL, and each
+// lookup may take up to Timeout.
+type ThreatIntelConfig struct {
+	Feeds    []ThreatFeedConfig `yaml:"feeds"`
+	CacheTTL time.Duration      `yaml:"cache_ttl"`
+	Timeout  time.Duration      `yaml:"timeout"`
+}
+
+// ThreatFeedConfig configures a threat intelligence feed: abuseipdb,
+// greynoise or misp. URL is the base URL of the MISP instance, or overrides
+// the API endpoint of the other feeds. The API key can be read from the
+// environment variable named by APIKeyEnv. MinScore is the AbuseIPDB
+// confidence score from which an IP address is malicious (50 if 0).
+type ThreatFeedConfig struct {
+	Type      string `yaml:"type"`
+	URL       string `yaml:"url"`
+	APIKey    string `yaml:"api_key"`
+	APIKeyEnv string `yaml:"api_key_env"`
+	MinScore  int    `yaml:"min_score"`
+}
+
+// StaticRulesConfig is the content of a static rules file.
+type StaticRulesConfig struct {
+	Rules []StaticRuleConfig `yaml:"rules"`
+}
+
+// StaticRuleConfig answers the matching requests with a canned response,
+// without generating it. A request matches if its method is one of Methods
+// (any if empty) and its path matches one of Paths (see cache.MatchPath) or
+// its request URI matches Regex. The header values and the body are
+// text/templates if they contain "{{", with the same data as the user prompt.
+type StaticRuleConfig struct {
+	Name       string            `yaml:"name"`
+	Methods    []string          `yaml:"methods"`
+	Paths      []string          `yaml:"paths"`
+	Regex      string            `yaml:"regex"`
+	StatusCode int               `yaml:"status_code"`
+	Headers    map[string]string `yaml:"headers"`
+	Body       string            `yaml:"body"`
+}
+
+// StaticArtifactsConfig configures the static artifacts answering the
+// ancillary requests of the pages (e.g. /favicon.ico, /robots.txt, the style
+// sheets and scripts) with the same content every time, without generating
+// them. The files of Dir are served at their path relative to it, with the
+// content type of their extension. If Placeholders is set, a built-in favicon
+// and robots.txt, and an empty asset of the type of the extension for the
+// paths with one of Extensions (the common extensions of the assets if empty),
+// are served for the paths without a file.
+type StaticArtifactsConfig struct {
+	Dir          string   `yaml:"dir"`
+	Placeholders bool     `yaml:"placeholders"`
+	Extensions   []string `yaml:"extensions"`
+}
+
+// ConsistencyConfig controls the per-source response consistency: when
+// enabled, a source requesting the same resource again within the TTL is
+// served the exact response it was served before, whatever the cache state.
+// MaxEntries bounds the number of remembered responses.
+type ConsistencyConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	TTL        time.Duration `yaml:"ttl"`
+	MaxEntries int           `yaml:"max_entries"`
+}
+
+// TrustedProxiesConfig configures the reverse proxies trusted to report the
+// IP address of their clients, the sources in CIDRs (ranges or addresses).
+// The client IP of their requests is read from the first of Headers set
+// (X-Forwarded-For, then X-Real-IP, if empty), the addresses of
+// X-Forwarded-For from the last one, skipping the trusted proxies. The access
+// lists, the rate limits, the cache, the sessions and the enrichment of the
+// events are of the client IP, and the events record the proxy in proxyIP.
+type TrustedProxiesConfig struct {
+	CIDRs   []string `yaml:"cidrs"`
+	Headers []string `yaml:"headers"`
+}
+
+// AccessListsConfig configures the allow and deny lists of the source IPs,
+// checked before any other processing of the requests. The entries are CIDR
+// ranges or addresses, each optionally followed by its RFC 3339 expiry time,
+// set in Allow and Deny or one per line in AllowFile and DenyFile, and can be
+// added at runtime with the admin API. If the allow list isn't empty, only its
+// sources are served, and the deny list takes precedence. The denied requests
+// are answered with the static response of the error policy (the default
+// Action, static) or their connection closed (drop), and are logged as events
+// only if Log is set.
+type AccessListsConfig struct {
+	Allow     []string `yaml:"allow"`
+	Deny      []string `yaml:"deny"`
+	AllowFile string   `yaml:"allow_file"`
+	DenyFile  string   `yaml:"deny_file"`
+	Action    string   `yaml:"action"`
+	Log       bool     `yaml:"log"`
+}
+
+// BudgetConfig configures the daily and monthly budgets of the LLM
+// generations, in estimated cost (USD) and tokens, counted since the start of
+// the honeypot. A zero value disables the corresponding budget. Once a budget
+// is spent, no generation is made until the next day or month, starting at
+// midnight in Timezone (UTC by default): the cached responses, even if
+// expired, and the static rules are served, with the error policy's action
+// for budget_exceeded otherwise, and an alert is sent to the webhooks.
+type BudgetConfig struct {
+	DailyCost     float64 `yaml:"daily_cost"`
+	DailyTokens   int     `yaml:"daily_tokens"`
+	MonthlyCost   float64 `yaml:"monthly_cost"`
+	MonthlyTokens int     `yaml:"monthly_tokens"`
+	Timezone      string  `yaml:"timezone"`
+}
+
+// RateLimitConfig limits the rate of the requests of each source IP answered
+// by the model or the caches, enabled if RequestsPerMinute is set, with bursts
+// of up to Burst requests. The Action taken when a source exceeds its rate is static (the
+// default: serve the response previously generated for the request, even if
+// expired, or else the static response of the error policy), delay (wait for
+// the rate up to MaxDelay, then act as static) or drop (close the connection
+// without a response). MaxSources bounds the number of tracked sources.
+type RateLimitConfig struct {
+	RequestsPerMinute float64       `yaml:"requests_per_minute"`
+	Burst             int           `yaml:"burst"`
+	Action            string        `yaml:"action"`
+	MaxDelay          time.Duration `yaml:"max_delay"`
+	MaxSources        int           `yaml:"max_sources"`
+}
+
+// TarpitConfig configures the tarpit of the sources flagged as scanners: the
+// sources with any of Tags (from the scanner enrichment, the threat
+// intelligence feeds or the request, e.g. rate_limited), or the known
+// scanners if Tags is empty. Their response bodies are sent ChunkSize bytes
+// (default 1) every Delay (default 1s), for at most MaxDuration (default 5m)
+// after which the rest is sent at once. At most MaxConnections (default 100)
+// responses are tarpitted at once, the others are sent normally.
+type TarpitConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Tags           []string      `yaml:"tags"`
+	ChunkSize      int           `yaml:"chunk_size"`
+	Delay          time.Duration `yaml:"delay"`
+	MaxDuration    time.Duration `yaml:"max_duration"`
+	MaxConnections int           `yaml:"max_connections"`
+}
+
+// ScannerDetectionConfig configures the identification of the scanners and
+// attack tools sending the requests (e.g. nuclei, sqlmap, zgrab), by the
+// built-in signatures of their headers and of the paths they probe, extended
+// with Signatures, and by their timing: the sources sending at least Burst
+// requests within Window (default 10s) are identified as automated, unless
+// Burst is 0. The later requests of a source identified are attributed to the
+// same tool for Memory (default 10m). The events are tagged scanner:<tool>
+// and, if its version is known, scanner:<tool>/<version>.
+//
+// Strategy answers the requests of the Tools identified (all of them if
+// empty): generate (the default) generates their responses as usual, cached
+// only serves them the cached responses, and static serves them the static
+// response of StatusCode (default 404), Headers and Body. The cached strategy
+// serves the static response to the requests without a cached response.
+type ScannerDetectionConfig struct {
+	Enabled    bool                     `yaml:"enabled"`
+	Signatures []ScannerSignatureConfig `yaml:"signatures"`
+	Burst      int                      `yaml:"burst"`
+	Window     time.Duration            `yaml:"window"`
+	Memory     time.Duration            `yaml:"memory"`
+	Strategy   string                   `yaml:"strategy"`
+	Tools      []string                 `yaml:"tools"`
+	StatusCode int                      `yaml:"status_code"`
+	Headers    map[string]string        `yaml:"headers"`
+	Body       string                   `yaml:"body"`
+}
+
+// ScannerSignatureConfig identifies the Tool by a regular expression of its
+// headers, matched against the "Name: value" lines, or of the request URIs
+// it probes. A capture group named version captures the version of the tool.
+type ScannerSignatureConfig struct {
+	Tool   string `yaml:"tool"`
+	Header string `yaml:"header"`
+	Path   string `yaml:"path"`
 }
 
-// PortConfig specifies honeypot port settings.
+// SessionsConfig configures the grouping of the requests into sessions, by
+// source, client fingerprint (TLS fingerprint and user agent) and inactivity
+// (Timeout, default 30m), scored from 0 to 100 by their interactivity and
+// sophistication. The sessions scoring at least Threshold (default 50) are
+// flagged for the analysts. At most MaxSessions (default 10000) are tracked.
+// The sessions are also rated by the confidence that they are hands-on-keyboard
+// activity rather than automated tooling: by the pacing of the requests, the
+// assets of the pages fetched, the cookies returned and, with JSChallenge, the
+// answers to a JavaScript challenge embedded in the HTML responses, sent to
+// JSChallengePath (default /cdn-cgi/rum) by the clients running the scripts.
+type SessionsConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	Timeout         time.Duration `yaml:"timeout"`
+	Threshold       int           `yaml:"threshold"`
+	MaxSessions     int           `yaml:"max_sessions"`
+	JSChallenge     bool          `yaml:"js_challenge"`
+	JSChallengePath string        `yaml:"js_challenge_path"`
+}
+
+// CookieSessionsConfig configures the session cookies issued as by a web
+// application, enabled if Enabled is set: the responses to the requests
+// without a valid session cookie set a new session identifier in the cookie
+// Name (PHPSESSID if empty), in the format of the framework of the name (PHP,
+// Java, ASP.NET or Django, hexadecimal otherwise). A session expires when
+// idle for Timeout (default 30m), and is logged in as the user of a login
+// form whose response redirects. At most MaxSessions (default 10000) are
+// tracked. The state of the session is described in the prompt.
+type CookieSessionsConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Name        string        `yaml:"name"`
+	Timeout     time.Duration `yaml:"timeout"`
+	MaxSessions int           `yaml:"max_sessions"`
+}
+
+// ClusterConfig configures the cluster mode, enabled if Enabled is set, in
+// which the honeypot instances sharing the Redis server at RedisURL (default
+// the cache's --cache-redis-url) behave as one: the responses are cached in
+// it (unless the cache has its own), the response to a request is generated by one instance, the others
+// waiting up to LockTimeout (default 30s) for it to be cached, and the cookie
+// sessions and the budget usage are shared.
+type ClusterConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	RedisURL    string        `yaml:"redis_url"`
+	LockTimeout time.Duration `yaml:"lock_timeout"`
+}
+
+// UploadsConfig configures the capture of the files uploaded in multipart
+// requests, stored in Directory (default uploads) named by their SHA-256
+// hash. The files larger than MaxFileSize bytes (default 10 MiB) are hashed
+// but not stored, and only the first MaxFiles (default 10) files of a request
+// are captured. The events of the requests reference the captured files.
+type UploadsConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Directory   string `yaml:"directory"`
+	MaxFileSize int64  `yaml:"max_file_size"`
+	MaxFiles    int    `yaml:"max_files"`
+}
+
+// PacketCaptureConfig configures the capture of the packets of the honeypot
+// traffic into PCAP files in Directory (default pcaps), read from Interface
+// (default the interface served on, or any). The traffic of the Ports is
+// always captured, into files rotated after MaxFileSize bytes (default 100
+// MiB) or MaxDuration (default 1h), and the traffic of the flagged sessions
+// is captured if FlaggedSessions is true, up to the same limits, with the
+// last Buffer packets (default 1000) of their sources before they were
+// flagged. The packets are truncated to Snaplen bytes (default 65535).
+type PacketCaptureConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	Interface       string        `yaml:"interface"`
+	Directory       string        `yaml:"directory"`
+	Ports           []uint16      `yaml:"ports"`
+	FlaggedSessions bool          `yaml:"flagged_sessions"`
+	Snaplen         int           `yaml:"snaplen"`
+	MaxFileSize     int64         `yaml:"max_file_size"`
+	MaxDuration     time.Duration `yaml:"max_duration"`
+	Buffer          int           `yaml:"buffer"`
+}
+
+// PromptVariantConfig is a variant of the prompts of an A/B experiment,
+// assigned to Weight percent of the sources. Its SystemPrompt or UserPrompt,
+// if set, replaces the configured one.
+type PromptVariantConfig struct {
+	Name         string `yaml:"name"`
+	Weight       int    `yaml:"weight"`
+	SystemPrompt string `yaml:"system_prompt"`
+	UserPrompt   string `yaml:"user_prompt"`
+}
+
+// HoneytokensConfig configures the canary tokens embedded in the generated
+// responses: unique URLs and tracking pixels in the HTML bodies, and fake API
+// keys in the HTML and JSON object bodies, of the Kinds (url, pixel and
+// api_key; all of them if empty). The tokens of a source and path are derived
+// from Secret, or the environment variable named by SecretEnv, and are random
+// across restarts if none is set. The tokens issued are recorded in File, if
+// set, so that their use is still detected after a restart. The URLs are
+// under PathPrefix (default /static/) of the honeypot, or of BaseURL if set.
+// At most MaxTokens (default 100000) are issued.
+type HoneytokensConfig struct {
+	Enabled    bool     `yaml:"enabled"`
+	Kinds      []string `yaml:"kinds"`
+	Secret     string   `yaml:"secret"`
+	SecretEnv  string   `yaml:"secret_env"`
+	File       string   `yaml:"file"`
+	BaseURL    string   `yaml:"base_url"`
+	PathPrefix string   `yaml:"path_prefix"`
+	MaxTokens  int      `yaml:"max_tokens"`
+}
+
+// CacheKeyConfig controls the normalization of the requests into cache keys.
+// Headers are the request headers included in the keys, and IgnoredParams the
+// query parameters left out of them (a trailing * matches any suffix). If
+// IgnoredParams is not set, common cache busters and tracking parameters are
+// ignored.
+type CacheKeyConfig struct {
+	Headers       []string `yaml:"headers"`
+	IgnoredParams []string `yaml:"ignored_params"`
+}
+
+// CacheTTLConfig overrides the cache duration of the responses to requests
+// whose path matches a path.Match pattern, where a trailing * also matches
+// subdirectories. A TTL of 0 disables caching, and
+// a negative TTL never expires.
+type CacheTTLConfig struct {
+	Path string        `yaml:"path"`
+	TTL  time.Duration `yaml:"ttl"`
+}
+
+// SemanticCacheConfig controls the reuse of the cached responses of similar
+// requests, enabled with an embedding model. Threshold is the minimum cosine
+// similarity of the requests' embeddings, and MaxEntries the maximum number of
+// indexed requests (0 for no limit).
+type SemanticCacheConfig struct {
+	Threshold  float64 `yaml:"threshold"`
+	MaxEntries int     `yaml:"max_entries"`
+}
+
+// PromptInjectionConfig controls the hardening against prompt injection in
+// requests. Delimit wraps the request in tags the model is told not to take
+// instructions from, Strip removes the injection phrases found in the
+// request, and Detect tags the events of requests containing them. With
+// Classifier, requests without known phrases are also classified by the model.
+type PromptInjectionConfig struct {
+	Delimit    bool `yaml:"delimit"`
+	Strip      bool `yaml:"strip"`
+	Detect     bool `yaml:"detect"`
+	Classifier bool `yaml:"classifier"`
+}
+
+// ClassificationConfig controls the classification of the payloads of the
+// requests, whose events are tagged with the categories of the attacks (e.g.
+// sqli, xss, path_traversal, rce) and the names of the scanners found. The
+// built-in signatures are extended with Signatures, regular expressions by
+// category. With Classifier, requests matching no signature are also
+// classified by the model.
+type ClassificationConfig struct {
+	Enabled    bool                `yaml:"enabled"`
+	Classifier bool                `yaml:"classifier"`
+	Signatures map[string][]string `yaml:"signatures"`
+}
+
+// ExampleConfig is a few-shot example of a request and the expected response,
+// included in the prompt before the actual request. Examples with a persona
+// are only used with the server profile of that name.
+type ExampleConfig struct {
+	Persona  string                `yaml:"persona"`
+	Request  string                `yaml:"request"`
+	Response ExampleResponseConfig `yaml:"response"`
+}
+
+// ExampleResponseConfig is the response of a few-shot example.
+type ExampleResponseConfig struct {
+	StatusCode int               `yaml:"status_code"`
+	Headers    map[string]string `yaml:"headers"`
+	Encoding   string            `yaml:"encoding"`
+	Body       string            `yaml:"body"`
+}
+
+// LLMProviderConfig configures a provider of the fallback chain. Settings not
+// listed here (e.g. temperature) are shared with the primary provider. The
+// API key can be read from the environment variable named by APIKeyEnv.
+type LLMProviderConfig struct {
+	Provider      string `yaml:"provider"`
+	Model         string `yaml:"model"`
+	ServerURL     string `yaml:"server_url"`
+	APIKey        string `yaml:"api_key"`
+	APIKeyEnv     string `yaml:"api_key_env"`
+	CloudProject  string `yaml:"cloud_project"`
+	CloudLocation string `yaml:"cloud_location"`
+}
+
+// DeadlineConfig controls the deadline-aware degradation. Each request must be
+// answered within RequestTimeout; if less time is left than the provider's
+// typical latency, generation is skipped and the error policy's action for
+// insufficient_deadline is taken instead.
+type DeadlineConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+}
+
+// LatencyProfileConfig configures the artificial latency of the responses,
+// so that their timing matches the emulated application rather than the
+// generation or the cache: the responses ready sooner than their latency
+// after the request are delayed until then. The latency is Base plus a random
+// duration up to Jitter, or those of the first of Paths matching the path of
+// the request, if any.
+type LatencyProfileConfig struct {
+	Base   time.Duration       `yaml:"base"`
+	Jitter time.Duration       `yaml:"jitter"`
+	Paths  []PathLatencyConfig `yaml:"paths"`
+}
+
+// PathLatencyConfig is the latency of the requests whose path matches Path
+// (see cache.MatchPath).
+type PathLatencyConfig struct {
+	Path   string        `yaml:"path"`
+	Base   time.Duration `yaml:"base"`
+	Jitter time.Duration `yaml:"jitter"`
+}
+
+// AuthChallengeConfig protects the paths starting with the given prefixes
+// with an authentication challenge. Requests without credentials for the
+// scheme are answered with a 401 and a WWW-Authenticate header.
+type AuthChallengeConfig struct {
+	Paths   []string          `yaml:"paths"`
+	Scheme  string            `yaml:"scheme"`
+	Realm   string            `yaml:"realm"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+}
+
+// ServerProfileConfig selects the technology stack of the emulated server,
+// either a built-in profile by name or custom headers and description.
+type ServerProfileConfig struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description"`
+	Headers     map[string]string `yaml:"headers"`
+}
+
+// EmulationConfig selects a vulnerable application emulation, either a
+// built-in one by name or a custom one. Paths, prompt and headers set in the
+// configuration override those of the built-in emulation, and artifacts are
+// added to its artifacts.
+type EmulationConfig struct {
+	Name        string             `yaml:"name"`
+	Description string             `yaml:"description"`
+	CVEs        []string           `yaml:"cves"`
+	Paths       []string           `yaml:"paths"`
+	Prompt      string             `yaml:"prompt"`
+	Headers     map[string]string  `yaml:"headers"`
+	Artifacts   []StaticRuleConfig `yaml:"artifacts"`
+}
+
+// ErrorPolicyConfig maps generation error kinds (e.g. rate_limited) to the
+// action taken when they occur: retry, fallback, static or fail.
+type ErrorPolicyConfig struct {
+	Actions          map[string]string    `yaml:"actions"`
+	MaxRetries       int                  `yaml:"max_retries"`
+	Backoff          BackoffConfig        `yaml:"backoff"`
+	RateLimitBackoff BackoffConfig        `yaml:"rate_limit_backoff"`
+	StaticResponse   StaticResponseConfig `yaml:"static_response"`
+}
+
+// BackoffConfig controls the exponential backoff between retries. The delay
+// starts at Initial, is multiplied by Multiplier after each retry up to Max,
+// and is randomly varied by up to Jitter (a fraction of the delay). An
+// initial delay of 0 retries immediately.
+type BackoffConfig struct {
+	Initial    time.Duration `yaml:"initial"`
+	Max        time.Duration `yaml:"max"`
+	Multiplier float64       `yaml:"multiplier"`
+	Jitter     float64       `yaml:"jitter"`
+}
+
+// StaticResponseConfig is a fixed response served instead of a generated one.
+type StaticResponseConfig struct {
+	StatusCode int               `yaml:"status_code"`
+	Headers    map[string]string `yaml:"headers"`
+	Body       string            `yaml:"body"`
+}
+
+// ResponseConfig controls the post-processing of generated responses.
+// Bodies longer than MaxBodySize bytes are truncated; if Oversized is
+// "regenerate", the model is first asked once for a shorter response. The
+// bodies not matching their Content-Type (e.g. invalid JSON) are repaired if
+// ContentMismatch is "repair", or first regenerated once with "regenerate".
+// With Stream, generated responses are sent to the client while being
+// generated, unless their bodies are checked after the generation. With
+// Candidates over 1, up to Candidates responses are generated and cached for
+// each request, and each source is consistently served one of them, chosen by
+// hashing its IP and the request. PostProcessors, if set, replace the default post-processing
+// pipeline.
+type ResponseConfig struct {
+	Stream          bool                  `yaml:"stream"`
+	Candidates      int                   `yaml:"candidates"`
+	TrimWhitespace  bool                  `yaml:"trim_whitespace"`
+	SanitizeHeaders bool                  `yaml:"sanitize_headers"`
+	JSONFormat      string                `yaml:"json_format"`
+	Variation       VariationConfig       `yaml:"variation"`
+	MaxBodySize     int                   `yaml:"max_body_size"`
+	Oversized       string                `yaml:"oversized"`
+	ContentMismatch string                `yaml:"content_mismatch"`
+	Moderation      ModerationConfig      `yaml:"moderation"`
+	PostProcessors  []PostProcessorConfig `yaml:"post_processors"`
+}
+
+// PostProcessorConfig is a stage of the post-processing pipeline of the
+// responses, run in the order of the stages: one of the built-in
+// post-processors (trim_whitespace, honeytokens, js_challenge, json_format,
+// variation, truncate, links, banner and compress) or of the registered ones,
+// named by Name and configured by Options. With Personas (e.g. "port:8080",
+// "host:example.com" or "default"), the stage only runs for the responses of
+// these personas.
+type PostProcessorConfig struct {
+	Name     string            `yaml:"name"`
+	Personas []string          `yaml:"personas"`
+	Options  map[string]string `yaml:"options"`
+}
+
+// ModerationConfig controls the moderation of the generated responses,
+// scanned for the Checks (self_identification, secrets, api_keys and
+// hostnames, all if empty): the model identifying itself, the secrets in the
+// formats of the common providers, the operator's LLM API keys and the
+// Patterns of its own keys, and the internal Hostnames. With the patch Action (the default), they are patched
+// before the responses are served and cached; with regenerate, the model is
+// first asked once for another response if it identified itself.
+type ModerationConfig struct {
+	Enabled   bool     `yaml:"enabled"`
+	Checks    []string `yaml:"checks"`
+	Patterns  []string `yaml:"patterns"`
+	Hostnames []string `yaml:"hostnames"`
+	Action    string   `yaml:"action"`
+}
+
+// VariationConfig controls the subtle per-instance variation of responses.
+// A seed of 0 picks a random seed at startup.
+type VariationConfig struct {
+	Enabled bool  `yaml:"enabled"`
+	Seed    int64 `yaml:"seed"`
+}
+
+// HistoryConfig controls the recent requests from the same session, and the
+// responses served to them, that are included in the prompt. A session is
+// identified by one of the session cookies, or by the source IP. A size of 0
+// disables the history.
+type HistoryConfig struct {
+	Size           int           `yaml:"size"`
+	TTL            time.Duration `yaml:"ttl"`
+	MaxSources     int           `yaml:"max_sources"`
+	SessionCookies []string      `yaml:"session_cookies"`
+	Excerpt        int           `yaml:"excerpt"`
+}
+
+// TLSConfig contains TLS-related settings. With Generate, a certificate is
+// generated for the server name (SNI) of each client, signed by the CA; the
+// certificate and key, if set, are served to the clients without SNI.
+type TLSConfig struct {
+	Certificate string     `yaml:"certificate"`
+	Key         string     `yaml:"key"`
+	Generate    bool       `yaml:"generate"`
+	CA          CAConfig   `yaml:"ca"`
+	ACME        ACMEConfig `yaml:"acme"`
+}
+
+// ACMEConfig obtains certificates for the domains from an ACME CA (Let's
+// Encrypt by default) with the TLS-ALPN-01 challenge, which requires the port
+// to be reachable on 443. The other server names get the generated or
+// configured certificate. The account key and the certificates are stored in
+// CacheDir.
+type ACMEConfig struct {
+	Domains      []string `yaml:"domains"`
+	Email        string   `yaml:"email"`
+	CacheDir     string   `yaml:"cache_dir"`
+	DirectoryURL string   `yaml:"directory_url"`
+}
+
+// CAConfig is the certificate authority signing the certificates generated
+// for the server names requested by the clients. It is loaded from the
+// certificate and key files, or generated at startup with the common name
+// and organization if they aren't set.
+type CAConfig struct {
+	Certificate  string `yaml:"certificate"`
+	Key          string `yaml:"key"`
+	CommonName   string `yaml:"common_name"`
+	Organization string `yaml:"organization"`
+}
+
+// PortConfig specifies honeypot port settings. HTTP/2 is offered with ALPN on
+// TLS ports unless HTTP2 is false, and accepted in cleartext (h2c, with prior
+// knowledge or an upgrade) on HTTP ports if HTTP2 is true. TLS ports also
+// offer HTTP/3 over QUIC on the same UDP port if HTTP3 is true, advertised in
+// the Alt-Svc header of the responses. With ProxyProtocol, the connections must start with a PROXY protocol (v1 or v2)
+// header, whose source address is logged instead of the load balancer's.
+//
+// A port is served on Address if set (an IPv4 or IPv6 address, or a host
+// name), else on the address of Interface (its IPv6 address if IPv6 is true)
+// or of the interface served on, else on all the addresses. A port can be
+// listed several times with distinct addresses, the listeners of a port
+// sharing its persona.
 type PortConfig struct {
-	Port       uint16 `yaml:"port"`
-	Protocol   string `yaml:"protocol"`
-	TLSProfile string `yaml:"tls_profile,omitempty"`
+	Port          uint16         `yaml:"port"`
+	Protocol      string         `yaml:"protocol"`
+	Address       string         `yaml:"address,omitempty"`
+	Interface     string         `yaml:"interface,omitempty"`
+	IPv6          bool           `yaml:"ipv6,omitempty"`
+	TLSProfile    string         `yaml:"tls_profile,omitempty"`
+	HTTP2         *bool          `yaml:"http2,omitempty"`
+	HTTP3         bool           `yaml:"http3,omitempty"`
+	ProxyProtocol bool           `yaml:"proxy_protocol,omitempty"`
+	Persona       *PersonaConfig `yaml:"persona,omitempty"`
+}
+
+// PersonaConfig is the emulated server of a port, overriding the system
+// prompt, the server profile, the model, the temperature or the response
+// latency of the other ports. Unset fields keep the global settings.
+type PersonaConfig struct {
+	SystemPrompt    string                `yaml:"system_prompt"`
+	ServerProfile   ServerProfileConfig   `yaml:"server_profile"`
+	Model           string                `yaml:"model"`
+	Temperature     *float64              `yaml:"temperature"`
+	ResponseLatency *LatencyProfileConfig `yaml:"response_latency"`
+}
+
+// ModelRoutingConfig configures the routing of the requests to the models
+// by their complexity: a request generated with the model of the first of
+// Routes it matches, or with the model of its persona if none matches.
+type ModelRoutingConfig struct {
+	Routes []ModelRouteConfig `yaml:"routes"`
+}
+
+// ModelRouteConfig is a routing rule, whose Model (of the primary provider)
+// and Temperature, if set, generate the responses to the requests matching
+// all its set conditions: one of Methods, one of Paths (patterns as in
+// cache_ttls), a body or none if Body is set, a continued session (earlier
+// requests of the client's session or session cookie) or none if Session is
+// set, a flagged session or none if Flagged is set, and any of Tags. Name is
+// recorded in the events of the requests routed.
+type ModelRouteConfig struct {
+	Name        string   `yaml:"name"`
+	Model       string   `yaml:"model"`
+	Temperature *float64 `yaml:"temperature"`
+	Methods     []string `yaml:"methods"`
+	Paths       []string `yaml:"paths"`
+	Body        *bool    `yaml:"body"`
+	Session     *bool    `yaml:"session"`
+	Flagged     *bool    `yaml:"flagged"`
+	Tags        []string `yaml:"tags"`
+}
+
+// WebSocketConfig controls the emulation of WebSocket endpoints: when
+// enabled, upgrade requests are accepted on any path and each message of the
+// client is answered with generated messages, in the context of the session.
+// A session is closed after MaxMessages messages of the client, or when it is
+// idle for IdleTimeout.
+type WebSocketConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	MaxMessages int           `yaml:"max_messages"`
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+}
+
+// VirtualHostConfig is the persona of the requests for one of Hosts, on any
+// port. A request matches by its Host header or, if no virtual host matches
+// it, by its TLS server name (SNI). A host of the form *.example.com matches
+// the subdomains of example.com.
+type VirtualHostConfig struct {
+	Hosts         []string `yaml:"hosts"`
+	PersonaConfig `yaml:",inline"`
 }
 
 // LoadConfig reads and parses the configuration file.
@@ -43,3 +917,17 @@ func LoadConfig(file string) (*Config, error) {
 
 	return config, nil
 }
+
+// LoadStaticRules loads the static rules from the given file.
+func LoadStaticRules(file string) ([]StaticRuleConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules StaticRulesConfig
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	return rules.Rules, nil
+}
@@ -0,0 +1,296 @@
+// Package eval replays a corpus of recorded HTTP requests against a prompt
+// and model configuration, offline, and scores the generated responses: the
+// validity of their JSON, the plausibility of their headers and the latency
+// of the generations, to validate the prompt changes before deployment.
+package eval
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// remoteAddr is the source address of the replayed requests.
+const remoteAddr = "192.0.2.1:49152"
+
+// Request is a recorded request of the corpus, named after its file.
+type Request struct {
+	Name string
+	Raw  []byte
+}
+
+// LoadCorpus returns the requests of the corpus at path: a file of a raw
+// HTTP request, or a directory of them, in the order of their names. The
+// fixtures recorded by NewFixture (.json files) are replayed with their
+// request.
+func LoadCorpus(path string) ([]Request, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = files[:0]
+		for _, e := range entries {
+			if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+	}
+
+	var corpus []Request
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if filepath.Ext(file) == ".json" {
+			f, err := llm.ReadFixture(file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", file, err)
+			}
+			raw = []byte(f.Request)
+		}
+		corpus = append(corpus, Request{Name: filepath.Base(file), Raw: raw})
+	}
+	return corpus, nil
+}
+
+// parse returns the HTTP request of the raw request. The lines may end with
+// LF only, and the body is everything after the header block, whatever its
+// Content-Length.
+func (req Request) parse() (*http.Request, error) {
+	raw := req.Raw
+	header, body, found := bytes.Cut(raw, []byte("\r\n\r\n"))
+	if !found {
+		header, body, _ = bytes.Cut(raw, []byte("\n\n"))
+	}
+	r, err := http.ReadRequest(bufio.NewReader(io.MultiReader(bytes.NewReader(header), strings.NewReader("\r\n\r\n"))))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.RemoteAddr = remoteAddr
+	r.RequestURI = r.URL.RequestURI()
+	return r, nil
+}
+
+// Config configures an evaluation: the prompts and the other settings of the
+// configuration file, and the model and its provider's settings.
+type Config struct {
+	Config    *config.Config
+	LLMConfig llm.Config
+	Model     llms.Model
+}
+
+// Result is the evaluation of the response to a request of the corpus. Valid
+// reports whether a valid JSON response was generated, and Error, if not,
+// why. HeaderScore is the ratio of the header checks passed (see
+// HeaderIssues), and Issues the checks failed.
+type Result struct {
+	Name        string            `json:"name"`
+	Method      string            `json:"method,omitempty"`
+	Path        string            `json:"path,omitempty"`
+	Valid       bool              `json:"valid"`
+	Error       string            `json:"error,omitempty"`
+	ErrorKind   string            `json:"errorKind,omitempty"`
+	Latency     time.Duration     `json:"latency"`
+	HeaderScore float64           `json:"headerScore"`
+	Issues      []string          `json:"issues,omitempty"`
+	Response    *llm.JSONResponse `json:"response,omitempty"`
+}
+
+// Summary sums up the results of an evaluation. The header score is the
+// mean of the valid responses', and the latencies are of all the
+// generations.
+type Summary struct {
+	Requests    int           `json:"requests"`
+	Valid       int           `json:"valid"`
+	ValidRatio  float64       `json:"validRatio"`
+	HeaderScore float64       `json:"headerScore"`
+	LatencyMean time.Duration `json:"latencyMean"`
+	LatencyP50  time.Duration `json:"latencyP50"`
+	LatencyP95  time.Duration `json:"latencyP95"`
+	LatencyMax  time.Duration `json:"latencyMax"`
+}
+
+// Report is the report of an evaluation.
+type Report struct {
+	Provider string   `json:"provider"`
+	Model    string   `json:"model"`
+	Summary  Summary  `json:"summary"`
+	Results  []Result `json:"results"`
+}
+
+// Run replays the requests of the corpus in order and returns the report of
+// their responses. It stops early, with the results so far, if ctx is done.
+func Run(ctx context.Context, cfg Config, corpus []Request) *Report {
+	report := &Report{Provider: cfg.LLMConfig.Provider, Model: cfg.LLMConfig.Model, Results: []Result{}}
+	for _, req := range corpus {
+		if ctx.Err() != nil {
+			break
+		}
+		report.Results = append(report.Results, evaluate(ctx, cfg, req))
+	}
+	report.Summary = summarize(report.Results)
+	return report
+}
+
+// evaluate generates and scores the response to the request.
+func evaluate(ctx context.Context, cfg Config, req Request) Result {
+	res := Result{Name: req.Name}
+	r, err := req.parse()
+	if err != nil {
+		res.Error = fmt.Sprintf("invalid request: %s", err)
+		return res
+	}
+	res.Method, res.Path = r.Method, r.URL.Path
+	messages, err := llm.CreateMessageContent(r.WithContext(ctx), cfg.Config, cfg.LLMConfig.Provider, nil)
+	if err != nil {
+		res.Error = fmt.Sprintf("error creating the prompt: %s", err)
+		return res
+	}
+
+	start := time.Now()
+	content, err := llm.GenerateStructured(ctx, cfg.Model, cfg.LLMConfig, messages)
+	res.Latency = time.Since(start)
+	if err != nil {
+		res.Error = err.Error()
+		res.ErrorKind = llm.ErrorKind(err)
+		return res
+	}
+	var resp llm.JSONResponse
+	if err := json.Unmarshal([]byte(content), &resp); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Valid = true
+	res.Response = &resp
+	res.HeaderScore, res.Issues = HeaderIssues(resp)
+	return res
+}
+
+// summarize returns the summary of the results.
+func summarize(results []Result) Summary {
+	s := Summary{Requests: len(results)}
+	var latencies []time.Duration
+	var total time.Duration
+	for _, res := range results {
+		if res.Latency > 0 {
+			latencies = append(latencies, res.Latency)
+			total += res.Latency
+		}
+		if res.Valid {
+			s.Valid++
+			s.HeaderScore += res.HeaderScore
+		}
+	}
+	if s.Requests > 0 {
+		s.ValidRatio = float64(s.Valid) / float64(s.Requests)
+	}
+	if s.Valid > 0 {
+		s.HeaderScore /= float64(s.Valid)
+	}
+	if n := len(latencies); n > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		s.LatencyMean = total / time.Duration(n)
+		s.LatencyP50 = latencies[(n-1)*50/100]
+		s.LatencyP95 = latencies[(n-1)*95/100]
+		s.LatencyMax = latencies[n-1]
+	}
+	return s
+}
+
+// headerName matches the valid header names (RFC 9110 tokens).
+var headerName = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// HeaderIssues checks the plausibility of the headers of the response and
+// returns the ratio of the checks passed and the issues found. The checks
+// are: the header names are valid, a Server header is present, a non-empty
+// body has a Content-Type that matches it, the Content-Length, if any,
+// matches the body, and the dates are HTTP dates.
+func HeaderIssues(resp llm.JSONResponse) (float64, []string) {
+	var issues []string
+	checks := 0
+	check := func(ok bool, format string, a ...any) {
+		checks++
+		if !ok {
+			issues = append(issues, fmt.Sprintf(format, a...))
+		}
+	}
+
+	headers := make(map[string]string, len(resp.Headers))
+	var invalid []string
+	for key, value := range resp.Headers {
+		if !headerName.MatchString(key) {
+			invalid = append(invalid, key)
+		}
+		headers[http.CanonicalHeaderKey(key)] = value
+	}
+	sort.Strings(invalid)
+	check(len(invalid) == 0, "invalid header names: %s", strings.Join(invalid, ", "))
+	check(headers["Server"] != "", "no Server header")
+
+	body, err := resp.DecodedBody()
+	if err != nil {
+		body = []byte(resp.Body)
+	}
+	if len(body) > 0 {
+		contentType := headers["Content-Type"]
+		check(contentType != "", "no Content-Type header for the body")
+		if contentType != "" {
+			check(matchesContentType(contentType, body), "body doesn't match the Content-Type %q", contentType)
+		}
+	}
+	if value, ok := headers["Content-Length"]; ok {
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		check(err == nil && n == len(body), "Content-Length %q doesn't match the body of %d bytes", value, len(body))
+	}
+	for _, name := range []string{"Date", "Last-Modified", "Expires"} {
+		if value, ok := headers[name]; ok {
+			_, err := http.ParseTime(value)
+			check(err == nil, "invalid %s %q", name, value)
+		}
+	}
+	return float64(checks-len(issues)) / float64(checks), issues
+}
+
+// matchesContentType reports whether the body is plausibly of the content
+// type: valid JSON for JSON, and markup for HTML and XML. The bodies of the
+// other textual types are accepted, and those of the binary types must be
+// sniffed as the same top-level type.
+func matchesContentType(contentType string, body []byte) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	text := bytes.TrimSpace(body)
+	switch {
+	case strings.HasSuffix(mediaType, "json"):
+		return json.Valid(text)
+	case strings.Contains(mediaType, "html"), strings.HasSuffix(mediaType, "xml"):
+		return bytes.HasPrefix(text, []byte("<"))
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "video/"):
+		sniffed := http.DetectContentType(body)
+		top, _, _ := strings.Cut(mediaType, "/")
+		return strings.HasPrefix(sniffed, top+"/")
+	}
+	return true
+}
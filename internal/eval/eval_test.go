@@ -0,0 +1,116 @@
+package eval
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// testModel returns the responses in order, and records the prompts.
+type testModel struct {
+	responses []string
+	prompts   []string
+}
+
+func (m *testModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.prompts = append(m.prompts, messages[len(messages)-1].Parts[0].(llms.TextContent).Text)
+	resp := m.responses[0]
+	m.responses = m.responses[1:]
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: resp}}}, nil
+}
+
+func (m *testModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"1-login.http": "POST /login HTTP/1.1\nHost: example.com\nContent-Type: application/x-www-form-urlencoded\n\nuser=admin&password=admin",
+		"2-env.http":   "GET /.env HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		"3-bad.http":   "not a request",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	corpus, err := LoadCorpus(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(corpus) != 3 || corpus[0].Name != "1-login.http" {
+		t.Fatalf("Expected the 3 requests in order, got %+v", corpus)
+	}
+
+	model := &testModel{responses: []string{
+		`{"headers": {"Server": "nginx", "Content-Type": "text/html", "Date": "Mon, 27 May 2024 10:00:00 GMT"}, "body": "<html>ok</html>"}`,
+		`not json`,
+	}}
+	report := Run(context.Background(), Config{
+		Config:    &config.Config{SystemPrompt: "You are a web server.", UserPrompt: "%q"},
+		LLMConfig: llm.Config{Provider: "openai", Model: "gpt-4o"},
+		Model:     model,
+	}, corpus)
+
+	if len(report.Results) != 3 {
+		t.Fatalf("Expected 3 results, got %+v", report.Results)
+	}
+	login, env, bad := report.Results[0], report.Results[1], report.Results[2]
+	if !login.Valid || login.HeaderScore != 1 || login.Method != "POST" || login.Path != "/login" {
+		t.Errorf("Expected a valid and plausible response to the login, got %+v", login)
+	}
+	if !strings.Contains(model.prompts[0], "password = admin") {
+		t.Errorf("Expected the body of the request in the prompt, got %q", model.prompts[0])
+	}
+	if env.Valid || env.ErrorKind != "invalid_json" {
+		t.Errorf("Expected an invalid JSON response to the .env request, got %+v", env)
+	}
+	if bad.Valid || !strings.HasPrefix(bad.Error, "invalid request") {
+		t.Errorf("Expected the invalid request reported, got %+v", bad)
+	}
+	if s := report.Summary; s.Requests != 3 || s.Valid != 1 || s.HeaderScore != 1 || s.LatencyMax < s.LatencyP50 {
+		t.Errorf("Unexpected summary %+v", s)
+	}
+}
+
+func TestHeaderIssues(t *testing.T) {
+	tests := []struct {
+		name   string
+		resp   llm.JSONResponse
+		score  float64
+		issues int
+	}{
+		{
+			name:  "plausible",
+			resp:  llm.JSONResponse{Headers: map[string]string{"Server": "Apache", "content-type": "application/json", "Content-Length": "11"}, Body: `{"ok":true}`},
+			score: 1,
+		},
+		{
+			name:   "implausible",
+			resp:   llm.JSONResponse{Headers: map[string]string{"HTTP/1.1": "200 OK", "Content-Type": "application/json", "Date": "yesterday"}, Body: "<html></html>"},
+			score:  1.0 / 5,
+			issues: 4,
+		},
+		{
+			name:   "noContentType",
+			resp:   llm.JSONResponse{Headers: map[string]string{"Server": "nginx"}, Body: "ok"},
+			score:  2.0 / 3,
+			issues: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, issues := HeaderIssues(tt.resp)
+			if score != tt.score || len(issues) != tt.issues {
+				t.Errorf("HeaderIssues() = %v, %q, want %v and %d issues", score, issues, tt.score, tt.issues)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+// Package eventstore stores the events and the sessions of the sources in a
+// SQLite or PostgreSQL database, and queries their history.
+package eventstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSessionTimeout is the inactivity after which the next event of a
+// source starts a new session.
+const DefaultSessionTimeout = 30 * time.Minute
+
+// Event is a stored event.
+type Event struct {
+	ID         int64     `json:"id"`
+	Time       time.Time `json:"time"`
+	SessionID  int64     `json:"sessionId"`
+	SrcIP      string    `json:"srcIP"`
+	SrcPort    string    `json:"srcPort"`
+	Port       string    `json:"port"`
+	Action     string    `json:"action"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	UserAgent  string    `json:"userAgent"`
+	StatusCode int       `json:"statusCode"`
+	Tags       []string  `json:"tags"`
+	// Data is the event as logged in the event log.
+	Data json.RawMessage `json:"data"`
+}
+
+// Session is a sequence of events of a source, without an inactivity longer
+// than the session timeout.
+type Session struct {
+	ID        int64     `json:"id"`
+	SrcIP     string    `json:"srcIP"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Events    int       `json:"events"`
+}
+
+// Filter selects the events or sessions of the queries. The zero values
+// select everything, and Limit defaults to 100.
+type Filter struct {
+	SrcIP     string
+	SessionID int64
+	// PathPrefix selects the events of the request URIs with the prefix.
+	PathPrefix string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+}
+
+// Count is the number of events of a source IP or request path.
+type Count struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Store is an event store.
+type Store struct {
+	db             *sql.DB
+	postgres       bool
+	sessionTimeout time.Duration
+	// mu serializes the inserts, which update the sessions.
+	mu sync.Mutex
+}
+
+var schema = map[bool]string{
+	false: `
+CREATE TABLE IF NOT EXISTS sessions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	src_ip TEXT NOT NULL,
+	first_seen TIMESTAMP NOT NULL,
+	last_seen TIMESTAMP NOT NULL,
+	events INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS sessions_src_ip ON sessions (src_ip, last_seen);
+CREATE TABLE IF NOT EXISTS events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	event_time TIMESTAMP NOT NULL,
+	session_id INTEGER REFERENCES sessions (id),
+	src_ip TEXT NOT NULL,
+	src_port TEXT,
+	port TEXT,
+	action TEXT,
+	method TEXT,
+	uri TEXT,
+	user_agent TEXT,
+	status_code INTEGER,
+	tags TEXT,
+	data TEXT
+);
+CREATE INDEX IF NOT EXISTS events_time ON events (event_time);
+CREATE INDEX IF NOT EXISTS events_src_ip ON events (src_ip, event_time);
+CREATE INDEX IF NOT EXISTS events_session ON events (session_id);`,
+	true: `
+CREATE TABLE IF NOT EXISTS sessions (
+	id BIGSERIAL PRIMARY KEY,
+	src_ip TEXT NOT NULL,
+	first_seen TIMESTAMPTZ NOT NULL,
+	last_seen TIMESTAMPTZ NOT NULL,
+	events INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS sessions_src_ip ON sessions (src_ip, last_seen);
+CREATE TABLE IF NOT EXISTS events (
+	id BIGSERIAL PRIMARY KEY,
+	event_time TIMESTAMPTZ NOT NULL,
+	session_id BIGINT REFERENCES sessions (id),
+	src_ip TEXT NOT NULL,
+	src_port TEXT,
+	port TEXT,
+	action TEXT,
+	method TEXT,
+	uri TEXT,
+	user_agent TEXT,
+	status_code INTEGER,
+	tags TEXT,
+	data JSONB
+);
+CREATE INDEX IF NOT EXISTS events_time ON events (event_time);
+CREATE INDEX IF NOT EXISTS events_src_ip ON events (src_ip, event_time);
+CREATE INDEX IF NOT EXISTS events_session ON events (session_id);`,
+}
+
+// Open opens the event store in the database of the driver, sqlite3 (with
+// the path of the database file as data source name) or postgres (with the
+// pgx driver, registered as "pgx"), creating its tables if needed. The events of a source separated by more than the
+// session timeout are in different sessions (DefaultSessionTimeout if 0).
+func Open(driver, dsn string, sessionTimeout time.Duration) (*Store, error) {
+	switch driver {
+	case "sqlite", "sqlite3":
+		driver = "sqlite3"
+	case "postgres", "postgresql":
+		driver = "pgx"
+	default:
+		return nil, fmt.Errorf("unsupported event store driver %q (sqlite3 or postgres)", driver)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if sessionTimeout <= 0 {
+		sessionTimeout = DefaultSessionTimeout
+	}
+	s := &Store{db: db, postgres: driver == "pgx", sessionTimeout: sessionTimeout}
+	if _, err := db.Exec(schema[s.postgres]); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating the event store tables: %s", err)
+	}
+	return s, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// rebind replaces the ? placeholders of the query by the $N placeholders of
+// PostgreSQL.
+func (s *Store) rebind(query string) string {
+	if !s.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// Insert stores the event in the current session of its source, or in a new
+// session, and sets its ID and session ID.
+func (s *Store) Insert(ctx context.Context, e *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	t := e.Time.UTC()
+	var lastSeen time.Time
+	err = tx.QueryRowContext(ctx, s.rebind("SELECT id, last_seen FROM sessions WHERE src_ip = ? ORDER BY last_seen DESC LIMIT 1"), e.SrcIP).
+		Scan(&e.SessionID, &lastSeen)
+	switch {
+	case err == nil && t.Sub(lastSeen) <= s.sessionTimeout:
+		_, err = tx.ExecContext(ctx, s.rebind("UPDATE sessions SET last_seen = ?, events = events + 1 WHERE id = ?"), maxTime(t, lastSeen), e.SessionID)
+	case err == nil || err == sql.ErrNoRows:
+		err = tx.QueryRowContext(ctx, s.rebind("INSERT INTO sessions (src_ip, first_seen, last_seen, events) VALUES (?, ?, ?, 1) RETURNING id"), e.SrcIP, t, t).
+			Scan(&e.SessionID)
+	}
+	if err != nil {
+		return err
+	}
+
+	data := string(e.Data)
+	if data == "" {
+		data = "{}"
+	}
+	err = tx.QueryRowContext(ctx, s.rebind(`INSERT INTO events (event_time, session_id, src_ip, src_port, port, action, method, uri, user_agent, status_code, tags, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		t, e.SessionID, e.SrcIP, e.SrcPort, e.Port, e.Action, e.Method, e.URI, e.UserAgent, e.StatusCode, strings.Join(e.Tags, ","), data).
+		Scan(&e.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// where returns the conditions and arguments of the filter.
+func (f Filter) where(timeColumn string, events bool) (string, []any) {
+	var conds []string
+	var args []any
+	if f.SrcIP != "" {
+		conds, args = append(conds, "src_ip = ?"), append(args, f.SrcIP)
+	}
+	if !f.Since.IsZero() {
+		conds, args = append(conds, timeColumn+" >= ?"), append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		conds, args = append(conds, timeColumn+" < ?"), append(args, f.Until.UTC())
+	}
+	if events && f.SessionID != 0 {
+		conds, args = append(conds, "session_id = ?"), append(args, f.SessionID)
+	}
+	if events && f.PathPrefix != "" {
+		conds, args = append(conds, "substr(uri, 1, ?) = ?"), append(args, len(f.PathPrefix), f.PathPrefix)
+	}
+	if !events && f.SessionID != 0 {
+		conds, args = append(conds, "id = ?"), append(args, f.SessionID)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+func (f Filter) limit() int {
+	if f.Limit <= 0 {
+		return 100
+	}
+	return f.Limit
+}
+
+// Events returns the events of the filter, most recent first.
+func (s *Store) Events(ctx context.Context, f Filter) ([]Event, error) {
+	where, args := f.where("event_time", true)
+	query := `SELECT id, event_time, session_id, src_ip, src_port, port, action, method, uri, user_agent, status_code, tags, data
+		FROM events` + where + " ORDER BY event_time DESC, id DESC LIMIT ?"
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), append(args, f.limit())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		var srcPort, port, action, method, uri, userAgent, tags, data sql.NullString
+		var sessionID sql.NullInt64
+		var statusCode sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.Time, &sessionID, &e.SrcIP, &srcPort, &port, &action, &method, &uri, &userAgent, &statusCode, &tags, &data); err != nil {
+			return nil, err
+		}
+		e.SessionID, e.StatusCode = sessionID.Int64, int(statusCode.Int64)
+		e.SrcPort, e.Port, e.Action, e.Method = srcPort.String, port.String, action.String, method.String
+		e.URI, e.UserAgent = uri.String, userAgent.String
+		if tags.String != "" {
+			e.Tags = strings.Split(tags.String, ",")
+		}
+		if data.Valid {
+			e.Data = json.RawMessage(data.String)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// Sessions returns the sessions of the filter, most recently active first.
+// The filter's PathPrefix is ignored.
+func (s *Store) Sessions(ctx context.Context, f Filter) ([]Session, error) {
+	where, args := f.where("last_seen", false)
+	query := "SELECT id, src_ip, first_seen, last_seen, events FROM sessions" + where + " ORDER BY last_seen DESC, id DESC LIMIT ?"
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), append(args, f.limit())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.ID, &session.SrcIP, &session.FirstSeen, &session.LastSeen, &session.Events); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// TopSources returns the source IPs with the most events of the filter.
+func (s *Store) TopSources(ctx context.Context, f Filter) ([]Count, error) {
+	return s.top(ctx, "src_ip", f)
+}
+
+// TopPaths returns the request paths, without the query, with the most
+// events of the filter.
+func (s *Store) TopPaths(ctx context.Context, f Filter) ([]Count, error) {
+	path := "CASE WHEN instr(uri, '?') > 0 THEN substr(uri, 1, instr(uri, '?') - 1) ELSE uri END"
+	if s.postgres {
+		path = "split_part(uri, '?', 1)"
+	}
+	return s.top(ctx, path, f)
+}
+
+func (s *Store) top(ctx context.Context, column string, f Filter) ([]Count, error) {
+	where, args := f.where("event_time", true)
+	query := "SELECT " + column + " AS value, COUNT(*) AS n FROM events" + where + " GROUP BY value ORDER BY n DESC, value LIMIT ?"
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), append(args, f.limit())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []Count
+	for rows.Next() {
+		var c Count
+		var value sql.NullString
+		if err := rows.Scan(&value, &c.Count); err != nil {
+			return nil, err
+		}
+		c.Value = value.String
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,88 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestStore(t *testing.T) {
+	s, err := Open("sqlite3", filepath.Join(t.TempDir(), "events.db"), 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	start := time.Date(2024, 5, 26, 19, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Time: start, SrcIP: "192.0.2.1", Method: "GET", URI: "/wp-login.php", StatusCode: 200, Tags: []string{"scanner"}, Data: json.RawMessage(`{"srcIP":"192.0.2.1"}`)},
+		{Time: start.Add(5 * time.Minute), SrcIP: "192.0.2.1", Method: "GET", URI: "/wp-login.php?redirect_to=%2F", StatusCode: 200},
+		{Time: start.Add(6 * time.Minute), SrcIP: "192.0.2.2", Method: "POST", URI: "/api/login", StatusCode: 401},
+		// After the session timeout of the first source.
+		{Time: start.Add(time.Hour), SrcIP: "192.0.2.1", Method: "GET", URI: "/.env", StatusCode: 404},
+	}
+	for i := range events {
+		if err := s.Insert(ctx, &events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if events[0].SessionID != events[1].SessionID || events[3].SessionID == events[0].SessionID || events[2].SessionID == events[0].SessionID {
+		t.Errorf("Unexpected sessions: %d, %d, %d, %d", events[0].SessionID, events[1].SessionID, events[2].SessionID, events[3].SessionID)
+	}
+
+	got, err := s.Events(ctx, Filter{SrcIP: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].URI != "/.env" || got[2].URI != "/wp-login.php" {
+		t.Fatalf("Unexpected events of the source: %+v", got)
+	}
+	if !got[2].Time.Equal(start) || len(got[2].Tags) != 1 || string(got[2].Data) != `{"srcIP":"192.0.2.1"}` {
+		t.Errorf("Unexpected stored event: %+v", got[2])
+	}
+	if got, _ := s.Events(ctx, Filter{PathPrefix: "/wp-", Since: start.Add(time.Minute)}); len(got) != 1 {
+		t.Errorf("Expected 1 event of the path prefix since the time, got %d", len(got))
+	}
+	if got, _ := s.Events(ctx, Filter{SessionID: events[0].SessionID, Limit: 1}); len(got) != 1 || got[0].ID != events[1].ID {
+		t.Errorf("Expected the last event of the session, got %+v", got)
+	}
+
+	sessions, err := s.Sessions(ctx, Filter{SrcIP: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[1].Events != 2 || !sessions[1].LastSeen.Equal(start.Add(5*time.Minute)) {
+		t.Errorf("Unexpected sessions: %+v", sessions)
+	}
+
+	paths, err := s.TopPaths(ctx, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 3 || paths[0] != (Count{Value: "/wp-login.php", Count: 2}) {
+		t.Errorf("Unexpected top paths: %+v", paths)
+	}
+	sources, err := s.TopSources(ctx, Filter{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 1 || sources[0] != (Count{Value: "192.0.2.1", Count: 3}) {
+		t.Errorf("Unexpected top sources: %+v", sources)
+	}
+
+	if _, err := Open("mysql", "", 0); err == nil {
+		t.Error("Expected an error for an unsupported driver")
+	}
+}
+
+func TestRebind(t *testing.T) {
+	s := &Store{postgres: true}
+	if got, want := s.rebind("SELECT * FROM events WHERE src_ip = ? AND id = ?"), "SELECT * FROM events WHERE src_ip = $1 AND id = $2"; got != want {
+		t.Errorf("rebind() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+// Package finetune exports the cached request and response pairs as chat
+// format training data (JSON lines of system, user and assistant messages),
+// to fine-tune a model on the responses generated for the honeypot.
+package finetune
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// variantHeader and candidateHeader are the lines of the cache keys of the
+// responses of a prompt variant and of a response candidate, which aren't
+// headers of the request.
+const (
+	variantHeader   = "Prompt-Variant"
+	candidateHeader = "Response-Candidate"
+)
+
+// Config configures the export. The prompts of the examples are built from
+// Config for the Provider, the same as the honeypot's prompts. Only the
+// cached responses matching Filter, and not longer than MaxResponseSize
+// bytes if set, are exported.
+type Config struct {
+	Config          *config.Config
+	Provider        string
+	Filter          cache.Filter
+	MaxResponseSize int
+}
+
+// Example is a training example: the messages of a generation, the last one
+// being the response of the assistant.
+type Example struct {
+	Messages []Message `json:"messages"`
+}
+
+// Message is a message of an example.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Stats are the numbers of cached responses exported, and skipped as
+// invalid, too large or duplicates of the prompt of another example.
+type Stats struct {
+	Exported   int `json:"exported"`
+	Invalid    int `json:"invalid"`
+	TooLarge   int `json:"tooLarge"`
+	Duplicates int `json:"duplicates"`
+}
+
+// Export writes the examples of the cached responses of the store to w, one
+// JSON object per line, most recently cached first. The responses that
+// aren't valid JSON responses are skipped, and of the responses to the same
+// prompt, only the most recent one is exported.
+func Export(store cache.Store, w io.Writer, cfg Config) (Stats, error) {
+	var stats Stats
+	entries, err := cache.List(store, cfg.Filter)
+	if err != nil {
+		return stats, err
+	}
+
+	enc := json.NewEncoder(w)
+	seen := make(map[[sha256.Size]byte]bool)
+	for _, e := range entries {
+		resp, _, err := store.Get(e.Key)
+		if err != nil {
+			return stats, fmt.Errorf("error reading the cached response %q: %s", e.Key, err)
+		}
+		var compact bytes.Buffer
+		if llm.ValidateJSON(string(resp)) != nil || json.Compact(&compact, resp) != nil {
+			stats.Invalid++
+			continue
+		}
+		if cfg.MaxResponseSize > 0 && compact.Len() > cfg.MaxResponseSize {
+			stats.TooLarge++
+			continue
+		}
+
+		messages, err := prompt(e, cfg)
+		if err != nil {
+			stats.Invalid++
+			continue
+		}
+		h := sha256.New()
+		for _, m := range messages {
+			fmt.Fprintf(h, "%s\x00%s\x00", m.Role, m.Content)
+		}
+		var sum [sha256.Size]byte
+		h.Sum(sum[:0])
+		if seen[sum] {
+			stats.Duplicates++
+			continue
+		}
+		seen[sum] = true
+
+		example := Example{Messages: append(messages, Message{Role: "assistant", Content: compact.String()})}
+		if err := enc.Encode(example); err != nil {
+			return stats, err
+		}
+		stats.Exported++
+	}
+	return stats, nil
+}
+
+// prompt returns the messages of the prompt of the request of the entry.
+func prompt(e cache.Entry, cfg Config) ([]Message, error) {
+	r, err := cache.KeyRequest(e)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Del(variantHeader)
+	r.Header.Del(candidateHeader)
+	content, err := llm.CreateMessageContent(r, cfg.Config, cfg.Provider, nil)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]Message, 0, len(content)+1)
+	for _, m := range content {
+		var text string
+		for _, part := range m.Parts {
+			if t, ok := part.(llms.TextContent); ok {
+				text += t.Text
+			}
+		}
+		messages = append(messages, Message{Role: role(m.Role), Content: text})
+	}
+	return messages, nil
+}
+
+// role returns the chat format role of the message type.
+func role(t llms.ChatMessageType) string {
+	switch t {
+	case llms.ChatMessageTypeSystem:
+		return "system"
+	case llms.ChatMessageTypeAI:
+		return "assistant"
+	default:
+		return "user"
+	}
+}
@@ -0,0 +1,66 @@
+package finetune
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestExport(t *testing.T) {
+	store, err := cache.InitializeCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	set := func(port, target, resp string) {
+		r := httptest.NewRequest("GET", target, nil)
+		r.Host = "shop.example.com"
+		if err := store.Set(cache.Entry{Key: cache.GetCacheKey(r, port), Host: r.Host}, []byte(resp)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set("8080", "/admin", `{"headers": {"Server": "nginx"}, "body": "old"}`)
+	set("8443", "/admin", `{"headers": {"Server": "nginx"}, "body": "new"}`)
+	set("8080", "/broken", `{"body": "no headers"}`)
+	set("8080", "/large", `{"headers": {"Server": "nginx"}, "body": "`+strings.Repeat("a", 200)+`"}`)
+
+	var out bytes.Buffer
+	stats, err := Export(store, &out, Config{
+		Config:          &config.Config{SystemPrompt: "You are a web server.", UserPrompt: "%q"},
+		Provider:        "openai",
+		MaxResponseSize: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{Exported: 1, Invalid: 1, TooLarge: 1, Duplicates: 1}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	var example Example
+	if err := json.Unmarshal(out.Bytes(), &example); err != nil {
+		t.Fatal(err)
+	}
+	if len(example.Messages) != 3 {
+		t.Fatalf("Expected the system, user and assistant messages, got %+v", example.Messages)
+	}
+	system, user, assistant := example.Messages[0], example.Messages[1], example.Messages[2]
+	if system.Role != "system" || system.Content != "You are a web server." {
+		t.Errorf("Unexpected system message %+v", system)
+	}
+	if user.Role != "user" || !strings.Contains(user.Content, "GET /admin HTTP/1.1") || !strings.Contains(user.Content, "shop.example.com") {
+		t.Errorf("Expected the request in the user message, got %+v", user)
+	}
+	if assistant.Role != "assistant" || assistant.Content != `{"headers":{"Server":"nginx"},"body":"new"}` {
+		t.Errorf("Expected the most recent response, compacted, got %+v", assistant)
+	}
+}
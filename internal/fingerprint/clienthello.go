@@ -0,0 +1,200 @@
+package fingerprint
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	recordTypeHandshake      = 0x16
+	handshakeTypeClientHello = 0x01
+
+	extensionServerName          = 0x0000
+	extensionSupportedGroups     = 0x000a
+	extensionPointFormats        = 0x000b
+	extensionSignatureAlgorithms = 0x000d
+	extensionALPN                = 0x0010
+	extensionSupportedVersions   = 0x002b
+)
+
+// maxClientHelloSize is the maximum size of the records carrying a
+// ClientHello, beyond which it isn't captured.
+const maxClientHelloSize = 64 * 1024
+
+var (
+	errIncomplete     = errors.New("incomplete ClientHello")
+	errNotClientHello = errors.New("not a TLS ClientHello")
+)
+
+// ClientHello contains the fields of a TLS ClientHello used by the
+// fingerprints, in the order sent by the client.
+type ClientHello struct {
+	Version             uint16
+	CipherSuites        []uint16
+	Extensions          []uint16
+	SupportedGroups     []uint16
+	PointFormats        []uint8
+	SignatureAlgorithms []uint16
+	SupportedVersions   []uint16
+	ALPN                []string
+	ServerName          string
+}
+
+// readClientHello returns the ClientHello message carried by the handshake
+// records at the start of data, or errIncomplete if more data is needed.
+func readClientHello(data []byte) ([]byte, error) {
+	var message []byte
+	for {
+		if len(data) < 5 {
+			return nil, errIncomplete
+		}
+		if data[0] != recordTypeHandshake {
+			return nil, errNotClientHello
+		}
+		n := int(binary.BigEndian.Uint16(data[3:5]))
+		if len(data) < 5+n {
+			return nil, errIncomplete
+		}
+		message = append(message, data[5:5+n]...)
+		data = data[5+n:]
+
+		if len(message) >= 4 {
+			if message[0] != handshakeTypeClientHello {
+				return nil, errNotClientHello
+			}
+			size := 4 + (int(message[1])<<16 | int(message[2])<<8 | int(message[3]))
+			if len(message) >= size {
+				return message[4:size], nil
+			}
+		}
+	}
+}
+
+// ParseClientHello parses the body of a ClientHello handshake message.
+func ParseClientHello(body []byte) (*ClientHello, error) {
+	r := reader(body)
+	ch := &ClientHello{}
+	var random, sessionID, ciphers, compression, extensions reader
+	if !r.uint16(&ch.Version) || !r.bytes(32, &random) || !r.prefixed8(&sessionID) ||
+		!r.prefixed16(&ciphers) || !r.prefixed8(&compression) {
+		return nil, errNotClientHello
+	}
+	for len(ciphers) > 0 {
+		var c uint16
+		if !ciphers.uint16(&c) {
+			return nil, errNotClientHello
+		}
+		ch.CipherSuites = append(ch.CipherSuites, c)
+	}
+	// The extensions are optional.
+	if len(r) == 0 {
+		return ch, nil
+	}
+	if !r.prefixed16(&extensions) {
+		return nil, errNotClientHello
+	}
+
+	for len(extensions) > 0 {
+		var typ uint16
+		var data reader
+		if !extensions.uint16(&typ) || !extensions.prefixed16(&data) {
+			return nil, errNotClientHello
+		}
+		ch.Extensions = append(ch.Extensions, typ)
+		if !ch.parseExtension(typ, data) {
+			return nil, errNotClientHello
+		}
+	}
+	return ch, nil
+}
+
+func (ch *ClientHello) parseExtension(typ uint16, data reader) bool {
+	var list reader
+	switch typ {
+	case extensionServerName:
+		if !data.prefixed16(&list) {
+			return false
+		}
+		for len(list) > 0 {
+			var nameType uint8
+			var name reader
+			if !list.uint8(&nameType) || !list.prefixed16(&name) {
+				return false
+			}
+			if nameType == 0 {
+				ch.ServerName = string(name)
+			}
+		}
+	case extensionSupportedGroups:
+		return data.prefixed16(&list) && list.uint16s(&ch.SupportedGroups)
+	case extensionPointFormats:
+		if !data.prefixed8(&list) {
+			return false
+		}
+		ch.PointFormats = append([]uint8{}, list...)
+	case extensionSignatureAlgorithms:
+		return data.prefixed16(&list) && list.uint16s(&ch.SignatureAlgorithms)
+	case extensionALPN:
+		if !data.prefixed16(&list) {
+			return false
+		}
+		for len(list) > 0 {
+			var protocol reader
+			if !list.prefixed8(&protocol) {
+				return false
+			}
+			ch.ALPN = append(ch.ALPN, string(protocol))
+		}
+	case extensionSupportedVersions:
+		return data.prefixed8(&list) && list.uint16s(&ch.SupportedVersions)
+	}
+	return true
+}
+
+// reader reads the fields of a TLS message.
+type reader []byte
+
+func (r *reader) bytes(n int, out *reader) bool {
+	if len(*r) < n {
+		return false
+	}
+	*out, *r = (*r)[:n], (*r)[n:]
+	return true
+}
+
+func (r *reader) uint8(out *uint8) bool {
+	if len(*r) < 1 {
+		return false
+	}
+	*out, *r = (*r)[0], (*r)[1:]
+	return true
+}
+
+func (r *reader) uint16(out *uint16) bool {
+	if len(*r) < 2 {
+		return false
+	}
+	*out, *r = binary.BigEndian.Uint16(*r), (*r)[2:]
+	return true
+}
+
+func (r *reader) uint16s(out *[]uint16) bool {
+	for len(*r) > 0 {
+		var v uint16
+		if !r.uint16(&v) {
+			return false
+		}
+		*out = append(*out, v)
+	}
+	return true
+}
+
+func (r *reader) prefixed8(out *reader) bool {
+	var n uint8
+	return r.uint8(&n) && r.bytes(int(n), out)
+}
+
+func (r *reader) prefixed16(out *reader) bool {
+	var n uint16
+	return r.uint16(&n) && r.bytes(int(n), out)
+}
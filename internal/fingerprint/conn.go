@@ -0,0 +1,120 @@
+package fingerprint
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+)
+
+type connKey struct{}
+
+// Listener records the TLS ClientHello sent at the start of the connections
+// it accepts or, for cleartext HTTP, the order of the headers of their
+// requests, to fingerprint the clients. The connections are otherwise
+// unchanged.
+type Listener struct {
+	net.Listener
+	// TLS is true if the connections start with a TLS handshake.
+	TLS bool
+}
+
+// NewListener returns a listener recording the ClientHello (if tls is true)
+// or the header order of the connections accepted by inner.
+func NewListener(inner net.Listener, tls bool) *Listener {
+	return &Listener{Listener: inner, TLS: tls}
+}
+
+// Accept waits for and returns the next connection.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if l.TLS {
+		return &Conn{Conn: c}, nil
+	}
+	return &Conn{Conn: c, done: true, headers: &headerRecorder{}}, nil
+}
+
+// Conn is a connection recording the ClientHello or the header order of the
+// requests read from it.
+type Conn struct {
+	net.Conn
+
+	mu      sync.Mutex
+	done    bool
+	data    []byte
+	tls     *TLS
+	headers *headerRecorder
+}
+
+// Read reads data from the connection, recording it until the ClientHello
+// is complete, or the header names of the requests.
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.headers != nil {
+		c.headers.write(b[:n])
+	}
+	if c.done {
+		return n, err
+	}
+
+	c.data = append(c.data, b[:n]...)
+	body, parseErr := readClientHello(c.data)
+	switch {
+	case parseErr == nil:
+		if ch, err := ParseClientHello(body); err == nil {
+			c.tls = NewTLS(ch)
+		}
+		c.done = true
+	case parseErr != errIncomplete || err != nil || len(c.data) > maxClientHelloSize:
+		c.done = true
+	}
+	if c.done {
+		c.data = nil
+	}
+	return n, err
+}
+
+// TLS returns the fingerprints of the ClientHello of the connection, or nil
+// if it hasn't been received or isn't valid.
+func (c *Conn) TLS() *TLS {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tls
+}
+
+// nextHeaderOrder returns the header names, in order, of the oldest request
+// of the connection not returned yet, or nil if they weren't recorded.
+func (c *Conn) nextHeaderOrder() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.headers == nil {
+		return nil
+	}
+	return c.headers.next()
+}
+
+// WithConn returns a copy of ctx carrying the connection, if it is (or wraps,
+// for TLS connections) a Conn, for use as http.Server.ConnContext.
+func WithConn(ctx context.Context, c net.Conn) context.Context {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	if fc, ok := c.(*Conn); ok {
+		return context.WithValue(ctx, connKey{}, fc)
+	}
+	return ctx
+}
+
+// TLSFrom returns the TLS fingerprints of the connection carried by ctx, or
+// nil if there are none.
+func TLSFrom(ctx context.Context) *TLS {
+	if c, ok := ctx.Value(connKey{}).(*Conn); ok {
+		return c.TLS()
+	}
+	return nil
+}
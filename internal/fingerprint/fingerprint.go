@@ -0,0 +1,166 @@
+package fingerprint
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TLS contains the fingerprints of the ClientHello of a TLS client.
+type TLS struct {
+	JA3     string `json:"ja3"`
+	JA3Hash string `json:"ja3Hash"`
+	JA4     string `json:"ja4"`
+}
+
+// NewTLS returns the fingerprints of the ClientHello.
+func NewTLS(ch *ClientHello) *TLS {
+	ja3 := JA3(ch)
+	hash := md5.Sum([]byte(ja3))
+	return &TLS{
+		JA3:     ja3,
+		JA3Hash: hex.EncodeToString(hash[:]),
+		JA4:     JA4(ch),
+	}
+}
+
+// JA3 returns the JA3 string of the ClientHello:
+// SSLVersion,Ciphers,Extensions,EllipticCurves,EllipticCurvePointFormats.
+// The GREASE values are ignored.
+func JA3(ch *ClientHello) string {
+	formats := make([]uint16, len(ch.PointFormats))
+	for i, f := range ch.PointFormats {
+		formats[i] = uint16(f)
+	}
+	return strings.Join([]string{
+		strconv.Itoa(int(ch.Version)),
+		joinDecimal(ch.CipherSuites),
+		joinDecimal(ch.Extensions),
+		joinDecimal(ch.SupportedGroups),
+		joinDecimal(formats),
+	}, ",")
+}
+
+// JA4 returns the JA4 fingerprint of the ClientHello, received over TCP.
+func JA4(ch *ClientHello) string {
+	ciphers := withoutGREASE(ch.CipherSuites)
+	extensions := withoutGREASE(ch.Extensions)
+
+	sni := "i"
+	if ch.ServerName != "" {
+		sni = "d"
+	}
+	a := fmt.Sprintf("t%s%s%02d%02d%s", ja4Version(ch), sni, min(len(ciphers), 99), min(len(extensions), 99), ja4ALPN(ch.ALPN))
+
+	// The server name and ALPN extensions are only counted.
+	var hashed []uint16
+	for _, e := range extensions {
+		if e != extensionServerName && e != extensionALPN {
+			hashed = append(hashed, e)
+		}
+	}
+	c := joinHex(sorted(hashed))
+	if algorithms := withoutGREASE(ch.SignatureAlgorithms); len(algorithms) > 0 {
+		c += "_" + joinHex(algorithms)
+	}
+	if len(hashed) == 0 {
+		c = ""
+	}
+
+	return a + "_" + truncatedHash(joinHex(sorted(ciphers))) + "_" + truncatedHash(c)
+}
+
+func ja4Version(ch *ClientHello) string {
+	version := ch.Version
+	for _, v := range withoutGREASE(ch.SupportedVersions) {
+		if v > version {
+			version = v
+		}
+	}
+	switch version {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	}
+	return "00"
+}
+
+// ja4ALPN returns the first and last characters of the first ALPN protocol,
+// or of its hex representation if they aren't alphanumeric.
+func ja4ALPN(protocols []string) string {
+	if len(protocols) == 0 || protocols[0] == "" {
+		return "00"
+	}
+	p := protocols[0]
+	first, last := p[0], p[len(p)-1]
+	if !isAlphanumeric(first) || !isAlphanumeric(last) {
+		h := hex.EncodeToString([]byte(p))
+		return h[:1] + h[len(h)-1:]
+	}
+	return string(first) + string(last)
+}
+
+// truncatedHash returns the first 12 characters of the SHA-256 of s, or
+// zeros if s is empty.
+func truncatedHash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])[:12]
+}
+
+// isGREASE reports whether v is a GREASE value (RFC 8701), sent by clients
+// to prevent ossification and ignored by the fingerprints.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func withoutGREASE(values []uint16) []uint16 {
+	var out []uint16
+	for _, v := range values {
+		if !isGREASE(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func sorted(values []uint16) []uint16 {
+	out := append([]uint16{}, values...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func joinDecimal(values []uint16) string {
+	var parts []string
+	for _, v := range withoutGREASE(values) {
+		parts = append(parts, strconv.Itoa(int(v)))
+	}
+	return strings.Join(parts, "-")
+}
+
+func joinHex(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,150 @@
+package fingerprint
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+func u16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func prefixed16(data ...[]byte) []byte {
+	var b []byte
+	for _, d := range data {
+		b = append(b, d...)
+	}
+	return append(u16(uint16(len(b))), b...)
+}
+
+func extension(typ uint16, data []byte) []byte {
+	return append(u16(typ), prefixed16(data)...)
+}
+
+// testClientHello returns the records of a ClientHello with GREASE values,
+// split in records of at most recordSize bytes.
+func testClientHello(recordSize int) []byte {
+	body := u16(0x0303)
+	body = append(body, make([]byte, 32)...) // random
+	body = append(body, 0)                   // session ID
+	body = append(body, prefixed16(u16(0x0a0a), u16(0x1301), u16(0xc02b), u16(0x002f))...)
+	body = append(body, 1, 0) // compression methods
+	body = append(body, prefixed16(
+		extension(0x1a1a, nil),
+		extension(extensionServerName, prefixed16([]byte{0}, prefixed16([]byte("example.com")))),
+		extension(extensionSupportedGroups, prefixed16(u16(0x0a0a), u16(0x001d), u16(0x0017))),
+		extension(extensionPointFormats, []byte{1, 0}),
+		extension(extensionSignatureAlgorithms, prefixed16(u16(0x0403), u16(0x0804))),
+		extension(extensionALPN, prefixed16([]byte{2}, []byte("h2"), []byte{8}, []byte("http/1.1"))),
+		extension(extensionSupportedVersions, []byte{6, 0x0a, 0x0a, 0x03, 0x04, 0x03, 0x03}),
+	)...)
+
+	message := append([]byte{handshakeTypeClientHello, 0}, u16(uint16(len(body)))...)
+	message = append(message, body...)
+	var records []byte
+	for len(message) > 0 {
+		n := min(recordSize, len(message))
+		records = append(records, recordTypeHandshake, 0x03, 0x01)
+		records = append(records, prefixed16(message[:n])...)
+		message = message[n:]
+	}
+	return records
+}
+
+func TestClientHello(t *testing.T) {
+	for _, recordSize := range []int{16384, 50} {
+		body, err := readClientHello(testClientHello(recordSize))
+		if err != nil {
+			t.Fatalf("readClientHello() error = %v", err)
+		}
+		ch, err := ParseClientHello(body)
+		if err != nil {
+			t.Fatalf("ParseClientHello() error = %v", err)
+		}
+		if ch.ServerName != "example.com" || len(ch.ALPN) != 2 || ch.ALPN[0] != "h2" {
+			t.Errorf("Expected the server name and ALPN protocols, got %q and %q", ch.ServerName, ch.ALPN)
+		}
+
+		fp := NewTLS(ch)
+		if want := "771,4865-49195-47,0-10-11-13-16-43,29-23,0"; fp.JA3 != want {
+			t.Errorf("JA3 = %q, want %q", fp.JA3, want)
+		}
+		if want := "0f92d7a0e8b92db0367a29764a06d32a"; fp.JA3Hash != want {
+			t.Errorf("JA3Hash = %q, want %q", fp.JA3Hash, want)
+		}
+		if want := "t13d0306h2_58a34ed92d94_fb71836bce29"; fp.JA4 != want {
+			t.Errorf("JA4 = %q, want %q", fp.JA4, want)
+		}
+	}
+
+	data := testClientHello(16384)
+	if _, err := readClientHello(data[:len(data)-1]); err != errIncomplete {
+		t.Errorf("Expected an incomplete ClientHello, got %v", err)
+	}
+	if _, err := readClientHello([]byte("GET / HTTP/1.1\r\n")); err != errNotClientHello {
+		t.Errorf("Expected an invalid ClientHello, got %v", err)
+	}
+}
+
+func TestJA4ALPN(t *testing.T) {
+	tests := []struct {
+		alpn []string
+		want string
+	}{
+		{nil, "00"},
+		{[]string{"http/1.1"}, "h1"},
+		{[]string{"\xab\xcd"}, "ad"},
+	}
+	for _, tt := range tests {
+		if got := ja4ALPN(tt.alpn); got != tt.want {
+			t.Errorf("ja4ALPN(%q) = %q, want %q", tt.alpn, got, tt.want)
+		}
+	}
+}
+
+func TestListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %s", err)
+	}
+	defer ln.Close()
+	fl := NewListener(ln, true)
+
+	go func() {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+			ServerName:         "example.com",
+			NextProtos:         []string{"h2"},
+			InsecureSkipVerify: true,
+		})
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	conn, err := fl.Accept()
+	if err != nil {
+		t.Fatalf("error accepting: %s", err)
+	}
+	defer conn.Close()
+	// The server fails the handshake without a certificate, after reading
+	// the ClientHello.
+	tlsConn := tls.Server(conn, &tls.Config{})
+	_ = tlsConn.Handshake()
+
+	ctx := WithConn(context.Background(), tlsConn)
+	fp := TLSFrom(ctx)
+	if fp == nil {
+		t.Fatal("Expected the TLS fingerprints of the connection")
+	}
+	if !strings.HasPrefix(fp.JA3, "771,") || !strings.HasPrefix(fp.JA4, "t13d") || !strings.Contains(fp.JA4, "h2_") {
+		t.Errorf("Unexpected fingerprints of a TLS 1.3 client: %+v", fp)
+	}
+
+	if fp := TLSFrom(WithConn(context.Background(), &net.TCPConn{})); fp != nil {
+		t.Errorf("Expected no fingerprints for other connections, got %+v", fp)
+	}
+}
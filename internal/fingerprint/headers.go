@@ -0,0 +1,161 @@
+package fingerprint
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// maxHeaderSize is the maximum size of the header of a request, beyond which
+// the headers of the connection aren't recorded anymore.
+const maxHeaderSize = 64 * 1024
+
+type recorderState int
+
+const (
+	stateHeader recorderState = iota
+	stateBody
+	stateChunkSize
+	stateChunkData
+	stateChunkEnd
+	stateTrailer
+	stateStopped
+)
+
+// headerRecorder records the order of the header names of the HTTP/1.x
+// requests of a connection, following the message framing to skip their
+// bodies. It stops at the first message it can't follow (e.g. after an
+// upgrade to another protocol).
+type headerRecorder struct {
+	state     recorderState
+	line      []byte
+	remaining int64
+	orders    [][]string
+}
+
+func (h *headerRecorder) write(b []byte) {
+	for len(b) > 0 && h.state != stateStopped {
+		switch h.state {
+		case stateBody, stateChunkData:
+			n := int64(len(b))
+			if n > h.remaining {
+				n = h.remaining
+			}
+			b = b[n:]
+			if h.remaining -= n; h.remaining == 0 {
+				if h.state == stateBody {
+					h.state = stateHeader
+				} else {
+					h.state = stateChunkEnd
+				}
+			}
+		case stateHeader:
+			// Leading empty lines are ignored by the servers.
+			if len(h.line) == 0 {
+				if b = bytes.TrimLeft(b, "\r\n"); len(b) == 0 {
+					return
+				}
+			}
+			data := append(h.line, b...)
+			i := bytes.Index(data, []byte("\r\n\r\n"))
+			if i < 0 {
+				if h.line = data; len(h.line) > maxHeaderSize {
+					h.state = stateStopped
+				}
+				return
+			}
+			b = b[i+4-len(h.line):]
+			h.line = nil
+			h.endHeader(data[:i+4])
+		default:
+			i := bytes.IndexByte(b, '\n')
+			if i < 0 {
+				if h.line = append(h.line, b...); len(h.line) > maxHeaderSize {
+					h.state = stateStopped
+				}
+				return
+			}
+			line := strings.TrimSpace(string(append(h.line, b[:i]...)))
+			h.line = nil
+			b = b[i+1:]
+			h.endLine(line)
+		}
+	}
+}
+
+// endHeader records the header names of a request and prepares to skip its
+// body.
+func (h *headerRecorder) endHeader(header []byte) {
+	lines := strings.Split(string(header), "\r\n")
+	if !strings.HasSuffix(lines[0], " HTTP/1.1") && !strings.HasSuffix(lines[0], " HTTP/1.0") {
+		h.state = stateStopped
+		return
+	}
+
+	var names []string
+	var contentLength int64
+	chunked, upgrade := false, false
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		// Continuation lines are part of the previous header.
+		if !ok || name == "" || name[0] == ' ' || name[0] == '\t' {
+			continue
+		}
+		names = append(names, name)
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(name) {
+		case "content-length":
+			contentLength, _ = strconv.ParseInt(value, 10, 64)
+		case "transfer-encoding":
+			chunked = strings.Contains(strings.ToLower(value), "chunked")
+		case "upgrade":
+			upgrade = true
+		}
+	}
+	h.orders = append(h.orders, names)
+
+	switch {
+	case upgrade:
+		h.state = stateStopped
+	case chunked:
+		h.state = stateChunkSize
+	case contentLength > 0:
+		h.state, h.remaining = stateBody, contentLength
+	default:
+		h.state = stateHeader
+	}
+}
+
+// endLine handles a line of a chunked body.
+func (h *headerRecorder) endLine(line string) {
+	switch h.state {
+	case stateChunkSize:
+		size, _, _ := strings.Cut(line, ";")
+		n, err := strconv.ParseInt(strings.TrimSpace(size), 16, 64)
+		switch {
+		case err != nil || n < 0:
+			h.state = stateStopped
+		case n == 0:
+			h.state = stateTrailer
+		default:
+			h.state, h.remaining = stateChunkData, n
+		}
+	case stateChunkEnd:
+		h.state = stateChunkSize
+	case stateTrailer:
+		if line == "" {
+			h.state = stateHeader
+		}
+	}
+}
+
+// next returns the header names of the oldest request not returned yet, or
+// nil if there is none.
+func (h *headerRecorder) next() []string {
+	if len(h.orders) == 0 {
+		return nil
+	}
+	names := h.orders[0]
+	h.orders = h.orders[1:]
+	return names
+}
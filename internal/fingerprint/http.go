@@ -0,0 +1,102 @@
+package fingerprint
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type ja4hKey struct{}
+
+// WithJA4H returns a copy of the request carrying its JA4H fingerprint,
+// computed with the header order recorded by its connection. It must be
+// called once for each request of a connection.
+func WithJA4H(r *http.Request) *http.Request {
+	var names []string
+	if c, ok := r.Context().Value(connKey{}).(*Conn); ok {
+		names = c.nextHeaderOrder()
+	}
+	return r.WithContext(context.WithValue(r.Context(), ja4hKey{}, JA4H(r, names)))
+}
+
+// JA4HFrom returns the JA4H fingerprint carried by the request, or computes
+// it without the header order.
+func JA4HFrom(r *http.Request) string {
+	if ja4h, ok := r.Context().Value(ja4hKey{}).(string); ok {
+		return ja4h
+	}
+	return JA4H(r, nil)
+}
+
+// JA4H returns the JA4H fingerprint of the request, given its header names
+// in the order they were received. Without them (e.g. for HTTPS and HTTP/2
+// requests), the names of the parsed headers are used in sorted order.
+func JA4H(r *http.Request, names []string) string {
+	if names == nil {
+		for name := range r.Header {
+			for range r.Header[name] {
+				names = append(names, name)
+			}
+		}
+		if r.ProtoMajor == 1 && r.Host != "" {
+			names = append(names, "Host")
+		}
+		sort.Strings(names)
+	}
+
+	cookie, referer := "n", "n"
+	var hashed []string
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "cookie":
+			cookie = "c"
+		case "referer":
+			referer = "r"
+		default:
+			hashed = append(hashed, name)
+		}
+	}
+
+	method := strings.ToLower(r.Method)
+	if len(method) > 2 {
+		method = method[:2]
+	}
+	language := strings.ToLower(strings.ReplaceAll(r.Header.Get("Accept-Language"), "-", ""))
+	language, _, _ = strings.Cut(language, ",")
+	language, _, _ = strings.Cut(language, ";")
+	language = (language + "0000")[:4]
+	a := fmt.Sprintf("%s%s%s%s%02d%s", method, ja4hVersion(r), cookie, referer, min(len(hashed), 99), language)
+
+	var cookieNames, cookiePairs []string
+	for _, line := range r.Header.Values("Cookie") {
+		for _, pair := range strings.Split(line, ";") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			name, _, _ := strings.Cut(pair, "=")
+			cookieNames = append(cookieNames, name)
+			cookiePairs = append(cookiePairs, pair)
+		}
+	}
+	sort.Strings(cookieNames)
+	sort.Strings(cookiePairs)
+
+	return a + "_" + truncatedHash(strings.Join(hashed, ",")) + "_" +
+		truncatedHash(strings.Join(cookieNames, ",")) + "_" + truncatedHash(strings.Join(cookiePairs, ","))
+}
+
+func ja4hVersion(r *http.Request) string {
+	switch {
+	case r.ProtoMajor == 1 && r.ProtoMinor == 0:
+		return "10"
+	case r.ProtoMajor == 1:
+		return "11"
+	case r.ProtoMajor == 2:
+		return "20"
+	case r.ProtoMajor == 3:
+		return "30"
+	}
+	return "00"
+}
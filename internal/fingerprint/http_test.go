@@ -0,0 +1,97 @@
+package fingerprint
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testHeaderRequest = "GET /login HTTP/1.1\r\n" +
+	"Host: example.com\r\n" +
+	"User-Agent: Mozilla/5.0\r\n" +
+	"Accept: */*\r\n" +
+	"Accept-Language: en-US,en;q=0.9\r\n" +
+	"Cookie: b=2; a=1\r\n" +
+	"Referer: http://example.com/\r\n\r\n"
+
+func TestJA4H(t *testing.T) {
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(testHeaderRequest)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"Host", "User-Agent", "Accept", "Accept-Language", "Cookie", "Referer"}
+	if got, want := JA4H(r, names), "ge11cr04enus_8ddaef5d77af_1eb7c54d5283_06beefe2b477"; got != want {
+		t.Errorf("JA4H() = %q, want %q", got, want)
+	}
+
+	// Without the header order, the names are sorted.
+	sorted := []string{"Accept", "Accept-Language", "Cookie", "Host", "Referer", "User-Agent"}
+	if got, want := JA4H(r, nil), JA4H(r, sorted); got != want {
+		t.Errorf("JA4H() = %q, want %q", got, want)
+	}
+}
+
+func TestHeaderRecorder(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %s", err)
+	}
+	defer ln.Close()
+
+	got := make(chan string, 3)
+	server := &http.Server{
+		ConnContext: WithConn,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body)
+			got <- JA4HFrom(WithJA4H(r))
+		}),
+	}
+	go server.Serve(NewListener(ln, false))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("error connecting: %s", err)
+	}
+	defer conn.Close()
+
+	requests := []struct {
+		raw   string
+		names []string
+	}{
+		{
+			raw:   "POST /a HTTP/1.1\r\nUser-Agent: curl/8.0\r\nHost: example.com\r\nContent-Length: 19\r\n\r\nGET /b HTTP/1.1\r\n\r\n",
+			names: []string{"User-Agent", "Host", "Content-Length"},
+		},
+		{
+			raw:   "POST /c HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\nX-Test: 1\r\n\r\n5\r\nHost:\r\n0\r\n\r\n",
+			names: []string{"Host", "Transfer-Encoding", "X-Test"},
+		},
+		{
+			raw:   testHeaderRequest,
+			names: []string{"Host", "User-Agent", "Accept", "Accept-Language", "Cookie", "Referer"},
+		},
+	}
+	br := bufio.NewReader(conn)
+	for _, req := range requests {
+		if _, err := io.WriteString(conn, req.raw); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("error reading the response: %s", err)
+		}
+		resp.Body.Close()
+
+		r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(req.raw)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ja4h, want := <-got, JA4H(r, req.names); ja4h != want {
+			t.Errorf("JA4H of %q = %q, want %q", req.raw, ja4h, want)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+// Package har converts the events of the event log into HTTP Archive (HAR)
+// 1.2 logs, to replay and analyze the requests of the attackers and the
+// generated responses with the standard web tooling.
+package har
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version is the HAR version of the logs.
+const Version = "1.2"
+
+// creatorName is the name of the creator of the logs.
+const creatorName = "galah"
+
+// HAR is an HTTP Archive.
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+// Log is the log of an HTTP Archive.
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+}
+
+// Creator is the application creating the log.
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry is a request and its response. The source of the request and the
+// tags of its event are kept in the custom _srcIP and _tags fields.
+type Entry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Time            float64   `json:"time"`
+	Request         Request   `json:"request"`
+	Response        Response  `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         Timings   `json:"timings"`
+	SrcIP           string    `json:"_srcIP,omitempty"`
+	Tags            []string  `json:"_tags,omitempty"`
+}
+
+// Request is the request of an entry.
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+// Response is the response of an entry.
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+// NameValue is a header or a query parameter.
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Cookie is a cookie of a request or a response.
+type Cookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// PostData is the body of a request. The Comment notes the bodies that are
+// base64 encoded.
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Content is the body of a response, base64 encoded if Encoding is set.
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Timings are the durations of the phases of a request, in milliseconds. The
+// event log doesn't record them, so they are all zero.
+type Timings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// Config controls the conversion. Only the events of SrcIP and of the session
+// Session (the ID of the session of the events) are converted when set. The
+// URLs of the requests are of Host, or of the sensor and port of the events
+// if empty. Version is the version of galah creating the log.
+type Config struct {
+	SrcIP   string
+	Session string
+	Host    string
+	Version string
+}
+
+// event is the part of an event log record converted into an entry.
+type event struct {
+	EventTime      time.Time       `json:"eventTime"`
+	SrcIP          string          `json:"srcIP"`
+	SensorName     string          `json:"sensorName"`
+	Port           string          `json:"port"`
+	Tags           []string        `json:"tags"`
+	TLSFingerprint json.RawMessage `json:"tlsFingerprint"`
+	HTTPRequest    struct {
+		Method          string `json:"method"`
+		ProtocolVersion string `json:"protocolVersion"`
+		Request         string `json:"request"`
+		Headers         string `json:"headers"`
+		Body            string `json:"body"`
+		BodyEncoding    string `json:"bodyEncoding"`
+	} `json:"httpRequest"`
+	HTTPResponse *struct {
+		StatusCode int               `json:"status_code"`
+		Headers    map[string]string `json:"headers"`
+		Encoding   string            `json:"encoding"`
+		Body       string            `json:"body"`
+	} `json:"httpResponse"`
+	Error *struct {
+		StatusCode int `json:"statusCode"`
+	} `json:"error"`
+	Session struct {
+		ID string `json:"id"`
+	} `json:"session"`
+}
+
+// FromEventLog returns the HAR log of the request events of the event log
+// matching the configuration. The other lines are skipped.
+func FromEventLog(eventLog io.Reader, cfg Config) (*HAR, error) {
+	var events []json.RawMessage
+	scanner := bufio.NewScanner(eventLog)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		events = append(events, json.RawMessage(append([]byte{}, scanner.Bytes()...)))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return FromEvents(events, cfg), nil
+}
+
+// FromEvents returns the HAR log of the request events matching the
+// configuration, in chronological order. The events that aren't request
+// events, such as the WebSocket messages, are skipped.
+func FromEvents(events []json.RawMessage, cfg Config) *HAR {
+	entries := []Entry{}
+	for _, data := range events {
+		var e event
+		if err := json.Unmarshal(data, &e); err != nil || e.HTTPRequest.Method == "" || !e.matches(data, cfg) {
+			continue
+		}
+		entries = append(entries, e.entry(cfg.Host))
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime.Before(entries[j].StartedDateTime)
+	})
+	return &HAR{Log: Log{
+		Version: Version,
+		Creator: Creator{Name: creatorName, Version: cfg.Version},
+		Entries: entries,
+	}}
+}
+
+// matches reports whether the event matches the configuration. The events of
+// the WebSocket sessions are request events with a webSocket field.
+func (e *event) matches(data json.RawMessage, cfg Config) bool {
+	if cfg.SrcIP != "" && e.SrcIP != cfg.SrcIP {
+		return false
+	}
+	if cfg.Session != "" && e.Session.ID != cfg.Session {
+		return false
+	}
+	var ws struct {
+		WebSocket json.RawMessage `json:"webSocket"`
+	}
+	return json.Unmarshal(data, &ws) == nil && ws.WebSocket == nil
+}
+
+// entry returns the entry of the event.
+func (e *event) entry(host string) Entry {
+	req := e.HTTPRequest
+	headers := parseHeaders(req.Headers)
+	if host == "" {
+		host = e.SensorName
+		if e.Port != "" {
+			host += ":" + e.Port
+		}
+	}
+	scheme := "http"
+	if len(e.TLSFingerprint) > 0 && string(e.TLSFingerprint) != "null" {
+		scheme = "https"
+	}
+	version := req.ProtocolVersion
+	if version == "" {
+		version = "HTTP/1.1"
+	}
+
+	entry := Entry{
+		StartedDateTime: e.EventTime,
+		Request: Request{
+			Method:      req.Method,
+			URL:         scheme + "://" + host + req.Request,
+			HTTPVersion: version,
+			Cookies:     requestCookies(headers),
+			Headers:     headers,
+			QueryString: queryString(req.Request),
+			HeadersSize: -1,
+			BodySize:    len(req.Body),
+		},
+		Response: Response{
+			// The failed generations logged without their status were
+			// served as internal server errors.
+			Status:      http.StatusInternalServerError,
+			HTTPVersion: version,
+			Cookies:     []Cookie{},
+			Headers:     []NameValue{},
+			HeadersSize: -1,
+		},
+		SrcIP: e.SrcIP,
+		Tags:  e.Tags,
+	}
+	if req.Body != "" {
+		entry.Request.PostData = &PostData{MimeType: header(headers, "Content-Type"), Text: req.Body}
+		// The bodies that aren't text are logged in base64, kept as is with
+		// a comment, the post data having no encoding.
+		if req.BodyEncoding != "" {
+			entry.Request.PostData.Comment = req.BodyEncoding + " encoded"
+			if body, err := base64.StdEncoding.DecodeString(req.Body); err == nil {
+				entry.Request.BodySize = len(body)
+			}
+		}
+	}
+	if e.Error != nil && e.Error.StatusCode != 0 {
+		entry.Response.Status = e.Error.StatusCode
+	}
+	if resp := e.HTTPResponse; resp != nil {
+		entry.Response.Status = resp.StatusCode
+		if entry.Response.Status == 0 {
+			entry.Response.Status = http.StatusOK
+		}
+		keys := make([]string, 0, len(resp.Headers))
+		for key := range resp.Headers {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			entry.Response.Headers = append(entry.Response.Headers, NameValue{Name: key, Value: resp.Headers[key]})
+		}
+		entry.Response.Cookies = responseCookies(resp.Headers)
+		entry.Response.Content = Content{
+			Size:     len(resp.Body),
+			MimeType: header(entry.Response.Headers, "Content-Type"),
+			Text:     resp.Body,
+		}
+		if resp.Encoding != "" {
+			entry.Response.Content.Encoding = resp.Encoding
+			if body, err := base64.StdEncoding.DecodeString(resp.Body); err == nil {
+				entry.Response.Content.Size = len(body)
+			}
+		}
+		entry.Response.BodySize = entry.Response.Content.Size
+		entry.Response.RedirectURL = header(entry.Response.Headers, "Location")
+	}
+	entry.Response.StatusText = http.StatusText(entry.Response.Status)
+	return entry
+}
+
+// headerStart matches the start of a header of the headers of the event log,
+// logged as "Name: [value1 value2], Name: [value]".
+var headerStart = regexp.MustCompile("(?:^|, )([!#$%&'*+.^_`|~0-9A-Za-z-]+): \\[")
+
+// parseHeaders returns the headers of the event log, sorted by name. The
+// values of a header are kept together, as their separator is ambiguous.
+func parseHeaders(s string) []NameValue {
+	headers := []NameValue{}
+	matches := headerStart.FindAllStringSubmatchIndex(s, -1)
+	for i, m := range matches {
+		end := len(s)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		value := strings.TrimSuffix(s[m[1]:end], "]")
+		headers = append(headers, NameValue{Name: s[m[2]:m[3]], Value: value})
+	}
+	sort.SliceStable(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+	return headers
+}
+
+// header returns the value of the named header, case-insensitively.
+func header(headers []NameValue, name string) string {
+	for _, h := range headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// queryString returns the query parameters of the request URI, in order.
+func queryString(uri string) []NameValue {
+	params := []NameValue{}
+	_, query, ok := strings.Cut(uri, "?")
+	if !ok {
+		return params
+	}
+	for _, pair := range strings.Split(query, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		if n, err := url.QueryUnescape(name); err == nil {
+			name = n
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		params = append(params, NameValue{Name: name, Value: value})
+	}
+	return params
+}
+
+// requestCookies returns the cookies of the Cookie header.
+func requestCookies(headers []NameValue) []Cookie {
+	cookies := []Cookie{}
+	r := http.Request{Header: http.Header{"Cookie": {header(headers, "Cookie")}}}
+	for _, c := range r.Cookies() {
+		cookies = append(cookies, Cookie{Name: c.Name, Value: c.Value})
+	}
+	return cookies
+}
+
+// responseCookies returns the cookies of the Set-Cookie header.
+func responseCookies(headers map[string]string) []Cookie {
+	cookies := []Cookie{}
+	for key, value := range headers {
+		if !strings.EqualFold(key, "Set-Cookie") {
+			continue
+		}
+		resp := http.Response{Header: http.Header{"Set-Cookie": {value}}}
+		for _, c := range resp.Cookies() {
+			cookies = append(cookies, Cookie{Name: c.Name, Value: c.Value})
+		}
+	}
+	return cookies
+}
@@ -0,0 +1,79 @@
+package har
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testEventLog = `{"eventTime":"2024-05-26T19:05:00Z","httpRequest":{"body":"user=admin&password=admin","headers":"Content-Type: [application/x-www-form-urlencoded], Cookie: [sid=abc]","method":"POST","protocolVersion":"HTTP/1.1","request":"/login?next=%2Fadmin"},"httpResponse":{"headers":{"Content-Type":"text/html","Location":"/admin","Set-Cookie":"sid=def; Path=/"},"body":"<html></html>","status_code":302},"msg":"successfulResponse","port":"8080","sensorName":"sensor","session":{"id":"s1"},"srcIP":"192.0.2.1","tags":["credentials"]}
+{"eventTime":"2024-05-26T19:03:45Z","httpRequest":{"body":"","headers":"Accept: [*/*], User-Agent: [curl/8.0, like Gecko]","method":"GET","protocolVersion":"HTTP/1.1","request":"/"},"httpResponse":{"headers":{"Content-Type":"image/png"},"body":"iVBORw==","encoding":"base64"},"msg":"successfulResponse","port":"8080","sensorName":"sensor","session":{"id":"s1"},"srcIP":"192.0.2.1","tlsFingerprint":{"ja3":"x"}}
+{"eventTime":"2024-05-26T19:06:00Z","error":{"msg":"timeout","statusCode":503},"httpRequest":{"body":"","headers":"","method":"GET","request":"/admin"},"msg":"failedResponse: returned 503 service unavailable","port":"8080","sensorName":"sensor","session":{"id":"s1"},"srcIP":"192.0.2.1"}
+{"eventTime":"2024-05-26T19:07:00Z","httpRequest":{"body":"","headers":"","method":"GET","request":"/ws"},"msg":"webSocketMessage","port":"8080","sensorName":"sensor","session":{"id":"s1"},"srcIP":"192.0.2.1","webSocket":{"message":"hi"}}
+{"eventTime":"2024-05-26T19:08:00Z","httpRequest":{"body":"","headers":"","method":"GET","request":"/"},"httpResponse":{"headers":{},"body":"ok"},"msg":"successfulResponse","port":"8080","sensorName":"sensor","session":{"id":"s2"},"srcIP":"192.0.2.2"}
+not a JSON line
+{"level":"info","msg":"starting HTTP server on port 8080"}
+`
+
+func TestFromEventLog(t *testing.T) {
+	h, err := FromEventLog(strings.NewReader(testEventLog), Config{Session: "s1", Version: "1.0"})
+	if err != nil {
+		t.Fatalf("FromEventLog() error = %v", err)
+	}
+	if h.Log.Version != Version || h.Log.Creator != (Creator{Name: "galah", Version: "1.0"}) {
+		t.Errorf("Unexpected log version and creator: %+v", h.Log)
+	}
+	entries := h.Log.Entries
+	if len(entries) != 3 {
+		t.Fatalf("Expected the 3 request events of the session, got %d", len(entries))
+	}
+
+	first := entries[0]
+	if first.Request.URL != "https://sensor:8080/" || first.Response.Status != 200 || first.Response.StatusText != "OK" {
+		t.Errorf("Unexpected first entry: %+v", first)
+	}
+	wantHeaders := []NameValue{{Name: "Accept", Value: "*/*"}, {Name: "User-Agent", Value: "curl/8.0, like Gecko"}}
+	if !reflect.DeepEqual(first.Request.Headers, wantHeaders) {
+		t.Errorf("Expected the request headers %+v, got %+v", wantHeaders, first.Request.Headers)
+	}
+	if c := first.Response.Content; c.Encoding != "base64" || c.Size != 4 || c.MimeType != "image/png" {
+		t.Errorf("Expected the base64 encoded content of 4 bytes, got %+v", c)
+	}
+
+	login := entries[1]
+	if login.Request.URL != "http://sensor:8080/login?next=%2Fadmin" {
+		t.Errorf("Unexpected URL %q", login.Request.URL)
+	}
+	if want := []NameValue{{Name: "next", Value: "/admin"}}; !reflect.DeepEqual(login.Request.QueryString, want) {
+		t.Errorf("Expected the query string %+v, got %+v", want, login.Request.QueryString)
+	}
+	if p := login.Request.PostData; p == nil || p.MimeType != "application/x-www-form-urlencoded" || p.Text != "user=admin&password=admin" {
+		t.Errorf("Unexpected post data %+v", p)
+	}
+	if want := []Cookie{{Name: "sid", Value: "abc"}}; !reflect.DeepEqual(login.Request.Cookies, want) {
+		t.Errorf("Expected the request cookies %+v, got %+v", want, login.Request.Cookies)
+	}
+	if want := []Cookie{{Name: "sid", Value: "def"}}; !reflect.DeepEqual(login.Response.Cookies, want) {
+		t.Errorf("Expected the response cookies %+v, got %+v", want, login.Response.Cookies)
+	}
+	if login.Response.Status != 302 || login.Response.RedirectURL != "/admin" {
+		t.Errorf("Expected a redirect to /admin, got %+v", login.Response)
+	}
+	if login.SrcIP != "192.0.2.1" || !reflect.DeepEqual(login.Tags, []string{"credentials"}) {
+		t.Errorf("Expected the source and tags of the event, got %q %v", login.SrcIP, login.Tags)
+	}
+
+	if failed := entries[2].Response; failed.Status != 503 || failed.StatusText != "Service Unavailable" {
+		t.Errorf("Expected the failed response served as a 503, got %+v", failed)
+	}
+}
+
+func TestFromEventLogFilters(t *testing.T) {
+	h, err := FromEventLog(strings.NewReader(testEventLog), Config{SrcIP: "192.0.2.2", Host: "example.com"})
+	if err != nil {
+		t.Fatalf("FromEventLog() error = %v", err)
+	}
+	if len(h.Log.Entries) != 1 || h.Log.Entries[0].Request.URL != "http://example.com/" {
+		t.Errorf("Expected the request of the source on the host, got %+v", h.Log.Entries)
+	}
+}
@@ -0,0 +1,346 @@
+// Package honeytoken embeds canary tokens (unique URLs, tracking pixels and
+// fake API keys) into the generated responses, and detects their later use in
+// the requests to the honeypot.
+package honeytoken
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// The kinds of tokens.
+const (
+	KindURL    = "url"
+	KindPixel  = "pixel"
+	KindAPIKey = "api_key"
+)
+
+// Kinds are the kinds of tokens.
+var Kinds = []string{KindURL, KindPixel, KindAPIKey}
+
+// Default settings of the tokens.
+const (
+	DefaultPathPrefix = "/static/"
+	DefaultMaxTokens  = 100000
+)
+
+// apiKeyPrefix is the prefix of the fake API keys.
+const apiKeyPrefix = "sk_live_"
+
+// idSize is the size of the IDs of the tokens, in hex digits.
+const idSize = 24
+
+// idRe matches the candidate IDs of tokens.
+var idRe = regexp.MustCompile(`[0-9a-f]{24}`)
+
+// Config configures the Honeytokens. The tokens of the Kinds (all of them if
+// empty) are derived from Secret (random if empty), and the tokens issued are
+// recorded in File, if set, to detect their use after a restart. The URLs of
+// the URL and pixel tokens are under PathPrefix (DefaultPathPrefix if empty)
+// of the honeypot, or of BaseURL if set. At most MaxTokens
+// (DefaultMaxTokens if 0) are issued. OnUsed, if not nil, is called when a
+// token is used.
+type Config struct {
+	Kinds      []string
+	Secret     string
+	File       string
+	BaseURL    string
+	PathPrefix string
+	MaxTokens  int
+	OnUsed     func(Use)
+}
+
+// Token is a token issued to Source in the response to the request for Path.
+type Token struct {
+	ID     string    `json:"id"`
+	Kind   string    `json:"kind"`
+	Value  string    `json:"value"`
+	Source string    `json:"srcIP"`
+	Path   string    `json:"path"`
+	Issued time.Time `json:"issued"`
+}
+
+// Use is a use of a token by Source.
+type Use struct {
+	Token  Token     `json:"token"`
+	Source string    `json:"srcIP"`
+	Time   time.Time `json:"time"`
+}
+
+// Honeytokens issues the tokens and detects their use, safe for concurrent
+// use.
+type Honeytokens struct {
+	cfg    Config
+	secret []byte
+	kinds  map[string]bool
+
+	mu     sync.Mutex
+	tokens map[string]Token
+	file   *os.File
+}
+
+// New returns the Honeytokens of the configuration, loading the tokens
+// recorded in its file.
+func New(cfg Config) (*Honeytokens, error) {
+	if len(cfg.Kinds) == 0 {
+		cfg.Kinds = Kinds
+	}
+	if cfg.PathPrefix == "" {
+		cfg.PathPrefix = DefaultPathPrefix
+	}
+	if !strings.HasSuffix(cfg.PathPrefix, "/") {
+		cfg.PathPrefix += "/"
+	}
+	if cfg.MaxTokens <= 0 {
+		cfg.MaxTokens = DefaultMaxTokens
+	}
+	h := &Honeytokens{cfg: cfg, kinds: make(map[string]bool), tokens: make(map[string]Token)}
+	for _, kind := range cfg.Kinds {
+		switch kind {
+		case KindURL, KindPixel, KindAPIKey:
+			h.kinds[kind] = true
+		default:
+			return nil, fmt.Errorf("unknown honeytoken kind %q", kind)
+		}
+	}
+	h.secret = []byte(cfg.Secret)
+	if len(h.secret) == 0 {
+		h.secret = make([]byte, 32)
+		if _, err := rand.Read(h.secret); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.File != "" {
+		if err := h.load(cfg.File); err != nil {
+			return nil, fmt.Errorf("error loading the honeytokens: %s", err)
+		}
+		f, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("error opening the honeytokens file: %s", err)
+		}
+		h.file = f
+	}
+	return h, nil
+}
+
+// load loads the tokens recorded in the file, if it exists.
+func (h *Honeytokens) load(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var t Token
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil || t.ID == "" {
+			continue
+		}
+		h.tokens[t.ID] = t
+	}
+	return scanner.Err()
+}
+
+// Close closes the file of the tokens.
+func (h *Honeytokens) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
+
+// Tokens returns the tokens issued, most recent first.
+func (h *Honeytokens) Tokens() []Token {
+	h.mu.Lock()
+	tokens := make([]Token, 0, len(h.tokens))
+	for _, t := range h.tokens {
+		tokens = append(tokens, t)
+	}
+	h.mu.Unlock()
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].Issued.Equal(tokens[j].Issued) {
+			return tokens[i].Issued.After(tokens[j].Issued)
+		}
+		return tokens[i].ID < tokens[j].ID
+	})
+	return tokens
+}
+
+// issue returns the token of the kind issued to the source for the path,
+// the same for the same source and path, or false if no more tokens can be
+// issued. The token is issued even if it can't be recorded in the file.
+func (h *Honeytokens) issue(kind, source, path string) (Token, bool, error) {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(kind + "\x00" + source + "\x00" + path))
+	id := hex.EncodeToString(mac.Sum(nil))[:idSize]
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if t, ok := h.tokens[id]; ok {
+		return t, true, nil
+	}
+	if len(h.tokens) >= h.cfg.MaxTokens {
+		return Token{}, false, nil
+	}
+	t := Token{ID: id, Kind: kind, Value: h.value(kind, id), Source: source, Path: path, Issued: time.Now().UTC()}
+	h.tokens[id] = t
+	if h.file == nil {
+		return t, true, nil
+	}
+	data, err := json.Marshal(t)
+	if err == nil {
+		_, err = h.file.Write(append(data, '\n'))
+	}
+	return t, true, err
+}
+
+// value returns the value of the token of the kind embedded in the responses.
+func (h *Honeytokens) value(kind, id string) string {
+	switch kind {
+	case KindAPIKey:
+		return apiKeyPrefix + id
+	case KindPixel:
+		return h.url(id + ".gif")
+	default:
+		return h.url(id)
+	}
+}
+
+func (h *Honeytokens) url(name string) string {
+	return strings.TrimSuffix(h.cfg.BaseURL, "/") + h.cfg.PathPrefix + name
+}
+
+// Inject embeds the tokens issued to the source for the path into the HTML
+// body, or the API key token into the JSON object body, of the response. The
+// other responses are left as they are. It returns the error recording the
+// tokens issued, embedded all the same.
+func (h *Honeytokens) Inject(source, path string, resp *llm.JSONResponse) error {
+	if resp.Encoding != "" || resp.Body == "" {
+		return nil
+	}
+	var errs []error
+	token := func(kind string) (Token, bool) {
+		if !h.kinds[kind] {
+			return Token{}, false
+		}
+		t, ok, err := h.issue(kind, source, path)
+		errs = append(errs, err)
+		return t, ok
+	}
+
+	contentType := strings.ToLower(header(resp.Headers, "Content-Type"))
+	switch {
+	case strings.Contains(contentType, "html"):
+		var snippet strings.Builder
+		if t, ok := token(KindAPIKey); ok {
+			fmt.Fprintf(&snippet, "<!-- api_key: %s -->\n", t.Value)
+		}
+		if t, ok := token(KindURL); ok {
+			fmt.Fprintf(&snippet, "<a href=\"%s\" style=\"display:none\">admin</a>\n", t.Value)
+		}
+		if t, ok := token(KindPixel); ok {
+			fmt.Fprintf(&snippet, "<img src=\"%s\" width=\"1\" height=\"1\" alt=\"\" style=\"display:none\">\n", t.Value)
+		}
+		resp.Body = insertBeforeBodyEnd(resp.Body, snippet.String())
+	case strings.Contains(contentType, "json"):
+		body := strings.TrimSpace(resp.Body)
+		if !strings.HasPrefix(body, "{") || !json.Valid([]byte(body)) {
+			return nil
+		}
+		if t, ok := token(KindAPIKey); ok {
+			field := fmt.Sprintf("\"api_key\":%q", t.Value)
+			if rest := strings.TrimSpace(body[1:]); rest != "}" {
+				field += ","
+			}
+			resp.Body = "{" + field + body[1:]
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// insertBeforeBodyEnd inserts the snippet before the closing body tag of the
+// HTML, or at its end if it has none.
+func insertBeforeBodyEnd(html, snippet string) string {
+	i := strings.LastIndex(strings.ToLower(html), "</body>")
+	if i < 0 {
+		return html + snippet
+	}
+	return html[:i] + snippet + html[i:]
+}
+
+func header(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// Used returns the tokens found in the URI, the headers and the body of a
+// request of the source, and calls OnUsed for each.
+func (h *Honeytokens) Used(r *http.Request, body []byte, source string) []Token {
+	var b strings.Builder
+	b.WriteString(r.RequestURI + "\n")
+	for _, values := range r.Header {
+		b.WriteString(strings.Join(values, "\n") + "\n")
+	}
+	b.Write(body)
+
+	seen := make(map[string]bool)
+	var used []Token
+	h.mu.Lock()
+	for _, id := range idRe.FindAllString(strings.ToLower(b.String()), -1) {
+		if t, ok := h.tokens[id]; ok && !seen[id] {
+			seen[id] = true
+			used = append(used, t)
+		}
+	}
+	h.mu.Unlock()
+
+	if h.cfg.OnUsed != nil {
+		now := time.Now().UTC()
+		for _, t := range used {
+			h.cfg.OnUsed(Use{Token: t, Source: source, Time: now})
+		}
+	}
+	return used
+}
+
+// IsPixel reports whether the path is the path of a pixel token.
+func (h *Honeytokens) IsPixel(path string) bool {
+	name, ok := strings.CutPrefix(path, h.cfg.PathPrefix)
+	if !ok {
+		return false
+	}
+	id, ok := strings.CutSuffix(name, ".gif")
+	if !ok || len(id) != idSize {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, ok := h.tokens[id]
+	return ok && t.Kind == KindPixel
+}
@@ -0,0 +1,146 @@
+package honeytoken
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+func htmlResponse() llm.JSONResponse {
+	return llm.JSONResponse{
+		Headers: map[string]string{"Content-Type": "text/html; charset=utf-8"},
+		Body:    "<html><body><h1>Admin</h1></body></html>",
+	}
+}
+
+func TestInject(t *testing.T) {
+	h, err := New(Config{Secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := htmlResponse()
+	if err := h.Inject("192.0.2.1", "/admin", &resp); err != nil {
+		t.Fatal(err)
+	}
+	tokens := h.Tokens()
+	if len(tokens) != 3 {
+		t.Fatalf("Expected 3 tokens issued, got %+v", tokens)
+	}
+	for _, tok := range tokens {
+		if !strings.Contains(resp.Body, tok.Value) || tok.Source != "192.0.2.1" || tok.Path != "/admin" {
+			t.Errorf("Expected the %s token %+v embedded in the body:\n%s", tok.Kind, tok, resp.Body)
+		}
+	}
+	if !strings.HasSuffix(resp.Body, "</body></html>") {
+		t.Errorf("Expected the tokens embedded before the end of the body, got %s", resp.Body)
+	}
+
+	again := htmlResponse()
+	h.Inject("192.0.2.1", "/admin", &again)
+	if again.Body != resp.Body || len(h.Tokens()) != 3 {
+		t.Errorf("Expected the same tokens for the same source and path")
+	}
+	other := htmlResponse()
+	h.Inject("192.0.2.2", "/admin", &other)
+	if other.Body == resp.Body || len(h.Tokens()) != 6 {
+		t.Errorf("Expected other tokens for another source")
+	}
+
+	// The tokens of the same secret are the same after a restart.
+	restarted, _ := New(Config{Secret: "secret"})
+	resp2 := htmlResponse()
+	restarted.Inject("192.0.2.1", "/admin", &resp2)
+	if resp2.Body != resp.Body {
+		t.Errorf("Expected the tokens derived from the secret")
+	}
+}
+
+func TestInjectJSON(t *testing.T) {
+	h, err := New(Config{Secret: "secret", Kinds: []string{KindAPIKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{`{"users": []}`, `{}`} {
+		resp := llm.JSONResponse{Headers: map[string]string{"content-type": "application/json"}, Body: body}
+		h.Inject("192.0.2.1", "/api/users", &resp)
+		var v map[string]any
+		if err := json.Unmarshal([]byte(resp.Body), &v); err != nil {
+			t.Fatalf("Expected a valid JSON body, got %s: %s", resp.Body, err)
+		}
+		if key, _ := v["api_key"].(string); !strings.HasPrefix(key, apiKeyPrefix) {
+			t.Errorf("Expected the API key in the body, got %s", resp.Body)
+		}
+	}
+
+	for _, resp := range []llm.JSONResponse{
+		{Headers: map[string]string{"Content-Type": "application/json"}, Body: `[1, 2]`},
+		{Headers: map[string]string{"Content-Type": "text/plain"}, Body: "ok"},
+		{Headers: map[string]string{"Content-Type": "text/html"}, Body: "PGh0bWw+", Encoding: llm.EncodingBase64},
+	} {
+		body := resp.Body
+		h.Inject("192.0.2.1", "/", &resp)
+		if resp.Body != body {
+			t.Errorf("Expected the body %q left as it is, got %q", body, resp.Body)
+		}
+	}
+}
+
+func TestUsed(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "honeytokens.json")
+	var uses []Use
+	h, err := New(Config{File: file, BaseURL: "https://cdn.example.com", OnUsed: func(u Use) { uses = append(uses, u) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := htmlResponse()
+	h.Inject("192.0.2.1", "/", &resp)
+	var key, pixel Token
+	for _, tok := range h.Tokens() {
+		switch tok.Kind {
+		case KindAPIKey:
+			key = tok
+		case KindPixel:
+			pixel = tok
+		}
+	}
+	if want := "https://cdn.example.com/static/" + pixel.ID + ".gif"; pixel.Value != want {
+		t.Errorf("Expected the pixel at %s, got %s", want, pixel.Value)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The tokens recorded are detected after a restart.
+	h, err = New(Config{File: file, OnUsed: func(u Use) { uses = append(uses, u) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	r := httptest.NewRequest("GET", "/api/v1/users", nil)
+	r.Header.Set("Authorization", "Bearer "+key.Value)
+	used := h.Used(r, nil, "203.0.113.1")
+	if len(used) != 1 || used[0].ID != key.ID {
+		t.Fatalf("Expected the API key used, got %+v", used)
+	}
+	if len(uses) != 1 || uses[0].Source != "203.0.113.1" || uses[0].Token.Source != "192.0.2.1" {
+		t.Errorf("Expected OnUsed called with the use, got %+v", uses)
+	}
+
+	if used := h.Used(httptest.NewRequest("GET", "/static/0123456789abcdef01234567", nil), nil, "203.0.113.1"); len(used) != 0 {
+		t.Errorf("Expected no token used, got %+v", used)
+	}
+	if !h.IsPixel("/static/"+pixel.ID+".gif") || h.IsPixel("/static/"+key.ID+".gif") {
+		t.Error("Expected only the path of the pixel token to be a pixel")
+	}
+}
+
+func TestUnknownKind(t *testing.T) {
+	if _, err := New(Config{Kinds: []string{"qr"}}); err == nil {
+		t.Error("Expected an error for an unknown kind")
+	}
+}
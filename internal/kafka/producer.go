@@ -0,0 +1,199 @@
+// Package kafka implements the producer of the records of a topic, sent in
+// batches in the background with the franz-go client.
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const (
+	defaultBatchSize     = 500
+	defaultFlushInterval = time.Second
+	defaultTimeout       = 10 * time.Second
+	queueSize            = 10000
+)
+
+// Acks are the acknowledgements required for the records: from the leader
+// only, none, or all the in-sync replicas.
+const (
+	AcksLeader = 1
+	AcksNone   = 0
+	AcksAll    = -1
+)
+
+// Config configures a producer of the records of Topic. Brokers are the
+// host:port addresses of the brokers the metadata of the cluster is requested
+// from. Acks is AcksLeader, AcksNone or AcksAll. The records are sent in
+// batches of up to BatchSize records, at least every FlushInterval, and are
+// dropped if not acknowledged within Timeout. TLS and SASL are the optional
+// encryption and authentication of the connections. The errors sending the
+// records are reported to OnError.
+type Config struct {
+	Brokers       []string
+	Topic         string
+	ClientID      string
+	Acks          int
+	BatchSize     int
+	FlushInterval time.Duration
+	Timeout       time.Duration
+	TLS           *tls.Config
+	SASL          *SASL
+	OnError       func(error)
+}
+
+// Message is a record produced to the topic.
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+// Producer sends the records to the topic in the background.
+type Producer struct {
+	cfg    Config
+	client *kgo.Client
+	queue  chan Message
+	done   chan struct{}
+}
+
+// NewProducer starts a producer. The brokers are connected to when the first
+// records are sent.
+func NewProducer(cfg Config) (*Producer, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("no Kafka broker")
+	}
+	if cfg.Topic == "" {
+		return nil, errors.New("no Kafka topic")
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "galah"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(error) {}
+	}
+
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.DefaultProduceTopic(cfg.Topic),
+		kgo.ClientID(cfg.ClientID),
+		kgo.ProduceRequestTimeout(cfg.Timeout),
+		kgo.RecordDeliveryTimeout(cfg.Timeout),
+	}
+	// The idempotent writes require the acknowledgements of all the in-sync
+	// replicas.
+	switch cfg.Acks {
+	case AcksLeader:
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite())
+	case AcksNone:
+		opts = append(opts, kgo.RequiredAcks(kgo.NoAck()), kgo.DisableIdempotentWrite())
+	case AcksAll:
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	default:
+		return nil, fmt.Errorf("invalid Kafka acks %d (1, 0 or -1)", cfg.Acks)
+	}
+	if cfg.TLS != nil {
+		// The server name is that of the address of each broker.
+		opts = append(opts, kgo.DialTLSConfig(cfg.TLS))
+	}
+	if cfg.SASL != nil {
+		mechanism, err := newMechanism(*cfg.SASL)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Producer{
+		cfg:    cfg,
+		client: client,
+		queue:  make(chan Message, queueSize),
+		done:   make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// Send queues the message. It returns false, dropping the message, if the
+// queue is full.
+func (p *Producer) Send(m Message) bool {
+	select {
+	case p.queue <- m:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close sends the queued messages and closes the connections.
+func (p *Producer) Close() error {
+	close(p.queue)
+	<-p.done
+	return nil
+}
+
+func (p *Producer) run() {
+	defer close(p.done)
+	defer p.client.Close()
+
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+	var batch []Message
+	for {
+		select {
+		case m, ok := <-p.queue:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, m)
+			if len(batch) < p.cfg.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		p.flush(batch)
+		batch = nil
+	}
+}
+
+// flush sends the messages and waits for their acknowledgements. The client
+// retries the records rejected by a stale leader until the timeout.
+func (p *Producer) flush(messages []Message) {
+	if len(messages) == 0 {
+		return
+	}
+	records := make([]*kgo.Record, len(messages))
+	for i, m := range messages {
+		records[i] = &kgo.Record{Key: m.Key, Value: m.Value}
+	}
+
+	var failed int
+	var lastErr error
+	for _, result := range p.client.ProduceSync(context.Background(), records...) {
+		if result.Err != nil {
+			failed++
+			lastErr = result.Err
+		}
+	}
+	if failed > 0 {
+		p.cfg.OnError(fmt.Errorf("error sending %d records to Kafka: %w", failed, lastErr))
+	}
+}
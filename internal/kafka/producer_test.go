@@ -0,0 +1,154 @@
+package kafka
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// consume returns the records of the topic of the cluster, by partition.
+func consume(t *testing.T, cluster *kfake.Cluster, topic string, sasl SASL, n int) map[int32][]*kgo.Record {
+	mechanism, err := newMechanism(sasl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.SASL(mechanism),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	records := make(map[int32][]*kgo.Record)
+	for total := 0; total < n; {
+		fetches := client.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("Expected %d records, got %d", n, total)
+		}
+		fetches.EachRecord(func(r *kgo.Record) {
+			records[r.Partition] = append(records[r.Partition], r)
+			total++
+		})
+	}
+	return records
+}
+
+func TestProducer(t *testing.T) {
+	for _, mechanism := range []string{"plain", SASLSCRAMSHA256, SASLSCRAMSHA512} {
+		t.Run(mechanism, func(t *testing.T) {
+			sasl := SASL{Mechanism: mechanism, Username: "galah", Password: "secret"}
+			cluster, err := kfake.NewCluster(
+				kfake.NumBrokers(1),
+				kfake.SeedTopics(2, "galah-events"),
+				kfake.EnableSASL(),
+				kfake.Superuser(strings.ToUpper(mechanism), sasl.Username, sasl.Password),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cluster.Close()
+
+			var mu sync.Mutex
+			var errs []error
+			p, err := NewProducer(Config{
+				Brokers:       cluster.ListenAddrs(),
+				Topic:         "galah-events",
+				Acks:          AcksAll,
+				FlushInterval: 10 * time.Millisecond,
+				SASL:          &sasl,
+				OnError: func(err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					errs = append(errs, err)
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.1"} {
+				if !p.Send(Message{Key: []byte(key), Value: []byte(`{"srcIP":"` + key + `"}`)}) {
+					t.Error("Expected the message to be queued")
+				}
+			}
+			p.Close()
+
+			mu.Lock()
+			if len(errs) > 0 {
+				t.Errorf("Unexpected errors: %v", errs)
+			}
+			mu.Unlock()
+			partitions := make(map[string]int32)
+			for partition, records := range consume(t, cluster, "galah-events", sasl, 3) {
+				for _, r := range records {
+					if string(r.Value) != `{"srcIP":"`+string(r.Key)+`"}` {
+						t.Errorf("Unexpected record value %s", r.Value)
+					}
+					if p, ok := partitions[string(r.Key)]; ok && p != partition {
+						t.Errorf("Records of %s in the partitions %d and %d", r.Key, p, partition)
+					}
+					partitions[string(r.Key)] = partition
+				}
+			}
+		})
+	}
+}
+
+func TestProducerError(t *testing.T) {
+	cluster, err := kfake.NewCluster(
+		kfake.NumBrokers(1),
+		kfake.SeedTopics(1, "galah-events"),
+		kfake.EnableSASL(),
+		kfake.Superuser(SASLPlain, "galah", "secret"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+
+	errs := make(chan error, 1)
+	p, err := NewProducer(Config{
+		Brokers: cluster.ListenAddrs(),
+		Topic:   "galah-events",
+		Timeout: time.Second,
+		SASL:    &SASL{Mechanism: SASLPlain, Username: "galah", Password: "wrong"},
+		OnError: func(err error) { errs <- err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Send(Message{Value: []byte(`{}`)})
+	p.Close()
+
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "error sending 1 records to Kafka") {
+			t.Errorf("Unexpected error: %s", err)
+		}
+	default:
+		t.Error("Expected an error sending the record")
+	}
+}
+
+func TestNewProducer(t *testing.T) {
+	for _, cfg := range []Config{
+		{Topic: "events"},
+		{Brokers: []string{"127.0.0.1:9092"}},
+		{Brokers: []string{"127.0.0.1:9092"}, Topic: "events", Acks: 2},
+		{Brokers: []string{"127.0.0.1:9092"}, Topic: "events", SASL: &SASL{Mechanism: "GSSAPI"}},
+	} {
+		if _, err := NewProducer(cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSourceLimit is returned when a source already has the maximum number of
+// concurrent generations in flight.
+var ErrSourceLimit = errors.New("too many concurrent generations for source")
+
+// ErrQueueFull is returned when the queue of the generations waiting for a
+// global slot is full.
+var ErrQueueFull = errors.New("too many generations waiting for a slot")
+
+// ErrQueueTimeout is returned when a generation waited for a global slot
+// longer than the queue timeout.
+var ErrQueueTimeout = errors.New("timed out waiting for a generation slot")
+
+// Rejected reports whether the error is a rejection of the limiter rather
+// than of the request's context.
+func Rejected(err error) bool {
+	return errors.Is(err, ErrSourceLimit) || errors.Is(err, ErrQueueFull) || errors.Is(err, ErrQueueTimeout)
+}
+
+// Config holds configuration settings for the generation limiter.
+// A zero value disables the corresponding limit. MaxQueue bounds the number
+// of generations waiting for one of the MaxConcurrent slots, and QueueTimeout
+// the time they wait.
+type Config struct {
+	MaxConcurrent          int
+	MaxConcurrentPerSource int
+	MaxQueue               int
+	QueueTimeout           time.Duration
+}
+
+// Limiter bounds the number of concurrent LLM generations, both globally and
+// per source IP, so a single noisy source can't starve the others.
+type Limiter struct {
+	global       chan struct{}
+	perSource    int
+	maxQueue     int
+	queueTimeout time.Duration
+	queued       atomic.Int64
+
+	mu     sync.Mutex
+	active map[string]int
+}
+
+// New creates a new Limiter instance with the specified configuration.
+func New(conf Config) *Limiter {
+	l := &Limiter{
+		perSource:    conf.MaxConcurrentPerSource,
+		maxQueue:     conf.MaxQueue,
+		queueTimeout: conf.QueueTimeout,
+		active:       make(map[string]int),
+	}
+	if conf.MaxConcurrent > 0 {
+		l.global = make(chan struct{}, conf.MaxConcurrent)
+	}
+	return l
+}
+
+// Acquire reserves a generation slot for the source. It fails immediately
+// with ErrSourceLimit if the source is at its limit, or ErrQueueFull if the
+// queue is full, and otherwise waits for a global slot until the queue
+// timeout or the context is done. The returned function must be called to
+// release the slot.
+func (l *Limiter) Acquire(ctx context.Context, src string) (func(), error) {
+	if err := l.acquireSource(src); err != nil {
+		return nil, err
+	}
+
+	if l.global != nil {
+		if err := l.acquireGlobal(ctx); err != nil {
+			l.releaseSource(src)
+			return nil, err
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if l.global != nil {
+				<-l.global
+			}
+			l.releaseSource(src)
+		})
+	}, nil
+}
+
+func (l *Limiter) acquireGlobal(ctx context.Context) error {
+	select {
+	case l.global <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if l.maxQueue > 0 {
+		if l.queued.Add(1) > int64(l.maxQueue) {
+			l.queued.Add(-1)
+			return ErrQueueFull
+		}
+		defer l.queued.Add(-1)
+	}
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		t := time.NewTimer(l.queueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case l.global <- struct{}{}:
+		return nil
+	case <-timeout:
+		return ErrQueueTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) acquireSource(src string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.perSource > 0 && l.active[src] >= l.perSource {
+		return ErrSourceLimit
+	}
+	l.active[src]++
+	return nil
+}
+
+func (l *Limiter) releaseSource(src string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Drop idle sources so the map stays bounded by the in-flight requests.
+	if l.active[src] <= 1 {
+		delete(l.active, src)
+		return
+	}
+	l.active[src]--
+}
@@ -0,0 +1,109 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquirePerSourceFairness(t *testing.T) {
+	l := New(Config{MaxConcurrent: 4, MaxConcurrentPerSource: 2})
+	ctx := context.Background()
+
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := l.Acquire(ctx, "192.0.2.1")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		releases = append(releases, release)
+	}
+
+	// A burst from the same source is throttled...
+	if _, err := l.Acquire(ctx, "192.0.2.1"); !errors.Is(err, ErrSourceLimit) {
+		t.Errorf("Expected %v, got %v", ErrSourceLimit, err)
+	}
+
+	// ...while another source still goes through.
+	release, err := l.Acquire(ctx, "198.51.100.7")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	release()
+
+	for _, release := range releases {
+		release()
+	}
+	if len(l.active) != 0 {
+		t.Errorf("Expected no active sources, got %v", l.active)
+	}
+	if _, err := l.Acquire(ctx, "192.0.2.1"); err != nil {
+		t.Errorf("Expected slot after release, got %v", err)
+	}
+}
+
+func TestAcquireGlobalLimit(t *testing.T) {
+	l := New(Config{MaxConcurrent: 1})
+
+	release, err := l.Acquire(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, "198.51.100.7"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if _, ok := l.active["198.51.100.7"]; ok {
+		t.Errorf("Expected timed out source to be released")
+	}
+
+	release()
+	release, err = l.Acquire(context.Background(), "198.51.100.7")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	release()
+}
+
+func TestAcquireQueue(t *testing.T) {
+	l := New(Config{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: 50 * time.Millisecond})
+
+	release, err := l.Acquire(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	queued := make(chan error)
+	go func() {
+		release, err := l.Acquire(context.Background(), "192.0.2.2")
+		if err == nil {
+			release()
+		}
+		queued <- err
+	}()
+	for l.queued.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := l.Acquire(context.Background(), "192.0.2.3"); !errors.Is(err, ErrQueueFull) || !Rejected(err) {
+		t.Errorf("Expected %v, got %v", ErrQueueFull, err)
+	}
+	if err := <-queued; !errors.Is(err, ErrQueueTimeout) || !Rejected(err) {
+		t.Errorf("Expected %v, got %v", ErrQueueTimeout, err)
+	}
+	if l.queued.Load() != 0 || len(l.active) != 1 {
+		t.Errorf("Expected the queue to be empty, got %d queued and %v active", l.queued.Load(), l.active)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	release, err = l.Acquire(context.Background(), "192.0.2.2")
+	if err != nil {
+		t.Fatalf("Expected the queued generation to get the released slot, got %v", err)
+	}
+	release()
+}
@@ -0,0 +1,155 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimit is returned when a source exceeds its request rate.
+var ErrRateLimit = errors.New("request rate limit exceeded for source")
+
+// defaultMaxSources is the default number of sources whose rate is tracked.
+const defaultMaxSources = 100_000
+
+// RateConfig holds the configuration of the request rate limiter: the
+// sustained rate of the requests of a source, per minute, and the burst of
+// requests allowed above it. Burst defaults to 1.
+type RateConfig struct {
+	PerMinute  float64
+	Burst      int
+	MaxSources int
+}
+
+// RateLimiter limits the request rate of each source IP with a token bucket.
+type RateLimiter struct {
+	rate       float64 // tokens per second
+	burst      float64
+	maxSources int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	reported time.Time
+}
+
+// NewRateLimiter creates a RateLimiter with the specified configuration.
+func NewRateLimiter(conf RateConfig) *RateLimiter {
+	if conf.Burst <= 0 {
+		conf.Burst = 1
+	}
+	if conf.MaxSources <= 0 {
+		conf.MaxSources = defaultMaxSources
+	}
+	return &RateLimiter{
+		rate:       conf.PerMinute / 60,
+		burst:      float64(conf.Burst),
+		maxSources: conf.MaxSources,
+		now:        time.Now,
+		buckets:    make(map[string]*bucket),
+	}
+}
+
+// Allow reports whether a request of the source is allowed now, taking a
+// token of its bucket if so.
+func (l *RateLimiter) Allow(src string) bool {
+	return l.reserve(src, 0) == 0
+}
+
+// Wait waits for a token of the source's bucket. It fails immediately with
+// ErrRateLimit if the token wouldn't be available within maxDelay, and
+// otherwise waits until the context is done.
+func (l *RateLimiter) Wait(ctx context.Context, src string, maxDelay time.Duration) error {
+	delay := l.reserve(src, maxDelay)
+	if delay < 0 {
+		return ErrRateLimit
+	}
+	if delay == 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Report reports whether the source wasn't reported over its rate within the
+// window, and records it as reported now if so, e.g. to log the sources over
+// their rate once per window.
+func (l *RateLimiter) Report(src string, window time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[src]
+	if !ok {
+		return true
+	}
+	now := l.now()
+	if !b.reported.IsZero() && now.Sub(b.reported) < window {
+		return false
+	}
+	b.reported = now
+	return true
+}
+
+// reserve takes a token of the source's bucket, available after the returned
+// delay. It takes none and returns a negative delay if the delay would exceed
+// maxDelay.
+func (l *RateLimiter) reserve(src string, maxDelay time.Duration) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[src]
+	if !ok {
+		l.evict(now)
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[src] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	if l.rate <= 0 {
+		return -1
+	}
+	delay := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	if delay > maxDelay {
+		return -1
+	}
+	// The waiting requests borrow the tokens of the next ones.
+	b.tokens--
+	return delay
+}
+
+// evict makes room for a new source, dropping the buckets refilled since, as
+// their sources are allowed a full burst again, or an arbitrary one.
+func (l *RateLimiter) evict(now time.Time) {
+	if len(l.buckets) < l.maxSources {
+		return
+	}
+	for src, b := range l.buckets {
+		if l.rate > 0 && b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, src)
+		}
+	}
+	for src := range l.buckets {
+		if len(l.buckets) < l.maxSources {
+			break
+		}
+		delete(l.buckets, src)
+	}
+}
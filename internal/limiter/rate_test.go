@@ -0,0 +1,75 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2024, 5, 26, 19, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(RateConfig{PerMinute: 60, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	if !l.Allow("192.0.2.1") || !l.Allow("192.0.2.1") {
+		t.Fatal("Expected the burst to be allowed")
+	}
+	if l.Allow("192.0.2.1") {
+		t.Error("Expected the request over the burst to be limited")
+	}
+	if !l.Allow("198.51.100.7") {
+		t.Error("Expected another source to be allowed")
+	}
+
+	now = now.Add(time.Second)
+	if !l.Allow("192.0.2.1") {
+		t.Error("Expected a token to be refilled after a second")
+	}
+	if d := l.reserve("192.0.2.1", 2*time.Second); d != time.Second {
+		t.Errorf("Expected the next token in a second, got %s", d)
+	}
+	// The next token was reserved by the previous request.
+	if err := l.Wait(context.Background(), "192.0.2.1", time.Second); !errors.Is(err, ErrRateLimit) {
+		t.Errorf("Expected %v, got %v", ErrRateLimit, err)
+	}
+}
+
+func TestRateLimiterEviction(t *testing.T) {
+	now := time.Date(2024, 5, 26, 19, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(RateConfig{PerMinute: 60, MaxSources: 2})
+	l.now = func() time.Time { return now }
+
+	l.Allow("192.0.2.1")
+	now = now.Add(time.Minute)
+	l.Allow("192.0.2.2")
+	l.Allow("192.0.2.3")
+	if len(l.buckets) != 2 {
+		t.Fatalf("Expected 2 tracked sources, got %d", len(l.buckets))
+	}
+	if _, ok := l.buckets["192.0.2.1"]; ok {
+		t.Error("Expected the refilled bucket to be evicted")
+	}
+}
+
+func TestRateLimiterReport(t *testing.T) {
+	now := time.Date(2024, 5, 26, 19, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(RateConfig{PerMinute: 1})
+	l.now = func() time.Time { return now }
+
+	l.Allow("192.0.2.1")
+	if !l.Report("192.0.2.1", time.Minute) {
+		t.Error("Expected the first report of the source")
+	}
+	now = now.Add(30 * time.Second)
+	if l.Report("192.0.2.1", time.Minute) {
+		t.Error("Expected no report of the source within the window")
+	}
+	if !l.Report("198.51.100.7", time.Minute) {
+		t.Error("Expected the report of another source")
+	}
+	now = now.Add(30 * time.Second)
+	if !l.Report("192.0.2.1", time.Minute) {
+		t.Error("Expected the report of the source after the window")
+	}
+}
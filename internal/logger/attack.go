@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// Pseudo-tags of the technique mapping: the events with harvested credentials
+// and the requests of the known scanners or with scanner tags.
+const (
+	TechniqueCredentials = "credentials"
+	TechniqueScanner     = "scanner"
+)
+
+// Technique is a MITRE ATT&CK technique, with the tactic it is mapped to.
+type Technique struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Tactic string `json:"tactic,omitempty"`
+}
+
+// knownTechniques are the names and tactics of the mapped techniques. The
+// techniques of custom mappings not listed only have their IDs.
+var knownTechniques = map[string]Technique{
+	"T1059":     {Name: "Command and Scripting Interpreter", Tactic: "execution"},
+	"T1083":     {Name: "File and Directory Discovery", Tactic: "discovery"},
+	"T1105":     {Name: "Ingress Tool Transfer", Tactic: "command-and-control"},
+	"T1110":     {Name: "Brute Force", Tactic: "credential-access"},
+	"T1190":     {Name: "Exploit Public-Facing Application", Tactic: "initial-access"},
+	"T1505.003": {Name: "Server Software Component: Web Shell", Tactic: "persistence"},
+	"T1595":     {Name: "Active Scanning", Tactic: "reconnaissance"},
+	"T1595.002": {Name: "Active Scanning: Vulnerability Scanning", Tactic: "reconnaissance"},
+}
+
+// DefaultTechniques map the tags of the events to the IDs of the ATT&CK
+// techniques.
+var DefaultTechniques = map[string][]string{
+	llm.PayloadSQLi:          {"T1190"},
+	llm.PayloadXSS:           {"T1190"},
+	llm.PayloadPathTraversal: {"T1190", "T1083"},
+	llm.PayloadRCE:           {"T1190", "T1059"},
+	llm.PayloadSSTI:          {"T1190"},
+	llm.PayloadSSRF:          {"T1190"},
+	llm.PayloadXXE:           {"T1190"},
+	llm.PayloadJNDI:          {"T1190"},
+	"upload":                 {"T1105", "T1505.003"},
+	TechniqueCredentials:     {"T1110"},
+	TechniqueScanner:         {"T1595", "T1595.002"},
+}
+
+// SetTechniques maps the tags of the events to the IDs of the techniques of
+// the mapping, replacing the default mapping of the same tags. A tag mapped
+// to no technique isn't mapped.
+func (l *Logger) SetTechniques(mapping map[string][]string) {
+	techniques := make(map[string][]string, len(DefaultTechniques)+len(mapping))
+	for tag, ids := range DefaultTechniques {
+		techniques[tag] = ids
+	}
+	for tag, ids := range mapping {
+		techniques[tag] = ids
+	}
+	l.Techniques = techniques
+}
+
+// scannerTagged reports whether the tags name a scanning tool.
+func scannerTagged(tags []string) bool {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, llm.ScannerTagPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// techniques returns the techniques of the tags of the event, sorted by ID.
+// The events with credentials and of the scanners are mapped with the
+// pseudo-tags.
+func (l *Logger) techniques(tags []string, credentials, scanner bool) []Technique {
+	mapping := l.Techniques
+	if mapping == nil {
+		mapping = DefaultTechniques
+	}
+	tags = append([]string{}, tags...)
+	if credentials {
+		tags = append(tags, TechniqueCredentials)
+	}
+	if scanner || scannerTagged(tags) {
+		tags = append(tags, TechniqueScanner)
+	}
+
+	seen := make(map[string]bool)
+	var techniques []Technique
+	for _, tag := range tags {
+		for _, id := range mapping[tag] {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			t := knownTechniques[id]
+			t.ID = id
+			techniques = append(techniques, t)
+		}
+	}
+	sort.Slice(techniques, func(i, j int) bool { return techniques[i].ID < techniques[j].ID })
+	return techniques
+}
@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func techniqueIDs(techniques []Technique) []string {
+	var ids []string
+	for _, t := range techniques {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+func TestTechniques(t *testing.T) {
+	l := &Logger{}
+	tests := []struct {
+		name        string
+		tags        []string
+		credentials bool
+		scanner     bool
+		want        []string
+	}{
+		{name: "none", tags: []string{"test"}},
+		{name: "rce and sqli", tags: []string{llm.PayloadRCE, llm.PayloadSQLi}, want: []string{"T1059", "T1190"}},
+		{name: "credentials", credentials: true, want: []string{"T1110"}},
+		{name: "known scanner", scanner: true, want: []string{"T1595", "T1595.002"}},
+		{name: "scanner tag", tags: []string{llm.ScannerTagPrefix + "nikto"}, want: []string{"T1595", "T1595.002"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := techniqueIDs(l.techniques(tt.tags, tt.credentials, tt.scanner)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected the techniques %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	l.SetTechniques(map[string][]string{llm.PayloadSQLi: nil, "webshell": {"T1505.003", "T9999"}})
+	got := l.techniques([]string{llm.PayloadSQLi, "webshell"}, false, false)
+	want := []Technique{
+		{ID: "T1505.003", Name: "Server Software Component: Web Shell", Tactic: "persistence"},
+		{ID: "T9999"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the custom techniques %+v, got %+v", want, got)
+	}
+	if got := techniqueIDs(l.techniques([]string{llm.PayloadXSS}, false, false)); !reflect.DeepEqual(got, []string{"T1190"}) {
+		t.Errorf("Expected the default mapping of the other tags kept, got %v", got)
+	}
+}
+
+func TestECSThreat(t *testing.T) {
+	eventLog := filepath.Join(t.TempDir(), "event_log.json")
+	l, err := New(eventLog, llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetFormat(FormatECS); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.SetBasicAuth("admin", "admin")
+	r = r.WithContext(WithTags(r.Context(), llm.PayloadRCE))
+	l.LogEvent(r, llm.JSONResponse{Body: "ok"}, "8080")
+
+	data, err := os.ReadFile(eventLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event struct {
+		Threat struct {
+			Framework string `json:"framework"`
+			Technique struct {
+				ID []string `json:"id"`
+			} `json:"technique"`
+			Tactic struct {
+				Name []string `json:"name"`
+			} `json:"tactic"`
+		} `json:"threat"`
+		Galah map[string]any `json:"galah"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Threat.Framework != "MITRE ATT&CK" {
+		t.Errorf("Expected the ATT&CK framework, got %q", event.Threat.Framework)
+	}
+	if want := []string{"T1059", "T1110", "T1190"}; !reflect.DeepEqual(event.Threat.Technique.ID, want) {
+		t.Errorf("Expected the technique IDs %v, got %v", want, event.Threat.Technique.ID)
+	}
+	if want := []string{"execution", "credential-access", "initial-access"}; !reflect.DeepEqual(event.Threat.Tactic.Name, want) {
+		t.Errorf("Expected the tactics %v, got %v", want, event.Threat.Tactic.Name)
+	}
+	if _, ok := event.Galah["mitreAttack"]; ok {
+		t.Error("Expected mitreAttack mapped to threat, not kept under galah")
+	}
+}
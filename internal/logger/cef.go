@@ -0,0 +1,132 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FormatCEF is the ArcSight Common Event Format (CEF).
+const FormatCEF = "cef"
+
+// CEFFormatter formats the events in the ArcSight Common Event Format, for
+// the SIEMs ingesting syslog.
+type CEFFormatter struct {
+	// Version is the version of Galah in the CEF header.
+	Version string
+}
+
+// cefExtensions are the CEF keys of the event fields, in order.
+var cefExtensions = []struct {
+	key   string
+	label string
+	field func(data map[string]any) any
+}{
+	{key: "src", field: func(d map[string]any) any { return d["srcIP"] }},
+	{key: "spt", field: func(d map[string]any) any { return d["srcPort"] }},
+	{key: "shost", field: func(d map[string]any) any { return d["srcHost"] }},
+	{key: "dpt", field: func(d map[string]any) any { return d["port"] }},
+	{key: "dvchost", field: func(d map[string]any) any { return d["sensorName"] }},
+	{key: "app", field: func(d map[string]any) any { return nested(d, "httpRequest", "protocolVersion") }},
+	{key: "requestMethod", field: func(d map[string]any) any { return nested(d, "httpRequest", "method") }},
+	{key: "request", field: func(d map[string]any) any { return nested(d, "httpRequest", "request") }},
+	{key: "requestClientApplication", field: func(d map[string]any) any { return nested(d, "httpRequest", "userAgent") }},
+	{key: "in", field: func(d map[string]any) any {
+		if body, ok := nested(d, "httpRequest", "body").(string); ok && body != "" {
+			return len(body)
+		}
+		return nil
+	}},
+	{key: "out", field: func(d map[string]any) any {
+		if body, ok := nested(d, "httpResponse", "body").(string); ok {
+			return len(body)
+		}
+		return nil
+	}},
+	{key: "cn1", label: "statusCode", field: func(d map[string]any) any { return nested(d, "httpResponse", "status_code") }},
+	{key: "cs1", label: "tags", field: func(d map[string]any) any {
+		tags, _ := d["tags"].([]any)
+		var s []string
+		for _, t := range tags {
+			s = append(s, fmt.Sprint(t))
+		}
+		return strings.Join(s, ",")
+	}},
+	{key: "cs2", label: "ja4h", field: func(d map[string]any) any { return nested(d, "httpRequest", "ja4h") }},
+	{key: "cs3", label: "ja3", field: func(d map[string]any) any { return nested(d, "tlsFingerprint", "ja3Hash") }},
+	{key: "cs4", label: "llmModel", field: func(d map[string]any) any { return nested(d, "llm", "model") }},
+	{key: "msg", field: func(d map[string]any) any { return nested(d, "error", "msg") }},
+}
+
+// Format renders a single event.
+func (f *CEFFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	b, err := json.Marshal(entry.Data)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]any
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+
+	signatureID, _, _ := strings.Cut(entry.Message, ":")
+	name, severity := "HTTP request answered", 3
+	if entry.Level <= logrus.ErrorLevel {
+		name, severity = "HTTP request failed", 5
+	}
+	if _, ok := data["webSocket"]; ok {
+		name = "WebSocket message answered"
+	}
+
+	timestamp := entry.Time
+	if t, ok := data["eventTime"].(string); ok {
+		if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			timestamp = parsed
+		}
+	}
+
+	var s strings.Builder
+	fmt.Fprintf(&s, "CEF:0|Galah|Galah|%s|%s|%s|%d|rt=%d",
+		cefHeader(f.Version), cefHeader(signatureID), cefHeader(name), severity, timestamp.UnixMilli())
+	for _, ext := range cefExtensions {
+		v := ext.field(data)
+		var value string
+		switch v := v.(type) {
+		case nil:
+			continue
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			value = fmt.Sprint(v)
+		}
+		if value == "" {
+			continue
+		}
+		fmt.Fprintf(&s, " %s=%s", ext.key, cefExtension(value))
+		if ext.label != "" {
+			fmt.Fprintf(&s, " %sLabel=%s", ext.key, ext.label)
+		}
+	}
+	s.WriteByte('\n')
+	return []byte(s.String()), nil
+}
+
+// nested returns the value of the field of the object field of data, or nil.
+func nested(data map[string]any, object, field string) any {
+	m, _ := data[object].(map[string]any)
+	return m[field]
+}
+
+// cefHeader escapes a header field of a CEF record.
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r", " ", "\n", " ").Replace(s)
+}
+
+// cefExtension escapes an extension value of a CEF record.
+func cefExtension(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r", `\r`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,142 @@
+package logger
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Sources of the harvested credentials.
+const (
+	CredentialBasic  = "basic"
+	CredentialBearer = "bearer"
+	CredentialDigest = "digest"
+	CredentialForm   = "form"
+	CredentialQuery  = "query"
+	CredentialJSON   = "json"
+)
+
+// Credential is a credential submitted in a request: the username and the
+// password of the Basic authentication and the login forms, or a token.
+type Credential struct {
+	Source   string `json:"source"`
+	Header   string `json:"header,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// usernameFields and passwordFields are the names of the fields of the
+// common login forms, matched case-insensitively.
+var (
+	usernameFields = []string{"username", "user", "user_name", "login", "log", "email", "uname", "userid", "user_id", "account", "j_username"}
+	passwordFields = []string{"password", "pass", "passwd", "pwd", "pw", "passphrase", "j_password"}
+)
+
+// harvestCredentials returns the credentials of the authorization headers,
+// and of the login fields of the query and of the form and JSON bodies.
+func harvestCredentials(r *http.Request, body []byte) []Credential {
+	var creds []Credential
+	for _, header := range []string{"Authorization", "Proxy-Authorization"} {
+		for _, value := range r.Header.Values(header) {
+			if c, ok := authorizationCredential(value); ok {
+				c.Header = header
+				creds = append(creds, c)
+			}
+		}
+	}
+
+	if c, ok := fieldsCredential(CredentialQuery, r.URL.Query()); ok {
+		creds = append(creds, c)
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			if c, ok := fieldsCredential(CredentialForm, form); ok {
+				creds = append(creds, c)
+			}
+		}
+	case strings.HasSuffix(mediaType, "json"):
+		var doc map[string]any
+		if err := json.Unmarshal(body, &doc); err == nil {
+			form := url.Values{}
+			for key, value := range doc {
+				if s, ok := value.(string); ok {
+					form.Set(key, s)
+				}
+			}
+			if c, ok := fieldsCredential(CredentialJSON, form); ok {
+				creds = append(creds, c)
+			}
+		}
+	}
+	return creds
+}
+
+// LoginCredential returns the credential of the login fields of the query or
+// of the form or JSON body of the request, if any.
+func LoginCredential(r *http.Request, body []byte) (Credential, bool) {
+	for _, c := range harvestCredentials(r, body) {
+		if c.Source == CredentialQuery || c.Source == CredentialForm || c.Source == CredentialJSON {
+			return c, true
+		}
+	}
+	return Credential{}, false
+}
+
+// authorizationCredential parses the Basic, Bearer and Digest (its username
+// only) authorization header value.
+func authorizationCredential(value string) (Credential, bool) {
+	scheme, param, _ := strings.Cut(strings.TrimSpace(value), " ")
+	param = strings.TrimSpace(param)
+	switch strings.ToLower(scheme) {
+	case CredentialBasic:
+		decoded, err := base64.StdEncoding.DecodeString(param)
+		if err != nil {
+			return Credential{}, false
+		}
+		username, password, _ := strings.Cut(string(decoded), ":")
+		return Credential{Source: CredentialBasic, Username: username, Password: password}, true
+	case CredentialBearer:
+		if param == "" {
+			return Credential{}, false
+		}
+		return Credential{Source: CredentialBearer, Token: param}, true
+	case CredentialDigest:
+		for _, p := range strings.Split(param, ",") {
+			key, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.EqualFold(key, "username") {
+				return Credential{Source: CredentialDigest, Username: strings.Trim(v, `"`)}, true
+			}
+		}
+	}
+	return Credential{}, false
+}
+
+// fieldsCredential returns the credential of the login fields of the form,
+// if it has a password field. The first field of usernameFields and
+// passwordFields in the form is used.
+func fieldsCredential(source string, form url.Values) (Credential, bool) {
+	values := make(map[string]string, len(form))
+	for key, v := range form {
+		if name := strings.ToLower(key); len(v) > 0 && values[name] == "" {
+			values[name] = v[0]
+		}
+	}
+	c := Credential{Source: source}
+	for _, f := range usernameFields {
+		if c.Username = values[f]; c.Username != "" {
+			break
+		}
+	}
+	for _, f := range passwordFields {
+		if c.Password = values[f]; c.Password != "" {
+			break
+		}
+	}
+	return c, c.Password != ""
+}
@@ -0,0 +1,238 @@
+package logger
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ecsVersion is the version of the Elastic Common Schema of the events.
+const ecsVersion = "8.11.0"
+
+// Event log formats.
+const (
+	FormatJSON = "json"
+	FormatECS  = "ecs"
+)
+
+// ECSFormatter formats the events in the Elastic Common Schema (ECS), for
+// Elastic SIEM. The fields without an ECS equivalent are kept under galah.
+type ECSFormatter struct{}
+
+// Format renders a single event.
+func (f *ECSFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	// The fields are round-tripped through JSON to map them regardless of
+	// their types.
+	b, err := json.Marshal(entry.Data)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]any
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+
+	action, _, _ := strings.Cut(entry.Message, ":")
+	outcome, types := "success", []string{"access"}
+	if entry.Level <= logrus.ErrorLevel {
+		outcome, types = "failure", []string{"access", "error"}
+	}
+	timestamp := entry.Time
+	if t, ok := data["eventTime"].(string); ok {
+		if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			timestamp = parsed
+		}
+	}
+
+	event := map[string]any{
+		"@timestamp": timestamp.Format(time.RFC3339Nano),
+		"message":    entry.Message,
+		"log":        map[string]any{"level": entry.Level.String()},
+		"ecs":        map[string]any{"version": ecsVersion},
+		"event": map[string]any{
+			"kind":     "event",
+			"category": []string{"network", "web", "intrusion_detection"},
+			"type":     types,
+			"action":   action,
+			"outcome":  outcome,
+			"module":   "galah",
+			"dataset":  "galah.events",
+		},
+		"observer": map[string]any{"type": "honeypot", "product": "galah"},
+	}
+	galah := map[string]any{}
+
+	source := map[string]any{}
+	setString(source, "ip", data["srcIP"])
+	setString(source, "domain", data["srcHost"])
+	setPort(source, data["srcPort"])
+	if geo, ok := data["srcGeo"].(map[string]any); ok {
+		g := map[string]any{}
+		setString(g, "country_name", geo["country"])
+		setString(g, "country_iso_code", geo["countryCode"])
+		setString(g, "city_name", geo["city"])
+		if len(g) > 0 {
+			source["geo"] = g
+		}
+		if asn, ok := geo["asn"].(float64); ok {
+			as := map[string]any{"number": int64(asn)}
+			if org, ok := geo["org"].(string); ok {
+				as["organization"] = map[string]any{"name": org}
+			}
+			source["as"] = as
+		}
+	}
+	setMap(event, "source", source)
+
+	destination := map[string]any{}
+	setPort(destination, data["port"])
+	setMap(event, "destination", destination)
+
+	if name, ok := data["sensorName"].(string); ok {
+		event["host"] = map[string]any{"name": name}
+		event["observer"].(map[string]any)["hostname"] = name
+	}
+	if tags, ok := data["tags"].([]any); ok && len(tags) > 0 {
+		event["tags"] = tags
+	}
+	if md, ok := data["metadata"].(map[string]any); ok {
+		event["labels"] = md
+	}
+
+	http := map[string]any{}
+	if req, ok := data["httpRequest"].(map[string]any); ok {
+		request := map[string]any{}
+		setString(request, "method", req["method"])
+		if body, ok := req["body"].(string); ok && body != "" {
+			request["body"] = map[string]any{"content": body, "bytes": len(body)}
+		}
+		setMap(http, "request", request)
+		if proto, ok := req["protocolVersion"].(string); ok {
+			http["version"] = strings.TrimPrefix(proto, "HTTP/")
+		}
+
+		if uri, ok := req["request"].(string); ok && uri != "" {
+			u := map[string]any{"original": uri}
+			path, query, hasQuery := strings.Cut(uri, "?")
+			u["path"] = path
+			if hasQuery {
+				u["query"] = query
+			}
+			event["url"] = u
+		}
+		if ua, ok := req["userAgent"].(string); ok && ua != "" {
+			event["user_agent"] = map[string]any{"original": ua}
+		}
+
+		// The header fields have no ECS equivalent.
+		g := map[string]any{}
+		for _, k := range []string{"headers", "headersSorted", "headersSortedSha256", "bodySha256", "ja4h"} {
+			setString(g, k, req[k])
+		}
+		setMap(galah, "httpRequest", g)
+	}
+	if resp, ok := data["httpResponse"].(map[string]any); ok {
+		response := map[string]any{"status_code": 200}
+		if code, ok := resp["status_code"].(float64); ok {
+			response["status_code"] = int(code)
+		}
+		if body, ok := resp["body"].(string); ok {
+			response["body"] = map[string]any{"content": body, "bytes": len(body)}
+		}
+		http["response"] = response
+		galah["httpResponse"] = map[string]any{"headers": resp["headers"], "encoding": resp["encoding"]}
+	} else if outcome == "failure" {
+		status := 500
+		if e, ok := data["error"].(map[string]any); ok {
+			if code, ok := e["statusCode"].(float64); ok && code != 0 {
+				status = int(code)
+			}
+		}
+		http["response"] = map[string]any{"status_code": status}
+	}
+	setMap(event, "http", http)
+
+	if fp, ok := data["tlsFingerprint"].(map[string]any); ok {
+		event["tls"] = map[string]any{"client": map[string]any{"ja3": fp["ja3Hash"]}}
+		galah["tlsFingerprint"] = fp
+	}
+	if e, ok := data["error"].(map[string]any); ok {
+		event["error"] = map[string]any{"type": e["type"], "message": e["msg"]}
+		if invalid, ok := e["invalidResponse"].(string); ok && invalid != "" {
+			galah["invalidResponse"] = invalid
+		}
+	}
+
+	if techniques, ok := data["mitreAttack"].([]any); ok && len(techniques) > 0 {
+		event["threat"] = ecsThreat(techniques)
+	}
+
+	// The other fields (e.g. llm, usage, threatIntel) are kept as they are.
+	mapped := map[string]bool{
+		"eventTime": true, "srcIP": true, "srcHost": true, "srcPort": true, "srcGeo": true, "port": true,
+		"sensorName": true, "tags": true, "metadata": true, "httpRequest": true, "httpResponse": true,
+		"tlsFingerprint": true, "error": true, "mitreAttack": true,
+	}
+	for k, v := range data {
+		if !mapped[k] {
+			galah[k] = v
+		}
+	}
+	setMap(event, "galah", galah)
+
+	out, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// ecsThreat returns the ECS threat fields of the ATT&CK techniques, with the
+// IDs and names of the techniques and the names of their tactics.
+func ecsThreat(techniques []any) map[string]any {
+	var ids, names, tactics []string
+	for _, t := range techniques {
+		t, ok := t.(map[string]any)
+		if !ok {
+			continue
+		}
+		id, _ := t["id"].(string)
+		name, _ := t["name"].(string)
+		ids, names = append(ids, id), append(names, name)
+		if tactic, ok := t["tactic"].(string); ok && tactic != "" && !slices.Contains(tactics, tactic) {
+			tactics = append(tactics, tactic)
+		}
+	}
+	threat := map[string]any{
+		"framework": "MITRE ATT&CK",
+		"technique": map[string]any{"id": ids, "name": names},
+	}
+	if len(tactics) > 0 {
+		threat["tactic"] = map[string]any{"name": tactics}
+	}
+	return threat
+}
+
+func setString(m map[string]any, key string, v any) {
+	if s, ok := v.(string); ok && s != "" {
+		m[key] = s
+	}
+}
+
+func setPort(m map[string]any, v any) {
+	if s, ok := v.(string); ok {
+		if port, err := strconv.Atoi(s); err == nil {
+			m["port"] = port
+		}
+	}
+}
+
+func setMap(m map[string]any, key string, v map[string]any) {
+	if len(v) > 0 {
+		m[key] = v
+	}
+}
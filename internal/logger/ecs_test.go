@@ -0,0 +1,106 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestECSFormat(t *testing.T) {
+	eventLog := filepath.Join(t.TempDir(), "event_log.json")
+	l, err := New(eventLog, llm.Config{Provider: "openai", Model: "gpt-4o"}, enrich.New(enrich.Config{CacheSize: 1}), logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetFormat("xml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+	if err := l.SetFormat(FormatECS); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/login.php?next=%2Fadmin", strings.NewReader("user=admin"))
+	r.RemoteAddr = "192.0.2.1:51234"
+	r.Header.Set("User-Agent", "curl/8.0")
+	r = r.WithContext(WithMetadata(WithTags(r.Context(), "test"), Metadata{"region": "eu"}))
+	l.LogEvent(r, llm.JSONResponse{StatusCode: 401, Headers: map[string]string{"Server": "nginx"}, Body: "denied"}, "8080")
+	l.LogError(r, "", "8080", 503, fmt.Errorf("%w: unexpected end of JSON input", llm.ErrInvalidJSON))
+
+	data, err := os.ReadFile(eventLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(lines))
+	}
+
+	var event map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &event); err != nil {
+		t.Fatal(err)
+	}
+	checks := map[string]any{
+		"ecs.version":                       ecsVersion,
+		"event.action":                      "successfulResponse",
+		"event.outcome":                     "success",
+		"source.ip":                         "192.0.2.1",
+		"source.port":                       float64(51234),
+		"destination.port":                  float64(8080),
+		"http.request.method":               "POST",
+		"http.request.body.content":         "user=admin",
+		"http.version":                      "1.1",
+		"http.response.status_code":         float64(401),
+		"http.response.body.content":        "denied",
+		"url.original":                      "/login.php?next=%2Fadmin",
+		"url.path":                          "/login.php",
+		"url.query":                         "next=%2Fadmin",
+		"user_agent.original":               "curl/8.0",
+		"labels.region":                     "eu",
+		"galah.llm.model":                   "gpt-4o",
+		"galah.httpResponse.headers.Server": "nginx",
+	}
+	for path, want := range checks {
+		if got := lookup(event, path); got != want {
+			t.Errorf("%s = %v, want %v", path, got, want)
+		}
+	}
+	if tags, _ := event["tags"].([]any); len(tags) != 1 || tags[0] != "test" {
+		t.Errorf("Expected the tags of the request, got %v", event["tags"])
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]any{
+		"event.action":              "failedResponse",
+		"event.outcome":             "failure",
+		"http.response.status_code": float64(503),
+		"error.type":                errorInvalidJSONResponse,
+		"error.message":             "unexpected end of JSON input",
+	} {
+		if got := lookup(event, path); got != want {
+			t.Errorf("%s = %v, want %v", path, got, want)
+		}
+	}
+}
+
+// lookup returns the value at the dotted path of the event.
+func lookup(event map[string]any, path string) any {
+	var v any = event
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
@@ -0,0 +1,345 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultESBatchSize     = 500
+	defaultESFlushInterval = time.Second
+	defaultESMaxRetries    = 5
+	esQueueSize            = 10000
+	esTimeout              = 30 * time.Second
+	esMaxBackoff           = 30 * time.Second
+)
+
+// esInitialBackoff is the delay before retrying the first time the events
+// rejected by an overloaded cluster.
+var esInitialBackoff = time.Second
+
+// ElasticsearchConfig configures the Elasticsearch (or OpenSearch) output of
+// the events. URL is the base URL of the cluster, and the events are indexed
+// in Index, suffixed by the date of the events in IndexDateFormat (a Go time
+// layout, e.g. 2006.01.02) if set. The events are formatted in Format: ecs
+// (the default) or json. An index template mapping the fields of the events
+// is installed for the indices on start unless SkipTemplate is true. The
+// events are indexed in bulk requests of up to BatchSize events, at least
+// every FlushInterval; the requests rejected because the cluster is
+// overloaded are retried with an exponential backoff up to MaxRetries
+// times. The requests are authenticated with APIKey, or Username and
+// Password.
+type ElasticsearchConfig struct {
+	URL                string
+	Index              string
+	IndexDateFormat    string
+	Format             string
+	SkipTemplate       bool
+	BatchSize          int
+	FlushInterval      time.Duration
+	MaxRetries         int
+	Username           string
+	Password           string
+	APIKey             string
+	CAFile             string
+	InsecureSkipVerify bool
+}
+
+// ElasticsearchHook is a logrus hook indexing the events in Elasticsearch in
+// the background.
+type ElasticsearchHook struct {
+	cfg       ElasticsearchConfig
+	client    *http.Client
+	formatter logrus.Formatter
+	logger    *logrus.Logger
+
+	queue   chan esDocument
+	done    chan struct{}
+	dropped sync.Once
+}
+
+// esDocument is an event to index.
+type esDocument struct {
+	index  string
+	source []byte
+}
+
+// NewElasticsearchHook returns a hook indexing the events in the cluster of
+// the configuration, after installing the index template. The errors indexing
+// the events are logged to logger.
+func NewElasticsearchHook(cfg ElasticsearchConfig, logger *logrus.Logger) (*ElasticsearchHook, error) {
+	if cfg.Index == "" {
+		cfg.Index = "galah"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultESBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultESFlushInterval
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = defaultESMaxRetries
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+
+	h := &ElasticsearchHook{
+		cfg:    cfg,
+		client: &http.Client{Timeout: esTimeout},
+		logger: logger,
+		queue:  make(chan esDocument, esQueueSize),
+		done:   make(chan struct{}),
+	}
+	switch cfg.Format {
+	case "", FormatECS:
+		h.formatter = &ECSFormatter{}
+	case FormatJSON:
+		h.formatter = &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}
+	default:
+		return nil, fmt.Errorf("unknown Elasticsearch format %q (ecs or json)", cfg.Format)
+	}
+	if strings.HasPrefix(cfg.URL, "https://") {
+		tlsConfig, err := newTLSConfig("", cfg.CAFile, cfg.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		h.client.Transport = &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}
+	}
+
+	if !cfg.SkipTemplate {
+		if err := h.putTemplate(); err != nil {
+			return nil, fmt.Errorf("error installing the Elasticsearch index template: %s", err)
+		}
+	}
+	go h.run()
+	return h, nil
+}
+
+// Levels returns the levels of the events indexed.
+func (h *ElasticsearchHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire queues the event to be indexed. The event is dropped if the queue is
+// full, when the cluster can't keep up.
+func (h *ElasticsearchHook) Fire(entry *logrus.Entry) error {
+	source, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	index := h.cfg.Index
+	if h.cfg.IndexDateFormat != "" {
+		index += "-" + entry.Time.UTC().Format(h.cfg.IndexDateFormat)
+	}
+	select {
+	case h.queue <- esDocument{index: index, source: bytes.TrimRight(source, "\n")}:
+	default:
+		h.dropped.Do(func() {
+			h.logger.Errorf("the Elasticsearch events queue is full, dropping the events")
+		})
+	}
+	return nil
+}
+
+// Close indexes the queued events.
+func (h *ElasticsearchHook) Close() error {
+	close(h.queue)
+	<-h.done
+	return nil
+}
+
+func (h *ElasticsearchHook) run() {
+	defer close(h.done)
+	ticker := time.NewTicker(h.cfg.FlushInterval)
+	defer ticker.Stop()
+	var batch []esDocument
+	for {
+		select {
+		case doc, ok := <-h.queue:
+			if !ok {
+				h.flush(batch)
+				return
+			}
+			batch = append(batch, doc)
+			if len(batch) < h.cfg.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		h.flush(batch)
+		batch = nil
+	}
+}
+
+// flush indexes the documents, retrying those rejected by an overloaded
+// cluster. The events keep being queued meanwhile, and are dropped once the
+// queue is full.
+func (h *ElasticsearchHook) flush(docs []esDocument) {
+	backoff := esInitialBackoff
+	for attempt := 0; len(docs) > 0; attempt++ {
+		retry, err := h.bulk(docs)
+		if err != nil {
+			h.logger.Errorf("error indexing %d events in Elasticsearch: %s", len(docs), err)
+		}
+		if len(retry) == 0 {
+			return
+		}
+		if attempt == h.cfg.MaxRetries {
+			h.logger.Errorf("dropping %d events rejected by Elasticsearch after %d retries", len(retry), attempt)
+			return
+		}
+		time.Sleep(backoff)
+		backoff = min(backoff*2, esMaxBackoff)
+		docs = retry
+	}
+}
+
+// bulk sends a bulk request of the documents, and returns those to retry.
+func (h *ElasticsearchHook) bulk(docs []esDocument) ([]esDocument, error) {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		// The create action also indexes to data streams.
+		action, _ := json.Marshal(map[string]any{"create": map[string]string{"_index": doc.index}})
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc.source)
+		body.WriteByte('\n')
+	}
+
+	resp, err := h.do(http.MethodPost, "/_bulk", "application/x-ndjson", body.Bytes())
+	if err != nil {
+		return docs, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return docs, fmt.Errorf("bulk request returned %s", resp.Status)
+	}
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("bulk request returned %s: %s", resp.Status, b)
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid bulk response: %s", err)
+	}
+	if !result.Errors {
+		return nil, nil
+	}
+
+	// The documents rejected by an overloaded node are retried, and the
+	// others (e.g. with mapping errors) dropped.
+	var retry []esDocument
+	var failed int
+	var lastErr error
+	for i, item := range result.Items {
+		for _, r := range item {
+			switch {
+			case r.Status < 300:
+			case r.Status == http.StatusTooManyRequests && i < len(docs):
+				retry = append(retry, docs[i])
+			default:
+				failed++
+				lastErr = fmt.Errorf("%s: %s", r.Error.Type, r.Error.Reason)
+			}
+		}
+	}
+	if failed > 0 {
+		return retry, fmt.Errorf("%d events were rejected, last error: %w", failed, lastErr)
+	}
+	return retry, nil
+}
+
+// putTemplate installs the index template mapping the fields of the events
+// of both formats.
+func (h *ElasticsearchHook) putTemplate() error {
+	text := map[string]string{"type": "text"}
+	template := map[string]any{
+		"index_patterns": []string{h.cfg.Index + "*"},
+		"priority":       200,
+		"template": map[string]any{
+			"mappings": map[string]any{
+				"dynamic_templates": []any{
+					map[string]any{"strings": map[string]any{
+						"match_mapping_type": "string",
+						"mapping":            map[string]any{"type": "keyword", "ignore_above": 1024},
+					}},
+				},
+				"properties": map[string]any{
+					"@timestamp": map[string]string{"type": "date"},
+					"eventTime":  map[string]string{"type": "date"},
+					"srcIP":      map[string]string{"type": "ip"},
+					"message":    text,
+					"source": map[string]any{"properties": map[string]any{
+						"ip":   map[string]string{"type": "ip"},
+						"port": map[string]string{"type": "long"},
+					}},
+					"destination": map[string]any{"properties": map[string]any{
+						"port": map[string]string{"type": "long"},
+					}},
+					"http": map[string]any{"properties": map[string]any{
+						"request": map[string]any{"properties": map[string]any{
+							"body": map[string]any{"properties": map[string]any{"content": text}},
+						}},
+						"response": map[string]any{"properties": map[string]any{
+							"body":        map[string]any{"properties": map[string]any{"content": text}},
+							"status_code": map[string]string{"type": "long"},
+						}},
+					}},
+					"httpRequest": map[string]any{"properties": map[string]any{
+						"body": text,
+					}},
+					"httpResponse": map[string]any{"properties": map[string]any{
+						"body": text,
+					}},
+				},
+			},
+		},
+	}
+	b, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+	resp, err := h.do(http.MethodPut, "/_index_template/"+h.cfg.Index, "application/json", b)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+func (h *ElasticsearchHook) do(method, path, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(context.Background(), method, h.cfg.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	switch {
+	case h.cfg.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+h.cfg.APIKey)
+	case h.cfg.Username != "":
+		req.SetBasicAuth(h.cfg.Username, h.cfg.Password)
+	}
+	return h.client.Do(req)
+}
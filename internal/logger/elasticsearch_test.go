@@ -0,0 +1,113 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestElasticsearchHook(t *testing.T) {
+	esInitialBackoff = time.Millisecond
+	defer func() { esInitialBackoff = time.Second }()
+
+	var mu sync.Mutex
+	var template map[string]any
+	var indexed []map[string]any
+	var indices []string
+	bulkRequests := 0
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "ApiKey secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/_index_template/galah":
+			json.NewDecoder(r.Body).Decode(&template)
+			fmt.Fprint(w, `{"acknowledged":true}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/_bulk":
+			bulkRequests++
+			// The first request is throttled, and the first document of
+			// the second one rejected by a node.
+			if bulkRequests == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			var items []string
+			scanner := bufio.NewScanner(r.Body)
+			for i := 0; scanner.Scan(); i++ {
+				var action map[string]map[string]string
+				json.Unmarshal(scanner.Bytes(), &action)
+				scanner.Scan()
+				if bulkRequests == 2 && i == 0 {
+					items = append(items, `{"create":{"status":429,"error":{"type":"es_rejected_execution_exception"}}}`)
+					continue
+				}
+				var doc map[string]any
+				json.Unmarshal(scanner.Bytes(), &doc)
+				indexed = append(indexed, doc)
+				indices = append(indices, action["create"]["_index"])
+				items = append(items, `{"create":{"status":201}}`)
+			}
+			fmt.Fprintf(w, `{"errors":true,"items":[%s]}`, strings.Join(items, ","))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer es.Close()
+
+	l, err := New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{Provider: "openai", Model: "gpt-4o"}, enrich.New(enrich.Config{CacheSize: 1}), logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook, err := NewElasticsearchHook(ElasticsearchConfig{
+		URL:             es.URL + "/",
+		IndexDateFormat: "2006.01",
+		APIKey:          "secret",
+		FlushInterval:   10 * time.Millisecond,
+	}, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.EventLogger.AddHook(hook)
+	for _, path := range []string{"/a", "/b"} {
+		r := httptest.NewRequest("GET", path, nil)
+		r.RemoteAddr = "192.0.2.1:51234"
+		l.LogEvent(r, llm.JSONResponse{StatusCode: 200, Body: "ok"}, "8080")
+	}
+	hook.Close()
+
+	if _, err := NewElasticsearchHook(ElasticsearchConfig{URL: es.URL, APIKey: "wrong"}, logrus.New()); err == nil {
+		t.Error("Expected an error installing the template without authorization")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if template["index_patterns"].([]any)[0] != "galah*" {
+		t.Errorf("Unexpected index template: %v", template)
+	}
+	if len(indexed) != 2 {
+		t.Fatalf("Expected 2 indexed events, got %d (%d bulk requests)", len(indexed), bulkRequests)
+	}
+	if got := lookup(indexed[0], "url.original"); got != "/b" {
+		t.Errorf("Expected the event of /b indexed first, got %v", got)
+	}
+	if got := lookup(indexed[1], "url.original"); got != "/a" {
+		t.Errorf("Expected the retried event of /a, got %v", got)
+	}
+	if want := "galah-" + time.Now().UTC().Format("2006.01"); indices[0] != want {
+		t.Errorf("Index = %q, want %q", indices[0], want)
+	}
+}
@@ -0,0 +1,135 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x4d31/galah/internal/eventstore"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	eventStoreQueueSize = 10000
+	eventStoreTimeout   = 10 * time.Second
+)
+
+// EventStoreHook is a logrus hook storing the events in an event store, in
+// the background.
+type EventStoreHook struct {
+	store     *eventstore.Store
+	formatter logrus.Formatter
+	logger    *logrus.Logger
+
+	queue   chan eventstore.Event
+	done    chan struct{}
+	dropped sync.Once
+}
+
+// NewEventStoreHook returns a hook storing the events in the store. The
+// errors storing them are logged to logger.
+func NewEventStoreHook(store *eventstore.Store, logger *logrus.Logger) *EventStoreHook {
+	h := &EventStoreHook{
+		store:     store,
+		formatter: &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano},
+		logger:    logger,
+		queue:     make(chan eventstore.Event, eventStoreQueueSize),
+		done:      make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+// Levels returns the levels of the stored events.
+func (h *EventStoreHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire queues the event to be stored. The event is dropped if the queue is
+// full.
+func (h *EventStoreHook) Fire(entry *logrus.Entry) error {
+	data, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	var fields struct {
+		SrcIP       string   `json:"srcIP"`
+		SrcPort     string   `json:"srcPort"`
+		Port        string   `json:"port"`
+		Tags        []string `json:"tags"`
+		HTTPRequest struct {
+			Method    string `json:"method"`
+			Request   string `json:"request"`
+			UserAgent string `json:"userAgent"`
+		} `json:"httpRequest"`
+		HTTPResponse struct {
+			StatusCode int `json:"status_code"`
+		} `json:"httpResponse"`
+		Error struct {
+			StatusCode int `json:"statusCode"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	// Only the request events are stored.
+	if fields.SrcIP == "" {
+		return nil
+	}
+
+	action, _, _ := strings.Cut(entry.Message, ":")
+	e := eventstore.Event{
+		Time:       entry.Time,
+		SrcIP:      fields.SrcIP,
+		SrcPort:    fields.SrcPort,
+		Port:       fields.Port,
+		Action:     action,
+		Method:     fields.HTTPRequest.Method,
+		URI:        fields.HTTPRequest.Request,
+		UserAgent:  fields.HTTPRequest.UserAgent,
+		StatusCode: fields.HTTPResponse.StatusCode,
+		Tags:       fields.Tags,
+		Data:       json.RawMessage(strings.TrimSpace(string(data))),
+	}
+	if t, ok := entry.Data["eventTime"].(time.Time); ok {
+		e.Time = t
+	}
+	if entry.Level <= logrus.ErrorLevel {
+		// The events logged before the status of the errors have 500.
+		e.StatusCode = fields.Error.StatusCode
+		if e.StatusCode == 0 {
+			e.StatusCode = 500
+		}
+	} else if e.StatusCode == 0 && action == "successfulResponse" {
+		e.StatusCode = 200
+	}
+
+	select {
+	case h.queue <- e:
+	default:
+		h.dropped.Do(func() {
+			h.logger.Errorf("the event store queue is full, dropping the events")
+		})
+	}
+	return nil
+}
+
+// Close stores the queued events.
+func (h *EventStoreHook) Close() error {
+	close(h.queue)
+	<-h.done
+	return nil
+}
+
+func (h *EventStoreHook) run() {
+	defer close(h.done)
+	for e := range h.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), eventStoreTimeout)
+		if err := h.store.Insert(ctx, &e); err != nil {
+			h.logger.Errorf("error storing the event of %s in the event store: %s", e.SrcIP, err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,57 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/eventstore"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestEventStoreHook(t *testing.T) {
+	dir := t.TempDir()
+	store, err := eventstore.Open("sqlite3", filepath.Join(dir, "events.db"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	l, err := New(filepath.Join(dir, "event_log.json"), llm.Config{Provider: "openai", Model: "gpt-4o"}, enrich.New(enrich.Config{CacheSize: 1}), logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook := NewEventStoreHook(store, logrus.New())
+	l.EventLogger.AddHook(hook)
+	r := httptest.NewRequest("GET", "/wp-login.php", nil)
+	r.RemoteAddr = "192.0.2.1:51234"
+	r.Header.Set("User-Agent", "curl/8.6.0")
+	l.LogEvent(r, llm.JSONResponse{StatusCode: 404, Body: "not found"}, "8080")
+	l.LogError(httptest.NewRequest("POST", "/api", nil), "", "8080", 503, errors.New("invalid JSON"))
+	hook.Close()
+
+	events, err := store.Events(context.Background(), eventstore.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 stored events, got %d", len(events))
+	}
+	if e := events[0]; e.Action != "failedResponse" || e.StatusCode != 503 || e.Method != "POST" {
+		t.Errorf("Unexpected stored error: %+v", e)
+	}
+	e := events[1]
+	if e.Action != "successfulResponse" || e.SrcIP != "192.0.2.1" || e.SrcPort != "51234" || e.Port != "8080" || e.URI != "/wp-login.php" || e.UserAgent != "curl/8.6.0" || e.StatusCode != 404 {
+		t.Errorf("Unexpected stored event: %+v", e)
+	}
+	if len(e.Data) == 0 || e.SessionID == 0 {
+		t.Errorf("Expected the event data and session, got %+v", e)
+	}
+}
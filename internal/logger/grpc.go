@@ -0,0 +1,280 @@
+package logger
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/0x4d31/galah/internal/session"
+	"github.com/0x4d31/galah/pkg/eventsapi"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// defaultGRPCBuffer is the default number of events buffered per consumer of
+// the gRPC event stream.
+const defaultGRPCBuffer = 256
+
+// GRPCConfig configures the gRPC event stream, served on Address, over TLS
+// with the Certificate and Key if set. The consumers must authenticate with
+// the Token, if set, as a bearer token in the authorization metadata. Up to
+// Buffer events (default 256) are buffered per consumer, the next ones dropped
+// while it is too slow to receive them.
+type GRPCConfig struct {
+	Address     string
+	Token       string
+	Certificate string
+	Key         string
+	Buffer      int
+}
+
+// GRPCHook is a logrus hook streaming the events, and the summaries of their
+// sessions, to the consumers of the gRPC event stream (see the eventsapi
+// package). The events are converted only while there are consumers.
+type GRPCHook struct {
+	eventsapi.UnimplementedEventStreamServer
+
+	token     string
+	buffer    int
+	formatter logrus.JSONFormatter
+	server    *grpc.Server
+	listener  net.Listener
+	logger    *logrus.Logger
+
+	mu        sync.Mutex
+	consumers map[*consumer]struct{}
+	closed    bool
+}
+
+// consumer is a stream of a consumer, receiving the events it matches.
+type consumer struct {
+	match   func(*eventsapi.Event) bool
+	events  chan *eventsapi.Event
+	done    chan struct{}
+	dropped sync.Once
+}
+
+// NewGRPCHook returns a hook streaming the events to the consumers of the
+// gRPC event stream, served in the background. The errors serving it are
+// logged to logger.
+func NewGRPCHook(cfg GRPCConfig, logger *logrus.Logger) (*GRPCHook, error) {
+	h := &GRPCHook{
+		token:     cfg.Token,
+		buffer:    cfg.Buffer,
+		formatter: logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano},
+		logger:    logger,
+		consumers: make(map[*consumer]struct{}),
+	}
+	if h.buffer <= 0 {
+		h.buffer = defaultGRPCBuffer
+	}
+	opts := []grpc.ServerOption{grpc.StreamInterceptor(h.authenticate)}
+	if cfg.Certificate != "" || cfg.Key != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Certificate, cfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the certificate of the gRPC event stream: %s", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewServerTLSFromCert(&cert)))
+	}
+
+	ln, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("error listening for the gRPC event stream: %s", err)
+	}
+	h.listener = ln
+	h.server = grpc.NewServer(opts...)
+	eventsapi.RegisterEventStreamServer(h.server, h)
+	go func() {
+		if err := h.server.Serve(ln); err != nil {
+			logger.Errorf("error serving the gRPC event stream: %s", err)
+		}
+	}()
+	logger.Infof("streaming the events over gRPC on %s", ln.Addr())
+	return h, nil
+}
+
+// Addr returns the address the event stream is served on.
+func (h *GRPCHook) Addr() net.Addr {
+	return h.listener.Addr()
+}
+
+// authenticate rejects the streams without the token, if set.
+func (h *GRPCHook) authenticate(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if h.token != "" {
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		auth := md.Get("authorization")
+		if len(auth) == 0 || subtle.ConstantTimeCompare([]byte(auth[0]), []byte("Bearer "+h.token)) != 1 {
+			return status.Error(codes.Unauthenticated, "invalid token")
+		}
+	}
+	return handler(srv, ss)
+}
+
+// StreamEvents implements eventsapi.EventStreamServer.
+func (h *GRPCHook) StreamEvents(req *eventsapi.StreamEventsRequest, stream eventsapi.EventStream_StreamEventsServer) error {
+	return h.stream(stream.Context(), func(e *eventsapi.Event) bool {
+		if req.SrcIp != "" && e.SrcIp != req.SrcIp {
+			return false
+		}
+		return len(req.Tags) == 0 || slices.ContainsFunc(req.Tags, func(tag string) bool { return slices.Contains(e.Tags, tag) })
+	}, stream.Send)
+}
+
+// StreamSessions implements eventsapi.EventStreamServer.
+func (h *GRPCHook) StreamSessions(req *eventsapi.StreamSessionsRequest, stream eventsapi.EventStream_StreamSessionsServer) error {
+	return h.stream(stream.Context(), func(e *eventsapi.Event) bool {
+		return e.Session != nil && (!req.FlaggedOnly || e.Session.Flagged)
+	}, func(e *eventsapi.Event) error {
+		return stream.Send(e.Session)
+	})
+}
+
+// stream sends the events matching match with send, until the consumer
+// cancels the stream or the hook is closed.
+func (h *GRPCHook) stream(ctx context.Context, match func(*eventsapi.Event) bool, send func(*eventsapi.Event) error) error {
+	c := &consumer{match: match, events: make(chan *eventsapi.Event, h.buffer), done: make(chan struct{})}
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return status.Error(codes.Unavailable, "the event stream is closed")
+	}
+	h.consumers[c] = struct{}{}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.consumers, c)
+		h.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.done:
+			return nil
+		case e := <-c.events:
+			if err := send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Levels returns the levels of the events.
+func (h *GRPCHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire sends the event to the consumers it matches, dropping it for the ones
+// whose buffer is full.
+func (h *GRPCHook) Fire(entry *logrus.Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.consumers) == 0 {
+		return nil
+	}
+	e, err := h.event(entry)
+	if err != nil {
+		return err
+	}
+	for c := range h.consumers {
+		if !c.match(e) {
+			continue
+		}
+		select {
+		case c.events <- e:
+		default:
+			c.dropped.Do(func() {
+				h.logger.Warnln("the gRPC event stream consumer is too slow, dropping its events")
+			})
+		}
+	}
+	return nil
+}
+
+// event returns the protobuf event of the entry.
+func (h *GRPCHook) event(entry *logrus.Entry) (*eventsapi.Event, error) {
+	data, err := h.formatter.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+	e := &eventsapi.Event{Msg: entry.Message, Json: string(data)}
+	if t, ok := entry.Data["eventTime"].(time.Time); ok {
+		e.EventTime = timestamppb.New(t)
+	} else {
+		e.EventTime = timestamppb.New(entry.Time)
+	}
+	e.SrcIp, _ = entry.Data["srcIP"].(string)
+	e.SrcHost, _ = entry.Data["srcHost"].(string)
+	e.SrcPort, _ = entry.Data["srcPort"].(string)
+	e.Port, _ = entry.Data["port"].(string)
+	e.SensorName, _ = entry.Data["sensorName"].(string)
+	e.Tags, _ = entry.Data["tags"].([]string)
+	if req, ok := entry.Data["httpRequest"].(HTTPRequest); ok {
+		e.HttpRequest = &eventsapi.HTTPRequest{
+			Method:              req.Method,
+			ProtocolVersion:     req.ProtocolVersion,
+			Request:             req.Request,
+			UserAgent:           req.UserAgent,
+			Headers:             req.Headers,
+			HeadersSorted:       req.HeadersSorted,
+			HeadersSortedSha256: req.HeadersSortedSha256,
+			Ja4H:                req.JA4H,
+			Body:                req.Body,
+			BodySha256:          req.BodySha256,
+		}
+	}
+	if resp, ok := entry.Data["httpResponse"].(llm.JSONResponse); ok {
+		e.HttpResponse = &eventsapi.HTTPResponse{
+			StatusCode: int32(resp.StatusCode),
+			Headers:    resp.Headers,
+			Encoding:   resp.Encoding,
+			Body:       resp.Body,
+		}
+	}
+	if m, ok := entry.Data["llm"].(LLM); ok {
+		e.Llm = &eventsapi.LLM{Provider: m.Provider, Model: m.Model, Temperature: m.Temperature, Route: m.Route}
+	}
+	if info, ok := entry.Data["session"].(*session.Info); ok && info != nil {
+		e.Session = &eventsapi.SessionSummary{
+			Id:          info.ID,
+			SrcIp:       info.Source,
+			Fingerprint: info.Fingerprint,
+			Start:       timestamppb.New(info.Start),
+			LastSeen:    timestamppb.New(info.LastSeen),
+			Requests:    int32(info.Requests),
+			Score:       int32(info.Score),
+			Flagged:     info.Flagged,
+		}
+	}
+	if fields, ok := entry.Data["error"].(logrus.Fields); ok {
+		e.Error = &eventsapi.Error{}
+		e.Error.Type, _ = fields["type"].(string)
+		e.Error.Msg, _ = fields["msg"].(string)
+	}
+	return e, nil
+}
+
+// Close ends the streams of the consumers and stops the server.
+func (h *GRPCHook) Close() error {
+	h.mu.Lock()
+	h.closed = true
+	for c := range h.consumers {
+		close(c.done)
+	}
+	h.consumers = make(map[*consumer]struct{})
+	h.mu.Unlock()
+	h.server.GracefulStop()
+	return nil
+}
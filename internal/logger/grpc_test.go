@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/session"
+	"github.com/0x4d31/galah/pkg/eventsapi"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// waitConsumers waits until the hook has n consumers.
+func waitConsumers(t *testing.T, h *GRPCHook, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		h.mu.Lock()
+		got := len(h.consumers)
+		h.mu.Unlock()
+		if got == n {
+			return
+		}
+	}
+	t.Fatalf("Expected %d consumers of the event stream", n)
+}
+
+func TestGRPCHook(t *testing.T) {
+	l := logrus.New()
+	l.Out = io.Discard
+	hook, err := NewGRPCHook(GRPCConfig{Address: "127.0.0.1:0", Token: "secret"}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hook.Close()
+	l.AddHook(hook)
+	// The events are only converted while there are consumers.
+	l.WithFields(logrus.Fields{"srcIP": "192.0.2.1"}).Info("successfulResponse")
+
+	conn, err := grpc.Dial(hook.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := eventsapi.NewEventStreamClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	unauthenticated, err := client.StreamEvents(ctx, &eventsapi.StreamEventsRequest{})
+	if err == nil {
+		_, err = unauthenticated.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected the stream without the token rejected, got %v", err)
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+	events, err := client.StreamEvents(ctx, &eventsapi.StreamEventsRequest{Tags: []string{"honeytoken"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := client.StreamSessions(ctx, &eventsapi.StreamSessionsRequest{FlaggedOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitConsumers(t, hook, 2)
+
+	start := time.Now().Add(-time.Minute)
+	l.WithFields(logrus.Fields{"srcIP": "192.0.2.1", "tags": []string{"scanner"}, "session": &session.Info{ID: "s1"}}).Info("successfulResponse")
+	l.WithFields(logrus.Fields{
+		"eventTime":    start,
+		"srcIP":        "192.0.2.2",
+		"port":         "8080",
+		"tags":         []string{"honeytoken"},
+		"httpRequest":  HTTPRequest{Method: "GET", Request: "/.env"},
+		"httpResponse": llm.JSONResponse{StatusCode: 200, Headers: map[string]string{"Content-Type": "text/plain"}, Body: "APP_KEY="},
+		"llm":          LLM{Provider: "openai", Model: "gpt-4o"},
+		"session":      &session.Info{ID: "s2", Source: "192.0.2.2", Start: start, Requests: 12, Score: 60, Flagged: true},
+	}).Info("successfulResponse")
+
+	e, err := events.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Msg != "successfulResponse" || e.SrcIp != "192.0.2.2" || e.Port != "8080" || !e.EventTime.AsTime().Equal(start) {
+		t.Errorf("Unexpected event %v", e)
+	}
+	if e.HttpRequest.GetRequest() != "/.env" || e.HttpResponse.GetHeaders()["Content-Type"] != "text/plain" || e.Llm.GetModel() != "gpt-4o" {
+		t.Errorf("Unexpected request, response or model of the event %v", e)
+	}
+	if !strings.Contains(e.Json, `"srcIP":"192.0.2.2"`) {
+		t.Errorf("Expected the JSON of the event, got %s", e.Json)
+	}
+
+	s, err := sessions.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Id != "s2" || s.Requests != 12 || s.Score != 60 || !s.Flagged {
+		t.Errorf("Expected the flagged session, got %v", s)
+	}
+
+	// The streams end when the hook is closed.
+	hook.Close()
+	if _, err := events.Recv(); err != io.EOF {
+		t.Errorf("Expected the stream ended, got %v", err)
+	}
+}
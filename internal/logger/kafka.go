@@ -0,0 +1,106 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/0x4d31/galah/internal/kafka"
+	"github.com/sirupsen/logrus"
+)
+
+// KafkaConfig configures the Kafka output of the events. The events are
+// formatted in Format: json (the default), ecs or cef, and keyed by their
+// source IP, so that the events of a source are kept in order in a
+// partition. TLS enables the encryption of the connections, verifying the
+// certificates of the brokers with the CAs of CAFile (the system's if
+// empty). SASL is the optional authentication to the brokers.
+type KafkaConfig struct {
+	Brokers            []string
+	Topic              string
+	Acks               int
+	Format             string
+	BatchSize          int
+	FlushInterval      time.Duration
+	TLS                bool
+	CAFile             string
+	InsecureSkipVerify bool
+	SASL               *kafka.SASL
+	// Version is the version of Galah in the CEF records.
+	Version string
+}
+
+// KafkaHook is a logrus hook producing the events to a Kafka topic. The
+// events are sent in batches in the background.
+type KafkaHook struct {
+	producer  *kafka.Producer
+	formatter logrus.Formatter
+	logger    *logrus.Logger
+	dropped   sync.Once
+}
+
+// NewKafkaHook returns a hook producing the events to the Kafka topic of the
+// configuration. The errors producing them are logged to logger.
+func NewKafkaHook(cfg KafkaConfig, logger *logrus.Logger) (*KafkaHook, error) {
+	formatter, err := newFormatter(cfg.Format, cfg.Version)
+	if err != nil {
+		return nil, err
+	}
+	pc := kafka.Config{
+		Brokers:       cfg.Brokers,
+		Topic:         cfg.Topic,
+		Acks:          cfg.Acks,
+		BatchSize:     cfg.BatchSize,
+		FlushInterval: cfg.FlushInterval,
+		SASL:          cfg.SASL,
+		OnError: func(err error) {
+			logger.Errorf("error producing the events to Kafka: %s", err)
+		},
+	}
+	if cfg.TLS {
+		// The server name is that of the address of each broker.
+		if pc.TLS, err = newTLSConfig("", cfg.CAFile, cfg.InsecureSkipVerify); err != nil {
+			return nil, err
+		}
+	}
+	producer, err := kafka.NewProducer(pc)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the Kafka producer: %s", err)
+	}
+	return &KafkaHook{producer: producer, formatter: formatter, logger: logger}, nil
+}
+
+// Levels returns the levels of the events produced to Kafka.
+func (h *KafkaHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire queues the event to be produced, keyed by its source IP. The event is
+// dropped if the queue is full.
+func (h *KafkaHook) Fire(entry *logrus.Entry) error {
+	value, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	var key []byte
+	if srcIP, ok := entry.Data["srcIP"].(string); ok && srcIP != "" {
+		key = []byte(srcIP)
+	}
+	// The formatters end the events with a newline, which isn't part of
+	// the record.
+	if n := len(value); n > 0 && value[n-1] == '\n' {
+		value = value[:n-1]
+	}
+	if !h.producer.Send(kafka.Message{Key: key, Value: value}) {
+		h.dropped.Do(func() {
+			h.logger.Errorf("the Kafka events queue is full, dropping the events")
+		})
+	}
+	return nil
+}
+
+// Close produces the queued events and closes the connections to the
+// brokers.
+func (h *KafkaHook) Close() error {
+	return h.producer.Close()
+}
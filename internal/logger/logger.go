@@ -1,8 +1,10 @@
 package logger
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -12,6 +14,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/0x4d31/galah/internal/fingerprint"
+	"github.com/0x4d31/galah/internal/session"
 	"github.com/0x4d31/galah/pkg/enrich"
 	"github.com/0x4d31/galah/pkg/llm"
 	"github.com/google/uuid"
@@ -22,6 +26,18 @@ const (
 	errorInvalidJSONResponse = "invalidJSONResponse"
 	errorEmptyLLMResponse    = "emptyLLMResponse"
 	errorContentGeneration   = "contentGenerationError"
+	errorNonJSONStream       = "nonJSONStream"
+	errorProviderResponse    = "providerResponse"
+	errorCostCeiling         = "costCeiling"
+	errorRateLimited         = "rateLimited"
+	errorTransport           = "transportError"
+	errorQuotaExhausted      = "quotaExhausted"
+	errorRefusal             = "refusal"
+	errorDeadline            = "insufficientDeadline"
+	errorTokenRateLimit      = "tokenRateLimited"
+	errorCircuitOpen         = "circuitOpen"
+	errorTimeout             = "llmTimeout"
+	errorBudgetExceeded      = "budgetExceeded"
 )
 
 // New creates a new Logger instance with the specified configuration.
@@ -44,22 +60,110 @@ func New(eventLogFile string, modelConfig llm.Config, eCache *enrich.Enricher, l
 	}, nil
 }
 
-// LogError logs a failedResponse event.
-func (l *Logger) LogError(r *http.Request, resp, port string, err error) {
+// SetRotation replaces the event log file opened by New with a file rotated
+// with the configuration.
+func (l *Logger) SetRotation(eventLogFile string, cfg RotateConfig) error {
+	f, err := OpenRotatingFile(eventLogFile, cfg, l.Logger)
+	if err != nil {
+		return err
+	}
+	if c, ok := l.EventLogger.Out.(io.Closer); ok {
+		c.Close()
+	}
+	l.EventLogger.SetOutput(f)
+	return nil
+}
+
+// Close detaches the hooks of the event outputs from the event log, closing
+// the ones sending the events in the background after the queued events are
+// sent, and closes the event log file.
+func (l *Logger) Close() error {
+	hooks := l.EventLogger.ReplaceHooks(make(logrus.LevelHooks))
+	closed := make(map[logrus.Hook]bool)
+	var errs []error
+	for _, levelHooks := range hooks {
+		for _, hook := range levelHooks {
+			c, ok := hook.(io.Closer)
+			if !ok || closed[hook] {
+				continue
+			}
+			closed[hook] = true
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	out := l.EventLogger.Out
+	l.EventLogger.SetOutput(io.Discard)
+	if c, ok := out.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetFormat sets the format of the event log: json (the default) or ecs.
+func (l *Logger) SetFormat(format string) error {
+	switch format {
+	case "", FormatJSON:
+		l.EventLogger.SetFormatter(&logrus.JSONFormatter{
+			TimestampFormat: time.RFC3339Nano,
+		})
+	case FormatECS:
+		l.EventLogger.SetFormatter(&ECSFormatter{})
+	default:
+		return fmt.Errorf("unknown event log format %q", format)
+	}
+	return nil
+}
+
+// LogError logs a failedResponse event, of the request answered with the
+// status code after the error.
+func (l *Logger) LogError(r *http.Request, resp, port string, status int, err error) {
 	fields := l.commonFields(r, port)
-	fields["error"] = errorFields(err, resp)
+	if l.Redactor != nil {
+		resp = l.Redactor.String(resp)
+	}
+	errFields := errorFields(err, resp)
+	errFields["statusCode"] = status
+	fields["error"] = errFields
+	if errors.Is(err, llm.ErrTimeout) {
+		fields["tags"] = append(fields["tags"].([]string), llm.ErrorKindTimeout)
+	}
 
-	l.EventLogger.WithFields(fields).Error("failedResponse: returned 500 internal server error")
+	l.EventLogger.WithFields(fields).Errorf("failedResponse: returned %d %s", status, strings.ToLower(http.StatusText(status)))
 }
 
 // LogEvent logs a successfulResponse event.
 func (l *Logger) LogEvent(r *http.Request, resp llm.JSONResponse, port string) {
 	fields := l.commonFields(r, port)
+	if l.Redactor != nil {
+		resp = l.Redactor.Response(resp)
+	}
 	fields["httpResponse"] = resp
 
 	l.EventLogger.WithFields(fields).Info("successfulResponse")
 }
 
+// LogWebSocketMessage logs a webSocketMessage event, with a message of the
+// client of a WebSocket session and the replies sent to it.
+func (l *Logger) LogWebSocketMessage(r *http.Request, port, message string, replies []string) {
+	fields := l.commonFields(r, port)
+	if rd := l.Redactor; rd != nil {
+		message = rd.String(message)
+		redacted := make([]string, len(replies))
+		for i, reply := range replies {
+			redacted[i] = rd.String(reply)
+		}
+		replies = redacted
+	}
+	fields["webSocket"] = WebSocket{Message: message, Replies: replies}
+
+	l.EventLogger.WithFields(fields).Info("webSocketMessage")
+}
+
 func (l *Logger) commonFields(r *http.Request, port string) logrus.Fields {
 	srcIP, srcPort, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
@@ -69,18 +173,34 @@ func (l *Logger) commonFields(r *http.Request, port string) logrus.Fields {
 
 	var tags []string
 	var host string
+	var scanner bool
 	srcIPInfo, err := l.EnrichCache.Process(srcIP)
 	if err != nil {
 		l.Logger.Errorf("error getting enrichment info for %q: %s", srcIP, err)
 	} else if srcIPInfo != nil {
 		if s := srcIPInfo.KnownScanner; s != "" {
 			tags = append(tags, s)
+			scanner = true
 		}
 		if h := srcIPInfo.Host; h != "" {
 			host = h
 		}
 	}
 
+	tags = append(tags, TagsFrom(r.Context())...)
+
+	geo, err := l.EnrichCache.GeoIP(srcIP)
+	if err != nil {
+		l.Logger.Errorf("error getting GeoIP info for %q: %s", srcIP, err)
+	}
+	verdicts, err := l.EnrichCache.LookupThreatIntel(context.WithoutCancel(r.Context()), srcIP)
+	if err != nil {
+		l.Logger.Errorf("error getting threat intelligence for %q: %s", srcIP, err)
+	}
+	for _, v := range verdicts {
+		tags = append(tags, v.Tags...)
+	}
+
 	sensorName, err := getHostname()
 	if err != nil {
 		sensorName = uuid.NewString()
@@ -89,8 +209,34 @@ func (l *Logger) commonFields(r *http.Request, port string) logrus.Fields {
 	headerKeys := headerKeys(r.Header)
 	sort.Strings(headerKeys)
 	bodyBytes, _ := io.ReadAll(r.Body)
+	credentials := harvestCredentials(r, bodyBytes)
+	scanner = scanner || scannerTagged(tags)
+	techniques := l.techniques(tags, len(credentials) > 0, scanner)
+	var sessionInfo *session.Info
+	if l.Sessions != nil {
+		info := l.recordSession(r, srcIP, bodyBytes, techniques, scanner)
+		if info.Flagged {
+			tags = append(tags, SessionTag)
+		}
+		if l.Redactor != nil {
+			info.Fingerprint = l.Redactor.String(info.Fingerprint)
+		}
+		sessionInfo = &info
+	}
+	uri, userAgent, headers := r.RequestURI, r.UserAgent(), r.Header
+	if rd := l.Redactor; rd != nil {
+		credentials = rd.Credentials(credentials)
+		// The hash is of the redacted body, as the hash of a short secret
+		// would reveal it.
+		uri, userAgent, headers = rd.URI(uri), rd.String(userAgent), rd.Header(headers)
+		bodyBytes = []byte(rd.Body(string(bodyBytes), r.Header.Get("Content-Type")))
+	}
+	// The bodies that aren't text are logged in base64, keeping them intact
+	// in the JSON event logs.
+	body, bodyEncoding := llm.SafeBody(r.Header.Get("Content-Type"), bodyBytes)
+	llmConfig := llmConfigFrom(r.Context(), l.LLMConfig)
 
-	return logrus.Fields{
+	fields := logrus.Fields{
 		"eventTime":  time.Now(),
 		"srcIP":      srcIP,
 		"srcHost":    host,
@@ -101,44 +247,108 @@ func (l *Logger) commonFields(r *http.Request, port string) logrus.Fields {
 		"httpRequest": HTTPRequest{
 			Method:              r.Method,
 			ProtocolVersion:     r.Proto,
-			Request:             r.RequestURI,
-			UserAgent:           r.UserAgent(),
-			Headers:             headerValues(r.Header),
+			Request:             uri,
+			UserAgent:           userAgent,
+			Headers:             headerValues(headers),
 			HeadersSorted:       strings.Join(headerKeys, ","),
 			HeadersSortedSha256: headersSortedSha256(headerKeys),
-			Body:                string(bodyBytes),
+			JA4H:                fingerprint.JA4HFrom(r),
+			Body:                body,
+			BodyEncoding:        bodyEncoding,
 			BodySha256: func(data []byte) string {
 				hash := sha256.Sum256(data)
 				return hex.EncodeToString(hash[:])
 			}(bodyBytes),
 		},
 		"llm": LLM{
-			Provider:    l.LLMConfig.Provider,
-			Model:       l.LLMConfig.Model,
-			Temperature: l.LLMConfig.Temperature,
+			Provider:    llmConfig.Provider,
+			Model:       llmConfig.Model,
+			Temperature: llmConfig.Temperature,
+			Seed:        llmConfig.Seed,
+			TopP:        llmConfig.TopP,
+			Route:       ModelRouteFrom(r.Context()),
 		},
 	}
+	if geo != nil {
+		fields["srcGeo"] = geo
+	}
+	if len(verdicts) > 0 {
+		fields["threatIntel"] = verdicts
+	}
+	if md := MetadataFrom(r.Context()); len(md) > 0 {
+		fields["metadata"] = md
+	}
+	if len(credentials) > 0 {
+		fields["credentials"] = credentials
+	}
+	if len(techniques) > 0 {
+		fields["mitreAttack"] = techniques
+	}
+	if sessionInfo != nil {
+		fields["session"] = sessionInfo
+	}
+	if artifacts := ArtifactsFrom(r.Context()); len(artifacts) > 0 {
+		fields["artifacts"] = artifacts
+	}
+	if tokens := HoneytokensFrom(r.Context()); len(tokens) > 0 {
+		fields["honeytokens"] = tokens
+	}
+	if rb, ok := llm.RequestBodyFrom(r.Context()); ok && (rb.Encoding != "" || rb.Chunked || rb.Truncated) {
+		fields["requestBody"] = rb
+	}
+	if proxy := ProxyIPFrom(r.Context()); proxy != "" {
+		fields["proxyIP"] = proxy
+	}
+	if tool, ok := ScannerFrom(r.Context()); ok {
+		fields["scanner"] = tool
+	}
+	if variant := PromptVariantFrom(r.Context()); variant != "" {
+		fields["promptVariant"] = variant
+	}
+	if usage, ok := llm.UsageFrom(r.Context()); ok {
+		fields["usage"] = usage
+	}
+	if fp := fingerprint.TLSFrom(r.Context()); fp != nil {
+		fields["tlsFingerprint"] = fp
+	}
+
+	return fields
+}
+
+// errorTypes are the event error types of the generation errors, checked in
+// order.
+var errorTypes = []struct {
+	err error
+	typ string
+}{
+	{llm.ErrInvalidJSON, errorInvalidJSONResponse},
+	{llm.ErrEmptyResponse, errorEmptyLLMResponse},
+	{llm.ErrProviderResponse, errorProviderResponse},
+	{llm.ErrRateLimited, errorRateLimited},
+	{llm.ErrTransport, errorTransport},
+	{llm.ErrQuotaExhausted, errorQuotaExhausted},
+	{llm.ErrRefusal, errorRefusal},
+	{llm.ErrCostCeiling, errorCostCeiling},
+	{llm.ErrNonJSONStream, errorNonJSONStream},
+	{llm.ErrInsufficientDeadline, errorDeadline},
+	{llm.ErrTokenRateLimit, errorTokenRateLimit},
+	{llm.ErrTimeout, errorTimeout},
+	{llm.ErrCircuitOpen, errorCircuitOpen},
+	{llm.ErrBudgetExceeded, errorBudgetExceeded},
 }
 
 func errorFields(err error, resp string) logrus.Fields {
-	errMsg := err.Error()
-	var errorType string
-
-	switch {
-	case strings.Contains(errMsg, errorInvalidJSONResponse):
-		errorType = errorInvalidJSONResponse
-		errMsg = strings.ReplaceAll(errMsg, errorInvalidJSONResponse+": ", "")
-	case strings.Contains(errMsg, errorEmptyLLMResponse):
-		errorType = errorEmptyLLMResponse
-		errMsg = strings.ReplaceAll(errMsg, errorEmptyLLMResponse+": ", "")
-	default:
-		errorType = errorContentGeneration
-		errMsg = strings.ReplaceAll(errMsg, errorContentGeneration+": ", "")
+	errorType := errorContentGeneration
+	for _, t := range errorTypes {
+		if errors.Is(err, t.err) {
+			errorType = t.typ
+			break
+		}
 	}
 
 	return logrus.Fields{
 		"type":            errorType,
-		"msg":             errMsg,
+		"msg":             strings.ReplaceAll(err.Error(), errorType+": ", ""),
 		"invalidResponse": resp,
 	}
 }
@@ -0,0 +1,100 @@
+package logger
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLogErrorTimeoutTag(t *testing.T) {
+	eventLog := filepath.Join(t.TempDir(), "event_log.json")
+	l, err := New(eventLog, llm.Config{Provider: "openai", Model: "gpt-4o"}, enrich.New(enrich.Config{CacheSize: 1}), logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	l.LogError(r, "", "8080", http.StatusServiceUnavailable, fmt.Errorf("%w after 20s: context deadline exceeded", llm.ErrTimeout))
+
+	data, err := os.ReadFile(eventLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event map[string]any
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := event["tags"], []any{llm.ErrorKindTimeout}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected tags %v, got %v", want, got)
+	}
+	if got := event["error"].(map[string]any)["type"]; got != errorTimeout {
+		t.Errorf("Expected error type %q, got %v", errorTimeout, got)
+	}
+	if got := event["error"].(map[string]any)["statusCode"]; got != float64(http.StatusServiceUnavailable) {
+		t.Errorf("Expected the status code %d, got %v", http.StatusServiceUnavailable, got)
+	}
+	if got, want := event["msg"], "failedResponse: returned 503 service unavailable"; got != want {
+		t.Errorf("Expected message %q, got %v", want, got)
+	}
+}
+
+func TestErrorFields(t *testing.T) {
+	tests := []struct {
+		err      error
+		wantType string
+		wantMsg  string
+	}{
+		{fmt.Errorf("%w: unexpected end of JSON input", llm.ErrInvalidJSON), errorInvalidJSONResponse, "unexpected end of JSON input"},
+		{fmt.Errorf("openai/gpt-4o: %w", fmt.Errorf("%w: status code: 429", llm.ErrRateLimited)), errorRateLimited, "openai/gpt-4o: the llm provider rate limited the request: status code: 429"},
+		{llm.ErrBudgetExceeded, errorBudgetExceeded, "the llm budget is exceeded"},
+		{fmt.Errorf("%w: %w", llm.ErrGeneration, errors.New("bad request")), errorContentGeneration, "bad request"},
+		{errors.New("invalidJSONResponse: not a typed error"), errorContentGeneration, "invalidJSONResponse: not a typed error"},
+	}
+	for _, tt := range tests {
+		fields := errorFields(tt.err, "")
+		if fields["type"] != tt.wantType || fields["msg"] != tt.wantMsg {
+			t.Errorf("Expected %s error %q, got %v error %q", tt.wantType, tt.wantMsg, fields["type"], fields["msg"])
+		}
+	}
+}
+
+func TestLogEventBinaryBody(t *testing.T) {
+	eventLog := filepath.Join(t.TempDir(), "event_log.json")
+	l, err := New(eventLog, llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := "\x0a\x05admin\x12\x00\xff"
+	r := httptest.NewRequest("POST", "/rpc", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	l.LogEvent(r, llm.JSONResponse{StatusCode: 200}, "8080")
+
+	data, err := os.ReadFile(eventLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event struct {
+		HTTPRequest HTTPRequest `json:"httpRequest"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("Expected a valid event, got %s: %s", err, data)
+	}
+	req := event.HTTPRequest
+	if req.BodyEncoding != llm.BodyEncodingBase64 || req.Body != base64.StdEncoding.EncodeToString([]byte(body)) {
+		t.Errorf("Expected the body in base64, got %q encoded with %q", req.Body, req.BodyEncoding)
+	}
+}
@@ -0,0 +1,161 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/0x4d31/galah/internal/honeytoken"
+	"github.com/0x4d31/galah/internal/scanner"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// Metadata holds deployment metadata (e.g. honeypot name, sensor ID, region)
+// included in the event log records of a request.
+type Metadata map[string]string
+
+type (
+	metadataKey    struct{}
+	llmConfigKey   struct{}
+	tagsKey        struct{}
+	artifactsKey   struct{}
+	honeytokensKey struct{}
+	variantKey     struct{}
+	routeKey       struct{}
+	scannerKey     struct{}
+	proxyKey       struct{}
+)
+
+// WithMetadata returns a copy of ctx carrying md merged over any metadata
+// already in ctx. The metadata of the parent context is not modified.
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	if len(md) == 0 {
+		return ctx
+	}
+
+	merged := Metadata{}
+	for k, v := range MetadataFrom(ctx) {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
+
+// MetadataFrom returns the metadata carried by ctx, or nil if there is none.
+func MetadataFrom(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md
+}
+
+// WithLLMConfig returns a copy of ctx carrying the configuration of the LLM
+// provider that served the request, logged instead of the primary provider.
+func WithLLMConfig(ctx context.Context, config llm.Config) context.Context {
+	return context.WithValue(ctx, llmConfigKey{}, config)
+}
+
+func llmConfigFrom(ctx context.Context, fallback llm.Config) llm.Config {
+	if config, ok := ctx.Value(llmConfigKey{}).(llm.Config); ok {
+		return config
+	}
+	return fallback
+}
+
+// WithTags returns a copy of ctx carrying the given tags in addition to those
+// already in ctx, added to the event log records of the request.
+func WithTags(ctx context.Context, tags ...string) context.Context {
+	if len(tags) == 0 {
+		return ctx
+	}
+	merged := append(append([]string{}, TagsFrom(ctx)...), tags...)
+	return context.WithValue(ctx, tagsKey{}, merged)
+}
+
+// TagsFrom returns the tags carried by ctx, or nil if there are none.
+func TagsFrom(ctx context.Context) []string {
+	tags, _ := ctx.Value(tagsKey{}).([]string)
+	return tags
+}
+
+// WithArtifacts returns a copy of ctx carrying the files uploaded in the
+// request, referenced in its event.
+func WithArtifacts(ctx context.Context, artifacts []Artifact) context.Context {
+	if len(artifacts) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, artifactsKey{}, artifacts)
+}
+
+// ArtifactsFrom returns the uploaded files carried by ctx, or nil if there
+// are none.
+func ArtifactsFrom(ctx context.Context) []Artifact {
+	artifacts, _ := ctx.Value(artifactsKey{}).([]Artifact)
+	return artifacts
+}
+
+// WithHoneytokens returns a copy of ctx carrying the honeytokens used in the
+// request, referenced in its event.
+func WithHoneytokens(ctx context.Context, tokens []honeytoken.Token) context.Context {
+	if len(tokens) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, honeytokensKey{}, tokens)
+}
+
+// HoneytokensFrom returns the honeytokens used carried by ctx, or nil if there
+// are none.
+func HoneytokensFrom(ctx context.Context) []honeytoken.Token {
+	tokens, _ := ctx.Value(honeytokensKey{}).([]honeytoken.Token)
+	return tokens
+}
+
+// WithPromptVariant returns a copy of ctx carrying the name of the prompt
+// variant of the request, recorded in its event.
+func WithPromptVariant(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, variantKey{}, name)
+}
+
+// PromptVariantFrom returns the name of the prompt variant carried by ctx, or
+// "" if there is none.
+func PromptVariantFrom(ctx context.Context) string {
+	name, _ := ctx.Value(variantKey{}).(string)
+	return name
+}
+
+// WithModelRoute returns a copy of ctx carrying the name of the model route
+// of the request, recorded in its event.
+func WithModelRoute(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, routeKey{}, name)
+}
+
+// ModelRouteFrom returns the name of the model route carried by ctx, or ""
+// if there is none.
+func ModelRouteFrom(ctx context.Context) string {
+	name, _ := ctx.Value(routeKey{}).(string)
+	return name
+}
+
+// WithScanner returns a copy of ctx carrying the scanner identified as
+// sending the request, recorded in its event.
+func WithScanner(ctx context.Context, tool scanner.Tool) context.Context {
+	return context.WithValue(ctx, scannerKey{}, tool)
+}
+
+// ScannerFrom returns the scanner carried by ctx, and false if there is none.
+func ScannerFrom(ctx context.Context) (scanner.Tool, bool) {
+	tool, ok := ctx.Value(scannerKey{}).(scanner.Tool)
+	return tool, ok
+}
+
+// WithProxyIP returns a copy of ctx carrying the IP address of the trusted
+// proxy the request was sent by, recorded in its event.
+func WithProxyIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, proxyKey{}, ip)
+}
+
+// ProxyIPFrom returns the IP address of the proxy carried by ctx, or "" if
+// there is none.
+func ProxyIPFrom(ctx context.Context) string {
+	ip, _ := ctx.Value(proxyKey{}).(string)
+	return ip
+}
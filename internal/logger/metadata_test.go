@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestWithMetadata(t *testing.T) {
+	parent := WithMetadata(context.Background(), Metadata{"sensor": "s1", "region": "eu-west-1"})
+	child := WithMetadata(parent, Metadata{"region": "us-east-1", "honeypot": "web-01"})
+
+	want := Metadata{"sensor": "s1", "region": "us-east-1", "honeypot": "web-01"}
+	if got := MetadataFrom(child); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	wantParent := Metadata{"sensor": "s1", "region": "eu-west-1"}
+	if got := MetadataFrom(parent); !reflect.DeepEqual(got, wantParent) {
+		t.Errorf("Expected parent metadata %v, got %v", wantParent, got)
+	}
+	if got := MetadataFrom(context.Background()); got != nil {
+		t.Errorf("Expected no metadata, got %v", got)
+	}
+}
+
+func TestWithTags(t *testing.T) {
+	parent := WithTags(context.Background(), "a")
+	child := WithTags(parent, "b")
+
+	if got, want := TagsFrom(child), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got, want := TagsFrom(parent), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected parent tags %v, got %v", want, got)
+	}
+}
+
+func TestLogEventMetadata(t *testing.T) {
+	eventLog := filepath.Join(t.TempDir(), "event_log.json")
+	l, err := New(eventLog, llm.Config{Provider: "openai", Model: "gpt-4o"}, enrich.New(enrich.Config{CacheSize: 1}), logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(WithMetadata(r.Context(), Metadata{"honeypot": "web-01", "region": "eu-west-1"}))
+	l.LogEvent(r, llm.JSONResponse{Headers: map[string]string{"Server": "nginx"}, Body: "ok"}, "8080")
+	served := httptest.NewRequest("GET", "/", nil)
+	served = served.WithContext(WithLLMConfig(served.Context(), llm.Config{Provider: "ollama", Model: "llama3"}))
+	l.LogEvent(served, llm.JSONResponse{Body: "ok"}, "8080")
+
+	data, err := os.ReadFile(eventLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	var withMetadata, withoutMetadata map[string]any
+	if err := dec.Decode(&withMetadata); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&withoutMetadata); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{"honeypot": "web-01", "region": "eu-west-1"}
+	if got := withMetadata["metadata"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected metadata %v, got %v", want, got)
+	}
+	if got, ok := withoutMetadata["metadata"]; ok {
+		t.Errorf("Expected no metadata, got %v", got)
+	}
+	if got := withMetadata["llm"].(map[string]any)["provider"]; got != "openai" {
+		t.Errorf("Expected the primary provider to be logged, got %v", got)
+	}
+	if got := withoutMetadata["llm"].(map[string]any)["provider"]; got != "ollama" {
+		t.Errorf("Expected the serving provider to be logged, got %v", got)
+	}
+}
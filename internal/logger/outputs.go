@@ -0,0 +1,43 @@
+package logger
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newFormatter returns the formatter of the events sent to an output: json
+// (the default), ecs or cef.
+func newFormatter(format, version string) (logrus.Formatter, error) {
+	switch format {
+	case "", FormatJSON:
+		return &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}, nil
+	case FormatECS:
+		return &ECSFormatter{}, nil
+	case FormatCEF:
+		return &CEFFormatter{Version: version}, nil
+	}
+	return nil, fmt.Errorf("unknown event format %q (json, ecs or cef)", format)
+}
+
+// newTLSConfig returns the TLS configuration of the connections to an
+// output, verifying the certificate of the server with the CAs of the PEM
+// file if set.
+func newTLSConfig(serverName, caFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: serverName, InsecureSkipVerify: insecureSkipVerify}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the CA file: %s", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in the CA file %q", caFile)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,131 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0x4d31/galah/internal/eventstore"
+	"github.com/sirupsen/logrus"
+)
+
+// RecentEvents is a hook keeping the last events of the event log in memory,
+// for the admin API.
+type RecentEvents struct {
+	formatter logrus.JSONFormatter
+	mu        sync.Mutex
+	events    []recentEvent
+	next      int
+	full      bool
+}
+
+type recentEvent struct {
+	srcIP string
+	uri   string
+	data  json.RawMessage
+}
+
+// NewRecentEvents returns a hook keeping the last size events.
+func NewRecentEvents(size int) *RecentEvents {
+	return &RecentEvents{
+		formatter: logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano},
+		events:    make([]recentEvent, size),
+	}
+}
+
+// Levels returns the levels of the events.
+func (h *RecentEvents) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire keeps the event, replacing the oldest one once full.
+func (h *RecentEvents) Fire(entry *logrus.Entry) error {
+	if len(h.events) == 0 {
+		return nil
+	}
+	data, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	srcIP, _ := entry.Data["srcIP"].(string)
+	req, _ := entry.Data["httpRequest"].(HTTPRequest)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events[h.next] = recentEvent{srcIP: srcIP, uri: req.Request, data: bytes.TrimSpace(data)}
+	h.next = (h.next + 1) % len(h.events)
+	if h.next == 0 {
+		h.full = true
+	}
+	return nil
+}
+
+// kept returns the kept events, newest first. h.mu must be held.
+func (h *RecentEvents) kept() []recentEvent {
+	n := h.next
+	if h.full {
+		n = len(h.events)
+	}
+	events := make([]recentEvent, 0, n)
+	for i := 1; i <= n; i++ {
+		events = append(events, h.events[(h.next-i+len(h.events))%len(h.events)])
+	}
+	return events
+}
+
+// Events returns the events of the source IP, or of all the sources if
+// empty, newest first. It returns all the kept events if limit is 0.
+func (h *RecentEvents) Events(srcIP string, limit int) []json.RawMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	events := []json.RawMessage{}
+	for _, e := range h.kept() {
+		if limit > 0 && len(events) == limit {
+			break
+		}
+		if srcIP == "" || e.srcIP == srcIP {
+			events = append(events, e.data)
+		}
+	}
+	return events
+}
+
+// TopSources returns the source IPs of the most kept request events, at most
+// limit if positive.
+func (h *RecentEvents) TopSources(limit int) []eventstore.Count {
+	return h.top(func(e recentEvent) string { return e.srcIP }, limit)
+}
+
+// TopPaths returns the request URIs of the most kept request events, at most
+// limit if positive.
+func (h *RecentEvents) TopPaths(limit int) []eventstore.Count {
+	return h.top(func(e recentEvent) string { return e.uri }, limit)
+}
+
+func (h *RecentEvents) top(value func(recentEvent) string, limit int) []eventstore.Count {
+	h.mu.Lock()
+	counts := make(map[string]int)
+	for _, e := range h.kept() {
+		if v := value(e); v != "" {
+			counts[v]++
+		}
+	}
+	h.mu.Unlock()
+
+	top := make([]eventstore.Count, 0, len(counts))
+	for v, n := range counts {
+		top = append(top, eventstore.Count{Value: v, Count: n})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Value < top[j].Value
+	})
+	if limit > 0 && len(top) > limit {
+		top = top[:limit]
+	}
+	return top
+}
@@ -0,0 +1,37 @@
+package logger
+
+import (
+	"io"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/eventstore"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRecentEvents(t *testing.T) {
+	recent := NewRecentEvents(3)
+	l := logrus.New()
+	l.Out = io.Discard
+	l.AddHook(recent)
+	for _, e := range []struct{ ip, uri string }{
+		{"192.0.2.1", "/old"},
+		{"192.0.2.1", "/.env"},
+		{"192.0.2.2", "/wp-login.php"},
+		{"192.0.2.1", "/.env"},
+	} {
+		l.WithFields(logrus.Fields{"srcIP": e.ip, "httpRequest": HTTPRequest{Request: e.uri}}).Info("successfulResponse")
+	}
+
+	if got := recent.Events("", 0); len(got) != 3 {
+		t.Errorf("Expected the 3 last events, got %d", len(got))
+	}
+	if got := recent.Events("192.0.2.1", 1); len(got) != 1 {
+		t.Errorf("Expected 1 event of the source, got %d", len(got))
+	}
+	if got := recent.TopPaths(0); len(got) != 2 || got[0] != (eventstore.Count{Value: "/.env", Count: 2}) {
+		t.Errorf("Unexpected top paths: %+v", got)
+	}
+	if got := recent.TopSources(1); len(got) != 1 || got[0] != (eventstore.Count{Value: "192.0.2.1", Count: 2}) {
+		t.Errorf("Unexpected top sources: %+v", got)
+	}
+}
@@ -0,0 +1,278 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// DefaultRedaction is the replacement of the redacted values.
+const DefaultRedaction = "[REDACTED]"
+
+// DefaultRedactedHeaders are the headers redacted if none is configured.
+var DefaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Auth-Token",
+	"X-Amz-Security-Token",
+}
+
+// DefaultRedactedFields are the query, form and JSON fields redacted if none
+// is configured.
+var DefaultRedactedFields = []string{
+	"password",
+	"passwd",
+	"pass",
+	"pwd",
+	"secret",
+	"client_secret",
+	"token",
+	"access_token",
+	"refresh_token",
+	"id_token",
+	"api_key",
+	"apikey",
+	"private_key",
+}
+
+// RedactConfig configures the redaction of the events. The values of the
+// Headers and the Fields of the queries, form and JSON bodies, matched
+// case-insensitively, are replaced with Replacement, DefaultRedaction if
+// empty, keeping the schemes of the authorization headers and the names of
+// the cookies. The matches of the Patterns, regular expressions, are
+// replaced in the URIs, headers and bodies of the requests and responses.
+type RedactConfig struct {
+	Headers     []string
+	Fields      []string
+	Patterns    []string
+	Replacement string
+}
+
+// Redactor redacts the credentials, cookies and tokens of the events.
+type Redactor struct {
+	headers     map[string]bool
+	fields      map[string]bool
+	patterns    []*regexp.Regexp
+	replacement string
+}
+
+// NewRedactor returns the Redactor of the configuration.
+func NewRedactor(cfg RedactConfig) (*Redactor, error) {
+	rd := &Redactor{
+		headers:     make(map[string]bool),
+		fields:      make(map[string]bool),
+		replacement: cfg.Replacement,
+	}
+	if rd.replacement == "" {
+		rd.replacement = DefaultRedaction
+	}
+	for _, h := range cfg.Headers {
+		rd.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, f := range cfg.Fields {
+		rd.fields[strings.ToLower(f)] = true
+	}
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		rd.patterns = append(rd.patterns, re)
+	}
+	return rd, nil
+}
+
+// SetRedaction redacts the events logged from now on with the configuration.
+func (l *Logger) SetRedaction(cfg RedactConfig) error {
+	rd, err := NewRedactor(cfg)
+	if err != nil {
+		return err
+	}
+	l.Redactor = rd
+	return nil
+}
+
+// String replaces the matches of the patterns in s.
+func (rd *Redactor) String(s string) string {
+	for _, re := range rd.patterns {
+		s = re.ReplaceAllLiteralString(s, rd.replacement)
+	}
+	return s
+}
+
+// Header returns a copy of the headers with the values of the redacted
+// headers replaced, and the patterns replaced in the others.
+func (rd *Redactor) Header(h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for key, values := range h {
+		redacted[key] = make([]string, len(values))
+		for i, v := range values {
+			redacted[key][i] = rd.headerValue(key, v)
+		}
+	}
+	return redacted
+}
+
+// headerValue redacts the value of the header.
+func (rd *Redactor) headerValue(key, value string) string {
+	key = http.CanonicalHeaderKey(key)
+	if !rd.headers[key] {
+		return rd.String(value)
+	}
+	switch key {
+	case "Cookie":
+		return rd.cookies(value, false)
+	case "Set-Cookie":
+		return rd.cookies(value, true)
+	case "Authorization", "Proxy-Authorization":
+		if scheme, _, ok := strings.Cut(value, " "); ok {
+			return scheme + " " + rd.replacement
+		}
+	}
+	return rd.replacement
+}
+
+// cookies replaces the values of the cookies, keeping their names, and the
+// attributes after the cookie of the Set-Cookie headers if setCookie is true.
+func (rd *Redactor) cookies(value string, setCookie bool) string {
+	pairs := strings.Split(value, ";")
+	for i, pair := range pairs {
+		if setCookie && i > 0 {
+			break
+		}
+		if name, _, ok := strings.Cut(pair, "="); ok {
+			pairs[i] = name + "=" + rd.replacement
+		}
+	}
+	return strings.Join(pairs, ";")
+}
+
+// URI redacts the values of the redacted fields of the query of the URI.
+func (rd *Redactor) URI(uri string) string {
+	path, query, ok := strings.Cut(uri, "?")
+	if ok {
+		uri = path + "?" + rd.query(query)
+	}
+	return rd.String(uri)
+}
+
+// query redacts the values of the redacted fields of the URL-encoded query,
+// keeping the order and the encoding of the others.
+func (rd *Redactor) query(query string) string {
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		key, _, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if name, err := url.QueryUnescape(key); err == nil && rd.fields[strings.ToLower(name)] {
+			pairs[i] = key + "=" + url.QueryEscape(rd.replacement)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// Body redacts the redacted fields of the form bodies, of the content type,
+// and of the JSON bodies, and replaces the patterns.
+func (rd *Redactor) Body(body, contentType string) string {
+	if body == "" {
+		return body
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		body = rd.query(body)
+	} else {
+		body = rd.json(body)
+	}
+	return rd.String(body)
+}
+
+// json redacts the values of the redacted fields of the JSON document, at
+// any depth. The documents without redacted fields are kept as they are.
+func (rd *Redactor) json(body string) string {
+	if len(rd.fields) == 0 || !json.Valid([]byte(body)) {
+		return body
+	}
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return body
+	}
+	if !rd.jsonValue(v) {
+		return body
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return body
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// jsonValue redacts the redacted fields of the decoded JSON value, and
+// reports whether any was.
+func (rd *Redactor) jsonValue(v any) bool {
+	redacted := false
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if rd.fields[strings.ToLower(key)] {
+				v[key] = rd.replacement
+				redacted = true
+			} else if rd.jsonValue(value) {
+				redacted = true
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if rd.jsonValue(value) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
+
+// Credentials returns a copy of the harvested credentials with their
+// passwords and tokens redacted, keeping the usernames.
+func (rd *Redactor) Credentials(creds []Credential) []Credential {
+	redacted := make([]Credential, len(creds))
+	for i, c := range creds {
+		if c.Password != "" {
+			c.Password = rd.replacement
+		}
+		if c.Token != "" {
+			c.Token = rd.replacement
+		}
+		redacted[i] = c
+	}
+	return redacted
+}
+
+// Response returns a copy of the response with its headers and body
+// redacted. The base64-encoded bodies are kept.
+func (rd *Redactor) Response(resp llm.JSONResponse) llm.JSONResponse {
+	headers := make(map[string]string, len(resp.Headers))
+	contentType := ""
+	for key, value := range resp.Headers {
+		headers[key] = rd.headerValue(key, value)
+		if strings.EqualFold(key, "Content-Type") {
+			contentType = value
+		}
+	}
+	resp.Headers = headers
+	if resp.Encoding != llm.EncodingBase64 {
+		resp.Body = rd.Body(resp.Body, contentType)
+	}
+	return resp
+}
@@ -0,0 +1,215 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const backupTimeFormat = "20060102T150405.000"
+
+// RotateConfig configures the rotation of the event log. The file is rotated
+// once it exceeds MaxSize bytes, or at the end of each Interval, if set. The
+// rotated files are renamed with the time of their rotation (e.g.
+// event_log-20240526T190000.000.json), compressed with gzip if Compress is
+// true, and passed to Archive, if set. Only the MaxBackups most recent
+// rotated files are kept, if set.
+type RotateConfig struct {
+	MaxSize    int64
+	Interval   time.Duration
+	MaxBackups int
+	Compress   bool
+	Archive    func(path string) error
+}
+
+// RotatingFile is a file rotated by size or time, safe for concurrent use.
+// The rotated files are compressed, archived and pruned in the background.
+type RotatingFile struct {
+	path   string
+	cfg    RotateConfig
+	logger *logrus.Logger
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	period time.Time
+
+	rotated chan string
+	done    chan struct{}
+}
+
+// OpenRotatingFile opens the file at the given path, appending to it. The
+// errors processing the rotated files are logged to logger.
+func OpenRotatingFile(path string, cfg RotateConfig, logger *logrus.Logger) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:    path,
+		cfg:     cfg,
+		logger:  logger,
+		rotated: make(chan string, 64),
+		done:    make(chan struct{}),
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	go f.run()
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	// An existing file belongs to the period it was last written in.
+	f.period = f.periodOf(info.ModTime())
+	if f.size == 0 {
+		f.period = f.periodOf(time.Now())
+	}
+	return nil
+}
+
+func (f *RotatingFile) periodOf(t time.Time) time.Time {
+	if f.cfg.Interval <= 0 {
+		return time.Time{}
+	}
+	return t.Truncate(f.cfg.Interval)
+}
+
+// Write writes p to the file, rotating it first if p would exceed its
+// maximum size or the interval has ended.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.size > 0 && (f.cfg.MaxSize > 0 && f.size+int64(len(p)) > f.cfg.MaxSize ||
+		!f.periodOf(time.Now()).Equal(f.period)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotate()
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(f.path)
+	backup := strings.TrimSuffix(f.path, ext) + "-" + time.Now().UTC().Format(backupTimeFormat) + ext
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	select {
+	case f.rotated <- backup:
+	default:
+		f.logger.Errorf("too many rotated event logs to process, keeping %s as is", backup)
+	}
+	return nil
+}
+
+// Close closes the file, after processing the rotated files.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	close(f.rotated)
+	<-f.done
+	return f.file.Close()
+}
+
+func (f *RotatingFile) run() {
+	defer close(f.done)
+	for path := range f.rotated {
+		if f.cfg.Compress {
+			compressed, err := compress(path)
+			if err != nil {
+				f.logger.Errorf("error compressing the rotated event log %s: %s", path, err)
+			} else {
+				path = compressed
+			}
+		}
+		if f.cfg.Archive != nil {
+			if err := f.cfg.Archive(path); err != nil {
+				f.logger.Errorf("error archiving the rotated event log %s: %s", path, err)
+			}
+		}
+		if f.cfg.MaxBackups > 0 {
+			f.prune()
+		}
+	}
+}
+
+// prune removes the oldest rotated files beyond MaxBackups.
+func (f *RotatingFile) prune() {
+	ext := filepath.Ext(f.path)
+	backups, err := filepath.Glob(escapeGlob(strings.TrimSuffix(f.path, ext)) + "-*" + ext + "*")
+	if err != nil {
+		return
+	}
+	// The names sort by the time of their rotation.
+	sort.Strings(backups)
+	for len(backups) > f.cfg.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			f.logger.Errorf("error removing the rotated event log %s: %s", backups[0], err)
+		}
+		backups = backups[1:]
+	}
+}
+
+// compress compresses the file with gzip, replacing it with the returned
+// path.
+func compress(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz.tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(path+".gz.tmp", path+".gz")
+	}
+	if err != nil {
+		os.Remove(path + ".gz.tmp")
+		return "", err
+	}
+	os.Remove(path)
+	return path + ".gz", nil
+}
+
+func escapeGlob(s string) string {
+	return strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`).Replace(s)
+}
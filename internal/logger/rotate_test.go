@@ -0,0 +1,90 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "event_log.json")
+	var archived []string
+	f, err := OpenRotatingFile(path, RotateConfig{
+		MaxSize:    10,
+		MaxBackups: 2,
+		Compress:   true,
+		Archive: func(path string) error {
+			archived = append(archived, path)
+			return nil
+		},
+	}, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"event 1\n", "event 2\n", "event 3\n", "event 4\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		// The rotated files are named by the millisecond of their rotation.
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := os.ReadFile(path); string(b) != "event 4\n" {
+		t.Errorf("Unexpected content of the current file: %q", b)
+	}
+	if len(archived) != 3 {
+		t.Fatalf("Expected 3 archived files, got %v", archived)
+	}
+	for _, p := range archived {
+		if !strings.HasPrefix(filepath.Base(p), "event_log-") || !strings.HasSuffix(p, ".json.gz") {
+			t.Errorf("Unexpected name of the rotated file %s", p)
+		}
+	}
+	backups, _ := filepath.Glob(filepath.Join(dir, "event_log-*"))
+	if len(backups) != 2 || backups[0] != archived[1] || backups[1] != archived[2] {
+		t.Fatalf("Expected the 2 most recent backups, got %v", backups)
+	}
+	r, err := os.Open(backups[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(zr); string(b) != "event 3\n" {
+		t.Errorf("Unexpected content of the rotated file: %q", b)
+	}
+}
+
+func TestRotatingFileInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "event_log.json")
+	f, err := OpenRotatingFile(path, RotateConfig{Interval: time.Hour}, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("event 1\n"))
+	// The file was written in the previous period.
+	f.period = f.period.Add(-time.Hour)
+	f.Write([]byte("event 2\n"))
+	f.Close()
+
+	backups, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "event_log-*.json"))
+	if len(backups) != 1 {
+		t.Fatalf("Expected 1 rotated file, got %v", backups)
+	}
+	if b, _ := os.ReadFile(backups[0]); string(b) != "event 1\n" {
+		t.Errorf("Unexpected content of the rotated file: %q", b)
+	}
+}
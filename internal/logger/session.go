@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/0x4d31/galah/internal/fingerprint"
+	"github.com/0x4d31/galah/internal/session"
+)
+
+// SessionTag tags the events of the flagged sessions.
+const SessionTag = "interactive_session"
+
+// JSChallengeTag tags the events of the requests answering the JavaScript
+// challenge of the sessions.
+const JSChallengeTag = "js_challenge"
+
+// recordSession records the request in its session, identified by the
+// source, the TLS fingerprint and the user agent of the client, and returns
+// the state of the session.
+func (l *Logger) recordSession(r *http.Request, srcIP string, body []byte, techniques []Technique, scanner bool) session.Info {
+	client := ClientFingerprint(r)
+	// The variants are hashed before the redaction, which would make the
+	// probed values alike.
+	variant := sha256.Sum256(append([]byte(r.URL.RawQuery+"\n"), body...))
+	ids := make([]string, len(techniques))
+	for i, t := range techniques {
+		ids[i] = t.ID
+	}
+	return l.Sessions.Record(session.Request{
+		Source:      srcIP,
+		Fingerprint: client,
+		Time:        time.Now(),
+		Method:      r.Method,
+		Path:        r.URL.Path,
+		Variant:     hex.EncodeToString(variant[:8]),
+		Cookie:      r.Header.Get("Cookie") != "",
+		Scanner:     scanner,
+		Referer:     r.Header.Get("Referer") != "",
+		JSChallenge: slices.Contains(TagsFrom(r.Context()), JSChallengeTag),
+		Techniques:  ids,
+	})
+}
+
+// ClientFingerprint returns the fingerprint of the client of the request in
+// its session: its TLS fingerprint and user agent.
+func ClientFingerprint(r *http.Request) string {
+	client := r.UserAgent()
+	if fp := fingerprint.TLSFrom(r.Context()); fp != nil {
+		client = fp.JA3Hash + " " + client
+	}
+	return client
+}
@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/session"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLogEventSession(t *testing.T) {
+	eventLog := filepath.Join(t.TempDir(), "event_log.json")
+	l, err := New(eventLog, llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Sessions = session.NewTracker(session.Config{Threshold: 20})
+
+	// The techniques of the rce tag and of the credentials score 15, and the
+	// two methods 10.
+	r := httptest.NewRequest("GET", "/", nil)
+	l.LogEvent(r, llm.JSONResponse{Body: "ok"}, "8080")
+	r = httptest.NewRequest("POST", "/login", strings.NewReader("user=admin&password=admin"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r = r.WithContext(WithTags(r.Context(), llm.PayloadRCE))
+	l.LogEvent(r, llm.JSONResponse{Body: "ok"}, "8080")
+
+	data, err := os.ReadFile(eventLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(lines))
+	}
+	var events [2]struct {
+		Tags    []string     `json:"tags"`
+		Session session.Info `json:"session"`
+	}
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if events[0].Session.ID == "" || events[0].Session.ID != events[1].Session.ID {
+		t.Errorf("Expected the events in the same session, got %+v and %+v", events[0].Session, events[1].Session)
+	}
+	if events[0].Session.Flagged || slices.Contains(events[0].Tags, SessionTag) {
+		t.Errorf("Expected the first event not flagged, got %+v", events[0])
+	}
+	if s := events[1].Session; !s.Flagged || s.Requests != 2 || s.Score != 25 {
+		t.Errorf("Expected the session flagged after 2 requests with a score of 25, got %+v", s)
+	}
+	if !slices.Contains(events[1].Tags, SessionTag) {
+		t.Errorf("Expected the event of the flagged session tagged %q, got %v", SessionTag, events[1].Tags)
+	}
+}
@@ -0,0 +1,221 @@
+package logger
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// syslogQueueSize is the number of events waiting to be sent to the
+	// syslog server, after which the events are dropped.
+	syslogQueueSize = 1024
+	syslogTimeout   = 5 * time.Second
+	// syslogTimestamp is the RFC 5424 timestamp, limited to microseconds.
+	syslogTimestamp = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "local0": 16, "local1": 17, "local2": 18,
+	"local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogConfig configures the syslog output of the events. Network is udp
+// (the default), tcp or tls, and Address the host:port of the syslog server.
+// The events are formatted in Format: json (the default), ecs or cef.
+// Facility is the name of the syslog facility (local0 if empty). CAFile is
+// the PEM file of the CAs verifying the server certificate over TLS (the
+// system's if empty).
+type SyslogConfig struct {
+	Network            string
+	Address            string
+	Format             string
+	Facility           string
+	AppName            string
+	CAFile             string
+	InsecureSkipVerify bool
+	// Version is the version of Galah in the CEF records.
+	Version string
+}
+
+// SyslogHook is a logrus hook sending the events to a syslog server, in the
+// RFC 5424 format. The messages are framed by octet counting (RFC 6587) over
+// TCP and TLS. The events are sent in the background, so a slow or
+// unreachable server doesn't delay the responses.
+type SyslogHook struct {
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	formatter logrus.Formatter
+	facility  int
+	appName   string
+	hostname  string
+	logger    *logrus.Logger
+
+	queue   chan []byte
+	done    chan struct{}
+	conn    net.Conn
+	dropped sync.Once
+}
+
+// NewSyslogHook returns a hook sending the events to the syslog server of the
+// configuration. The errors sending them are logged to logger.
+func NewSyslogHook(cfg SyslogConfig, logger *logrus.Logger) (*SyslogHook, error) {
+	h := &SyslogHook{
+		network: cfg.Network,
+		address: cfg.Address,
+		appName: cfg.AppName,
+		logger:  logger,
+		queue:   make(chan []byte, syslogQueueSize),
+		done:    make(chan struct{}),
+	}
+	if h.network == "" {
+		h.network = "udp"
+	}
+	if h.appName == "" {
+		h.appName = "galah"
+	}
+	if h.hostname, _ = os.Hostname(); h.hostname == "" {
+		h.hostname = "-"
+	}
+
+	switch h.network {
+	case "udp", "tcp":
+	case "tls":
+		host, _, err := net.SplitHostPort(cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid syslog address %q: %s", cfg.Address, err)
+		}
+		if h.tlsConfig, err = newTLSConfig(host, cfg.CAFile, cfg.InsecureSkipVerify); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown syslog network %q (udp, tcp or tls)", cfg.Network)
+	}
+
+	facility := cfg.Facility
+	if facility == "" {
+		facility = "local0"
+	}
+	var ok bool
+	if h.facility, ok = syslogFacilities[facility]; !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", cfg.Facility)
+	}
+
+	var err error
+	if h.formatter, err = newFormatter(cfg.Format, cfg.Version); err != nil {
+		return nil, err
+	}
+
+	go h.run()
+	return h, nil
+}
+
+// Levels returns the levels of the events sent to the syslog server.
+func (h *SyslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire queues the event to be sent to the syslog server. The event is dropped
+// if the queue is full.
+func (h *SyslogHook) Fire(entry *logrus.Entry) error {
+	msg, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	select {
+	case h.queue <- h.message(entry, msg):
+	default:
+		h.dropped.Do(func() {
+			h.logger.Errorf("the syslog events queue is full, dropping the events")
+		})
+	}
+	return nil
+}
+
+// Close sends the queued events and closes the connection to the server.
+func (h *SyslogHook) Close() error {
+	close(h.queue)
+	<-h.done
+	return nil
+}
+
+// message returns the RFC 5424 message of the event.
+func (h *SyslogHook) message(entry *logrus.Entry, msg []byte) []byte {
+	msgID, _, _ := strings.Cut(entry.Message, ":")
+	if msgID == "" || len(msgID) > 32 || strings.ContainsAny(msgID, " \t\r\n") {
+		msgID = "-"
+	}
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s - ",
+		h.facility*8+syslogSeverity(entry.Level), entry.Time.Format(syslogTimestamp), h.hostname, h.appName, os.Getpid(), msgID)
+	return append([]byte(header), strings.TrimRight(string(msg), "\n")...)
+}
+
+func (h *SyslogHook) run() {
+	defer close(h.done)
+	for msg := range h.queue {
+		// Stream connections are reopened once if the server closed them.
+		err := h.write(msg)
+		if err != nil && h.network != "udp" {
+			err = h.write(msg)
+		}
+		if err != nil {
+			h.logger.Errorf("error sending the event to the syslog server %s: %s", h.address, err)
+		}
+	}
+	if h.conn != nil {
+		h.conn.Close()
+	}
+}
+
+func (h *SyslogHook) write(msg []byte) error {
+	if h.conn == nil {
+		dialer := &net.Dialer{Timeout: syslogTimeout}
+		var err error
+		if h.tlsConfig != nil {
+			h.conn, err = tls.DialWithDialer(dialer, "tcp", h.address, h.tlsConfig)
+		} else {
+			h.conn, err = dialer.Dial(h.network, h.address)
+		}
+		if err != nil {
+			h.conn = nil
+			return err
+		}
+	}
+	if h.network != "udp" {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	h.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	if _, err := h.conn.Write(msg); err != nil {
+		h.conn.Close()
+		h.conn = nil
+		return err
+	}
+	return nil
+}
+
+// syslogSeverity returns the syslog severity of the logrus level.
+func syslogSeverity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return 0
+	case logrus.FatalLevel:
+		return 2
+	case logrus.ErrorLevel:
+		return 3
+	case logrus.WarnLevel:
+		return 4
+	case logrus.InfoLevel:
+		return 6
+	default:
+		return 7
+	}
+}
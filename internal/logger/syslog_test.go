@@ -0,0 +1,131 @@
+package logger
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSyslogHook(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+
+	tests := []struct {
+		network string
+		address string
+		read    func() (string, error)
+	}{
+		{
+			network: "udp",
+			address: udp.LocalAddr().String(),
+			read: func() (string, error) {
+				buf := make([]byte, 64*1024)
+				udp.SetReadDeadline(time.Now().Add(5 * time.Second))
+				n, _, err := udp.ReadFrom(buf)
+				return string(buf[:n]), err
+			},
+		},
+		{
+			network: "tcp",
+			address: tcp.Addr().String(),
+			read: func() (string, error) {
+				conn, err := tcp.Accept()
+				if err != nil {
+					return "", err
+				}
+				defer conn.Close()
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				r := bufio.NewReader(conn)
+				length, err := r.ReadString(' ')
+				if err != nil {
+					return "", err
+				}
+				n, err := strconv.Atoi(strings.TrimSpace(length))
+				if err != nil {
+					return "", err
+				}
+				buf := make([]byte, n)
+				_, err = io.ReadFull(r, buf)
+				return string(buf), err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.network, func(t *testing.T) {
+			l, err := New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{Provider: "openai", Model: "gpt-4o"}, enrich.New(enrich.Config{CacheSize: 1}), logrus.New())
+			if err != nil {
+				t.Fatal(err)
+			}
+			hook, err := NewSyslogHook(SyslogConfig{Network: tt.network, Address: tt.address, Format: FormatCEF, Version: "1.0"}, logrus.New())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer hook.Close()
+			l.EventLogger.AddHook(hook)
+
+			r := httptest.NewRequest("GET", "/index.php?a=b=c", nil)
+			r.RemoteAddr = "192.0.2.1:51234"
+			r.Header.Set("User-Agent", "curl/8.0")
+			l.LogEvent(r, llm.JSONResponse{StatusCode: 404, Body: "not found"}, "8080")
+
+			msg, err := tt.read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(msg, "<134>1 ") {
+				t.Errorf("Expected the local0.info priority, got %q", msg)
+			}
+			fields := strings.SplitN(msg, " ", 8)
+			if len(fields) != 8 || fields[3] != "galah" || fields[5] != "successfulResponse" || fields[6] != "-" {
+				t.Fatalf("Unexpected RFC 5424 header: %q", msg)
+			}
+			for _, want := range []string{
+				"CEF:0|Galah|Galah|1.0|successfulResponse|HTTP request answered|3|rt=",
+				" src=192.0.2.1 spt=51234 ",
+				" dpt=8080 ",
+				` request=/index.php?a\=b\=c `,
+				" requestClientApplication=curl/8.0 ",
+				" cn1=404 cn1Label=statusCode ",
+				" out=9 ",
+			} {
+				if !strings.Contains(fields[7], want) {
+					t.Errorf("Expected %q in the CEF record, got %q", want, fields[7])
+				}
+			}
+		})
+	}
+
+	if _, err := NewSyslogHook(SyslogConfig{Network: "quic", Address: "127.0.0.1:514"}, logrus.New()); err == nil {
+		t.Error("Expected an error for an unknown network")
+	}
+	if _, err := NewSyslogHook(SyslogConfig{Address: "127.0.0.1:514", Facility: "local9"}, logrus.New()); err == nil {
+		t.Error("Expected an error for an unknown facility")
+	}
+}
+
+func TestCEFEscape(t *testing.T) {
+	if got, want := cefHeader(`a|b\c`+"\n"), `a\|b\\c `; got != want {
+		t.Errorf("cefHeader() = %q, want %q", got, want)
+	}
+	if got, want := cefExtension("a=b\\c\r\nd|e"), `a\=b\\c\r\nd|e`; got != want {
+		t.Errorf("cefExtension() = %q, want %q", got, want)
+	}
+}
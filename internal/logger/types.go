@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"github.com/0x4d31/galah/internal/session"
 	"github.com/0x4d31/galah/pkg/enrich"
 	"github.com/0x4d31/galah/pkg/llm"
 	"github.com/sirupsen/logrus"
@@ -12,24 +13,54 @@ type Logger struct {
 	EventLogger *logrus.Logger
 	LLMConfig   llm.Config
 	Logger      *logrus.Logger
+	// Redactor, if set, redacts the events before they are written to the
+	// event log and the outputs.
+	Redactor *Redactor
+	// Techniques map the tags of the events to the IDs of the ATT&CK
+	// techniques, DefaultTechniques if nil.
+	Techniques map[string][]string
+	// Sessions, if set, groups the events into scored sessions.
+	Sessions *session.Tracker
 }
 
 // HTTPRequest contains information about the HTTP request.
 type HTTPRequest struct {
 	Body                string `json:"body"`
+	BodyEncoding        string `json:"bodyEncoding,omitempty"`
 	BodySha256          string `json:"bodySha256"`
 	Headers             string `json:"headers"`
 	HeadersSorted       string `json:"headersSorted"`
 	HeadersSortedSha256 string `json:"headersSortedSha256"`
+	JA4H                string `json:"ja4h"`
 	Method              string `json:"method"`
 	ProtocolVersion     string `json:"protocolVersion"`
 	Request             string `json:"request"`
 	UserAgent           string `json:"userAgent"`
 }
 
+// Artifact is a file uploaded in a multipart request, stored at Path unless
+// it exceeds the size limit.
+type Artifact struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        int64  `json:"size"`
+	Sha256      string `json:"sha256"`
+	Path        string `json:"path,omitempty"`
+}
+
+// WebSocket contains a message of a WebSocket session and its replies.
+type WebSocket struct {
+	Message string   `json:"message"`
+	Replies []string `json:"replies"`
+}
+
 // LLM contains information about the large language model.
 type LLM struct {
 	Model       string  `json:"model"`
 	Provider    string  `json:"provider"`
 	Temperature float64 `json:"temperature"`
+	Seed        int     `json:"seed,omitempty"`
+	TopP        float64 `json:"topP,omitempty"`
+	Route       string  `json:"route,omitempty"`
 }
@@ -0,0 +1,147 @@
+// Package metrics implements the counters and histograms of the honeypot,
+// exposed in the Prometheus text format with the Prometheus client.
+package metrics
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// The caches of the lookups.
+const (
+	CacheExact    = "exact"
+	CacheSemantic = "semantic"
+)
+
+// generationBuckets are the upper bounds, in seconds, of the generation
+// latency buckets.
+var generationBuckets = []float64{0.25, 0.5, 1, 2, 3, 5, 8, 13, 21, 34, 60}
+
+// Metrics are the metrics of the honeypot. The methods of a nil Metrics
+// record nothing.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests     *prometheus.CounterVec
+	cacheLookups *prometheus.CounterVec
+	generations  *prometheus.HistogramVec
+	errors       *prometheus.CounterVec
+
+	// The lookups of the exact cache, for the hit ratio.
+	exactHits, exactMisses atomic.Uint64
+}
+
+// New returns the metrics of the honeypot, with the token usage and
+// estimated cost of the models collected from usage, if not nil.
+func New(usage *llm.UsageTracker) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "galah_http_requests_total",
+			Help: "HTTP requests received, by port and persona.",
+		}, []string{"port", "persona"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "galah_cache_lookups_total",
+			Help: "Lookups of the response caches, by cache (exact or semantic) and result (hit or miss).",
+		}, []string{"cache", "result"}),
+		generations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "galah_llm_generation_duration_seconds",
+			Help:    "Latency of the generations of the LLM providers, by provider and model.",
+			Buckets: generationBuckets,
+		}, []string{"provider", "model"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "galah_llm_errors_total",
+			Help: "Failed generations of the LLM providers, by provider and error kind.",
+		}, []string{"provider", "kind"}),
+	}
+	m.Registry.MustRegister(m.requests, m.cacheLookups, m.generations, m.errors)
+	m.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "galah_cache_hit_ratio",
+		Help: "Ratio of the lookups of the exact response cache that were hits.",
+	}, func() float64 {
+		hits := float64(m.exactHits.Load())
+		total := hits + float64(m.exactMisses.Load())
+		if total == 0 {
+			return 0
+		}
+		return hits / total
+	}))
+	if usage != nil {
+		m.Registry.MustRegister(&usageCollector{usage: usage})
+	}
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// Request counts a request received on the port, answered by the persona.
+func (m *Metrics) Request(port, persona string) {
+	if m != nil {
+		m.requests.WithLabelValues(port, persona).Inc()
+	}
+}
+
+// CacheLookup counts a lookup of the cache.
+func (m *Metrics) CacheLookup(cache string, hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(cache, result).Inc()
+	if cache == CacheExact {
+		if hit {
+			m.exactHits.Add(1)
+		} else {
+			m.exactMisses.Add(1)
+		}
+	}
+}
+
+// Generation records the latency of a generation of the provider, or its
+// error.
+func (m *Metrics) Generation(config llm.Config, seconds float64, err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		m.errors.WithLabelValues(config.Provider, llm.ErrorKind(err)).Inc()
+		return
+	}
+	m.generations.WithLabelValues(config.Provider, config.Model).Observe(seconds)
+}
+
+var (
+	tokensDesc = prometheus.NewDesc("galah_llm_tokens_total",
+		"Tokens used by the generations, by model and type (prompt or completion).", []string{"model", "type"}, nil)
+	costDesc = prometheus.NewDesc("galah_llm_estimated_cost_dollars_total",
+		"Estimated cost of the generations in US dollars, by model.", []string{"model"}, nil)
+)
+
+// usageCollector collects the token usage and estimated cost of the models
+// from the usage tracker when scraped.
+type usageCollector struct {
+	usage *llm.UsageTracker
+}
+
+func (c *usageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tokensDesc
+	ch <- costDesc
+}
+
+func (c *usageCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, u := range c.usage.Totals().Models {
+		ch <- prometheus.MustNewConstMetric(tokensDesc, prometheus.CounterValue, float64(u.PromptTokens), name, "prompt")
+		ch <- prometheus.MustNewConstMetric(tokensDesc, prometheus.CounterValue, float64(u.CompletionTokens), name, "completion")
+		ch <- prometheus.MustNewConstMetric(costDesc, prometheus.CounterValue, u.Cost, name)
+	}
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// usageModel reports the token usage of its generations.
+type usageModel struct{}
+
+func (usageModel) Call(context.Context, string, ...llms.CallOption) (string, error) {
+	return "", nil
+}
+
+func (usageModel) GenerateContent(context.Context, []llms.MessageContent, ...llms.CallOption) (*llms.ContentResponse, error) {
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		Content:        `{"headers": {}, "body": "ok"}`,
+		GenerationInfo: map[string]any{"PromptTokens": 1000, "CompletionTokens": 200},
+	}}}, nil
+}
+
+func TestMetrics(t *testing.T) {
+	usage := llm.NewUsageTracker()
+	m := New(usage)
+	m.Request("8080", "default")
+	m.CacheLookup(CacheExact, true)
+	m.CacheLookup(CacheExact, false)
+	m.CacheLookup(CacheExact, false)
+	m.CacheLookup(CacheSemantic, true)
+	config := llm.Config{Provider: "openai", Model: "gpt-4o"}
+	m.Generation(config, 1.5, nil)
+	m.Generation(config, 0, llm.ErrRateLimited)
+	if _, err := usage.Wrap(usageModel{}, "gpt-4o").GenerateContent(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		`galah_http_requests_total{persona="default",port="8080"} 1`,
+		`galah_cache_lookups_total{cache="exact",result="miss"} 2`,
+		`galah_cache_hit_ratio 0.3333333333333333`,
+		`galah_llm_generation_duration_seconds_bucket{model="gpt-4o",provider="openai",le="2"} 1`,
+		`galah_llm_errors_total{kind="` + llm.ErrorKind(llm.ErrRateLimited) + `",provider="openai"} 1`,
+		`# TYPE galah_llm_tokens_total counter`,
+		`galah_llm_tokens_total{model="gpt-4o",type="prompt"} 1000`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected %q in the metrics:\n%s", line, body)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+
+	// A nil Metrics records nothing.
+	var nilMetrics *Metrics
+	nilMetrics.Request("8080", "default")
+	nilMetrics.Generation(config, 1, errors.New("error"))
+}
@@ -0,0 +1,192 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultTimeout is the time allowed to receive the header if not set.
+const defaultTimeout = 5 * time.Second
+
+// maxV1HeaderSize is the maximum size of a v1 header, including the CRLF.
+const maxV1HeaderSize = 107
+
+// v2Signature starts the v2 headers.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrInvalidHeader is returned when a connection doesn't start with a valid
+// PROXY protocol header.
+var ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+// Listener accepts connections starting with a PROXY protocol (v1 or v2)
+// header, sent by a load balancer, and reports the source address of the
+// header as the remote address of the connections. Connections without a
+// valid header fail on their first read.
+type Listener struct {
+	net.Listener
+	// Timeout is the time allowed to receive the header (5s if 0).
+	Timeout time.Duration
+}
+
+// NewListener returns a listener reading the PROXY protocol header of the
+// connections accepted by inner.
+func NewListener(inner net.Listener, timeout time.Duration) *Listener {
+	return &Listener{Listener: inner, Timeout: timeout}
+}
+
+// Accept waits for and returns the next connection. Its header is read on
+// the first call to Read or RemoteAddr, not to block the listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	timeout := l.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Conn{Conn: c, timeout: timeout}, nil
+}
+
+// Conn is a connection starting with a PROXY protocol header.
+type Conn struct {
+	net.Conn
+	timeout time.Duration
+
+	once   sync.Once
+	r      *bufio.Reader
+	remote net.Addr
+	err    error
+}
+
+func (c *Conn) readHeader() {
+	c.once.Do(func() {
+		c.r = bufio.NewReader(c.Conn)
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+			c.err = err
+			return
+		}
+		c.remote, c.err = readHeader(c.r)
+		if err := c.Conn.SetReadDeadline(time.Time{}); err != nil && c.err == nil {
+			c.err = err
+		}
+	})
+}
+
+// Read reads data from the connection, after its header.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the source address of the header, or the address of the
+// peer if the header has none (e.g. health checks of the load balancer).
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readHeader reads a v1 or v2 header and returns its source address, or nil
+// for the UNKNOWN (v1) and LOCAL (v2) headers and the unsupported protocols.
+func readHeader(r *bufio.Reader) (net.Addr, error) {
+	start, err := r.Peek(len(v2Signature))
+	if err != nil && !(errors.Is(err, io.EOF) && len(start) >= 6) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidHeader, err)
+	}
+	switch {
+	case bytes.Equal(start, v2Signature):
+		return readV2Header(r)
+	case bytes.HasPrefix(start, []byte("PROXY ")):
+		return readV1Header(r)
+	}
+	return nil, ErrInvalidHeader
+}
+
+// readV1Header reads a header of the form
+// "PROXY TCP4 192.0.2.1 198.51.100.1 51234 443\r\n".
+func readV1Header(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < maxV1HeaderSize {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidHeader, err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalidHeader
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return nil, ErrInvalidHeader
+	}
+	ip := net.ParseIP(fields[2])
+	if ip == nil || (ip.To4() != nil) != (fields[1] == "TCP4") {
+		return nil, ErrInvalidHeader
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, ErrInvalidHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readV2Header reads a binary header.
+func readV2Header(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidHeader, err)
+	}
+	if header[12]>>4 != 2 {
+		return nil, ErrInvalidHeader
+	}
+	command, family := header[12]&0x0f, header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidHeader, err)
+	}
+
+	switch command {
+	case 0x0: // LOCAL
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, ErrInvalidHeader
+	}
+	// The TLVs following the addresses are ignored.
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, ErrInvalidHeader
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, ErrInvalidHeader
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,135 @@
+package proxyproto
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func v2Header(command, family byte, payload []byte) []byte {
+	h := append([]byte{}, v2Signature...)
+	h = append(h, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(h[14:16], uint16(len(payload)))
+	return append(h, payload...)
+}
+
+func v2IPv4Payload() []byte {
+	p := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0, 0, 1, 187}
+	binary.BigEndian.PutUint16(p[8:10], 51234)
+	// A TLV, ignored.
+	return append(p, 0x01, 0x00, 0x02, 'h', '2')
+}
+
+func v2IPv6Payload() []byte {
+	p := make([]byte, 36)
+	copy(p[0:16], net.ParseIP("2001:db8::1"))
+	copy(p[16:32], net.ParseIP("2001:db8::2"))
+	binary.BigEndian.PutUint16(p[32:34], 40000)
+	binary.BigEndian.PutUint16(p[34:36], 443)
+	return p
+}
+
+func TestConn(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     []byte
+		wantRemote string
+		wantErr    error
+	}{
+		{
+			name:       "v1 TCP4",
+			header:     []byte("PROXY TCP4 192.0.2.1 198.51.100.1 51234 443\r\n"),
+			wantRemote: "192.0.2.1:51234",
+		},
+		{
+			name:       "v1 TCP6",
+			header:     []byte("PROXY TCP6 2001:db8::1 2001:db8::2 40000 443\r\n"),
+			wantRemote: "[2001:db8::1]:40000",
+		},
+		{
+			name:   "v1 UNKNOWN",
+			header: []byte("PROXY UNKNOWN\r\n"),
+		},
+		{
+			name:       "v2 PROXY IPv4",
+			header:     v2Header(0x1, 0x11, v2IPv4Payload()),
+			wantRemote: "192.0.2.1:51234",
+		},
+		{
+			name:       "v2 PROXY IPv6",
+			header:     v2Header(0x1, 0x21, v2IPv6Payload()),
+			wantRemote: "[2001:db8::1]:40000",
+		},
+		{
+			name:   "v2 LOCAL",
+			header: v2Header(0x0, 0x00, nil),
+		},
+		{
+			name:    "no header",
+			header:  []byte("GET / HTTP/1.1\r\n"),
+			wantErr: ErrInvalidHeader,
+		},
+		{
+			name:    "v1 mismatched family",
+			header:  []byte("PROXY TCP4 2001:db8::1 2001:db8::2 40000 443\r\n"),
+			wantErr: ErrInvalidHeader,
+		},
+		{
+			name:    "v1 without CRLF",
+			header:  []byte("PROXY TCP4 192.0.2.1 198.51.100.1 51234 443 and more than the maximum size of a v1 header\n"),
+			wantErr: ErrInvalidHeader,
+		},
+	}
+
+	const data = "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("error listening: %s", err)
+			}
+			defer ln.Close()
+			pl := NewListener(ln, 0)
+
+			client, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatalf("error connecting: %s", err)
+			}
+			defer client.Close()
+			go func() {
+				client.Write(append(tt.header, data...))
+				client.(*net.TCPConn).CloseWrite()
+			}()
+
+			conn, err := pl.Accept()
+			if err != nil {
+				t.Fatalf("error accepting: %s", err)
+			}
+			defer conn.Close()
+
+			got, err := io.ReadAll(conn)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Read() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if string(got) != data {
+				t.Errorf("Read() = %q, want %q", got, data)
+			}
+
+			wantRemote := tt.wantRemote
+			if wantRemote == "" {
+				wantRemote = client.LocalAddr().String()
+			}
+			if remote := conn.RemoteAddr().String(); remote != wantRemote {
+				t.Errorf("RemoteAddr() = %s, want %s", remote, wantRemote)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+// Package rulegen generates draft Suricata rules from the requests recorded in
+// the event log.
+package rulegen
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxContentSize is the maximum size of the payload matched by a rule.
+const maxContentSize = 64
+
+// DefaultIgnoredPaths are the paths requested by too many legitimate clients
+// to make useful rules.
+var DefaultIgnoredPaths = []string{"/", "/favicon.ico", "/robots.txt", "/sitemap.xml"}
+
+// exploitIndicators are the substrings of the requests revealing an exploit
+// payload.
+var exploitIndicators = []string{
+	"../", "..%2f", "%2e%2e", "/etc/passwd", "/bin/sh", "/bin/bash", "cmd.exe", "powershell",
+	"${jndi:", "${${", "<script", "javascript:", "onerror=", "union select", "union all select",
+	"sleep(", "benchmark(", "waitfor delay", "wget ", "curl ", "chmod ", "base64_decode", "eval(",
+	"system(", "exec(", "passthru(", "shell_exec", "php://", "data://", "file://", "expect://",
+	"<?php", "%00", "{{", "${",
+}
+
+// Config controls the rule generation. Rules are generated for the method and
+// path pairs requested at least MinHits times, except for IgnoredPaths, and
+// only if they carry an exploit payload when PayloadsOnly is true. The rules
+// are numbered from SID.
+type Config struct {
+	MinHits      int
+	PayloadsOnly bool
+	IgnoredPaths []string
+	SID          int
+	// Now is the creation date of the rules (the current time if zero).
+	Now time.Time
+}
+
+// event is the part of an event log record used by the rules.
+type event struct {
+	EventTime   time.Time `json:"eventTime"`
+	SrcIP       string    `json:"srcIP"`
+	Port        string    `json:"port"`
+	HTTPRequest struct {
+		Method  string `json:"method"`
+		Request string `json:"request"`
+		Body    string `json:"body"`
+	} `json:"httpRequest"`
+}
+
+// signature groups the requests with the same method and path.
+type signature struct {
+	method  string
+	path    string
+	exploit bool
+	// payload is matched in the buffer if set, for the exploit payloads
+	// of the query or body.
+	buffer    string
+	payload   string
+	hits      int
+	sources   map[string]bool
+	ports     map[string]bool
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// Generate reads the event log and writes the rules of the recorded requests
+// to w, most requested first. It returns the number of rules.
+func Generate(eventLog io.Reader, w io.Writer, cfg Config) (int, error) {
+	signatures, err := readSignatures(eventLog, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	now := cfg.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	sid := cfg.SID
+	n := 0
+	for _, s := range signatures {
+		if s.hits < cfg.MinHits || cfg.PayloadsOnly && !s.exploit {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, s.rule(sid+n, now)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func readSignatures(eventLog io.Reader, cfg Config) ([]*signature, error) {
+	ignored := make(map[string]bool)
+	for _, p := range cfg.IgnoredPaths {
+		ignored[p] = true
+	}
+
+	byKey := make(map[string]*signature)
+	var signatures []*signature
+	scanner := bufio.NewScanner(eventLog)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e event
+		// The lines that aren't request events are skipped.
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.HTTPRequest.Method == "" {
+			continue
+		}
+		path, query, _ := strings.Cut(e.HTTPRequest.Request, "?")
+		if path == "" || ignored[path] {
+			continue
+		}
+
+		key := e.HTTPRequest.Method + " " + path
+		s, ok := byKey[key]
+		if !ok {
+			s = &signature{
+				method:    e.HTTPRequest.Method,
+				path:      path,
+				sources:   map[string]bool{},
+				ports:     map[string]bool{},
+				firstSeen: e.EventTime,
+			}
+			byKey[key] = s
+			signatures = append(signatures, s)
+		}
+		s.hits++
+		s.sources[e.SrcIP] = true
+		s.ports[e.Port] = true
+		if e.EventTime.Before(s.firstSeen) {
+			s.firstSeen = e.EventTime
+		}
+		if e.EventTime.After(s.lastSeen) {
+			s.lastSeen = e.EventTime
+		}
+		// The rule matches the first payload seen in the path, query or
+		// body. The query is matched decoded, as normalized by Suricata.
+		if !s.exploit {
+			if payload(path, true) != "" {
+				s.exploit = true
+			} else if p := payload(query, true); p != "" {
+				s.exploit, s.buffer, s.payload = true, "http.uri", p
+			} else if p := payload(e.HTTPRequest.Body, false); p != "" {
+				s.exploit, s.buffer, s.payload = true, "http.request_body", p
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading the event log: %s", err)
+	}
+
+	sort.SliceStable(signatures, func(i, j int) bool {
+		return signatures[i].hits > signatures[j].hits
+	})
+	return signatures, nil
+}
+
+// payload returns the part of s, URL-decoded if decode is true, starting
+// with an exploit indicator, up to maxContentSize bytes and lowercased, or an
+// empty string if there is none.
+func payload(s string, decode bool) string {
+	if s == "" {
+		return ""
+	}
+	if decoded, err := url.QueryUnescape(s); decode && err == nil {
+		s = decoded
+	}
+	lower := strings.ToLower(s)
+	for _, indicator := range exploitIndicators {
+		if i := strings.Index(lower, indicator); i >= 0 {
+			end := min(i+maxContentSize, len(lower))
+			return lower[i:end]
+		}
+	}
+	return ""
+}
+
+// rule returns the Suricata rule of the signature.
+func (s *signature) rule(sid int, now time.Time) string {
+	classtype := "web-application-activity"
+	kind := "request"
+	if s.exploit {
+		classtype, kind = "web-application-attack", "exploit attempt"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `alert http $EXTERNAL_NET any -> $HOME_NET any (msg:"GALAH Honeypot %s %s %s"; flow:established,to_server; `,
+		kind, escapeMsg(s.method), escapeMsg(truncate(s.path, 100)))
+	fmt.Fprintf(&b, `http.method; content:"%s"; `, escapeContent(s.method))
+	fmt.Fprintf(&b, `http.uri.raw; content:"%s"; startswith; `, escapeContent(s.path))
+	if s.payload != "" {
+		fmt.Fprintf(&b, `%s; content:"%s"; nocase; `, s.buffer, escapeContent(s.payload))
+	}
+	fmt.Fprintf(&b, "classtype:%s; sid:%d; rev:1; ", classtype, sid)
+	fmt.Fprintf(&b, "metadata:created_at %s, galah_hits %d, galah_sources %d, galah_ports %s, galah_first_seen %s, galah_last_seen %s;)",
+		now.UTC().Format("2006_01_02"), s.hits, len(s.sources), strings.Join(sortedKeys(s.ports), "_"),
+		s.firstSeen.UTC().Format("2006_01_02"), s.lastSeen.UTC().Format("2006_01_02"))
+	return b.String()
+}
+
+// escapeContent escapes the string for a content option: the characters
+// reserved by the rule syntax and the non-printable bytes are written in hex
+// between pipes.
+func escapeContent(s string) string {
+	var b strings.Builder
+	inHex := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= 0x7f || c == '"' || c == ';' || c == '\\' || c == '|' {
+			if inHex {
+				b.WriteByte(' ')
+			} else {
+				b.WriteByte('|')
+				inHex = true
+			}
+			fmt.Fprintf(&b, "%02X", c)
+			continue
+		}
+		if inHex {
+			b.WriteByte('|')
+			inHex = false
+		}
+		b.WriteByte(c)
+	}
+	if inHex {
+		b.WriteByte('|')
+	}
+	return b.String()
+}
+
+// escapeMsg escapes the string for the msg option, dropping the
+// non-printable bytes.
+func escapeMsg(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == ';' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c >= 0x20 && c < 0x7f:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
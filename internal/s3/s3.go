@@ -0,0 +1,123 @@
+// Package s3 implements the uploads of objects to S3-compatible storage,
+// with the requests signed by the signer of the AWS SDK.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+const service = "s3"
+
+// Client uploads objects to a bucket, with the Credentials of the region.
+// Endpoint is the URL of the storage service, https://s3.<Region>.amazonaws.com
+// by default. The bucket is addressed in the path of the URLs if PathStyle is
+// true (as most S3-compatible services expect), and in their host otherwise.
+type Client struct {
+	Endpoint    string
+	Region      string
+	Bucket      string
+	PathStyle   bool
+	Credentials aws.CredentialsProvider
+	HTTPClient  *http.Client
+
+	// now returns the signing time, overridden in tests.
+	now func() time.Time
+}
+
+// Error is an error response of the storage service.
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+// PutObject uploads the object of the given key.
+func (c *Client) PutObject(ctx context.Context, key string, body []byte, contentType string) error {
+	u, err := c.objectURL(key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	sum := sha256.Sum256(body)
+	if err := c.sign(ctx, req, hex.EncodeToString(sum[:])); err != nil {
+		return err
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		e := &Error{StatusCode: resp.StatusCode}
+		xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(e)
+		return e
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// objectURL returns the URL of the object of the given key.
+func (c *Client) objectURL(key string) (*url.URL, error) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + c.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3: invalid endpoint: %w", err)
+	}
+	key = strings.TrimPrefix(key, "/")
+	if c.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.Bucket + "/" + key
+	} else {
+		u.Host = c.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	return u, nil
+}
+
+// sign adds the headers authenticating the request with AWS Signature
+// Version 4.
+func (c *Client) sign(ctx context.Context, req *http.Request, payloadHash string) error {
+	creds, err := c.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("s3: error retrieving the credentials: %w", err)
+	}
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	return v4.NewSigner().SignHTTP(ctx, creds, req, payloadHash, service, c.Region, now())
+}
@@ -0,0 +1,214 @@
+// Package scanner identifies the well-known scanners and attack tools (e.g.
+// Nuclei, sqlmap, zgrab) sending the requests, by the signatures of their
+// headers and of the paths they probe, and the automated clients by the
+// timing of their requests.
+package scanner
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Evidence of the detections.
+const (
+	EvidenceHeader = "header"
+	EvidencePath   = "path"
+	// EvidenceSource is the evidence of the requests of a source whose tool
+	// was identified by its earlier requests.
+	EvidenceSource = "source"
+	// EvidenceTiming is the evidence of the sources sending bursts of
+	// requests too fast for a human.
+	EvidenceTiming = "timing"
+)
+
+// Automated is the name of the tool of the sources identified by their
+// timing only.
+const Automated = "automated"
+
+// Default settings of the detector.
+const (
+	DefaultWindow = 10 * time.Second
+	DefaultMemory = 10 * time.Minute
+	// defaultMaxSources bounds the number of sources tracked.
+	defaultMaxSources = 10000
+)
+
+// Signature identifies a tool by its headers or the paths it probes. Header
+// is matched against the "Name: value" lines of the headers, and Path against
+// the request URI. A capture group named version captures the version of the
+// tool.
+type Signature struct {
+	Tool   string
+	Header *regexp.Regexp
+	Path   *regexp.Regexp
+}
+
+// signatures are the built-in signatures of the common scanners and attack
+// tools.
+var signatures = []Signature{
+	{Tool: "sqlmap", Header: regexp.MustCompile(`(?i)\bsqlmap(?:/(?P<version>\d[\w.]*))?`)},
+	{Tool: "nikto", Header: regexp.MustCompile(`(?i)\bnikto(?:/(?P<version>\d[\w.]*))?`)},
+	{Tool: "nmap", Header: regexp.MustCompile(`(?i)\bnmap\b`), Path: regexp.MustCompile(`(?i)^/(nmaplowercheck|nmapuppercheck)\d+|^/nmap/folder/check\d+`)},
+	{Tool: "masscan", Header: regexp.MustCompile(`(?i)\bmasscan(?:/(?P<version>\d[\w.]*))?`)},
+	{Tool: "zgrab", Header: regexp.MustCompile(`(?i)\bzgrab(?:/(?P<version>\d[\w.]*))?`)},
+	{Tool: "nuclei", Header: regexp.MustCompile(`(?i)\bnuclei\b(?:[\s/-]*v?(?P<version>\d+\.[\w.]*))?`)},
+	{Tool: "gobuster", Header: regexp.MustCompile(`(?i)\bgobuster(?:/(?P<version>\d[\w.]*))?`)},
+	{Tool: "dirbuster", Header: regexp.MustCompile(`(?i)\bdirbuster(?:-(?P<version>\d[\w.-]*))?`), Path: regexp.MustCompile(`(?i)/thereisnowaythat-you-canbethere`)},
+	{Tool: "feroxbuster", Header: regexp.MustCompile(`(?i)\bferoxbuster(?:/(?P<version>\d[\w.]*))?`)},
+	{Tool: "ffuf", Header: regexp.MustCompile(`(?i)\b(?:fuzz faster u fool|ffuf)(?:\s+v|/)?(?P<version>\d[\w.-]*)?`)},
+	{Tool: "wfuzz", Header: regexp.MustCompile(`(?i)\bwfuzz(?:/(?P<version>\d[\w.]*))?`)},
+	{Tool: "wpscan", Header: regexp.MustCompile(`(?i)\bwpscan(?:\s+v|/)?(?P<version>\d[\w.]*)?`)},
+	{Tool: "acunetix", Header: regexp.MustCompile(`(?i)\bacunetix\b|^acunetix-`), Path: regexp.MustCompile(`(?i)acunetix-wvs-test`)},
+	{Tool: "nessus", Header: regexp.MustCompile(`(?i)\bnessus\b`), Path: regexp.MustCompile(`(?i)/nessus[_-]?(test|check|is_probing)`)},
+	{Tool: "openvas", Header: regexp.MustCompile(`(?i)\bopenvas\b`)},
+	{Tool: "burp", Header: regexp.MustCompile(`(?i)\bburp\s*collaborator\b|\.burpcollaborator\.net\b|\.oastify\.com\b`)},
+	{Tool: "interactsh", Header: regexp.MustCompile(`(?i)\.oast\.(fun|live|me|online|pro|site)\b|\binteractsh\b`), Path: regexp.MustCompile(`(?i)\.oast\.(fun|live|me|online|pro|site)\b`)},
+	{Tool: "censys", Header: regexp.MustCompile(`(?i)\bcensysinspect(?:/(?P<version>\d[\w.]*))?`)},
+	{Tool: "shodan", Header: regexp.MustCompile(`(?i)\bshodan\b`)},
+}
+
+// Tool is a tool identified as sending a request, with the evidence it was
+// identified by.
+type Tool struct {
+	Name     string `json:"name"`
+	Version  string `json:"version,omitempty"`
+	Evidence string `json:"evidence"`
+}
+
+// Config configures the detector. The built-in signatures are extended with
+// Signatures. The requests of a source within Memory (default 10m) of its
+// last request identified are attributed to the same tool. The sources
+// sending at least Burst requests within Window (default 10s) are identified
+// as automated, unless Burst is 0.
+type Config struct {
+	Signatures []Signature
+	Burst      int
+	Window     time.Duration
+	Memory     time.Duration
+	MaxSources int
+}
+
+// Detector identifies the tools sending the requests, safe for concurrent
+// use.
+type Detector struct {
+	cfg        Config
+	signatures []Signature
+
+	mu      sync.Mutex
+	sources map[string]*source
+}
+
+// source is the state of a source: the tool it was last identified as and
+// when, and the times of its recent requests.
+type source struct {
+	tool     Tool
+	seen     time.Time
+	requests []time.Time
+}
+
+// New returns a detector of the configuration.
+func New(cfg Config) (*Detector, error) {
+	for _, sig := range cfg.Signatures {
+		if sig.Tool == "" {
+			return nil, fmt.Errorf("scanner signature without a tool")
+		}
+		if sig.Header == nil && sig.Path == nil {
+			return nil, fmt.Errorf("scanner signature of %s without a header or path", sig.Tool)
+		}
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	if cfg.Memory <= 0 {
+		cfg.Memory = DefaultMemory
+	}
+	if cfg.MaxSources <= 0 {
+		cfg.MaxSources = defaultMaxSources
+	}
+	return &Detector{
+		cfg:        cfg,
+		signatures: append(append([]Signature{}, cfg.Signatures...), signatures...),
+		sources:    make(map[string]*source),
+	}, nil
+}
+
+// Detect returns the tool sending the request of the source at now, and
+// false if none is identified. The custom signatures are matched before the
+// built-in ones.
+func (d *Detector) Detect(r *http.Request, src string, now time.Time) (Tool, bool) {
+	tool, ok := d.match(r)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.sources[src]
+	if s == nil {
+		if len(d.sources) >= d.cfg.MaxSources {
+			d.prune(now)
+		}
+		s = &source{}
+		d.sources[src] = s
+	}
+	s.requests = append(s.requests, now)
+	for len(s.requests) > 0 && now.Sub(s.requests[0]) > d.cfg.Window {
+		s.requests = s.requests[1:]
+	}
+
+	switch {
+	case ok:
+	case s.tool.Name != "" && now.Sub(s.seen) <= d.cfg.Memory:
+		tool = Tool{Name: s.tool.Name, Version: s.tool.Version, Evidence: EvidenceSource}
+	case d.cfg.Burst > 0 && len(s.requests) >= d.cfg.Burst:
+		tool = Tool{Name: Automated, Evidence: EvidenceTiming}
+	default:
+		return Tool{}, false
+	}
+	if tool.Name != Automated || s.tool.Name == "" || s.tool.Name == Automated {
+		s.tool, s.seen = tool, now
+	}
+	return tool, true
+}
+
+// match returns the tool of the first signature matching the request.
+func (d *Detector) match(r *http.Request) (Tool, bool) {
+	for _, sig := range d.signatures {
+		if sig.Header != nil {
+			for key, values := range r.Header {
+				for _, value := range values {
+					if m := sig.Header.FindStringSubmatch(key + ": " + value); m != nil {
+						return Tool{Name: sig.Tool, Version: version(sig.Header, m), Evidence: EvidenceHeader}, true
+					}
+				}
+			}
+		}
+		if sig.Path != nil {
+			if m := sig.Path.FindStringSubmatch(r.URL.RequestURI()); m != nil {
+				return Tool{Name: sig.Tool, Version: version(sig.Path, m), Evidence: EvidencePath}, true
+			}
+		}
+	}
+	return Tool{}, false
+}
+
+// prune forgets the sources without recent requests, or all of them if they
+// all have some.
+func (d *Detector) prune(now time.Time) {
+	for src, s := range d.sources {
+		if now.Sub(s.requests[len(s.requests)-1]) > max(d.cfg.Window, d.cfg.Memory) {
+			delete(d.sources, src)
+		}
+	}
+	if len(d.sources) >= d.cfg.MaxSources {
+		d.sources = make(map[string]*source)
+	}
+}
+
+// version returns the version captured by the match of re, or "".
+func version(re *regexp.Regexp, match []string) string {
+	if i := re.SubexpIndex("version"); i > 0 && i < len(match) {
+		return match[i]
+	}
+	return ""
+}
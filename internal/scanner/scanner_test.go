@@ -0,0 +1,125 @@
+package scanner
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestDetect(t *testing.T) {
+	d, err := New(Config{
+		Signatures: []Signature{{Tool: "custom", Header: regexp.MustCompile(`(?i)^x-probe: custom/(?P<version>[\d.]+)`)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		src     string
+		target  string
+		headers map[string]string
+		want    Tool
+		wantOK  bool
+	}{
+		{
+			name:    "userAgentWithVersion",
+			src:     "192.0.2.1",
+			target:  "/?id=1",
+			headers: map[string]string{"User-Agent": "sqlmap/1.7.2#stable (https://sqlmap.org)"},
+			want:    Tool{Name: "sqlmap", Version: "1.7.2", Evidence: EvidenceHeader},
+			wantOK:  true,
+		},
+		{
+			name:    "userAgentWithoutVersion",
+			src:     "192.0.2.2",
+			target:  "/",
+			headers: map[string]string{"User-Agent": "Mozilla/5.0 (compatible; Nmap Scripting Engine; https://nmap.org/book/nse.html)"},
+			want:    Tool{Name: "nmap", Evidence: EvidenceHeader},
+			wantOK:  true,
+		},
+		{
+			name:    "path",
+			src:     "192.0.2.3",
+			target:  "/nmaplowercheck1718032512",
+			headers: map[string]string{"User-Agent": "Mozilla/5.0"},
+			want:    Tool{Name: "nmap", Evidence: EvidencePath},
+			wantOK:  true,
+		},
+		{
+			name:    "customSignature",
+			src:     "192.0.2.4",
+			target:  "/",
+			headers: map[string]string{"X-Probe": "custom/2.0"},
+			want:    Tool{Name: "custom", Version: "2.0", Evidence: EvidenceHeader},
+			wantOK:  true,
+		},
+		{
+			name:    "sameSource",
+			src:     "192.0.2.1",
+			target:  "/admin",
+			headers: map[string]string{"User-Agent": "Mozilla/5.0"},
+			want:    Tool{Name: "sqlmap", Version: "1.7.2", Evidence: EvidenceSource},
+			wantOK:  true,
+		},
+		{
+			name:    "browser",
+			src:     "192.0.2.5",
+			target:  "/",
+			headers: map[string]string{"User-Agent": "Mozilla/5.0 (X11; Linux x86_64) Firefox/126.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			got, ok := d.Detect(r, tt.src, now)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("Detect() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// The attribution to the source expires.
+	if _, ok := d.Detect(httptest.NewRequest("GET", "/", nil), "192.0.2.1", now.Add(DefaultMemory+time.Second)); ok {
+		t.Error("Expected the earlier tool of the source forgotten")
+	}
+}
+
+func TestDetectTiming(t *testing.T) {
+	d, err := New(Config{Burst: 3, Window: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, wantOK := range []bool{false, false, true} {
+		_, ok := d.Detect(httptest.NewRequest("GET", "/", nil), "192.0.2.1", now.Add(time.Duration(i)*100*time.Millisecond))
+		if ok != wantOK {
+			t.Errorf("Expected request %d identified %v, got %v", i+1, wantOK, ok)
+		}
+	}
+	// The slower requests of another source aren't identified.
+	for i := 0; i < 3; i++ {
+		if tool, ok := d.Detect(httptest.NewRequest("GET", "/", nil), "192.0.2.2", now.Add(time.Duration(i)*2*time.Second)); ok {
+			t.Errorf("Expected the slow requests not identified, got %+v", tool)
+		}
+	}
+
+	// A tool identified later replaces the timing evidence.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", "Nuclei - Open-source project (github.com/projectdiscovery/nuclei)")
+	if tool, _ := d.Detect(r, "192.0.2.1", now.Add(300*time.Millisecond)); tool.Name != "nuclei" {
+		t.Errorf("Expected nuclei identified, got %+v", tool)
+	}
+	if tool, _ := d.Detect(httptest.NewRequest("GET", "/", nil), "192.0.2.1", now.Add(400*time.Millisecond)); tool.Name != "nuclei" || tool.Evidence != EvidenceSource {
+		t.Errorf("Expected the source attributed to nuclei, got %+v", tool)
+	}
+
+	if _, err := New(Config{Signatures: []Signature{{Tool: "empty"}}}); err == nil {
+		t.Error("Expected an error for a signature without a header or path")
+	}
+}
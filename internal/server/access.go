@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/0x4d31/galah/internal/access"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// Actions taken for the denied sources (see config.AccessListsConfig).
+const (
+	accessActionStatic = "static"
+	accessActionDrop   = "drop"
+)
+
+// deniedTag tags the events of the requests of the denied sources.
+const deniedTag = "denied"
+
+// LoadAccessLists loads the entries of the allow and deny lists of the
+// configuration, from the lists and the files.
+func LoadAccessLists(ac config.AccessListsConfig) (allow, deny []access.Entry, err error) {
+	switch ac.Action {
+	case "", accessActionStatic, accessActionDrop:
+	default:
+		return nil, nil, fmt.Errorf("unknown access list action %q", ac.Action)
+	}
+	load := func(entries []string, file string) ([]access.Entry, error) {
+		list, err := access.ParseEntries(entries)
+		if err != nil {
+			return nil, err
+		}
+		if file != "" {
+			fileEntries, err := access.LoadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("error loading the access list %s: %w", file, err)
+			}
+			list = append(list, fileEntries...)
+		}
+		return list, nil
+	}
+	if allow, err = load(ac.Allow, ac.AllowFile); err != nil {
+		return nil, nil, err
+	}
+	if deny, err = load(ac.Deny, ac.DenyFile); err != nil {
+		return nil, nil, err
+	}
+	return allow, deny, nil
+}
+
+// NewAccessLists returns the allow and deny lists of the configuration.
+func NewAccessLists(ac config.AccessListsConfig) (*access.Lists, error) {
+	allow, deny, err := LoadAccessLists(ac)
+	if err != nil {
+		return nil, err
+	}
+	return &access.Lists{Allow: access.NewList(allow), Deny: access.NewList(deny)}, nil
+}
+
+// denyAccess denies the request if its source isn't allowed by the access
+// lists, and returns true if so. The static response is sent, or the
+// connection closed with the drop action.
+func (s *Server) denyAccess(w http.ResponseWriter, r *http.Request, port string) bool {
+	if s.AccessLists == nil || s.AccessLists.Allowed(llm.SourceIP(r)) {
+		return false
+	}
+
+	s.Logger.Infof("request from %s denied by the access lists", r.RemoteAddr)
+	ac := s.Config.AccessLists
+	if ac.Action == accessActionDrop {
+		// Aborts the handler and closes the connection without a response.
+		panic(http.ErrAbortHandler)
+	}
+	resp := s.sendStaticResponse(w)
+	if ac.Log {
+		r = r.WithContext(logger.WithTags(r.Context(), deniedTag))
+		s.EventLogger.LogEvent(r, resp, port)
+	}
+	return true
+}
+
+// accessEntry is the body of an entry added with the admin API, expiring
+// after TTL, a duration like "24h", or at Expires.
+type accessEntry struct {
+	CIDR    string    `json:"cidr"`
+	TTL     string    `json:"ttl"`
+	Expires time.Time `json:"expires"`
+	Comment string    `json:"comment"`
+}
+
+// accessList returns the access list named in the path, or nil after
+// writing the error.
+func (s *Server) accessList(w http.ResponseWriter, r *http.Request) *access.List {
+	if s.AccessLists == nil {
+		http.Error(w, "the access lists are disabled", http.StatusNotFound)
+		return nil
+	}
+	switch name := r.PathValue("list"); name {
+	case "allow":
+		return s.AccessLists.Allow
+	case "deny":
+		return s.AccessLists.Deny
+	default:
+		http.Error(w, fmt.Sprintf("unknown access list %q, expected allow or deny", name), http.StatusNotFound)
+		return nil
+	}
+}
+
+func (s *Server) handleAccessLists(w http.ResponseWriter, r *http.Request) {
+	if s.AccessLists == nil {
+		http.Error(w, "the access lists are disabled", http.StatusNotFound)
+		return
+	}
+	s.writeAdmin(w, map[string][]access.Entry{
+		"allow": s.AccessLists.Allow.Entries(),
+		"deny":  s.AccessLists.Deny.Entries(),
+	})
+}
+
+func (s *Server) handleAddAccess(w http.ResponseWriter, r *http.Request) {
+	list := s.accessList(w, r)
+	if list == nil {
+		return
+	}
+	var body accessEntry
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.CIDR == "" {
+		http.Error(w, `expected {"cidr": ..., "ttl": ..., "comment": ...}`, http.StatusBadRequest)
+		return
+	}
+	prefix, err := access.ParsePrefix(body.CIDR)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid cidr %q", body.CIDR), http.StatusBadRequest)
+		return
+	}
+	e := access.Entry{Prefix: prefix, Expires: body.Expires, Comment: body.Comment}
+	if body.TTL != "" {
+		ttl, err := time.ParseDuration(body.TTL)
+		if err != nil || ttl <= 0 {
+			http.Error(w, fmt.Sprintf("invalid ttl %q", body.TTL), http.StatusBadRequest)
+			return
+		}
+		e.Expires = time.Now().Add(ttl).UTC()
+	}
+	list.Add(e)
+	s.Logger.Infof("added %s to the %s list", prefix, r.PathValue("list"))
+	s.writeAdmin(w, e)
+}
+
+func (s *Server) handleRemoveAccess(w http.ResponseWriter, r *http.Request) {
+	list := s.accessList(w, r)
+	if list == nil {
+		return
+	}
+	cidr := r.PathValue("cidr")
+	prefix, err := access.ParsePrefix(cidr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid cidr %q", cidr), http.StatusBadRequest)
+		return
+	}
+	if !list.Remove(prefix) {
+		http.Error(w, fmt.Sprintf("%s isn't in the %s list", prefix, r.PathValue("list")), http.StatusNotFound)
+		return
+	}
+	s.Logger.Infof("removed %s from the %s list", prefix, r.PathValue("list"))
+	w.WriteHeader(http.StatusNoContent)
+}
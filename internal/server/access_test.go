@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/access"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAccessLists(t *testing.T) {
+	l := logrus.New()
+	eventLog := filepath.Join(t.TempDir(), "event_log.json")
+	eventLogger, err := logger.New(eventLog, llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ac := config.AccessListsConfig{Deny: []string{"192.0.2.0/24"}, Log: true}
+	lists, err := NewAccessLists(ac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := &sequenceModel{results: []any{validResponse, validResponse}}
+	s := &Server{
+		AccessLists: lists,
+		Config: &config.Config{
+			UserPrompt:  "%q",
+			AccessLists: ac,
+			ErrorPolicy: config.ErrorPolicyConfig{StaticResponse: config.StaticResponseConfig{StatusCode: 404, Body: "not found"}},
+		},
+		EventLogger: eventLogger,
+		LLMConfig:   llm.Config{Provider: "openai"},
+		Logger:      l,
+		Model:       model,
+		Runtime:     NewRuntime(),
+	}
+	serve := func(src string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = src + ":4444"
+		w := httptest.NewRecorder()
+		s.handleRequest(w, r, "127.0.0.1:8080")
+		return w
+	}
+
+	if w := serve("192.0.2.1"); w.Code != 404 || w.Body.String() != "not found" {
+		t.Errorf("Expected the static response to the denied source, got %d %q", w.Code, w.Body)
+	}
+	if model.calls != 0 {
+		t.Errorf("Expected no generation for the denied source, got %d", model.calls)
+	}
+	if data, err := os.ReadFile(eventLog); err != nil || !strings.Contains(string(data), deniedTag) {
+		t.Errorf("Expected the denied request to be logged with the %q tag, got %q", deniedTag, data)
+	}
+	if w := serve("198.51.100.1"); w.Code != http.StatusOK || model.calls != 1 {
+		t.Errorf("Expected the other source to be served, got %d", w.Code)
+	}
+
+	h := s.adminHandler("secret")
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	if w := do("POST", "/api/access/deny", `{"cidr": "198.51.100.0/24", "ttl": "1h", "comment": "own scanner"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected the entry to be added, got %d %q", w.Code, w.Body)
+	}
+	if w := serve("198.51.100.1"); w.Code != 404 || model.calls != 1 {
+		t.Errorf("Expected the added range to be denied, got %d", w.Code)
+	}
+	var entries map[string][]access.Entry
+	if err := json.Unmarshal(do("GET", "/api/access", "").Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if deny := entries["deny"]; len(deny) != 2 || deny[1].Comment != "own scanner" || deny[1].Expires.IsZero() || !deny[0].Configured {
+		t.Errorf("Unexpected deny list %+v", deny)
+	}
+	for target, code := range map[string]int{
+		"/api/access/deny/198.51.100.0/24": http.StatusNoContent,
+		"/api/access/deny/203.0.113.0/24":  http.StatusNotFound,
+		"/api/access/other/203.0.113.0/24": http.StatusNotFound,
+		"/api/access/deny/not-a-cidr":      http.StatusBadRequest,
+	} {
+		if w := do("DELETE", target, ""); w.Code != code {
+			t.Errorf("Expected %d for DELETE %s, got %d", code, target, w.Code)
+		}
+	}
+	if w := do("POST", "/api/access/allow", `{"cidr": "192.0.2.300"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the invalid range to be rejected, got %d", w.Code)
+	}
+
+	s.Config.AccessLists.Action = accessActionDrop
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("Expected the handler to be aborted, got %v", p)
+			}
+		}()
+		serve("192.0.2.1")
+	}()
+
+	if _, err := NewAccessLists(config.AccessListsConfig{Action: "tarpit"}); err == nil {
+		t.Error("Expected an error for the unknown action")
+	}
+}
@@ -0,0 +1,380 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0x4d31/galah/internal/eventstore"
+	"github.com/0x4d31/galah/internal/har"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// modelSwitchTimeout is the maximum duration of the initialization of the
+// model switched to.
+const modelSwitchTimeout = 30 * time.Second
+
+// maxHAREvents is the default maximum number of events of the HAR logs of the
+// sessions.
+const maxHAREvents = 1000
+
+// PersonaStatus is a persona of a port or virtual host served by the admin
+// API.
+type PersonaStatus struct {
+	Name          string `json:"name"`
+	Enabled       bool   `json:"enabled"`
+	Model         string `json:"model"`
+	ServerProfile string `json:"serverProfile,omitempty"`
+}
+
+// ModelStatus is the primary model served by the admin API. Switched is true
+// if it was switched at runtime.
+type ModelStatus struct {
+	Provider    string  `json:"provider"`
+	Model       string  `json:"model"`
+	Temperature float64 `json:"temperature"`
+	Switched    bool    `json:"switched"`
+}
+
+// modelSwitch is the body of a model switch. The provider's settings not set
+// are the primary's, or empty for another provider.
+type modelSwitch struct {
+	Provider    string   `json:"provider"`
+	Model       string   `json:"model"`
+	ServerURL   string   `json:"serverUrl"`
+	APIKey      string   `json:"apiKey"`
+	Temperature *float64 `json:"temperature"`
+}
+
+// StartAdminServer serves the admin API on addr, authenticated with the
+// bearer token:
+//
+//   - GET /api/stats: the stats of the stats server.
+//   - GET, DELETE /api/cache: the cache management API of the stats server.
+//   - GET /api/events: the recent events, filtered by src_ip, session,
+//     path_prefix, since, until and limit.
+//   - GET /api/sessions: the sessions of the event store.
+//   - GET /api/personas, PUT /api/personas/{name}: the personas, enabled or
+//     disabled with {"enabled": false}.
+//   - GET, PUT, DELETE /api/model: the primary model, switched for all the
+//     requests, or back to the configured models.
+//   - GET /api/access, POST /api/access/{allow|deny},
+//     DELETE /api/access/{allow|deny}/{cidr}: the access lists of the
+//     sources, with the entries added with {"cidr": ..., "ttl": "24h"}.
+func (s *Server) StartAdminServer(addr, token string) error {
+	if token == "" {
+		return errors.New("the admin API requires a token")
+	}
+	if s.Runtime == nil {
+		return errors.New("the admin API requires the runtime state")
+	}
+
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      s.adminHandler(token),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: modelSwitchTimeout + 10*time.Second,
+	}
+	s.Logger.Infof("starting admin server on %s", addr)
+	return server.ListenAndServe()
+}
+
+func (s *Server) adminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/stats", s.handleStats)
+	mux.HandleFunc("/api/cache", s.handleCache)
+	mux.HandleFunc("GET /api/events", s.handleEvents)
+	mux.HandleFunc("GET /api/sessions", s.handleSessions)
+	mux.HandleFunc("GET /api/sessions/active", s.handleActiveSessions)
+	mux.HandleFunc("GET /api/sessions/{id}/har", s.handleSessionHAR)
+	mux.HandleFunc("GET /api/honeytokens", s.handleHoneytokens)
+	mux.HandleFunc("GET /api/personas", s.handlePersonas)
+	mux.HandleFunc("PUT /api/personas/{name}", s.handleSetPersona)
+	mux.HandleFunc("GET /api/model", s.handleModel)
+	mux.HandleFunc("PUT /api/model", s.handleSetModel)
+	mux.HandleFunc("DELETE /api/model", s.handleResetModel)
+	mux.HandleFunc("GET /api/access", s.handleAccessLists)
+	mux.HandleFunc("POST /api/access/{list}", s.handleAddAccess)
+	mux.HandleFunc("DELETE /api/access/{list}/{cidr...}", s.handleRemoveAccess)
+
+	return requireToken(token, mux)
+}
+
+// requireToken returns a handler serving the requests authenticated with the
+// token, as a bearer token or the password of the basic authentication for
+// the browsers.
+func requireToken(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			_, got, ok = r.BasicAuth()
+		}
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="galah"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// handleEvents serves the events of the event store, if configured, or else
+// the recent events kept in memory, newest first.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	f, err := eventFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.EventStore != nil {
+		events, err := s.EventStore.Events(r.Context(), f)
+		if err != nil {
+			s.Logger.Errorf("error querying the event store: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if events == nil {
+			events = []eventstore.Event{}
+		}
+		s.writeAdmin(w, events)
+		return
+	}
+	if s.Recent == nil {
+		http.Error(w, "the recent events are not kept", http.StatusNotFound)
+		return
+	}
+	s.writeAdmin(w, s.Recent.Events(f.SrcIP, f.Limit))
+}
+
+// handleSessions serves the sessions of the event store.
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if s.EventStore == nil {
+		http.Error(w, "the event store is disabled", http.StatusNotFound)
+		return
+	}
+	f, err := eventFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sessions, err := s.EventStore.Sessions(r.Context(), f)
+	if err != nil {
+		s.Logger.Errorf("error querying the event store: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sessions == nil {
+		sessions = []eventstore.Session{}
+	}
+	s.writeAdmin(w, sessions)
+}
+
+func (s *Server) handleActiveSessions(w http.ResponseWriter, r *http.Request) {
+	if s.Sessions == nil {
+		http.Error(w, "the sessions are disabled", http.StatusNotFound)
+		return
+	}
+	s.writeAdmin(w, s.Sessions.Active(time.Now()))
+}
+
+// handleHoneytokens serves the honeytokens issued, most recent first.
+func (s *Server) handleHoneytokens(w http.ResponseWriter, r *http.Request) {
+	if s.Honeytokens == nil {
+		http.Error(w, "the honeytokens are disabled", http.StatusNotFound)
+		return
+	}
+	s.writeAdmin(w, s.Honeytokens.Tokens())
+}
+
+// handleSessionHAR serves the requests of a session of the event store, with
+// their responses, as a HAR log.
+func (s *Server) handleSessionHAR(w http.ResponseWriter, r *http.Request) {
+	if s.EventStore == nil {
+		http.Error(w, "the event store is disabled", http.StatusNotFound)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid session %q", r.PathValue("id")), http.StatusBadRequest)
+		return
+	}
+	f, err := eventFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.SessionID = id
+	if f.Limit == 0 {
+		f.Limit = maxHAREvents
+	}
+	events, err := s.EventStore.Events(r.Context(), f)
+	if err != nil {
+		s.Logger.Errorf("error querying the event store: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := make([]json.RawMessage, len(events))
+	for i, e := range events {
+		data[i] = e.Data
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="session-%d.har"`, id))
+	s.writeAdmin(w, har.FromEvents(data, har.Config{}))
+}
+
+// eventFilter returns the filter of the query parameters.
+func eventFilter(q url.Values) (eventstore.Filter, error) {
+	f := eventstore.Filter{
+		SrcIP:      q.Get("src_ip"),
+		PathPrefix: q.Get("path_prefix"),
+	}
+	var err error
+	if v := q.Get("session"); v != "" {
+		if f.SessionID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return f, fmt.Errorf("invalid session %q", v)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 0 {
+			return f, fmt.Errorf("invalid limit %q", v)
+		}
+	}
+	for name, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := q.Get(name); v != "" {
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				return f, fmt.Errorf("invalid %s time %q, expected RFC 3339", name, v)
+			}
+		}
+	}
+	return f, nil
+}
+
+// personas returns the current personas by name.
+func (s *Server) personas() map[string]*Persona {
+	cs := s.current()
+	personas := make(map[string]*Persona)
+	for port, p := range cs.Personas {
+		personas[portPersona(port)] = p
+	}
+	for _, vh := range cs.VirtualHosts {
+		personas[hostPersona(vh)] = vh.Persona
+	}
+	return personas
+}
+
+func (s *Server) handlePersonas(w http.ResponseWriter, r *http.Request) {
+	list := []PersonaStatus{}
+	for name, p := range s.personas() {
+		list = append(list, PersonaStatus{
+			Name:          name,
+			Enabled:       s.Runtime.PersonaEnabled(name),
+			Model:         p.LLMConfig.Model,
+			ServerProfile: p.Config.ServerProfile.Name,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	s.writeAdmin(w, list)
+}
+
+func (s *Server) handleSetPersona(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	p, ok := s.personas()[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown persona %q", name), http.StatusNotFound)
+		return
+	}
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Enabled == nil {
+		http.Error(w, `expected {"enabled": true|false}`, http.StatusBadRequest)
+		return
+	}
+	s.Runtime.SetPersonaEnabled(name, *body.Enabled)
+	s.Logger.Infof("persona %s enabled: %t", name, *body.Enabled)
+	s.writeAdmin(w, PersonaStatus{
+		Name:          name,
+		Enabled:       *body.Enabled,
+		Model:         p.LLMConfig.Model,
+		ServerProfile: p.Config.ServerProfile.Name,
+	})
+}
+
+func (s *Server) handleModel(w http.ResponseWriter, r *http.Request) {
+	s.writeAdmin(w, s.modelStatus())
+}
+
+// handleSetModel switches the model of all the requests, including the ones
+// of the personas.
+func (s *Server) handleSetModel(w http.ResponseWriter, r *http.Request) {
+	if s.NewModel == nil {
+		http.Error(w, "the model can't be switched", http.StatusNotImplemented)
+		return
+	}
+	var body modelSwitch
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Model == "" {
+		http.Error(w, `expected {"model": ..., "provider": ..., "temperature": ...}`, http.StatusBadRequest)
+		return
+	}
+
+	c := s.LLMConfig
+	if body.Provider != "" && body.Provider != c.Provider {
+		c.Provider = body.Provider
+		c.ServerURL = ""
+		c.APIKey = ""
+		c.Deployment = ""
+		c.Headers = nil
+	}
+	c.Model = body.Model
+	if body.ServerURL != "" {
+		c.ServerURL = body.ServerURL
+	}
+	if body.APIKey != "" {
+		c.APIKey = body.APIKey
+	}
+	if body.Temperature != nil {
+		c.Temperature = *body.Temperature
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), modelSwitchTimeout)
+	defer cancel()
+	model, err := s.NewModel(ctx, c)
+	if err != nil {
+		s.Logger.Errorf("error switching the model to %s/%s: %s", c.Provider, c.Model, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.Runtime.SetModel(&llm.Provider{Config: c, Model: model})
+	s.Logger.Infof("switched the model to %s/%s", c.Provider, c.Model)
+	s.writeAdmin(w, s.modelStatus())
+}
+
+// handleResetModel switches back to the configured models.
+func (s *Server) handleResetModel(w http.ResponseWriter, r *http.Request) {
+	s.Runtime.SetModel(nil)
+	s.Logger.Infof("switched back to the configured model %s/%s", s.LLMConfig.Provider, s.LLMConfig.Model)
+	s.writeAdmin(w, s.modelStatus())
+}
+
+func (s *Server) modelStatus() ModelStatus {
+	c, switched := s.LLMConfig, false
+	if p := s.Runtime.Model(); p != nil {
+		c, switched = p.Config, true
+	}
+	return ModelStatus{Provider: c.Provider, Model: c.Model, Temperature: c.Temperature, Switched: switched}
+}
+
+func (s *Server) writeAdmin(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.Logger.Errorf("error writing the admin API response: %s", err)
+	}
+}
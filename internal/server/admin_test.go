@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	el "github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestAdminAPI(t *testing.T) {
+	recent := el.NewRecentEvents(2)
+	events := logrus.New()
+	events.Out = &strings.Builder{}
+	events.AddHook(recent)
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.1"} {
+		events.WithField("srcIP", ip).Info("successfulResponse")
+	}
+
+	switched := &sequenceModel{results: []any{validResponse}}
+	s := &Server{
+		Config:    &config.Config{SystemPrompt: "web server"},
+		LLMConfig: llm.Config{Provider: "openai", Model: "gpt-4o", Temperature: 1},
+		Logger:    logrus.New(),
+		Model:     &sequenceModel{results: []any{validResponse}},
+		NewModel: func(_ context.Context, c llm.Config) (llms.Model, error) {
+			return switched, nil
+		},
+		Personas: map[uint16]*Persona{
+			8443: {Config: &config.Config{SystemPrompt: "API gateway"}, LLMConfig: llm.Config{Model: "gpt-4o-mini"}},
+		},
+		Recent:  recent,
+		Runtime: NewRuntime(),
+	}
+	h := s.adminHandler("secret")
+
+	do := func(method, target, body string, v any) int {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if v != nil && w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+				t.Fatalf("error decoding %s %s: %s", method, target, err)
+			}
+		}
+		return w.Code
+	}
+
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		r := httptest.NewRequest("GET", "/api/stats", nil)
+		r.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 with the Authorization %q, got %d", auth, w.Code)
+		}
+	}
+
+	var got []map[string]any
+	if code := do("GET", "/api/events?src_ip=192.0.2.1", "", &got); code != http.StatusOK || len(got) != 1 || got[0]["srcIP"] != "192.0.2.1" {
+		t.Errorf("Expected the last kept event of the source, got %d %v", code, got)
+	}
+	if code := do("GET", "/api/events?limit=x", "", nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid limit, got %d", code)
+	}
+	if code := do("GET", "/api/sessions", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the sessions without event store, got %d", code)
+	}
+	if code := do("GET", "/api/sessions/1/har", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the HAR log of a session without event store, got %d", code)
+	}
+	if code := do("DELETE", "/api/cache", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the cache management without cache, got %d", code)
+	}
+
+	var persona PersonaStatus
+	if code := do("PUT", "/api/personas/port:8443", `{"enabled": false}`, &persona); code != http.StatusOK || persona.Enabled {
+		t.Errorf("Expected the persona to be disabled, got %d %+v", code, persona)
+	}
+	if got := s.forPort(8443); got != s {
+		t.Errorf("Expected the server itself for a disabled persona")
+	}
+	if code := do("PUT", "/api/personas/port:9999", `{"enabled": false}`, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown persona, got %d", code)
+	}
+	var personas []PersonaStatus
+	do("GET", "/api/personas", "", &personas)
+	if len(personas) != 1 || personas[0].Name != "port:8443" || personas[0].Enabled {
+		t.Errorf("Unexpected personas: %+v", personas)
+	}
+
+	var model ModelStatus
+	if code := do("PUT", "/api/model", `{"model": "gpt-4.1", "temperature": 0.5}`, &model); code != http.StatusOK {
+		t.Fatalf("Expected the model to be switched, got %d", code)
+	}
+	if model != (ModelStatus{Provider: "openai", Model: "gpt-4.1", Temperature: 0.5, Switched: true}) {
+		t.Errorf("Unexpected switched model: %+v", model)
+	}
+	if ps := s.forRequest(8443, httptest.NewRequest("GET", "/", nil)); ps.Model != switched || ps.LLMConfig.Model != "gpt-4.1" || s.LLMConfig.Model != "gpt-4o" {
+		t.Errorf("Expected the switched model for the requests, got %s", ps.LLMConfig.Model)
+	}
+	do("DELETE", "/api/model", "", &model)
+	if model.Switched || model.Model != "gpt-4o" {
+		t.Errorf("Expected the configured model, got %+v", model)
+	}
+	if code := do("PUT", "/api/model", `{}`, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without model, got %d", code)
+	}
+}
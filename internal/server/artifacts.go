@@ -0,0 +1,262 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// staticArtifactTag is the event tag of the responses served by a static
+// artifact.
+const staticArtifactTag = "static_artifact"
+
+// maxArtifactSize is the maximum size of the files of the static artifacts,
+// which are read in memory.
+const maxArtifactSize = 10 << 20
+
+// defaultArtifactExtensions are the extensions of the assets answered with a
+// placeholder if none is configured.
+var defaultArtifactExtensions = []string{".css", ".js", ".png", ".gif", ".jpg", ".jpeg", ".svg", ".ico", ".webp", ".woff", ".woff2"}
+
+// artifactTypes are the content types of the extensions missing from, or
+// varying between, the MIME tables of the systems.
+var artifactTypes = map[string]string{
+	".ico":   "image/x-icon",
+	".txt":   "text/plain; charset=utf-8",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+}
+
+// StaticArtifacts are the static artifacts, served at their path.
+type StaticArtifacts struct {
+	files        map[string]*artifact
+	placeholders map[string]*artifact
+	extensions   map[string]bool
+}
+
+type artifact struct {
+	contentType string
+	body        []byte
+	modTime     time.Time
+}
+
+// NewStaticArtifacts reads the files of the static artifacts, and builds the
+// placeholders if enabled. It returns nil if none is configured.
+func NewStaticArtifacts(cfg config.StaticArtifactsConfig) (*StaticArtifacts, error) {
+	if cfg.Dir == "" && !cfg.Placeholders {
+		return nil, nil
+	}
+	sa := &StaticArtifacts{files: make(map[string]*artifact)}
+	if cfg.Dir != "" {
+		err := filepath.WalkDir(cfg.Dir, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			if info.Size() > maxArtifactSize {
+				return fmt.Errorf("%s is larger than %d bytes", file, maxArtifactSize)
+			}
+			body, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(cfg.Dir, file)
+			if err != nil {
+				return err
+			}
+			sa.files["/"+filepath.ToSlash(rel)] = newArtifact(path.Ext(file), body, info.ModTime())
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error reading the static artifacts: %s", err)
+		}
+	}
+
+	if cfg.Placeholders {
+		extensions := cfg.Extensions
+		if len(extensions) == 0 {
+			extensions = defaultArtifactExtensions
+		}
+		sa.extensions = make(map[string]bool, len(extensions))
+		for _, ext := range extensions {
+			sa.extensions["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = true
+		}
+		placeholders, err := newPlaceholders(time.Now(), sa.extensions)
+		if err != nil {
+			return nil, fmt.Errorf("error building the placeholders of the static artifacts: %s", err)
+		}
+		sa.placeholders = placeholders
+	}
+	return sa, nil
+}
+
+func newArtifact(ext string, body []byte, modTime time.Time) *artifact {
+	ext = strings.ToLower(ext)
+	contentType, ok := artifactTypes[ext]
+	if !ok {
+		contentType = mime.TypeByExtension(ext)
+	}
+	if contentType == "" && len(body) > 0 {
+		contentType = http.DetectContentType(body)
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &artifact{contentType: contentType, body: body, modTime: modTime.UTC().Truncate(time.Second)}
+}
+
+// newPlaceholders returns the placeholders of the paths, /favicon.ico and
+// /robots.txt, and of the extensions, served at the other paths. The assets
+// without a placeholder of their type are empty.
+func newPlaceholders(modTime time.Time, extensions map[string]bool) (map[string]*artifact, error) {
+	pixel := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	var pngBody, gifBody, jpegBody bytes.Buffer
+	if err := png.Encode(&pngBody, pixel); err != nil {
+		return nil, err
+	}
+	if err := gif.Encode(&gifBody, pixel, nil); err != nil {
+		return nil, err
+	}
+	if err := jpeg.Encode(&jpegBody, pixel, nil); err != nil {
+		return nil, err
+	}
+	// The icon embeds the PNG image, after the header of the file and the
+	// entry of the image.
+	var ico bytes.Buffer
+	binary.Write(&ico, binary.LittleEndian, []uint16{0, 1, 1})
+	ico.Write([]byte{1, 1, 0, 0})
+	binary.Write(&ico, binary.LittleEndian, []uint16{1, 32})
+	binary.Write(&ico, binary.LittleEndian, []uint32{uint32(pngBody.Len()), 22})
+	ico.Write(pngBody.Bytes())
+
+	bodies := map[string][]byte{
+		"/favicon.ico": ico.Bytes(),
+		"/robots.txt":  []byte("User-agent: *\nDisallow:\n"),
+		".ico":         ico.Bytes(),
+		".png":         pngBody.Bytes(),
+		".gif":         gifBody.Bytes(),
+		".jpg":         jpegBody.Bytes(),
+		".jpeg":        jpegBody.Bytes(),
+		".svg":         []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="1" height="1"/>`),
+	}
+	placeholders := make(map[string]*artifact)
+	for key, body := range bodies {
+		if strings.HasPrefix(key, "/") || extensions[key] {
+			placeholders[key] = newArtifact(path.Ext(key), body, modTime)
+		}
+	}
+	for ext := range extensions {
+		if placeholders[ext] == nil {
+			placeholders[ext] = newArtifact(ext, nil, modTime)
+		}
+	}
+	return placeholders, nil
+}
+
+// lookup returns the artifact of the request, or nil. The artifacts are only
+// served to the GET and HEAD requests.
+func (sa *StaticArtifacts) lookup(r *http.Request) *artifact {
+	if sa == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return nil
+	}
+	p := path.Clean("/" + r.URL.Path)
+	if a, ok := sa.files[p]; ok {
+		return a
+	}
+	if sa.placeholders == nil {
+		return nil
+	}
+	if a, ok := sa.placeholders[p]; ok {
+		return a
+	}
+	return sa.placeholders[strings.ToLower(path.Ext(p))]
+}
+
+// etag returns the entity tag of the artifact, after its size and
+// modification time.
+func (a *artifact) etag() string {
+	return fmt.Sprintf(`"%x-%x"`, len(a.body), a.modTime.UnixMicro())
+}
+
+// response returns the response of the artifact to the request, not modified
+// if the request's conditions match its entity tag or modification time.
+func (a *artifact) response(r *http.Request) llm.JSONResponse {
+	etag := a.etag()
+	resp := llm.JSONResponse{
+		Headers: map[string]string{
+			"Content-Type":  a.contentType,
+			"ETag":          etag,
+			"Last-Modified": a.modTime.Format(http.TimeFormat),
+		},
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			if tag = strings.TrimSpace(tag); tag == etag || tag == "*" || tag == "W/"+etag {
+				resp.StatusCode = http.StatusNotModified
+				return resp
+			}
+		}
+	} else if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !a.modTime.After(t) {
+		resp.StatusCode = http.StatusNotModified
+		return resp
+	}
+
+	resp.StatusCode = http.StatusOK
+	if utf8.Valid(a.body) {
+		resp.Body = string(a.body)
+	} else {
+		resp.Encoding = llm.EncodingBase64
+		resp.Body = base64.StdEncoding.EncodeToString(a.body)
+	}
+	return resp
+}
+
+// handleStaticArtifact answers the request with its static artifact, if any.
+// It returns true if the request has been answered.
+func (s *Server) handleStaticArtifact(w http.ResponseWriter, r *http.Request, port string) bool {
+	a := s.StaticArtifacts.lookup(r)
+	if a == nil {
+		return false
+	}
+
+	resp := a.response(r)
+	s.applyProfile(r, &resp)
+
+	r = r.WithContext(logger.WithTags(r.Context(), staticArtifactTag))
+	if s.History != nil {
+		s.History.RecordResponse(r, resp)
+	}
+	// The content type and modification time of the artifacts are kept,
+	// unlike those of the generated responses.
+	for _, key := range []string{"Content-Type", "Last-Modified"} {
+		w.Header().Set(key, resp.Headers[key])
+	}
+	s.sendResponse(w, resp)
+	s.Logger.Infof("sent the static artifact %s to %s", r.URL.Path, r.RemoteAddr)
+	s.EventLogger.LogEvent(r, resp, port)
+	return true
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHandleStaticArtifact(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "static"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"robots.txt":     "User-agent: *\nDisallow: /admin/\n",
+		"static/app.css": "body { margin: 0; }",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	artifacts, err := NewStaticArtifacts(config.StaticArtifactsConfig{Dir: dir, Placeholders: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := logrus.New()
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Config:          &config.Config{},
+		EventLogger:     eventLogger,
+		Logger:          l,
+		Profile:         &llm.ServerProfile{Headers: map[string]string{"Server": "Apache/2.4.41 (Ubuntu)"}},
+		StaticArtifacts: artifacts,
+	}
+	serve := func(method, target string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		for key, values := range header {
+			r.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		if !s.handleStaticArtifact(w, r, "8080") {
+			return nil
+		}
+		return w
+	}
+
+	tests := []struct {
+		target      string
+		contentType string
+		body        string
+	}{
+		{"/robots.txt", "text/plain; charset=utf-8", "User-agent: *\nDisallow: /admin/\n"},
+		{"/static/app.css", "text/css; charset=utf-8", "body { margin: 0; }"},
+		{"/assets/main.js", "text/javascript; charset=utf-8", ""},
+		{"/STATIC/theme.CSS", "text/css; charset=utf-8", ""},
+	}
+	for _, tt := range tests {
+		w := serve("GET", tt.target, nil)
+		if w == nil {
+			t.Errorf("Expected %s to be answered", tt.target)
+			continue
+		}
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != tt.contentType || w.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q %q, want %q %q", tt.target, w.Code, w.Header().Get("Content-Type"), w.Body.String(), tt.contentType, tt.body)
+		}
+		if got := w.Header().Get("Server"); got != "Apache/2.4.41 (Ubuntu)" {
+			t.Errorf("%s: expected the headers of the server profile, got Server %q", tt.target, got)
+		}
+	}
+
+	w := serve("GET", "/favicon.ico", nil)
+	if w == nil || w.Header().Get("Content-Type") != "image/x-icon" {
+		t.Fatalf("Expected the placeholder favicon, got %v", w)
+	}
+	if _, err := png.Decode(bytes.NewReader(w.Body.Bytes()[22:])); err != nil {
+		t.Errorf("Expected the favicon to embed a PNG image: %s", err)
+	}
+	if w := serve("GET", "/logo.png", nil); w == nil || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Expected the placeholder image, got %v", w)
+	} else if _, err := png.Decode(w.Body); err != nil {
+		t.Errorf("Expected a valid PNG image: %s", err)
+	}
+
+	etag := w.Header().Get("ETag")
+	if w := serve("GET", "/favicon.ico", http.Header{"If-None-Match": {etag}}); w == nil || w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected the favicon not modified for its entity tag, got %v", w)
+	}
+	lastModified := serve("GET", "/robots.txt", nil).Header().Get("Last-Modified")
+	if w := serve("GET", "/robots.txt", http.Header{"If-Modified-Since": {lastModified}}); w == nil || w.Code != http.StatusNotModified {
+		t.Errorf("Expected robots.txt not modified since %s, got %v", lastModified, w)
+	}
+
+	for _, tt := range []struct{ method, target string }{
+		{"GET", "/admin"},
+		{"GET", "/index.php"},
+		{"POST", "/robots.txt"},
+	} {
+		if w := serve(tt.method, tt.target, nil); w != nil {
+			t.Errorf("Expected %s %s not to be answered", tt.method, tt.target)
+		}
+	}
+
+	s.StaticArtifacts = nil
+	if w := serve("GET", "/favicon.ico", nil); w != nil {
+		t.Error("Expected no artifact without the static artifacts")
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+const (
+	defaultAuthRealm = "Restricted"
+	defaultAuthBody  = "<html>\r\n<head><title>401 Authorization Required</title></head>\r\n<body>\r\n<center><h1>401 Authorization Required</h1></center>\r\n</body>\r\n</html>\r\n"
+)
+
+// handleAuthChallenge answers requests for protected paths that carry no
+// credentials for the configured scheme with a 401 challenge. Requests with
+// credentials are left to the generated response. It returns true if the
+// request has been answered.
+func (s *Server) handleAuthChallenge(w http.ResponseWriter, r *http.Request, port string) bool {
+	ac := s.authChallengeFor(r)
+	if ac == nil || hasCredentials(r, ac.Scheme) {
+		return false
+	}
+
+	realm := ac.Realm
+	if realm == "" {
+		realm = defaultAuthRealm
+	}
+	challenge, err := llm.Challenge(ac.Scheme, realm)
+	if err != nil {
+		s.Logger.Errorf("error creating authentication challenge: %s", err)
+		return false
+	}
+
+	resp := llm.JSONResponse{
+		Headers: map[string]string{"Content-Type": "text/html"},
+		Body:    ac.Body,
+	}
+	if resp.Body == "" {
+		resp.Body = defaultAuthBody
+	}
+	for key, value := range ac.Headers {
+		resp.Headers[key] = value
+	}
+	s.applyProfile(r, &resp)
+	resp.Headers["WWW-Authenticate"] = challenge
+
+	for key, value := range resp.Headers {
+		w.Header().Set(key, value)
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+	if _, err := w.Write([]byte(resp.Body)); err != nil {
+		s.Logger.Errorf("error writing response: %s", err)
+	}
+
+	s.Logger.Infof("sent a %s authentication challenge to %s", ac.Scheme, r.RemoteAddr)
+	s.EventLogger.LogEvent(r, resp, port)
+	return true
+}
+
+// authChallengeFor returns the authentication challenge protecting the
+// requested path, or nil if the path isn't protected.
+func (s *Server) authChallengeFor(r *http.Request) *config.AuthChallengeConfig {
+	for i, ac := range s.Config.AuthChallenges {
+		for _, prefix := range ac.Paths {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return &s.Config.AuthChallenges[i]
+			}
+		}
+	}
+	return nil
+}
+
+func hasCredentials(r *http.Request, scheme string) bool {
+	name, _, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	return name != "" && strings.EqualFold(name, scheme)
+}
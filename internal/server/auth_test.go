@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHandleAuthChallenge(t *testing.T) {
+	tests := []struct {
+		name          string
+		scheme        string
+		path          string
+		authorization string
+		wantAnswered  bool
+		wantPrefix    string
+	}{
+		{
+			name:         "basicChallenge",
+			scheme:       "basic",
+			path:         "/admin/login.php",
+			wantAnswered: true,
+			wantPrefix:   `Basic realm="Restricted Area"`,
+		},
+		{
+			name:         "digestChallenge",
+			scheme:       "digest",
+			path:         "/manager/html",
+			wantAnswered: true,
+			wantPrefix:   `Digest realm="Restricted Area", qop="auth", algorithm=MD5, nonce="`,
+		},
+		{
+			name:          "credentialsArePassedThrough",
+			scheme:        "basic",
+			path:          "/admin",
+			authorization: "Basic YWRtaW46YWRtaW4=",
+		},
+		{
+			name:          "otherSchemeIsChallenged",
+			scheme:        "basic",
+			path:          "/admin",
+			authorization: "Bearer token",
+			wantAnswered:  true,
+			wantPrefix:    `Basic realm="Restricted Area"`,
+		},
+		{
+			name:   "unprotectedPath",
+			scheme: "basic",
+			path:   "/index.html",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := logrus.New()
+			eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &Server{
+				Config: &config.Config{AuthChallenges: []config.AuthChallengeConfig{{
+					Paths:  []string{"/admin", "/manager/html"},
+					Scheme: tt.scheme,
+					Realm:  "Restricted Area",
+				}}},
+				EventLogger: eventLogger,
+				Logger:      l,
+				Profile:     &llm.ServerProfile{Headers: map[string]string{"Server": "Apache-Coyote/1.1"}},
+			}
+
+			r := httptest.NewRequest("GET", tt.path, nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			answered := s.handleAuthChallenge(w, r, "8080")
+
+			if answered != tt.wantAnswered {
+				t.Fatalf("Expected answered %v, got %v", tt.wantAnswered, answered)
+			}
+			if !answered {
+				return
+			}
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+			}
+			challenge := w.Header().Get("WWW-Authenticate")
+			if !strings.HasPrefix(challenge, tt.wantPrefix) {
+				t.Errorf("Expected challenge starting with %q, got %q", tt.wantPrefix, challenge)
+			}
+			if !llm.ValidChallenge(challenge) {
+				t.Errorf("Expected a well-formed challenge, got %q", challenge)
+			}
+			if got := w.Header().Get("Server"); got != "Apache-Coyote/1.1" {
+				t.Errorf("Expected Server header %q, got %q", "Apache-Coyote/1.1", got)
+			}
+		})
+	}
+}
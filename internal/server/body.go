@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// readRequestBody reads the body of the request once, decodes its gzip and
+// deflate Content-Encoding and truncates it at the maximum size (see
+// requestBodyLimit), so that the following handlers, the prompt and the
+// event log see the same body. The decoded body replaces the encoded one, with its Content-Length,
+// and how it was read is recorded in the context of the request. Bodies with
+// an unsupported or invalid encoding are kept encoded.
+func (s *Server) readRequestBody(r *http.Request) *http.Request {
+	if r.Body == nil || r.Body == http.NoBody {
+		return r
+	}
+	max := requestBodyLimit(s.Config.MaxRequestBodySize)
+	info := llm.RequestBody{Chunked: len(r.TransferEncoding) > 0}
+
+	var body []byte
+	var err error
+	encoding := r.Header.Get("Content-Encoding")
+	if encoding != "" {
+		// The encoded body read while decoding is kept in case it can't be
+		// decoded. Only the decoded body is limited, the decoders reading
+		// no more than they need.
+		var raw bytes.Buffer
+		body, err = decodeBody(io.TeeReader(r.Body, &raw), encoding, max)
+		switch {
+		case err != nil:
+			s.Logger.Debugf("keeping the request body of %s encoded with %q: %s", r.RemoteAddr, encoding, err)
+			body = raw.Bytes()
+			if len(body) <= max {
+				rest, _ := io.ReadAll(limitReader(r.Body, max-len(body)+1))
+				body = append(body, rest...)
+			}
+		case body != nil:
+			info.Encoding = encoding
+			r.Header.Del("Content-Encoding")
+		default:
+			body = raw.Bytes()
+		}
+	} else {
+		body, err = io.ReadAll(limitReader(r.Body, max))
+		if err != nil {
+			s.Logger.Errorf("error reading the request body of %s: %s", r.RemoteAddr, err)
+		}
+	}
+	if len(body) > max {
+		body = body[:max]
+		info.Truncated = true
+		s.Logger.Infof("truncated the request body of %s at %d bytes", r.RemoteAddr, max)
+	}
+	info.Size = len(body)
+
+	r = r.WithContext(llm.WithRequestBody(r.Context(), info))
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.TransferEncoding = nil
+	if r.Header.Get("Content-Length") != "" || info.Chunked {
+		r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	return r
+}
+
+// defaultMaxRequestBodySize is the maximum size of the request bodies if
+// none is configured, in bytes.
+const defaultMaxRequestBodySize = 1 << 20
+
+// maxRequestBodyCeiling is the largest maximum size of the request bodies, in
+// bytes, bounding the decoded bodies of the small compressed requests.
+const maxRequestBodyCeiling = 64 << 20
+
+// requestBodyLimit returns the maximum size of the request bodies of the
+// configured size: the default size if it isn't set (0) and the ceiling if it
+// is negative or above.
+func requestBodyLimit(size int) int {
+	switch {
+	case size == 0:
+		return defaultMaxRequestBodySize
+	case size < 0 || size > maxRequestBodyCeiling:
+		return maxRequestBodyCeiling
+	}
+	return size
+}
+
+// limitReader returns a reader of r stopping one byte after max bytes, so that
+// the longer bodies can be told apart, or r if max isn't positive.
+func limitReader(r io.Reader, max int) io.Reader {
+	if max <= 0 {
+		return r
+	}
+	return io.LimitReader(r, int64(max)+1)
+}
+
+// decodeBody reads the body encoded with the Content-Encoding, the codings
+// being applied in the order they are listed. It reads at most one byte more
+// than max of the decoded body if max is positive, and a body cut short is
+// decoded as far as it goes. It returns nil if the body isn't encoded.
+func decodeBody(body io.Reader, encoding string, max int) ([]byte, error) {
+	codings := strings.Split(encoding, ",")
+	decoded := false
+	for i := len(codings) - 1; i >= 0; i-- {
+		var err error
+		switch coding := strings.ToLower(strings.TrimSpace(codings[i])); coding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			body, err = gzip.NewReader(body)
+		case "deflate":
+			body, err = newDeflateReader(body)
+		default:
+			return nil, fmt.Errorf("unsupported coding %q", coding)
+		}
+		if err != nil {
+			return nil, err
+		}
+		decoded = true
+	}
+	if !decoded {
+		return nil, nil
+	}
+	out, err := io.ReadAll(limitReader(body, max))
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return out, nil
+}
+
+// newDeflateReader returns a reader decoding the deflate coding, in the zlib
+// format or, as some clients send it, as raw deflate data.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestReadRequestBody(t *testing.T) {
+	compress := func(newWriter func(io.Writer) io.WriteCloser, data string) string {
+		var buf bytes.Buffer
+		w := newWriter(&buf)
+		_, _ = io.WriteString(w, data)
+		_ = w.Close()
+		return buf.String()
+	}
+	gzipped := compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, "user=admin&pass=secret")
+	zlibbed := compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }, "user=admin")
+	bomb := compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, strings.Repeat("\x00", 8<<20))
+	deflated := compress(func(w io.Writer) io.WriteCloser { fw, _ := flate.NewWriter(w, flate.DefaultCompression); return fw }, "user=admin")
+
+	tests := []struct {
+		name         string
+		body         string
+		encoding     string
+		chunked      bool
+		max          int
+		want         string
+		wantInfo     llm.RequestBody
+		wantEncoding string
+	}{
+		{name: "plain", body: "user=admin", want: "user=admin", wantInfo: llm.RequestBody{Size: 10}},
+		{name: "truncated", body: "user=admin", max: 4, want: "user", wantInfo: llm.RequestBody{Truncated: true, Size: 4}},
+		{name: "gzip", body: gzipped, encoding: "gzip", want: "user=admin&pass=secret", wantInfo: llm.RequestBody{Encoding: "gzip", Size: 22}},
+		{name: "gzipTruncated", body: gzipped, encoding: "gzip", max: 10, want: "user=admin", wantInfo: llm.RequestBody{Encoding: "gzip", Truncated: true, Size: 10}},
+		{name: "zlibDeflate", body: zlibbed, encoding: "deflate", want: "user=admin", wantInfo: llm.RequestBody{Encoding: "deflate", Size: 10}},
+		{name: "rawDeflate", body: deflated, encoding: "deflate", want: "user=admin", wantInfo: llm.RequestBody{Encoding: "deflate", Size: 10}},
+		{name: "chunked", body: "user=admin", chunked: true, want: "user=admin", wantInfo: llm.RequestBody{Chunked: true, Size: 10}},
+		{name: "unsupportedEncoding", body: "\x1b\x00", encoding: "br", want: "\x1b\x00", wantInfo: llm.RequestBody{Size: 2}, wantEncoding: "br"},
+		{name: "gzipBomb", body: bomb, encoding: "gzip", want: strings.Repeat("\x00", defaultMaxRequestBodySize), wantInfo: llm.RequestBody{Encoding: "gzip", Truncated: true, Size: defaultMaxRequestBodySize}},
+		{name: "invalidGzip", body: "user=admin", encoding: "gzip", want: "user=admin", wantInfo: llm.RequestBody{Size: 10}, wantEncoding: "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{Config: &config.Config{MaxRequestBodySize: tt.max}, Logger: logrus.New()}
+			r := httptest.NewRequest("POST", "/login", strings.NewReader(tt.body))
+			if tt.encoding != "" {
+				r.Header.Set("Content-Encoding", tt.encoding)
+			}
+			if tt.chunked {
+				r.ContentLength = -1
+				r.TransferEncoding = []string{"chunked"}
+			}
+			r = s.readRequestBody(r)
+
+			body, _ := io.ReadAll(r.Body)
+			if string(body) != tt.want {
+				t.Errorf("Expected the body %q, got %q", tt.want, body)
+			}
+			if r.ContentLength != int64(len(tt.want)) || r.TransferEncoding != nil {
+				t.Errorf("Expected the length %d without a transfer encoding, got %d %v", len(tt.want), r.ContentLength, r.TransferEncoding)
+			}
+			if got := r.Header.Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Expected the Content-Encoding %q, got %q", tt.wantEncoding, got)
+			}
+			if info, _ := llm.RequestBodyFrom(r.Context()); info != tt.wantInfo {
+				t.Errorf("Expected %+v, got %+v", tt.wantInfo, info)
+			}
+		})
+	}
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	for size, want := range map[int]int{0: defaultMaxRequestBodySize, -1: maxRequestBodyCeiling, 1 << 30: maxRequestBodyCeiling, 4096: 4096} {
+		if got := requestBodyLimit(size); got != want {
+			t.Errorf("requestBodyLimit(%d) = %d, want %d", size, got, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestBudgetExceeded(t *testing.T) {
+	l := logrus.New()
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := cache.InitializeCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var exceeded string
+	budget := llm.NewBudget(llm.BudgetConfig{DailyTokens: 1}, func(period string, _ llm.BudgetPeriod) { exceeded = period })
+	model := &sequenceModel{results: []any{validResponse, validResponse}}
+	s := &Server{
+		Budget:        budget,
+		Cache:         db,
+		CacheDuration: 1,
+		Config: &config.Config{
+			UserPrompt:  "%q",
+			CacheTTLs:   []config.CacheTTLConfig{{Path: "/cached", TTL: time.Nanosecond}},
+			ErrorPolicy: config.ErrorPolicyConfig{StaticResponse: config.StaticResponseConfig{StatusCode: 503, Body: "maintenance"}},
+		},
+		EventLogger: eventLogger,
+		LLMConfig:   llm.Config{Provider: "openai", Model: "gpt-4o"},
+		Logger:      l,
+		Model:       budget.Wrap(model, "gpt-4o"),
+	}
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleRequest(w, httptest.NewRequest("GET", target, nil), "127.0.0.1:8080")
+		return w
+	}
+
+	if w := serve("/cached"); w.Code != http.StatusOK || exceeded != "daily" {
+		t.Fatalf("Expected the generation to spend the daily budget, got %d, %q", w.Code, exceeded)
+	}
+	if w := serve("/cached"); w.Code != http.StatusOK || model.calls != 1 {
+		t.Errorf("Expected the expired cached response, got %d after %d generations", w.Code, model.calls)
+	}
+	if w := serve("/other"); w.Code != 503 || w.Body.String() != "maintenance" {
+		t.Errorf("Expected the static response, got %d %q", w.Code, w.Body)
+	}
+	if model.calls != 1 {
+		t.Errorf("Expected 1 generation, got %d", model.calls)
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/internal/metrics"
+	"github.com/0x4d31/galah/pkg/llm"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// cacheKey returns the cache key of the request, normalized as configured.
+func (s *Server) cacheKey(r *http.Request, port string) string {
+	key := cache.RequestKey(r, port, cache.KeyConfig{
+		Headers:       s.Config.CacheKey.Headers,
+		IgnoredParams: s.Config.CacheKey.IgnoredParams,
+	})
+	// The responses generated with the prompts of a variant aren't served
+	// to the sources of the other variants.
+	if variant := logger.PromptVariantFrom(r.Context()); variant != "" && variant != defaultVariant {
+		key += "\nPrompt-Variant: " + variant
+	}
+	// Nor are the responses to the sessions logged in served to the others.
+	if st := llm.SessionStateFrom(r.Context()); st != nil && st.User != "" {
+		key += "\nSession-User: " + st.User
+	}
+	// With several candidate responses, each source is served the one of its
+	// own, generated on its first request.
+	if n := s.Config.Response.Candidates; n > 1 {
+		key += fmt.Sprintf("\nResponse-Candidate: %d", llm.CandidateIndex(n, llm.SourceIP(r), key))
+	}
+	return key
+}
+
+// cachedResponse returns the response cached for the request, in the exact
+// cache or else the semantic cache, and the embedding of the request if the
+// semantic cache is enabled but has no response.
+func (s *Server) cachedResponse(r *http.Request, port string) ([]byte, []float32) {
+	_, span := tracer.Start(r.Context(), "galah.cache.lookup")
+	response, err := cache.CheckKeyTTL(s.Cache, s.cacheKey(r, port), s.cacheTTL(r))
+	span.SetAttributes(attribute.Bool("galah.cache.hit", response != nil))
+	span.End()
+	if err != nil {
+		if errors.Is(err, cache.ErrCacheExpired) || errors.Is(err, cache.ErrCacheMiss) {
+			s.Logger.Infof("Cache check for %q: %s", r.URL.String(), err)
+		} else {
+			s.Logger.Error(err)
+		}
+	}
+	if s.Cache != nil {
+		s.Metrics.CacheLookup(metrics.CacheExact, response != nil)
+	}
+	if response != nil || s.Semantic == nil {
+		return response, nil
+	}
+
+	_, span = tracer.Start(r.Context(), "galah.cache.semantic_lookup")
+	response, embedding := s.checkSemanticCache(r, port)
+	span.SetAttributes(attribute.Bool("galah.cache.hit", response != nil))
+	span.End()
+	s.Metrics.CacheLookup(metrics.CacheSemantic, response != nil)
+	return response, embedding
+}
+
+// cacheTTL returns the cache duration of the response to the request: the
+// TTL of the first matching cache_ttls rule, or the cache duration. It is 0
+// if caching is disabled, and negative if the response never expires.
+func (s *Server) cacheTTL(r *http.Request) time.Duration {
+	if s.Cache == nil {
+		return 0
+	}
+	for _, rule := range s.Config.CacheTTLs {
+		if cache.MatchPath(rule.Path, r.URL.Path) {
+			return rule.TTL
+		}
+	}
+	return cache.DurationTTL(s.CacheDuration)
+}
+
+// handleCache lists the cached responses matching the query parameters (port,
+// method, path, host and source) on GET, and invalidates them on DELETE. A DELETE
+// without parameters invalidates the whole cache.
+func (s *Server) handleCache(w http.ResponseWriter, r *http.Request) {
+	if s.Cache == nil {
+		http.Error(w, "the cache is disabled", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	filter := cache.Filter{
+		Port:   q.Get("port"),
+		Method: q.Get("method"),
+		Path:   q.Get("path"),
+		Host:   q.Get("host"),
+		Source: q.Get("source"),
+	}
+
+	var result any
+	switch r.Method {
+	case http.MethodGet:
+		entries, err := cache.List(s.Cache, filter)
+		if err != nil {
+			s.Logger.Errorf("error listing the cached responses: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if entries == nil {
+			entries = []cache.Entry{}
+		}
+		result = entries
+	case http.MethodDelete:
+		n, err := cache.InvalidateMatching(s.Cache, filter)
+		if err != nil {
+			s.Logger.Errorf("error invalidating the cached responses: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.Logger.Infof("invalidated %d cached responses matching %+v", n, filter)
+		result = map[string]int64{"invalidated": n}
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		s.Logger.Errorf("error writing the cached responses: %s", err)
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCacheTTL(t *testing.T) {
+	db, err := cache.InitializeCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s := &Server{
+		Cache:         db,
+		CacheDuration: 24,
+		Config: &config.Config{CacheTTLs: []config.CacheTTLConfig{
+			{Path: "/api/*", TTL: 0},
+			{Path: "/wp-*", TTL: time.Hour},
+		}},
+	}
+	tests := map[string]time.Duration{
+		"/api/users":    0,
+		"/wp-login.php": time.Hour,
+		"/index.php":    24 * time.Hour,
+	}
+	for target, want := range tests {
+		if got := s.cacheTTL(httptest.NewRequest("GET", target, nil)); got != want {
+			t.Errorf("cacheTTL(%q) = %s, want %s", target, got, want)
+		}
+	}
+
+	s.CacheDuration = -1
+	if got := s.cacheTTL(httptest.NewRequest("GET", "/", nil)); got >= 0 {
+		t.Errorf("Expected unlimited caching, got %s", got)
+	}
+	s.Cache = nil
+	if got := s.cacheTTL(httptest.NewRequest("GET", "/wp-login.php", nil)); got != 0 {
+		t.Errorf("Expected caching to be disabled without a cache, got %s", got)
+	}
+}
+
+func TestResponseCandidates(t *testing.T) {
+	db, err := cache.InitializeCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	l := logrus.New()
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := &sequenceModel{results: []any{
+		`{"headers": {}, "body": "variant-1"}`,
+		`{"headers": {}, "body": "variant-2"}`,
+		`{"headers": {}, "body": "variant-3"}`,
+	}}
+	s := &Server{
+		Cache:         db,
+		CacheDuration: 24,
+		Config:        &config.Config{UserPrompt: "%q", Response: config.ResponseConfig{Candidates: 3}},
+		EventLogger:   eventLogger,
+		LLMConfig:     llm.Config{Provider: "openai"},
+		Logger:        l,
+		Model:         model,
+	}
+	serve := func(src string) string {
+		r := httptest.NewRequest("GET", "/admin/login.php", nil)
+		r.RemoteAddr = src + ":1234"
+		w := httptest.NewRecorder()
+		s.handleRequest(w, r, "127.0.0.1:8080")
+		return w.Body.String()
+	}
+
+	first := serve("192.0.2.1")
+	if got := serve("192.0.2.1"); got != first {
+		t.Errorf("Expected the source to be served the same candidate, got %q and %q", first, got)
+	}
+	seen := map[string]bool{first: true}
+	for i := 0; i < 30; i++ {
+		seen[serve(fmt.Sprintf("198.51.100.%d", i))] = true
+	}
+	if len(seen) < 2 || model.calls > 3 {
+		t.Errorf("Expected the sources to be served up to 3 cached candidates, got %v after %d generations", seen, model.calls)
+	}
+}
+
+func TestHandleCache(t *testing.T) {
+	db, err := cache.InitializeCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, target := range []string{"/wp-login.php", "/index.php"} {
+		r := httptest.NewRequest("GET", target, nil)
+		if err := cache.StoreRequestResponse(db, r, cache.GetCacheKey(r, "8080"), []byte(validResponse), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &Server{Cache: db, Logger: logrus.New()}
+
+	w := httptest.NewRecorder()
+	s.handleCache(w, httptest.NewRequest("GET", "/cache?path=/wp-*", nil))
+	var entries []cache.Entry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("error decoding the entries: %s", err)
+	}
+	if len(entries) != 1 || entries[0].Key != "8080_/wp-login.php" || entries[0].Source != "192.0.2.1" {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleCache(w, httptest.NewRequest("DELETE", "/cache?path=/index.php", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "{\"invalidated\":1}\n" {
+		t.Errorf("Unexpected response %d %q", w.Code, w.Body.String())
+	}
+	if _, err := cache.CheckKey(db, "8080_/wp-login.php", -1); err != nil {
+		t.Errorf("Expected the other entry to stay cached, got %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleCache(w, httptest.NewRequest("POST", "/cache", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
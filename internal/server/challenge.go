@@ -0,0 +1,87 @@
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// defaultJSChallengePath is the default path of the beacon of the JavaScript
+// challenge, a real user monitoring endpoint of a CDN.
+const defaultJSChallengePath = "/cdn-cgi/rum"
+
+// challengeModulus bounds the nonces and the answers of the JavaScript
+// challenge, small enough for the answers to be exact in JavaScript.
+const challengeModulus = 1000003
+
+// challengeAnswer returns the answer to the nonce, computed by the script of
+// the challenge.
+func challengeAnswer(nonce int) int {
+	return (nonce*31 + 7) % challengeModulus
+}
+
+// jsChallengePath returns the path of the beacon of the JavaScript challenge,
+// or "" if the challenge is disabled.
+func (s *Server) jsChallengePath() string {
+	cfg := s.Config.Sessions
+	if !cfg.JSChallenge || s.Sessions == nil {
+		return ""
+	}
+	if cfg.JSChallengePath != "" {
+		return cfg.JSChallengePath
+	}
+	return defaultJSChallengePath
+}
+
+// injectChallenge embeds the JavaScript challenge into the HTML body of the
+// response: a script computing the answer to a nonce and sending it to the
+// beacon, which only the clients running the scripts of the pages do.
+func (s *Server) injectChallenge(resp *llm.JSONResponse) {
+	path := s.jsChallengePath()
+	if path == "" || resp.Encoding != "" || resp.Body == "" {
+		return
+	}
+	contentType := ""
+	for key, value := range resp.Headers {
+		if strings.EqualFold(key, "Content-Type") {
+			contentType = strings.ToLower(value)
+		}
+	}
+	if !strings.Contains(contentType, "html") {
+		return
+	}
+	nonce := rand.Intn(challengeModulus)
+	script := fmt.Sprintf("<script>(function(){var n=%d;new Image().src=%q+\"?n=\"+n+\"&v=\"+((n*31+7)%%%d);})();</script>\n", nonce, path, challengeModulus)
+	if i := strings.LastIndex(strings.ToLower(resp.Body), "</body>"); i >= 0 {
+		resp.Body = resp.Body[:i] + script + resp.Body[i:]
+	} else {
+		resp.Body += script
+	}
+}
+
+// handleChallenge answers the requests for the beacon of the JavaScript
+// challenge with no content, tagging the ones with the right answer, which
+// mark their session as running the scripts. It returns true if the request
+// has been answered.
+func (s *Server) handleChallenge(w http.ResponseWriter, r *http.Request, port string) bool {
+	path := s.jsChallengePath()
+	if path == "" || r.URL.Path != path {
+		return false
+	}
+	query := r.URL.Query()
+	nonce, errNonce := strconv.Atoi(query.Get("n"))
+	answer, errAnswer := strconv.Atoi(query.Get("v"))
+	if errNonce == nil && errAnswer == nil && nonce >= 0 && answer == challengeAnswer(nonce) {
+		r = r.WithContext(logger.WithTags(r.Context(), logger.JSChallengeTag))
+		s.Logger.Infof("%s answered the JavaScript challenge", r.RemoteAddr)
+	}
+	resp := llm.JSONResponse{StatusCode: http.StatusNoContent, Headers: map[string]string{"Cache-Control": "no-store"}}
+	s.sendResponse(w, resp)
+	s.EventLogger.LogEvent(r, resp, port)
+	return true
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/internal/session"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestJSChallenge(t *testing.T) {
+	l := logrus.New()
+	eventLog := filepath.Join(t.TempDir(), "event_log.json")
+	eventLogger, err := logger.New(eventLog, llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := session.NewTracker(session.Config{})
+	eventLogger.Sessions = tracker
+	s := &Server{
+		Config:      &config.Config{Sessions: config.SessionsConfig{Enabled: true, JSChallenge: true}},
+		EventLogger: eventLogger,
+		Logger:      l,
+		Sessions:    tracker,
+	}
+
+	resp := llm.JSONResponse{Headers: map[string]string{"Content-Type": "text/html"}, Body: "<html><body><h1>Welcome</h1></body></html>"}
+	s.injectChallenge(&resp)
+	m := regexp.MustCompile(`<script>\(function\(\)\{var n=(\d+);new Image\(\)\.src="/cdn-cgi/rum"\+.*</script>\n</body></html>$`).FindStringSubmatch(resp.Body)
+	if m == nil {
+		t.Fatalf("Expected the challenge before the end of the body, got %q", resp.Body)
+	}
+	other := llm.JSONResponse{Headers: map[string]string{"Content-Type": "application/json"}, Body: "{}"}
+	if s.injectChallenge(&other); other.Body != "{}" {
+		t.Errorf("Expected no challenge in a JSON response, got %q", other.Body)
+	}
+
+	nonce, _ := strconv.Atoi(m[1])
+	for _, answer := range []int{challengeAnswer(nonce) + 1, challengeAnswer(nonce)} {
+		r := httptest.NewRequest("GET", fmt.Sprintf("/cdn-cgi/rum?n=%d&v=%d", nonce, answer), nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		if !s.handleChallenge(w, r, "8080") || w.Code != http.StatusNoContent {
+			t.Fatalf("Expected the beacon answered with no content, got %d", w.Code)
+		}
+	}
+	if s.handleChallenge(httptest.NewRecorder(), httptest.NewRequest("GET", "/index.php", nil), "8080") {
+		t.Error("Expected another path not answered")
+	}
+
+	data, err := os.ReadFile(eventLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type event struct {
+		Tags    []string     `json:"tags"`
+		Session session.Info `json:"session"`
+	}
+	var events []event
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 || slices.Contains(events[0].Tags, logger.JSChallengeTag) || !slices.Contains(events[1].Tags, logger.JSChallengeTag) {
+		t.Fatalf("Expected only the right answer tagged, got %+v", events)
+	}
+	if !slices.Contains(events[1].Session.Signals, session.SignalJSChallenge) {
+		t.Errorf("Expected the session marked as running the scripts, got %+v", events[1].Session)
+	}
+}
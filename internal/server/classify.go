@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// classifyPayload tags the request with the categories of the attacks in its
+// payload and the scanners found, by the signatures or, if enabled and none
+// matches, by the classifier.
+func (s *Server) classifyPayload(r *http.Request) *http.Request {
+	cfg := s.Config.Classification
+	if !cfg.Enabled {
+		return r
+	}
+
+	tags, err := llm.ClassifyPayload(r, s.PayloadSignatures)
+	if err != nil {
+		s.Logger.Errorf("error classifying the payload of the request: %s", err)
+		return r
+	}
+	attack := slices.ContainsFunc(tags, func(tag string) bool {
+		return !strings.HasPrefix(tag, llm.ScannerTagPrefix)
+	})
+	if !attack && cfg.Classifier && s.Model != nil {
+		categories, err := llm.ClassifyPayloadLLM(r.Context(), s.Model, r)
+		if err != nil {
+			s.Logger.Errorf("error classifying the payload of the request with the model: %s", err)
+		}
+		tags = append(tags, categories...)
+	}
+	if len(tags) == 0 {
+		return r
+	}
+
+	s.Logger.Infof("request for %q from %s classified as %v", r.URL.String(), r.RemoteAddr, tags)
+	return r.WithContext(logger.WithTags(r.Context(), tags...))
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestClassifyPayload(t *testing.T) {
+	signatures, err := llm.NewPayloadSignatures(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		cfg        config.ClassificationConfig
+		uri        string
+		userAgent  string
+		classifier []any
+		want       []string
+		wantCalls  int
+	}{
+		{name: "disabled", uri: "/?q=%3Cscript%3E"},
+		{name: "signature", cfg: config.ClassificationConfig{Enabled: true}, uri: "/?q=%3Cscript%3E", want: []string{llm.PayloadXSS}},
+		{name: "benign", cfg: config.ClassificationConfig{Enabled: true}, uri: "/index.html"},
+		{
+			name:       "classifier",
+			cfg:        config.ClassificationConfig{Enabled: true, Classifier: true},
+			uri:        "/render?name=obfuscated",
+			classifier: []any{"ssti"},
+			want:       []string{llm.PayloadSSTI},
+			wantCalls:  1,
+		},
+		{
+			name:       "classifierAfterScanner",
+			cfg:        config.ClassificationConfig{Enabled: true, Classifier: true},
+			uri:        "/",
+			userAgent:  "Nuclei - Open-source project (github.com/projectdiscovery/nuclei)",
+			classifier: []any{"none"},
+			want:       []string{llm.ScannerTagPrefix + "nuclei"},
+			wantCalls:  1,
+		},
+		{
+			name:       "classifierSkippedOnSignature",
+			cfg:        config.ClassificationConfig{Enabled: true, Classifier: true},
+			uri:        "/?q=%3Cscript%3E",
+			classifier: []any{"sqli"},
+			want:       []string{llm.PayloadXSS},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &sequenceModel{results: tt.classifier}
+			s := &Server{
+				Config:            &config.Config{Classification: tt.cfg},
+				Logger:            logrus.New(),
+				Model:             model,
+				PayloadSignatures: signatures,
+			}
+			r := httptest.NewRequest("GET", tt.uri, strings.NewReader(""))
+			if tt.userAgent != "" {
+				r.Header.Set("User-Agent", tt.userAgent)
+			}
+			r = s.classifyPayload(r)
+
+			if got := logger.TagsFrom(r.Context()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected the tags %v, got %v", tt.want, got)
+			}
+			if model.calls != tt.wantCalls {
+				t.Errorf("Expected %d classifier calls, got %d", tt.wantCalls, model.calls)
+			}
+		})
+	}
+}
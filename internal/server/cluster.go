@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+)
+
+// clusterPollInterval is the interval at which an instance waiting for the
+// response generated by another checks the cache.
+const clusterPollInterval = 100 * time.Millisecond
+
+// awaitGeneration takes the cluster's generation lock of the request's cache
+// key, so that the instances generate the response to the same request once.
+// If another instance holds the lock, it waits for the response cached by the
+// other instance, until the lock is released or expires, and returns it. It
+// returns the function releasing the lock taken, if any, to be called once
+// the generated response is cached. Without a cluster, or if the response
+// isn't cached, the response is generated right away.
+func (s *Server) awaitGeneration(r *http.Request, port string) ([]byte, func()) {
+	ttl := s.cacheTTL(r)
+	if s.Cluster == nil || ttl == 0 {
+		return nil, func() {}
+	}
+	key := s.cacheKey(r, port)
+	deadline := time.Now().Add(s.Cluster.LockTimeout())
+	ticker := time.NewTicker(clusterPollInterval)
+	defer ticker.Stop()
+	for {
+		unlock, ok, err := s.Cluster.Lock(key)
+		if err != nil {
+			s.Logger.Errorf("error locking the generation in the cluster: %s", err)
+			return nil, func() {}
+		}
+		// The other instance caches the response before releasing the lock.
+		if response, err := cache.CheckKeyTTL(s.Cache, key, ttl); err == nil {
+			if ok {
+				unlock()
+			}
+			s.Logger.Infof("serving the response to %q generated by another instance", r.URL.String())
+			return response, func() {}
+		}
+		if ok {
+			return nil, unlock
+		}
+		if time.Now().After(deadline) {
+			s.Logger.Infof("generating the response to %q, another instance didn't in %s", r.URL.String(), s.Cluster.LockTimeout())
+			return nil, func() {}
+		}
+		select {
+		case <-r.Context().Done():
+			return nil, func() {}
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// consistentResponse returns the response previously served to the source
+// of the request for the same resource, if any.
+func (s *Server) consistentResponse(r *http.Request, port string) (llm.JSONResponse, bool) {
+	var resp llm.JSONResponse
+	if s.Consistency == nil {
+		return resp, false
+	}
+	data, ok := s.Consistency.Get(llm.SourceIP(r), s.cacheKey(r, port))
+	if !ok {
+		return resp, false
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		s.Logger.Errorf("error unmarshalling the response served to %s: %s", r.RemoteAddr, err)
+		return resp, false
+	}
+	return resp, true
+}
+
+// rememberResponse records the response served to the source of the request
+// so the same response is served to its later requests for the resource.
+func (s *Server) rememberResponse(r *http.Request, port string, resp llm.JSONResponse) {
+	if s.Consistency == nil {
+		return
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		s.Logger.Errorf("error marshalling the response served to %s: %s", r.RemoteAddr, err)
+		return
+	}
+	s.Consistency.Set(llm.SourceIP(r), s.cacheKey(r, port), data)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestConsistentResponses(t *testing.T) {
+	l := logrus.New()
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := &sequenceModel{results: []any{
+		`{"headers": {"Set-Cookie": "PHPSESSID=first"}, "body": "first"}`,
+		`{"headers": {"Set-Cookie": "PHPSESSID=second"}, "body": "second"}`,
+	}}
+	s := &Server{
+		Config:      &config.Config{UserPrompt: "%q"},
+		Consistency: cache.NewSourceResponses(10, time.Minute),
+		EventLogger: eventLogger,
+		LLMConfig:   llm.Config{Provider: "openai"},
+		Logger:      l,
+		Model:       model,
+	}
+
+	serve := func(remoteAddr, target string) (string, string) {
+		r := httptest.NewRequest("GET", target, nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		s.handleRequest(w, r, "127.0.0.1:8080")
+		return w.Header().Get("Set-Cookie"), w.Body.String()
+	}
+
+	cookie, body := serve("192.0.2.1:1000", "/login.php")
+	if cookie != "PHPSESSID=first" || body != "first" {
+		t.Fatalf("Unexpected first response %q %q", cookie, body)
+	}
+	// Without a cache, the response would be generated again.
+	for _, target := range []string{"/login.php", "/login.php?utm_source=x"} {
+		if cookie, body := serve("192.0.2.1:2000", target); cookie != "PHPSESSID=first" || body != "first" {
+			t.Errorf("Expected the same response for %q, got %q %q", target, cookie, body)
+		}
+	}
+	if model.calls != 1 {
+		t.Errorf("Expected 1 generation, got %d", model.calls)
+	}
+
+	if cookie, body := serve("198.51.100.7:1000", "/login.php"); cookie != "PHPSESSID=second" || body != "second" {
+		t.Errorf("Expected another source to get a new response, got %q %q", cookie, body)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"maps"
+	"net/http"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	contentMismatchRepair     = "repair"
+	contentMismatchRegenerate = "regenerate"
+)
+
+// checkContentType handles the generated response whose body doesn't match
+// its Content-Type. With regenerate, the model is asked once for another
+// response; the mismatches left are repaired.
+func (s *Server) checkContentType(r *http.Request, messages []llms.MessageContent, resp llm.JSONResponse, served llm.Config) (llm.JSONResponse, llm.Config) {
+	action := s.Config.Response.ContentMismatch
+	if action != contentMismatchRepair && action != contentMismatchRegenerate {
+		return resp, served
+	}
+	mismatch := llm.CheckContentType(resp)
+	if mismatch == nil {
+		return resp, served
+	}
+	s.Logger.Infof("generated response for %q doesn't match its content type: %s", r.URL.String(), mismatch)
+
+	if action == contentMismatchRegenerate {
+		retry := append(messages[:len(messages):len(messages)], llms.TextParts(llms.ChatMessageTypeHuman, llm.ContentTypePrompt(mismatch)))
+		next, _, config, err := s.generateWithPolicy(r, retry)
+		if err != nil {
+			s.Logger.Errorf("error regenerating the mismatched response: %s", err)
+		} else {
+			resp, served = next, config
+			if llm.CheckContentType(resp) == nil {
+				return resp, served
+			}
+		}
+	}
+
+	// The response is copied, as its headers are shared with the caller.
+	resp.Headers = maps.Clone(resp.Headers)
+	llm.RepairContentType(&resp)
+	return resp, served
+}
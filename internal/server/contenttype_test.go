@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestCheckContentType(t *testing.T) {
+	mismatched := `{"headers": {"Content-Type": "application/json"}, "body": "<html><body>Not Found</body></html>"}`
+	matching := `{"headers": {"Content-Type": "application/json"}, "body": "{\"error\": \"not found\"}"}`
+	tests := []struct {
+		name      string
+		action    string
+		response  string
+		results   []any
+		wantType  string
+		wantCalls int
+	}{
+		{
+			name:     "repairsMismatch",
+			action:   contentMismatchRepair,
+			response: mismatched,
+			wantType: "text/html; charset=utf-8",
+		},
+		{
+			name:      "regeneratesMismatch",
+			action:    contentMismatchRegenerate,
+			response:  mismatched,
+			results:   []any{matching},
+			wantType:  "application/json",
+			wantCalls: 1,
+		},
+		{
+			name:      "repairsMismatchedRegeneration",
+			action:    contentMismatchRegenerate,
+			response:  mismatched,
+			results:   []any{mismatched},
+			wantType:  "text/html; charset=utf-8",
+			wantCalls: 1,
+		},
+		{
+			name:     "keepsMatchingResponse",
+			action:   contentMismatchRegenerate,
+			response: matching,
+			wantType: "application/json",
+		},
+		{
+			name:     "disabled",
+			response: mismatched,
+			wantType: "application/json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &sequenceModel{results: tt.results}
+			s := &Server{
+				Config:    &config.Config{UserPrompt: "%q", Response: config.ResponseConfig{ContentMismatch: tt.action}},
+				LLMConfig: llm.Config{Provider: "openai"},
+				Logger:    logrus.New(),
+				Model:     model,
+			}
+
+			r := httptest.NewRequest("GET", "/api/users", nil)
+			messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "test")}
+			generated, err := llm.ParseJSONResponse(tt.response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, _ := s.checkContentType(r, messages, generated, s.LLMConfig)
+			if resp.Headers["Content-Type"] != tt.wantType {
+				t.Errorf("Expected the content type %q, got %q", tt.wantType, resp.Headers["Content-Type"])
+			}
+			if model.calls != tt.wantCalls {
+				t.Errorf("Expected %d calls, got %d", tt.wantCalls, model.calls)
+			}
+		})
+	}
+}
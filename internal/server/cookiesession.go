@@ -0,0 +1,280 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cluster"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/bluele/gcache"
+	"github.com/sirupsen/logrus"
+)
+
+// sessionCookieInvalidTag tags the events of the requests with an unknown or
+// expired session cookie.
+const sessionCookieInvalidTag = "session_cookie_invalid"
+
+const (
+	defaultSessionCookie        = "PHPSESSID"
+	defaultCookieSessionTimeout = 30 * time.Minute
+	defaultMaxCookieSessions    = 10000
+)
+
+// sessionFormat is the format of the session identifiers of a framework,
+// and the attributes of its session cookies.
+type sessionFormat struct {
+	alphabet   string
+	length     int
+	attributes string
+}
+
+// sessionFormats are the formats of the session cookies of the frameworks,
+// by the lowercase name of the cookie.
+var sessionFormats = map[string]sessionFormat{
+	"phpsessid":         {alphabet: "0123456789abcdefghijklmnopqrstuv", length: 26, attributes: "; path=/"},
+	"jsessionid":        {alphabet: "0123456789ABCDEF", length: 32, attributes: "; Path=/; HttpOnly"},
+	"asp.net_sessionid": {alphabet: "abcdefghijklmnopqrstuvwxyz012345", length: 24, attributes: "; path=/; HttpOnly; SameSite=Lax"},
+	"sessionid":         {alphabet: "0123456789abcdefghijklmnopqrstuvwxyz", length: 32, attributes: "; HttpOnly; Path=/; SameSite=Lax"},
+}
+
+// defaultSessionFormat is the format of the session cookies of the other
+// names.
+var defaultSessionFormat = sessionFormat{alphabet: "0123456789abcdef", length: 32, attributes: "; Path=/; HttpOnly"}
+
+// CookieSessions are the sessions of the session cookies issued to the
+// clients, by identifier. With a cluster, the sessions are shared with the
+// other instances, which continue the sessions started by each other.
+type CookieSessions struct {
+	name     string
+	format   sessionFormat
+	timeout  time.Duration
+	sessions gcache.Cache
+	shared   *cluster.Cluster
+}
+
+type cookieSession struct {
+	mu       sync.Mutex
+	started  time.Time
+	lastSeen time.Time
+	requests int
+	user     string
+}
+
+// NewCookieSessions returns the sessions of the session cookie of the
+// configuration, shared in the cluster if not nil.
+func NewCookieSessions(cfg config.CookieSessionsConfig, shared *cluster.Cluster) *CookieSessions {
+	if cfg.Name == "" {
+		cfg.Name = defaultSessionCookie
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultCookieSessionTimeout
+	}
+	if cfg.MaxSessions <= 0 {
+		cfg.MaxSessions = defaultMaxCookieSessions
+	}
+	format, ok := sessionFormats[strings.ToLower(cfg.Name)]
+	if !ok {
+		format = defaultSessionFormat
+	}
+	return &CookieSessions{
+		name:     cfg.Name,
+		format:   format,
+		timeout:  cfg.Timeout,
+		sessions: gcache.New(cfg.MaxSessions).LRU().Build(),
+		shared:   shared,
+	}
+}
+
+// start starts a new session, and returns its identifier.
+func (cs *CookieSessions) start(now time.Time) (string, *cookieSession, error) {
+	b := make([]byte, cs.format.length)
+	rand.Read(b)
+	for i := range b {
+		b[i] = cs.format.alphabet[int(b[i])%len(cs.format.alphabet)]
+	}
+	id := string(b)
+	session := &cookieSession{started: now}
+	cs.sessions.Set(id, session)
+	if cs.shared != nil {
+		return id, session, cs.shared.StartSession(id, now, cs.timeout)
+	}
+	return id, session, nil
+}
+
+// lookup returns the session of the identifier, or nil if it is unknown or
+// has expired. The shared sessions are looked up in the cluster, where they
+// are the most recent, and only locally if it fails.
+func (cs *CookieSessions) lookup(id string, now time.Time) (*cookieSession, error) {
+	if cs.shared != nil {
+		shared, ok, err := cs.shared.Session(id)
+		if err == nil {
+			if !ok {
+				cs.sessions.Remove(id)
+				return nil, nil
+			}
+			session := &cookieSession{started: shared.Started, lastSeen: now, requests: shared.Requests, user: shared.User}
+			cs.sessions.Set(id, session)
+			return session, nil
+		}
+		return cs.lookupLocal(id, now), err
+	}
+	return cs.lookupLocal(id, now), nil
+}
+
+// lookupLocal returns the session of the identifier known to the instance,
+// or nil if it is unknown or has expired.
+func (cs *CookieSessions) lookupLocal(id string, now time.Time) *cookieSession {
+	v, err := cs.sessions.Get(id)
+	if err != nil {
+		return nil
+	}
+	session := v.(*cookieSession)
+	session.mu.Lock()
+	expired := now.Sub(session.lastSeen) > cs.timeout
+	session.mu.Unlock()
+	if expired {
+		cs.sessions.Remove(id)
+		return nil
+	}
+	return session
+}
+
+// useCookieSession returns the writer setting the session cookie of the
+// sessions started by the response, and the request carrying the state of
+// its session. The requests without a valid session cookie start a new
+// session, and those with an unknown or expired one are tagged
+// session_cookie_invalid. The session of a login form is logged in as its
+// user if the response redirects, as the login forms do on success. The
+// body is restored so it can be read again.
+func (s *Server) useCookieSession(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request) {
+	cs := s.CookieSessions
+	if cs == nil {
+		return w, r
+	}
+	now := time.Now()
+	st := &llm.SessionState{Cookie: cs.name}
+	var session *cookieSession
+	sw := &sessionWriter{ResponseWriter: w, name: cs.name}
+	var id string
+	if c, err := r.Cookie(cs.name); err == nil {
+		id = c.Value
+		var err error
+		if session, err = cs.lookup(id, now); err != nil {
+			s.Logger.Errorf("error looking up the shared cookie session: %s", err)
+		}
+		if session == nil {
+			st.Expired = true
+			r = r.WithContext(logger.WithTags(r.Context(), sessionCookieInvalidTag))
+		}
+	}
+	if session == nil {
+		var err error
+		if id, session, err = cs.start(now); err != nil {
+			s.Logger.Errorf("error sharing the cookie session: %s", err)
+		}
+		st.New = true
+		sw.cookie = cs.name + "=" + id + cs.format.attributes
+	}
+
+	session.mu.Lock()
+	st.Started, st.Requests, st.User = session.started, session.requests, session.user
+	session.requests++
+	session.lastSeen = now
+	session.mu.Unlock()
+	if cs.shared != nil {
+		if err := cs.shared.CountSessionRequest(id, cs.timeout); err != nil {
+			s.Logger.Errorf("error counting the request of the shared cookie session: %s", err)
+		}
+	}
+	sw.sessions, sw.id, sw.session, sw.logger = cs, id, session, s.Logger
+
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			s.Logger.Errorf("error reading the body of %s: %s", r.RemoteAddr, err)
+		} else if c, ok := logger.LoginCredential(r, body); ok {
+			sw.login = c.Username
+		}
+	}
+	return sw, r.WithContext(llm.WithSessionState(r.Context(), st))
+}
+
+// sessionWriter replaces the session cookies of the response with the
+// cookie of the session it starts, if any, and logs the session in as the
+// user of the login form if the response redirects.
+type sessionWriter struct {
+	http.ResponseWriter
+	name        string
+	cookie      string
+	login       string
+	sessions    *CookieSessions
+	id          string
+	session     *cookieSession
+	logger      *logrus.Logger
+	wroteHeader bool
+}
+
+func (w *sessionWriter) WriteHeader(code int) {
+	// The interim responses are sent before the final response.
+	if w.wroteHeader || (code >= 100 && code < 200) {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	var cookies []string
+	for _, v := range h.Values("Set-Cookie") {
+		if name, _, _ := strings.Cut(v, "="); strings.TrimSpace(name) != w.name {
+			cookies = append(cookies, v)
+		}
+	}
+	if w.cookie != "" {
+		cookies = append(cookies, w.cookie)
+	}
+	if len(cookies) > 0 {
+		h["Set-Cookie"] = cookies
+	} else {
+		h.Del("Set-Cookie")
+	}
+
+	if w.login != "" && code >= 300 && code < 400 {
+		w.session.mu.Lock()
+		w.session.user = w.login
+		w.session.mu.Unlock()
+		if cs := w.sessions; cs != nil && cs.shared != nil {
+			if err := cs.shared.SetSessionUser(w.id, w.login, cs.timeout); err != nil {
+				w.logger.Errorf("error logging the shared cookie session in: %s", err)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sessionWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *sessionWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCookieSession(t *testing.T) {
+	s := &Server{
+		Config:         &config.Config{},
+		CookieSessions: NewCookieSessions(config.CookieSessionsConfig{Timeout: time.Minute}, nil),
+		Logger:         logrus.New(),
+	}
+	// serve answers the request as the generated response would, setting a
+	// session cookie of its own.
+	serve := func(r *http.Request, status int) (*httptest.ResponseRecorder, *llm.SessionState, *http.Request) {
+		rec := httptest.NewRecorder()
+		w, r := s.useCookieSession(rec, r)
+		w.Header().Set("Set-Cookie", "PHPSESSID=generated; path=/")
+		w.WriteHeader(status)
+		return rec, llm.SessionStateFrom(r.Context()), r
+	}
+
+	w, st, _ := serve(httptest.NewRequest("GET", "/", nil), http.StatusOK)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "PHPSESSID" || cookies[0].Value == "generated" || len(cookies[0].Value) != 26 {
+		t.Fatalf("Expected a new PHP session identifier, got %v", cookies)
+	}
+	if !st.New || st.Expired {
+		t.Errorf("Expected a new session, got %+v", st)
+	}
+	id := cookies[0].Value
+
+	r := httptest.NewRequest("POST", "/login.php", strings.NewReader("username=admin&password=secret"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(&http.Cookie{Name: "PHPSESSID", Value: id})
+	w, st, r = serve(r, http.StatusFound)
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("Expected the session cookie not set again, got %v", w.Result().Cookies())
+	}
+	if st.New || st.Expired || st.Requests != 1 || st.User != "" {
+		t.Errorf("Expected the session not logged in before the login, got %+v", st)
+	}
+	if body := make([]byte, 64); r.Body == nil {
+		t.Error("Expected the body restored")
+	} else if n, _ := r.Body.Read(body); !strings.Contains(string(body[:n]), "username=admin") {
+		t.Errorf("Expected the body restored, got %q", body[:n])
+	}
+
+	r = httptest.NewRequest("GET", "/admin/", nil)
+	r.AddCookie(&http.Cookie{Name: "PHPSESSID", Value: id})
+	if _, st, r = serve(r, http.StatusOK); st.User != "admin" || st.Requests != 2 {
+		t.Errorf("Expected the session logged in as admin, got %+v", st)
+	}
+	if !strings.Contains(s.cacheKey(r, "8080"), "Session-User: admin") {
+		t.Error("Expected the cache key of the session logged in")
+	}
+
+	r = httptest.NewRequest("GET", "/admin/", nil)
+	r.AddCookie(&http.Cookie{Name: "PHPSESSID", Value: "forgedsessionidentifier000"})
+	w, st, r = serve(r, http.StatusOK)
+	if !st.New || !st.Expired || st.User != "" || len(w.Result().Cookies()) != 1 {
+		t.Errorf("Expected a new session for the unknown identifier, got %+v", st)
+	}
+	if tags := logger.TagsFrom(r.Context()); len(tags) != 1 || tags[0] != sessionCookieInvalidTag {
+		t.Errorf("Expected the request tagged %s, got %v", sessionCookieInvalidTag, tags)
+	}
+
+	// The sessions expire when idle for the timeout.
+	session, _ := s.CookieSessions.lookup(id, time.Now())
+	session.lastSeen = time.Now().Add(-2 * time.Minute)
+	if session, _ := s.CookieSessions.lookup(id, time.Now()); session != nil {
+		t.Error("Expected the idle session expired")
+	}
+}
+
+func TestSessionFormats(t *testing.T) {
+	for name, want := range map[string]int{"JSESSIONID": 32, "ASP.NET_SessionId": 24, "sessionid": 32, "sid": 32} {
+		cs := NewCookieSessions(config.CookieSessionsConfig{Name: name}, nil)
+		id, _, _ := cs.start(time.Now())
+		if len(id) != want || strings.Trim(id, cs.format.alphabet) != "" {
+			t.Errorf("%s: unexpected identifier %q", name, id)
+		}
+	}
+}
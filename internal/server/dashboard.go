@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"embed"
+	"io/fs"
+	"net/http"
+	"strconv"
+
+	"github.com/0x4d31/galah/internal/eventstore"
+	"github.com/0x4d31/galah/internal/logger"
+)
+
+// dashboardTop is the default number of top sources and paths of the
+// dashboard.
+const dashboardTop = 20
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboardHandler serves the dashboard at /dashboard/, authenticated with the
+// token: the live events, the timelines of the sources, the top paths and the
+// generated responses. The data is read from the event store, if configured,
+// or else from the recent events kept in memory.
+func (s *Server) dashboardHandler(token string) http.Handler {
+	static, _ := fs.Sub(dashboardFiles, "dashboard")
+	mux := http.NewServeMux()
+	mux.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", http.FileServer(http.FS(static))))
+	mux.HandleFunc("GET /dashboard/api/events", s.handleEvents)
+	mux.HandleFunc("GET /dashboard/api/sources", s.handleTop((*eventstore.Store).TopSources, (*logger.RecentEvents).TopSources))
+	mux.HandleFunc("GET /dashboard/api/paths", s.handleTop((*eventstore.Store).TopPaths, (*logger.RecentEvents).TopPaths))
+	return requireToken(token, mux)
+}
+
+// handleTop serves the top values of the event store, or of the recent events.
+func (s *Server) handleTop(stored func(*eventstore.Store, context.Context, eventstore.Filter) ([]eventstore.Count, error), recent func(*logger.RecentEvents, int) []eventstore.Count) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := dashboardTop
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		switch {
+		case s.EventStore != nil:
+			top, err := stored(s.EventStore, r.Context(), eventstore.Filter{Limit: limit})
+			if err != nil {
+				s.Logger.Errorf("error querying the event store: %s", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if top == nil {
+				top = []eventstore.Count{}
+			}
+			s.writeAdmin(w, top)
+		case s.Recent != nil:
+			s.writeAdmin(w, recent(s.Recent, limit))
+		default:
+			http.Error(w, "the recent events are not kept", http.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+"use strict";
+
+// The events are the ones of the event log, or of the event store with the
+// logged event in data. The attacker-controlled values are only set as text.
+const refreshInterval = 5000;
+const $ = (id) => document.getElementById(id);
+
+function el(tag, text, className) {
+  const e = document.createElement(tag);
+  if (text !== undefined) e.textContent = text;
+  if (className) e.className = className;
+  return e;
+}
+
+async function get(path) {
+  const resp = await fetch(path, { headers: { Accept: "application/json" } });
+  if (!resp.ok) throw new Error(`${path}: ${resp.status} ${await resp.text()}`);
+  return resp.json();
+}
+
+function status(ev) {
+  if (ev.httpResponse && ev.httpResponse.status_code) return ev.httpResponse.status_code;
+  if (ev.level === "error") return 500;
+  return ev.httpResponse ? 200 : "";
+}
+
+function showSource(ip) {
+  $("source").value = ip;
+  refresh();
+}
+
+function showEvent(ev) {
+  const req = ev.httpRequest || {};
+  $("request").textContent = `${req.method || ""} ${req.request || ""} ${req.protocolVersion || ""}\n${req.headers || ""}\n\n${req.body || ""}`;
+  let resp = "";
+  if (ev.httpResponse) {
+    const headers = ev.httpResponse.headers || {};
+    resp = Object.keys(headers).map((k) => `${k}: ${headers[k]}`).join("\n");
+    let body = ev.httpResponse.body || "";
+    if (ev.httpResponse.encoding === "base64") {
+      try { body = atob(body); } catch (e) { /* keep the encoded body */ }
+    }
+    resp += `\n\n${body}`;
+  } else if (ev.webSocket) {
+    resp = JSON.stringify(ev.webSocket, null, 2);
+  } else if (ev.error) {
+    resp = JSON.stringify(ev.error, null, 2);
+  }
+  $("response").textContent = resp;
+  $("detail").hidden = false;
+  $("detail").scrollIntoView();
+}
+
+function renderEvents(events, source) {
+  const tbody = $("events");
+  tbody.replaceChildren();
+  // A source's timeline is shown oldest first.
+  if (source) events.reverse();
+  for (const e of events) {
+    const ev = e.data || e;
+    const req = ev.httpRequest || {};
+    const tr = el("tr");
+    tr.append(el("td", new Date(ev.time).toLocaleString()));
+    const src = el("td");
+    const link = el("a", ev.srcIP || "");
+    link.addEventListener("click", (event) => { event.stopPropagation(); showSource(ev.srcIP); });
+    src.append(link);
+    tr.append(src, el("td", ev.port || ""), el("td", req.method || ""), el("td", req.request || "", "uri"));
+    const code = status(ev);
+    tr.append(el("td", String(code), code >= 500 ? "error" : undefined));
+    const tags = el("td");
+    for (const t of ev.tags || []) tags.append(el("span", t, "tag"));
+    tr.append(tags);
+    tr.addEventListener("click", () => showEvent(ev));
+    tbody.append(tr);
+  }
+}
+
+function renderTop(id, counts, onClick) {
+  const list = $(id);
+  list.replaceChildren();
+  for (const c of counts) {
+    const li = el("li");
+    const value = el(onClick ? "a" : "span", c.value);
+    if (onClick) value.addEventListener("click", () => onClick(c.value));
+    li.append(value, ` (${c.count})`);
+    list.append(li);
+  }
+}
+
+async function refresh() {
+  const source = $("source").value.trim();
+  $("events-title").textContent = source ? `Timeline of ${source}` : "Live events";
+  const params = new URLSearchParams({ limit: "200" });
+  if (source) params.set("src_ip", source);
+  try {
+    const [events, sources, paths] = await Promise.all([
+      get(`api/events?${params}`),
+      get("api/sources"),
+      get("api/paths"),
+    ]);
+    renderEvents(events, source);
+    renderTop("sources", sources, showSource);
+    renderTop("paths", paths);
+  } catch (err) {
+    $("events-title").textContent = err.message;
+  }
+}
+
+$("source").addEventListener("change", refresh);
+$("close").addEventListener("click", () => { $("detail").hidden = true; });
+setInterval(() => { if ($("live").checked) refresh(); }, refreshInterval);
+refresh();
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/eventstore"
+	el "github.com/0x4d31/galah/internal/logger"
+	"github.com/sirupsen/logrus"
+)
+
+func TestDashboard(t *testing.T) {
+	recent := el.NewRecentEvents(10)
+	events := logrus.New()
+	events.Out = io.Discard
+	events.AddHook(recent)
+	events.WithFields(logrus.Fields{"srcIP": "192.0.2.1", "httpRequest": el.HTTPRequest{Request: "/.env"}}).Info("successfulResponse")
+
+	s := &Server{Logger: logrus.New(), Recent: recent}
+	h := s.dashboardHandler("secret")
+	get := func(target string, auth bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		if auth {
+			r.SetBasicAuth("analyst", "secret")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := get("/dashboard/", false); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected a basic authentication challenge, got %d", w.Code)
+	}
+	if w := get("/dashboard/", true); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "dashboard.js") {
+		t.Errorf("Expected the dashboard page, got %d", w.Code)
+	}
+	if w := get("/dashboard/dashboard.js", true); w.Code != http.StatusOK {
+		t.Errorf("Expected the dashboard script, got %d", w.Code)
+	}
+
+	var paths []eventstore.Count
+	w := get("/dashboard/api/paths", true)
+	if err := json.Unmarshal(w.Body.Bytes(), &paths); err != nil || len(paths) != 1 || paths[0].Value != "/.env" {
+		t.Errorf("Unexpected top paths: %d %s", w.Code, w.Body)
+	}
+	var got []map[string]any
+	w = get("/dashboard/api/events?src_ip=192.0.2.1", true)
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got) != 1 {
+		t.Errorf("Unexpected events: %d %s", w.Code, w.Body)
+	}
+	if w := get("/dashboard/api/sources?limit=0", true); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid limit, got %d", w.Code)
+	}
+}
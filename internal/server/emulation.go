@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// emulationTagPrefix prefixes the name of the emulations matching a request
+// in the tags of its event.
+const emulationTagPrefix = "emulation:"
+
+// tagEmulations tags the request with the emulations matching it.
+func (s *Server) tagEmulations(r *http.Request) *http.Request {
+	var tags []string
+	for _, e := range s.Emulations {
+		if e.Matches(r) {
+			tags = append(tags, emulationTagPrefix+e.Name)
+		}
+	}
+	if len(tags) == 0 {
+		return r
+	}
+	return r.WithContext(logger.WithTags(r.Context(), tags...))
+}
+
+// applyProfile replaces the headers of the response identifying the server
+// with those of the server profile and of the emulations matching the request.
+func (s *Server) applyProfile(r *http.Request, resp *llm.JSONResponse) {
+	if s.Profile != nil {
+		s.Profile.Apply(resp)
+	}
+	for _, e := range s.Emulations {
+		if e.Matches(r) {
+			e.Apply(resp)
+		}
+	}
+}
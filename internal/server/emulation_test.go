@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+func TestEmulations(t *testing.T) {
+	var ecs []config.EmulationConfig
+	for name := range llm.Emulations {
+		ecs = append(ecs, config.EmulationConfig{Name: name})
+	}
+	emulations, err := llm.ResolveEmulations(ecs)
+	if err != nil {
+		t.Fatalf("ResolveEmulations() error = %v", err)
+	}
+	for _, e := range emulations {
+		if _, err := NewStaticRules(e.Artifacts); err != nil {
+			t.Errorf("Invalid artifacts of emulation %s: %s", e.Name, err)
+		}
+	}
+
+	citrix, err := llm.ResolveEmulations([]config.EmulationConfig{{Name: "citrix-adc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Profile:    &llm.ServerProfile{Headers: map[string]string{"Server": "Apache"}},
+		Emulations: citrix,
+	}
+	rules, err := NewStaticRules(citrix[0].Artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := s.tagEmulations(httptest.NewRequest("GET", "/vpn/../vpns/cfg/smb.conf", nil))
+	if tags := logger.TagsFrom(r.Context()); len(tags) != 1 || tags[0] != "emulation:citrix-adc" {
+		t.Errorf("Expected the emulation:citrix-adc tag, got %v", tags)
+	}
+	if rule := rules.match(r); rule == nil || rule.Name != "smb.conf" {
+		t.Errorf("Expected the smb.conf artifact to match, got %v", rule)
+	}
+
+	resp := llm.JSONResponse{Headers: map[string]string{"X-Frame-Options": "DENY"}}
+	s.applyProfile(r, &resp)
+	if resp.Headers["Server"] != "Apache" || resp.Headers["X-Frame-Options"] != "SAMEORIGIN" {
+		t.Errorf("Expected the profile and emulation headers, got %v", resp.Headers)
+	}
+
+	other := s.tagEmulations(httptest.NewRequest("GET", "/index.html", nil))
+	if tags := logger.TagsFrom(other.Context()); len(tags) != 0 {
+		t.Errorf("Expected no tags, got %v", tags)
+	}
+}
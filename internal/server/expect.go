@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	expectContinue = "continue"
+	expectReject   = "reject"
+)
+
+// handleExpect handles requests sent with "Expect: 100-continue". In continue
+// mode, the interim 100 Continue response is written before the body is read
+// and the final response is generated as usual. In reject mode, the request is
+// answered with 417 Expectation Failed without reading the body. It returns
+// true if the request has been answered.
+func (s *Server) handleExpect(w http.ResponseWriter, r *http.Request) bool {
+	if !strings.EqualFold(r.Header.Get("Expect"), "100-continue") {
+		return false
+	}
+
+	switch s.Config.ExpectContinue {
+	case expectReject:
+		s.Logger.Infof("rejecting the expectation of %s with 417 Expectation Failed", r.RemoteAddr)
+		w.Header().Set("Connection", "close")
+		http.Error(w, "Expectation Failed", http.StatusExpectationFailed)
+		return true
+	default:
+		// net/http writes the interim response on the first read of the body.
+		_, _ = r.Body.Read(nil)
+		return false
+	}
+}
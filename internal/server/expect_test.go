@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestExpectContinue(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		wantInterim  bool
+		wantStatus   int
+		wantGenerate bool
+	}{
+		{
+			name:         "interimContinue",
+			mode:         expectContinue,
+			wantInterim:  true,
+			wantStatus:   http.StatusOK,
+			wantGenerate: true,
+		},
+		{
+			name:       "expectationFailed",
+			mode:       expectReject,
+			wantStatus: http.StatusExpectationFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := logrus.New()
+			eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			model := &sequenceModel{results: []any{validResponse}}
+			s := &Server{
+				Config:      &config.Config{UserPrompt: "%q", ExpectContinue: tt.mode},
+				EventLogger: eventLogger,
+				LLMConfig:   llm.Config{Provider: "openai"},
+				Logger:      l,
+				Model:       model,
+			}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				s.handleRequest(w, r, "127.0.0.1:8080")
+			}))
+			defer ts.Close()
+
+			conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			body := "user=admin&pass=admin"
+			fmt.Fprintf(conn, "POST /login HTTP/1.1\r\nHost: example.com\r\nContent-Length: %d\r\nExpect: 100-continue\r\n\r\n", len(body))
+			br := bufio.NewReader(conn)
+
+			if tt.wantInterim {
+				status, err := br.ReadString('\n')
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.HasPrefix(status, "HTTP/1.1 100 Continue") {
+					t.Fatalf("Expected interim 100 Continue, got %q", status)
+				}
+				if _, err := br.ReadString('\n'); err != nil {
+					t.Fatal(err)
+				}
+				fmt.Fprint(conn, body)
+			}
+
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Server"); tt.wantGenerate && got != "nginx" {
+				t.Errorf("Expected Server header %q, got %q", "nginx", got)
+			}
+			if generated := model.calls > 0; generated != tt.wantGenerate {
+				t.Errorf("Expected generation %v, got %v", tt.wantGenerate, generated)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// pinnedHeaders are the headers identifying the server software, pinned per
+// persona to the first value generated for them.
+var pinnedHeaders = []string{"Server", "X-Powered-By", "X-Aspnet-Version"}
+
+// HeaderPins are the pinned header values of the personas.
+type HeaderPins struct {
+	mu     sync.Mutex
+	values map[string]map[string]string
+}
+
+// NewHeaderPins returns the header pins, without any value pinned.
+func NewHeaderPins() *HeaderPins {
+	return &HeaderPins{values: make(map[string]map[string]string)}
+}
+
+// apply sets the pinned values of the named headers of the persona in the
+// headers, and pins the values of the headers not pinned yet.
+func (hp *HeaderPins) apply(persona string, headers map[string]string, names []string) {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	pins := hp.values[persona]
+	if pins == nil {
+		pins = make(map[string]string)
+		hp.values[persona] = pins
+	}
+	for _, name := range names {
+		if value, ok := pins[name]; ok {
+			headers[name] = value
+		} else if value, ok := headers[name]; ok {
+			pins[name] = value
+		}
+	}
+}
+
+// sanitizeHeaders enforces the invariants of the generated headers of the
+// response, if enabled (see llm.SanitizeHeaders), and keeps the headers
+// identifying the server the same in all the responses of the persona,
+// except those set by its server profile. The order of the headers is
+// stable, as the server sorts them.
+func (s *Server) sanitizeHeaders(resp *llm.JSONResponse) {
+	if !s.Config.Response.SanitizeHeaders {
+		return
+	}
+	llm.SanitizeHeaders(resp)
+	if s.HeaderPins == nil {
+		return
+	}
+	var names []string
+	for _, name := range pinnedHeaders {
+		if s.Profile == nil || !hasHeader(s.Profile.Headers, name) {
+			names = append(names, name)
+		}
+	}
+	s.HeaderPins.apply(s.persona, resp.Headers, names)
+}
+
+// hasHeader reports whether the headers have the named header, in any case.
+func hasHeader(headers map[string]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
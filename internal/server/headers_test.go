@@ -0,0 +1,41 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+func TestSanitizeHeadersPins(t *testing.T) {
+	cfg := &config.Config{Response: config.ResponseConfig{SanitizeHeaders: true}}
+	s := &Server{Config: cfg, HeaderPins: NewHeaderPins()}
+	camera := s.withPersona(&Persona{Config: cfg}, portPersona(8443))
+	profiled := s.withPersona(&Persona{Config: cfg, Profile: &llm.ServerProfile{Headers: map[string]string{"Server": "nginx/1.18.0"}}}, portPersona(8080))
+
+	sanitize := func(s *Server, headers map[string]string) map[string]string {
+		resp := llm.JSONResponse{Headers: headers}
+		s.sanitizeHeaders(&resp)
+		return resp.Headers
+	}
+	if got := sanitize(s, map[string]string{"server": "Apache/2.4.41", "x-powered-by": "PHP/7.4.3"}); got["Server"] != "Apache/2.4.41" {
+		t.Fatalf("Expected the first Server header kept, got %v", got)
+	}
+	got := sanitize(s, map[string]string{"Server": "Apache/2.4.57 (Debian)", "Content-Length": "10"})
+	if got["Server"] != "Apache/2.4.41" || got["X-Powered-By"] != "PHP/7.4.3" || got["Content-Length"] != "" {
+		t.Errorf("Expected the pinned headers of the server, got %v", got)
+	}
+	if got := sanitize(camera, map[string]string{"Server": "App-webs/"}); got["Server"] != "App-webs/" || got["X-Powered-By"] != "" {
+		t.Errorf("Expected the headers of the persona pinned separately, got %v", got)
+	}
+	sanitize(profiled, map[string]string{"Server": "nginx/1.18.0"})
+	profiled.Profile.Headers["Server"] = "nginx/1.24.0"
+	if got := sanitize(profiled, map[string]string{"Server": "nginx/1.24.0"}); got["Server"] != "nginx/1.24.0" {
+		t.Errorf("Expected the Server header of the profile not pinned, got %v", got)
+	}
+
+	cfg.Response.SanitizeHeaders = false
+	if got := sanitize(s, map[string]string{"Content-Length": "10"}); got["Content-Length"] != "10" {
+		t.Errorf("Expected the headers unchanged when disabled, got %v", got)
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// healthCheckTimeout is the maximum duration of the readiness checks.
+const healthCheckTimeout = 5 * time.Second
+
+// Health is the document served by the health and readiness endpoints, with
+// the result of each check: "ok" or the error.
+type Health struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// StartManagementServer serves the health check at /healthz and the
+// readiness check at /readyz on addr, for orchestrators such as Kubernetes,
+// and, if dashboardToken isn't empty, the dashboard at /dashboard/,
+// authenticated with it.
+func (s *Server) StartManagementServer(addr, dashboardToken string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	if dashboardToken != "" {
+		mux.Handle("/dashboard/", s.dashboardHandler(dashboardToken))
+	}
+
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 2 * healthCheckTimeout,
+	}
+	s.Logger.Infof("starting management server on %s", addr)
+	return server.ListenAndServe()
+}
+
+// handleHealthz answers while the process is running.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	s.writeHealth(w, Health{Status: "ok"}, true)
+}
+
+// handleReadyz answers if the configuration file is valid, the cache is
+// available and at least one of the LLM providers is reachable.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+	h, ready := s.checkReadiness(ctx)
+	s.writeHealth(w, h, ready)
+}
+
+func (s *Server) writeHealth(w http.ResponseWriter, h Health, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(h); err != nil {
+		s.Logger.Errorf("error writing the health status: %s", err)
+	}
+}
+
+// checkReadiness runs the readiness checks concurrently.
+func (s *Server) checkReadiness(ctx context.Context) (Health, bool) {
+	checks := map[string]func() error{}
+	if s.ConfigFile != "" {
+		checks["config"] = func() error {
+			_, err := config.LoadConfig(s.ConfigFile)
+			return err
+		}
+	}
+	if s.Cache != nil {
+		checks["cache"] = func() error { return cache.Ping(s.Cache) }
+	}
+	providers := []string{}
+	addProvider := func(c llm.Config) {
+		name := "llm:" + c.Provider + "/" + c.Model
+		if _, ok := checks[name]; ok {
+			return
+		}
+		providers = append(providers, name)
+		checks[name] = func() error { return llm.CheckReachable(ctx, c) }
+	}
+	addProvider(s.LLMConfig)
+	for _, p := range s.Fallback {
+		addProvider(p.Config)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]string, len(checks))
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := "ok"
+			if err := check(); err != nil {
+				result = err.Error()
+			}
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	ready := true
+	for name, result := range results {
+		if (name == "config" || name == "cache") && result != "ok" {
+			ready = false
+		}
+	}
+	// Any reachable provider can answer, the others being fallbacks.
+	reachable := false
+	for _, name := range providers {
+		reachable = reachable || results[name] == "ok"
+	}
+	ready = ready && reachable
+
+	h := Health{Status: "ok", Checks: results}
+	if !ready {
+		h.Status = "unavailable"
+	}
+	return h, ready
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHandleReadyz(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configFile, []byte("system_prompt: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Logger:     logrus.New(),
+		ConfigFile: configFile,
+		LLMConfig:  llm.Config{Provider: "ollama", Model: "llama3", ServerURL: "http://127.0.0.1:1"},
+		Fallback:   llm.Chain{{Config: llm.Config{Provider: "ollama", Model: "mistral", ServerURL: "http://" + ln.Addr().String()}}},
+	}
+
+	readyz := func() (int, Health) {
+		w := httptest.NewRecorder()
+		s.handleReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+		var h Health
+		json.Unmarshal(w.Body.Bytes(), &h)
+		return w.Code, h
+	}
+	// The fallback provider is reachable.
+	code, h := readyz()
+	if code != http.StatusOK || h.Status != "ok" || h.Checks["config"] != "ok" || h.Checks["llm:ollama/mistral"] != "ok" || h.Checks["llm:ollama/llama3"] == "ok" {
+		t.Errorf("Unexpected readiness %d: %+v", code, h)
+	}
+
+	if err := os.WriteFile(configFile, []byte("ports: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code, h := readyz(); code != http.StatusServiceUnavailable || h.Status != "unavailable" || h.Checks["config"] == "ok" {
+		t.Errorf("Expected the invalid config to be unready, got %d: %+v", code, h)
+	}
+
+	w := httptest.NewRecorder()
+	s.handleHealthz(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected a healthy status, got %d", w.Code)
+	}
+}
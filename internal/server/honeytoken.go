@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// honeytokenTag tags the events of the requests using honeytokens.
+const honeytokenTag = "honeytoken"
+
+// pixelGIF is the transparent 1x1 GIF served for the pixel tokens.
+var pixelGIF = []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\x00\x00\x00!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02D\x01\x00;")
+
+// detectHoneytokens returns the request referencing the honeytokens it uses
+// in its event, tagged honeytoken. The body is restored so it can be read
+// again.
+func (s *Server) detectHoneytokens(r *http.Request) *http.Request {
+	if s.Honeytokens == nil {
+		return r
+	}
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			s.Logger.Errorf("error reading the body of %s: %s", r.RemoteAddr, err)
+			return r
+		}
+	}
+	used := s.Honeytokens.Used(r, body, llm.SourceIP(r))
+	if len(used) == 0 {
+		return r
+	}
+	ctx := logger.WithTags(r.Context(), honeytokenTag)
+	return r.WithContext(logger.WithHoneytokens(ctx, used))
+}
+
+// servePixel serves the GIF of the request for a pixel token, and reports
+// whether it did.
+func (s *Server) servePixel(w http.ResponseWriter, r *http.Request, port string) bool {
+	if s.Honeytokens == nil || !s.Honeytokens.IsPixel(r.URL.Path) {
+		return false
+	}
+	resp := llm.JSONResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "image/gif", "Cache-Control": "no-store"},
+		Encoding:   llm.EncodingBase64,
+		Body:       base64.StdEncoding.EncodeToString(pixelGIF),
+	}
+	s.sendResponse(w, resp)
+	s.EventLogger.LogEvent(r, resp, port)
+	return true
+}
+
+// injectHoneytokens embeds the honeytokens of the source of the request into
+// the response.
+func (s *Server) injectHoneytokens(r *http.Request, resp *llm.JSONResponse) {
+	if s.Honeytokens == nil {
+		return
+	}
+	if err := s.Honeytokens.Inject(llm.SourceIP(r), r.URL.Path, resp); err != nil {
+		s.Logger.Errorf("error recording the honeytokens of %s: %s", r.RemoteAddr, err)
+	}
+}
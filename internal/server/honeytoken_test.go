@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/honeytoken"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHoneytokens(t *testing.T) {
+	tokens, err := honeytoken.New(honeytoken.Config{Kinds: []string{honeytoken.KindPixel}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Logger: logrus.New(), Honeytokens: tokens}
+
+	resp := llm.JSONResponse{Headers: map[string]string{"Content-Type": "text/html"}, Body: "<html><body></body></html>"}
+	s.injectHoneytokens(httptest.NewRequest("GET", "/", nil), &resp)
+	issued := tokens.Tokens()
+	if len(issued) != 1 || !strings.Contains(resp.Body, issued[0].Value) {
+		t.Fatalf("Expected the pixel embedded in the body, got %s", resp.Body)
+	}
+
+	r := s.detectHoneytokens(httptest.NewRequest("GET", issued[0].Value, nil))
+	if !slices.Contains(logger.TagsFrom(r.Context()), honeytokenTag) {
+		t.Errorf("Expected the request tagged %q, got %v", honeytokenTag, logger.TagsFrom(r.Context()))
+	}
+	if used := logger.HoneytokensFrom(r.Context()); len(used) != 1 || used[0].ID != issued[0].ID {
+		t.Errorf("Expected the token used referenced, got %+v", used)
+	}
+
+	eventLog := filepath.Join(t.TempDir(), "event_log.json")
+	s.EventLogger, err = logger.New(eventLog, llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), s.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	// The content type of the GIF is sniffed by net/http.
+	if !s.servePixel(w, r, "8080") || http.DetectContentType(w.Body.Bytes()) != "image/gif" {
+		t.Errorf("Expected the pixel served, got %d %q", w.Code, w.Body.String())
+	}
+	data, err := os.ReadFile(eventLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event struct {
+		Honeytokens []honeytoken.Token `json:"honeytokens"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil || len(event.Honeytokens) != 1 || event.Honeytokens[0].Source != "192.0.2.1" {
+		t.Errorf("Expected the event to list the token used, got %s", data)
+	}
+	if s.servePixel(httptest.NewRecorder(), httptest.NewRequest("GET", "/static/logo.gif", nil), "8080") {
+		t.Error("Expected no pixel served for another path")
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// altSvcMaxAge is how long the clients may remember that a port offers
+// HTTP/3.
+const altSvcMaxAge = 24 * time.Hour
+
+// withAltSvc advertises the HTTP/3 listener of the port in the Alt-Svc header
+// of the responses, for the clients to switch to QUIC.
+func withAltSvc(handler http.Handler, port uint16) http.Handler {
+	altSvc := fmt.Sprintf(`h3=":%d"; ma=%d`, port, int(altSvcMaxAge.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", altSvc)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// startHTTP3Server serves HTTP/3 over QUIC on the UDP port of the address of
+// the TLS server, with its handler and certificates (those of certFile and
+// keyFile if it has no TLS configuration). The HTTP/3 server is closed when
+// the TLS server is shut down.
+func (s *Server) startHTTP3Server(server *http.Server, certFile, keyFile string) (*http3.Server, error) {
+	tlsConfig := server.TLSConfig
+	if tlsConfig == nil {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	conn, err := net.ListenPacket("udp", server.Addr)
+	if err != nil {
+		return nil, err
+	}
+	h3 := &http3.Server{
+		Addr:      server.Addr,
+		Handler:   server.Handler,
+		TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+	}
+	server.RegisterOnShutdown(func() {
+		h3.Close()
+		conn.Close()
+	})
+
+	s.Logger.Infof("starting HTTP/3 server on %s", server.Addr)
+	go func() {
+		if err := h3.Serve(conn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.Logger.Errorf("error serving HTTP/3 on %s: %s", server.Addr, err)
+		}
+	}()
+	return h3, nil
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// injectionTag is the event tag of requests containing a prompt injection.
+const injectionTag = "prompt_injection"
+
+// checkInjection tags the request if it contains a prompt injection, found
+// by the known phrases or, if enabled, by the classifier.
+func (s *Server) checkInjection(r *http.Request) *http.Request {
+	cfg := s.Config.PromptInjection
+	if !cfg.Detect {
+		return r
+	}
+
+	matches, err := llm.DetectInjection(r)
+	if err != nil {
+		s.Logger.Errorf("error checking the request for prompt injection: %s", err)
+		return r
+	}
+	detected := len(matches) > 0
+	if !detected && cfg.Classifier && s.Model != nil {
+		detected, err = llm.ClassifyInjection(r.Context(), s.Model, r)
+		if err != nil {
+			s.Logger.Errorf("error classifying the request for prompt injection: %s", err)
+		}
+	}
+	if !detected {
+		return r
+	}
+
+	s.Logger.Infof("prompt injection detected in the request for %q from %s: %q", r.URL.String(), r.RemoteAddr, matches)
+	return r.WithContext(logger.WithTags(r.Context(), injectionTag))
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package server
+
+// ListenForInvalidationSignals is a no-op on platforms without SIGUSR1.
+func (s *Server) ListenForInvalidationSignals() {}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package server
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/0x4d31/galah/internal/cache"
+)
+
+// ListenForInvalidationSignals flushes the response cache on SIGUSR1, e.g.
+// after changing the prompt or the server profile.
+func (s *Server) ListenForInvalidationSignals() {
+	if s.Cache == nil {
+		return
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1)
+
+	go func() {
+		for range sig {
+			n, err := cache.InvalidateAll(s.Cache)
+			if err != nil {
+				s.Logger.Errorf("error invalidating the response cache: %s", err)
+				continue
+			}
+			s.Logger.Infof("invalidated %d cached responses", n)
+		}
+	}()
+}
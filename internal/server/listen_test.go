@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSetupServerAddress(t *testing.T) {
+	s := &Server{Config: &config.Config{}, Logger: logrus.New()}
+	tests := []struct {
+		pc   config.PortConfig
+		addr string
+	}{
+		{config.PortConfig{Port: 8080, Protocol: "HTTP"}, ":8080"},
+		{config.PortConfig{Port: 8080, Protocol: "HTTP", Address: "127.0.0.1"}, "127.0.0.1:8080"},
+		{config.PortConfig{Port: 8443, Protocol: "TLS", Address: "::1"}, "[::1]:8443"},
+		{config.PortConfig{Port: 8443, Protocol: "TLS", Address: "[2001:db8::10]"}, "[2001:db8::10]:8443"},
+		{config.PortConfig{Port: 80, Protocol: "HTTP", Address: "::", Interface: "eth0"}, "[::]:80"},
+	}
+	for _, tt := range tests {
+		if got := s.SetupServer(tt.pc).Addr; got != tt.addr {
+			t.Errorf("Expected the address %s for %+v, got %s", tt.addr, tt.pc, got)
+		}
+	}
+}
+
+func TestSelectInterfaceIP(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("127.0.0.1"),
+		net.ParseIP("::1"),
+		net.ParseIP("fe80::1"),
+		net.ParseIP("192.0.2.10"),
+		net.ParseIP("2001:db8::10"),
+	}
+	if got := selectInterfaceIP(ips, "eth0", false); got != "192.0.2.10" {
+		t.Errorf("Expected the IPv4 address, got %q", got)
+	}
+	if got := selectInterfaceIP(ips, "eth0", true); got != "2001:db8::10" {
+		t.Errorf("Expected the global IPv6 address, got %q", got)
+	}
+	if got := selectInterfaceIP(ips[:3], "eth0", true); got != "fe80::1%eth0" {
+		t.Errorf("Expected the link-local address with its zone, got %q", got)
+	}
+	if got := selectInterfaceIP(ips[:3], "eth0", false); got != "" {
+		t.Errorf("Expected no IPv4 address, got %q", got)
+	}
+}
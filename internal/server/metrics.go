@@ -0,0 +1,22 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// StartMetricsServer serves the metrics in the Prometheus text format at
+// /metrics on addr.
+func (s *Server) StartMetricsServer(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.Metrics.Handler())
+
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	s.Logger.Infof("starting metrics server on %s", addr)
+	return server.ListenAndServe()
+}
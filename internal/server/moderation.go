@@ -0,0 +1,62 @@
+package server
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/tmc/langchaingo/llms"
+)
+
+const moderationRegenerate = "regenerate"
+
+// moderate moderates the generated response, before it is sent, cached and
+// recorded in the history and the signatures: the responses aren't streamed
+// with a moderator. With the regenerate action, the model is asked once for
+// another response if it identified itself; the findings left are patched.
+func (s *Server) moderate(r *http.Request, messages []llms.MessageContent, resp llm.JSONResponse, served llm.Config) (llm.JSONResponse, llm.Config) {
+	if s.Moderator == nil {
+		return resp, served
+	}
+	findings := s.Moderator.Scan(resp)
+	if len(findings) == 0 {
+		return resp, served
+	}
+	// The matches aren't logged, as they may be secrets.
+	s.Logger.Infof("generated response for %q failed the moderation checks: %s", r.URL.String(), moderationChecks(findings))
+
+	// The other findings are patched without losing the response.
+	selfIdentified := slices.ContainsFunc(findings, func(f llm.ModerationFinding) bool {
+		return f.Check == llm.ModerationSelfIdentification
+	})
+	if s.Config.Response.Moderation.Action == moderationRegenerate && selfIdentified {
+		retry := append(messages[:len(messages):len(messages)], llms.TextParts(llms.ChatMessageTypeHuman, llm.ModerationPrompt(findings)))
+		next, _, config, err := s.generateWithPolicy(r, retry)
+		if err != nil {
+			s.Logger.Errorf("error regenerating the moderated response: %s", err)
+		} else {
+			resp, served = next, config
+			if len(s.Moderator.Scan(resp)) == 0 {
+				return resp, served
+			}
+		}
+	}
+
+	// The response is copied, as its headers are shared with the caller.
+	resp.Headers = maps.Clone(resp.Headers)
+	s.Moderator.Patch(&resp)
+	return resp, served
+}
+
+// moderationChecks returns the checks of the findings.
+func moderationChecks(findings []llm.ModerationFinding) string {
+	var checks []string
+	for _, f := range findings {
+		if !slices.Contains(checks, f.Check) {
+			checks = append(checks, f.Check)
+		}
+	}
+	return strings.Join(checks, ", ")
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestModeration(t *testing.T) {
+	l := logrus.New()
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moderator, err := llm.NewModerator(llm.ModerationConfig{Hostnames: []string{"db01.corp.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := &sequenceModel{results: []any{
+		`{"headers": {}, "body": "As an AI language model, I can't emulate a server."}`,
+		`{"headers": {}, "body": "connected to db01.corp.example.com"}`,
+	}}
+	s := &Server{
+		Config: &config.Config{
+			UserPrompt: "%q",
+			Response:   config.ResponseConfig{Moderation: config.ModerationConfig{Enabled: true, Action: moderationRegenerate}},
+		},
+		EventLogger: eventLogger,
+		LLMConfig:   llm.Config{Provider: "openai"},
+		Logger:      l,
+		Model:       model,
+		Moderator:   moderator,
+	}
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleRequest(w, httptest.NewRequest("GET", target, nil), "127.0.0.1:8080")
+		return w
+	}
+
+	if w := serve("/"); w.Body.String() != "connected to localhost" || model.calls != 2 {
+		t.Errorf("Expected the regenerated response to be patched, got %q after %d generations", w.Body, model.calls)
+	}
+
+	s.Config.Response.Moderation.Action = ""
+	if w := serve("/"); w.Body.String() != "I can't emulate a server." || model.calls != 3 {
+		t.Errorf("Expected the response to be patched, got %q after %d generations", w.Body, model.calls)
+	}
+}
+
+func TestModerationStreamed(t *testing.T) {
+	l := logrus.New()
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moderator, err := llm.NewModerator(llm.ModerationConfig{Hostnames: []string{"db01.corp.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := llm.NewHistory(llm.HistoryConfig{Size: 1})
+	s := &Server{
+		Config:      &config.Config{UserPrompt: "%q", Response: config.ResponseConfig{Stream: true}},
+		EventLogger: eventLogger,
+		History:     history,
+		LLMConfig:   llm.Config{Provider: "openai"},
+		Logger:      l,
+		Model:       &chunkedModel{content: `{"headers": {}, "body": "connected to db01.corp.example.com"}`},
+		Moderator:   moderator,
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	s.handleRequest(w, r, "127.0.0.1:8080")
+
+	if w.Flushed || w.Body.String() != "connected to localhost" {
+		t.Errorf("Expected the moderated response not to be streamed, got %q", w.Body)
+	}
+	if recent := history.RecentFor(r); len(recent) != 1 || strings.Contains(recent[0], "corp.example.com") {
+		t.Errorf("Expected the moderated response in the history, got %v", recent)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Actions taken when the generation limiter rejects a request, because its
+// source is at its limit or the queue of the generations is full or timed
+// out.
+const (
+	overflowUnavailable = "unavailable"
+	overflowStatic      = "static"
+	overflowDrop        = "drop"
+)
+
+// CheckQueueOverflow checks the action taken when the generation limiter
+// rejects a request: unavailable, static or drop.
+func CheckQueueOverflow(action string) error {
+	switch action {
+	case "", overflowUnavailable, overflowStatic, overflowDrop:
+		return nil
+	}
+	return fmt.Errorf("unknown queue overflow action %q, expected unavailable, static or drop", action)
+}
+
+// handleOverflow answers the request rejected by the generation limiter with
+// the overflow action, and returns the response previously generated for the
+// request to serve instead, if any. With the unavailable action (the default),
+// a bare 503 is sent; with static, the response previously generated for the
+// request, even if expired, or else the static response of the error policy;
+// with drop, the connection is closed.
+func (s *Server) handleOverflow(w http.ResponseWriter, r *http.Request, port string) []byte {
+	switch s.QueueOverflow {
+	case overflowStatic:
+		if resp := s.staleResponse(r, port); resp != nil {
+			return resp
+		}
+		s.sendStaticResponse(w)
+	case overflowDrop:
+		// Aborts the handler and closes the connection without a response.
+		panic(http.ErrAbortHandler)
+	default:
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	}
+	return nil
+}
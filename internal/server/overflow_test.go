@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/limiter"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestQueueOverflow(t *testing.T) {
+	l := logrus.New()
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := cache.InitializeCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// The cached response has expired.
+	cached := httptest.NewRequest("GET", "/cached", nil)
+	if err := cache.StoreRequestResponse(db, cached, cache.GetCacheKey(cached, "8080"), []byte(`{"headers": {}, "body": "cached"}`), 0); err != nil {
+		t.Fatal(err)
+	}
+	generations := limiter.New(limiter.Config{MaxConcurrent: 1, QueueTimeout: time.Millisecond})
+	release, err := generations.Acquire(context.Background(), "198.51.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	model := &sequenceModel{results: []any{validResponse}}
+	s := &Server{
+		Cache:         db,
+		CacheDuration: 1,
+		Config: &config.Config{
+			UserPrompt:  "%q",
+			CacheTTLs:   []config.CacheTTLConfig{{Path: "/cached", TTL: time.Nanosecond}},
+			ErrorPolicy: config.ErrorPolicyConfig{StaticResponse: config.StaticResponseConfig{StatusCode: 502, Body: "bad gateway"}},
+		},
+		EventLogger: eventLogger,
+		LLMConfig:   llm.Config{Provider: "openai"},
+		Limiter:     generations,
+		Logger:      l,
+		Model:       model,
+	}
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleRequest(w, httptest.NewRequest("GET", target, nil), "127.0.0.1:8080")
+		return w
+	}
+
+	if w := serve("/cached"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a 503 by default, got %d %q", w.Code, w.Body)
+	}
+	s.QueueOverflow = overflowStatic
+	if w := serve("/cached"); w.Body.String() != "cached" {
+		t.Errorf("Expected the expired cached response, got %d %q", w.Code, w.Body)
+	}
+	if w := serve("/other"); w.Code != 502 || w.Body.String() != "bad gateway" {
+		t.Errorf("Expected the static response, got %d %q", w.Code, w.Body)
+	}
+	if model.calls != 0 {
+		t.Errorf("Expected no generation, got %d", model.calls)
+	}
+
+	s.QueueOverflow = overflowDrop
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("Expected the handler to be aborted, got %v", p)
+			}
+		}()
+		serve("/dropped")
+	}()
+
+	if err := CheckQueueOverflow("wait"); err == nil {
+		t.Error("Expected an error for the unknown action")
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Persona is the emulated server of a port: the configuration, model and
+// server profile used for its requests instead of the server's.
+type Persona struct {
+	Config    *config.Config
+	LLMConfig llm.Config
+	Model     llms.Model
+	Profile   *llm.ServerProfile
+}
+
+// VirtualHost is the persona of the requests for one of Hosts (see
+// config.VirtualHostConfig).
+type VirtualHost struct {
+	Hosts   []string
+	Persona *Persona
+}
+
+// matches reports whether the host name is one of the virtual host's.
+func (vh VirtualHost) matches(host string) bool {
+	for _, h := range vh.Hosts {
+		h = strings.ToLower(h)
+		if h == host || strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// virtualHost returns the persona of the virtual host of the request and its
+// name, or nil if it has none or it is disabled.
+func (s *Server) virtualHost(r *http.Request) (*Persona, string) {
+	if len(s.VirtualHosts) == 0 {
+		return nil, ""
+	}
+	names := []string{requestHost(r)}
+	if r.TLS != nil && r.TLS.ServerName != "" {
+		names = append(names, strings.ToLower(r.TLS.ServerName))
+	}
+	for _, name := range names {
+		for _, vh := range s.VirtualHosts {
+			if vh.matches(name) {
+				name := hostPersona(vh)
+				if !s.Runtime.PersonaEnabled(name) {
+					return nil, ""
+				}
+				return vh.Persona, name
+			}
+		}
+	}
+	return nil, ""
+}
+
+// requestHost returns the lower-cased host name of the Host header, without
+// the port.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// forHost returns the server handling the request, which uses the persona of
+// its virtual host, if any.
+func (s *Server) forHost(r *http.Request) *Server {
+	if p, name := s.virtualHost(r); p != nil {
+		return s.withPersona(p, name)
+	}
+	return s
+}
+
+// forPort returns the server handling the requests of the port, which shares
+// the components of s but uses the port's persona, if any and enabled.
+func (s *Server) forPort(port uint16) *Server {
+	if p, ok := s.Personas[port]; ok && s.Runtime.PersonaEnabled(portPersona(port)) {
+		return s.withPersona(p, portPersona(port))
+	}
+	return s
+}
+
+// withPersona returns a copy of s using the persona of the name.
+func (s *Server) withPersona(p *Persona, name string) *Server {
+	ps := *s
+	ps.persona = name
+	ps.Config = p.Config
+	ps.LLMConfig = p.LLMConfig
+	ps.Model = p.Model
+	ps.Profile = p.Profile
+	return &ps
+}
+
+// personaName returns the name of the server profile of the persona, or
+// "default" if it has none.
+func (s *Server) personaName() string {
+	if name := s.Config.ServerProfile.Name; name != "" {
+		return name
+	}
+	return "default"
+}
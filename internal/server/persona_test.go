@@ -0,0 +1,99 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestForPort(t *testing.T) {
+	model := &sequenceModel{results: []any{validResponse}}
+	personaModel := &sequenceModel{results: []any{validResponse}}
+	s := &Server{
+		Config:    &config.Config{SystemPrompt: "web server", UserPrompt: "%q"},
+		LLMConfig: llm.Config{Provider: "openai", Model: "gpt-4o"},
+		Logger:    logrus.New(),
+		Model:     model,
+		Personas: map[uint16]*Persona{
+			8443: {
+				Config:    &config.Config{SystemPrompt: "API gateway", UserPrompt: "%q"},
+				LLMConfig: llm.Config{Provider: "openai", Model: "gpt-4o-mini", Temperature: 0.2},
+				Model:     personaModel,
+				Profile:   &llm.ServerProfile{Headers: map[string]string{"Server": "Kong/3.4.0"}},
+			},
+		},
+	}
+
+	if got := s.forPort(8080); got != s {
+		t.Errorf("Expected the server itself for a port without persona")
+	}
+
+	ps := s.forPort(8443)
+	if ps.Config.SystemPrompt != "API gateway" || ps.LLMConfig.Model != "gpt-4o-mini" || ps.Profile.Headers["Server"] != "Kong/3.4.0" {
+		t.Errorf("Expected the persona settings, got %q, %q and %v", ps.Config.SystemPrompt, ps.LLMConfig.Model, ps.Profile.Headers)
+	}
+	if ps.Logger != s.Logger {
+		t.Errorf("Expected the persona to share the server components")
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	messages, err := llm.CreateMessageContent(r, ps.Config, ps.LLMConfig.Provider, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if system := messages[0].Parts[0].(llms.TextContent).Text; !strings.Contains(system, "API gateway") {
+		t.Errorf("Expected the persona system prompt, got %q", system)
+	}
+	if _, _, served, err := ps.generateWithPolicy(r, messages); err != nil || served.Model != "gpt-4o-mini" {
+		t.Fatalf("generateWithPolicy() = %v, %v", served.Model, err)
+	}
+	if personaModel.calls != 1 || model.calls != 0 {
+		t.Errorf("Expected the persona model to be called, got %d persona and %d server calls", personaModel.calls, model.calls)
+	}
+}
+
+func TestForHost(t *testing.T) {
+	shop := &Persona{Config: &config.Config{SystemPrompt: "shop"}}
+	api := &Persona{Config: &config.Config{SystemPrompt: "api"}}
+	s := &Server{
+		Config: &config.Config{SystemPrompt: "default"},
+		VirtualHosts: []VirtualHost{
+			{Hosts: []string{"shop.example.com"}, Persona: shop},
+			{Hosts: []string{"*.api.example.com", "API.example.net"}, Persona: api},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		host       string
+		serverName string
+		want       string
+	}{
+		{name: "host", host: "shop.example.com", want: "shop"},
+		{name: "hostWithPort", host: "SHOP.example.com:8443", want: "shop"},
+		{name: "wildcard", host: "v2.api.example.com", want: "api"},
+		{name: "wildcardExcludesDomain", host: "api.example.com", want: "default"},
+		{name: "caseInsensitive", host: "api.example.net", want: "api"},
+		{name: "serverName", host: "203.0.113.10", serverName: "shop.example.com", want: "shop"},
+		{name: "hostBeforeServerName", host: "shop.example.com", serverName: "v1.api.example.com", want: "shop"},
+		{name: "noMatch", host: "www.example.org", want: "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Host = tt.host
+			if tt.serverName != "" {
+				r.TLS = &tls.ConnectionState{ServerName: tt.serverName}
+			}
+			if got := s.forHost(r).Config.SystemPrompt; got != tt.want {
+				t.Errorf("Expected the %q persona, got %q", tt.want, got)
+			}
+		})
+	}
+}
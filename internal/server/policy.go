@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/tmc/langchaingo/llms"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Actions taken when a generation fails.
+const (
+	actionRetry    = "retry"
+	actionFallback = "fallback"
+	actionStatic   = "static"
+	actionFail     = "fail"
+)
+
+// defaultErrorActions are used for error kinds that have no configured action.
+var defaultErrorActions = map[string]string{
+	llm.ErrorKindNonJSONStream:  actionRetry,
+	llm.ErrorKindDeadline:       actionStatic,
+	llm.ErrorKindTimeout:        actionStatic,
+	llm.ErrorKindBudgetExceeded: actionStatic,
+}
+
+// errorAction returns the configured action for the generation error. Errors
+// without a configured action fall back to the next providers if a fallback
+// chain is configured. A provider whose circuit breaker is open is otherwise
+// answered with a static response rather than failing.
+func (s *Server) errorAction(err error) string {
+	kind := llm.ErrorKind(err)
+	actions := s.Config.ErrorPolicy.Actions
+	if a, ok := actions[kind]; ok {
+		return a
+	}
+	if a, ok := actions["default"]; ok {
+		return a
+	}
+	if a, ok := defaultErrorActions[kind]; ok {
+		return a
+	}
+	if len(s.Fallback) > 0 {
+		return actionFallback
+	}
+	if kind == llm.ErrorKindCircuitOpen {
+		return actionStatic
+	}
+	return actionFail
+}
+
+func (s *Server) maxRetries() int {
+	if n := s.Config.ErrorPolicy.MaxRetries; n > 0 {
+		return n
+	}
+	return 1
+}
+
+// retryDelay returns the backoff delay before the given retry. Rate-limited
+// requests use their own backoff, as they usually need to wait longer than
+// transient network or server errors.
+func (s *Server) retryDelay(err error, retry int) time.Duration {
+	b := s.Config.ErrorPolicy.Backoff
+	if errors.Is(err, llm.ErrRateLimited) && s.Config.ErrorPolicy.RateLimitBackoff.Initial > 0 {
+		b = s.Config.ErrorPolicy.RateLimitBackoff
+	}
+	if b.Initial <= 0 {
+		return 0
+	}
+
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(b.Initial) * math.Pow(multiplier, float64(retry))
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		delay *= 1 + b.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// generateWithPolicy generates a response, retrying or falling back to the
+// next providers according to the error policy. The next providers are also
+// tried once the retries are exhausted. It returns the response
+// along with the raw output of the model, and the configuration of the
+// provider that served the response, or of the last one tried.
+func (s *Server) generateWithPolicy(r *http.Request, messages []llms.MessageContent) (llm.JSONResponse, string, llm.Config, error) {
+	config := s.LLMConfig
+	resp, raw, err := s.generate(r.Context(), config, messages)
+
+	for retries := 0; err != nil; retries++ {
+		switch s.errorAction(err) {
+		case actionRetry:
+			if r.Context().Err() != nil {
+				return resp, raw, config, err
+			}
+			// The retries exhausted, the next providers are tried.
+			if retries >= s.maxRetries() {
+				if len(s.Fallback) == 0 {
+					return resp, raw, config, err
+				}
+				s.Logger.Infof("%s after %d retries, falling back to the next provider", err, retries)
+				return s.generateFallback(r)
+			}
+			// A stream aborted early is retried without streaming.
+			if errors.Is(err, llm.ErrNonJSONStream) {
+				config.Stream = false
+			}
+			delay := s.retryDelay(err, retries)
+			s.Logger.Infof("%s, retrying in %s (attempt %d)", err, delay, retries+1)
+			if sleep(r.Context(), delay) != nil {
+				return resp, raw, config, err
+			}
+			resp, raw, err = s.generate(r.Context(), config, messages)
+		case actionFallback:
+			if len(s.Fallback) == 0 {
+				return resp, raw, config, err
+			}
+			s.Logger.Infof("%s, falling back to the next provider", err)
+			return s.generateFallback(r)
+		default:
+			return resp, raw, config, err
+		}
+	}
+
+	return resp, raw, config, nil
+}
+
+// generateFallback generates a response with the fallback chain. The
+// generations of the chain are recorded as one, of the provider that served
+// it or was tried last.
+func (s *Server) generateFallback(r *http.Request) (llm.JSONResponse, string, llm.Config, error) {
+	ctx, span := tracer.Start(r.Context(), "galah.llm.fallback", trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
+	resp, raw, served, err := s.Fallback.GenerateJSONResponse(ctx, r.WithContext(ctx), s.Config, s.History)
+	s.Metrics.Generation(served, time.Since(start).Seconds(), err)
+	span.SetAttributes(
+		attribute.String("gen_ai.system", served.Provider),
+		attribute.String("gen_ai.request.model", served.Model),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, llm.ErrorKind(err))
+	}
+	span.End()
+	return resp, raw, served, err
+}
+
+// generate generates a response with the primary provider. If the latency
+// estimator is enabled, generation is skipped when the request deadline leaves
+// less time than the provider's typical latency.
+func (s *Server) generate(ctx context.Context, config llm.Config, messages []llms.MessageContent) (llm.JSONResponse, string, error) {
+	if s.Latency != nil {
+		if err := s.Latency.CheckDeadline(ctx, config); err != nil {
+			return llm.JSONResponse{}, "", err
+		}
+	}
+
+	ctx, span := tracer.Start(ctx, "galah.llm.generate",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("gen_ai.system", config.Provider),
+			attribute.String("gen_ai.request.model", config.Model),
+		))
+	defer span.End()
+	start := time.Now()
+	resp, raw, err := llm.GenerateJSONResponse(ctx, s.Model, config, messages)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, llm.ErrorKind(err))
+	}
+	if err == nil && s.Latency != nil {
+		s.Latency.Observe(config, time.Since(start))
+	}
+	s.Metrics.Generation(config, time.Since(start).Seconds(), err)
+	return resp, raw, err
+}
+
+// staleResponse returns the last cached response to the request regardless of
+// its age, or nil if there is none.
+func (s *Server) staleResponse(r *http.Request, port string) []byte {
+	if s.Cache == nil {
+		return nil
+	}
+	response, err := cache.CheckKey(s.Cache, s.cacheKey(r, port), -1)
+	if err != nil {
+		return nil
+	}
+	return response
+}
+
+// sendStaticResponse writes the configured static response, and returns it.
+func (s *Server) sendStaticResponse(w http.ResponseWriter) llm.JSONResponse {
+	static := s.Config.ErrorPolicy.StaticResponse
+	for key, value := range static.Headers {
+		w.Header().Set(key, value)
+	}
+
+	status := static.StatusCode
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	w.WriteHeader(status)
+
+	if _, err := w.Write([]byte(static.Body)); err != nil {
+		s.Logger.Errorf("error writing response: %s", err)
+	}
+	return llm.JSONResponse{StatusCode: status, Headers: static.Headers, Body: static.Body}
+}
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+	"github.com/tmc/langchaingo/llms"
+)
+
+const validResponse = `{"headers": {"Server": "nginx"}, "body": "ok"}`
+
+// sequenceModel returns the given contents or errors in order, one per call.
+type sequenceModel struct {
+	results []any
+	calls   int
+}
+
+func (m *sequenceModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+	result := m.results[m.calls%len(m.results)]
+	m.calls++
+	if err, ok := result.(error); ok {
+		return nil, err
+	}
+	return &llms.ContentResponse{
+		Choices: []*llms.ContentChoice{{Content: result.(string)}},
+	}, nil
+}
+
+func (m *sequenceModel) Call(ctx context.Context, prompt string, opts ...llms.CallOption) (string, error) {
+	return "", nil
+}
+
+func TestErrorPolicy(t *testing.T) {
+	policy := config.ErrorPolicyConfig{
+		Actions: map[string]string{
+			llm.ErrorKindRateLimited:    actionRetry,
+			llm.ErrorKindQuotaExhausted: actionStatic,
+			llm.ErrorKindRefusal:        actionFallback,
+			llm.ErrorKindInvalidJSON:    actionFail,
+		},
+		MaxRetries: 2,
+		StaticResponse: config.StaticResponseConfig{
+			StatusCode: http.StatusServiceUnavailable,
+			Headers:    map[string]string{"Server": "nginx"},
+			Body:       "<h1>503 Service Temporarily Unavailable</h1>",
+		},
+	}
+
+	tests := []struct {
+		name          string
+		results       []any
+		fallback      []any
+		wantAction    string
+		wantErr       bool
+		wantCalls     int
+		wantFallbacks int
+	}{
+		{
+			name:       "rateLimitRetriesThenSucceeds",
+			results:    []any{errors.New("429 Too Many Requests"), validResponse},
+			wantAction: actionRetry,
+			wantCalls:  2,
+		},
+		{
+			name:       "rateLimitRetriesAreBounded",
+			results:    []any{errors.New("rate limit reached for requests")},
+			wantAction: actionRetry,
+			wantErr:    true,
+			wantCalls:  3,
+		},
+		{
+			name:          "rateLimitRetriesThenFallsBack",
+			results:       []any{errors.New("rate limit reached for requests")},
+			fallback:      []any{validResponse},
+			wantAction:    actionRetry,
+			wantCalls:     3,
+			wantFallbacks: 1,
+		},
+		{
+			name:       "quotaExhaustedServesStatic",
+			results:    []any{errors.New("You exceeded your current quota, please check your plan and billing details")},
+			wantAction: actionStatic,
+			wantErr:    true,
+			wantCalls:  1,
+		},
+		{
+			name:          "refusalFallsBack",
+			results:       []any{"I'm sorry, but I can't help with that."},
+			fallback:      []any{validResponse},
+			wantAction:    actionFallback,
+			wantCalls:     1,
+			wantFallbacks: 1,
+		},
+		{
+			name:       "invalidJSONFails",
+			results:    []any{`{"headers": "nope"}`},
+			wantAction: actionFail,
+			wantErr:    true,
+			wantCalls:  1,
+		},
+		{
+			name:          "unconfiguredKindFallsBackWithChain",
+			results:       []any{errors.New("context deadline exceeded")},
+			fallback:      []any{validResponse},
+			wantAction:    actionFallback,
+			wantCalls:     1,
+			wantFallbacks: 1,
+		},
+		{
+			name:       "circuitOpenServesStatic",
+			results:    []any{llm.ErrCircuitOpen},
+			wantAction: actionStatic,
+			wantErr:    true,
+			wantCalls:  1,
+		},
+		{
+			name:       "unconfiguredKindFails",
+			results:    []any{errors.New("connection reset by peer")},
+			wantAction: actionFail,
+			wantErr:    true,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &sequenceModel{results: tt.results}
+			fallbackModel := &sequenceModel{results: tt.fallback}
+			s := &Server{
+				Config:    &config.Config{UserPrompt: "%q", ErrorPolicy: policy},
+				LLMConfig: llm.Config{Provider: "openai"},
+				Logger:    logrus.New(),
+				Model:     model,
+			}
+			if tt.fallback != nil {
+				s.Fallback = llm.Chain{{Config: llm.Config{Provider: "ollama"}, Model: fallbackModel}}
+			}
+
+			r := httptest.NewRequest("GET", "/", nil)
+			messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "test")}
+			_, raw, served, err := s.generateWithPolicy(r, messages)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("generateWithPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if action := s.errorAction(err); action != tt.wantAction {
+					t.Errorf("Expected action %q, got %q", tt.wantAction, action)
+				}
+			} else if raw != validResponse {
+				t.Errorf("Expected %q, got %q", validResponse, raw)
+			}
+			wantProvider := "openai"
+			if tt.wantFallbacks > 0 {
+				wantProvider = "ollama"
+			}
+			if served.Provider != wantProvider {
+				t.Errorf("Expected response served by %q, got %q", wantProvider, served.Provider)
+			}
+			if model.calls != tt.wantCalls {
+				t.Errorf("Expected %d calls, got %d", tt.wantCalls, model.calls)
+			}
+			if fallbackModel.calls != tt.wantFallbacks {
+				t.Errorf("Expected %d fallback calls, got %d", tt.wantFallbacks, fallbackModel.calls)
+			}
+		})
+	}
+}
+
+func TestSendStaticResponse(t *testing.T) {
+	s := &Server{
+		Config: &config.Config{ErrorPolicy: config.ErrorPolicyConfig{
+			StaticResponse: config.StaticResponseConfig{
+				Headers: map[string]string{"Server": "nginx"},
+				Body:    "unavailable",
+			},
+		}},
+		Logger: logrus.New(),
+	}
+
+	w := httptest.NewRecorder()
+	s.sendStaticResponse(w)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if got := w.Header().Get("Server"); got != "nginx" {
+		t.Errorf("Expected Server header %q, got %q", "nginx", got)
+	}
+	if got := w.Body.String(); got != "unavailable" {
+		t.Errorf("Expected body %q, got %q", "unavailable", got)
+	}
+}
+
+func TestDeadlineSkipsGeneration(t *testing.T) {
+	model := &sequenceModel{results: []any{validResponse}}
+	s := &Server{
+		Config:    &config.Config{UserPrompt: "%q"},
+		Latency:   llm.NewLatencyEstimator(),
+		LLMConfig: llm.Config{Provider: "openai", Model: "gpt-4o"},
+		Logger:    logrus.New(),
+		Model:     model,
+	}
+	s.Latency.Observe(s.LLMConfig, 5*time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "test")}
+
+	_, _, _, err := s.generateWithPolicy(r, messages)
+	if !errors.Is(err, llm.ErrInsufficientDeadline) {
+		t.Fatalf("Expected %v, got %v", llm.ErrInsufficientDeadline, err)
+	}
+	if model.calls != 0 {
+		t.Errorf("Expected generation to be skipped, got %d calls", model.calls)
+	}
+	if action := s.errorAction(err); action != actionStatic {
+		t.Errorf("Expected action %q, got %q", actionStatic, action)
+	}
+
+	// With enough time left, the response is generated and the latency observed.
+	r = httptest.NewRequest("GET", "/", nil)
+	if _, _, _, err := s.generateWithPolicy(r, messages); err != nil {
+		t.Fatalf("generateWithPolicy() error = %v", err)
+	}
+	if model.calls != 1 {
+		t.Errorf("Expected 1 call, got %d", model.calls)
+	}
+	if got := s.Latency.Estimate(s.LLMConfig); got >= 5*time.Second {
+		t.Errorf("Expected the latency estimate to decrease, got %s", got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	s := &Server{Config: &config.Config{ErrorPolicy: config.ErrorPolicyConfig{
+		Backoff:          config.BackoffConfig{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2},
+		RateLimitBackoff: config.BackoffConfig{Initial: 2 * time.Second, Max: 30 * time.Second, Multiplier: 3, Jitter: 0.5},
+	}}}
+
+	transport := llm.ErrTransport
+	for retry, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if got := s.retryDelay(transport, retry); got != want {
+			t.Errorf("retryDelay(transport, %d) = %s, want %s", retry, got, want)
+		}
+	}
+
+	for retry, base := range []time.Duration{2 * time.Second, 6 * time.Second, 18 * time.Second, 30 * time.Second} {
+		got := s.retryDelay(llm.ErrRateLimited, retry)
+		if got < base/2 || got > base*3/2 {
+			t.Errorf("retryDelay(rateLimited, %d) = %s, want %s ± 50%%", retry, got, base)
+		}
+	}
+
+	if got := (&Server{Config: &config.Config{}}).retryDelay(transport, 3); got != 0 {
+		t.Errorf("Expected no delay without backoff, got %s", got)
+	}
+}
+
+func TestRetryBackoffCanceled(t *testing.T) {
+	model := &sequenceModel{results: []any{errors.New("dial tcp: connection refused")}}
+	s := &Server{
+		Config: &config.Config{UserPrompt: "%q", ErrorPolicy: config.ErrorPolicyConfig{
+			Actions:    map[string]string{llm.ErrorKindTransport: actionRetry},
+			MaxRetries: 3,
+			Backoff:    config.BackoffConfig{Initial: time.Minute},
+		}},
+		LLMConfig: llm.Config{Provider: "openai"},
+		Logger:    logrus.New(),
+		Model:     model,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "test")}
+
+	start := time.Now()
+	_, _, _, err := s.generateWithPolicy(r, messages)
+	if !errors.Is(err, llm.ErrTransport) {
+		t.Errorf("Expected %v, got %v", llm.ErrTransport, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the backoff to stop when the request is canceled, took %s", elapsed)
+	}
+	if model.calls != 1 {
+		t.Errorf("Expected 1 call, got %d", model.calls)
+	}
+}
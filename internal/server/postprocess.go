@@ -0,0 +1,363 @@
+package server
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// PostProcessor is a stage of the pipeline transforming the responses before
+// they are served, cached and logged.
+type PostProcessor interface {
+	Process(s *Server, r *http.Request, resp *llm.JSONResponse)
+}
+
+// PostProcessorFunc is a function used as a PostProcessor.
+type PostProcessorFunc func(s *Server, r *http.Request, resp *llm.JSONResponse)
+
+// Process calls f(s, r, resp).
+func (f PostProcessorFunc) Process(s *Server, r *http.Request, resp *llm.JSONResponse) {
+	f(s, r, resp)
+}
+
+// PostProcessorFactory returns the post-processor of a stage configured with
+// the options.
+type PostProcessorFactory func(options map[string]string) (PostProcessor, error)
+
+// postProcessors are the factories of the post-processors by name.
+var postProcessors = map[string]PostProcessorFactory{
+	"trim_whitespace": func(map[string]string) (PostProcessor, error) { return PostProcessorFunc(processTrim), nil },
+	"honeytokens":     func(map[string]string) (PostProcessor, error) { return PostProcessorFunc(processHoneytokens), nil },
+	"js_challenge":    func(map[string]string) (PostProcessor, error) { return PostProcessorFunc(processChallenge), nil },
+	"json_format":     newJSONFormat,
+	"variation":       func(map[string]string) (PostProcessor, error) { return PostProcessorFunc(processVariation), nil },
+	"truncate":        func(map[string]string) (PostProcessor, error) { return PostProcessorFunc(processTruncate), nil },
+	"links":           newLinkRewriter,
+	"banner":          newBanner,
+	"compress":        newCompressor,
+}
+
+// RegisterPostProcessor makes the post-processor of the name available to the
+// pipelines of the configuration. It must be called before the pipelines are
+// created, e.g. from an init function, and panics if the name is taken.
+func RegisterPostProcessor(name string, factory PostProcessorFactory) {
+	if _, ok := postProcessors[name]; ok {
+		panic(fmt.Sprintf("post-processor %q already registered", name))
+	}
+	postProcessors[name] = factory
+}
+
+// defaultPostProcessors are the stages of the pipeline if none is configured,
+// the optional ones only run if enabled by the response configuration.
+var defaultPostProcessors = []string{"trim_whitespace", "honeytokens", "js_challenge", "json_format", "variation", "truncate"}
+
+// Pipeline is the ordered stages of the post-processing of the responses
+// (see config.PostProcessorConfig).
+type Pipeline struct {
+	stages []stage
+}
+
+// stage is a post-processor of the pipeline, run for the responses of the
+// personas, or all if there are none.
+type stage struct {
+	personas  []string
+	processor PostProcessor
+}
+
+// NewPipeline returns the pipeline of the configured post-processors, or the
+// default pipeline if there are none. The body size limit is enforced after
+// the stages unless the pipeline truncates the bodies itself.
+func NewPipeline(cfg config.ResponseConfig) (*Pipeline, error) {
+	if len(cfg.PostProcessors) == 0 {
+		return defaultPipeline(), nil
+	}
+	p := &Pipeline{}
+	truncates := false
+	for _, pc := range cfg.PostProcessors {
+		factory, ok := postProcessors[pc.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown post-processor %q", pc.Name)
+		}
+		processor, err := factory(pc.Options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid post-processor %q: %s", pc.Name, err)
+		}
+		p.stages = append(p.stages, stage{personas: pc.Personas, processor: processor})
+		truncates = truncates || pc.Name == "truncate"
+	}
+	if !truncates {
+		p.stages = append(p.stages, stage{processor: PostProcessorFunc(processTruncate)})
+	}
+	return p, nil
+}
+
+// builtinPipeline is the default pipeline of the servers without one.
+var builtinPipeline = defaultPipeline()
+
+// defaultPipeline returns the pipeline of the default post-processors.
+func defaultPipeline() *Pipeline {
+	p := &Pipeline{}
+	for _, name := range defaultPostProcessors {
+		processor, _ := postProcessors[name](nil)
+		switch name {
+		case "trim_whitespace":
+			processor = onlyIf(processor, func(cfg config.ResponseConfig) bool { return cfg.TrimWhitespace })
+		case "json_format":
+			processor = onlyIf(processor, func(cfg config.ResponseConfig) bool { return cfg.JSONFormat != "" })
+		}
+		p.stages = append(p.stages, stage{processor: processor})
+	}
+	return p
+}
+
+// onlyIf returns the post-processor run only if enabled by the response
+// configuration of the server.
+func onlyIf(p PostProcessor, enabled func(config.ResponseConfig) bool) PostProcessor {
+	return PostProcessorFunc(func(s *Server, r *http.Request, resp *llm.JSONResponse) {
+		if enabled(s.Config.Response) {
+			p.Process(s, r, resp)
+		}
+	})
+}
+
+// Process runs the stages of the pipeline enabled for the persona of the
+// server on the response, in order.
+func (p *Pipeline) Process(s *Server, r *http.Request, resp *llm.JSONResponse) {
+	persona := s.persona
+	if persona == "" {
+		persona = "default"
+	}
+	for _, st := range p.stages {
+		if len(st.personas) > 0 && !slices.Contains(st.personas, persona) {
+			continue
+		}
+		st.processor.Process(s, r, resp)
+	}
+}
+
+func processTrim(_ *Server, _ *http.Request, resp *llm.JSONResponse) {
+	llm.NormalizeWhitespace(resp)
+}
+
+func processHoneytokens(s *Server, r *http.Request, resp *llm.JSONResponse) {
+	s.injectHoneytokens(r, resp)
+}
+
+func processChallenge(s *Server, _ *http.Request, resp *llm.JSONResponse) {
+	s.injectChallenge(resp)
+}
+
+func processVariation(s *Server, _ *http.Request, resp *llm.JSONResponse) {
+	if s.Variation != nil {
+		s.Variation.Apply(resp)
+	}
+}
+
+// processTruncate truncates the body at the maximum body size. The bodies
+// compressed by the pipeline are truncated before their compression.
+func processTruncate(s *Server, r *http.Request, resp *llm.JSONResponse) {
+	if headerValue(resp.Headers, "Content-Encoding") != "" {
+		return
+	}
+	if llm.TruncateBody(resp, s.Config.Response.MaxBodySize) {
+		s.Logger.Infof("truncated the response body for %q to %d bytes", r.URL.String(), len(resp.Body))
+	}
+}
+
+// newJSONFormat returns the post-processor formatting the JSON bodies as the
+// format option, compact or pretty, or as json_format if not set.
+func newJSONFormat(options map[string]string) (PostProcessor, error) {
+	format := options["format"]
+	if format != "" && format != "compact" && format != "pretty" {
+		return nil, fmt.Errorf("invalid format %q", format)
+	}
+	return PostProcessorFunc(func(s *Server, _ *http.Request, resp *llm.JSONResponse) {
+		f := format
+		if f == "" {
+			f = s.Config.Response.JSONFormat
+		}
+		if f != "" {
+			llm.FormatJSONBody(resp, f)
+		}
+	}), nil
+}
+
+// defaultLinkHosts are the hosts of the links rewritten by default, the ones
+// the models use in made-up URLs.
+const defaultLinkHosts = "localhost,127.0.0.1,example.com,www.example.com"
+
+// newLinkRewriter returns the post-processor rewriting the absolute links of
+// the bodies and the Location header to the hosts option (comma-separated)
+// into links to the host of the request, so that the clients following them
+// stay on the honeypot.
+func newLinkRewriter(options map[string]string) (PostProcessor, error) {
+	hosts := options["hosts"]
+	if hosts == "" {
+		hosts = defaultLinkHosts
+	}
+	var quoted []string
+	for _, h := range strings.Split(hosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			quoted = append(quoted, regexp.QuoteMeta(h))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil, fmt.Errorf("no hosts")
+	}
+	re, err := regexp.Compile(`(?i)\bhttps?://(?:` + strings.Join(quoted, "|") + `)(?::\d+)?\b`)
+	if err != nil {
+		return nil, err
+	}
+	return PostProcessorFunc(func(_ *Server, r *http.Request, resp *llm.JSONResponse) {
+		if r.Host == "" {
+			return
+		}
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		origin := scheme + "://" + r.Host
+		if resp.Encoding == "" {
+			resp.Body = re.ReplaceAllLiteralString(resp.Body, origin)
+		}
+		for key, value := range resp.Headers {
+			if strings.EqualFold(key, "Location") {
+				resp.Headers[key] = re.ReplaceAllLiteralString(value, origin)
+			}
+		}
+	}), nil
+}
+
+// newBanner returns the post-processor inserting the text option into the
+// HTML bodies, at the top of their <body> element if the position option is
+// "top" or at its end otherwise.
+func newBanner(options map[string]string) (PostProcessor, error) {
+	text := options["text"]
+	if text == "" {
+		return nil, fmt.Errorf("no text")
+	}
+	top := false
+	switch options["position"] {
+	case "top":
+		top = true
+	case "", "bottom":
+	default:
+		return nil, fmt.Errorf("invalid position %q", options["position"])
+	}
+	return PostProcessorFunc(func(_ *Server, _ *http.Request, resp *llm.JSONResponse) {
+		if resp.Encoding != "" || !strings.Contains(strings.ToLower(headerValue(resp.Headers, "Content-Type")), "html") {
+			return
+		}
+		lower := strings.ToLower(resp.Body)
+		if top {
+			if i := strings.Index(lower, "<body"); i >= 0 {
+				if end := strings.IndexByte(lower[i:], '>'); end >= 0 {
+					i += end + 1
+					resp.Body = resp.Body[:i] + text + resp.Body[i:]
+					return
+				}
+			}
+			resp.Body = text + resp.Body
+			return
+		}
+		if i := strings.LastIndex(lower, "</body>"); i >= 0 {
+			resp.Body = resp.Body[:i] + text + resp.Body[i:]
+			return
+		}
+		resp.Body += text
+	}), nil
+}
+
+// defaultCompressMinSize is the size of the smallest bodies compressed by
+// default, in bytes.
+const defaultCompressMinSize = 1024
+
+// newCompressor returns the post-processor compressing the bodies of at least
+// min_size bytes with the encoding option (gzip, the default, or deflate),
+// for the clients accepting it. The bodies are truncated at the maximum body
+// size before they are compressed.
+func newCompressor(options map[string]string) (PostProcessor, error) {
+	encoding := options["encoding"]
+	if encoding == "" {
+		encoding = "gzip"
+	}
+	if encoding != "gzip" && encoding != "deflate" {
+		return nil, fmt.Errorf("invalid encoding %q", encoding)
+	}
+	minSize := defaultCompressMinSize
+	if v := options["min_size"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid min_size %q", v)
+		}
+		minSize = n
+	}
+	return PostProcessorFunc(func(s *Server, r *http.Request, resp *llm.JSONResponse) {
+		if !acceptsEncoding(r, encoding) || headerValue(resp.Headers, "Content-Encoding") != "" {
+			return
+		}
+		llm.TruncateBody(resp, s.Config.Response.MaxBodySize)
+		body, err := resp.DecodedBody()
+		if err != nil || len(body) < minSize {
+			return
+		}
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		if encoding == "gzip" {
+			w = gzip.NewWriter(&buf)
+		} else {
+			w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+		}
+		if _, err := w.Write(body); err != nil {
+			return
+		}
+		if err := w.Close(); err != nil {
+			return
+		}
+		resp.Body = base64.StdEncoding.EncodeToString(buf.Bytes())
+		resp.Encoding = llm.EncodingBase64
+		if resp.Headers == nil {
+			resp.Headers = map[string]string{}
+		}
+		resp.Headers["Content-Encoding"] = encoding
+		resp.Headers["Vary"] = "Accept-Encoding"
+	}), nil
+}
+
+// acceptsEncoding reports whether the Accept-Encoding of the request accepts
+// the encoding.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, value := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(value), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), encoding) && strings.TrimSpace(coding) != "*" {
+			continue
+		}
+		if q := strings.TrimSpace(params); q == "q=0" || q == "q=0.0" || q == "q=0.000" {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// headerValue returns the value of the header of the response, matched
+// case-insensitively.
+func headerValue(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPipeline(t *testing.T) {
+	if _, ok := postProcessors["test_marker"]; !ok {
+		RegisterPostProcessor("test_marker", func(options map[string]string) (PostProcessor, error) {
+			return PostProcessorFunc(func(_ *Server, _ *http.Request, resp *llm.JSONResponse) {
+				resp.Body += options["text"]
+			}), nil
+		})
+	}
+
+	var cfg config.ResponseConfig
+	err := yaml.Unmarshal([]byte(`
+post_processors:
+  - name: links
+  - name: banner
+    personas: ["port:8080"]
+    options: {text: "<!-- banner -->", position: top}
+  - name: test_marker
+    options: {text: "<!-- marker -->"}
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline, err := NewPipeline(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		persona string
+		want    string
+	}{
+		{name: "persona", persona: "port:8080", want: `<body><!-- banner --><a href="http://honeypot.local/login">Login</a></body><!-- marker -->`},
+		{name: "otherPersona", persona: "port:9090", want: `<body><a href="http://honeypot.local/login">Login</a></body><!-- marker -->`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{Config: &config.Config{Response: cfg}, Logger: logrus.New(), Pipeline: pipeline, persona: tt.persona}
+			r := httptest.NewRequest("GET", "http://honeypot.local/", nil)
+			resp := llm.JSONResponse{
+				Headers: map[string]string{"Content-Type": "text/html", "Location": "http://localhost:8080/login"},
+				Body:    `<body><a href="http://localhost/login">Login</a></body>`,
+			}
+			s.processBody(r, &resp)
+			if resp.Body != tt.want {
+				t.Errorf("Expected the body %q, got %q", tt.want, resp.Body)
+			}
+			if got := resp.Headers["Location"]; got != "http://honeypot.local/login" {
+				t.Errorf("Expected the Location rewritten, got %q", got)
+			}
+		})
+	}
+
+	for _, pc := range []config.PostProcessorConfig{{Name: "unknown"}, {Name: "banner"}, {Name: "compress", Options: map[string]string{"encoding": "br"}}} {
+		if _, err := NewPipeline(config.ResponseConfig{PostProcessors: []config.PostProcessorConfig{pc}}); err == nil {
+			t.Errorf("Expected an error for the post-processor %+v", pc)
+		}
+	}
+}
+
+func TestDefaultPipeline(t *testing.T) {
+	s := &Server{Config: &config.Config{Response: config.ResponseConfig{TrimWhitespace: true, JSONFormat: "compact", MaxBodySize: 10}}, Logger: logrus.New()}
+	resp := llm.JSONResponse{Headers: map[string]string{"Content-Type": "application/json"}, Body: "{\n  \"status\": \"ok\"\n}"}
+	s.processBody(httptest.NewRequest("GET", "/", nil), &resp)
+	if resp.Body != `{"status":` {
+		t.Errorf("Expected the compact and truncated body, got %q", resp.Body)
+	}
+}
+
+func TestCompressor(t *testing.T) {
+	p, err := newCompressor(map[string]string{"min_size": "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Config: &config.Config{Response: config.ResponseConfig{MaxBodySize: 20}}}
+	body := strings.Repeat("compressible ", 10)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		body           string
+		wantCompressed bool
+	}{
+		{name: "accepted", acceptEncoding: "gzip, deflate, br", body: body, wantCompressed: true},
+		{name: "wildcard", acceptEncoding: "*", body: body, wantCompressed: true},
+		{name: "refused", acceptEncoding: "gzip;q=0, deflate", body: body},
+		{name: "notAccepted", body: body},
+		{name: "small", acceptEncoding: "gzip", body: "short"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			resp := llm.JSONResponse{Body: tt.body}
+			p.Process(s, r, &resp)
+			if compressed := resp.Headers["Content-Encoding"] == "gzip"; compressed != tt.wantCompressed {
+				t.Fatalf("Expected compressed %v, got the headers %v", tt.wantCompressed, resp.Headers)
+			}
+			if !tt.wantCompressed {
+				return
+			}
+			data, err := resp.DecodedBody()
+			if err != nil {
+				t.Fatal(err)
+			}
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			plain, _ := io.ReadAll(zr)
+			// The body is truncated before its compression.
+			if string(plain) != tt.body[:20] {
+				t.Errorf("Expected the truncated body compressed, got %q", plain)
+			}
+		})
+	}
+}
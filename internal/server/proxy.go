@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// defaultProxyHeaders are the headers of the client IP set by the trusted
+// proxies, in the order they are read.
+var defaultProxyHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+// TrustedProxies are the reverse proxies trusted to report the IP address of
+// their clients (see config.TrustedProxiesConfig).
+type TrustedProxies struct {
+	prefixes []netip.Prefix
+	headers  []string
+}
+
+// NewTrustedProxies returns the trusted proxies of the configuration, or nil
+// if there are none.
+func NewTrustedProxies(cfg config.TrustedProxiesConfig) (*TrustedProxies, error) {
+	if len(cfg.CIDRs) == 0 {
+		return nil, nil
+	}
+	t := &TrustedProxies{headers: cfg.Headers}
+	if len(t.headers) == 0 {
+		t.headers = defaultProxyHeaders
+	}
+	for _, cidr := range cfg.CIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, errAddr := netip.ParseAddr(cidr)
+			if errAddr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %s", cidr, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		t.prefixes = append(t.prefixes, prefix.Masked())
+	}
+	return t, nil
+}
+
+// trusted reports whether the address is of a trusted proxy.
+func (t *TrustedProxies) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range t.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP address of the client of the request sent by a
+// trusted proxy, read from the first of the headers set, and false if the
+// request isn't from a trusted proxy or has no valid client IP. The
+// addresses of X-Forwarded-For are read from the last one, skipping the
+// trusted proxies the request went through.
+func (t *TrustedProxies) clientIP(r *http.Request) (netip.Addr, bool) {
+	remote, err := netip.ParseAddr(llm.SourceIP(r))
+	if err != nil || !t.trusted(remote) {
+		return netip.Addr{}, false
+	}
+	for _, name := range t.headers {
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		var hops []string
+		for _, value := range values {
+			hops = append(hops, strings.Split(value, ",")...)
+		}
+		var client netip.Addr
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, ok := parseHop(hops[i])
+			if !ok {
+				break
+			}
+			client = addr
+			if !t.trusted(addr) {
+				break
+			}
+		}
+		return client, client.IsValid()
+	}
+	return netip.Addr{}, false
+}
+
+// parseHop parses an address of a proxy header: an IP address, with a port
+// or not.
+func parseHop(hop string) (netip.Addr, bool) {
+	hop = strings.TrimSpace(hop)
+	if addr, err := netip.ParseAddr(hop); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+// withClientIP returns the request with the remote address of its client, if
+// it is sent by a trusted proxy, the source port being unknown. The address
+// of the proxy is recorded in the event of the request.
+func (s *Server) withClientIP(r *http.Request) *http.Request {
+	if s.TrustedProxies == nil {
+		return r
+	}
+	client, ok := s.TrustedProxies.clientIP(r)
+	if !ok {
+		return r
+	}
+	proxy := llm.SourceIP(r)
+	r = r.WithContext(logger.WithProxyIP(r.Context(), proxy))
+	r.RemoteAddr = net.JoinHostPort(client.String(), "0")
+	return r
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+func TestWithClientIP(t *testing.T) {
+	proxies, err := NewTrustedProxies(config.TrustedProxiesConfig{CIDRs: []string{"10.0.0.0/8", "2001:db8::1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{TrustedProxies: proxies}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+		wantProxy  string
+	}{
+		{
+			name:       "forwardedFor",
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"192.0.2.1"}},
+			want:       "192.0.2.1:0",
+			wantProxy:  "10.0.0.1",
+		},
+		{
+			name:       "proxyChain",
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.9, 192.0.2.1", "10.0.0.2"}},
+			want:       "192.0.2.1:0",
+			wantProxy:  "10.0.0.1",
+		},
+		{
+			name:       "realIP",
+			remoteAddr: "[2001:db8::1]:4321",
+			headers:    map[string][]string{"X-Real-Ip": {"2001:db8::beef"}},
+			want:       "[2001:db8::beef]:0",
+			wantProxy:  "2001:db8::1",
+		},
+		{
+			name:       "hopWithPort",
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"192.0.2.1:5555"}},
+			want:       "192.0.2.1:0",
+			wantProxy:  "10.0.0.1",
+		},
+		{
+			name:       "untrustedSource",
+			remoteAddr: "203.0.113.5:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"192.0.2.1"}},
+			want:       "203.0.113.5:4321",
+		},
+		{
+			name:       "invalidHeader",
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"unknown"}},
+			want:       "10.0.0.1:4321",
+		},
+		{
+			name:       "noHeader",
+			remoteAddr: "10.0.0.1:4321",
+			want:       "10.0.0.1:4321",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				r.Header[k] = v
+			}
+			r = s.withClientIP(r)
+			if r.RemoteAddr != tt.want {
+				t.Errorf("Expected the remote address %s, got %s", tt.want, r.RemoteAddr)
+			}
+			// The source of the events, history and limits is the client.
+			if want, _, _ := net.SplitHostPort(tt.want); llm.SourceIP(r) != want {
+				t.Errorf("Expected the source %s, got %s", want, llm.SourceIP(r))
+			}
+			if got := logger.ProxyIPFrom(r.Context()); got != tt.wantProxy {
+				t.Errorf("Expected the proxy %q, got %q", tt.wantProxy, got)
+			}
+		})
+	}
+
+	if _, err := NewTrustedProxies(config.TrustedProxiesConfig{CIDRs: []string{"10.0.0.0/33"}}); err == nil {
+		t.Error("Expected an error for an invalid CIDR")
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/limiter"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// Actions taken when a source exceeds its request rate (see
+// config.RateLimitConfig).
+const (
+	rateActionStatic = "static"
+	rateActionDelay  = "delay"
+	rateActionDrop   = "drop"
+)
+
+// rateLimitedTag tags the events of the requests of the sources over their
+// rate.
+const rateLimitedTag = "rate_limited"
+
+// defaultRateMaxDelay is the default maximum delay of the requests over the
+// rate with the delay action.
+const defaultRateMaxDelay = 5 * time.Second
+
+// rateLogWindow is the window in which a source over its rate is logged once.
+const rateLogWindow = time.Minute
+
+// NewRateLimiter returns the limiter of the request rate of the sources of
+// the configuration, or nil if disabled.
+func NewRateLimiter(rc config.RateLimitConfig) (*limiter.RateLimiter, error) {
+	if rc.RequestsPerMinute <= 0 {
+		return nil, nil
+	}
+	switch rc.Action {
+	case "", rateActionStatic, rateActionDelay, rateActionDrop:
+	default:
+		return nil, fmt.Errorf("unknown rate limit action %q", rc.Action)
+	}
+	return limiter.NewRateLimiter(limiter.RateConfig{
+		PerMinute:  rc.RequestsPerMinute,
+		Burst:      rc.Burst,
+		MaxSources: rc.MaxSources,
+	}), nil
+}
+
+// allowRate reports whether the source of the request is within its rate,
+// waiting for it with the delay action.
+func (s *Server) allowRate(r *http.Request) error {
+	rc := s.Config.RateLimit
+	if rc.Action == rateActionDelay {
+		maxDelay := rc.MaxDelay
+		if maxDelay <= 0 {
+			maxDelay = defaultRateMaxDelay
+		}
+		return s.RateLimiter.Wait(r.Context(), llm.SourceIP(r), maxDelay)
+	}
+	if !s.RateLimiter.Allow(llm.SourceIP(r)) {
+		return limiter.ErrRateLimit
+	}
+	return nil
+}
+
+// limitRate applies the rate limit of the source to the request, before its
+// response is looked up in the caches. If the source is over its rate, it
+// returns true and the request tagged, with the response cached for the
+// request, even if expired, or nil if the static response was sent and
+// logged. With the drop action, the connection is closed.
+func (s *Server) limitRate(w http.ResponseWriter, r *http.Request, port string) (*http.Request, []byte, bool) {
+	if s.RateLimiter == nil {
+		return r, nil, false
+	}
+	rc := s.Config.RateLimit
+	err := s.allowRate(r)
+	if err == nil {
+		return r, nil, false
+	}
+
+	if s.RateLimiter.Report(llm.SourceIP(r), rateLogWindow) {
+		s.Logger.Infof("request from %s rate limited: %s (logged once per %s)", r.RemoteAddr, err, rateLogWindow)
+	}
+	if rc.Action == rateActionDrop {
+		// Aborts the handler and closes the connection without a response.
+		panic(http.ErrAbortHandler)
+	}
+	r = r.WithContext(logger.WithTags(r.Context(), rateLimitedTag))
+	if resp := s.staleResponse(r, port); resp != nil {
+		return r, resp, true
+	}
+	s.EventLogger.LogEvent(r, s.sendStaticResponse(w), port)
+	return r, nil, true
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRateLimit(t *testing.T) {
+	l := logrus.New()
+	var logs bytes.Buffer
+	l.SetOutput(&logs)
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := cache.InitializeCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// The cached response has expired.
+	cached := httptest.NewRequest("GET", "/cached", nil)
+	if err := cache.StoreRequestResponse(db, cached, cache.GetCacheKey(cached, "8080"), []byte(`{"headers": {}, "body": "cached"}`), 0); err != nil {
+		t.Fatal(err)
+	}
+	rateLimiter, err := NewRateLimiter(config.RateLimitConfig{RequestsPerMinute: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := &sequenceModel{results: []any{validResponse}}
+	s := &Server{
+		Cache:         db,
+		CacheDuration: 1,
+		Config: &config.Config{
+			UserPrompt:  "%q",
+			CacheTTLs:   []config.CacheTTLConfig{{Path: "/cached", TTL: time.Nanosecond}},
+			ErrorPolicy: config.ErrorPolicyConfig{StaticResponse: config.StaticResponseConfig{StatusCode: 429, Body: "slow down"}},
+		},
+		EventLogger: eventLogger,
+		LLMConfig:   llm.Config{Provider: "openai"},
+		Logger:      l,
+		Model:       model,
+		RateLimiter: rateLimiter,
+	}
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleRequest(w, httptest.NewRequest("GET", target, nil), "127.0.0.1:8080")
+		return w
+	}
+
+	if w := serve("/first"); w.Code != http.StatusOK || model.calls != 1 {
+		t.Fatalf("Expected the first request to be generated, got %d", w.Code)
+	}
+	if w := serve("/cached"); w.Body.String() != "cached" {
+		t.Errorf("Expected the expired cached response over the rate, got %d %q", w.Code, w.Body)
+	}
+	if w := serve("/other"); w.Code != 429 || w.Body.String() != "slow down" {
+		t.Errorf("Expected the static response over the rate, got %d %q", w.Code, w.Body)
+	}
+	if model.calls != 1 {
+		t.Errorf("Expected 1 generation, got %d", model.calls)
+	}
+
+	s.Config.RateLimit.Action = rateActionDrop
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("Expected the handler to be aborted, got %v", p)
+			}
+		}()
+		serve("/dropped")
+	}()
+
+	if n := strings.Count(logs.String(), "rate limited"); n != 1 {
+		t.Errorf("Expected the source over its rate to be logged once, got %d times", n)
+	}
+
+	if _, err := NewRateLimiter(config.RateLimitConfig{RequestsPerMinute: 1, Action: "block"}); err == nil {
+		t.Error("Expected an error for an unknown action")
+	}
+	if rl, err := NewRateLimiter(config.RateLimitConfig{}); rl != nil || err != nil {
+		t.Errorf("Expected no limiter when disabled, got %v, %v", rl, err)
+	}
+}
+
+func TestRateLimitCachedResponses(t *testing.T) {
+	l := logrus.New()
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := cache.InitializeCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cached := httptest.NewRequest("GET", "/cached", nil)
+	if err := cache.StoreRequestResponse(db, cached, cache.GetCacheKey(cached, "8080"), []byte(`{"headers": {}, "body": "cached"}`), 0); err != nil {
+		t.Fatal(err)
+	}
+	rateLimiter, err := NewRateLimiter(config.RateLimitConfig{RequestsPerMinute: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := &sequenceModel{results: []any{validResponse}}
+	s := &Server{
+		Cache:         db,
+		CacheDuration: 1,
+		Config: &config.Config{
+			UserPrompt:  "%q",
+			ErrorPolicy: config.ErrorPolicyConfig{StaticResponse: config.StaticResponseConfig{StatusCode: 429, Body: "slow down"}},
+		},
+		EventLogger: eventLogger,
+		LLMConfig:   llm.Config{Provider: "openai"},
+		Logger:      l,
+		Model:       model,
+		RateLimiter: rateLimiter,
+	}
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleRequest(w, httptest.NewRequest("GET", target, nil), "127.0.0.1:8080")
+		return w
+	}
+
+	// The cached responses count in the rate of the source.
+	if w := serve("/cached"); w.Code != http.StatusOK || w.Body.String() != "cached" {
+		t.Fatalf("Expected the cached response, got %d %q", w.Code, w.Body)
+	}
+	if w := serve("/other"); w.Code != 429 || w.Body.String() != "slow down" {
+		t.Errorf("Expected the static response over the rate, got %d %q", w.Code, w.Body)
+	}
+	if w := serve("/cached"); w.Code != http.StatusOK || w.Body.String() != "cached" {
+		t.Errorf("Expected the cached response over the rate, got %d %q", w.Code, w.Body)
+	}
+	if model.calls != 0 {
+		t.Errorf("Expected no generation, got %d", model.calls)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package server
+
+// ListenForReloadSignals is a no-op on platforms without SIGHUP.
+func (s *Server) ListenForReloadSignals(reload func() error) {}
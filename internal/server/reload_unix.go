@@ -0,0 +1,24 @@
+//go:build unix
+
+package server
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ListenForReloadSignals calls reload on SIGHUP, to apply the changes of the
+// configuration without restarting the listeners.
+func (s *Server) ListenForReloadSignals(reload func() error) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	go func() {
+		for range sig {
+			if err := reload(); err != nil {
+				s.Logger.Errorf("error reloading the configuration: %s", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Replay is the dry run of a request: the messages of its prompt, the raw
+// generated response and the configuration of the provider that served it,
+// and the response as it would be served. Outputs are the outputs of the
+// model, before their cleaning and repair, of all the generations of the
+// response (e.g. the corrections), and ContentMismatch is the mismatch of the
+// generated body with its Content-Type (see llm.CheckContentType), if any.
+type Replay struct {
+	Messages        []llms.MessageContent
+	Raw             string
+	Outputs         []string
+	Served          llm.Config
+	ContentMismatch error
+	Response        *llm.JSONResponse
+}
+
+// Replay builds the prompt of the request, as if received on the port, and
+// generates its response with the error policy, the post-processing, the
+// persona, the model route and the server profile of the honeypot. The
+// response isn't cached, sent or logged. On error, the replay holds the steps
+// completed.
+func (s *Server) Replay(r *http.Request, port uint16) (*Replay, error) {
+	ps, r := s.forRequest(port, r).withPromptVariant(r)
+	r = ps.tagEmulations(r)
+	ps, r = ps.routeModel(r)
+
+	messages, err := llm.CreateMessageContent(r, ps.Config, ps.LLMConfig.Provider, ps.History)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the prompt: %s", err)
+	}
+	replay := &Replay{Messages: messages, Served: ps.LLMConfig}
+	r = r.WithContext(llm.WithOutputs(r.Context()))
+	defer func() { replay.Outputs = llm.OutputsFrom(r.Context()) }()
+	resp, raw, served, err := ps.generateWithPolicy(r, messages)
+	replay.Raw, replay.Served = raw, served
+	if err != nil {
+		return replay, err
+	}
+	resp, served = ps.regenerateOversized(r, messages, resp, served)
+	replay.ContentMismatch = llm.CheckContentType(resp)
+	resp, served = ps.checkContentType(r, messages, resp, served)
+	resp, served = ps.moderate(r, messages, resp, served)
+	replay.Served = served
+
+	ps.applyProfile(r, &resp)
+	ps.sanitizeHeaders(&resp)
+	ps.processBody(r, &resp)
+	replay.Response = &resp
+	return replay, nil
+}
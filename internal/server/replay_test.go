@@ -0,0 +1,83 @@
+package server
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestReplay(t *testing.T) {
+	model := &sequenceModel{results: []any{validResponse}}
+	s := &Server{
+		Config:    &config.Config{SystemPrompt: "web server", UserPrompt: "%q"},
+		LLMConfig: llm.Config{Provider: "openai", Model: "gpt-4o"},
+		Logger:    logrus.New(),
+		Model:     model,
+		Profile:   &llm.ServerProfile{Headers: map[string]string{"Server": "Apache/2.4.41"}},
+		Personas: map[uint16]*Persona{
+			8443: {
+				Config:    &config.Config{SystemPrompt: "API gateway", UserPrompt: "%q"},
+				LLMConfig: llm.Config{Provider: "openai", Model: "gpt-4o-mini"},
+				Model:     model,
+			},
+		},
+	}
+
+	replay, err := s.Replay(httptest.NewRequest("GET", "/admin", nil), 8080)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if system := replay.Messages[0].Parts[0].(llms.TextContent).Text; !strings.Contains(system, "web server") {
+		t.Errorf("Expected the system prompt of the server, got %q", system)
+	}
+	if replay.Raw != validResponse || replay.Served.Model != "gpt-4o" {
+		t.Errorf("Expected the raw response of gpt-4o, got %q of %q", replay.Raw, replay.Served.Model)
+	}
+	if got := replay.Response.Headers["Server"]; got != "Apache/2.4.41" {
+		t.Errorf("Expected the headers of the server profile applied, got %q", got)
+	}
+
+	replay, err = s.Replay(httptest.NewRequest("GET", "/admin", nil), 8443)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if system := replay.Messages[0].Parts[0].(llms.TextContent).Text; !strings.Contains(system, "API gateway") || replay.Served.Model != "gpt-4o-mini" {
+		t.Errorf("Expected the persona of the port, got %q and %q", system, replay.Served.Model)
+	}
+
+	model.results = []any{errors.New("unavailable")}
+	replay, err = s.Replay(httptest.NewRequest("GET", "/admin", nil), 8080)
+	if err == nil || replay == nil || len(replay.Messages) == 0 || replay.Response != nil {
+		t.Errorf("Expected the prompt of the failed generation, got %+v and %v", replay, err)
+	}
+}
+
+func TestReplayOutputs(t *testing.T) {
+	output := `{'headers': {'Content-Type': 'application/json'}, 'body': 'not json',}`
+	s := &Server{
+		Config:    &config.Config{SystemPrompt: "web server", UserPrompt: "%q"},
+		LLMConfig: llm.Config{Provider: "openai", Model: "gpt-4o"},
+		Logger:    logrus.New(),
+		Model:     &sequenceModel{results: []any{output}},
+	}
+
+	replay, err := s.Replay(httptest.NewRequest("GET", "/api", nil), 8080)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replay.Outputs) != 1 || replay.Outputs[0] != output {
+		t.Errorf("Expected the output of the model before its repair, got %q", replay.Outputs)
+	}
+	if replay.Raw == output {
+		t.Errorf("Expected the repaired raw response, got %q", replay.Raw)
+	}
+	if replay.ContentMismatch == nil {
+		t.Error("Expected the mismatch of the body with its Content-Type")
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/internal/session"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ModelRoute is a routing rule of the requests to a model (see
+// config.ModelRouteConfig), and the model of the primary provider it routes
+// to.
+type ModelRoute struct {
+	Config config.ModelRouteConfig
+	Model  llms.Model
+}
+
+// routeModel returns the server generating the response to the request with
+// the model of the first matching route, and the request carrying the name
+// of the route. The requests matching no route, and all the requests while
+// the model is switched at runtime, keep the server's model.
+func (s *Server) routeModel(r *http.Request) (*Server, *http.Request) {
+	if len(s.Routes) == 0 || s.Runtime.Model() != nil {
+		return s, r
+	}
+	for _, route := range s.Routes {
+		if !s.matchRoute(route.Config, r) {
+			continue
+		}
+		rs := *s
+		rs.LLMConfig.Model = route.Config.Model
+		if route.Config.Temperature != nil {
+			rs.LLMConfig.Temperature = *route.Config.Temperature
+		}
+		rs.Model = route.Model
+		return &rs, r.WithContext(logger.WithModelRoute(r.Context(), route.Config.Name))
+	}
+	return s, r
+}
+
+// matchRoute reports whether the request matches all the set conditions of
+// the route.
+func (s *Server) matchRoute(rc config.ModelRouteConfig, r *http.Request) bool {
+	if len(rc.Methods) > 0 && !slices.ContainsFunc(rc.Methods, func(m string) bool { return strings.EqualFold(m, r.Method) }) {
+		return false
+	}
+	if len(rc.Paths) > 0 && !slices.ContainsFunc(rc.Paths, func(p string) bool { return cache.MatchPath(p, r.URL.Path) }) {
+		return false
+	}
+	if rc.Body != nil && hasBody(r) != *rc.Body {
+		return false
+	}
+	if rc.Session != nil || rc.Flagged != nil {
+		info, _ := s.clientSession(r)
+		continued := info.Requests > 0
+		if st := llm.SessionStateFrom(r.Context()); st != nil && !st.New && st.Requests > 0 {
+			continued = true
+		}
+		if rc.Session != nil && continued != *rc.Session {
+			return false
+		}
+		if rc.Flagged != nil && info.Flagged != *rc.Flagged {
+			return false
+		}
+	}
+	if len(rc.Tags) > 0 {
+		tags := logger.TagsFrom(r.Context())
+		if !slices.ContainsFunc(rc.Tags, func(tag string) bool { return slices.Contains(tags, tag) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// clientSession returns the current session of the source and client of the
+// request, which doesn't include the request yet, and false if it has none
+// or the sessions aren't tracked.
+func (s *Server) clientSession(r *http.Request) (session.Info, bool) {
+	if s.Sessions == nil {
+		return session.Info{}, false
+	}
+	return s.Sessions.Lookup(llm.SourceIP(r), logger.ClientFingerprint(r), time.Now())
+}
+
+// hasBody reports whether the request has a body.
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/internal/session"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+func TestRouteModel(t *testing.T) {
+	yes := true
+	temperature := 0.2
+	tracker := session.NewTracker(session.Config{Threshold: 100})
+	s := &Server{
+		LLMConfig: llm.Config{Provider: "openai", Model: "default", Temperature: 1},
+		Sessions:  tracker,
+		Routes: []ModelRoute{
+			{Config: config.ModelRouteConfig{Name: "interactive", Model: "strong", Temperature: &temperature, Body: &yes}},
+			{Config: config.ModelRouteConfig{Name: "injection", Model: "strong", Tags: []string{"prompt_injection"}}},
+			{Config: config.ModelRouteConfig{Name: "continued", Model: "strong", Session: &yes}},
+			{Config: config.ModelRouteConfig{Name: "probe", Model: "cheap", Methods: []string{"get", "HEAD"}, Paths: []string{"/wp-*"}}},
+		},
+	}
+
+	post := httptest.NewRequest("POST", "/login", strings.NewReader("user=admin"))
+	injected := httptest.NewRequest("GET", "/", nil)
+	injected = injected.WithContext(logger.WithTags(injected.Context(), "prompt_injection"))
+	probe := httptest.NewRequest("GET", "/wp-login.php", nil)
+	cookie := httptest.NewRequest("GET", "/wp-admin/", nil)
+	cookie = cookie.WithContext(llm.WithSessionState(cookie.Context(), &llm.SessionState{Cookie: "PHPSESSID", Requests: 2}))
+	other := httptest.NewRequest("PUT", "/wp-login.php", nil)
+
+	tests := []struct {
+		name  string
+		r     *http.Request
+		model string
+		route string
+	}{
+		{"body", post, "strong", "interactive"},
+		{"tag", injected, "strong", "injection"},
+		{"probe", probe, "cheap", "probe"},
+		{"session cookie", cookie, "strong", "continued"},
+		{"no route", other, "default", ""},
+	}
+	for _, tt := range tests {
+		rs, rr := s.routeModel(tt.r)
+		if rs.LLMConfig.Model != tt.model || rs.LLMConfig.Provider != "openai" {
+			t.Errorf("%s: expected the model %s of the primary provider, got %+v", tt.name, tt.model, rs.LLMConfig)
+		}
+		if got := logger.ModelRouteFrom(rr.Context()); got != tt.route {
+			t.Errorf("%s: expected the route %q, got %q", tt.name, tt.route, got)
+		}
+	}
+	if rs, _ := s.routeModel(post); rs.LLMConfig.Temperature != 0.2 {
+		t.Errorf("Expected the temperature of the route, got %v", rs.LLMConfig.Temperature)
+	}
+	if s.LLMConfig.Model != "default" || s.LLMConfig.Temperature != 1 {
+		t.Errorf("Expected the server's configuration unchanged, got %+v", s.LLMConfig)
+	}
+
+	// The later requests of a tracked session continue it.
+	continued := httptest.NewRequest("GET", "/", nil)
+	tracker.Record(session.Request{Source: llm.SourceIP(continued), Fingerprint: logger.ClientFingerprint(continued), Time: time.Now()})
+	if _, rr := s.routeModel(continued); logger.ModelRouteFrom(rr.Context()) != "continued" {
+		t.Errorf("Expected the request of the tracked session routed to continued, got %q", logger.ModelRouteFrom(rr.Context()))
+	}
+}
+
+func TestRouteModelFlagged(t *testing.T) {
+	yes, no := true, false
+	tracker := session.NewTracker(session.Config{Threshold: 1})
+	s := &Server{
+		LLMConfig: llm.Config{Model: "default"},
+		Sessions:  tracker,
+		Routes: []ModelRoute{
+			{Config: config.ModelRouteConfig{Name: "flagged", Model: "strong", Flagged: &yes}},
+			{Config: config.ModelRouteConfig{Name: "unflagged", Model: "cheap", Flagged: &no}},
+		},
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	if rs, _ := s.routeModel(r); rs.LLMConfig.Model != "cheap" {
+		t.Errorf("Expected the request without a session routed to cheap, got %s", rs.LLMConfig.Model)
+	}
+	for _, method := range []string{"GET", "POST"} {
+		tracker.Record(session.Request{Source: llm.SourceIP(r), Fingerprint: logger.ClientFingerprint(r), Time: time.Now(), Method: method})
+	}
+	if rs, _ := s.routeModel(r); rs.LLMConfig.Model != "strong" {
+		t.Errorf("Expected the request of the flagged session routed to strong, got %s", rs.LLMConfig.Model)
+	}
+
+	s.Runtime = NewRuntime()
+	s.Runtime.SetModel(&llm.Provider{Config: llm.Config{Model: "switched"}})
+	if rs, _ := s.routeModel(r); rs != s {
+		t.Error("Expected no routing while the model is switched at runtime")
+	}
+}
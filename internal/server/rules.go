@@ -0,0 +1,145 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// staticRuleTag is the event tag of the responses served by a static rule.
+const staticRuleTag = "static_rule"
+
+// StaticRules are the compiled static rules, evaluated in order.
+type StaticRules []*staticRule
+
+type staticRule struct {
+	config.StaticRuleConfig
+	re      *regexp.Regexp
+	headers map[string]*template.Template
+	body    *template.Template
+}
+
+// NewStaticRules compiles the static rules.
+func NewStaticRules(rules []config.StaticRuleConfig) (StaticRules, error) {
+	compiled := make(StaticRules, 0, len(rules))
+	for i, rc := range rules {
+		name := rc.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if len(rc.Paths) == 0 && rc.Regex == "" {
+			return nil, fmt.Errorf("static rule %s has no paths or regex", name)
+		}
+
+		rule := &staticRule{StaticRuleConfig: rc, headers: map[string]*template.Template{}}
+		rule.Name = name
+		var err error
+		if rc.Regex != "" {
+			if rule.re, err = regexp.Compile(rc.Regex); err != nil {
+				return nil, fmt.Errorf("invalid regex of static rule %s: %s", name, err)
+			}
+		}
+		for key, value := range rc.Headers {
+			if strings.Contains(value, "{{") {
+				if rule.headers[key], err = llm.ParseTemplate(key, value); err != nil {
+					return nil, fmt.Errorf("invalid %s header of static rule %s: %s", key, name, err)
+				}
+			}
+		}
+		if strings.Contains(rc.Body, "{{") {
+			if rule.body, err = llm.ParseTemplate("body", rc.Body); err != nil {
+				return nil, fmt.Errorf("invalid body of static rule %s: %s", name, err)
+			}
+		}
+		compiled = append(compiled, rule)
+	}
+	return compiled, nil
+}
+
+// match returns the first rule matching the request, or nil.
+func (rs StaticRules) match(r *http.Request) *staticRule {
+	for _, rule := range rs {
+		if rule.matches(r) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (rule *staticRule) matches(r *http.Request) bool {
+	if len(rule.Methods) > 0 {
+		found := false
+		for _, m := range rule.Methods {
+			found = found || strings.EqualFold(m, r.Method)
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, p := range rule.Paths {
+		if cache.MatchPath(p, r.URL.Path) {
+			return true
+		}
+	}
+	return rule.re != nil && rule.re.MatchString(r.URL.RequestURI())
+}
+
+// response renders the response of the rule for the request.
+func (rule *staticRule) response(r *http.Request, data llm.PromptData) (llm.JSONResponse, error) {
+	resp := llm.JSONResponse{
+		StatusCode: rule.StatusCode,
+		Headers:    map[string]string{},
+		Body:       rule.Body,
+	}
+	for key, value := range rule.StaticRuleConfig.Headers {
+		if tmpl, ok := rule.headers[key]; ok {
+			var b strings.Builder
+			if err := tmpl.Execute(&b, data); err != nil {
+				return resp, err
+			}
+			value = b.String()
+		}
+		resp.Headers[key] = value
+	}
+	if rule.body != nil {
+		var b strings.Builder
+		if err := rule.body.Execute(&b, data); err != nil {
+			return resp, err
+		}
+		resp.Body = b.String()
+	}
+	return resp, nil
+}
+
+// handleStaticRule answers the request with the response of the first
+// matching static rule, if any. It returns true if the request has been
+// answered.
+func (s *Server) handleStaticRule(w http.ResponseWriter, r *http.Request, port string) bool {
+	rule := s.Rules.match(r)
+	if rule == nil {
+		return false
+	}
+
+	resp, err := rule.response(r, llm.NewPromptData(r, s.Profile, s.Config.ServerProfile.Name))
+	if err != nil {
+		s.Logger.Errorf("error rendering the response of static rule %s: %s", rule.Name, err)
+		return false
+	}
+	s.applyProfile(r, &resp)
+
+	r = r.WithContext(logger.WithTags(r.Context(), staticRuleTag))
+	if s.History != nil {
+		s.History.RecordResponse(r, resp)
+	}
+	s.sendResponse(w, resp)
+	s.Logger.Infof("sent the response of static rule %s to %s", rule.Name, r.RemoteAddr)
+	s.EventLogger.LogEvent(r, resp, port)
+	return true
+}
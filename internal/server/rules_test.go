@@ -0,0 +1,135 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHandleStaticRule(t *testing.T) {
+	rules, err := NewStaticRules([]config.StaticRuleConfig{
+		{
+			Name:    "wordpress",
+			Methods: []string{"GET"},
+			Paths:   []string{"/wp-login.php"},
+			Headers: map[string]string{"Content-Type": "text/html"},
+			Body:    "<title>Log In &lsaquo; {{ .Host }}</title>",
+		},
+		{
+			Name:       "dotenv",
+			Regex:      `/\.env$`,
+			StatusCode: http.StatusForbidden,
+			Body:       "Forbidden",
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewStaticRules() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		wantAnswered bool
+		wantStatus   int
+		wantBody     string
+	}{
+		{
+			name:         "pathWithTemplate",
+			method:       "GET",
+			target:       "/wp-login.php?redirect_to=%2Fwp-admin",
+			wantAnswered: true,
+			wantStatus:   http.StatusOK,
+			wantBody:     "<title>Log In &lsaquo; blog.example.com</title>",
+		},
+		{
+			name:   "otherMethod",
+			method: "POST",
+			target: "/wp-login.php",
+		},
+		{
+			name:         "regex",
+			method:       "GET",
+			target:       "/app/.env",
+			wantAnswered: true,
+			wantStatus:   http.StatusForbidden,
+			wantBody:     "Forbidden",
+		},
+		{
+			name:   "noMatch",
+			method: "GET",
+			target: "/index.php",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := logrus.New()
+			eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &Server{
+				Config:      &config.Config{},
+				EventLogger: eventLogger,
+				Logger:      l,
+				Profile:     &llm.ServerProfile{Headers: map[string]string{"Server": "Apache/2.4.41 (Ubuntu)"}},
+				Rules:       rules,
+			}
+
+			r := httptest.NewRequest(tt.method, "http://blog.example.com"+tt.target, nil)
+			w := httptest.NewRecorder()
+			answered := s.handleStaticRule(w, r, "8080")
+
+			if answered != tt.wantAnswered {
+				t.Fatalf("Expected answered %v, got %v", tt.wantAnswered, answered)
+			}
+			if !answered {
+				return
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("Expected body %q, got %q", tt.wantBody, got)
+			}
+			if got := w.Header().Get("Server"); got != "Apache/2.4.41 (Ubuntu)" {
+				t.Errorf("Expected Server header %q, got %q", "Apache/2.4.41 (Ubuntu)", got)
+			}
+		})
+	}
+}
+
+func TestNewStaticRules(t *testing.T) {
+	ruleConfigs, err := config.LoadStaticRules("../../config/rules.yaml")
+	if err != nil {
+		t.Fatalf("LoadStaticRules() error = %v", err)
+	}
+	rules, err := NewStaticRules(ruleConfigs)
+	if err != nil {
+		t.Fatalf("NewStaticRules() error = %v", err)
+	}
+	for _, target := range []string{"/wp-login.php", "/.env", "/laravel/.env.local", "/boaform/admin/formLogin"} {
+		if rules.match(httptest.NewRequest("GET", target, nil)) == nil {
+			t.Errorf("Expected a rule matching %s", target)
+		}
+	}
+
+	for _, invalid := range []config.StaticRuleConfig{
+		{Name: "noMatcher", Body: "ok"},
+		{Name: "badRegex", Regex: "("},
+		{Name: "badTemplate", Paths: []string{"/"}, Body: "{{ .Host"},
+	} {
+		if _, err := NewStaticRules([]config.StaticRuleConfig{invalid}); err == nil || !strings.Contains(err.Error(), invalid.Name) {
+			t.Errorf("Expected an error for rule %s, got %v", invalid.Name, err)
+		}
+	}
+}
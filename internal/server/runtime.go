@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// Runtime is the state changed while the honeypot runs, with the admin API or
+// by reloading the configuration, shared by the servers of the ports and
+// personas. The nil Runtime changes nothing.
+type Runtime struct {
+	mu       sync.RWMutex
+	disabled map[string]bool
+	model    *llm.Provider
+	settings *Settings
+}
+
+// Settings are the settings of the requests reloaded from the configuration,
+// replacing the server's.
+type Settings struct {
+	Config            *config.Config
+	Profile           *llm.ServerProfile
+	Rules             StaticRules
+	StaticArtifacts   *StaticArtifacts
+	Emulations        []*llm.Emulation
+	Personas          map[uint16]*Persona
+	VirtualHosts      []VirtualHost
+	PayloadSignatures []llm.PayloadSignature
+	Routes            []ModelRoute
+}
+
+// NewRuntime returns the runtime state of the configured settings.
+func NewRuntime() *Runtime {
+	return &Runtime{disabled: make(map[string]bool)}
+}
+
+// SetPersonaEnabled enables or disables the persona. The requests of a
+// disabled persona are handled with the server's configuration.
+func (rt *Runtime) SetPersonaEnabled(name string, enabled bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if enabled {
+		delete(rt.disabled, name)
+	} else {
+		rt.disabled[name] = true
+	}
+}
+
+// PersonaEnabled reports whether the persona is enabled.
+func (rt *Runtime) PersonaEnabled(name string) bool {
+	if rt == nil {
+		return true
+	}
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	return !rt.disabled[name]
+}
+
+// SetModel switches the model of the requests to the provider, or back to the
+// configured models if nil.
+func (rt *Runtime) SetModel(p *llm.Provider) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.model = p
+}
+
+// Model returns the provider the model was switched to, or nil.
+func (rt *Runtime) Model() *llm.Provider {
+	if rt == nil {
+		return nil
+	}
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	return rt.model
+}
+
+// SetSettings replaces the settings of the requests.
+func (rt *Runtime) SetSettings(st *Settings) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.settings = st
+}
+
+// Settings returns the reloaded settings, or nil.
+func (rt *Runtime) Settings() *Settings {
+	if rt == nil {
+		return nil
+	}
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	return rt.settings
+}
+
+// portPersona returns the name of the persona of the port.
+func portPersona(port uint16) string {
+	return fmt.Sprintf("port:%d", port)
+}
+
+// hostPersona returns the name of the persona of the virtual host, after its
+// first host name.
+func hostPersona(vh VirtualHost) string {
+	return "host:" + strings.ToLower(vh.Hosts[0])
+}
+
+// current returns the server using the reloaded settings, if any.
+func (s *Server) current() *Server {
+	st := s.Runtime.Settings()
+	if st == nil {
+		return s
+	}
+	cs := *s
+	cs.Config = st.Config
+	cs.Profile = st.Profile
+	cs.Rules = st.Rules
+	cs.StaticArtifacts = st.StaticArtifacts
+	cs.Emulations = st.Emulations
+	cs.Personas = st.Personas
+	cs.VirtualHosts = st.VirtualHosts
+	cs.PayloadSignatures = st.PayloadSignatures
+	cs.Routes = st.Routes
+	return &cs
+}
+
+// forRequest returns the server handling the request received on the port,
+// with the current settings, the persona of its port or virtual host, if
+// enabled, and the model switched to at runtime, if any.
+func (s *Server) forRequest(port uint16, r *http.Request) *Server {
+	ps := s.current().forPort(port).forHost(r)
+	if p := s.Runtime.Model(); p != nil {
+		if ps == s {
+			cp := *s
+			ps = &cp
+		}
+		ps.LLMConfig = p.Config
+		ps.Model = p.Model
+	}
+	return ps
+}
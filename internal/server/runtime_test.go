@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+func TestForRequestSettings(t *testing.T) {
+	s := &Server{
+		Config:  &config.Config{SystemPrompt: "web server"},
+		Logger:  logrus.New(),
+		Runtime: NewRuntime(),
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	if got := s.forRequest(8080, r); got != s {
+		t.Errorf("Expected the server itself without reloaded settings")
+	}
+
+	s.Runtime.SetSettings(&Settings{
+		Config: &config.Config{SystemPrompt: "reloaded"},
+		Personas: map[uint16]*Persona{
+			8443: {Config: &config.Config{SystemPrompt: "reloaded persona"}},
+		},
+	})
+	if got := s.forRequest(8080, r).Config.SystemPrompt; got != "reloaded" {
+		t.Errorf("Expected the reloaded configuration, got %q", got)
+	}
+	if got := s.forRequest(8443, r).Config.SystemPrompt; got != "reloaded persona" {
+		t.Errorf("Expected the reloaded persona, got %q", got)
+	}
+	if s.Config.SystemPrompt != "web server" {
+		t.Errorf("Expected the server's configuration to be kept, got %q", s.Config.SystemPrompt)
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/internal/scanner"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// scannerResponseTag tags the events of the responses served to the scanners
+// instead of generating them.
+const scannerResponseTag = "scanner_response"
+
+// Strategies of the responses to the scanners.
+const (
+	ScannerStrategyGenerate = "generate"
+	ScannerStrategyCached   = "cached"
+	ScannerStrategyStatic   = "static"
+)
+
+// ScannerDetection identifies the scanners sending the requests, and answers
+// them with the strategy of the configuration (see
+// config.ScannerDetectionConfig).
+type ScannerDetection struct {
+	cfg      config.ScannerDetectionConfig
+	detector *scanner.Detector
+}
+
+// NewScannerDetection returns the scanner detection of the configuration, or
+// nil if disabled.
+func NewScannerDetection(cfg config.ScannerDetectionConfig) (*ScannerDetection, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	switch cfg.Strategy {
+	case "":
+		cfg.Strategy = ScannerStrategyGenerate
+	case ScannerStrategyGenerate, ScannerStrategyCached, ScannerStrategyStatic:
+	default:
+		return nil, fmt.Errorf("invalid scanner response strategy %q (generate, cached or static)", cfg.Strategy)
+	}
+	if cfg.StatusCode == 0 {
+		cfg.StatusCode = http.StatusNotFound
+	}
+
+	var signatures []scanner.Signature
+	for _, sc := range cfg.Signatures {
+		sig := scanner.Signature{Tool: sc.Tool}
+		var err error
+		if sc.Header != "" {
+			if sig.Header, err = regexp.Compile(sc.Header); err != nil {
+				return nil, fmt.Errorf("invalid header signature of scanner %s: %s", sc.Tool, err)
+			}
+		}
+		if sc.Path != "" {
+			if sig.Path, err = regexp.Compile(sc.Path); err != nil {
+				return nil, fmt.Errorf("invalid path signature of scanner %s: %s", sc.Tool, err)
+			}
+		}
+		signatures = append(signatures, sig)
+	}
+	detector, err := scanner.New(scanner.Config{
+		Signatures: signatures,
+		Burst:      cfg.Burst,
+		Window:     cfg.Window,
+		Memory:     cfg.Memory,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ScannerDetection{cfg: cfg, detector: detector}, nil
+}
+
+// detectScanner returns the request carrying the scanner sending it, tagged
+// with its name and, if known, its version.
+func (s *Server) detectScanner(r *http.Request) *http.Request {
+	if s.Scanners == nil {
+		return r
+	}
+	tool, ok := s.Scanners.detector.Detect(r, llm.SourceIP(r), time.Now())
+	if !ok {
+		return r
+	}
+	var tags []string
+	existing := logger.TagsFrom(r.Context())
+	for _, tag := range scannerTags(tool) {
+		if !slices.Contains(existing, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	s.Logger.Infof("request for %q from %s identified as %s (%s)", r.URL.String(), r.RemoteAddr, tool.Name, tool.Evidence)
+	ctx := logger.WithTags(r.Context(), tags...)
+	return r.WithContext(logger.WithScanner(ctx, tool))
+}
+
+// scannerTags returns the tags of the tool: scanner:<name> and, if its
+// version is known, scanner:<name>/<version>.
+func scannerTags(tool scanner.Tool) []string {
+	tags := []string{llm.ScannerTagPrefix + tool.Name}
+	if tool.Version != "" {
+		tags = append(tags, llm.ScannerTagPrefix+tool.Name+"/"+tool.Version)
+	}
+	return tags
+}
+
+// handleScanner answers the request of a scanner with the static response,
+// unless the strategy generates the responses to its tool, or serves the
+// cached response of the request. It returns true if the request has been
+// answered.
+func (s *Server) handleScanner(w http.ResponseWriter, r *http.Request, port string) bool {
+	if s.Scanners == nil || s.Scanners.cfg.Strategy == ScannerStrategyGenerate {
+		return false
+	}
+	cfg := s.Scanners.cfg
+	tool, ok := logger.ScannerFrom(r.Context())
+	if !ok || (len(cfg.Tools) > 0 && !slices.Contains(cfg.Tools, tool.Name)) {
+		return false
+	}
+	if cfg.Strategy == ScannerStrategyCached {
+		if resp, _ := cache.CheckKeyTTL(s.Cache, s.cacheKey(r, port), s.cacheTTL(r)); resp != nil {
+			return false
+		}
+	}
+
+	resp := llm.JSONResponse{StatusCode: cfg.StatusCode, Headers: map[string]string{}, Body: cfg.Body}
+	for key, value := range cfg.Headers {
+		resp.Headers[key] = value
+	}
+	s.applyProfile(r, &resp)
+	r = r.WithContext(logger.WithTags(r.Context(), scannerResponseTag))
+	s.sendResponse(w, resp)
+	s.Logger.Infof("sent the %s response to %s, identified as %s", cfg.Strategy, r.RemoteAddr, tool.Name)
+	s.EventLogger.LogEvent(r, resp, port)
+	return true
+}
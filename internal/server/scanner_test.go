@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHandleScanner(t *testing.T) {
+	tests := []struct {
+		name         string
+		strategy     string
+		tools        []string
+		userAgent    string
+		cached       bool
+		wantAnswered bool
+	}{
+		{name: "generate", strategy: "", userAgent: "sqlmap/1.7.2#stable"},
+		{name: "static", strategy: ScannerStrategyStatic, userAgent: "sqlmap/1.7.2#stable", wantAnswered: true},
+		{name: "otherTool", strategy: ScannerStrategyStatic, tools: []string{"zgrab"}, userAgent: "sqlmap/1.7.2#stable"},
+		{name: "notScanner", strategy: ScannerStrategyStatic, userAgent: "Mozilla/5.0"},
+		{name: "cachedMiss", strategy: ScannerStrategyCached, userAgent: "Mozilla/5.0 zgrab/0.x", wantAnswered: true},
+		{name: "cachedHit", strategy: ScannerStrategyCached, userAgent: "Mozilla/5.0 zgrab/0.x", cached: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanners, err := NewScannerDetection(config.ScannerDetectionConfig{
+				Enabled:  true,
+				Strategy: tt.strategy,
+				Tools:    tt.tools,
+				Body:     "Not Found",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := logrus.New()
+			eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := cache.InitializeCache(filepath.Join(t.TempDir(), "cache.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			s := &Server{
+				Config:        &config.Config{},
+				Cache:         c,
+				CacheDuration: 1,
+				EventLogger:   eventLogger,
+				Logger:        l,
+				Profile:       &llm.ServerProfile{},
+				Scanners:      scanners,
+			}
+
+			r := httptest.NewRequest("GET", "/index.php", nil)
+			r.Header.Set("User-Agent", tt.userAgent)
+			if tt.cached {
+				if err := cache.StoreResponse(c, s.cacheKey(r, "8080"), []byte(`{"body":"cached"}`)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r = s.detectScanner(r)
+			w := httptest.NewRecorder()
+			if answered := s.handleScanner(w, r, "8080"); answered != tt.wantAnswered {
+				t.Fatalf("Expected answered %v, got %v", tt.wantAnswered, answered)
+			}
+			if tt.wantAnswered && (w.Code != http.StatusNotFound || w.Body.String() != "Not Found") {
+				t.Errorf("Expected the static response, got %d %q", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDetectScanner(t *testing.T) {
+	scanners, err := NewScannerDetection(config.ScannerDetectionConfig{Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Logger: logrus.New(), Scanners: scanners}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", "sqlmap/1.7.2#stable (https://sqlmap.org)")
+	r = r.WithContext(logger.WithTags(r.Context(), "scanner:sqlmap"))
+	r = s.detectScanner(r)
+	if tags := logger.TagsFrom(r.Context()); !slices.Equal(tags, []string{"scanner:sqlmap", "scanner:sqlmap/1.7.2"}) {
+		t.Errorf("Expected the tool and version tags once, got %v", tags)
+	}
+	if tool, ok := logger.ScannerFrom(r.Context()); !ok || tool.Name != "sqlmap" || tool.Version != "1.7.2" {
+		t.Errorf("Expected the scanner in the context, got %+v", tool)
+	}
+
+	if _, err := NewScannerDetection(config.ScannerDetectionConfig{Enabled: true, Strategy: "cheap"}); err == nil {
+		t.Error("Expected an error for an invalid strategy")
+	}
+	if _, err := NewScannerDetection(config.ScannerDetectionConfig{Enabled: true, Signatures: []config.ScannerSignatureConfig{{Tool: "x", Path: "("}}}); err == nil {
+		t.Error("Expected an error for an invalid signature")
+	}
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/0x4d31/galah/internal/cache"
+)
+
+// checkSemanticCache returns the cached response of a request similar to r,
+// if any, and the embedding of r to index it once its response is generated.
+// Only requests without any cached response are looked up, so the response
+// generated for a request always takes precedence over a similar one.
+func (s *Server) checkSemanticCache(r *http.Request, port string) ([]byte, []float32) {
+	key, embedding, err := s.Semantic.Lookup(r.Context(), r, port)
+	if err != nil {
+		if !errors.Is(err, cache.ErrCacheMiss) {
+			s.Logger.Errorf("error checking the semantic cache for %q: %s", r.URL.String(), err)
+		}
+		return nil, embedding
+	}
+
+	response, err := cache.CheckKeyTTL(s.Cache, key, s.cacheTTL(r))
+	if err != nil || response == nil {
+		return nil, embedding
+	}
+	s.Logger.Infof("serving the cached response of the similar request %q to %q", key, r.URL.String())
+	return response, nil
+}
@@ -2,7 +2,7 @@ package server
 
 import (
 	"context"
-	"database/sql"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,19 +12,45 @@ import (
 	"os/signal"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/0x4d31/galah/internal/access"
 	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/capture"
+	"github.com/0x4d31/galah/internal/cluster"
 	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/eventstore"
+	"github.com/0x4d31/galah/internal/fingerprint"
+	"github.com/0x4d31/galah/internal/honeytoken"
+	"github.com/0x4d31/galah/internal/limiter"
 	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/internal/metrics"
+	"github.com/0x4d31/galah/internal/proxyproto"
+	"github.com/0x4d31/galah/internal/session"
+	"github.com/0x4d31/galah/internal/stats"
+	"github.com/0x4d31/galah/internal/tracing"
 	"github.com/0x4d31/galah/pkg/llm"
 	"github.com/google/gopacket/pcap"
 	"github.com/sirupsen/logrus"
 	"github.com/tmc/langchaingo/llms"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"golang.org/x/sync/errgroup"
 )
 
+// tracer traces the requests, through the caches, the prompt building and
+// the LLM generations to the response.
+var tracer = otel.Tracer("github.com/0x4d31/galah/internal/server")
+
+// defaultShutdownTimeout is the default time given to the in-flight requests
+// to complete on shutdown.
+const defaultShutdownTimeout = 30 * time.Second
+
 var ignoreHeaders = map[string]bool{
 	// Standard headers to ignore
 	"content-length": true,
@@ -42,34 +68,88 @@ var ignoreHeaders = map[string]bool{
 
 // Server holds the configuration and components for running HTTP/TLS servers.
 type Server struct {
-	Cache         *sql.DB
-	CacheDuration int
-	Interface     string
-	Config        *config.Config
-	EventLogger   *logger.Logger
-	LLMConfig     llm.Config
-	Logger        *logrus.Logger
-	Model         llms.Model
-	Servers       map[uint16]*http.Server
+	Cache             cache.Store
+	CacheDuration     int
+	Consistency       *cache.SourceResponses
+	Interface         string
+	Config            *config.Config
+	ConfigFile        string
+	Cluster           *cluster.Cluster
+	CookieSessions    *CookieSessions
+	EventLogger       *logger.Logger
+	EventStore        *eventstore.Store
+	Fallback          llm.Chain
+	HeaderPins        *HeaderPins
+	History           *llm.History
+	Latency           *llm.LatencyEstimator
+	LLMConfig         llm.Config
+	Limiter           *limiter.Limiter
+	Logger            *logrus.Logger
+	Metrics           *metrics.Metrics
+	Model             llms.Model
+	NewModel          func(context.Context, llm.Config) (llms.Model, error)
+	Personas          map[uint16]*Persona
+	Profile           *llm.ServerProfile
+	RateLimiter       *limiter.RateLimiter
+	Recent            *logger.RecentEvents
+	Routes            []ModelRoute
+	Rules             StaticRules
+	Runtime           *Runtime
+	Emulations        []*llm.Emulation
+	Semantic          *cache.SemanticIndex
+	Servers           map[string]*http.Server
+	ShutdownTimeout   time.Duration
+	Signatures        *stats.Signatures
+	StaticArtifacts   *StaticArtifacts
+	AccessLists       *access.Lists
+	QueueOverflow     string
+	Budget            *llm.Budget
+	Pipeline          *Pipeline
+	Moderator         *llm.Moderator
+	Tarpit            *Tarpit
+	Scanners          *ScannerDetection
+	TrustedProxies    *TrustedProxies
+	Sessions          *session.Tracker
+	PayloadSignatures []llm.PayloadSignature
+	Uploads           *Uploads
+	Capture           *capture.Capturer
+	Honeytokens       *honeytoken.Honeytokens
+	Tracing           *tracing.Provider
+	Usage             *llm.UsageTracker
+	Variation         *llm.Variation
+	VirtualHosts      []VirtualHost
+	WebSockets        *WebSocketSessions
+
+	// persona is the name of the persona of the server, empty for the
+	// server's own configuration.
+	persona string
 }
 
 // StartServers starts all servers defined in the configuration.
 func (s *Server) StartServers() error {
+	tlsConfigs, err := s.newTLSConfigs()
+	if err != nil {
+		return err
+	}
+
 	var g errgroup.Group
 	mu := sync.Mutex{}
 
 	for _, pc := range s.Config.Ports {
 		pc := pc // Capture the loop variable
 		g.Go(func() error {
-			return s.startServer(pc, &mu)
+			return s.startServer(pc, tlsConfigs[pc.TLSProfile], &mu)
 		})
 	}
 
 	return g.Wait()
 }
 
-func (s *Server) startServer(pc config.PortConfig, mu *sync.Mutex) error {
+func (s *Server) startServer(pc config.PortConfig, tlsConfig *tls.Config, mu *sync.Mutex) error {
 	server := s.SetupServer(pc)
+	if tlsConfig != nil {
+		server.TLSConfig = tlsConfig.Clone()
+	}
 
 	var err error
 	switch pc.Protocol {
@@ -86,33 +166,63 @@ func (s *Server) startServer(pc config.PortConfig, mu *sync.Mutex) error {
 	}
 
 	mu.Lock()
-	s.Servers[pc.Port] = server
+	s.Servers[server.Addr] = server
 	mu.Unlock()
 
 	return nil
 }
 
+// writeTimeout is the write timeout of the honeypot servers, from the end of
+// the reading of the request. The slow responses (streamed, delayed or
+// tarpitted) push the deadline of their writes further.
+const writeTimeout = 10 * time.Second
+
 // SetupServer configures the server with the provided settings.
 func (s *Server) SetupServer(pc config.PortConfig) *http.Server {
-	var ip string
-	var err error
-
-	if s.Interface != "" {
-		ip, err = getInterfaceIP(s.Interface)
-		if err != nil {
-			s.Logger.Errorln(err)
+	serverAddr := net.JoinHostPort(s.listenHost(pc), fmt.Sprintf("%d", pc.Port))
+
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = s.withClientIP(r)
+		r = fingerprint.WithJA4H(r)
+		// The requests start new traces, the trace context sent by the
+		// clients isn't trusted.
+		ctx, span := tracer.Start(r.Context(), "galah.request",
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("client.address", llm.SourceIP(r)),
+				attribute.Int("server.port", int(pc.Port)),
+			))
+		defer span.End()
+		r = r.WithContext(ctx)
+		rs, r := s.forRequest(pc.Port, r).withPromptVariant(r)
+		if timeout := rs.Config.Deadline.RequestTimeout; s.Latency != nil && timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
 		}
+		rs.handleRequest(w, r, serverAddr)
+	})
+	server := &http.Server{
+		Addr:         serverAddr,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: writeTimeout,
+		ConnContext:  fingerprint.WithConn,
 	}
-	serverAddr := net.JoinHostPort(ip, fmt.Sprintf("%d", pc.Port))
 
-	return &http.Server{
-		Addr: serverAddr,
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			s.handleRequest(w, r, serverAddr)
-		}),
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+	switch {
+	case pc.Protocol == "HTTP" && pc.HTTP2 != nil && *pc.HTTP2:
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	case pc.Protocol == "TLS" && pc.HTTP2 != nil && !*pc.HTTP2:
+		// A non-nil map disables HTTP/2.
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
 	}
+	if pc.Protocol == "TLS" && pc.HTTP3 {
+		handler = withAltSvc(handler, pc.Port)
+	}
+	server.Handler = handler
+	return server
 }
 
 // StartTLSServer starts the configured TLS server.
@@ -122,53 +232,244 @@ func (s *Server) StartTLSServer(server *http.Server, pc config.PortConfig) error
 	}
 
 	tlsConfig, ok := s.Config.Profiles[pc.TLSProfile]
-	if !ok || tlsConfig.Certificate == "" || tlsConfig.Key == "" {
+	hasCert := tlsConfig.Certificate != "" && tlsConfig.Key != ""
+	if !ok || !hasCert && !tlsConfig.Generate && len(tlsConfig.ACME.Domains) == 0 {
 		return fmt.Errorf("TLS profile is incomplete for port %d", pc.Port)
 	}
 
-	s.Logger.Infof("starting HTTPS server on port %d with TLS profile: %s", pc.Port, pc.TLSProfile)
-	return server.ListenAndServeTLS(tlsConfig.Certificate, tlsConfig.Key)
+	if server.TLSConfig == nil {
+		var err error
+		if server.TLSConfig, err = s.newTLSConfig(pc.TLSProfile, tlsConfig); err != nil {
+			return err
+		}
+	}
+	if server.TLSConfig != nil {
+		s.Logger.Infof("starting HTTPS server on %s with TLS profile: %s (certificates obtained on the fly)", server.Addr, pc.TLSProfile)
+	} else {
+		s.Logger.Infof("starting HTTPS server on %s with TLS profile: %s", server.Addr, pc.TLSProfile)
+	}
+	ln, err := s.listen(server, pc)
+	if err != nil {
+		return err
+	}
+	if pc.HTTP3 {
+		h3, err := s.startHTTP3Server(server, tlsConfig.Certificate, tlsConfig.Key)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("error starting the HTTP/3 server on %s: %s", server.Addr, err)
+		}
+		defer h3.Close()
+	}
+	if server.TLSConfig != nil {
+		return server.ServeTLS(ln, "", "")
+	}
+	return server.ServeTLS(ln, tlsConfig.Certificate, tlsConfig.Key)
 }
 
 // StartHTTPServer starts the configured HTTP server.
 func (s *Server) StartHTTPServer(server *http.Server, pc config.PortConfig) error {
-	s.Logger.Infof("starting HTTP server on port %d", pc.Port)
-	return server.ListenAndServe()
+	s.Logger.Infof("starting HTTP server on %s", server.Addr)
+	ln, err := s.listen(server, pc)
+	if err != nil {
+		return err
+	}
+	return server.Serve(ln)
+}
+
+// listen returns the listener of the port. With the PROXY protocol, the
+// source addresses are read from the headers sent by the load balancer. The
+// ClientHello of the TLS clients, or the header order of the cleartext
+// requests, is recorded to fingerprint them.
+func (s *Server) listen(server *http.Server, pc config.PortConfig) (net.Listener, error) {
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if pc.ProxyProtocol {
+		ln = proxyproto.NewListener(ln, 0)
+	}
+	return fingerprint.NewListener(ln, pc.Protocol == "TLS"), nil
 }
 
 func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request, serverAddr string) {
+	start := time.Now()
 	port := s.extractPort(serverAddr)
 	s.Logger.Infof("port %s received a request for %q, from source %s", port, r.URL.String(), r.RemoteAddr)
+	s.Metrics.Request(port, s.personaName())
+	if s.denyAccess(w, r, port) {
+		return
+	}
+	r = r.WithContext(logger.WithMetadata(r.Context(), s.Config.Metadata))
+	r = s.tagEmulations(r)
+	if s.Usage != nil {
+		r = r.WithContext(llm.WithUsage(r.Context()))
+	}
 
-	response, err := cache.CheckCache(s.Cache, r, port, s.CacheDuration)
-	if err != nil {
-		if errors.Is(err, cache.ErrCacheExpired) || errors.Is(err, cache.ErrCacheMiss) {
-			s.Logger.Infof("Cache check for %q: %s", r.URL.String(), err)
-		} else {
-			s.Logger.Error(err)
+	if s.handleExpect(w, r) {
+		return
+	}
+	r = s.readRequestBody(r)
+	r = s.captureUploads(r)
+	r = s.classifyPayload(r)
+	r = s.detectScanner(r)
+	r = s.detectHoneytokens(r)
+	if s.servePixel(w, r, port) {
+		return
+	}
+	if s.handleChallenge(w, r, port) {
+		return
+	}
+	if s.handleAuthChallenge(w, r, port) {
+		return
+	}
+	// The WebSocket upgrades hijack the connection of the writer.
+	if s.handleWebSocket(w, r, port) {
+		return
+	}
+	w = s.delayResponse(w, r, start)
+	w, r = s.useCookieSession(w, r)
+	w, r, release := s.tarpit(w, r)
+	defer release()
+	if s.handleStaticRule(w, r, port) {
+		return
+	}
+	if s.handleStaticArtifact(w, r, port) {
+		return
+	}
+	if s.handleScanner(w, r, port) {
+		return
+	}
+	r = s.checkInjection(r)
+	s, r = s.routeModel(r)
+
+	// The sources over their rate are served their cached response, without
+	// the other lookups.
+	r, response, limited := s.limitRate(w, r, port)
+	if limited && response == nil {
+		return
+	}
+
+	var embedding []float32
+	if !limited {
+		if resp, ok := s.consistentResponse(r, port); ok {
+			if s.History != nil {
+				s.History.RecordResponse(r, resp)
+			}
+			s.sendResponse(w, resp)
+			s.Logger.Infof("sent the response previously served to %s", r.RemoteAddr)
+			s.EventLogger.LogEvent(r, resp, port)
+			return
+		}
+
+		response, embedding = s.cachedResponse(r, port)
+		if response == nil {
+			var unlock func()
+			response, unlock = s.awaitGeneration(r, port)
+			defer unlock()
 		}
 	}
 
-	if response == nil {
-		response, err = s.generateResponse(r, port)
+	generated := response == nil
+	var respData llm.JSONResponse
+	var stream *llm.BodyStream
+	var err error
+	if generated {
+		if s.streams() {
+			stream = s.newBodyStream(w, r)
+			r = r.WithContext(llm.WithBodyStream(r.Context(), stream))
+		}
+		var raw string
+		var served llm.Config
+		respData, raw, served, err = s.generateResponse(r, port)
+		r = r.WithContext(logger.WithLLMConfig(r.Context(), served))
+		// Part of the response was already sent, it can't be replaced.
+		if err != nil && stream.Started() {
+			status := stream.StatusCode()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			s.EventLogger.LogError(r, raw, port, status, err)
+			return
+		}
+		if limiter.Rejected(err) {
+			if response = s.handleOverflow(w, r, port); response == nil {
+				return
+			}
+			s.Logger.Infof("serving the cached response to %q: %s", r.URL.String(), err)
+			err, generated = nil, false
+		}
+		// While the provider's circuit breaker is open, or the budget is
+		// spent, a previously generated response is served even if it has
+		// expired.
+		if errors.Is(err, llm.ErrCircuitOpen) || errors.Is(err, llm.ErrBudgetExceeded) {
+			if response = s.staleResponse(r, port); response != nil {
+				s.Logger.Infof("serving the cached response to %q: %s", r.URL.String(), err)
+				err, generated = nil, false
+			}
+		}
+		if err == nil && embedding != nil {
+			if err := s.Semantic.Add(s.cacheKey(r, port), port, embedding); err != nil {
+				s.Logger.Errorf("error indexing the request in the semantic cache: %s", err)
+			}
+		}
 		if err != nil {
+			if s.errorAction(err) == actionStatic {
+				static := s.sendStaticResponse(w)
+				s.EventLogger.LogError(r, raw, port, static.StatusCode, err)
+				return
+			}
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			s.EventLogger.LogError(r, raw, port, http.StatusInternalServerError, err)
 			return
 		}
 	}
 
-	var respData llm.JSONResponse
-	if err := json.Unmarshal(response, &respData); err != nil {
-		s.Logger.Errorf("error unmarshalling the json-encoded data: %s", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+	// The generated responses are already decoded and normalized.
+	if response != nil {
+		if err := json.Unmarshal(response, &respData); err != nil {
+			s.Logger.Errorf("error unmarshalling the json-encoded data: %s", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		llm.Normalize(&respData)
+	}
+	s.applyProfile(r, &respData)
+	s.sanitizeHeaders(&respData)
+	streamed := stream.Started()
+	if !streamed {
+		s.processBody(r, &respData)
+	}
+
+	if s.History != nil {
+		s.History.RecordResponse(r, respData)
+	}
+	s.rememberResponse(r, port, respData)
+	if generated && s.Signatures != nil {
+		s.Signatures.Record(respData)
 	}
 
-	s.sendResponse(w, respData)
-	s.Logger.Infof("sent the generated response to %s", r.RemoteAddr)
+	if streamed {
+		llm.TruncateBody(&respData, s.Config.Response.MaxBodySize)
+		s.Logger.Infof("streamed the generated response to %s", r.RemoteAddr)
+	} else {
+		_, span := tracer.Start(r.Context(), "galah.response.send", trace.WithAttributes(attribute.Int("http.response.status_code", respData.StatusCode)))
+		s.sendResponse(w, respData)
+		span.End()
+		s.Logger.Infof("sent the generated response to %s", r.RemoteAddr)
+	}
 	s.EventLogger.LogEvent(r, respData, port)
 }
 
+// processBody runs the post-processing pipeline on the response, the default
+// pipeline if the server has none.
+func (s *Server) processBody(r *http.Request, resp *llm.JSONResponse) {
+	pipeline := s.Pipeline
+	if pipeline == nil {
+		pipeline = builtinPipeline
+	}
+	pipeline.Process(s, r, resp)
+}
+
 func (s *Server) extractPort(serverAddr string) string {
 	_, port, err := net.SplitHostPort(serverAddr)
 	if err != nil {
@@ -177,32 +478,52 @@ func (s *Server) extractPort(serverAddr string) string {
 	return port
 }
 
-func (s *Server) generateResponse(r *http.Request, port string) ([]byte, error) {
-	messages, err := llm.CreateMessageContent(r, s.Config, s.LLMConfig.Provider)
+// generateResponse generates a response to the request and returns it along
+// with the configuration of the provider that served it, and on error the
+// raw output of the model, if any.
+func (s *Server) generateResponse(r *http.Request, port string) (llm.JSONResponse, string, llm.Config, error) {
+	_, span := tracer.Start(r.Context(), "galah.prompt.build")
+	messages, err := llm.CreateMessageContent(r, s.Config, s.LLMConfig.Provider, s.History)
+	span.End()
 	if err != nil {
 		s.Logger.Errorf("error creating llm message: %s", err)
-		return nil, err
+		return llm.JSONResponse{}, "", s.LLMConfig, err
+	}
+
+	if s.Limiter != nil {
+		_, span := tracer.Start(r.Context(), "galah.limiter.acquire")
+		release, err := s.Limiter.Acquire(r.Context(), llm.SourceIP(r))
+		span.End()
+		if err != nil {
+			s.Logger.Infof("generation for %s throttled: %s", r.RemoteAddr, err)
+			return llm.JSONResponse{}, "", s.LLMConfig, err
+		}
+		defer release()
 	}
 
-	responseString, err := llm.GenerateLLMResponse(r.Context(), s.Model, s.LLMConfig.Temperature, messages)
+	resp, raw, served, err := s.generateWithPolicy(r, messages)
 	if err != nil {
 		s.Logger.Errorf("error generating response: %s", err)
-		s.EventLogger.LogError(r, responseString, port, err)
-		return nil, err
+		return resp, raw, served, err
+	}
+	resp, served = s.regenerateOversized(r, messages, resp, served)
+	resp, served = s.checkContentType(r, messages, resp, served)
+	resp, served = s.moderate(r, messages, resp, served)
+	response, err := json.Marshal(resp)
+	if err != nil {
+		return resp, "", served, fmt.Errorf("error encoding the generated response: %s", err)
 	}
-	response := []byte(responseString)
 
-	s.Logger.Infof("generated HTTP response: %s", strings.ReplaceAll(responseString, "\n", " "))
+	s.Logger.Infof("generated HTTP response: %s", response)
 
 	// Store the response if caching is enabled
-	if s.CacheDuration != 0 {
-		key := cache.GetCacheKey(r, port)
-		if err := cache.StoreResponse(s.Cache, key, response); err != nil {
+	if ttl := s.cacheTTL(r); ttl != 0 {
+		if err := cache.StoreRequestResponse(s.Cache, r, s.cacheKey(r, port), response, ttl); err != nil {
 			s.Logger.Errorf("error storing response in cache: %s", err)
 		}
 	}
 
-	return response, nil
+	return resp, "", served, nil
 }
 
 func (s *Server) sendResponse(w http.ResponseWriter, response llm.JSONResponse) {
@@ -211,12 +532,32 @@ func (s *Server) sendResponse(w http.ResponseWriter, response llm.JSONResponse)
 			w.Header().Set(key, value)
 		}
 	}
+	body, err := response.DecodedBody()
+	if err != nil {
+		s.Logger.Errorf("error decoding the response body: %s", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	status := response.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	if !bodyAllowed(status) {
+		return
+	}
 
-	if _, err := w.Write([]byte(response.Body)); err != nil {
+	if _, err := w.Write(body); err != nil {
 		s.Logger.Errorf("error writing response: %s", err)
 	}
 }
 
+// bodyAllowed reports whether a response with the status code may include a
+// body.
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified
+}
+
 func isExcludedHeader(headerKey string) bool {
 	return ignoreHeaders[strings.ToLower(headerKey)]
 }
@@ -230,22 +571,116 @@ func (s *Server) ListenForShutdownSignals() {
 		<-sig
 		s.Logger.Infof("received shutdown signal. shutting down servers...")
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		for _, server := range s.Servers {
-			if err := server.Shutdown(ctx); err != nil {
-				s.Logger.Errorf("error shutting down server: %s", err)
+		if s.Signatures != nil {
+			for _, sc := range s.Signatures.Top(10) {
+				s.Logger.Infof("response %s was generated %d times", sc.Signature, sc.Count)
 			}
 		}
 
-		s.Logger.Infoln("all servers shut down gracefully.")
+		s.Shutdown()
 		os.Exit(0)
 	}()
 }
 
-// getInterfaceIP retrieves the IPv4 address of the specified network interface.
-func getInterfaceIP(ifaceName string) (string, error) {
+// Shutdown stops the servers accepting connections and waits for the
+// in-flight requests, and their generations, to complete up to
+// ShutdownTimeout, before closing the remaining connections. The WebSocket
+// sessions are closed right away and waited for. Then, it flushes the event
+// outputs and closes the event store, the cache and the trace exporter.
+func (s *Server) Shutdown() {
+	timeout := s.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var forced atomic.Bool
+	for addr, server := range s.Servers {
+		wg.Add(1)
+		go func(addr string, server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				s.Logger.Errorf("error shutting down the server on %s, closing its connections: %s", addr, err)
+				server.Close()
+				forced.Store(true)
+			}
+		}(addr, server)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := s.WebSockets.Close(ctx); err != nil {
+			s.Logger.Errorf("error closing the WebSocket sessions: %s", err)
+			forced.Store(true)
+		}
+	}()
+	wg.Wait()
+	if forced.Load() {
+		s.Logger.Warnln("all servers shut down, some in-flight requests were aborted.")
+	} else {
+		s.Logger.Infoln("all servers shut down gracefully.")
+	}
+
+	if s.EventLogger != nil {
+		if err := s.EventLogger.Close(); err != nil {
+			s.Logger.Errorf("error flushing the event outputs: %s", err)
+		}
+	}
+	if s.EventStore != nil {
+		if err := s.EventStore.Close(); err != nil {
+			s.Logger.Errorf("error closing the event store: %s", err)
+		}
+	}
+	if s.Cache != nil {
+		if err := s.Cache.Close(); err != nil {
+			s.Logger.Errorf("error closing the cache: %s", err)
+		}
+	}
+	if s.Cluster != nil {
+		if err := s.Cluster.Close(); err != nil {
+			s.Logger.Errorf("error closing the cluster connections: %s", err)
+		}
+	}
+	if s.Capture != nil {
+		if err := s.Capture.Close(); err != nil {
+			s.Logger.Errorf("error closing the packet capture: %s", err)
+		}
+	}
+	if s.Honeytokens != nil {
+		if err := s.Honeytokens.Close(); err != nil {
+			s.Logger.Errorf("error closing the honeytokens: %s", err)
+		}
+	}
+	s.Tracing.Shutdown()
+}
+
+// listenHost returns the host the port is served on: its address, else the
+// address of its interface or of the interface served on, else the empty
+// host of all the addresses.
+func (s *Server) listenHost(pc config.PortConfig) string {
+	if pc.Address != "" {
+		return strings.TrimSuffix(strings.TrimPrefix(pc.Address, "["), "]")
+	}
+	iface := pc.Interface
+	if iface == "" {
+		iface = s.Interface
+	}
+	if iface == "" {
+		return ""
+	}
+	ip, err := getInterfaceIP(iface, pc.IPv6)
+	if err != nil {
+		s.Logger.Errorln(err)
+	}
+	return ip
+}
+
+// getInterfaceIP retrieves the IPv4 address of the specified network
+// interface, or its IPv6 address if ipv6 is true: a global address if it has
+// one, else its link-local address with the interface as zone.
+func getInterfaceIP(ifaceName string, ipv6 bool) (string, error) {
 	ifs, err := pcap.FindAllDevs()
 	if err != nil {
 		return "", err
@@ -253,14 +688,39 @@ func getInterfaceIP(ifaceName string) (string, error) {
 
 	for _, iface := range ifs {
 		if iface.Name == ifaceName {
+			var ips []net.IP
 			for _, address := range iface.Addresses {
-				ip := address.IP
-				if ip != nil && ip.To4() != nil && !ip.IsLoopback() {
-					return ip.String(), nil
-				}
+				ips = append(ips, address.IP)
+			}
+			if ip := selectInterfaceIP(ips, ifaceName, ipv6); ip != "" {
+				return ip, nil
 			}
 		}
 	}
 
-	return "", fmt.Errorf("no non-loopback addresses found for interface: %s", ifaceName)
+	family := "IPv4"
+	if ipv6 {
+		family = "IPv6"
+	}
+	return "", fmt.Errorf("no non-loopback %s addresses found for interface: %s", family, ifaceName)
+}
+
+// selectInterfaceIP returns the first non-loopback address of the family
+// among the addresses of the interface, the link-local IPv6 addresses (with
+// the interface as zone) only if it has no global one, and "" if none.
+func selectInterfaceIP(ips []net.IP, ifaceName string, ipv6 bool) string {
+	var linkLocal string
+	for _, ip := range ips {
+		if ip == nil || ip.IsLoopback() || (ip.To4() != nil) == ipv6 {
+			continue
+		}
+		if ipv6 && ip.IsLinkLocalUnicast() {
+			if linkLocal == "" {
+				linkLocal = ip.String() + "%" + ifaceName
+			}
+			continue
+		}
+		return ip.String()
+	}
+	return linkLocal
 }
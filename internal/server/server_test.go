@@ -2,14 +2,33 @@ package server_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/0x4d31/galah/internal/app"
 	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
 	"github.com/0x4d31/galah/internal/server"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/quic-go/quic-go/http3"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -164,3 +183,149 @@ func TestStartTLSServer(t *testing.T) {
 		})
 	}
 }
+
+func TestStartTLSServerHTTP3(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeSelfSignedCert(t, certFile, keyFile)
+
+	// A free port of both TCP and UDP.
+	ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.LocalAddr().(*net.UDPAddr).Port
+	ln.Close()
+
+	l := logrus.New()
+	eventLogger, err := logger.New(filepath.Join(dir, "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := server.NewStaticRules([]config.StaticRuleConfig{{Paths: []string{"/"}, Body: "{{ .Method }}"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := server.Server{
+		Config: &config.Config{
+			Profiles: map[string]config.TLSConfig{"tls": {Certificate: certFile, Key: keyFile}},
+		},
+		EventLogger: eventLogger,
+		Logger:      l,
+		Rules:       rules,
+	}
+	pc := config.PortConfig{Port: uint16(port), Protocol: "TLS", Address: "127.0.0.1", TLSProfile: "tls", HTTP3: true}
+	h := srv.SetupServer(pc)
+	errs := make(chan error, 1)
+	go func() { errs <- srv.StartTLSServer(h, pc) }()
+	defer func() {
+		h.Shutdown(context.Background())
+		if err := <-errs; err != http.ErrServerClosed {
+			t.Errorf("StartTLSServer() error = %v", err)
+		}
+	}()
+
+	tlsClient := &tls.Config{InsecureSkipVerify: true}
+	url := fmt.Sprintf("https://127.0.0.1:%d/", port)
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = (&http.Client{Transport: &http.Transport{TLSClientConfig: tlsClient}}).Get(url); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("HTTPS request error = %v", err)
+	}
+	resp.Body.Close()
+	if want := fmt.Sprintf(`h3=":%d"; ma=86400`, port); resp.Header.Get("Alt-Svc") != want {
+		t.Errorf("Expected the Alt-Svc header %q, got %q", want, resp.Header.Get("Alt-Svc"))
+	}
+
+	rt := &http3.RoundTripper{TLSClientConfig: tlsClient}
+	defer rt.Close()
+	resp, err = (&http.Client{Transport: rt, Timeout: 5 * time.Second}).Get(url)
+	if err != nil {
+		t.Fatalf("HTTP/3 request error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.ProtoMajor != 3 || string(body) != "GET" {
+		t.Errorf("Expected an HTTP/3 response with body %q, got %s and %q", "GET", resp.Proto, body)
+	}
+}
+
+// writeSelfSignedCert writes a self-signed certificate of 127.0.0.1 and its
+// key to the PEM files.
+func writeSelfSignedCert(t *testing.T, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetupServerHTTP2(t *testing.T) {
+	l := logrus.New()
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := server.NewStaticRules([]config.StaticRuleConfig{{Paths: []string{"/"}, Body: "{{ .Method }}"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := server.Server{
+		Config:      &config.Config{},
+		EventLogger: eventLogger,
+		Logger:      l,
+		Rules:       rules,
+	}
+
+	enabled := true
+	h := srv.SetupServer(config.PortConfig{Port: 8080, Protocol: "HTTP", HTTP2: &enabled})
+	ts := httptest.NewServer(h.Handler)
+	defer ts.Close()
+
+	// An HTTP/2 client with prior knowledge, over cleartext.
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err := client.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("h2c request error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.ProtoMajor != 2 || string(body) != "GET" {
+		t.Errorf("Expected an HTTP/2 response with body %q, got %s and %q", "GET", resp.Proto, body)
+	}
+
+	disabled := false
+	if h := srv.SetupServer(config.PortConfig{Port: 8443, Protocol: "TLS", HTTP2: &disabled}); h.TLSNextProto == nil {
+		t.Errorf("Expected HTTP/2 to be disabled on the TLS port")
+	}
+}
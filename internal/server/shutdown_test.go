@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+	"github.com/tmc/langchaingo/llms"
+	"golang.org/x/net/websocket"
+)
+
+// closeHook counts the events fired before it is closed.
+type closeHook struct {
+	fired  int
+	closed bool
+}
+
+func (h *closeHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h *closeHook) Fire(*logrus.Entry) error {
+	if h.closed {
+		panic("event fired after close")
+	}
+	h.fired++
+	return nil
+}
+
+func (h *closeHook) Close() error {
+	h.closed = true
+	return nil
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	hook := &closeHook{}
+	events := logrus.New()
+	events.Out = io.Discard
+	events.AddHook(hook)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		events.Info("successfulResponse")
+		w.Write([]byte("ok"))
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+
+	s := &Server{
+		EventLogger:     &logger.Logger{EventLogger: events},
+		Logger:          logrus.New(),
+		Servers:         map[string]*http.Server{":8080": server},
+		ShutdownTimeout: 5 * time.Second,
+	}
+	resp := make(chan error, 1)
+	go func() {
+		r, err := http.Get("http://" + ln.Addr().String())
+		if err == nil {
+			r.Body.Close()
+		}
+		resp <- err
+	}()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		s.Shutdown()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Expected the shutdown to wait for the in-flight request")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, err := net.DialTimeout("tcp", ln.Addr().String(), time.Second); err == nil {
+		t.Error("Expected the new connections to be refused")
+	}
+
+	close(release)
+	if err := <-resp; err != nil {
+		t.Errorf("Expected the in-flight request to complete, got %v", err)
+	}
+	<-done
+	if hook.fired != 1 || !hook.closed {
+		t.Errorf("Expected the event to be flushed before closing the outputs, got %d events, closed %t", hook.fired, hook.closed)
+	}
+}
+
+// blockingModel blocks the generations until they are canceled.
+type blockingModel struct {
+	started chan struct{}
+}
+
+func (m *blockingModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+	close(m.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (m *blockingModel) Call(ctx context.Context, prompt string, opts ...llms.CallOption) (string, error) {
+	return "", nil
+}
+
+func TestShutdownClosesWebSockets(t *testing.T) {
+	l := logrus.New()
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook := &closeHook{}
+	eventLogger.EventLogger.AddHook(hook)
+
+	model := &blockingModel{started: make(chan struct{})}
+	s := &Server{
+		Config:          &config.Config{WebSocket: config.WebSocketConfig{Enabled: true}},
+		EventLogger:     eventLogger,
+		LLMConfig:       llm.Config{Provider: "openai"},
+		Logger:          l,
+		Model:           model,
+		ShutdownTimeout: 5 * time.Second,
+		WebSockets:      NewWebSocketSessions(),
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.handleWebSocket(w, r, "8080")
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+	s.Servers = map[string]*http.Server{":8080": server}
+
+	conn, err := websocket.Dial("ws://"+ln.Addr().String()+"/ws", "", "http://evil.example")
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	if err := websocket.Message.Send(conn, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	<-model.started
+
+	done := make(chan struct{})
+	go func() {
+		s.Shutdown()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the shutdown to close the WebSocket session")
+	}
+	// The opening and the error of the session are logged before the outputs
+	// are closed.
+	if hook.fired != 2 || !hook.closed {
+		t.Errorf("Expected the session to end before closing the outputs, got %d events, closed %t", hook.fired, hook.closed)
+	}
+	var message string
+	if err := websocket.Message.Receive(conn, &message); err == nil {
+		t.Errorf("Expected the WebSocket connection to be closed, got %q", message)
+	}
+	if _, _, ok := s.WebSockets.open(context.Background(), conn); ok {
+		t.Error("Expected the sessions opened after the shutdown to be refused")
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/tmc/langchaingo/llms"
+)
+
+const oversizedRegenerate = "regenerate"
+
+// shorterPrompt asks the model for a response under the body size limit.
+const shorterPrompt = "Your previous response body was %d bytes long. Generate the response again with a body of at most %d bytes."
+
+// regenerateOversized asks the model once for a shorter response if the body
+// of the response exceeds the configured maximum size and regeneration is
+// enabled. The shorter response is only used if it is smaller; bodies still
+// too long are truncated afterwards.
+func (s *Server) regenerateOversized(r *http.Request, messages []llms.MessageContent, resp llm.JSONResponse, served llm.Config) (llm.JSONResponse, llm.Config) {
+	max := s.Config.Response.MaxBodySize
+	size := len(resp.Body)
+	if s.Config.Response.Oversized != oversizedRegenerate || max <= 0 || size <= max {
+		return resp, served
+	}
+
+	s.Logger.Infof("generated body for %q is %d bytes, regenerating a shorter response", r.URL.String(), size)
+	shorter := append(messages[:len(messages):len(messages)], llms.TextParts(llms.ChatMessageTypeHuman, fmt.Sprintf(shorterPrompt, size, max)))
+	next, _, config, err := s.generateWithPolicy(r, shorter)
+	if err != nil {
+		s.Logger.Errorf("error regenerating the oversized response: %s", err)
+		return resp, served
+	}
+	if len(next.Body) >= size {
+		return resp, served
+	}
+	return next, config
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestRegenerateOversized(t *testing.T) {
+	long := `{"headers": {"Server": "nginx"}, "body": "` + strings.Repeat("a", 100) + `"}`
+	tests := []struct {
+		name      string
+		oversized string
+		response  string
+		results   []any
+		want      string
+		wantCalls int
+	}{
+		{
+			name:      "regeneratesOversized",
+			oversized: oversizedRegenerate,
+			response:  long,
+			results:   []any{validResponse},
+			want:      validResponse,
+			wantCalls: 1,
+		},
+		{
+			name:      "keepsSmallResponse",
+			oversized: oversizedRegenerate,
+			response:  validResponse,
+			results:   []any{validResponse},
+			want:      validResponse,
+		},
+		{
+			name:      "keepsLongerRegeneration",
+			oversized: oversizedRegenerate,
+			response:  long,
+			results:   []any{long},
+			want:      long,
+			wantCalls: 1,
+		},
+		{
+			name:     "truncateDoesNotRegenerate",
+			response: long,
+			results:  []any{validResponse},
+			want:     long,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &sequenceModel{results: tt.results}
+			s := &Server{
+				Config: &config.Config{UserPrompt: "%q", Response: config.ResponseConfig{
+					MaxBodySize: 10,
+					Oversized:   tt.oversized,
+				}},
+				LLMConfig: llm.Config{Provider: "openai"},
+				Logger:    logrus.New(),
+				Model:     model,
+			}
+
+			r := httptest.NewRequest("GET", "/", nil)
+			messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "test")}
+			resp, err := llm.ParseJSONResponse(tt.response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := llm.ParseJSONResponse(tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := s.regenerateOversized(r, messages, resp, s.LLMConfig)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected %+v, got %+v", want, got)
+			}
+			if model.calls != tt.wantCalls {
+				t.Errorf("Expected %d calls, got %d", tt.wantCalls, model.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/0x4d31/galah/internal/stats"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// topSignatures is the number of most common responses included in the stats.
+const topSignatures = 10
+
+// Stats is the document served by the stats endpoint.
+type Stats struct {
+	Usage        *llm.UsageTotals       `json:"usage,omitempty"`
+	Budget       *llm.BudgetStatus      `json:"budget,omitempty"`
+	TopResponses []stats.SignatureCount `json:"topResponses,omitempty"`
+}
+
+// StartStatsServer serves the token usage, estimated cost and response
+// statistics as JSON at /stats on addr, and the cache management API at
+// /cache, authenticated with the admin token. The cache management API isn't
+// served without a token.
+func (s *Server) StartStatsServer(addr, token string) error {
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      s.statsHandler(token),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	s.Logger.Infof("starting stats server on %s", addr)
+	return server.ListenAndServe()
+}
+
+func (s *Server) statsHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", s.handleStats)
+	if token != "" {
+		mux.Handle("/cache", requireToken(token, http.HandlerFunc(s.handleCache)))
+	}
+	return mux
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	var st Stats
+	if s.Usage != nil {
+		totals := s.Usage.Totals()
+		st.Usage = &totals
+	}
+	if s.Budget != nil {
+		status := s.Budget.Status()
+		st.Budget = &status
+	}
+	if s.Signatures != nil {
+		st.TopResponses = s.Signatures.Top(topSignatures)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(st); err != nil {
+		s.Logger.Errorf("error writing stats: %s", err)
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/stats"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestHandleStats(t *testing.T) {
+	usage := llm.NewUsageTracker()
+	s := &Server{
+		Logger:     logrus.New(),
+		Signatures: stats.NewSignatures(10),
+		Usage:      usage,
+	}
+
+	model := usage.Wrap(&sequenceModel{results: []any{validResponse}}, "gpt-4o")
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "test")}
+	if _, err := llm.GenerateLLMResponse(context.Background(), model, llm.Config{Provider: "openai"}, messages); err != nil {
+		t.Fatalf("GenerateLLMResponse() error = %v", err)
+	}
+	s.Signatures.Record(llm.JSONResponse{Body: "ok"})
+
+	w := httptest.NewRecorder()
+	s.handleStats(w, httptest.NewRequest("GET", "/stats", nil))
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", ct)
+	}
+	var got Stats
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("error decoding stats: %s", err)
+	}
+	if got.Usage == nil || got.Usage.Generations != 1 || got.Usage.Models["gpt-4o"].Generations != 1 {
+		t.Errorf("Expected one gpt-4o generation, got %+v", got.Usage)
+	}
+	if len(got.TopResponses) != 1 {
+		t.Errorf("Expected 1 top response, got %d", len(got.TopResponses))
+	}
+}
+
+func TestStatsHandlerCacheAuth(t *testing.T) {
+	c, err := cache.InitializeCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	s := &Server{Cache: c, Logger: logrus.New()}
+	tests := []struct {
+		name     string
+		token    string
+		auth     string
+		wantCode int
+	}{
+		{name: "noToken", wantCode: http.StatusNotFound},
+		{name: "unauthenticated", token: "secret", wantCode: http.StatusUnauthorized},
+		{name: "wrongToken", token: "secret", auth: "Bearer nope", wantCode: http.StatusUnauthorized},
+		{name: "authenticated", token: "secret", auth: "Bearer secret", wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/cache", nil)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			s.statsHandler(tt.token).ServeHTTP(w, r)
+			if w.Code != tt.wantCode {
+				t.Errorf("Expected status %d, got %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// CheckStreaming checks that the streamed responses don't need the checks of
+// the generated bodies, which can't replace a body already sent: the
+// moderation, the content type check and the regeneration of the oversized
+// bodies.
+func CheckStreaming(rc config.ResponseConfig) error {
+	if !rc.Stream {
+		return nil
+	}
+	var errs []error
+	if rc.Moderation.Enabled {
+		errs = append(errs, errors.New("the streamed responses can't be moderated, disable moderation"))
+	}
+	if rc.ContentMismatch == contentMismatchRepair || rc.ContentMismatch == contentMismatchRegenerate {
+		errs = append(errs, errors.New("the content type of the streamed responses can't be checked, set content_mismatch to \"\""))
+	}
+	if rc.Oversized == oversizedRegenerate {
+		errs = append(errs, errors.New("the oversized streamed responses can't be regenerated, set oversized to truncate"))
+	}
+	return errors.Join(errs...)
+}
+
+// streams reports whether the generated responses are streamed, only if
+// their bodies aren't checked after the generation.
+func (s *Server) streams() bool {
+	return s.Config.Response.Stream && CheckStreaming(s.Config.Response) == nil && s.Moderator == nil
+}
+
+// newBodyStream returns a stream writing the generated response to w while it
+// is being generated. The headers are post-processed like those of complete
+// responses; the body is written as generated, up to the maximum body size,
+// and flushed after each chunk so that it is sent with chunked encoding.
+// The write timeout of the server applies to each write of the stream rather
+// than the whole response, which outlasts it with the long generations.
+func (s *Server) newBodyStream(w http.ResponseWriter, r *http.Request) *llm.BodyStream {
+	rc := http.NewResponseController(w)
+	// The generation is bounded by the deadline of the request.
+	_ = rc.SetWriteDeadline(time.Time{})
+	flush := func() {
+		_ = rc.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	written := 0
+	bodyless := false
+
+	return llm.NewBodyStream(
+		func(headers map[string]string, statusCode int) {
+			resp := llm.JSONResponse{StatusCode: statusCode, Headers: headers}
+			llm.Normalize(&resp)
+			s.applyProfile(r, &resp)
+			s.sanitizeHeaders(&resp)
+			for key, value := range resp.Headers {
+				if !isExcludedHeader(key) {
+					w.Header().Set(key, value)
+				}
+			}
+			if resp.StatusCode == 0 {
+				resp.StatusCode = http.StatusOK
+			}
+			w.WriteHeader(resp.StatusCode)
+			flush()
+			bodyless = !bodyAllowed(resp.StatusCode)
+		},
+		func(chunk string) {
+			if bodyless {
+				return
+			}
+			if max := s.Config.Response.MaxBodySize; max > 0 && written+len(chunk) > max {
+				chunk = chunk[:max-written]
+			}
+			if chunk == "" {
+				return
+			}
+			_ = rc.SetWriteDeadline(time.Now().Add(writeTimeout))
+			n, err := w.Write([]byte(chunk))
+			written += n
+			if err != nil {
+				s.Logger.Errorf("error writing response: %s", err)
+				return
+			}
+			flush()
+		},
+	)
+}
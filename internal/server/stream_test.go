@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// chunkedModel streams the content one byte at a time.
+type chunkedModel struct {
+	content string
+}
+
+func (m *chunkedModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+	var o llms.CallOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for i := 0; i < len(m.content) && o.StreamingFunc != nil; i++ {
+		if err := o.StreamingFunc(ctx, []byte{m.content[i]}); err != nil {
+			return nil, err
+		}
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: m.content}}}, nil
+}
+
+func (m *chunkedModel) Call(ctx context.Context, prompt string, opts ...llms.CallOption) (string, error) {
+	return "", nil
+}
+
+func TestNewBodyStream(t *testing.T) {
+	s := &Server{
+		Config: &config.Config{Response: config.ResponseConfig{MaxBodySize: 5}},
+		Logger: logrus.New(),
+	}
+	w := httptest.NewRecorder()
+	stream := s.newBodyStream(w, httptest.NewRequest("GET", "/", nil))
+
+	model := &chunkedModel{content: `{"headers": {"Server": "nginx", "Content-Length": "11"}, "body": "hello world"}`}
+	ctx := llm.WithBodyStream(context.Background(), stream)
+	if _, err := llm.GenerateLLMResponse(ctx, model, llm.Config{Provider: "openai"}, nil); err != nil {
+		t.Fatalf("GenerateLLMResponse() error = %v", err)
+	}
+
+	if !stream.Started() {
+		t.Fatal("Expected the response to be streamed")
+	}
+	if !w.Flushed {
+		t.Error("Expected the response to be flushed")
+	}
+	if got := w.Header().Get("Server"); got != "nginx" {
+		t.Errorf("Expected Server header %q, got %q", "nginx", got)
+	}
+	if got := w.Header().Get("Content-Length"); got != "" {
+		t.Errorf("Expected no Content-Length header, got %q", got)
+	}
+	if got := w.Body.String(); got != "hello" {
+		t.Errorf("Expected the body to be capped to %q, got %q", "hello", got)
+	}
+}
+
+func TestCheckStreaming(t *testing.T) {
+	tests := []struct {
+		name    string
+		rc      config.ResponseConfig
+		wantErr bool
+	}{
+		{"streamed", config.ResponseConfig{Stream: true, Oversized: "truncate"}, false},
+		{"moderatedNotStreamed", config.ResponseConfig{ContentMismatch: contentMismatchRepair, Moderation: config.ModerationConfig{Enabled: true}}, false},
+		{"moderated", config.ResponseConfig{Stream: true, Moderation: config.ModerationConfig{Enabled: true}}, true},
+		{"contentMismatch", config.ResponseConfig{Stream: true, ContentMismatch: contentMismatchRepair}, true},
+		{"oversized", config.ResponseConfig{Stream: true, Oversized: oversizedRegenerate}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckStreaming(tt.rc); (err != nil) != tt.wantErr {
+				t.Errorf("CheckStreaming() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStreamingModeratedResponse(t *testing.T) {
+	l := logrus.New()
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moderator, err := llm.NewModerator(llm.ModerationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Config: &config.Config{
+			UserPrompt: "%q",
+			Response:   config.ResponseConfig{Stream: true, Moderation: config.ModerationConfig{Enabled: true}},
+		},
+		EventLogger: eventLogger,
+		LLMConfig:   llm.Config{Provider: "openai"},
+		Logger:      l,
+		Model:       &chunkedModel{content: `{"headers": {}, "body": "As an AI language model, I can't emulate a server."}`},
+		Moderator:   moderator,
+	}
+	w := httptest.NewRecorder()
+	s.handleRequest(w, httptest.NewRequest("GET", "/", nil), "127.0.0.1:8080")
+
+	if w.Flushed || w.Body.String() != "I can't emulate a server." {
+		t.Errorf("Expected the moderated response not to be streamed, got %q", w.Body)
+	}
+}
+
+func TestSendResponseStatusCode(t *testing.T) {
+	tests := []struct {
+		name       string
+		resp       llm.JSONResponse
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "defaultsToOK",
+			resp:       llm.JSONResponse{Headers: map[string]string{"Server": "nginx"}, Body: "ok"},
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:       "redirect",
+			resp:       llm.JSONResponse{StatusCode: http.StatusMovedPermanently, Headers: map[string]string{"Location": "/login"}, Body: "Moved"},
+			wantStatus: http.StatusMovedPermanently,
+			wantBody:   "Moved",
+		},
+		{
+			name:       "base64Body",
+			resp:       llm.JSONResponse{Headers: map[string]string{"Content-Type": "image/x-icon"}, Encoding: llm.EncodingBase64, Body: "AAEC/w=="},
+			wantStatus: http.StatusOK,
+			wantBody:   "\x00\x01\x02\xff",
+		},
+		{
+			name:       "notModifiedHasNoBody",
+			resp:       llm.JSONResponse{StatusCode: http.StatusNotModified, Headers: map[string]string{}, Body: "cached"},
+			wantStatus: http.StatusNotModified,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{Logger: logrus.New()}
+			w := httptest.NewRecorder()
+			s.sendResponse(w, tt.resp)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("Expected body %q, got %q", tt.wantBody, got)
+			}
+		})
+	}
+}
+
+func TestBodyStreamOutlastsWriteTimeout(t *testing.T) {
+	s := &Server{Config: &config.Config{}, Logger: logrus.New()}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stream := s.newBodyStream(w, r)
+		// The generation outlasts the write timeout of the server.
+		time.Sleep(300 * time.Millisecond)
+		model := &chunkedModel{content: `{"headers": {"Server": "nginx"}, "body": "hello world"}`}
+		if _, err := llm.GenerateLLMResponse(llm.WithBodyStream(r.Context(), stream), model, llm.Config{Provider: "openai"}, nil); err != nil {
+			t.Errorf("GenerateLLMResponse() error = %v", err)
+		}
+	}))
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, err := io.ReadAll(resp.Body); err != nil || string(body) != "hello world" {
+		t.Errorf("Expected the streamed body past the write timeout, got %q, %v", body, err)
+	}
+}
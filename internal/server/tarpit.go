@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// tarpitTag tags the events of the tarpitted requests.
+const tarpitTag = "tarpit"
+
+// Default settings of the tarpit.
+const (
+	defaultTarpitChunkSize      = 1
+	defaultTarpitDelay          = time.Second
+	defaultTarpitMaxDuration    = 5 * time.Minute
+	defaultTarpitMaxConnections = 100
+)
+
+// tarpitIntelTimeout bounds the threat intelligence lookup of the tarpit,
+// which delays the response. The verdicts of the slower feeds are cached by
+// the lookup of the event, and flag the next requests of the source.
+const tarpitIntelTimeout = time.Second
+
+// Tarpit slows down the responses to the sources flagged as scanners, sending
+// their bodies a few bytes at a time (see config.TarpitConfig).
+type Tarpit struct {
+	cfg   config.TarpitConfig
+	slots chan struct{}
+}
+
+// NewTarpit returns the tarpit of the configuration, or nil if disabled.
+func NewTarpit(cfg config.TarpitConfig) *Tarpit {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = defaultTarpitChunkSize
+	}
+	if cfg.Delay <= 0 {
+		cfg.Delay = defaultTarpitDelay
+	}
+	if cfg.MaxDuration <= 0 {
+		cfg.MaxDuration = defaultTarpitMaxDuration
+	}
+	if cfg.MaxConnections <= 0 {
+		cfg.MaxConnections = defaultTarpitMaxConnections
+	}
+	return &Tarpit{cfg: cfg, slots: make(chan struct{}, cfg.MaxConnections)}
+}
+
+// tarpit returns the writer and the request of the response to the request:
+// a writer dripping the body if its source is flagged and a tarpit slot is
+// free. The returned function must be called once the response is sent.
+func (s *Server) tarpit(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, func()) {
+	if s.Tarpit == nil || !s.flagged(r) {
+		return w, r, func() {}
+	}
+	select {
+	case s.Tarpit.slots <- struct{}{}:
+	default:
+		// The responses are sent normally beyond the tarpitted connections.
+		return w, r, func() {}
+	}
+
+	cfg := s.Tarpit.cfg
+	deadline := time.Now().Add(cfg.MaxDuration)
+	// The write timeout of the server would interrupt the response.
+	http.NewResponseController(w).SetWriteDeadline(deadline.Add(writeTimeout))
+	s.Logger.Infof("tarpitting the response to %s", r.RemoteAddr)
+	tw := &tarpitWriter{
+		ResponseWriter: w,
+		ctx:            r.Context(),
+		chunkSize:      cfg.ChunkSize,
+		delay:          cfg.Delay,
+		deadline:       deadline,
+	}
+	r = r.WithContext(logger.WithTags(r.Context(), tarpitTag))
+	return tw, r, func() { <-s.Tarpit.slots }
+}
+
+// flagged reports whether the source of the request is flagged as a scanner:
+// with any of the tags of the tarpit from the enrichment, the threat
+// intelligence or the request, or a known scanner without tags.
+func (s *Server) flagged(r *http.Request) bool {
+	// The tags of the context are shared with the other handlers.
+	tags := slices.Clone(logger.TagsFrom(r.Context()))
+	if s.EventLogger != nil && s.EventLogger.EnrichCache != nil {
+		src := llm.SourceIP(r)
+		if info, err := s.EventLogger.EnrichCache.Process(src); err == nil && info != nil && info.KnownScanner != "" {
+			if len(s.Tarpit.cfg.Tags) == 0 {
+				return true
+			}
+			tags = append(tags, info.KnownScanner)
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), tarpitIntelTimeout)
+		verdicts, _ := s.EventLogger.EnrichCache.LookupThreatIntel(ctx, src)
+		cancel()
+		for _, v := range verdicts {
+			tags = append(tags, v.Tags...)
+		}
+	}
+	for _, tag := range s.Tarpit.cfg.Tags {
+		if slices.Contains(tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// tarpitWriter writes the body chunkSize bytes every delay until the
+// deadline, after which the rest is written at once.
+type tarpitWriter struct {
+	http.ResponseWriter
+	ctx       context.Context
+	chunkSize int
+	delay     time.Duration
+	deadline  time.Time
+}
+
+func (w *tarpitWriter) Write(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if time.Now().After(w.deadline) {
+			m, err := w.ResponseWriter.Write(p[n:])
+			return n + m, err
+		}
+		m, err := w.ResponseWriter.Write(p[n:min(n+w.chunkSize, len(p))])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		w.Flush()
+		if err := sleep(w.ctx, w.delay); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (w *tarpitWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *tarpitWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
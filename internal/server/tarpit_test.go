@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+func TestTarpit(t *testing.T) {
+	s := &Server{
+		Logger: logrus.New(),
+		Tarpit: NewTarpit(config.TarpitConfig{Enabled: true, Tags: []string{"scanner"}, ChunkSize: 2, Delay: time.Millisecond, MaxConnections: 1}),
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	if tw, _, release := s.tarpit(w, r); isTarpitted(tw) {
+		t.Errorf("Expected the request without the tags not to be tarpitted")
+	} else {
+		release()
+	}
+
+	r = r.WithContext(logger.WithTags(r.Context(), "scanner"))
+	tw, tr, release := s.tarpit(w, r)
+	if !isTarpitted(tw) {
+		t.Fatal("Expected the tagged request to be tarpitted")
+	}
+	if tags := logger.TagsFrom(tr.Context()); len(tags) != 2 || tags[1] != tarpitTag {
+		t.Errorf("Expected the request to be tagged %q, got %v", tarpitTag, tags)
+	}
+	// The slots are all taken.
+	if other, _, _ := s.tarpit(httptest.NewRecorder(), r); isTarpitted(other) {
+		t.Errorf("Expected the request beyond the slots not to be tarpitted")
+	}
+
+	start := time.Now()
+	if n, err := tw.Write([]byte("hello")); n != 5 || err != nil {
+		t.Errorf("Expected 5 bytes written, got %d, %v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 3*time.Millisecond {
+		t.Errorf("Expected the body to be dripped in 3 chunks, took %s", elapsed)
+	}
+	if w.Body.String() != "hello" || !w.Flushed {
+		t.Errorf("Expected the flushed body \"hello\", got %q", w.Body)
+	}
+	release()
+	if other, _, release := s.tarpit(httptest.NewRecorder(), r); !isTarpitted(other) {
+		t.Errorf("Expected the released slot to be reused")
+	} else {
+		release()
+	}
+}
+
+func isTarpitted(w http.ResponseWriter) bool {
+	_, ok := w.(*tarpitWriter)
+	return ok
+}
+
+// intelFeed is a threat intelligence feed tagging every address with tag,
+// after delay or once the lookup is canceled if block is true.
+type intelFeed struct {
+	tag   string
+	block bool
+}
+
+func (f intelFeed) Name() string { return "test" }
+
+func (f intelFeed) Lookup(ctx context.Context, ip string) (*enrich.Verdict, error) {
+	if f.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &enrich.Verdict{Feed: f.Name(), Malicious: true, Tags: []string{f.tag}}, nil
+}
+
+// newIntelServer returns the server of the tarpit flagging the tag, with the
+// threat intelligence feed.
+func newIntelServer(t *testing.T, tag string, feed enrich.Feed) *Server {
+	t.Helper()
+	l := logrus.New()
+	enricher := enrich.New(enrich.Config{CacheSize: 10})
+	// The lookups of the feed take up to a minute.
+	enricher.SetThreatIntel(enrich.NewThreatIntel([]enrich.Feed{feed}, 10, 0, time.Minute))
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enricher, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Server{
+		EventLogger: eventLogger,
+		Logger:      l,
+		Tarpit:      NewTarpit(config.TarpitConfig{Enabled: true, Tags: []string{tag}}),
+	}
+}
+
+func TestTarpitFlaggedKeepsTags(t *testing.T) {
+	s := newIntelServer(t, "test:scanner", intelFeed{tag: "test:scanner"})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "127.0.0.1:49152"
+	// The tags of the request get spare capacity.
+	ctx := r.Context()
+	for tags := logger.TagsFrom(ctx); cap(tags) == len(tags); tags = logger.TagsFrom(ctx) {
+		ctx = logger.WithTags(ctx, "tag")
+	}
+	r = r.WithContext(ctx)
+	tags := logger.TagsFrom(ctx)
+
+	if !s.flagged(r) {
+		t.Fatal("Expected the source tagged by the threat intelligence to be flagged")
+	}
+	if spare := tags[len(tags):cap(tags)]; spare[0] != "" {
+		t.Errorf("Expected the tags of the request to be kept, got %q written after them", spare[0])
+	}
+}
+
+func TestTarpitFlaggedIntelTimeout(t *testing.T) {
+	s := newIntelServer(t, "test:scanner", intelFeed{block: true})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "127.0.0.1:49152"
+	start := time.Now()
+	if s.flagged(r) {
+		t.Error("Expected the source without verdict not to be flagged")
+	}
+	if elapsed := time.Since(start); elapsed > tarpitIntelTimeout+time.Second {
+		t.Errorf("Expected the lookup to time out after %s, took %s", tarpitIntelTimeout, elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	cancel()
+	start = time.Now()
+	if s.flagged(r.WithContext(ctx)) {
+		t.Error("Expected the source of the canceled request not to be flagged")
+	}
+	if elapsed := time.Since(start); elapsed > tarpitIntelTimeout/2 {
+		t.Errorf("Expected the lookup to stop with the canceled request, took %s", elapsed)
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/0x4d31/galah/internal/cache"
+)
+
+// responseLatency returns the artificial latency of the response to the
+// request, 0 if none is configured.
+func (s *Server) responseLatency(r *http.Request) time.Duration {
+	cfg := s.Config.ResponseLatency
+	base, jitter := cfg.Base, cfg.Jitter
+	for _, pl := range cfg.Paths {
+		if cache.MatchPath(pl.Path, r.URL.Path) {
+			base, jitter = pl.Base, pl.Jitter
+			break
+		}
+	}
+	if jitter > 0 {
+		base += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	return base
+}
+
+// delayResponse returns the writer delaying the response to the request
+// until its artificial latency after start, if any. The write deadline is
+// pushed out by the latency, past the deadline of the request (or the write
+// timeout without one), so that the latency and the generation fit in it.
+func (s *Server) delayResponse(w http.ResponseWriter, r *http.Request, start time.Time) http.ResponseWriter {
+	latency := s.responseLatency(r)
+	if latency <= 0 {
+		return w
+	}
+	timeout := s.Config.Deadline.RequestTimeout
+	if timeout <= 0 {
+		timeout = writeTimeout
+	}
+	_ = http.NewResponseController(w).SetWriteDeadline(start.Add(latency + timeout + writeTimeout))
+	return &delayWriter{ResponseWriter: w, ctx: r.Context(), at: start.Add(latency)}
+}
+
+// delayWriter delays the header of the response, and so its body, until at,
+// or the end of the request.
+type delayWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	at          time.Time
+	wroteHeader bool
+}
+
+func (w *delayWriter) wait() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if d := time.Until(w.at); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-w.ctx.Done():
+		}
+	}
+}
+
+func (w *delayWriter) WriteHeader(code int) {
+	// The interim responses aren't delayed.
+	if code >= 100 && code < 200 {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wait()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *delayWriter) Write(p []byte) (int, error) {
+	w.wait()
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *delayWriter) Flush() {
+	w.wait()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *delayWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
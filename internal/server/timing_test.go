@@ -0,0 +1,79 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+)
+
+func TestResponseLatency(t *testing.T) {
+	s := &Server{Config: &config.Config{ResponseLatency: config.LatencyProfileConfig{
+		Base:   100 * time.Millisecond,
+		Jitter: 50 * time.Millisecond,
+		Paths: []config.PathLatencyConfig{
+			{Path: "/api/*", Base: 20 * time.Millisecond},
+		},
+	}}}
+	for i := 0; i < 20; i++ {
+		if got := s.responseLatency(httptest.NewRequest("GET", "/index.php", nil)); got < 100*time.Millisecond || got >= 150*time.Millisecond {
+			t.Fatalf("Expected the latency within the jitter of the base, got %s", got)
+		}
+	}
+	if got := s.responseLatency(httptest.NewRequest("GET", "/api/users", nil)); got != 20*time.Millisecond {
+		t.Errorf("Expected the latency of the path, got %s", got)
+	}
+}
+
+func TestDelayResponse(t *testing.T) {
+	s := &Server{Config: &config.Config{ResponseLatency: config.LatencyProfileConfig{Base: 80 * time.Millisecond}}}
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	w := s.delayResponse(rec, httptest.NewRequest("GET", "/", nil), start)
+	w.WriteHeader(100)
+	if elapsed := time.Since(start); elapsed >= 80*time.Millisecond {
+		t.Errorf("Expected the interim response not delayed, took %s", elapsed)
+	}
+	w.Write([]byte("ok"))
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Expected the response delayed by the latency, took %s", elapsed)
+	}
+
+	// The responses ready after their latency aren't delayed further.
+	start = time.Now().Add(-time.Second)
+	w = s.delayResponse(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), start)
+	before := time.Now()
+	w.WriteHeader(200)
+	if elapsed := time.Since(before); elapsed > 20*time.Millisecond {
+		t.Errorf("Expected the late response not delayed, took %s", elapsed)
+	}
+
+	s.Config.ResponseLatency = config.LatencyProfileConfig{}
+	if w := s.delayResponse(rec, httptest.NewRequest("GET", "/", nil), time.Now()); w != rec {
+		t.Error("Expected the writer unchanged without latency")
+	}
+}
+
+func TestDelayResponseOutlastsWriteTimeout(t *testing.T) {
+	s := &Server{Config: &config.Config{ResponseLatency: config.LatencyProfileConfig{Base: 300 * time.Millisecond}}}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = s.delayResponse(w, r, time.Now())
+		w.Write([]byte("ok"))
+	}))
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, err := io.ReadAll(resp.Body); err != nil || string(body) != "ok" {
+		t.Errorf("Expected the delayed response past the write timeout, got %q, %v", body, err)
+	}
+}
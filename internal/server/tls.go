@@ -0,0 +1,124 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/0x4d31/galah/internal/certs"
+	"github.com/0x4d31/galah/internal/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// defaultACMECacheDir is the directory of the ACME account and certificates
+// if not configured.
+const defaultACMECacheDir = "cert/acme"
+
+// newTLSConfigs returns the TLS configurations of the TLS profiles used by the
+// ports, for the profiles that obtain their certificates on the fly. They are
+// shared by the ports using the same profile, and must be cloned for each
+// server.
+func (s *Server) newTLSConfigs() (map[string]*tls.Config, error) {
+	configs := make(map[string]*tls.Config)
+	for _, pc := range s.Config.Ports {
+		if pc.Protocol != "TLS" || configs[pc.TLSProfile] != nil {
+			continue
+		}
+		tc, ok := s.Config.Profiles[pc.TLSProfile]
+		if !ok {
+			continue
+		}
+		tlsConfig, err := s.newTLSConfig(pc.TLSProfile, tc)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig != nil {
+			configs[pc.TLSProfile] = tlsConfig
+		}
+	}
+	return configs, nil
+}
+
+// newTLSConfig returns the TLS configuration of the profile, or nil if it
+// only serves its certificate. The certificates are obtained from the ACME CA
+// for its domains, then generated for the other server names; the profile's
+// certificate is served to the other clients.
+func (s *Server) newTLSConfig(name string, tc config.TLSConfig) (*tls.Config, error) {
+	if !tc.Generate && len(tc.ACME.Domains) == 0 {
+		return nil, nil
+	}
+
+	var fallback *tls.Certificate
+	if tc.Certificate != "" && tc.Key != "" {
+		cert, err := tls.LoadX509KeyPair(tc.Certificate, tc.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the certificate of TLS profile %s: %s", name, err)
+		}
+		fallback = &cert
+	}
+	var generator *certs.Generator
+	if tc.Generate {
+		var err error
+		if generator, err = certs.NewGenerator(tc.CA, fallback); err != nil {
+			return nil, fmt.Errorf("error initializing the certificate generator of TLS profile %s: %s", name, err)
+		}
+	}
+	var manager *autocert.Manager
+	if len(tc.ACME.Domains) > 0 {
+		manager = newACMEManager(tc.ACME)
+	}
+
+	// The HTTP protocols are added by the HTTP server.
+	tlsConfig := &tls.Config{}
+	if manager != nil {
+		tlsConfig.NextProtos = []string{acme.ALPNProto}
+	}
+	tlsConfig.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if manager != nil {
+			cert, err := manager.GetCertificate(hello)
+			if err == nil || generator == nil && fallback == nil {
+				return cert, err
+			}
+			if isACMEDomain(tc.ACME.Domains, hello.ServerName) {
+				s.Logger.Errorf("error obtaining the certificate of %s: %s", hello.ServerName, err)
+			}
+		}
+		if generator != nil {
+			return generator.GetCertificate(hello)
+		}
+		if fallback != nil {
+			return fallback, nil
+		}
+		return nil, errors.New("no certificate for the server name")
+	}
+	return tlsConfig, nil
+}
+
+// newACMEManager returns the manager of the certificates of the ACME domains.
+func newACMEManager(ac config.ACMEConfig) *autocert.Manager {
+	cacheDir := ac.CacheDir
+	if cacheDir == "" {
+		cacheDir = defaultACMECacheDir
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		HostPolicy: autocert.HostWhitelist(ac.Domains...),
+		Email:      ac.Email,
+	}
+	if ac.DirectoryURL != "" {
+		m.Client = &acme.Client{DirectoryURL: ac.DirectoryURL}
+	}
+	return m
+}
+
+func isACMEDomain(domains []string, name string) bool {
+	for _, d := range domains {
+		if strings.EqualFold(d, name) {
+			return true
+		}
+	}
+	return false
+}
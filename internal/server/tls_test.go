@@ -0,0 +1,44 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	s := &Server{Logger: logrus.New()}
+
+	tlsConfig, err := s.newTLSConfig("static", config.TLSConfig{Certificate: "cert.pem", Key: "key.pem"})
+	if err != nil || tlsConfig != nil {
+		t.Errorf("Expected no TLS configuration for a static certificate, got %v, %v", tlsConfig, err)
+	}
+
+	tlsConfig, err = s.newTLSConfig("acme", config.TLSConfig{
+		Generate: true,
+		ACME:     config.ACMEConfig{Domains: []string{"www.example.com"}, CacheDir: t.TempDir()},
+	})
+	if err != nil {
+		t.Fatalf("newTLSConfig() error = %v", err)
+	}
+	if protos := tlsConfig.NextProtos; len(protos) != 1 || protos[0] != acme.ALPNProto {
+		t.Errorf("Expected the ACME ALPN protocol to be offered, got %v", protos)
+	}
+
+	// The server names other than the ACME domains get generated certificates.
+	cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: "mail.example.org"})
+	if err != nil {
+		t.Fatalf("GetCertificate() error = %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.VerifyHostname("mail.example.org"); err != nil {
+		t.Errorf("Expected a certificate for mail.example.org, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+)
+
+// uploadTag tags the events of the requests with captured uploads.
+const uploadTag = "upload"
+
+// Default settings of the capture of the uploads.
+const (
+	defaultUploadsDirectory   = "uploads"
+	defaultUploadsMaxFileSize = 10 << 20
+	defaultUploadsMaxFiles    = 10
+)
+
+// Uploads stores the files uploaded in multipart requests (see
+// config.UploadsConfig).
+type Uploads struct {
+	cfg config.UploadsConfig
+}
+
+// NewUploads returns the capture of the uploads of the configuration, creating
+// its directory, or nil if disabled.
+func NewUploads(cfg config.UploadsConfig) (*Uploads, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.Directory == "" {
+		cfg.Directory = defaultUploadsDirectory
+	}
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = defaultUploadsMaxFileSize
+	}
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = defaultUploadsMaxFiles
+	}
+	if err := os.MkdirAll(cfg.Directory, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating the uploads directory: %w", err)
+	}
+	return &Uploads{cfg: cfg}, nil
+}
+
+// captureUploads stores the files uploaded in the multipart request and
+// returns the request referencing them in its event. The body is restored so
+// it can be read again.
+func (s *Server) captureUploads(r *http.Request) *http.Request {
+	if s.Uploads == nil || r.Body == nil || r.Body == http.NoBody {
+		return r
+	}
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return r
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		s.Logger.Errorf("error reading the multipart body of %s: %s", r.RemoteAddr, err)
+		return r
+	}
+
+	artifacts, err := s.Uploads.capture(multipart.NewReader(bytes.NewReader(body), params["boundary"]))
+	if err != nil {
+		// The truncated or malformed bodies are common in attacks, the parts
+		// read before the error are kept.
+		s.Logger.Infof("error parsing the multipart body of %s: %s", r.RemoteAddr, err)
+	}
+	if len(artifacts) == 0 {
+		return r
+	}
+	s.Logger.Infof("captured %d uploaded files from %s", len(artifacts), r.RemoteAddr)
+	ctx := logger.WithArtifacts(r.Context(), artifacts)
+	return r.WithContext(logger.WithTags(ctx, uploadTag))
+}
+
+// capture stores the file parts of the multipart body, and returns them.
+func (u *Uploads) capture(mr *multipart.Reader) ([]logger.Artifact, error) {
+	var artifacts []logger.Artifact
+	for len(artifacts) < u.cfg.MaxFiles {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return artifacts, nil
+		}
+		if err != nil {
+			return artifacts, err
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		a, err := u.store(part)
+		if err != nil {
+			return artifacts, err
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, nil
+}
+
+// store hashes the part and stores it, if within the size limit, in a file
+// named by its hash. The files are written without their extension for they
+// aren't executed or served by mistake.
+func (u *Uploads) store(part *multipart.Part) (logger.Artifact, error) {
+	a := logger.Artifact{
+		Field:       part.FormName(),
+		Filename:    part.FileName(),
+		ContentType: part.Header.Get("Content-Type"),
+	}
+	// The filename is logged as sent, with the path traversals of the attacks,
+	// which FileName removes.
+	if _, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		a.Filename = params["filename"]
+	}
+	tmp, err := os.CreateTemp(u.cfg.Directory, ".upload-*")
+	if err != nil {
+		return a, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	// The part is stored up to one byte beyond the limit, and only hashed
+	// after it.
+	stored, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(part, u.cfg.MaxFileSize+1))
+	if err != nil {
+		return a, err
+	}
+	rest, err := io.Copy(hash, part)
+	if err != nil {
+		return a, err
+	}
+	a.Size = stored + rest
+	a.Sha256 = hex.EncodeToString(hash.Sum(nil))
+	if a.Size > u.cfg.MaxFileSize {
+		return a, nil
+	}
+
+	if err := tmp.Close(); err != nil {
+		return a, err
+	}
+	path := filepath.Join(u.cfg.Directory, a.Sha256)
+	if _, err := os.Stat(path); err != nil {
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			return a, err
+		}
+	}
+	a.Path = path
+	return a, nil
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCaptureUploads(t *testing.T) {
+	dir := t.TempDir()
+	uploads, err := NewUploads(config.UploadsConfig{Enabled: true, Directory: dir, MaxFileSize: 16, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Logger: logrus.New(), Uploads: uploads}
+
+	shell := "<?php system($_GET['c']); ?>"[:16]
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("submit", "Upload")
+	fw, _ := mw.CreateFormFile("file", "../../shell.php")
+	fw.Write([]byte(shell))
+	fw, _ = mw.CreateFormFile("big", "big.bin")
+	fw.Write([]byte(strings.Repeat("A", 17)))
+	fw, _ = mw.CreateFormFile("third", "ignored.txt")
+	fw.Write([]byte("beyond max_files"))
+	mw.Close()
+	raw := body.String()
+
+	r := httptest.NewRequest("POST", "/upload.php", strings.NewReader(raw))
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r = s.captureUploads(r)
+
+	if rest, _ := io.ReadAll(r.Body); string(rest) != raw {
+		t.Errorf("Expected the body restored")
+	}
+	if tags := logger.TagsFrom(r.Context()); len(tags) != 1 || tags[0] != uploadTag {
+		t.Errorf("Expected the request tagged %q, got %v", uploadTag, tags)
+	}
+	artifacts := logger.ArtifactsFrom(r.Context())
+	if len(artifacts) != 2 {
+		t.Fatalf("Expected 2 artifacts, got %+v", artifacts)
+	}
+
+	hash := sha256.Sum256([]byte(shell))
+	a := artifacts[0]
+	if a.Field != "file" || a.Filename != "../../shell.php" || a.Size != 16 || a.Sha256 != hex.EncodeToString(hash[:]) {
+		t.Errorf("Unexpected artifact %+v", a)
+	}
+	if data, err := os.ReadFile(a.Path); err != nil || string(data) != shell {
+		t.Errorf("Expected the file stored at %q, got %q, %v", a.Path, data, err)
+	}
+	if big := artifacts[1]; big.Size != 17 || big.Path != "" || big.Sha256 == "" {
+		t.Errorf("Expected the oversized file hashed but not stored, got %+v", big)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the stored file in the directory, got %v", entries)
+	}
+}
+
+func TestCaptureUploadsNotMultipart(t *testing.T) {
+	uploads, err := NewUploads(config.UploadsConfig{Enabled: true, Directory: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Logger: logrus.New(), Uploads: uploads}
+
+	r := httptest.NewRequest("POST", "/login", strings.NewReader("user=admin"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if got := s.captureUploads(r); got != r {
+		t.Errorf("Expected the request unchanged")
+	}
+}
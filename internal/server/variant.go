@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+// defaultVariant is the prompt variant of the sources not assigned to a
+// configured variant, which keep the configured prompts.
+const defaultVariant = "default"
+
+// ValidatePromptVariants checks that the prompt variants are named uniquely
+// and that their weights add up to at most 100 percent.
+func ValidatePromptVariants(variants []config.PromptVariantConfig) error {
+	names := make(map[string]bool)
+	total := 0
+	for _, v := range variants {
+		switch {
+		case v.Name == "":
+			return fmt.Errorf("prompt variant without a name")
+		case v.Name == defaultVariant || names[v.Name]:
+			return fmt.Errorf("duplicate prompt variant %q", v.Name)
+		case v.Weight < 0:
+			return fmt.Errorf("negative weight of prompt variant %q", v.Name)
+		}
+		names[v.Name] = true
+		total += v.Weight
+	}
+	if total > 100 {
+		return fmt.Errorf("the weights of the prompt variants add up to %d%%, more than 100%%", total)
+	}
+	return nil
+}
+
+// promptVariant returns the variant assigned to the source, the same for
+// all its requests, or nil if it keeps the configured prompts.
+func promptVariant(variants []config.PromptVariantConfig, source string) *config.PromptVariantConfig {
+	h := fnv.New32a()
+	h.Write([]byte(source))
+	bucket := int(h.Sum32() % 100)
+	for i, v := range variants {
+		if bucket < v.Weight {
+			return &variants[i]
+		}
+		bucket -= v.Weight
+	}
+	return nil
+}
+
+// withPromptVariant returns the server using the prompts of the variant
+// assigned to the source of the request, and the request carrying the name
+// of the variant, if prompt variants are configured.
+func (s *Server) withPromptVariant(r *http.Request) (*Server, *http.Request) {
+	if len(s.Config.PromptVariants) == 0 {
+		return s, r
+	}
+	return s.usePromptVariant(r, promptVariant(s.Config.PromptVariants, llm.SourceIP(r)))
+}
+
+// usePromptVariant returns the server using the prompts of the variant, or
+// the configured prompts if nil, and the request carrying its name.
+func (s *Server) usePromptVariant(r *http.Request, v *config.PromptVariantConfig) (*Server, *http.Request) {
+	if v == nil {
+		return s, r.WithContext(logger.WithPromptVariant(r.Context(), defaultVariant))
+	}
+	cfg := *s.Config
+	if v.SystemPrompt != "" {
+		cfg.SystemPrompt = v.SystemPrompt
+	}
+	if v.UserPrompt != "" {
+		cfg.UserPrompt = v.UserPrompt
+	}
+	vs := *s
+	vs.Config = &cfg
+	return &vs, r.WithContext(logger.WithPromptVariant(r.Context(), v.Name))
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+)
+
+func TestPromptVariant(t *testing.T) {
+	variants := []config.PromptVariantConfig{
+		{Name: "a", Weight: 30},
+		{Name: "b", Weight: 20},
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		source := fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+		name := defaultVariant
+		if v := promptVariant(variants, source); v != nil {
+			name = v.Name
+		}
+		counts[name]++
+		if again := promptVariant(variants, source); (again == nil) != (name == defaultVariant) || again != nil && again.Name != name {
+			t.Fatalf("Expected the same variant for the source %s", source)
+		}
+	}
+	for name, want := range map[string]int{"a": 3000, "b": 2000, defaultVariant: 5000} {
+		if got := counts[name]; got < want*9/10 || got > want*11/10 {
+			t.Errorf("Expected about %d sources assigned to %s, got %d", want, name, got)
+		}
+	}
+}
+
+func TestWithPromptVariant(t *testing.T) {
+	s := &Server{Config: &config.Config{
+		SystemPrompt: "default system",
+		UserPrompt:   "default user %q",
+		PromptVariants: []config.PromptVariantConfig{
+			{Name: "terse", Weight: 100, SystemPrompt: "terse system"},
+		},
+	}}
+	r := httptest.NewRequest("GET", "/", nil)
+	vs, vr := s.withPromptVariant(r)
+	if vs.Config.SystemPrompt != "terse system" || vs.Config.UserPrompt != "default user %q" {
+		t.Errorf("Expected the system prompt of the variant, got %q and %q", vs.Config.SystemPrompt, vs.Config.UserPrompt)
+	}
+	if s.Config.SystemPrompt != "default system" {
+		t.Errorf("Expected the configuration unchanged, got %q", s.Config.SystemPrompt)
+	}
+	if got := logger.PromptVariantFrom(vr.Context()); got != "terse" {
+		t.Errorf("Expected the request of the variant terse, got %q", got)
+	}
+	if vs.cacheKey(vr, "8080") == s.cacheKey(r, "8080") {
+		t.Error("Expected the responses of the variant cached apart")
+	}
+
+	s.Config.PromptVariants[0].Weight = 0
+	vs, vr = s.withPromptVariant(r)
+	if vs != s || logger.PromptVariantFrom(vr.Context()) != defaultVariant {
+		t.Errorf("Expected the default variant, got %q", logger.PromptVariantFrom(vr.Context()))
+	}
+}
+
+func TestValidatePromptVariants(t *testing.T) {
+	tests := []struct {
+		name     string
+		variants []config.PromptVariantConfig
+		wantErr  bool
+	}{
+		{name: "valid", variants: []config.PromptVariantConfig{{Name: "a", Weight: 50}, {Name: "b", Weight: 50}}},
+		{name: "noName", variants: []config.PromptVariantConfig{{Weight: 10}}, wantErr: true},
+		{name: "duplicate", variants: []config.PromptVariantConfig{{Name: "a"}, {Name: "a"}}, wantErr: true},
+		{name: "default", variants: []config.PromptVariantConfig{{Name: defaultVariant}}, wantErr: true},
+		{name: "overweight", variants: []config.PromptVariantConfig{{Name: "a", Weight: 60}, {Name: "b", Weight: 50}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePromptVariants(tt.variants); (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePromptVariants() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+)
+
+// DefaultWarmupPaths are the paths commonly probed by the scanners, whose
+// responses are generated by the warm-up unless other paths are given.
+var DefaultWarmupPaths = []string{
+	"/",
+	"/robots.txt",
+	"/favicon.ico",
+	"/sitemap.xml",
+	"/.env",
+	"/.git/config",
+	"/.aws/credentials",
+	"/admin",
+	"/login",
+	"/wp-login.php",
+	"/wp-admin/",
+	"/xmlrpc.php",
+	"/phpmyadmin/",
+	"/phpinfo.php",
+	"/server-status",
+	"/config.json",
+	"/api",
+	"/api/v1/users",
+	"/actuator/health",
+	"/actuator/env",
+	"/console",
+	"/manager/html",
+	"/cgi-bin/",
+	"/HNAP1",
+	"/boaform/admin/formLogin",
+	"/vendor/phpunit/phpunit/src/Util/PHP/eval-stdin.php",
+}
+
+// The results of the warm-up of a request.
+const (
+	WarmupGenerated = "generated"
+	WarmupCached    = "cached"
+	WarmupStatic    = "static"
+)
+
+// errCacheDisabled is the error of the warm-up of the requests whose
+// responses aren't cached.
+var errCacheDisabled = errors.New("the responses of the request aren't cached")
+
+// Warmup generates and caches the responses to the request, as if received
+// on the port, with the prompts of each prompt variant, so that the first
+// requests are answered from the cache. The responses already cached aren't
+// generated again unless force is true, and the requests answered by a
+// static rule or artifact are skipped. It returns the results of the variants.
+func (s *Server) Warmup(r *http.Request, port uint16, force bool) ([]string, error) {
+	ps := s.forRequest(port, r)
+	if ps.Rules.match(r) != nil || ps.StaticArtifacts.lookup(r) != nil {
+		return []string{WarmupStatic}, nil
+	}
+	var variants []*config.PromptVariantConfig
+	total := 0
+	for i, v := range ps.Config.PromptVariants {
+		if v.Weight > 0 {
+			variants = append(variants, &ps.Config.PromptVariants[i])
+			total += v.Weight
+		}
+	}
+	// The configured prompts are used unless the variants take all the
+	// sources.
+	if total < 100 {
+		variants = append([]*config.PromptVariantConfig{nil}, variants...)
+	}
+
+	p := strconv.Itoa(int(port))
+	var results []string
+	for _, v := range variants {
+		vs, vr := ps.usePromptVariant(r, v)
+		vr = vs.tagEmulations(vr)
+		vs, vr = vs.routeModel(vr)
+		ttl := vs.cacheTTL(vr)
+		if ttl == 0 {
+			return results, errCacheDisabled
+		}
+		if !force {
+			if resp, _ := cache.CheckKeyTTL(vs.Cache, vs.cacheKey(vr, p), ttl); resp != nil {
+				results = append(results, WarmupCached)
+				continue
+			}
+		}
+		if _, _, _, err := vs.generateResponse(vr, p); err != nil {
+			return results, err
+		}
+		results = append(results, WarmupGenerated)
+	}
+	return results, nil
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/cache"
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+)
+
+func TestWarmup(t *testing.T) {
+	db, err := cache.InitializeCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rules, err := NewStaticRules([]config.StaticRuleConfig{{Name: "dotenv", Paths: []string{"/.env"}, Body: "Forbidden"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model := &sequenceModel{results: []any{validResponse}}
+	s := &Server{
+		Cache:         db,
+		CacheDuration: 24,
+		Config:        &config.Config{SystemPrompt: "web server", UserPrompt: "%q"},
+		LLMConfig:     llm.Config{Provider: "openai", Model: "gpt-4o"},
+		Logger:        logrus.New(),
+		Model:         model,
+		Rules:         rules,
+	}
+	warmup := func(target string, force bool) []string {
+		t.Helper()
+		results, err := s.Warmup(httptest.NewRequest("GET", target, nil), 8080, force)
+		if err != nil {
+			t.Fatalf("Warmup(%q) error = %v", target, err)
+		}
+		return results
+	}
+
+	if got := warmup("/admin", false); !reflect.DeepEqual(got, []string{WarmupGenerated}) || model.calls != 1 {
+		t.Errorf("Expected the response generated, got %v after %d calls", got, model.calls)
+	}
+	if got := warmup("/admin", false); !reflect.DeepEqual(got, []string{WarmupCached}) || model.calls != 1 {
+		t.Errorf("Expected the cached response kept, got %v after %d calls", got, model.calls)
+	}
+	if got := warmup("/admin", true); !reflect.DeepEqual(got, []string{WarmupGenerated}) || model.calls != 2 {
+		t.Errorf("Expected the response generated again, got %v after %d calls", got, model.calls)
+	}
+	if got := warmup("/.env", false); !reflect.DeepEqual(got, []string{WarmupStatic}) || model.calls != 2 {
+		t.Errorf("Expected the static rule skipped, got %v after %d calls", got, model.calls)
+	}
+
+	// Each prompt variant has its own cached response, and the configured
+	// prompts are skipped once the variants take all the sources.
+	s.Config.PromptVariants = []config.PromptVariantConfig{
+		{Name: "terse", Weight: 50, SystemPrompt: "terse web server"},
+		{Name: "verbose", Weight: 50, SystemPrompt: "verbose web server"},
+	}
+	if got := warmup("/login", false); !reflect.DeepEqual(got, []string{WarmupGenerated, WarmupGenerated}) {
+		t.Errorf("Expected the responses of both variants generated, got %v", got)
+	}
+	s.Config.PromptVariants[1].Weight = 0
+	if got := warmup("/login", false); !reflect.DeepEqual(got, []string{WarmupGenerated, WarmupCached}) {
+		t.Errorf("Expected the configured prompts and the cached variant, got %v", got)
+	}
+
+	s.Cache = nil
+	if _, err := s.Warmup(httptest.NewRequest("GET", "/admin", nil), 8080, false); err == nil {
+		t.Error("Expected an error without a cache")
+	}
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/llm"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// defaultWebSocketMessages is the number of client messages of a session
+	// if not configured.
+	defaultWebSocketMessages = 50
+	// defaultWebSocketIdle is the idle timeout of a session if not configured.
+	defaultWebSocketIdle = time.Minute
+	// webSocketTag is the event tag of the WebSocket sessions.
+	webSocketTag = "websocket"
+)
+
+// WebSocketSessions tracks the open WebSocket sessions, whose hijacked
+// connections aren't tracked by the HTTP servers, to close them on shutdown.
+// The nil WebSocketSessions tracks nothing.
+type WebSocketSessions struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewWebSocketSessions returns the tracker of the WebSocket sessions.
+func NewWebSocketSessions() *WebSocketSessions {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebSocketSessions{ctx: ctx, cancel: cancel}
+}
+
+// open registers a session on conn, closed when the sessions are closed. It
+// returns the context of the session, canceled when the sessions are closed,
+// the function to call when the session ends, and false if the sessions are
+// already closed.
+func (ws *WebSocketSessions) open(ctx context.Context, conn *websocket.Conn) (context.Context, func(), bool) {
+	if ws == nil {
+		return ctx, func() {}, true
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed {
+		return nil, nil, false
+	}
+	ws.wg.Add(1)
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(ws.ctx, func() {
+		cancel()
+		conn.Close()
+	})
+	return ctx, func() {
+		stop()
+		cancel()
+		ws.wg.Done()
+	}, true
+}
+
+// Close cancels the generations of the open sessions, closes their
+// connections and waits for them to end, up to the deadline of ctx. The
+// sessions opened after are closed right away.
+func (ws *WebSocketSessions) Close(ctx context.Context) error {
+	if ws == nil {
+		return nil
+	}
+	ws.mu.Lock()
+	ws.closed = true
+	ws.mu.Unlock()
+	ws.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		ws.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handleWebSocket accepts WebSocket upgrade requests, if enabled, and serves
+// the session. It returns true if the request has been answered.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request, port string) bool {
+	if !s.Config.WebSocket.Enabled || !isWebSocketUpgrade(r) {
+		return false
+	}
+
+	r = r.WithContext(logger.WithTags(r.Context(), webSocketTag))
+	ws := websocket.Server{
+		// Any origin is accepted, and the first subprotocol offered by the
+		// client is selected.
+		Handshake: func(c *websocket.Config, _ *http.Request) error {
+			if len(c.Protocol) > 1 {
+				c.Protocol = c.Protocol[:1]
+			}
+			return nil
+		},
+		Handler: func(conn *websocket.Conn) {
+			s.serveWebSocket(conn, r, port)
+		},
+	}
+	ws.ServeHTTP(w, r)
+	return true
+}
+
+// serveWebSocket answers the messages of the client until the session is
+// closed, idle or reaches the maximum number of messages.
+func (s *Server) serveWebSocket(conn *websocket.Conn, r *http.Request, port string) {
+	defer conn.Close()
+	// The session outlives the deadline of the upgrade request, until the
+	// shutdown.
+	ctx, done, ok := s.WebSockets.open(context.WithoutCancel(r.Context()), conn)
+	if !ok {
+		return
+	}
+	defer done()
+	r = r.WithContext(ctx)
+
+	maxMessages := s.Config.WebSocket.MaxMessages
+	if maxMessages <= 0 {
+		maxMessages = defaultWebSocketMessages
+	}
+	idle := s.Config.WebSocket.IdleTimeout
+	if idle <= 0 {
+		idle = defaultWebSocketIdle
+	}
+
+	s.Logger.Infof("opened a WebSocket session with %s on %q", r.RemoteAddr, r.URL.String())
+	s.EventLogger.LogEvent(r, llm.JSONResponse{StatusCode: http.StatusSwitchingProtocols}, port)
+
+	var transcript []llm.WebSocketMessage
+	for i := 0; i < maxMessages; i++ {
+		// The deadlines of the HTTP server still apply to the hijacked
+		// connection.
+		if err := conn.SetDeadline(time.Now().Add(idle)); err != nil {
+			return
+		}
+		var message string
+		if err := websocket.Message.Receive(conn, &message); err != nil {
+			return
+		}
+		// Each message needing a generation counts towards the rate of
+		// the source, the session being closed once it is over.
+		if s.RateLimiter != nil {
+			if err := s.allowRate(r); err != nil {
+				s.Logger.Infof("closing the WebSocket session with %s, rate limited: %s", r.RemoteAddr, err)
+				s.EventLogger.LogWebSocketMessage(r.WithContext(logger.WithTags(r.Context(), rateLimitedTag)), port, message, nil)
+				return
+			}
+		}
+		transcript = append(transcript, llm.WebSocketMessage{FromClient: true, Data: message})
+
+		replies, err := s.generateWebSocketReplies(r, transcript)
+		if err != nil {
+			s.Logger.Errorf("error generating the WebSocket replies: %s", err)
+			s.EventLogger.LogError(r, "", port, http.StatusSwitchingProtocols, err)
+			return
+		}
+		s.EventLogger.LogWebSocketMessage(r, port, message, replies)
+		for _, reply := range replies {
+			if err := websocket.Message.Send(conn, reply); err != nil {
+				return
+			}
+			transcript = append(transcript, llm.WebSocketMessage{Data: reply})
+		}
+	}
+	s.Logger.Infof("closing the WebSocket session with %s after %d messages", r.RemoteAddr, maxMessages)
+}
+
+// generateWebSocketReplies generates the replies to the last message of the
+// transcript.
+func (s *Server) generateWebSocketReplies(r *http.Request, transcript []llm.WebSocketMessage) ([]string, error) {
+	messages, err := llm.CreateWebSocketMessages(r, s.Config, transcript)
+	if err != nil {
+		return nil, err
+	}
+	if s.Limiter != nil {
+		release, err := s.Limiter.Acquire(r.Context(), llm.SourceIP(r))
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+	return llm.GenerateWebSocketReplies(r.Context(), s.Model, s.LLMConfig, messages)
+}
+
+// isWebSocketUpgrade reports whether the request asks for an upgrade to the
+// WebSocket protocol.
+func isWebSocketUpgrade(r *http.Request) bool {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
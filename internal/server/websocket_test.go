@@ -0,0 +1,122 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/internal/logger"
+	"github.com/0x4d31/galah/pkg/enrich"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+func TestHandleWebSocket(t *testing.T) {
+	l := logrus.New()
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := &sequenceModel{results: []any{`{"messages": ["{\"type\":\"welcome\"}", "{\"type\":\"status\",\"online\":3}"]}`, `{"messages": []}`}}
+	s := &Server{
+		Config:      &config.Config{WebSocket: config.WebSocketConfig{Enabled: true, MaxMessages: 2}},
+		EventLogger: eventLogger,
+		LLMConfig:   llm.Config{Provider: "openai"},
+		Logger:      l,
+		Model:       model,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.handleWebSocket(w, r, "8080") {
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	if resp, err := http.Get(ts.URL + "/ws"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected requests without upgrade to be left to the handler, got %v", err)
+	}
+
+	conn, err := websocket.Dial(strings.Replace(ts.URL, "http", "ws", 1)+"/ws", "chat", "http://evil.example")
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	if err := websocket.Message.Send(conn, `{"type":"hello"}`); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`{"type":"welcome"}`, `{"type":"status","online":3}`} {
+		var got string
+		if err := websocket.Message.Receive(conn, &got); err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+
+	// The session is closed after the maximum number of messages.
+	if err := websocket.Message.Send(conn, "ping"); err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	if err := websocket.Message.Receive(conn, &got); err == nil {
+		t.Errorf("Expected the session to be closed, got %q", got)
+	}
+	if model.calls != 2 {
+		t.Errorf("Expected 2 generations, got %d", model.calls)
+	}
+}
+
+func TestWebSocketRateLimit(t *testing.T) {
+	l := logrus.New()
+	eventLogger, err := logger.New(filepath.Join(t.TempDir(), "event_log.json"), llm.Config{}, enrich.New(enrich.Config{CacheSize: 1}), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rateLimiter, err := NewRateLimiter(config.RateLimitConfig{RequestsPerMinute: 1, Burst: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := &sequenceModel{results: []any{`{"messages": ["pong"]}`}}
+	s := &Server{
+		Config:      &config.Config{WebSocket: config.WebSocketConfig{Enabled: true, MaxMessages: 10}},
+		EventLogger: eventLogger,
+		LLMConfig:   llm.Config{Provider: "openai"},
+		Logger:      l,
+		Model:       model,
+		RateLimiter: rateLimiter,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.handleWebSocket(w, r, "8080")
+	}))
+	defer ts.Close()
+
+	conn, err := websocket.Dial(strings.Replace(ts.URL, "http", "ws", 1)+"/ws", "", "http://evil.example")
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	if err := websocket.Message.Send(conn, "ping"); err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	if err := websocket.Message.Receive(conn, &got); err != nil || got != "pong" {
+		t.Fatalf("Expected the reply within the rate, got %q, %v", got, err)
+	}
+	// The second message is over the rate of the source.
+	if err := websocket.Message.Send(conn, "ping"); err != nil {
+		t.Fatal(err)
+	}
+	if err := websocket.Message.Receive(conn, &got); err == nil {
+		t.Errorf("Expected the session to be closed, got %q", got)
+	}
+	if model.calls != 1 {
+		t.Errorf("Expected 1 generation, got %d", model.calls)
+	}
+}
@@ -0,0 +1,390 @@
+// Package session groups the requests of the attackers into sessions, by
+// source, client fingerprint and inactivity, and scores their interactivity
+// and sophistication to flag the sessions going beyond automated scanning,
+// and the confidence that they are hands-on-keyboard activity.
+package session
+
+import (
+	"math"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Default settings of the tracker.
+const (
+	DefaultTimeout     = 30 * time.Minute
+	DefaultMaxSessions = 10000
+	DefaultThreshold   = 50
+)
+
+// Limits of the state kept per session.
+const (
+	maxPaths    = 100
+	maxVariants = 10
+	maxGaps     = 50
+)
+
+// Points of the signals of the score, out of 100.
+const (
+	pointsPerTechnique = 5
+	maxTechniquePoints = 25
+	pointsCookie       = 15
+	pointsProbing      = 20
+	pointsMethods      = 10
+	pointsPacing       = 15
+	pointsDuration     = 15
+	penaltyScanner     = 25
+)
+
+// Points of the signals of the human confidence, from the neutral
+// humanNeutral for a session without signals.
+const (
+	humanNeutral         = 50
+	humanPacingPoints    = 15
+	humanAssetPoints     = 15
+	humanCookiePoints    = 10
+	humanChallengePoints = 30
+	botPacingPenalty     = 25
+	botNoAssetPenalty    = 10
+	botScannerPenalty    = 30
+)
+
+// Thresholds of the signals.
+const (
+	probingVariants = 3
+	pacingRequests  = 5
+	minHumanGap     = time.Second
+	maxHumanGap     = 2 * time.Minute
+	longRequests    = 10
+	longDuration    = 5 * time.Minute
+	// The pacing of the automated tools: a median gap below minBotGap, or
+	// gaps varying less than maxBotVariation (their coefficient of
+	// variation), and of the humans: gaps varying at least minHumanVariation.
+	minBotGap         = 250 * time.Millisecond
+	maxBotVariation   = 0.1
+	minHumanVariation = 0.3
+	// The sessions of at least noAssetRequests requests without any asset
+	// aren't browsing the pages.
+	noAssetRequests = 10
+)
+
+// Signals of the human confidence of the sessions.
+const (
+	SignalHumanPacing     = "human_pacing"
+	SignalAutomatedPacing = "automated_pacing"
+	SignalAssets          = "assets"
+	SignalNoAssets        = "no_assets"
+	SignalCookies         = "cookies"
+	SignalJSChallenge     = "js_challenge"
+	SignalScanner         = "scanner"
+)
+
+// assetExtensions are the extensions of the assets the browsers fetch with
+// the pages.
+var assetExtensions = []string{".css", ".js", ".png", ".gif", ".jpg", ".jpeg", ".svg", ".ico", ".webp", ".woff", ".woff2"}
+
+// Config configures a Tracker. A session ends after Timeout (DefaultTimeout
+// if 0) without requests, and at most MaxSessions (DefaultMaxSessions if 0)
+// are tracked, the least recently active being dropped first. The sessions
+// scoring at least Threshold (DefaultThreshold if 0) are flagged, and
+// OnFlagged, if not nil, is called once when a session is.
+type Config struct {
+	Timeout     time.Duration
+	MaxSessions int
+	Threshold   int
+	OnFlagged   func(Info)
+}
+
+// Request is a request of a session. Fingerprint identifies the client of the
+// source (e.g. its TLS fingerprint and user agent), Variant is the query and
+// the body of the request, and Techniques are the IDs of its ATT&CK
+// techniques. Scanner is true for the known scanners and the requests of the
+// scanning tools. Referer is true for the requests with a referer, and
+// JSChallenge for the requests answering the JavaScript challenge embedded in
+// the pages, showing the client runs their scripts.
+type Request struct {
+	Source      string
+	Fingerprint string
+	Time        time.Time
+	Method      string
+	Path        string
+	Variant     string
+	Cookie      bool
+	Scanner     bool
+	Referer     bool
+	JSChallenge bool
+	Techniques  []string
+}
+
+// Info is the state of a session. Human is the confidence, from 0 to 100,
+// that the session is hands-on-keyboard activity rather than automated
+// tooling, 50 without any signal, and Signals the signals observed.
+type Info struct {
+	ID          string    `json:"id"`
+	Source      string    `json:"srcIP"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Start       time.Time `json:"start"`
+	LastSeen    time.Time `json:"lastSeen"`
+	Requests    int       `json:"requests"`
+	Score       int       `json:"score"`
+	Flagged     bool      `json:"flagged"`
+	Human       int       `json:"human"`
+	Signals     []string  `json:"signals,omitempty"`
+}
+
+type session struct {
+	info       Info
+	methods    map[string]bool
+	paths      map[string]map[string]bool
+	techniques map[string]bool
+	gaps       []time.Duration
+	cookie     bool
+	scanner    bool
+	assets     int
+	challenge  bool
+}
+
+// Tracker tracks the sessions of the requests, safe for concurrent use.
+type Tracker struct {
+	cfg Config
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// NewTracker returns the tracker of the configuration.
+func NewTracker(cfg Config) *Tracker {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxSessions <= 0 {
+		cfg.MaxSessions = DefaultMaxSessions
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = DefaultThreshold
+	}
+	return &Tracker{cfg: cfg, sessions: make(map[string]*session)}
+}
+
+// Record adds the request to the current session of its source and client,
+// or to a new session, and returns the updated state of the session.
+func (t *Tracker) Record(req Request) Info {
+	key := req.Source + "|" + req.Fingerprint
+	t.mu.Lock()
+	s, ok := t.sessions[key]
+	if !ok || req.Time.Sub(s.info.LastSeen) > t.cfg.Timeout {
+		if !ok && len(t.sessions) >= t.cfg.MaxSessions {
+			t.evict(req.Time)
+		}
+		s = &session{
+			info:       Info{ID: uuid.NewString(), Source: req.Source, Fingerprint: req.Fingerprint, Start: req.Time, LastSeen: req.Time},
+			methods:    make(map[string]bool),
+			paths:      make(map[string]map[string]bool),
+			techniques: make(map[string]bool),
+		}
+		t.sessions[key] = s
+	}
+	s.add(req)
+	wasFlagged := s.info.Flagged
+	s.info.Score = s.score()
+	s.info.Flagged = wasFlagged || s.info.Score >= t.cfg.Threshold
+	s.info.Human, s.info.Signals = s.human()
+	info := s.info
+	t.mu.Unlock()
+
+	if info.Flagged && !wasFlagged && t.cfg.OnFlagged != nil {
+		t.cfg.OnFlagged(info)
+	}
+	return info
+}
+
+// evict drops the ended sessions, or the least recently active one if none
+// has ended. It must be called with t.mu held.
+func (t *Tracker) evict(now time.Time) {
+	var oldest string
+	for key, s := range t.sessions {
+		if now.Sub(s.info.LastSeen) > t.cfg.Timeout {
+			delete(t.sessions, key)
+			continue
+		}
+		if oldest == "" || s.info.LastSeen.Before(t.sessions[oldest].info.LastSeen) {
+			oldest = key
+		}
+	}
+	if len(t.sessions) >= t.cfg.MaxSessions {
+		delete(t.sessions, oldest)
+	}
+}
+
+// Active returns the sessions active at now, highest score first.
+func (t *Tracker) Active(now time.Time) []Info {
+	t.mu.Lock()
+	sessions := make([]Info, 0, len(t.sessions))
+	for _, s := range t.sessions {
+		if now.Sub(s.info.LastSeen) <= t.cfg.Timeout {
+			sessions = append(sessions, s.info)
+		}
+	}
+	t.mu.Unlock()
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Score != sessions[j].Score {
+			return sessions[i].Score > sessions[j].Score
+		}
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions
+}
+
+// Lookup returns the state of the current session of the source and client
+// at now, and false if it has none.
+func (t *Tracker) Lookup(source, fingerprint string, now time.Time) (Info, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.sessions[source+"|"+fingerprint]
+	if !ok || now.Sub(s.info.LastSeen) > t.cfg.Timeout {
+		return Info{}, false
+	}
+	return s.info, true
+}
+
+// add records the signals of the request.
+func (s *session) add(req Request) {
+	if s.info.Requests > 0 && req.Time.After(s.info.LastSeen) {
+		s.gaps = append(s.gaps, req.Time.Sub(s.info.LastSeen))
+		if len(s.gaps) > maxGaps {
+			s.gaps = s.gaps[1:]
+		}
+	}
+	if req.Time.After(s.info.LastSeen) {
+		s.info.LastSeen = req.Time
+	}
+	s.info.Requests++
+
+	s.methods[strings.ToUpper(req.Method)] = true
+	variants, ok := s.paths[req.Path]
+	if !ok && len(s.paths) < maxPaths {
+		variants = make(map[string]bool)
+		s.paths[req.Path] = variants
+	}
+	if variants != nil && len(variants) < maxVariants {
+		variants[req.Variant] = true
+	}
+	for _, id := range req.Techniques {
+		// The reconnaissance techniques are the scanning itself.
+		if !strings.HasPrefix(id, "T1595") {
+			s.techniques[id] = true
+		}
+	}
+	// The cookies of the first request weren't set by the honeypot.
+	s.cookie = s.cookie || (req.Cookie && s.info.Requests > 1)
+	s.scanner = s.scanner || req.Scanner
+	if req.Referer && slices.Contains(assetExtensions, strings.ToLower(path.Ext(req.Path))) {
+		s.assets++
+	}
+	s.challenge = s.challenge || req.JSChallenge
+}
+
+// score returns the score of the session, from 0 to 100.
+func (s *session) score() int {
+	score := min(len(s.techniques)*pointsPerTechnique, maxTechniquePoints)
+	if s.cookie {
+		score += pointsCookie
+	}
+	for _, variants := range s.paths {
+		if len(variants) >= probingVariants {
+			score += pointsProbing
+			break
+		}
+	}
+	if len(s.methods) > 1 {
+		score += pointsMethods
+	}
+	if s.info.Requests >= pacingRequests {
+		if gap := median(s.gaps); gap >= minHumanGap && gap <= maxHumanGap {
+			score += pointsPacing
+		}
+	}
+	if s.info.Requests >= longRequests && s.info.LastSeen.Sub(s.info.Start) >= longDuration {
+		score += pointsDuration
+	}
+	if s.scanner {
+		score -= penaltyScanner
+	}
+	return max(0, min(score, 100))
+}
+
+// human returns the human confidence of the session, from 0 to 100, and the
+// signals observed.
+func (s *session) human() (int, []string) {
+	confidence := humanNeutral
+	var signals []string
+	if len(s.gaps) >= pacingRequests-1 {
+		gap, variation := median(s.gaps), variationCoefficient(s.gaps)
+		switch {
+		case gap < minBotGap || variation < maxBotVariation:
+			confidence -= botPacingPenalty
+			signals = append(signals, SignalAutomatedPacing)
+		case gap >= minHumanGap && gap <= maxHumanGap && variation >= minHumanVariation:
+			confidence += humanPacingPoints
+			signals = append(signals, SignalHumanPacing)
+		}
+	}
+	switch {
+	case s.assets > 0:
+		confidence += humanAssetPoints
+		signals = append(signals, SignalAssets)
+	case s.info.Requests >= noAssetRequests:
+		confidence -= botNoAssetPenalty
+		signals = append(signals, SignalNoAssets)
+	}
+	if s.cookie {
+		confidence += humanCookiePoints
+		signals = append(signals, SignalCookies)
+	}
+	if s.challenge {
+		confidence += humanChallengePoints
+		signals = append(signals, SignalJSChallenge)
+	}
+	if s.scanner {
+		confidence -= botScannerPenalty
+		signals = append(signals, SignalScanner)
+	}
+	return max(0, min(confidence, 100)), signals
+}
+
+// variationCoefficient returns the coefficient of variation of the durations,
+// their standard deviation relative to their mean.
+func variationCoefficient(ds []time.Duration) float64 {
+	if len(ds) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, d := range ds {
+		sum += float64(d)
+	}
+	mean := sum / float64(len(ds))
+	if mean == 0 {
+		return 0
+	}
+	var variance float64
+	for _, d := range ds {
+		variance += (float64(d) - mean) * (float64(d) - mean)
+	}
+	return math.Sqrt(variance/float64(len(ds))) / mean
+}
+
+// median returns the median of the durations.
+func median(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,151 @@
+package session
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 5, 26, 19, 0, 0, 0, time.UTC)
+
+func TestScannerSession(t *testing.T) {
+	tr := NewTracker(Config{})
+	var info Info
+	for i := 0; i < 30; i++ {
+		info = tr.Record(Request{
+			Source:     "192.0.2.1",
+			Time:       start.Add(time.Duration(i) * 50 * time.Millisecond),
+			Method:     "GET",
+			Path:       fmt.Sprintf("/path%d", i),
+			Scanner:    true,
+			Techniques: []string{"T1190", "T1595"},
+		})
+	}
+	if info.Requests != 30 {
+		t.Errorf("Expected 30 requests in the session, got %d", info.Requests)
+	}
+	if info.Flagged || info.Score >= DefaultThreshold {
+		t.Errorf("Expected the scanning session not to be flagged, got %+v", info)
+	}
+}
+
+func TestInteractiveSession(t *testing.T) {
+	var flagged []Info
+	tr := NewTracker(Config{OnFlagged: func(info Info) { flagged = append(flagged, info) }})
+	requests := []Request{
+		{Method: "GET", Path: "/login"},
+		{Method: "POST", Path: "/login", Variant: "a", Cookie: true, Techniques: []string{"T1110"}},
+		{Method: "POST", Path: "/login", Variant: "b", Cookie: true, Techniques: []string{"T1110", "T1190"}},
+		{Method: "POST", Path: "/login", Variant: "c", Cookie: true},
+		{Method: "GET", Path: "/admin/exec", Variant: "cmd=id", Cookie: true, Techniques: []string{"T1190", "T1059"}},
+		{Method: "GET", Path: "/admin/exec", Variant: "cmd=uname", Cookie: true},
+	}
+	var info Info
+	for i, req := range requests {
+		req.Source = "192.0.2.1"
+		req.Fingerprint = "curl/8.0"
+		req.Time = start.Add(time.Duration(i) * 12 * time.Second)
+		info = tr.Record(req)
+	}
+	// 15 for the techniques, 15 for the cookies, 20 for the probing, 10 for
+	// the methods and 15 for the pacing.
+	if info.Score != 75 || !info.Flagged {
+		t.Errorf("Expected the session flagged with a score of 75, got %+v", info)
+	}
+	if len(flagged) != 1 || flagged[0].ID != info.ID {
+		t.Errorf("Expected OnFlagged called once for the session, got %+v", flagged)
+	}
+}
+
+func TestSessionTimeout(t *testing.T) {
+	tr := NewTracker(Config{Timeout: time.Minute})
+	first := tr.Record(Request{Source: "192.0.2.1", Time: start})
+	same := tr.Record(Request{Source: "192.0.2.1", Time: start.Add(30 * time.Second)})
+	other := tr.Record(Request{Source: "192.0.2.1", Fingerprint: "other", Time: start.Add(30 * time.Second)})
+	next := tr.Record(Request{Source: "192.0.2.1", Time: start.Add(2 * time.Minute)})
+
+	if same.ID != first.ID || same.Requests != 2 {
+		t.Errorf("Expected the request in the same session, got %+v", same)
+	}
+	if other.ID == first.ID {
+		t.Error("Expected another client of the source in another session")
+	}
+	if next.ID == first.ID || next.Requests != 1 {
+		t.Errorf("Expected a new session after the timeout, got %+v", next)
+	}
+
+	active := tr.Active(start.Add(2 * time.Minute))
+	if len(active) != 1 || active[0].ID != next.ID {
+		t.Errorf("Expected only the new session active, got %+v", active)
+	}
+}
+
+func TestSessionLookup(t *testing.T) {
+	tr := NewTracker(Config{Timeout: time.Minute})
+	recorded := tr.Record(Request{Source: "192.0.2.1", Fingerprint: "curl", Time: start})
+
+	if info, ok := tr.Lookup("192.0.2.1", "curl", start.Add(30*time.Second)); !ok || info.ID != recorded.ID {
+		t.Errorf("Expected the session of the client, got %+v, %v", info, ok)
+	}
+	if _, ok := tr.Lookup("192.0.2.1", "other", start); ok {
+		t.Error("Expected no session for another client of the source")
+	}
+	if _, ok := tr.Lookup("192.0.2.1", "curl", start.Add(2*time.Minute)); ok {
+		t.Error("Expected no session after the timeout")
+	}
+}
+
+func TestSessionEviction(t *testing.T) {
+	tr := NewTracker(Config{MaxSessions: 2})
+	a := tr.Record(Request{Source: "192.0.2.1", Time: start})
+	tr.Record(Request{Source: "192.0.2.2", Time: start.Add(time.Second)})
+	tr.Record(Request{Source: "192.0.2.3", Time: start.Add(2 * time.Second)})
+
+	active := tr.Active(start.Add(2 * time.Second))
+	if len(active) != 2 {
+		t.Fatalf("Expected 2 sessions tracked, got %+v", active)
+	}
+	for _, s := range active {
+		if s.ID == a.ID {
+			t.Error("Expected the least recently active session evicted")
+		}
+	}
+}
+
+func TestHumanConfidence(t *testing.T) {
+	tr := NewTracker(Config{})
+	if info := tr.Record(Request{Source: "192.0.2.1", Time: start, Method: "GET", Path: "/"}); info.Human != humanNeutral || len(info.Signals) != 0 {
+		t.Errorf("Expected a neutral confidence without signals, got %+v", info)
+	}
+
+	// A browser fetching the assets of the pages at a human and irregular
+	// pace, returning the cookies and answering the JavaScript challenge.
+	gaps := []time.Duration{2 * time.Second, 300 * time.Millisecond, 9 * time.Second, 4 * time.Second, 25 * time.Second}
+	requests := []Request{
+		{Path: "/style.css", Referer: true},
+		{Path: "/app.js", Referer: true, Cookie: true},
+		{Path: "/beacon", Referer: true, Cookie: true, JSChallenge: true},
+		{Path: "/account", Referer: true, Cookie: true},
+		{Path: "/settings", Referer: true, Cookie: true},
+	}
+	var info Info
+	now := start
+	for i, req := range requests {
+		now = now.Add(gaps[i])
+		req.Source, req.Method, req.Time = "192.0.2.1", "GET", now
+		info = tr.Record(req)
+	}
+	want := []string{SignalHumanPacing, SignalAssets, SignalCookies, SignalJSChallenge}
+	if info.Human != 100 || fmt.Sprint(info.Signals) != fmt.Sprint(want) {
+		t.Errorf("Expected a human session with the signals %v, got %+v", want, info)
+	}
+
+	// A tool requesting pages at a regular pace, without any asset.
+	for i := 0; i < 12; i++ {
+		info = tr.Record(Request{Source: "192.0.2.2", Time: start.Add(time.Duration(i) * time.Second), Method: "GET", Path: fmt.Sprintf("/page%d", i)})
+	}
+	want = []string{SignalAutomatedPacing, SignalNoAssets}
+	if info.Human != 15 || fmt.Sprint(info.Signals) != fmt.Sprint(want) {
+		t.Errorf("Expected an automated session with the signals %v, got %+v", want, info)
+	}
+}
@@ -0,0 +1,151 @@
+package stats
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+const sampleSize = 200
+
+// SignatureCount is the number of times a generated response was seen.
+type SignatureCount struct {
+	Signature string    `json:"signature"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Sample    string    `json:"sample"`
+}
+
+// Signatures tracks how often identical responses are generated, which helps
+// detect the model collapsing to a few templates. At most maxEntries
+// signatures are tracked; when full, the least frequent one is evicted, its
+// frequency decayed by half every maxEntries responses since it was last
+// seen, so the responses no longer generated make room for the new ones.
+type Signatures struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*signatureEntry
+	// tick is the number of responses recorded.
+	tick uint64
+}
+
+// signatureEntry is a tracked signature with its decayed frequency, score, as
+// of the tick it was last seen.
+type signatureEntry struct {
+	SignatureCount
+	score float64
+	tick  uint64
+}
+
+// NewSignatures creates a new Signatures instance tracking up to maxEntries
+// distinct responses.
+func NewSignatures(maxEntries int) *Signatures {
+	return &Signatures{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*signatureEntry),
+	}
+}
+
+// Record counts the response and returns its signature.
+func (s *Signatures) Record(resp llm.JSONResponse) string {
+	sig := Signature(resp)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tick++
+	if e, ok := s.entries[sig]; ok {
+		e.Count++
+		e.LastSeen = now
+		e.score = s.decayed(e) + 1
+		e.tick = s.tick
+		return sig
+	}
+
+	if len(s.entries) >= s.maxEntries {
+		s.evict()
+	}
+	s.entries[sig] = &signatureEntry{
+		SignatureCount: SignatureCount{
+			Signature: sig,
+			Count:     1,
+			FirstSeen: now,
+			LastSeen:  now,
+			Sample:    truncate(resp.Body, sampleSize),
+		},
+		score: 1,
+		tick:  s.tick,
+	}
+	return sig
+}
+
+// Top returns a snapshot of the n most common responses.
+func (s *Signatures) Top(n int) []SignatureCount {
+	s.mu.Lock()
+	snapshot := make([]SignatureCount, 0, len(s.entries))
+	for _, e := range s.entries {
+		snapshot = append(snapshot, e.SignatureCount)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].Count != snapshot[j].Count {
+			return snapshot[i].Count > snapshot[j].Count
+		}
+		return snapshot[i].FirstSeen.Before(snapshot[j].FirstSeen)
+	})
+	if n > 0 && len(snapshot) > n {
+		snapshot = snapshot[:n]
+	}
+	return snapshot
+}
+
+// evict removes the entry of the lowest decayed frequency, preferring the
+// least recently seen.
+func (s *Signatures) evict() {
+	var victim *signatureEntry
+	var lowest float64
+	for _, e := range s.entries {
+		score := s.decayed(e)
+		if victim == nil || score < lowest || score == lowest && e.tick < victim.tick {
+			victim, lowest = e, score
+		}
+	}
+	if victim != nil {
+		delete(s.entries, victim.Signature)
+	}
+}
+
+// decayed returns the frequency of the entry decayed since it was last seen.
+func (s *Signatures) decayed(e *signatureEntry) float64 {
+	return e.score * math.Exp2(-float64(s.tick-e.tick)/float64(s.maxEntries))
+}
+
+// truncate cuts s to at most n bytes, on a UTF-8 character boundary.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// Signature returns the SHA256 hash of the canonical JSON encoding of the
+// response.
+func Signature(resp llm.JSONResponse) string {
+	// Map keys are sorted by json.Marshal, so equal responses encode equally.
+	data, _ := json.Marshal(resp)
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
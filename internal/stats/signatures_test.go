@@ -0,0 +1,104 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/0x4d31/galah/pkg/llm"
+)
+
+func TestSignaturesRecord(t *testing.T) {
+	s := NewSignatures(10)
+
+	login := llm.JSONResponse{
+		Headers: map[string]string{"Content-Type": "text/html", "Server": "nginx"},
+		Body:    "<html>login</html>",
+	}
+	// Same response with headers in a different insertion order.
+	loginReordered := llm.JSONResponse{
+		Headers: map[string]string{"Server": "nginx", "Content-Type": "text/html"},
+		Body:    "<html>login</html>",
+	}
+	notFound := llm.JSONResponse{
+		Headers: map[string]string{"Content-Type": "text/html"},
+		Body:    "<html>404</html>",
+	}
+
+	for i := 0; i < 2; i++ {
+		s.Record(login)
+		s.Record(loginReordered)
+	}
+	s.Record(notFound)
+
+	top := s.Top(0)
+	if len(top) != 2 {
+		t.Fatalf("Expected 2 signatures, got %d", len(top))
+	}
+	if top[0].Signature != Signature(login) || top[0].Count != 4 {
+		t.Errorf("Expected login response with count 4, got %+v", top[0])
+	}
+	if top[1].Signature != Signature(notFound) || top[1].Count != 1 {
+		t.Errorf("Expected not found response with count 1, got %+v", top[1])
+	}
+	if len(s.Top(1)) != 1 {
+		t.Errorf("Expected Top(1) to return a single entry")
+	}
+}
+
+func TestSignaturesBounded(t *testing.T) {
+	s := NewSignatures(2)
+
+	frequent := llm.JSONResponse{Body: "frequent"}
+	s.Record(frequent)
+	s.Record(frequent)
+	s.Record(llm.JSONResponse{Body: "rare-1"})
+	s.Record(llm.JSONResponse{Body: "rare-2"})
+
+	top := s.Top(0)
+	if len(top) != 2 {
+		t.Fatalf("Expected 2 signatures, got %d", len(top))
+	}
+	if top[0].Signature != Signature(frequent) || top[0].Count != 2 {
+		t.Errorf("Expected frequent response to survive eviction, got %+v", top[0])
+	}
+	if top[1].Sample != "rare-2" {
+		t.Errorf("Expected the older rare response to be evicted, got %+v", top[1])
+	}
+}
+
+func TestSignaturesLearnNewResponses(t *testing.T) {
+	s := NewSignatures(2)
+	for i := 0; i < 5; i++ {
+		s.Record(llm.JSONResponse{Body: "old-1"})
+		s.Record(llm.JSONResponse{Body: "old-2"})
+	}
+	// The new responses alternate, each evicting the other if the frequent
+	// responses no longer generated are kept.
+	for i := 0; i < 10; i++ {
+		s.Record(llm.JSONResponse{Body: "new-1"})
+		s.Record(llm.JSONResponse{Body: "new-2"})
+	}
+
+	top := s.Top(0)
+	if len(top) != 2 {
+		t.Fatalf("Expected 2 signatures, got %d", len(top))
+	}
+	for _, sc := range top {
+		if !strings.HasPrefix(sc.Sample, "new-") || sc.Count < 5 {
+			t.Errorf("Expected the new responses to be tracked, got %+v", sc)
+		}
+	}
+}
+
+func TestSignaturesSampleUTF8(t *testing.T) {
+	s := NewSignatures(1)
+	// The sample size falls in the middle of the last character.
+	body := strings.Repeat("a", sampleSize-1) + "é"
+	s.Record(llm.JSONResponse{Body: body})
+
+	sample := s.Top(1)[0].Sample
+	if !utf8.ValidString(sample) || sample != strings.Repeat("a", sampleSize-1) {
+		t.Errorf("Expected the sample to be cut before the last character, got %q", sample)
+	}
+}
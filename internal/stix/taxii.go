@@ -0,0 +1,87 @@
+package stix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// taxiiMediaType is the media type of the TAXII 2.1 requests and responses.
+const taxiiMediaType = "application/taxii+json;version=2.1"
+
+// TAXIIConfig configures the TAXII 2.1 collection the bundles are pushed to:
+// the collection of ID Collection of the API root at URL. The requests are
+// authenticated with the Username and Password if set, or else with the
+// bearer Token if set.
+type TAXIIConfig struct {
+	URL        string
+	Collection string
+	Username   string
+	Password   string
+	Token      string
+}
+
+// Status is the status of the objects added to a collection.
+type Status struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	TotalCount   int    `json:"total_count"`
+	SuccessCount int    `json:"success_count"`
+	FailureCount int    `json:"failure_count"`
+	PendingCount int    `json:"pending_count"`
+}
+
+// Push adds the objects of the bundle to the TAXII collection, and returns the
+// status of the addition.
+func Push(ctx context.Context, client *http.Client, cfg TAXIIConfig, bundle *Bundle) (*Status, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	body, err := json.Marshal(struct {
+		Objects []Object `json:"objects"`
+	}{bundle.Objects})
+	if err != nil {
+		return nil, err
+	}
+	u := strings.TrimSuffix(cfg.URL, "/") + "/collections/" + cfg.Collection + "/objects/"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", taxiiMediaType)
+	req.Header.Set("Accept", taxiiMediaType)
+	if cfg.Username != "" || cfg.Password != "" {
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	} else if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Title       string `json:"title"`
+			Description string `json:"description"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Title != "" {
+			return nil, fmt.Errorf("the TAXII server returned %s: %s %s", resp.Status, e.Title, e.Description)
+		}
+		return nil, fmt.Errorf("the TAXII server returned %s", resp.Status)
+	}
+	var status Status
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("error decoding the status of the TAXII server: %s", err)
+	}
+	return &status, nil
+}
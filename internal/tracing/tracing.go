@@ -0,0 +1,137 @@
+// Package tracing configures the OpenTelemetry SDK tracer provider exporting
+// the spans to an OTLP/HTTP collector.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+const (
+	defaultServiceName   = "galah"
+	defaultBatchSize     = 512
+	defaultFlushInterval = 5 * time.Second
+	queueSize            = 4096
+	exportTimeout        = 10 * time.Second
+	maxEvents            = 32
+	tracesPath           = "/v1/traces"
+)
+
+// Config configures a Provider. The spans are exported to the OTLP/HTTP
+// collector at Endpoint (e.g. http://localhost:4318), with the Headers set
+// (e.g. for authentication), in batches of up to BatchSize spans sent at
+// least every FlushInterval. SampleRatio is the ratio of the traces sampled,
+// all of them if 0.
+type Config struct {
+	Endpoint      string
+	Headers       map[string]string
+	ServiceName   string
+	Version       string
+	SampleRatio   float64
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// Provider is a trace.TracerProvider exporting the sampled spans in the
+// background with the SDK batch span processor. The spans are dropped if the
+// queue is full.
+type Provider struct {
+	embedded.TracerProvider
+
+	sdk    *sdktrace.TracerProvider
+	logger *logrus.Logger
+}
+
+// NewProvider returns a Provider of the configuration, logging the errors
+// exporting the spans to logger.
+func NewProvider(cfg Config, logger *logrus.Logger) (*Provider, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("no OTLP endpoint for the traces")
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("invalid trace sample ratio %v (between 0 and 1)", cfg.SampleRatio)
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" || endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q for the traces", cfg.Endpoint)
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = defaultServiceName
+	}
+	if cfg.SampleRatio == 0 {
+		cfg.SampleRatio = 1
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpoint.Host),
+		otlptracehttp.WithURLPath(path.Join("/", endpoint.Path, tracesPath)),
+		otlptracehttp.WithHeaders(cfg.Headers),
+		otlptracehttp.WithTimeout(exportTimeout),
+	}
+	if endpoint.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	// The exporter doesn't connect until the first export.
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the OTLP trace exporter: %w", err)
+	}
+
+	attrs := []attribute.KeyValue{attribute.String("service.name", cfg.ServiceName)}
+	if cfg.Version != "" {
+		attrs = append(attrs, attribute.String("service.version", cfg.Version))
+	}
+	limits := sdktrace.NewSpanLimits()
+	limits.EventCountLimit = maxEvents
+
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Errorf("error exporting the spans: %s", err)
+	}))
+	sdk := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter,
+			sdktrace.WithMaxQueueSize(queueSize),
+			sdktrace.WithMaxExportBatchSize(cfg.BatchSize),
+			sdktrace.WithBatchTimeout(cfg.FlushInterval),
+			sdktrace.WithExportTimeout(exportTimeout),
+		),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attrs...)),
+		sdktrace.WithRawSpanLimits(limits),
+	)
+	return &Provider{sdk: sdk, logger: logger}, nil
+}
+
+// Tracer returns the tracer of the instrumentation scope of the given name.
+func (p *Provider) Tracer(name string, options ...trace.TracerOption) trace.Tracer {
+	return p.sdk.Tracer(name, options...)
+}
+
+// Shutdown exports the queued spans. The spans ended after are dropped.
+func (p *Provider) Shutdown() {
+	if p == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	if err := p.sdk.Shutdown(ctx); err != nil {
+		p.logger.Errorf("error shutting down the tracer provider: %s", err)
+	}
+}
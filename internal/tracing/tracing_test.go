@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestProvider(t *testing.T) {
+	var mu sync.Mutex
+	var spans []*tracepb.Span
+	var resource int
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req collectortrace.ExportTraceServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			resource = len(rs.Resource.Attributes)
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	p, err := NewProvider(Config{Endpoint: collector.URL, Headers: map[string]string{"Authorization": "Bearer token"}}, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := p.Tracer("test")
+	ctx, root := tracer.Start(context.Background(), "galah.request", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attribute.Int("server.port", 8080)))
+	_, child := tracer.Start(ctx, "galah.llm.generate", trace.WithAttributes(attribute.StringSlice("tags", []string{"a", "b"})))
+	child.RecordError(errors.New("rate limited"))
+	child.SetStatus(codes.Error, "rateLimited")
+	child.End()
+	root.End()
+	p.Shutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(spans) != 2 || resource != 1 {
+		t.Fatalf("Expected 2 spans of the resource, got %v (%d resource attributes)", spans, resource)
+	}
+	c, r := spans[0], spans[1]
+	if c.Name != "galah.llm.generate" || !bytes.Equal(c.TraceId, r.TraceId) || !bytes.Equal(c.ParentSpanId, r.SpanId) || len(r.ParentSpanId) != 0 {
+		t.Errorf("Unexpected parent of the spans: %v, %v", c, r)
+	}
+	if r.Kind != tracepb.Span_SPAN_KIND_SERVER || c.Kind != tracepb.Span_SPAN_KIND_INTERNAL {
+		t.Errorf("Unexpected span kinds: %v, %v", c.Kind, r.Kind)
+	}
+	if c.Status.Code != tracepb.Status_STATUS_CODE_ERROR || c.Status.Message != "rateLimited" {
+		t.Errorf("Unexpected status %v", c.Status)
+	}
+	if len(c.Events) != 1 || c.Events[0].Name != "exception" {
+		t.Errorf("Unexpected events %v", c.Events)
+	}
+	if attr := r.Attributes[0]; attr.Key != "server.port" || attr.Value.GetIntValue() != 8080 {
+		t.Errorf("Unexpected attribute %v", attr)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	p, err := NewProvider(Config{Endpoint: "http://localhost:4318", SampleRatio: 1e-9}, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown()
+	ctx, root := p.Tracer("test").Start(context.Background(), "root")
+	_, child := p.Tracer("test").Start(ctx, "child")
+	if root.IsRecording() || child.IsRecording() || child.SpanContext().TraceID() != root.SpanContext().TraceID() {
+		t.Errorf("Expected the trace to be unsampled")
+	}
+	child.End()
+	root.End()
+}
+
+func TestNewProviderEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"", "localhost:4318", "ftp://localhost"} {
+		if _, err := NewProvider(Config{Endpoint: endpoint}, logrus.New()); err == nil {
+			t.Errorf("Expected an error for the endpoint %q", endpoint)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/bluele/gcache"
+	"github.com/oschwald/maxminddb-golang"
 )
 
 // LookupInfo contains the results of a performed lookup.
@@ -23,8 +24,11 @@ type Config struct {
 
 // Enricher represents the default enrichment implementation.
 type Enricher struct {
-	cache gcache.Cache
-	ttl   time.Duration
+	cache  gcache.Cache
+	ttl    time.Duration
+	cityDB *maxminddb.Reader
+	asnDB  *maxminddb.Reader
+	intel  *ThreatIntel
 }
 
 // ScannerSubnets contains a list of known scanners' subnet.
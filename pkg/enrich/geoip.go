@@ -0,0 +1,108 @@
+package enrich
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoInfo contains the location and the autonomous system of an IP address.
+type GeoInfo struct {
+	Country     string `json:"country,omitempty"`
+	CountryCode string `json:"countryCode,omitempty"`
+	City        string `json:"city,omitempty"`
+	ASN         uint   `json:"asn,omitempty"`
+	Org         string `json:"org,omitempty"`
+}
+
+// geoRecord is the part of the records of the city, country and ASN
+// databases used by GeoIP.
+type geoRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN uint   `maxminddb:"autonomous_system_number"`
+	Org string `maxminddb:"autonomous_system_organization"`
+}
+
+// LoadGeoIP loads the city (or country) and ASN databases, in the MaxMind DB
+// format of the MaxMind GeoIP2/GeoLite2 and DB-IP databases, used by GeoIP.
+// Either path may be empty. The databases are memory-mapped.
+func (e *Enricher) LoadGeoIP(cityDB, asnDB string) error {
+	for _, db := range []struct {
+		path   string
+		reader **maxminddb.Reader
+	}{
+		{cityDB, &e.cityDB},
+		{asnDB, &e.asnDB},
+	} {
+		if db.path == "" {
+			continue
+		}
+		r, err := maxminddb.Open(db.path)
+		if err != nil {
+			return fmt.Errorf("error loading the GeoIP database %s: %w", db.path, err)
+		}
+		*db.reader = r
+	}
+	return nil
+}
+
+// GeoIP returns the location and the autonomous system of the IP address, or
+// nil if no GeoIP database is loaded or the address isn't in them.
+func (e *Enricher) GeoIP(ip string) (*GeoInfo, error) {
+	if e.cityDB == nil && e.asnDB == nil {
+		return nil, nil
+	}
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return nil, fmt.Errorf("invalid IP address %q", ip)
+	}
+
+	info := &GeoInfo{}
+	found := false
+	for _, db := range []*maxminddb.Reader{e.cityDB, e.asnDB} {
+		// The IPv4 databases have no IPv6 addresses.
+		if db == nil || (db.Metadata.IPVersion == 4 && parsedIP.To4() == nil) {
+			continue
+		}
+		var record geoRecord
+		_, ok, err := db.LookupNetwork(parsedIP, &record)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up %q in the GeoIP database: %w", ip, err)
+		}
+		if ok {
+			info.merge(record)
+			found = true
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	return info, nil
+}
+
+// merge sets the fields found in the record of a city, country or ASN
+// database, with the English names.
+func (g *GeoInfo) merge(record geoRecord) {
+	if code := record.Country.ISOCode; code != "" {
+		g.CountryCode = code
+	}
+	if name := record.Country.Names["en"]; name != "" {
+		g.Country = name
+	}
+	if name := record.City.Names["en"]; name != "" {
+		g.City = name
+	}
+	if record.ASN != 0 {
+		g.ASN = record.ASN
+	}
+	if record.Org != "" {
+		g.Org = record.Org
+	}
+}
@@ -0,0 +1,86 @@
+package enrich
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// writeMMDB writes a database of the IP version mapping the network to the
+// record.
+func writeMMDB(t *testing.T, ipVersion int, network string, record mmdbtype.Map) string {
+	w, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: "Test", IPVersion: ipVersion, RecordSize: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, n, err := net.ParseCIDR(network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Insert(n, record); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := w.WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGeoIP(t *testing.T) {
+	city := mmdbtype.Map{
+		"city":    mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String("Sydney"), "de": mmdbtype.String("Sydney")}},
+		"country": mmdbtype.Map{"iso_code": mmdbtype.String("AU"), "names": mmdbtype.Map{"en": mmdbtype.String("Australia")}},
+	}
+	asn := mmdbtype.Map{
+		"autonomous_system_number":       mmdbtype.Uint32(13335),
+		"autonomous_system_organization": mmdbtype.String("Cloudflare, Inc."),
+	}
+
+	e := New(Config{CacheSize: 1})
+	if info, err := e.GeoIP("1.1.1.1"); info != nil || err != nil {
+		t.Errorf("Expected no GeoIP info without databases, got %+v, %v", info, err)
+	}
+
+	// The city database is an IPv6 database, with the IPv4 addresses under
+	// ::/96, and the ASN database an IPv4 database.
+	cityDB := writeMMDB(t, 6, "1.1.1.0/24", city)
+	asnDB := writeMMDB(t, 4, "1.1.1.0/24", asn)
+	if err := e.LoadGeoIP(cityDB, asnDB); err != nil {
+		t.Fatalf("LoadGeoIP() error = %v", err)
+	}
+
+	info, err := e.GeoIP("1.1.1.1")
+	if err != nil {
+		t.Fatalf("GeoIP() error = %v", err)
+	}
+	want := GeoInfo{Country: "Australia", CountryCode: "AU", City: "Sydney", ASN: 13335, Org: "Cloudflare, Inc."}
+	if info == nil || *info != want {
+		t.Errorf("GeoIP() = %+v, want %+v", info, want)
+	}
+
+	for _, ip := range []string{"1.1.2.1", "2001:db8::1"} {
+		if info, err := e.GeoIP(ip); info != nil || err != nil {
+			t.Errorf("Expected no GeoIP info for %s, got %+v, %v", ip, info, err)
+		}
+	}
+
+	if err := e.LoadGeoIP(filepath.Join(t.TempDir(), "missing.mmdb"), ""); err == nil {
+		t.Error("Expected an error loading a missing database")
+	}
+	bad := filepath.Join(t.TempDir(), "bad.mmdb")
+	os.WriteFile(bad, []byte("not a database"), 0o644)
+	if err := e.LoadGeoIP(bad, ""); err == nil {
+		t.Error("Expected an error loading an invalid database")
+	}
+}
@@ -0,0 +1,400 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluele/gcache"
+)
+
+const (
+	// defaultIntelTimeout is the time allowed to each feed lookup if not set.
+	defaultIntelTimeout = 3 * time.Second
+	// defaultIntelCacheTTL is the time a verdict is cached if not set.
+	defaultIntelCacheTTL = 24 * time.Hour
+	// defaultRateLimitBackoff is the time a rate-limited feed isn't queried
+	// if the feed doesn't tell when to retry.
+	defaultRateLimitBackoff = time.Minute
+	// defaultAbuseIPDBMinScore is the AbuseIPDB confidence score from which
+	// an IP address is malicious if not set.
+	defaultAbuseIPDBMinScore = 50
+)
+
+// Verdict is the assessment of an IP address by a threat intelligence feed.
+type Verdict struct {
+	Feed           string   `json:"feed"`
+	Malicious      bool     `json:"malicious"`
+	Score          int      `json:"score,omitempty"`
+	Classification string   `json:"classification,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+}
+
+// Feed is a threat intelligence feed. Lookup returns nil if the feed knows
+// nothing about the IP address.
+type Feed interface {
+	Name() string
+	Lookup(ctx context.Context, ip string) (*Verdict, error)
+}
+
+// FeedConfig configures a threat intelligence feed. Type is abuseipdb,
+// greynoise or misp. URL overrides the API endpoint of AbuseIPDB and
+// GreyNoise, and is the base URL of the MISP instance. MinScore is the
+// AbuseIPDB confidence score from which an IP address is malicious.
+type FeedConfig struct {
+	Type     string
+	URL      string
+	APIKey   string
+	MinScore int
+}
+
+// NewFeed returns the configured feed, querying its API with the client (the
+// default client if nil).
+func NewFeed(fc FeedConfig, client *http.Client) (Feed, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	api := &feedAPI{client: client, apiKey: fc.APIKey}
+	switch strings.ToLower(fc.Type) {
+	case "abuseipdb":
+		api.name, api.url = "abuseipdb", "https://api.abuseipdb.com/api/v2/check"
+		minScore := fc.MinScore
+		if minScore <= 0 {
+			minScore = defaultAbuseIPDBMinScore
+		}
+		if fc.URL != "" {
+			api.url = fc.URL
+		}
+		return &abuseIPDB{feedAPI: api, minScore: minScore}, nil
+	case "greynoise":
+		api.name, api.url = "greynoise", "https://api.greynoise.io/v3/community/"
+		if fc.URL != "" {
+			api.url = fc.URL
+		}
+		return &greyNoise{feedAPI: api}, nil
+	case "misp":
+		if fc.URL == "" {
+			return nil, errors.New("the URL of the MISP instance is not configured")
+		}
+		api.name, api.url = "misp", strings.TrimSuffix(fc.URL, "/")+"/attributes/restSearch"
+		return &misp{feedAPI: api}, nil
+	}
+	return nil, fmt.Errorf("unknown threat intelligence feed type %q", fc.Type)
+}
+
+// ThreatIntel looks up the IP addresses in threat intelligence feeds, caching
+// the verdicts.
+type ThreatIntel struct {
+	feeds   []Feed
+	cache   gcache.Cache
+	ttl     time.Duration
+	timeout time.Duration
+}
+
+// NewThreatIntel returns a lookup of the feeds caching up to cacheSize
+// verdicts for ttl, each lookup taking up to timeout.
+func NewThreatIntel(feeds []Feed, cacheSize int, ttl, timeout time.Duration) *ThreatIntel {
+	if ttl <= 0 {
+		ttl = defaultIntelCacheTTL
+	}
+	if timeout <= 0 {
+		timeout = defaultIntelTimeout
+	}
+	return &ThreatIntel{
+		feeds:   feeds,
+		cache:   gcache.New(cacheSize).LRU().Build(),
+		ttl:     ttl,
+		timeout: timeout,
+	}
+}
+
+type cachedVerdict struct {
+	verdict *Verdict
+}
+
+// Lookup returns the verdicts of the feeds knowing the IP address, queried
+// concurrently. The feeds failing or rate limited are skipped; the errors are
+// returned with the other verdicts.
+func (t *ThreatIntel) Lookup(ctx context.Context, ip string) ([]Verdict, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	verdicts := make([]*Verdict, len(t.feeds))
+	errs := make([]error, len(t.feeds))
+	var wg sync.WaitGroup
+	for i, feed := range t.feeds {
+		key := feed.Name() + "|" + ip
+		if v, err := t.cache.Get(key); err == nil {
+			verdicts[i] = v.(cachedVerdict).verdict
+			continue
+		}
+		wg.Add(1)
+		go func(i int, feed Feed) {
+			defer wg.Done()
+			verdict, err := feed.Lookup(ctx, ip)
+			if err != nil {
+				if !errors.Is(err, errRateLimited) {
+					errs[i] = fmt.Errorf("error looking up %q in %s: %w", ip, feed.Name(), err)
+				}
+				return
+			}
+			// Unknown addresses are cached too.
+			_ = t.cache.SetWithExpire(key, cachedVerdict{verdict}, t.ttl)
+			verdicts[i] = verdict
+		}(i, feed)
+	}
+	wg.Wait()
+
+	var out []Verdict
+	for _, v := range verdicts {
+		if v != nil {
+			out = append(out, *v)
+		}
+	}
+	return out, errors.Join(errs...)
+}
+
+// errRateLimited is returned while a feed is rate limited.
+var errRateLimited = errors.New("rate limited")
+
+// feedAPI queries the HTTP API of a feed, and stops querying it when rate
+// limited until the time given by the API.
+type feedAPI struct {
+	name   string
+	url    string
+	apiKey string
+	client *http.Client
+
+	mu           sync.Mutex
+	limitedUntil time.Time
+}
+
+func (f *feedAPI) Name() string {
+	return f.name
+}
+
+// do sends the request and decodes the JSON response into v. It returns
+// false if the API answered 404 (Not Found).
+func (f *feedAPI) do(req *http.Request, v any) (bool, error) {
+	f.mu.Lock()
+	limited := time.Now().Before(f.limitedUntil)
+	f.mu.Unlock()
+	if limited {
+		return false, errRateLimited
+	}
+
+	req.Header.Set("Accept", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		until := retryTime(resp.Header)
+		f.mu.Lock()
+		f.limitedUntil = until
+		f.mu.Unlock()
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return false, fmt.Errorf("rate limited until %s", until.Format(time.RFC3339))
+		}
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return false, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v); err != nil {
+		return false, fmt.Errorf("invalid response: %w", err)
+	}
+	return true, nil
+}
+
+// retryTime returns the time from which a rate-limited API can be queried
+// again, from the Retry-After or X-RateLimit-Reset (Unix time) headers.
+func retryTime(h http.Header) time.Time {
+	now := time.Now()
+	if s, err := strconv.Atoi(h.Get("Retry-After")); err == nil && s > 0 {
+		return now.Add(time.Duration(s) * time.Second)
+	}
+	if t, err := http.ParseTime(h.Get("Retry-After")); err == nil && t.After(now) {
+		return t
+	}
+	if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil && reset > now.Unix() {
+		return time.Unix(reset, 0)
+	}
+	return now.Add(defaultRateLimitBackoff)
+}
+
+// abuseIPDB looks up the IP addresses with the AbuseIPDB check API.
+type abuseIPDB struct {
+	*feedAPI
+	minScore int
+}
+
+func (a *abuseIPDB) Lookup(ctx context.Context, ip string) (*Verdict, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	q := req.URL.Query()
+	q.Set("ipAddress", ip)
+	q.Set("maxAgeInDays", "90")
+	req.URL.RawQuery = q.Encode()
+	req.Header.Set("Key", a.apiKey)
+
+	var resp struct {
+		Data struct {
+			AbuseConfidenceScore int    `json:"abuseConfidenceScore"`
+			TotalReports         int    `json:"totalReports"`
+			UsageType            string `json:"usageType"`
+			IsWhitelisted        bool   `json:"isWhitelisted"`
+		} `json:"data"`
+	}
+	if ok, err := a.do(req, &resp); !ok || err != nil {
+		return nil, err
+	}
+	if resp.Data.TotalReports == 0 && !resp.Data.IsWhitelisted {
+		return nil, nil
+	}
+
+	v := &Verdict{
+		Feed:           a.name,
+		Score:          resp.Data.AbuseConfidenceScore,
+		Classification: "unknown",
+		Malicious:      resp.Data.AbuseConfidenceScore >= a.minScore,
+	}
+	switch {
+	case resp.Data.IsWhitelisted:
+		v.Classification = "benign"
+	case v.Malicious:
+		v.Classification = "malicious"
+	}
+	v.Tags = []string{a.name + ":" + v.Classification}
+	if resp.Data.UsageType != "" {
+		v.Tags = append(v.Tags, a.name+":"+resp.Data.UsageType)
+	}
+	return v, nil
+}
+
+// greyNoise looks up the IP addresses with the GreyNoise community API.
+type greyNoise struct {
+	*feedAPI
+}
+
+func (g *greyNoise) Lookup(ctx context.Context, ip string) (*Verdict, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.url+ip, nil)
+	if err != nil {
+		return nil, err
+	}
+	if g.apiKey != "" {
+		req.Header.Set("key", g.apiKey)
+	}
+
+	var resp struct {
+		Noise          bool   `json:"noise"`
+		RIOT           bool   `json:"riot"`
+		Classification string `json:"classification"`
+		Name           string `json:"name"`
+	}
+	if ok, err := g.do(req, &resp); !ok || err != nil {
+		return nil, err
+	}
+	if !resp.Noise && !resp.RIOT {
+		return nil, nil
+	}
+
+	v := &Verdict{
+		Feed:           g.name,
+		Classification: resp.Classification,
+		Malicious:      resp.Classification == "malicious",
+		Tags:           []string{g.name + ":" + resp.Classification},
+	}
+	if resp.RIOT {
+		v.Tags = append(v.Tags, g.name+":riot")
+	}
+	if resp.Name != "" && resp.Name != "unknown" {
+		v.Tags = append(v.Tags, g.name+":"+resp.Name)
+	}
+	return v, nil
+}
+
+// misp looks up the IP addresses in the attributes of a MISP instance.
+type misp struct {
+	*feedAPI
+}
+
+func (m *misp) Lookup(ctx context.Context, ip string) (*Verdict, error) {
+	body, err := json.Marshal(map[string]any{
+		"value":            ip,
+		"type":             []string{"ip-src", "ip-dst", "ip-src|port", "ip-dst|port"},
+		"to_ids":           true,
+		"includeEventTags": true,
+		"limit":            50,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.url, strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", m.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		Response struct {
+			Attribute []struct {
+				Tag []struct {
+					Name string `json:"name"`
+				} `json:"Tag"`
+			} `json:"Attribute"`
+		} `json:"response"`
+	}
+	if ok, err := m.do(req, &resp); !ok || err != nil {
+		return nil, err
+	}
+	if len(resp.Response.Attribute) == 0 {
+		return nil, nil
+	}
+
+	// The attributes flagged for IDS are indicators of malicious activity.
+	v := &Verdict{
+		Feed:           m.name,
+		Malicious:      true,
+		Classification: "malicious",
+	}
+	seen := map[string]bool{}
+	for _, a := range resp.Response.Attribute {
+		for _, t := range a.Tag {
+			if !seen[t.Name] {
+				seen[t.Name] = true
+				v.Tags = append(v.Tags, m.name+":"+t.Name)
+			}
+		}
+	}
+	return v, nil
+}
+
+// SetThreatIntel sets the threat intelligence feeds used by LookupThreatIntel.
+func (e *Enricher) SetThreatIntel(t *ThreatIntel) {
+	e.intel = t
+}
+
+// LookupThreatIntel returns the verdicts of the threat intelligence feeds on
+// the IP address, or nil if no feed is set.
+func (e *Enricher) LookupThreatIntel(ctx context.Context, ip string) ([]Verdict, error) {
+	if e.intel == nil {
+		return nil, nil
+	}
+	return e.intel.Lookup(ctx, ip)
+}
@@ -0,0 +1,100 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestThreatIntel(t *testing.T) {
+	var abuseCalls, greyNoiseCalls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/abuseipdb", func(w http.ResponseWriter, r *http.Request) {
+		abuseCalls.Add(1)
+		if r.Header.Get("Key") != "abuse-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		score := 0
+		if r.URL.Query().Get("ipAddress") == "192.0.2.1" {
+			score = 100
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"abuseConfidenceScore": score,
+			"totalReports":         score,
+			"usageType":            "Data Center/Web Hosting/Transit",
+		}})
+	})
+	mux.HandleFunc("/greynoise/", func(w http.ResponseWriter, r *http.Request) {
+		greyNoiseCalls.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("/attributes/restSearch", func(w http.ResponseWriter, r *http.Request) {
+		var query struct {
+			Value string `json:"value"`
+		}
+		json.NewDecoder(r.Body).Decode(&query)
+		var attributes []any
+		if query.Value == "192.0.2.1" {
+			attributes = append(attributes, map[string]any{"Tag": []any{map[string]any{"name": "tlp:white"}}})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"response": map[string]any{"Attribute": attributes}})
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	var feeds []Feed
+	for _, fc := range []FeedConfig{
+		{Type: "abuseipdb", URL: ts.URL + "/abuseipdb", APIKey: "abuse-key"},
+		{Type: "greynoise", URL: ts.URL + "/greynoise/"},
+		{Type: "misp", URL: ts.URL + "/"},
+	} {
+		feed, err := NewFeed(fc, ts.Client())
+		if err != nil {
+			t.Fatalf("NewFeed() error = %v", err)
+		}
+		feeds = append(feeds, feed)
+	}
+	if _, err := NewFeed(FeedConfig{Type: "unknown"}, nil); err == nil {
+		t.Error("Expected an error for an unknown feed type")
+	}
+
+	e := New(Config{CacheSize: 1})
+	if verdicts, err := e.LookupThreatIntel(context.Background(), "192.0.2.1"); verdicts != nil || err != nil {
+		t.Errorf("Expected no verdicts without feeds, got %+v, %v", verdicts, err)
+	}
+	e.SetThreatIntel(NewThreatIntel(feeds, 10, 0, 0))
+
+	verdicts, err := e.LookupThreatIntel(context.Background(), "192.0.2.1")
+	if err == nil || !strings.Contains(err.Error(), "greynoise") {
+		t.Errorf("Expected the rate limit error of greynoise, got %v", err)
+	}
+	if len(verdicts) != 2 {
+		t.Fatalf("Expected the verdicts of abuseipdb and misp, got %+v", verdicts)
+	}
+	if v := verdicts[0]; v.Feed != "abuseipdb" || !v.Malicious || v.Score != 100 || v.Tags[0] != "abuseipdb:malicious" {
+		t.Errorf("Unexpected abuseipdb verdict: %+v", v)
+	}
+	if v := verdicts[1]; v.Feed != "misp" || !v.Malicious || len(v.Tags) != 1 || v.Tags[0] != "misp:tlp:white" {
+		t.Errorf("Unexpected misp verdict: %+v", v)
+	}
+
+	// The verdicts are cached, and the rate-limited feed isn't queried.
+	verdicts, err = e.LookupThreatIntel(context.Background(), "192.0.2.1")
+	if err != nil || len(verdicts) != 2 {
+		t.Errorf("Expected the cached verdicts without errors, got %+v, %v", verdicts, err)
+	}
+	if abuseCalls.Load() != 1 || greyNoiseCalls.Load() != 1 {
+		t.Errorf("Expected a single call to each feed, got %d and %d", abuseCalls.Load(), greyNoiseCalls.Load())
+	}
+
+	verdicts, err = e.LookupThreatIntel(context.Background(), "198.51.100.1")
+	if err != nil || len(verdicts) != 0 {
+		t.Errorf("Expected no verdicts for an unknown address, got %+v, %v", verdicts, err)
+	}
+}
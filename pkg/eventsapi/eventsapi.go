@@ -0,0 +1,6 @@
+// Package eventsapi is the gRPC API streaming the events of the honeypot and
+// the summaries of their sessions (see events.proto), for the consumers of
+// the event stream enabled by event_outputs.grpc.
+package eventsapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative events.proto
@@ -1,12 +1,19 @@
 package llm
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/anthropic"
 )
 
+// initAnthropicClient initializes the client of Anthropic's messages API, at
+// the server URL if set (e.g. a proxy, with the /v1 path). The system prompt,
+// the same for all the requests, is cached by the API (see cachingDoer).
 func initAnthropicClient(config Config) (llms.Model, error) {
 	if config.APIKey == "" {
 		return nil, fmt.Errorf("API key is required")
@@ -14,6 +21,10 @@ func initAnthropicClient(config Config) (llms.Model, error) {
 	opts := []anthropic.Option{
 		anthropic.WithModel(config.Model),
 		anthropic.WithToken(config.APIKey),
+		anthropic.WithHTTPClient(&cachingDoer{}),
+	}
+	if config.ServerURL != "" {
+		opts = append(opts, anthropic.WithBaseURL(config.ServerURL))
 	}
 	m, err := anthropic.New(opts...)
 	if err != nil {
@@ -21,3 +32,57 @@ func initAnthropicClient(config Config) (llms.Model, error) {
 	}
 	return m, nil
 }
+
+// cachingDoer marks the system prompt of the requests sent to Anthropic's
+// messages API as a prompt caching breakpoint, so that the API reuses its
+// processing for the next requests rather than billing it at the full input
+// price. The system prompts shorter than the minimum of the model aren't
+// cached, and the requests are sent unchanged.
+type cachingDoer struct{}
+
+func (d *cachingDoer) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if cached, ok := cacheSystemPrompt(body); ok {
+			body = cached
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// cacheSystemPrompt returns the payload of the messages API with its system
+// prompt as a text block with an ephemeral cache control, and false if the
+// payload has no system prompt.
+func cacheSystemPrompt(payload []byte) ([]byte, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, false
+	}
+	var system string
+	if err := json.Unmarshal(fields["system"], &system); err != nil || system == "" {
+		return nil, false
+	}
+	type cacheControl struct {
+		Type string `json:"type"`
+	}
+	blocks, err := json.Marshal([]struct {
+		Type         string       `json:"type"`
+		Text         string       `json:"text"`
+		CacheControl cacheControl `json:"cache_control"`
+	}{{Type: "text", Text: system, CacheControl: cacheControl{Type: "ephemeral"}}})
+	if err != nil {
+		return nil, false
+	}
+	fields["system"] = blocks
+	cached, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false
+	}
+	return cached, true
+}
@@ -0,0 +1,61 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestAnthropicPromptCaching(t *testing.T) {
+	var gotPath string
+	var got struct {
+		System []struct {
+			Type         string `json:"type"`
+			Text         string `json:"text"`
+			CacheControl struct {
+				Type string `json:"type"`
+			} `json:"cache_control"`
+		} `json:"system"`
+		Messages []json.RawMessage `json:"messages"`
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, r.ContentLength, int64(len(body)))
+		assert.NoError(t, json.Unmarshal(body, &got))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"type": "message", "role": "assistant", "content": [{"type": "text", "text": "{\"headers\": {\"Server\": \"nginx\"}, \"body\": \"ok\"}"}], "stop_reason": "end_turn", "usage": {"input_tokens": 10, "output_tokens": 12}}`))
+	}))
+	defer ts.Close()
+
+	config := llm.Config{
+		Provider:  "anthropic",
+		Model:     "claude-3-5-haiku-latest",
+		APIKey:    "sk-ant-test",
+		ServerURL: ts.URL + "/v1",
+	}
+	model, err := llm.New(context.Background(), config)
+	require.NoError(t, err)
+
+	messages := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "You are a web server."),
+		llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1"),
+	}
+	resp, err := llm.GenerateLLMResponse(context.Background(), model, config, messages)
+	require.NoError(t, err)
+	assert.Equal(t, `{"headers": {"Server": "nginx"}, "body": "ok"}`, resp)
+	assert.Equal(t, "/v1/messages", gotPath)
+	require.Len(t, got.System, 1)
+	assert.Equal(t, "text", got.System[0].Type)
+	assert.Equal(t, "You are a web server.", got.System[0].Text)
+	assert.Equal(t, "ephemeral", got.System[0].CacheControl.Type)
+	assert.Len(t, got.Messages, 1)
+}
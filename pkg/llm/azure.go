@@ -0,0 +1,42 @@
+package llm
+
+import (
+	"fmt"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// defaultAzureAPIVersion is the Azure OpenAI API version used if none is set.
+const defaultAzureAPIVersion = "2024-02-01"
+
+func initAzureOpenAIClient(config Config) (llms.Model, error) {
+	if config.APIKey == "" {
+		return nil, fmt.Errorf("API key is required")
+	}
+	if config.ServerURL == "" {
+		return nil, fmt.Errorf("Server URL (the Azure OpenAI endpoint) is required")
+	}
+	deployment := config.Deployment
+	if deployment == "" {
+		deployment = config.Model
+	}
+	apiVersion := config.APIVersion
+	if apiVersion == "" {
+		apiVersion = defaultAzureAPIVersion
+	}
+
+	opts := []openai.Option{
+		openai.WithAPIType(openai.APITypeAzure),
+		openai.WithBaseURL(config.ServerURL),
+		openai.WithAPIVersion(apiVersion),
+		openai.WithModel(deployment),
+		openai.WithEmbeddingModel(deployment),
+		openai.WithToken(config.APIKey),
+	}
+	m, err := openai.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,45 @@
+package llm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestAzureOpenAIProvider(t *testing.T) {
+	var gotPath, gotVersion, gotKey string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotVersion, gotKey = r.URL.Path, r.URL.Query().Get("api-version"), r.Header.Get("api-key")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{\"headers\": {\"Server\": \"nginx\"}, \"body\": \"ok\"}"}, "finish_reason": "stop"}]}`))
+	}))
+	defer ts.Close()
+
+	config := llm.Config{
+		Provider:   "azure-openai",
+		Model:      "gpt-4o",
+		Deployment: "galah-gpt4o",
+		APIVersion: "2024-06-01",
+		APIKey:     "secret",
+		ServerURL:  ts.URL,
+	}
+	model, err := llm.New(context.Background(), config)
+	require.NoError(t, err)
+
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+	resp, err := llm.GenerateLLMResponse(context.Background(), model, config, messages)
+	require.NoError(t, err)
+	assert.Equal(t, `{"headers": {"Server": "nginx"}, "body": "ok"}`, resp)
+	assert.Equal(t, "/openai/deployments/galah-gpt4o/chat/completions", gotPath)
+	assert.Equal(t, "2024-06-01", gotVersion)
+	assert.Equal(t, "secret", gotKey)
+
+	_, err = llm.New(context.Background(), llm.Config{Provider: "azure-openai", Model: "gpt-4o", APIKey: "secret"})
+	assert.Error(t, err, "the endpoint is required")
+}
@@ -0,0 +1,42 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/bedrock"
+)
+
+// initBedrockClient initializes an AWS Bedrock client. Credentials are loaded
+// from the standard AWS credential chain (environment, shared config, or the
+// instance/task role), and requests are signed with SigV4. The server URL, if
+// set, overrides the Bedrock runtime endpoint (e.g. a VPC endpoint).
+func initBedrockClient(ctx context.Context, config Config) (llms.Model, error) {
+	var loadOpts []func(*awsconfig.LoadOptions) error
+	if config.CloudLocation != "" {
+		loadOpts = append(loadOpts, awsconfig.WithRegion(config.CloudLocation))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	client := bedrockruntime.NewFromConfig(awsCfg, func(o *bedrockruntime.Options) {
+		if config.ServerURL != "" {
+			o.BaseEndpoint = aws.String(config.ServerURL)
+		}
+	})
+
+	opts := []bedrock.Option{
+		bedrock.WithModel(config.Model),
+		bedrock.WithClient(client),
+	}
+	m, err := bedrock.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
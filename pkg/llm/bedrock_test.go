@@ -0,0 +1,46 @@
+package llm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestBedrockProvider(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+
+	var gotPath, gotAuth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"type": "message", "role": "assistant", "content": [{"type": "text", "text": "{\"headers\": {\"Server\": \"nginx\"}, \"body\": \"ok\"}"}], "stop_reason": "end_turn", "usage": {"input_tokens": 10, "output_tokens": 12}}`))
+	}))
+	defer ts.Close()
+
+	config := llm.Config{
+		Provider:      "bedrock",
+		Model:         "anthropic.claude-3-haiku-20240307-v1:0",
+		CloudLocation: "us-east-1",
+		ServerURL:     ts.URL,
+	}
+	model, err := llm.New(context.Background(), config)
+	require.NoError(t, err)
+
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+	resp, err := llm.GenerateLLMResponse(context.Background(), model, config, messages)
+	require.NoError(t, err)
+	assert.Equal(t, `{"headers": {"Server": "nginx"}, "body": "ok"}`, resp)
+	assert.Contains(t, gotPath, "/model/anthropic.claude-3-haiku-20240307-v1")
+	assert.True(t, strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), "request should be signed with SigV4, got %q", gotAuth)
+	assert.Contains(t, gotAuth, "/us-east-1/bedrock/aws4_request")
+}
@@ -0,0 +1,157 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Media types of bodies that are always summarized instead of included.
+var binaryMediaPrefixes = []string{
+	"image/",
+	"audio/",
+	"video/",
+	"font/",
+	"application/octet-stream",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/pdf",
+	"application/x-protobuf",
+	"application/grpc",
+}
+
+// bodyTailShare is the share of the truncated body kept from its end. The
+// rest is kept from its start.
+const bodyTailShare = 3
+
+// dumpRequest returns the wire representation of the request with the body
+// presented in the clearest form for its content type: JSON bodies are
+// indented, form-urlencoded bodies are decoded into key/value pairs, and
+// binary bodies are replaced by a size and type summary. If maxTokens is
+// positive and the dump is estimated to exceed it, the middle of the body is
+// cut out, the headers are always kept. A body truncated when it was read
+// ends with a note about the truncation. The request body is restored so it
+// can be read again.
+func dumpRequest(r *http.Request, maxTokens int) (string, error) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			return "", err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	head, err := httputil.DumpRequest(r, false)
+	if err != nil {
+		return "", err
+	}
+
+	presented := presentBody(r.Header, body)
+	if maxTokens > 0 {
+		presented = truncateMiddle(presented, (maxTokens-EstimateTokens(string(head)))*4)
+	}
+	if rb, ok := RequestBodyFrom(r.Context()); ok && rb.Truncated {
+		presented += "\n" + rb.Marker()
+	}
+	return string(head) + presented, nil
+}
+
+// truncateMiddle keeps the start and the end of s within maxLen bytes and
+// replaces the rest with a note about the truncation.
+func truncateMiddle(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	if maxLen < 0 {
+		maxLen = 0
+	}
+
+	tailLen := maxLen / bodyTailShare
+	head := s[:runeBoundary(s, maxLen-tailLen)]
+	tail := s[runeBoundary(s, len(s)-tailLen):]
+	return fmt.Sprintf("%s\n[... %d bytes of the body truncated ...]\n%s", head, len(s)-len(head)-len(tail), tail)
+}
+
+// runeBoundary returns the largest offset not after i that starts a UTF-8
+// character in s.
+func runeBoundary(s string, i int) int {
+	for i > 0 && i < len(s) && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
+
+// presentBody returns the body in the clearest form for its content type,
+// decoded from its declared charset.
+func presentBody(header http.Header, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	body = DecodeCharset(header.Get("Content-Type"), body)
+	switch {
+	case header.Get("Content-Encoding") != "" && header.Get("Content-Encoding") != "identity",
+		isBinaryMediaType(mediaType),
+		IsBinary(body):
+		return binarySummary(mediaType, body)
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var b bytes.Buffer
+		if err := json.Indent(&b, body, "", "  "); err == nil {
+			return b.String()
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			return formSummary(values)
+		}
+	}
+
+	return string(body)
+}
+
+func isBinaryMediaType(mediaType string) bool {
+	for _, prefix := range binaryMediaPrefixes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func binarySummary(mediaType string, body []byte) string {
+	detected, _, _ := strings.Cut(http.DetectContentType(body), ";")
+	if mediaType == "" {
+		mediaType = "unspecified"
+	}
+	return fmt.Sprintf("[binary body: %d bytes, declared type %s, detected type %s]", len(body), mediaType, detected)
+}
+
+// formSummary returns the decoded form values, one "key = value" pair per
+// line in key order.
+func formSummary(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("[form-urlencoded body, decoded]\n")
+	for _, k := range keys {
+		for _, v := range values[k] {
+			fmt.Fprintf(&b, "%s = %s\n", k, v)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,121 @@
+package llm_test
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateMessageContentBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+		notWant     string
+	}{
+		{
+			name:        "jsonBodyIsIndented",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"username":"admin","roles":["root"]}`,
+			want:        "{\n  \"username\": \"admin\",\n  \"roles\": [\n    \"root\"\n  ]\n}",
+		},
+		{
+			name:        "formBodyIsDecoded",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "user=admin&pass=p%40ss+word&cmd=%3Bid",
+			want:        "[form-urlencoded body, decoded]\ncmd = ;id\npass = p@ss word\nuser = admin",
+			notWant:     "p%40ss",
+		},
+		{
+			name:        "binaryBodyIsSummarized",
+			contentType: "application/octet-stream",
+			body:        "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+			want:        "[binary body: 16 bytes, declared type application/octet-stream, detected type image/png]",
+			notWant:     "IHDR",
+		},
+		{
+			name:        "undeclaredBinaryBodyIsSummarized",
+			contentType: "text/plain",
+			body:        "\x00\x01\x02\xff",
+			want:        "[binary body: 4 bytes, declared type text/plain, detected type application/octet-stream]",
+		},
+		{
+			name:        "declaredCharsetIsDecoded",
+			contentType: "text/plain; charset=windows-1252",
+			body:        "na\xefve \x93quoted\x94",
+			want:        "naïve “quoted”",
+		},
+		{
+			name:        "textBodyIsUnchanged",
+			contentType: "text/xml",
+			body:        "<methodCall><methodName>system.listMethods</methodName></methodCall>",
+			want:        "\r\n\r\n<methodCall><methodName>system.listMethods</methodName></methodCall>",
+		},
+	}
+
+	cfg := &config.Config{SystemPrompt: "system prompt", UserPrompt: "%s"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/login", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			messages, err := llm.CreateMessageContent(r, cfg, "openai", nil)
+			require.NoError(t, err)
+			userPrompt := fmt.Sprint(messages[1].Parts[0])
+			assert.Contains(t, userPrompt, "POST /api/login HTTP/1.1")
+			assert.Contains(t, userPrompt, tt.want)
+			if tt.notWant != "" {
+				assert.NotContains(t, userPrompt, tt.notWant)
+			}
+
+			// The body can still be read after the message is created.
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.body, string(body))
+		})
+	}
+}
+
+func TestCreateMessageContentTruncatesBody(t *testing.T) {
+	cfg := &config.Config{SystemPrompt: "system prompt", UserPrompt: "%s", MaxRequestTokens: 100}
+	body := "start-" + strings.Repeat("é", 5000) + "-end"
+	r := httptest.NewRequest("POST", "/upload", strings.NewReader(body))
+	r.Header.Set("Content-Type", "text/plain")
+	r.Header.Set("X-Custom", "kept")
+
+	messages, err := llm.CreateMessageContent(r, cfg, "openai", nil)
+	require.NoError(t, err)
+	prompt := fmt.Sprint(messages[1].Parts[0])
+
+	assert.Contains(t, prompt, "X-Custom: kept")
+	assert.Contains(t, prompt, "start-")
+	assert.Contains(t, prompt, "-end")
+	assert.Regexp(t, `\[\.\.\. \d+ bytes of the body truncated \.\.\.\]`, prompt)
+	assert.Less(t, len(prompt), 600)
+	assert.True(t, utf8.ValidString(prompt))
+
+	// The body can still be read.
+	restored, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(restored))
+}
+
+func TestCreateMessageContentMarksTruncatedBody(t *testing.T) {
+	cfg := &config.Config{SystemPrompt: "system prompt", UserPrompt: "%s"}
+	r := httptest.NewRequest("POST", "/upload", strings.NewReader("cmd=id"))
+	r.Header.Set("Content-Type", "text/plain")
+	r = r.WithContext(llm.WithRequestBody(r.Context(), llm.RequestBody{Truncated: true, Size: 6}))
+
+	messages, err := llm.CreateMessageContent(r, cfg, "openai", nil)
+	require.NoError(t, err)
+	assert.Contains(t, fmt.Sprint(messages[1].Parts[0]), "cmd=id\n[... request body truncated at 6 bytes ...]")
+}
@@ -0,0 +1,342 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Parser states of a BodyStream.
+const (
+	bodyStreamSeekObject = iota
+	bodyStreamSeekKey
+	bodyStreamInKey
+	bodyStreamSeekColon
+	bodyStreamSeekValue
+	bodyStreamValue
+	bodyStreamBody
+	bodyStreamDone
+)
+
+// BodyStream parses the JSON response of the model while it is being
+// generated and passes the headers and the decoded body to the given writers
+// as soon as they are available, so the response can be sent to the client in
+// chunks. The body is only streamed if the model generates the headers first;
+// otherwise nothing is written and the response is sent once complete. The
+// headers are written when the body starts, along with the status code if it
+// was generated before the body (200 otherwise).
+//
+// Once something was written, the output of later generations (e.g. retries
+// or corrections) is ignored, as the client has already received a response.
+type BodyStream struct {
+	writeHeaders func(headers map[string]string, statusCode int)
+	writeBody    func(chunk string)
+
+	mu       sync.Mutex
+	started  bool
+	detached bool
+	bodyParser
+}
+
+// bodyParser is the state of the parser, reset for each generation.
+type bodyParser struct {
+	state      int
+	key        strings.Builder
+	escaped    bool
+	value      strings.Builder
+	depth      int
+	inString   bool
+	headers    map[string]string
+	statusCode int
+	unicode    strings.Builder
+	inUnicode  bool
+	highSurr   rune
+	out        strings.Builder
+}
+
+// NewBodyStream returns a BodyStream writing the headers and the body with
+// the given functions.
+func NewBodyStream(writeHeaders func(headers map[string]string, statusCode int), writeBody func(chunk string)) *BodyStream {
+	return &BodyStream{writeHeaders: writeHeaders, writeBody: writeBody}
+}
+
+// Started reports whether the headers were written. It returns false for a
+// nil stream.
+func (s *BodyStream) Started() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+// StatusCode returns the status code of the headers written, 0 if they have
+// the default status or weren't written.
+func (s *BodyStream) StatusCode() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		return 0
+	}
+	return s.statusCode
+}
+
+type bodyStreamKey struct{}
+
+// WithBodyStream returns a copy of ctx with which the generated responses are
+// streamed to s.
+func WithBodyStream(ctx context.Context, s *BodyStream) context.Context {
+	return context.WithValue(ctx, bodyStreamKey{}, s)
+}
+
+func bodyStreamFrom(ctx context.Context) *BodyStream {
+	s, _ := ctx.Value(bodyStreamKey{}).(*BodyStream)
+	return s
+}
+
+// begin prepares the stream for a new generation.
+func (s *BodyStream) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		s.detached = true
+		return
+	}
+	s.bodyParser = bodyParser{}
+}
+
+// consume parses a streamed chunk of the generation.
+func (s *BodyStream) consume(chunk []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.detached {
+		return
+	}
+	for i := 0; i < len(chunk); {
+		if s.step(chunk[i]) {
+			i++
+		}
+		if s.detached {
+			return
+		}
+	}
+	if s.out.Len() > 0 {
+		s.writeBody(s.out.String())
+		s.out.Reset()
+	}
+}
+
+// step processes a byte of the generation and reports whether it was
+// consumed. A byte ending a literal value is processed again as the start of
+// the next key.
+func (s *BodyStream) step(c byte) bool {
+	switch s.state {
+	case bodyStreamSeekObject:
+		if c == '{' {
+			s.state = bodyStreamSeekKey
+		}
+	case bodyStreamSeekKey:
+		switch c {
+		case '"':
+			s.key.Reset()
+			s.state = bodyStreamInKey
+		case '}':
+			s.state = bodyStreamDone
+		}
+	case bodyStreamInKey:
+		switch {
+		case s.escaped:
+			s.key.WriteByte(c)
+			s.escaped = false
+		case c == '\\':
+			s.escaped = true
+		case c == '"':
+			s.state = bodyStreamSeekColon
+		default:
+			s.key.WriteByte(c)
+		}
+	case bodyStreamSeekColon:
+		if c == ':' {
+			s.state = bodyStreamSeekValue
+		}
+	case bodyStreamSeekValue:
+		if isJSONSpace(c) {
+			return true
+		}
+		if s.key.String() == "body" {
+			if s.headers == nil || c != '"' {
+				s.detached = true
+				return true
+			}
+			s.started = true
+			s.writeHeaders(s.headers, s.statusCode)
+			s.state = bodyStreamBody
+			return true
+		}
+		s.value.Reset()
+		s.depth, s.inString, s.escaped = 0, false, false
+		s.state = bodyStreamValue
+		return s.stepValue(c)
+	case bodyStreamValue:
+		return s.stepValue(c)
+	case bodyStreamBody:
+		s.stepBody(c)
+	}
+	return true
+}
+
+// stepValue captures the raw JSON value of a key other than the body.
+func (s *BodyStream) stepValue(c byte) bool {
+	if s.inString {
+		s.value.WriteByte(c)
+		switch {
+		case s.escaped:
+			s.escaped = false
+		case c == '\\':
+			s.escaped = true
+		case c == '"':
+			s.inString = false
+			if s.depth == 0 {
+				s.endValue()
+			}
+		}
+		return true
+	}
+
+	switch c {
+	case '"':
+		s.inString = true
+	case '{', '[':
+		s.depth++
+	case '}', ']', ',':
+		if s.depth == 0 {
+			// The end of a literal value (e.g. a number).
+			s.endValue()
+			return false
+		}
+		if c != ',' {
+			s.depth--
+		}
+	}
+	s.value.WriteByte(c)
+	if s.depth == 0 && (c == '}' || c == ']') {
+		s.endValue()
+	}
+	return true
+}
+
+func (s *BodyStream) endValue() {
+	s.state = bodyStreamSeekKey
+
+	var err error
+	switch s.key.String() {
+	case "headers":
+		err = json.Unmarshal([]byte(s.value.String()), &s.headers)
+		if s.headers == nil {
+			s.headers = map[string]string{}
+		}
+	case "encoding":
+		// Encoded bodies are only sent once complete.
+		var encoding string
+		err = json.Unmarshal([]byte(s.value.String()), &encoding)
+		if encoding != "" {
+			s.detached = true
+		}
+	case "status_code":
+		err = json.Unmarshal([]byte(s.value.String()), &s.statusCode)
+		if s.statusCode != 0 && (s.statusCode < 200 || s.statusCode > 599) {
+			s.detached = true
+		}
+	}
+	if err != nil {
+		s.detached = true
+	}
+}
+
+// stepBody decodes a byte of the body string.
+func (s *BodyStream) stepBody(c byte) {
+	switch {
+	case s.inUnicode:
+		s.unicode.WriteByte(c)
+		if s.unicode.Len() == 4 {
+			s.inUnicode = false
+			n, err := strconv.ParseUint(s.unicode.String(), 16, 16)
+			if err != nil {
+				s.writeRune(utf8.RuneError)
+				return
+			}
+			s.writeRune(rune(n))
+		}
+		return
+	case s.escaped:
+		s.escaped = false
+		if c == 'u' {
+			s.inUnicode = true
+			s.unicode.Reset()
+			return
+		}
+		s.writeRune(rune(unescapeJSON(c)))
+		return
+	case c == '\\':
+		s.escaped = true
+		return
+	case c == '"':
+		s.writeRune(-1)
+		s.state = bodyStreamDone
+		return
+	}
+	s.writeRune(-1)
+	s.out.WriteByte(c)
+}
+
+// writeRune writes a decoded rune, combining UTF-16 surrogate pairs. A rune
+// of -1 only flushes a pending high surrogate.
+func (s *BodyStream) writeRune(r rune) {
+	if s.highSurr != 0 {
+		high := s.highSurr
+		s.highSurr = 0
+		if r != -1 && utf16.IsSurrogate(r) {
+			s.out.WriteRune(utf16.DecodeRune(high, r))
+			return
+		}
+		s.out.WriteRune(utf8.RuneError)
+	}
+	switch {
+	case r == -1:
+	case utf16.IsSurrogate(r):
+		s.highSurr = r
+	default:
+		s.out.WriteRune(r)
+	}
+}
+
+func unescapeJSON(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	case 'b':
+		return '\b'
+	case 'f':
+		return '\f'
+	}
+	// \", \\ and \/
+	return c
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,126 @@
+package llm_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// splitChunks splits the content in chunks of the given size.
+func splitChunks(content string, size int) []string {
+	var chunks []string
+	for i := 0; i < len(content); i += size {
+		chunks = append(chunks, content[i:min(i+size, len(content))])
+	}
+	return chunks
+}
+
+type recordedStream struct {
+	headers map[string]string
+	status  int
+	body    strings.Builder
+	chunks  int
+}
+
+func (r *recordedStream) stream() *llm.BodyStream {
+	return llm.NewBodyStream(
+		func(headers map[string]string, statusCode int) { r.headers, r.status = headers, statusCode },
+		func(chunk string) {
+			r.body.WriteString(chunk)
+			r.chunks++
+		},
+	)
+}
+
+func TestBodyStream(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantStarted bool
+		wantHeaders map[string]string
+		wantStatus  int
+		wantBody    string
+		wantErr     bool
+	}{
+		{
+			name:        "headersFirst",
+			content:     "```json\n{\"headers\": {\"Server\": \"nginx\", \"X-Note\": \"a \\\"b\\\" {c}\"}, \"body\": \"<h1>caf\\u00e9 \\ud83d\\ude00</h1>\\n\\t\\\"ok\\\"\\\\\"}\n```",
+			wantStarted: true,
+			wantHeaders: map[string]string{"Server": "nginx", "X-Note": `a "b" {c}`},
+			wantBody:    "<h1>café 😀</h1>\n\t\"ok\"\\",
+		},
+		{
+			name:        "otherKeysAreSkipped",
+			content:     `{"status": 200, "tags": ["a", {"b": "}"}], "headers": {"Server": "nginx"}, "body": "ok", "extra": true}`,
+			wantStarted: true,
+			wantHeaders: map[string]string{"Server": "nginx"},
+			wantBody:    "ok",
+		},
+		{
+			name:        "statusCode",
+			content:     `{"headers": {"Location": "/login"}, "status_code": 302, "body": "Found"}`,
+			wantStarted: true,
+			wantHeaders: map[string]string{"Location": "/login"},
+			wantStatus:  302,
+			wantBody:    "Found",
+		},
+		{
+			name:    "invalidStatusCodeIsNotStreamed",
+			content: `{"status_code": 99, "headers": {"Server": "nginx"}, "body": "ok"}`,
+			wantErr: true,
+		},
+		{
+			name:    "encodedBodyIsNotStreamed",
+			content: `{"headers": {"Content-Type": "image/x-icon"}, "encoding": "base64", "body": "AAABAAEAEBA="}`,
+		},
+		{
+			name:    "bodyFirstIsNotStreamed",
+			content: `{"body": "ok", "headers": {"Server": "nginx"}}`,
+		},
+		{
+			name:    "invalidHeadersAreNotStreamed",
+			content: `{"headers": {"Server": ["nginx"]}, "body": "ok"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rec recordedStream
+			stream := rec.stream()
+			ctx := llm.WithBodyStream(context.Background(), stream)
+			config := llm.Config{Provider: "openai"}
+
+			_, err := llm.GenerateLLMResponse(ctx, streamingModel(splitChunks(tt.content, 3), new(int)), config, nil)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantStarted, stream.Started())
+			assert.Equal(t, tt.wantHeaders, rec.headers)
+			assert.Equal(t, tt.wantStatus, rec.status)
+			assert.Equal(t, tt.wantBody, rec.body.String())
+		})
+	}
+}
+
+func TestBodyStreamIgnoresLaterGenerations(t *testing.T) {
+	var rec recordedStream
+	ctx := llm.WithBodyStream(context.Background(), rec.stream())
+	config := llm.Config{Provider: "openai"}
+
+	_, err := llm.GenerateLLMResponse(ctx, streamingModel(splitChunks(`{"headers": {"Server": "nginx"}, "body": "first"}`, 2), new(int)), config, nil)
+	require.NoError(t, err)
+	_, err = llm.GenerateLLMResponse(ctx, streamingModel(splitChunks(`{"headers": {"Server": "apache"}, "body": "second"}`, 2), new(int)), config, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "nginx", rec.headers["Server"])
+	assert.Equal(t, "first", rec.body.String())
+	assert.Greater(t, rec.chunks, 1)
+}
+
+func TestBodyStreamNil(t *testing.T) {
+	var stream *llm.BodyStream
+	assert.False(t, stream.Started())
+}
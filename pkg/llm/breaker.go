@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ErrCircuitOpen is returned without calling the provider while its circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("circuitOpen: the llm provider is failing, skipping generation")
+
+// Circuit breaker states.
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// CircuitBreaker stops calling a provider after consecutive failures. Once
+// the cooldown has elapsed, a single trial call is let through: if it
+// succeeds the circuit closes, otherwise it opens again.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreaker returns a breaker that opens after threshold consecutive
+// failures and stays open for cooldown.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Wrap returns a model whose calls go through the breaker.
+func (b *CircuitBreaker) Wrap(model llms.Model) llms.Model {
+	return &breakerModel{Model: model, breaker: b}
+}
+
+// allow reports whether a call may be made.
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		remaining := b.cooldown - time.Since(b.openedAt)
+		if remaining > 0 {
+			return fmt.Errorf("%w (retrying in %s)", ErrCircuitOpen, remaining.Round(time.Second))
+		}
+		b.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		return fmt.Errorf("%w (trial call in progress)", ErrCircuitOpen)
+	}
+	return nil
+}
+
+// record updates the breaker with the result of a call.
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.state, b.failures = circuitClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state, b.openedAt = circuitOpen, time.Now()
+	}
+}
+
+// release returns a half-open breaker whose trial call was canceled to the
+// open state, so that the next call after the cooldown becomes the trial.
+func (b *CircuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitHalfOpen {
+		b.state = circuitOpen
+	}
+}
+
+type breakerModel struct {
+	llms.Model
+	breaker *CircuitBreaker
+}
+
+func (m *breakerModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	if err := m.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	resp, err := m.Model.GenerateContent(ctx, messages, options...)
+	// Calls canceled by the client don't say anything about the provider.
+	if err != nil && ctx.Err() != nil {
+		m.breaker.release()
+		return resp, err
+	}
+	m.breaker.record(err)
+	return resp, err
+}
@@ -0,0 +1,85 @@
+package llm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// failingModel fails until it is marked as recovered.
+type failingModel struct {
+	recovered bool
+	calls     int
+}
+
+func (m *failingModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.calls++
+	if !m.recovered {
+		return nil, errors.New("503 Service Unavailable")
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		Content: `{"headers": {"Server": "nginx"}, "body": "ok"}`,
+	}}}, nil
+}
+
+func (m *failingModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return "", nil
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	inner := &failingModel{}
+	model := llm.NewCircuitBreaker(2, 50*time.Millisecond).Wrap(inner)
+	config := llm.Config{Provider: "openai", Model: "gpt-4o"}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := llm.GenerateLLMResponse(ctx, model, config, messages)
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, llm.ErrCircuitOpen)
+	}
+
+	// The circuit is open, the provider is not called.
+	_, err := llm.GenerateLLMResponse(ctx, model, config, messages)
+	assert.ErrorIs(t, err, llm.ErrCircuitOpen)
+	assert.Equal(t, llm.ErrorKindCircuitOpen, llm.ErrorKind(err))
+	assert.Equal(t, 2, inner.calls)
+
+	// After the cooldown, a failed trial call opens the circuit again.
+	time.Sleep(60 * time.Millisecond)
+	_, err = llm.GenerateLLMResponse(ctx, model, config, messages)
+	assert.NotErrorIs(t, err, llm.ErrCircuitOpen)
+	_, err = llm.GenerateLLMResponse(ctx, model, config, messages)
+	assert.ErrorIs(t, err, llm.ErrCircuitOpen)
+	assert.Equal(t, 3, inner.calls)
+
+	// A successful trial call closes it.
+	inner.recovered = true
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		_, err = llm.GenerateLLMResponse(ctx, model, config, messages)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 5, inner.calls)
+}
+
+func TestCircuitBreakerIgnoresCanceledCalls(t *testing.T) {
+	inner := &failingModel{}
+	model := llm.NewCircuitBreaker(1, time.Minute).Wrap(inner)
+	config := llm.Config{Provider: "openai", Model: "gpt-4o"}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := llm.GenerateLLMResponse(ctx, model, config, messages)
+	require.Error(t, err)
+
+	_, err = llm.GenerateLLMResponse(context.Background(), model, config, messages)
+	assert.NotErrorIs(t, err, llm.ErrCircuitOpen, "a canceled call should not open the circuit")
+}
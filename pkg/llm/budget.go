@@ -0,0 +1,198 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ErrBudgetExceeded is returned without calling the provider when the daily
+// or monthly budget of the generations is spent.
+var ErrBudgetExceeded = errors.New("budgetExceeded: the llm budget is exceeded")
+
+// BudgetConfig holds the daily and monthly budgets of the generations of all
+// the models, in estimated cost (USD) and tokens. A zero value disables the
+// corresponding budget. The days and months start at midnight in Location,
+// UTC if nil. With Shared, the usage of the periods is counted with the
+// other honeypot instances.
+type BudgetConfig struct {
+	DailyCost     float64
+	DailyTokens   int
+	MonthlyCost   float64
+	MonthlyTokens int
+	Location      *time.Location
+	Shared        BudgetCounter
+}
+
+// BudgetCounter counts the usage of the budget periods shared by several
+// honeypot instances. AddUsage adds the usage of a generation to the period
+// of the name ("daily" or "monthly") starting at start, and returns the usage
+// of the period by all the instances.
+type BudgetCounter interface {
+	AddUsage(period string, start time.Time, tokens int, cost float64) (int, float64, error)
+}
+
+// enabled reports whether any budget is set.
+func (c BudgetConfig) enabled() bool {
+	return c.DailyCost > 0 || c.DailyTokens > 0 || c.MonthlyCost > 0 || c.MonthlyTokens > 0
+}
+
+// BudgetPeriod is the usage of a budget period.
+type BudgetPeriod struct {
+	Start    time.Time `json:"start"`
+	Tokens   int       `json:"tokens"`
+	Cost     float64   `json:"estimatedCost"`
+	Exceeded bool      `json:"exceeded"`
+}
+
+// BudgetStatus is the usage of the current day and month.
+type BudgetStatus struct {
+	Day   BudgetPeriod `json:"day"`
+	Month BudgetPeriod `json:"month"`
+}
+
+// Budget stops the generations of the wrapped models once the daily or
+// monthly budget is spent, until the next period. The usage is counted
+// since the start of the honeypot, or with the other instances with a shared
+// counter, whose usage is seen at the next generation of the instance. The
+// usage is counted locally if the shared counter fails.
+type Budget struct {
+	cfg        BudgetConfig
+	onExceeded func(period string, usage BudgetPeriod)
+	now        func() time.Time
+
+	mu    sync.Mutex
+	day   BudgetPeriod
+	month BudgetPeriod
+}
+
+// NewBudget returns the budget of the configuration, or nil if no budget is
+// set. onExceeded, if not nil, is called once when the budget of a period,
+// "daily" or "monthly", is spent.
+func NewBudget(cfg BudgetConfig, onExceeded func(period string, usage BudgetPeriod)) *Budget {
+	if !cfg.enabled() {
+		return nil
+	}
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+	return &Budget{cfg: cfg, onExceeded: onExceeded, now: time.Now}
+}
+
+// Wrap returns a model whose generations are counted in the budget under
+// the given model name, for its pricing, and fail with ErrBudgetExceeded once
+// the budget is spent.
+func (b *Budget) Wrap(model llms.Model, name string) llms.Model {
+	return &budgetModel{Model: model, budget: b, name: name}
+}
+
+// Status returns the usage of the current periods.
+func (b *Budget) Status() BudgetStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	return BudgetStatus{Day: b.day, Month: b.month}
+}
+
+// roll starts the new periods. It must be called with b.mu held.
+func (b *Budget) roll() {
+	now := b.now().In(b.cfg.Location)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, b.cfg.Location)
+	if !b.day.Start.Equal(day) {
+		b.day = BudgetPeriod{Start: day}
+	}
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, b.cfg.Location)
+	if !b.month.Start.Equal(month) {
+		b.month = BudgetPeriod{Start: month}
+	}
+}
+
+// check returns ErrBudgetExceeded if the budget of a current period is spent.
+func (b *Budget) check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	if b.day.Exceeded {
+		return fmt.Errorf("%w: daily budget spent", ErrBudgetExceeded)
+	}
+	if b.month.Exceeded {
+		return fmt.Errorf("%w: monthly budget spent", ErrBudgetExceeded)
+	}
+	return nil
+}
+
+// record adds the usage of a generation to the current periods.
+func (b *Budget) record(tokens int, cost float64) {
+	b.mu.Lock()
+	b.roll()
+	starts := map[string]time.Time{"daily": b.day.Start, "monthly": b.month.Start}
+	b.mu.Unlock()
+
+	shared := map[string]BudgetPeriod{}
+	if b.cfg.Shared != nil {
+		for name, start := range starts {
+			if t, c, err := b.cfg.Shared.AddUsage(name, start, tokens, cost); err == nil {
+				shared[name] = BudgetPeriod{Start: start, Tokens: t, Cost: c}
+			}
+		}
+	}
+
+	b.mu.Lock()
+	b.roll()
+	exceeded := map[string]BudgetPeriod{}
+	for _, p := range []struct {
+		name      string
+		period    *BudgetPeriod
+		maxCost   float64
+		maxTokens int
+	}{
+		{"daily", &b.day, b.cfg.DailyCost, b.cfg.DailyTokens},
+		{"monthly", &b.month, b.cfg.MonthlyCost, b.cfg.MonthlyTokens},
+	} {
+		if usage, ok := shared[p.name]; ok && usage.Start.Equal(p.period.Start) {
+			p.period.Tokens, p.period.Cost = usage.Tokens, usage.Cost
+		} else {
+			p.period.Tokens += tokens
+			p.period.Cost += cost
+		}
+		if p.period.Exceeded {
+			continue
+		}
+		if (p.maxCost > 0 && p.period.Cost >= p.maxCost) || (p.maxTokens > 0 && p.period.Tokens >= p.maxTokens) {
+			p.period.Exceeded = true
+			exceeded[p.name] = *p.period
+		}
+	}
+	b.mu.Unlock()
+
+	if b.onExceeded == nil {
+		return
+	}
+	for name, usage := range exceeded {
+		b.onExceeded(name, usage)
+	}
+}
+
+type budgetModel struct {
+	llms.Model
+	budget *Budget
+	name   string
+}
+
+func (m *budgetModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	if err := m.budget.check(); err != nil {
+		return nil, err
+	}
+	resp, in, out, _, counted, err := generateCounted(ctx, m.Model, messages, options)
+	if !counted {
+		return resp, err
+	}
+
+	pricing, _ := PricingFor(m.name)
+	m.budget.record(in+out, pricing.Cost(in, out))
+	return resp, err
+}
@@ -0,0 +1,78 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestBudget(t *testing.T) {
+	assert.Nil(t, llm.NewBudget(llm.BudgetConfig{}, nil), "no budget should be enabled without limits")
+
+	var exceeded []string
+	budget := llm.NewBudget(llm.BudgetConfig{DailyTokens: 1500, MonthlyCost: 100}, func(period string, usage llm.BudgetPeriod) {
+		exceeded = append(exceeded, period)
+		assert.Equal(t, 1800, usage.Tokens)
+	})
+	inner := &usageModel{promptTokens: 500, completionTokens: 400}
+	model := budget.Wrap(inner, "gpt-4o")
+	config := llm.Config{Provider: "openai", Model: "gpt-4o"}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+
+	for i := 0; i < 2; i++ {
+		_, err := llm.GenerateLLMResponse(context.Background(), model, config, messages)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"daily"}, exceeded)
+
+	// The other models share the budget.
+	other := &usageModel{promptTokens: 500, completionTokens: 400}
+	_, err := llm.GenerateLLMResponse(context.Background(), budget.Wrap(other, "gpt-4o-mini"), config, messages)
+	assert.ErrorIs(t, err, llm.ErrBudgetExceeded)
+	assert.Equal(t, llm.ErrorKindBudgetExceeded, llm.ErrorKind(err))
+	assert.Equal(t, 0, other.calls, "generation over the budget should not reach the provider")
+
+	status := budget.Status()
+	assert.True(t, status.Day.Exceeded)
+	assert.False(t, status.Month.Exceeded)
+	assert.Equal(t, 1800, status.Month.Tokens)
+	assert.Greater(t, status.Month.Cost, 0.0)
+	assert.Equal(t, 1, status.Month.Start.Day())
+}
+
+// sharedCounter is a BudgetCounter with the usage of another instance.
+type sharedCounter struct {
+	tokens map[string]int
+	cost   map[string]float64
+}
+
+func (c *sharedCounter) AddUsage(period string, start time.Time, tokens int, cost float64) (int, float64, error) {
+	c.tokens[period] += tokens
+	c.cost[period] += cost
+	return c.tokens[period], c.cost[period], nil
+}
+
+func TestBudgetShared(t *testing.T) {
+	counter := &sharedCounter{tokens: map[string]int{"daily": 1000, "monthly": 1000}, cost: map[string]float64{}}
+	var exceeded []string
+	budget := llm.NewBudget(llm.BudgetConfig{DailyTokens: 1500, Shared: counter}, func(period string, usage llm.BudgetPeriod) {
+		exceeded = append(exceeded, period)
+		assert.Equal(t, 1900, usage.Tokens)
+	})
+	model := budget.Wrap(&usageModel{promptTokens: 500, completionTokens: 400}, "gpt-4o")
+	config := llm.Config{Provider: "openai", Model: "gpt-4o"}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+
+	// The usage of the other instances counts toward the budget.
+	_, err := llm.GenerateLLMResponse(context.Background(), model, config, messages)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"daily"}, exceeded)
+	assert.Equal(t, 1900, budget.Status().Month.Tokens)
+	_, err = llm.GenerateLLMResponse(context.Background(), model, config, messages)
+	assert.ErrorIs(t, err, llm.ErrBudgetExceeded)
+}
@@ -0,0 +1,65 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Provider pairs an initialized LLM client with its configuration.
+type Provider struct {
+	Config Config
+	Model  llms.Model
+}
+
+// Chain is an ordered list of providers. If a provider fails or returns an
+// invalid response, the next one is tried.
+type Chain []Provider
+
+// Generate returns the first valid response produced by the chain along with
+// the configuration of the provider that served it. The messages are built
+// for each provider separately, so that the system prompt and JSON mode
+// handling match that provider's capabilities rather than the primary's.
+func (c Chain) Generate(ctx context.Context, r *http.Request, cfg *config.Config, history *History) (string, Config, error) {
+	_, raw, served, err := c.GenerateJSONResponse(ctx, r, cfg, history)
+	return raw, served, err
+}
+
+// GenerateJSONResponse returns the first valid response produced by the
+// chain like Generate, decoded (see GenerateJSONResponse) along with the raw
+// output of the model.
+func (c Chain) GenerateJSONResponse(ctx context.Context, r *http.Request, cfg *config.Config, history *History) (JSONResponse, string, Config, error) {
+	if len(c) == 0 {
+		return JSONResponse{}, "", Config{}, ErrNoProviders
+	}
+
+	var (
+		raw  string
+		last Config
+		errs []error
+	)
+	for _, p := range c {
+		last = p.Config
+		messages, err := CreateMessageContent(r, cfg, p.Config.Provider, history)
+		if err != nil {
+			return JSONResponse{}, "", p.Config, err
+		}
+
+		var resp JSONResponse
+		resp, raw, err = GenerateJSONResponse(ctx, p.Model, p.Config, messages)
+		if err == nil {
+			return resp, raw, p.Config, nil
+		}
+		errs = append(errs, fmt.Errorf("%s/%s: %w", p.Config.Provider, p.Config.Model, err))
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return JSONResponse{}, raw, last, errors.Join(errs...)
+}
@@ -0,0 +1,110 @@
+package llm_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+type recordedCall struct {
+	jsonMode bool
+	roles    []llms.ChatMessageType
+	prompt   string
+}
+
+func recordingModel(calls *[]recordedCall, content string, err error) *MockModel {
+	return &MockModel{
+		GenerateContentFunc: func(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+			var o llms.CallOptions
+			for _, opt := range opts {
+				opt(&o)
+			}
+			call := recordedCall{jsonMode: o.JSONMode}
+			for _, m := range messages {
+				call.roles = append(call.roles, m.Role)
+			}
+			call.prompt = fmt.Sprint(messages[len(messages)-1].Parts[0])
+			*calls = append(*calls, call)
+
+			if err != nil {
+				return nil, err
+			}
+			return &llms.ContentResponse{
+				Choices: []*llms.ContentChoice{{Content: content}},
+			}, nil
+		},
+	}
+}
+
+func TestChainGenerate(t *testing.T) {
+	cfg := &config.Config{
+		SystemPrompt: "system prompt",
+		UserPrompt:   "request: %q",
+	}
+	valid := `{"headers": {"Server": "nginx"}, "body": "ok"}`
+
+	var openaiCalls, anthropicCalls, vertexCalls []recordedCall
+	chain := llm.Chain{
+		{
+			Config: llm.Config{Provider: "openai", Model: "gpt-4o"},
+			Model:  recordingModel(&openaiCalls, "", errors.New("rate limited")),
+		},
+		{
+			Config: llm.Config{Provider: "anthropic", Model: "claude-3-haiku"},
+			Model:  recordingModel(&anthropicCalls, "Sure! Here is the response.", nil),
+		},
+		{
+			Config: llm.Config{Provider: "gcp-vertex", Model: "gemini-1.5-pro"},
+			Model:  recordingModel(&vertexCalls, valid, nil),
+		},
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	resp, served, err := chain.Generate(context.Background(), r, cfg, nil)
+	require.NoError(t, err)
+	assert.Equal(t, valid, resp)
+	assert.Equal(t, "gcp-vertex", served.Provider)
+
+	// openai: native JSON mode and system prompt.
+	require.Len(t, openaiCalls, 1)
+	assert.True(t, openaiCalls[0].jsonMode)
+	assert.Equal(t, []llms.ChatMessageType{llms.ChatMessageTypeSystem, llms.ChatMessageTypeHuman}, openaiCalls[0].roles)
+	assert.NotContains(t, openaiCalls[0].prompt, "Return only the JSON object")
+
+	// anthropic: system prompt, but JSON is requested in the prompt.
+	require.Len(t, anthropicCalls, 1)
+	assert.False(t, anthropicCalls[0].jsonMode)
+	assert.Equal(t, []llms.ChatMessageType{llms.ChatMessageTypeSystem, llms.ChatMessageTypeHuman}, anthropicCalls[0].roles)
+	assert.Contains(t, anthropicCalls[0].prompt, "Return only the JSON object")
+
+	// gcp-vertex: no system prompt and no JSON mode.
+	require.Len(t, vertexCalls, 1)
+	assert.False(t, vertexCalls[0].jsonMode)
+	assert.Equal(t, []llms.ChatMessageType{llms.ChatMessageTypeHuman}, vertexCalls[0].roles)
+	assert.Contains(t, vertexCalls[0].prompt, "system prompt")
+	assert.Contains(t, vertexCalls[0].prompt, "Return only the JSON object")
+}
+
+func TestChainGenerateAllFail(t *testing.T) {
+	cfg := &config.Config{UserPrompt: "request: %q"}
+
+	var calls []recordedCall
+	chain := llm.Chain{
+		{Config: llm.Config{Provider: "openai"}, Model: recordingModel(&calls, "", errors.New("timeout"))},
+		{Config: llm.Config{Provider: "ollama"}, Model: recordingModel(&calls, "not json", nil)},
+	}
+
+	_, served, err := chain.Generate(context.Background(), httptest.NewRequest("GET", "/", nil), cfg, nil)
+	assert.ErrorContains(t, err, "contentGenerationError")
+	assert.ErrorContains(t, err, "invalidJSONResponse")
+	assert.Equal(t, "ollama", served.Provider)
+	assert.Len(t, calls, 2)
+}
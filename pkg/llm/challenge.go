@@ -0,0 +1,175 @@
+package llm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Authentication schemes supported by Challenge.
+const (
+	AuthSchemeBasic  = "basic"
+	AuthSchemeBearer = "bearer"
+	AuthSchemeDigest = "digest"
+)
+
+// Challenge returns a WWW-Authenticate header value for the scheme and realm.
+// Digest challenges include a random nonce and opaque value.
+func Challenge(scheme, realm string) (string, error) {
+	realm = strings.ReplaceAll(realm, `"`, `'`)
+	switch strings.ToLower(scheme) {
+	case AuthSchemeBasic:
+		return fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, realm), nil
+	case AuthSchemeBearer:
+		return fmt.Sprintf(`Bearer realm="%s"`, realm), nil
+	case AuthSchemeDigest:
+		nonce, err := randomHex(16)
+		if err != nil {
+			return "", err
+		}
+		opaque, err := randomHex(16)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(`Digest realm="%s", qop="auth", algorithm=MD5, nonce="%s", opaque="%s"`, realm, nonce, opaque), nil
+	default:
+		return "", fmt.Errorf("unsupported authentication scheme %q", scheme)
+	}
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ValidChallenge reports whether value is a well-formed WWW-Authenticate
+// header, i.e. one or more challenges made of an auth scheme optionally
+// followed by a token68 or comma-separated auth parameters. Basic and Digest
+// challenges must include a realm, and Digest challenges a nonce.
+func ValidChallenge(value string) bool {
+	parts, ok := splitChallengeParts(value)
+	if !ok {
+		return false
+	}
+
+	var scheme string
+	var params map[string]bool
+	for _, part := range parts {
+		if part == "" {
+			return false
+		}
+
+		param := part
+		space, eq := strings.IndexByte(part, ' '), strings.IndexByte(part, '=')
+		if eq == -1 || (space != -1 && space < eq) {
+			// The part starts a new challenge.
+			if scheme != "" && !hasRequiredParams(scheme, params) {
+				return false
+			}
+			name, rest, _ := strings.Cut(part, " ")
+			if !isToken(name) {
+				return false
+			}
+			scheme, params = strings.ToLower(name), map[string]bool{}
+			param = strings.TrimSpace(rest)
+			if param == "" || isToken68(param) {
+				continue
+			}
+		}
+		if scheme == "" {
+			return false
+		}
+
+		key, val, _ := strings.Cut(param, "=")
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		if !isToken(key) || !isParamValue(val) {
+			return false
+		}
+		params[strings.ToLower(key)] = true
+	}
+
+	return scheme != "" && hasRequiredParams(scheme, params)
+}
+
+func hasRequiredParams(scheme string, params map[string]bool) bool {
+	switch scheme {
+	case AuthSchemeBasic:
+		return params["realm"]
+	case AuthSchemeDigest:
+		return params["realm"] && params["nonce"]
+	}
+	return true
+}
+
+// splitChallengeParts splits value on commas outside quoted strings.
+func splitChallengeParts(value string) ([]string, bool) {
+	var parts []string
+	var b strings.Builder
+	quoted, escaped := false, false
+	for _, c := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			parts = append(parts, strings.TrimSpace(b.String()))
+			b.Reset()
+			continue
+		}
+		b.WriteRune(c)
+	}
+	if quoted {
+		return nil, false
+	}
+	return append(parts, strings.TrimSpace(b.String())), true
+}
+
+func isParamValue(s string) bool {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		return true
+	}
+	return isToken(s)
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isToken68 reports whether s is a token68, e.g. base64-encoded credentials,
+// where "=" may only appear as trailing padding.
+func isToken68(s string) bool {
+	trimmed := strings.TrimRight(s, "=")
+	if trimmed == "" {
+		return false
+	}
+	for _, c := range trimmed {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-._~+/", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeChallenge returns the value if it is a well-formed challenge, or
+// an empty string otherwise.
+func normalizeChallenge(value string) string {
+	if !ValidChallenge(value) {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,61 @@
+package llm_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChallenge(t *testing.T) {
+	basic, err := llm.Challenge("basic", "Restricted Area")
+	require.NoError(t, err)
+	assert.Equal(t, `Basic realm="Restricted Area", charset="UTF-8"`, basic)
+	assert.True(t, llm.ValidChallenge(basic))
+
+	bearer, err := llm.Challenge("Bearer", "api")
+	require.NoError(t, err)
+	assert.Equal(t, `Bearer realm="api"`, bearer)
+	assert.True(t, llm.ValidChallenge(bearer))
+
+	digest, err := llm.Challenge("digest", "Tomcat Manager Application")
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^Digest realm="Tomcat Manager Application", qop="auth", algorithm=MD5, nonce="[0-9a-f]{32}", opaque="[0-9a-f]{32}"$`), digest)
+	assert.True(t, llm.ValidChallenge(digest))
+
+	other, err := llm.Challenge("digest", "Tomcat Manager Application")
+	require.NoError(t, err)
+	assert.NotEqual(t, digest, other, "nonces should differ between challenges")
+
+	_, err = llm.Challenge("ntlm", "realm")
+	assert.Error(t, err)
+}
+
+func TestValidChallenge(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{`Basic realm="WallyWorld"`, true},
+		{`Basic realm=WallyWorld, charset="UTF-8"`, true},
+		{`Newauth realm="apps", type=1, title="Login to \"apps\"", Basic realm="simple"`, true},
+		{`Bearer`, true},
+		{`Negotiate YIIHhgYGKwYBBQUCoIIHejCCB3agDTALBgkqhkiG9xIBAgKiggdj`, true},
+		{`Digest realm="users@example.com", qop="auth", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093"`, true},
+		{`Digest realm="users@example.com", qop="auth"`, false},
+		{`Basic`, false},
+		{`Basic realm="unterminated`, false},
+		{`realm="no scheme"`, false},
+		{`Basic realm=, charset="UTF-8"`, false},
+		{`Basic realm="a",,`, false},
+		{``, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.want, llm.ValidChallenge(tt.value))
+		})
+	}
+}
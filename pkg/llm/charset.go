@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// BodyEncodingBase64 is the encoding of the bodies that aren't text, see
+// SafeBody.
+const BodyEncodingBase64 = "base64"
+
+// maxControlShare bounds the share of the control characters, other than the
+// whitespace, of the bodies treated as text.
+const maxControlShare = 10
+
+// DecodeCharset returns the body decoded to UTF-8 from the charset declared
+// by the Content-Type, or the body unchanged if the charset is UTF-8, unknown
+// or not declared, or the body can't be decoded.
+func DecodeCharset(contentType string, body []byte) []byte {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["charset"] == "" {
+		return body
+	}
+	charset := strings.ToLower(params["charset"])
+	if charset == "utf-8" || charset == "utf8" || charset == "us-ascii" {
+		return body
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return body
+	}
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil || !utf8.Valid(decoded) {
+		return body
+	}
+	return decoded
+}
+
+// IsBinary reports whether the body isn't text: it isn't valid UTF-8, has
+// null bytes or is mostly control characters.
+func IsBinary(body []byte) bool {
+	if !utf8.Valid(body) || bytes.IndexByte(body, 0) != -1 {
+		return true
+	}
+	controls := 0
+	for _, c := range body {
+		if (c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\f') || c == 0x7f {
+			controls++
+		}
+	}
+	return controls*maxControlShare > len(body)
+}
+
+// SafeBody returns the body of the Content-Type as valid UTF-8 text for the
+// prompts and the event logs, decoded from its declared charset, or, if it
+// isn't text, encoded in base64 with BodyEncodingBase64 as its encoding.
+func SafeBody(contentType string, body []byte) (string, string) {
+	body = DecodeCharset(contentType, body)
+	if len(body) > 0 && IsBinary(body) {
+		return base64.StdEncoding.EncodeToString(body), BodyEncodingBase64
+	}
+	return string(body), ""
+}
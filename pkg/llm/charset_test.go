@@ -0,0 +1,34 @@
+package llm_test
+
+import (
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafeBody(t *testing.T) {
+	tests := []struct {
+		name         string
+		contentType  string
+		body         string
+		want         string
+		wantEncoding string
+	}{
+		{name: "utf8", contentType: "text/plain; charset=utf-8", body: "café", want: "café"},
+		{name: "latin1", contentType: "application/x-www-form-urlencoded; charset=ISO-8859-1", body: "name=caf\xe9", want: "name=café"},
+		{name: "shiftJIS", contentType: "text/plain; charset=Shift_JIS", body: "\x82\xa0", want: "あ"},
+		{name: "unknownCharset", contentType: "text/plain; charset=x-unknown", body: "plain", want: "plain"},
+		{name: "invalidUTF8", contentType: "text/plain", body: "caf\xe9", want: "Y2Fm6Q==", wantEncoding: llm.BodyEncodingBase64},
+		{name: "nullBytes", contentType: "application/x-protobuf", body: "\x0a\x00ok", want: "CgBvaw==", wantEncoding: llm.BodyEncodingBase64},
+		{name: "controlCharacters", body: "\x01\x02\x03\x04ok", want: "AQIDBG9r", wantEncoding: llm.BodyEncodingBase64},
+		{name: "empty", contentType: "text/plain", body: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, encoding := llm.SafeBody(tt.contentType, []byte(tt.body))
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantEncoding, encoding)
+		})
+	}
+}
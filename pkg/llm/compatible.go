@@ -0,0 +1,55 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// initOpenAICompatibleClient initializes a client for servers implementing
+// OpenAI's chat completions API, such as vLLM, LM Studio, llama.cpp server and
+// OpenRouter. Only the server URL is required. JSON mode isn't requested, as
+// support for it varies between servers.
+func initOpenAICompatibleClient(config Config) (llms.Model, error) {
+	if config.ServerURL == "" {
+		return nil, fmt.Errorf("Server URL is required")
+	}
+	// The OpenAI client requires a token; without an API key, the
+	// Authorization header is removed before sending the request.
+	token := config.APIKey
+	if token == "" {
+		token = "unused"
+	}
+	opts := []openai.Option{
+		openai.WithBaseURL(config.ServerURL),
+		openai.WithModel(config.Model),
+		openai.WithToken(token),
+		openai.WithHTTPClient(&headerDoer{
+			headers:  config.Headers,
+			dropAuth: config.APIKey == "",
+		}),
+	}
+	m, err := openai.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// headerDoer adds extra headers to the requests sent to the provider.
+type headerDoer struct {
+	headers  map[string]string
+	dropAuth bool
+}
+
+func (d *headerDoer) Do(req *http.Request) (*http.Response, error) {
+	if d.dropAuth {
+		req.Header.Del("Authorization")
+	}
+	for k, v := range d.headers {
+		req.Header.Set(k, v)
+	}
+	return http.DefaultClient.Do(req)
+}
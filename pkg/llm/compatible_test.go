@@ -0,0 +1,59 @@
+package llm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestOpenAICompatibleProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		apiKey   string
+		wantAuth string
+	}{
+		{name: "withoutAPIKey", wantAuth: ""},
+		{name: "withAPIKey", apiKey: "sk-or-secret", wantAuth: "Bearer sk-or-secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got http.Header
+			var gotPath string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, gotPath = r.Header.Clone(), r.URL.Path
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{\"headers\": {\"Server\": \"nginx\"}, \"body\": \"ok\"}"}, "finish_reason": "stop"}]}`))
+			}))
+			defer ts.Close()
+
+			config := llm.Config{
+				Provider:  "openai-compatible",
+				Model:     "meta-llama/Meta-Llama-3-8B-Instruct",
+				APIKey:    tt.apiKey,
+				ServerURL: ts.URL + "/v1",
+				Headers:   map[string]string{"HTTP-Referer": "https://galah.example", "X-Title": "galah"},
+			}
+			model, err := llm.New(context.Background(), config)
+			require.NoError(t, err)
+
+			messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+			resp, err := llm.GenerateLLMResponse(context.Background(), model, config, messages)
+			require.NoError(t, err)
+			assert.Equal(t, `{"headers": {"Server": "nginx"}, "body": "ok"}`, resp)
+			assert.Equal(t, "/v1/chat/completions", gotPath)
+			assert.Equal(t, tt.wantAuth, got.Get("Authorization"))
+			assert.Equal(t, "https://galah.example", got.Get("HTTP-Referer"))
+			assert.Equal(t, "galah", got.Get("X-Title"))
+		})
+	}
+
+	_, err := llm.New(context.Background(), llm.Config{Provider: "openai-compatible", Model: "local"})
+	assert.Error(t, err, "the server URL is required")
+}
@@ -0,0 +1,202 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// htmlMarkup matches the start of an HTML tag, comment or doctype.
+var htmlMarkup = regexp.MustCompile(`<[A-Za-z!/]`)
+
+// closedElements are the elements a (non-truncated) HTML document closes, in
+// the order of their closing tags.
+var closedElements = []string{"body", "html"}
+
+// CheckContentType checks that the body of the response is in the format of
+// its Content-Type: valid JSON for the JSON types, and markup without JSON or
+// unclosed body and html elements for the HTML types. The other types, the
+// compressed bodies and the empty bodies aren't checked. It returns an error
+// describing the mismatch, or nil.
+func CheckContentType(resp JSONResponse) error {
+	mediaType, body, ok := checkedBody(resp)
+	if !ok {
+		return nil
+	}
+	switch {
+	case isJSONType(mediaType):
+		var v any
+		if err := json.Unmarshal(body, &v); err != nil {
+			return fmt.Errorf("the %s body isn't valid JSON: %s", mediaType, err)
+		}
+	case isHTMLType(mediaType):
+		if isJSONBody(body) {
+			return fmt.Errorf("the %s body is JSON", mediaType)
+		}
+		if !htmlMarkup.Match(body) {
+			return fmt.Errorf("the %s body has no HTML markup", mediaType)
+		}
+		if el := unclosedElement(string(body)); el != "" {
+			return fmt.Errorf("the <%s> element of the %s body isn't closed", el, mediaType)
+		}
+	}
+	return nil
+}
+
+// RepairContentType repairs the response whose body doesn't match its
+// Content-Type (see CheckContentType): the text around a JSON value is
+// stripped, the unclosed body and html elements are closed, and the
+// Content-Type of the other bodies is replaced with their sniffed type. It
+// reports whether the response was repaired.
+func RepairContentType(resp *JSONResponse) bool {
+	if CheckContentType(*resp) == nil {
+		return false
+	}
+	mediaType, body, _ := checkedBody(*resp)
+	if resp.Encoding == "" {
+		switch {
+		case isJSONType(mediaType):
+			if value := extractJSON(body); value != nil {
+				resp.Body = string(value)
+				return true
+			}
+		case isHTMLType(mediaType) && !isJSONBody(body) && htmlMarkup.Match(body):
+			resp.Body = closeElements(resp.Body)
+			return true
+		}
+	}
+	setContentType(resp, sniffContentType(body))
+	return true
+}
+
+// ContentTypePrompt returns the prompt asking the model to generate the
+// response again with a body matching its Content-Type.
+func ContentTypePrompt(mismatch error) string {
+	return fmt.Sprintf("The body of your previous response didn't match its Content-Type header: %s. Generate the response again with a complete body in the format of its Content-Type.", mismatch)
+}
+
+// checkedBody returns the media type and the decoded body of the response, if
+// they are checked.
+func checkedBody(resp JSONResponse) (string, []byte, bool) {
+	var contentType, contentEncoding string
+	for key, value := range resp.Headers {
+		switch http.CanonicalHeaderKey(key) {
+		case "Content-Type":
+			contentType = value
+		case "Content-Encoding":
+			contentEncoding = value
+		}
+	}
+	if contentType == "" || (contentEncoding != "" && !strings.EqualFold(contentEncoding, "identity")) {
+		return "", nil, false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, _, _ = strings.Cut(strings.ToLower(contentType), ";")
+		mediaType = strings.TrimSpace(mediaType)
+	}
+	body, err := resp.DecodedBody()
+	if err != nil {
+		return "", nil, false
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return "", nil, false
+	}
+	return mediaType, body, true
+}
+
+func isJSONType(mediaType string) bool {
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func isHTMLType(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+func isJSONBody(body []byte) bool {
+	return (body[0] == '{' || body[0] == '[') && json.Valid(body)
+}
+
+// unclosedElement returns the first of the closedElements opened but not
+// closed in the body, or "".
+func unclosedElement(body string) string {
+	lower := strings.ToLower(body)
+	for _, el := range closedElements {
+		if hasTag(lower, "<"+el) && !strings.Contains(lower, "</"+el) {
+			return el
+		}
+	}
+	return ""
+}
+
+// hasTag reports whether the lowercase body has the opening tag, matching the
+// whole tag name.
+func hasTag(lower, tag string) bool {
+	for offset := 0; ; {
+		i := strings.Index(lower[offset:], tag)
+		if i == -1 {
+			return false
+		}
+		next := offset + i + len(tag)
+		if next == len(lower) || strings.ContainsRune(" \t\r\n/>", rune(lower[next])) {
+			return true
+		}
+		offset = next
+	}
+}
+
+// closeElements appends the closing tags of the unclosed elements to the
+// body.
+func closeElements(body string) string {
+	lower := strings.ToLower(body)
+	for _, el := range closedElements {
+		if hasTag(lower, "<"+el) && !strings.Contains(lower, "</"+el) {
+			body = strings.TrimRight(body, " \t\r\n") + "\n</" + el + ">\n"
+		}
+	}
+	return body
+}
+
+// extractJSON returns the JSON value surrounded by other text (e.g. a
+// markdown code block) in the body, or nil.
+func extractJSON(body []byte) []byte {
+	start := bytes.IndexAny(body, "{[")
+	if start == -1 {
+		return nil
+	}
+	closing := byte('}')
+	if body[start] == '[' {
+		closing = ']'
+	}
+	end := bytes.LastIndexByte(body, closing)
+	if end <= start || !json.Valid(body[start:end+1]) {
+		return nil
+	}
+	return body[start : end+1]
+}
+
+// sniffContentType returns the content type of the body, after its format.
+func sniffContentType(body []byte) string {
+	switch {
+	case isJSONBody(body):
+		return "application/json"
+	case htmlMarkup.Match(body) && strings.Contains(strings.ToLower(string(body)), "<html"):
+		return "text/html; charset=utf-8"
+	}
+	return http.DetectContentType(body)
+}
+
+// setContentType replaces the value of the Content-Type header of the
+// response, keeping the case of its name.
+func setContentType(resp *JSONResponse, contentType string) {
+	for key := range resp.Headers {
+		if http.CanonicalHeaderKey(key) == "Content-Type" {
+			resp.Headers[key] = contentType
+		}
+	}
+}
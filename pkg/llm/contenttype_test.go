@@ -0,0 +1,70 @@
+package llm_test
+
+import (
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		mismatch    bool
+	}{
+		{"valid json", "application/json; charset=utf-8", `{"status":"ok"}`, false},
+		{"vendor json", "application/vnd.api+json", `[1, 2]`, false},
+		{"invalid json", "application/json", `{"status":"ok"`, true},
+		{"html declared json", "application/json", "<html><body>Not Found</body></html>", true},
+		{"valid html", "text/html", "<!DOCTYPE html><html><body><h1>It works!</h1></body></html>", false},
+		{"html fragment", "text/html", "<h1>Forbidden</h1>", false},
+		{"json declared html", "text/html", `{"error":"not found"}`, true},
+		{"plain text declared html", "text/html", "Not Found", true},
+		{"unclosed html", "text/html", "<html><body><p>Index of /", true},
+		{"unchecked type", "text/plain", `{"a":`, false},
+		{"empty body", "application/json", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := llm.JSONResponse{Headers: map[string]string{"content-type": tt.contentType}, Body: tt.body}
+			err := llm.CheckContentType(resp)
+			assert.Equal(t, tt.mismatch, err != nil, "error: %v", err)
+		})
+	}
+
+	compressed := llm.JSONResponse{
+		Headers: map[string]string{"Content-Type": "application/json", "Content-Encoding": "gzip"},
+		Body:    "H4sIAAAAAAAA/w==",
+	}
+	assert.NoError(t, llm.CheckContentType(compressed))
+}
+
+func TestRepairContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantType    string
+		wantBody    string
+	}{
+		{"json in text", "application/json", "Here is the response:\n```json\n{\"id\": 1}\n```", "application/json", `{"id": 1}`},
+		{"html declared json", "application/json", "<html><body>Not Found</body></html>", "text/html; charset=utf-8", "<html><body>Not Found</body></html>"},
+		{"json declared html", "text/html", `{"error":"not found"}`, "application/json", `{"error":"not found"}`},
+		{"plain text declared html", "text/html", "Not Found", "text/plain; charset=utf-8", "Not Found"},
+		{"unclosed html", "text/html", "<html><body><p>Index of /\n", "text/html", "<html><body><p>Index of /\n</body>\n</html>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := llm.JSONResponse{Headers: map[string]string{"Content-Type": tt.contentType}, Body: tt.body}
+			assert.True(t, llm.RepairContentType(&resp))
+			assert.Equal(t, tt.wantType, resp.Headers["Content-Type"])
+			assert.Equal(t, tt.wantBody, resp.Body)
+			assert.NoError(t, llm.CheckContentType(resp))
+		})
+	}
+
+	resp := llm.JSONResponse{Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"id": 1}`}
+	assert.False(t, llm.RepairContentType(&resp))
+}
@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SessionState is the state of the session cookie of a request, issued by
+// the honeypot, described to the model so that the responses follow the
+// session: Cookie is the name of the cookie, New is true if the session is
+// started by the response, Expired is true if the session of the request's
+// cookie is unknown or has expired, and User is the user the session is
+// logged in as, if any.
+type SessionState struct {
+	Cookie   string
+	New      bool
+	Expired  bool
+	Started  time.Time
+	Requests int
+	User     string
+}
+
+type sessionStateKey struct{}
+
+// WithSessionState returns a copy of ctx carrying the state of the session
+// cookie of the request.
+func WithSessionState(ctx context.Context, st *SessionState) context.Context {
+	return context.WithValue(ctx, sessionStateKey{}, st)
+}
+
+// SessionStateFrom returns the state of the session cookie carried by ctx,
+// or nil.
+func SessionStateFrom(ctx context.Context) *SessionState {
+	st, _ := ctx.Value(sessionStateKey{}).(*SessionState)
+	return st
+}
+
+// prompt returns the instruction describing the session to the model.
+func (st *SessionState) prompt() string {
+	var b strings.Builder
+	if st.Expired {
+		fmt.Fprintf(&b, "The session of the %s cookie of the request has expired or is invalid, so the client isn't logged in. ", st.Cookie)
+	}
+	if st.New {
+		fmt.Fprintf(&b, "The server starts a new session for the client and sets its %s cookie itself: don't set the %s cookie in the response.", st.Cookie, st.Cookie)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "The client's session (%s cookie) was started %s ago, with %d requests before this one.", st.Cookie, time.Since(st.Started).Round(time.Second), st.Requests)
+	if st.User != "" {
+		fmt.Fprintf(&b, " The client is logged in as %q.", st.User)
+	} else {
+		b.WriteString(" The client isn't logged in.")
+	}
+	b.WriteString(" Don't set the " + st.Cookie + " cookie in the response.")
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package llm_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateMessageContentSessionState(t *testing.T) {
+	cfg := &config.Config{SystemPrompt: "system prompt", UserPrompt: "request: %q"}
+
+	tests := []struct {
+		name     string
+		state    *llm.SessionState
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "none",
+			excludes: []string{"session"},
+		},
+		{
+			name:     "new",
+			state:    &llm.SessionState{Cookie: "PHPSESSID", New: true},
+			contains: []string{"starts a new session", "don't set the PHPSESSID cookie"},
+			excludes: []string{"expired"},
+		},
+		{
+			name:     "expired",
+			state:    &llm.SessionState{Cookie: "PHPSESSID", New: true, Expired: true},
+			contains: []string{"expired or is invalid", "isn't logged in", "starts a new session"},
+		},
+		{
+			name:     "loggedIn",
+			state:    &llm.SessionState{Cookie: "JSESSIONID", Started: time.Now().Add(-time.Minute), Requests: 3, User: "admin"},
+			contains: []string{"with 3 requests before this one", `logged in as "admin"`},
+			excludes: []string{"new session"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/admin/", nil)
+			if tt.state != nil {
+				r = r.WithContext(llm.WithSessionState(r.Context(), tt.state))
+			}
+			messages, err := llm.CreateMessageContent(r, cfg, "openai", nil)
+			require.NoError(t, err)
+			userPrompt := fmt.Sprint(messages[len(messages)-1].Parts[0])
+			for _, s := range tt.contains {
+				assert.Contains(t, userPrompt, s)
+			}
+			for _, s := range tt.excludes {
+				assert.NotContains(t, userPrompt, s)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Pricing is the price of a model in USD per million tokens.
+type Pricing struct {
+	Input  float64
+	Output float64
+}
+
+// ModelPricing maps model name prefixes to their pricing. The longest
+// matching prefix is used, so more specific models can override a family.
+var ModelPricing = map[string]Pricing{
+	"gpt-3.5-turbo":     {Input: 0.50, Output: 1.50},
+	"gpt-4":             {Input: 30.00, Output: 60.00},
+	"gpt-4-turbo":       {Input: 10.00, Output: 30.00},
+	"gpt-4o":            {Input: 5.00, Output: 15.00},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.60},
+	"claude-3-haiku":    {Input: 0.25, Output: 1.25},
+	"claude-3-sonnet":   {Input: 3.00, Output: 15.00},
+	"claude-3-5-sonnet": {Input: 3.00, Output: 15.00},
+	"claude-3-opus":     {Input: 15.00, Output: 75.00},
+	"gemini-1.0-pro":    {Input: 0.50, Output: 1.50},
+	"gemini-1.5-flash":  {Input: 0.35, Output: 1.05},
+	"gemini-1.5-pro":    {Input: 3.50, Output: 10.50},
+	"command-r":         {Input: 0.50, Output: 1.50},
+	"command-r-plus":    {Input: 3.00, Output: 15.00},
+	"mistral-small":     {Input: 1.00, Output: 3.00},
+	"mistral-large":     {Input: 4.00, Output: 12.00},
+	"open-mistral-7b":   {Input: 0.25, Output: 0.25},
+	"open-mixtral-8x7b": {Input: 0.70, Output: 0.70},
+	// AWS Bedrock model IDs.
+	"anthropic.claude-3-haiku":    {Input: 0.25, Output: 1.25},
+	"anthropic.claude-3-sonnet":   {Input: 3.00, Output: 15.00},
+	"anthropic.claude-3-5-sonnet": {Input: 3.00, Output: 15.00},
+	"anthropic.claude-3-opus":     {Input: 15.00, Output: 75.00},
+	"amazon.titan-text-lite":      {Input: 0.15, Output: 0.20},
+	"amazon.titan-text-express":   {Input: 0.20, Output: 0.60},
+	"meta.llama3-8b-instruct":     {Input: 0.30, Output: 0.60},
+	"meta.llama3-70b-instruct":    {Input: 2.65, Output: 3.50},
+}
+
+// PricingFor returns the pricing of the model and whether it is known.
+func PricingFor(model string) (Pricing, bool) {
+	var (
+		best    Pricing
+		bestLen int
+	)
+	for prefix, p := range ModelPricing {
+		if strings.HasPrefix(model, prefix) && len(prefix) > bestLen {
+			best, bestLen = p, len(prefix)
+		}
+	}
+	return best, bestLen > 0
+}
+
+// EstimateTokens roughly estimates the number of tokens in the text, using
+// the common approximation of four characters per token.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// estimateMessagesTokens estimates the number of prompt tokens. The count of
+// the system prompt is cached.
+func estimateMessagesTokens(messages []llms.MessageContent) int {
+	var tokens int
+	for _, m := range messages {
+		for _, p := range m.Parts {
+			text, ok := p.(llms.TextContent)
+			if !ok {
+				continue
+			}
+			if m.Role == llms.ChatMessageTypeSystem {
+				tokens += systemPromptTokens.Count(text.Text)
+			} else {
+				tokens += EstimateTokens(text.Text)
+			}
+		}
+	}
+	return tokens
+}
+
+// Cost returns the estimated cost in USD of the given token counts.
+func (p Pricing) Cost(inputTokens, outputTokens int) float64 {
+	return (float64(inputTokens)*p.Input + float64(outputTokens)*p.Output) / 1_000_000
+}
+
+// Usage returns the prompt and completion token counts reported by the
+// provider in the response, if any.
+func Usage(resp *llms.ContentResponse) (inputTokens, outputTokens int, ok bool) {
+	if resp == nil || len(resp.Choices) == 0 {
+		return 0, 0, false
+	}
+	info := resp.Choices[0].GenerationInfo
+	for _, keys := range [][2]string{
+		{"PromptTokens", "CompletionTokens"},
+		{"InputTokens", "OutputTokens"},
+	} {
+		in, inOK := info[keys[0]].(int)
+		out, outOK := info[keys[1]].(int)
+		if inOK && outOK && in+out > 0 {
+			return in, out, true
+		}
+	}
+	return 0, 0, false
+}
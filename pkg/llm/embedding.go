@@ -0,0 +1,22 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tmc/langchaingo/embeddings"
+)
+
+// NewEmbedder initializes an embedding client for the provider and model of
+// the given configuration.
+func NewEmbedder(ctx context.Context, config Config) (embeddings.Embedder, error) {
+	model, err := New(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	client, ok := model.(embeddings.EmbedderClient)
+	if !ok {
+		return nil, fmt.Errorf("the %s provider doesn't support embeddings", config.Provider)
+	}
+	return embeddings.NewEmbedder(client)
+}
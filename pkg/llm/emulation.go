@@ -0,0 +1,255 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/0x4d31/galah/internal/config"
+)
+
+// Emulation describes a vulnerable application emulated on some paths of the
+// server, to attract the exploitation campaigns targeting it. Requests whose
+// path starts with one of Paths (case-insensitively, or any request if Paths
+// is empty) are generated with the emulation's instructions, and their
+// responses get its headers. Artifacts are static rules answering the
+// application's well-known resources without generating them.
+type Emulation struct {
+	Name        string
+	Description string
+	CVEs        []string
+	Paths       []string
+	Prompt      string
+	Headers     map[string]string
+	Artifacts   []config.StaticRuleConfig
+}
+
+// Emulations contains the built-in vulnerable application emulations.
+var Emulations = map[string]Emulation{
+	"citrix-adc": {
+		Description: "Citrix ADC (NetScaler Gateway) 13.0",
+		CVEs:        []string{"CVE-2019-19781", "CVE-2023-3519"},
+		Paths:       []string{"/vpn/", "/vpns/", "/logon/", "/cgi/", "/nf/", "/citrix/", "/oauth/", "/gwtest/"},
+		Prompt:      "Directory traversal requests through /vpn/../vpns/ reach the Perl scripts and configuration files of /netscaler/portal and /nsconfig (e.g. smb.conf and ns.conf), and a POST to /vpn/../vpns/portal/scripts/newbm.pl with an NSC_USER header creates the bookmark XML file without authentication.",
+		Headers: map[string]string{
+			"X-Frame-Options": "SAMEORIGIN",
+		},
+		Artifacts: []config.StaticRuleConfig{
+			{
+				Name:    "login",
+				Methods: []string{"GET", "HEAD"},
+				Paths:   []string{"/vpn/index.html", "/logon/LogonPoint/index.html"},
+				Headers: map[string]string{
+					"Content-Type":  "text/html; charset=utf-8",
+					"Cache-Control": "no-cache, no-store, must-revalidate",
+					"Set-Cookie":    "NSC_TEMP=xyz; Path=/; expires=Thursday, 01-Jan-1970 00:00:00 GMT",
+				},
+				Body: "<!DOCTYPE html>\n<html>\n<head>\n<meta http-equiv=\"X-UA-Compatible\" content=\"IE=edge\">\n<title>NetScaler Gateway</title>\n<link rel=\"stylesheet\" href=\"/vpn/images/caxtonstyle.css\" type=\"text/css\">\n<script type=\"text/javascript\" src=\"/vpn/resources.js\"></script>\n</head>\n<body>\n<form action=\"/cgi/login\" method=\"post\" name=\"vpnForm\" autocomplete=\"off\">\n<input type=\"text\" id=\"Enter user name\" name=\"login\" size=\"30\" maxlength=\"127\">\n<input type=\"password\" id=\"passwd\" name=\"passwd\" size=\"30\" maxlength=\"127\">\n<input type=\"submit\" id=\"Log_On\" value=\"Log On\">\n</form>\n</body>\n</html>\n",
+			},
+			{
+				Name:    "smb.conf",
+				Methods: []string{"GET"},
+				Regex:   `^/vpns?/(\.\.|%2e%2e)/vpns/cfg/smb\.conf$`,
+				Headers: map[string]string{"Content-Type": "text/plain"},
+				Body:    "[global]\n\tencrypt passwords = yes\n\tname resolve order = lmhosts wins host bcast\n",
+			},
+		},
+	},
+	"confluence": {
+		Description: "Atlassian Confluence Server 7.13.6",
+		CVEs:        []string{"CVE-2022-26134", "CVE-2023-22515", "CVE-2021-26084"},
+		Prompt:      "OGNL expressions in the request URI (e.g. /${...}/) and in the queryString parameter of /pages/doenterpagevariables.action are evaluated: respond with a 302 redirect and, when the expression sets a response header to the output of Runtime.exec, that header with the plausible output of the command. /server-info.action?bootstrapStatusProvider.applicationConfig.setupComplete=false reopens the setup, and /setup/setupadministrator.action then creates the administrator account.",
+		Headers: map[string]string{
+			"X-Content-Type-Options":  "nosniff",
+			"X-XSS-Protection":        "1; mode=block",
+			"Content-Security-Policy": "frame-ancestors 'self'",
+		},
+		Artifacts: []config.StaticRuleConfig{
+			{
+				Name:    "login",
+				Methods: []string{"GET", "HEAD"},
+				Paths:   []string{"/login.action"},
+				Headers: map[string]string{
+					"Content-Type": "text/html;charset=UTF-8",
+					"Set-Cookie":   "JSESSIONID=5F0D2C9D47B3A1E6C8E0A9B4D3F21C77; Path=/; HttpOnly",
+				},
+				Body: "<!DOCTYPE html>\n<html>\n<head>\n<title>Log In - Confluence</title>\n<meta name=\"ajs-version-number\" content=\"7.13.6\">\n<meta name=\"ajs-build-number\" content=\"8703\">\n</head>\n<body id=\"com-atlassian-confluence\" class=\"login aui-layout aui-theme-default\">\n<form name=\"loginform\" method=\"POST\" action=\"/dologin.action\" class=\"aui login-form-container\">\n<input type=\"text\" name=\"os_username\" id=\"os_username\" class=\"text\" autocomplete=\"username\">\n<input type=\"password\" name=\"os_password\" id=\"os_password\" class=\"password\" autocomplete=\"current-password\">\n<input type=\"submit\" name=\"login\" id=\"loginButton\" class=\"aui-button aui-button-primary\" value=\"Log in\">\n</form>\n<ul id=\"poweredby\"><li class=\"noprint\">Powered by <a href=\"https://www.atlassian.com/software/confluence\">Atlassian Confluence</a> <span id='footer-build-information'>7.13.6</span></li></ul>\n</body>\n</html>\n",
+			},
+		},
+	},
+	"f5-bigip": {
+		Description: "F5 BIG-IP 15.1.0 (TMUI and iControl REST)",
+		CVEs:        []string{"CVE-2020-5902", "CVE-2022-1388"},
+		Paths:       []string{"/tmui/", "/mgmt/"},
+		Prompt:      "/tmui/login.jsp/..;/ bypasses the TMUI authentication (e.g. fileRead.jsp returns the content of the file named by its fileName parameter), and POST requests to /mgmt/tm/util/bash with an X-F5-Auth-Token header and Connection: X-F5-Auth-Token run the utilCmdArgs of the JSON body, returning {\"kind\":\"tm:util:bash:runstate\",\"command\":\"run\",\"utilCmdArgs\":...,\"commandResult\":...} with the plausible output of the command.",
+		Headers: map[string]string{
+			"Server": "Apache",
+		},
+		Artifacts: []config.StaticRuleConfig{
+			{
+				Name:    "login",
+				Methods: []string{"GET", "HEAD"},
+				Paths:   []string{"/tmui/login.jsp"},
+				Headers: map[string]string{
+					"Content-Type": "text/html;charset=UTF-8",
+					"Set-Cookie":   "JSESSIONID=8B3C1F0E5A7D49C2B6E1F03A9D4C7E21; Path=/tmui; Secure; HttpOnly",
+				},
+				Body: "<!DOCTYPE html>\n<html>\n<head>\n<title>BIG-IP&reg;- {{ .Host }}</title>\n<link href=\"/tmui/tmui/login/css/login.css\" rel=\"stylesheet\" type=\"text/css\">\n</head>\n<body>\n<form id=\"loginform\" name=\"loginform\" action=\"/tmui/logmein.html\" method=\"post\" autocomplete=\"off\">\n<input type=\"text\" name=\"username\" id=\"username\" value=\"\">\n<input type=\"password\" name=\"passwd\" id=\"passwd\" value=\"\">\n<button type=\"submit\">Log in</button>\n</form>\n<div id=\"productinfo\">BIG-IP 15.1.0 Build 0.0.31</div>\n</body>\n</html>\n",
+			},
+		},
+	},
+	"fortios": {
+		Description: "Fortinet FortiGate SSL VPN on FortiOS 6.0.4",
+		CVEs:        []string{"CVE-2018-13379", "CVE-2022-40684"},
+		Paths:       []string{"/remote/", "/api/v2/"},
+		Prompt:      "/remote/fgt_lang?lang= with a traversal to /dev/cmdb/sslvpn_websession returns the binary session file with usernames and plaintext passwords, and /api/v2/cmdb/system/admin accepts requests with a Forwarded: for=127.0.0.1 header and a User-Agent of Report Runner as authenticated.",
+		Headers: map[string]string{
+			"Server": "xxxxxxxx-xxxxx",
+		},
+		Artifacts: []config.StaticRuleConfig{
+			{
+				Name:    "login",
+				Methods: []string{"GET", "HEAD"},
+				Paths:   []string{"/remote/login"},
+				Headers: map[string]string{
+					"Content-Type":    "text/html; charset=utf-8",
+					"X-Frame-Options": "SAMEORIGIN",
+				},
+				Body: "<html lang=\"en\" class=\"main-app\">\n<head>\n<meta charset=\"UTF-8\">\n<title>Please Login</title>\n<script src=\"/remote/fgt_lang?lang=en\"></script>\n</head>\n<body>\n<form action=\"/remote/logincheck\" method=\"post\" name=\"f\" autocomplete=\"off\">\n<input type=\"text\" name=\"username\" id=\"username\" placeholder=\"Username\">\n<input type=\"password\" name=\"credential\" id=\"credential\" placeholder=\"Password\">\n<button type=\"submit\" id=\"login_button\">Login</button>\n</form>\n</body>\n</html>\n",
+			},
+		},
+	},
+	"exchange": {
+		Description: "Microsoft Exchange Server 2016 CU19 (15.1.2176.2) with Outlook Web App",
+		CVEs:        []string{"CVE-2021-26855", "CVE-2021-34473", "CVE-2022-41040"},
+		Paths:       []string{"/owa/", "/ecp/", "/autodiscover/", "/mapi/", "/ews/", "/powershell/", "/rpc/"},
+		Prompt:      "The Autodiscover and ECP frontends proxy requests whose path or X-BEResource cookie names a backend (e.g. /autodiscover/autodiscover.json?@example.com/mapi/nspi/?&Email=autodiscover/autodiscover.json%3F@example.com), so such requests reach the backend services without authentication, which answer with their usual responses (e.g. the legacy DN of the mailbox from /mapi/emsmdb).",
+		Headers: map[string]string{
+			"Server":                 "Microsoft-IIS/10.0",
+			"X-Powered-By":           "ASP.NET",
+			"X-OWA-Version":          "15.1.2176.2",
+			"X-FEServer":             "EXCH01",
+			"Request-Id":             "0b1f6a3c-6e3f-4d5c-9d2a-3f8e7c1b2a90",
+			"X-AspNet-Version":       "4.0.30319",
+			"X-Content-Type-Options": "nosniff",
+		},
+		Artifacts: []config.StaticRuleConfig{
+			{
+				Name:       "owa",
+				Methods:    []string{"GET", "HEAD"},
+				Paths:      []string{"/owa/"},
+				StatusCode: http.StatusFound,
+				Headers: map[string]string{
+					"Location": "https://{{ .Host }}/owa/auth/logon.aspx?url=https%3a%2f%2f{{ .Host }}%2fowa%2f&reason=0",
+				},
+			},
+		},
+	},
+}
+
+// ResolveEmulations returns the emulations selected in the configuration.
+func ResolveEmulations(ecs []config.EmulationConfig) ([]*Emulation, error) {
+	emulations := make([]*Emulation, 0, len(ecs))
+	for _, ec := range ecs {
+		e := Emulation{Name: ec.Name, Headers: make(map[string]string)}
+		if builtin, ok := Emulations[ec.Name]; ok {
+			e.Description = builtin.Description
+			e.CVEs = builtin.CVEs
+			e.Paths = builtin.Paths
+			e.Prompt = builtin.Prompt
+			for k, v := range builtin.Headers {
+				e.Headers[k] = v
+			}
+			e.Artifacts = append(e.Artifacts, builtin.Artifacts...)
+		} else if ec.Prompt == "" && ec.Description == "" {
+			return nil, fmt.Errorf("unknown emulation %q", ec.Name)
+		}
+
+		if ec.Description != "" {
+			e.Description = ec.Description
+		}
+		if ec.CVEs != nil {
+			e.CVEs = ec.CVEs
+		}
+		if ec.Paths != nil {
+			e.Paths = ec.Paths
+		}
+		if ec.Prompt != "" {
+			e.Prompt = ec.Prompt
+		}
+		for k, v := range ec.Headers {
+			e.Headers[http.CanonicalHeaderKey(k)] = v
+		}
+		e.Artifacts = append(e.Artifacts, ec.Artifacts...)
+		emulations = append(emulations, &e)
+	}
+	return emulations, nil
+}
+
+// Matches reports whether the request is for one of the emulation's paths.
+func (e *Emulation) Matches(r *http.Request) bool {
+	if len(e.Paths) == 0 {
+		return true
+	}
+	path := strings.ToLower(r.URL.Path)
+	for _, prefix := range e.Paths {
+		if strings.HasPrefix(path, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply replaces the headers generated by the model with the emulation's
+// headers.
+func (e *Emulation) Apply(resp *JSONResponse) {
+	if resp.Headers == nil {
+		resp.Headers = make(map[string]string)
+	}
+	for key := range resp.Headers {
+		if _, ok := e.Headers[http.CanonicalHeaderKey(key)]; ok {
+			delete(resp.Headers, key)
+		}
+	}
+	for k, v := range e.Headers {
+		resp.Headers[k] = v
+	}
+}
+
+// prompt returns the instruction describing the emulation to the model.
+func (e *Emulation) prompt() string {
+	var b strings.Builder
+	if e.Description != "" {
+		fmt.Fprintf(&b, "This path of the server runs %s", e.Description)
+		if len(e.CVEs) > 0 {
+			fmt.Fprintf(&b, ", which is vulnerable to %s", strings.Join(e.CVEs, ", "))
+		}
+		b.WriteString(". Keep the response consistent with this application and version, and respond to exploitation attempts as the vulnerable application would, so they appear to succeed.")
+	}
+	if e.Prompt != "" {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(e.Prompt)
+	}
+	return b.String()
+}
+
+// emulationsPrompt returns the instructions of the emulations matching the
+// request.
+func emulationsPrompt(ecs []config.EmulationConfig, r *http.Request) (string, error) {
+	if len(ecs) == 0 {
+		return "", nil
+	}
+	emulations, err := ResolveEmulations(ecs)
+	if err != nil {
+		return "", err
+	}
+	var prompts []string
+	for _, e := range emulations {
+		if e.Matches(r) {
+			prompts = append(prompts, e.prompt())
+		}
+	}
+	return strings.Join(prompts, "\n"), nil
+}
@@ -0,0 +1,72 @@
+package llm_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveEmulations(t *testing.T) {
+	emulations, err := llm.ResolveEmulations([]config.EmulationConfig{
+		{Name: "fortios", Headers: map[string]string{"x-frame-options": "DENY"}},
+		{
+			Name:        "gitlab",
+			Description: "GitLab CE 13.10.2",
+			CVEs:        []string{"CVE-2021-22205"},
+			Paths:       []string{"/uploads/"},
+			Artifacts:   []config.StaticRuleConfig{{Paths: []string{"/users/sign_in"}, Body: "sign in"}},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, emulations, 2)
+
+	fortios := emulations[0]
+	assert.Equal(t, []string{"CVE-2018-13379", "CVE-2022-40684"}, fortios.CVEs)
+	assert.Equal(t, map[string]string{"Server": "xxxxxxxx-xxxxx", "X-Frame-Options": "DENY"}, fortios.Headers)
+	assert.NotEmpty(t, fortios.Artifacts)
+	assert.Len(t, emulations[1].Artifacts, 1)
+
+	_, err = llm.ResolveEmulations([]config.EmulationConfig{{Name: "netscreen"}})
+	assert.Error(t, err)
+}
+
+func TestEmulationMatchesAndApply(t *testing.T) {
+	emulations, err := llm.ResolveEmulations([]config.EmulationConfig{{Name: "exchange"}, {Name: "confluence"}})
+	require.NoError(t, err)
+	exchange, confluence := emulations[0], emulations[1]
+
+	assert.True(t, exchange.Matches(httptest.NewRequest("POST", "/autodiscover/autodiscover.json?@example.com/mapi/nspi/", nil)))
+	assert.True(t, exchange.Matches(httptest.NewRequest("GET", "/OWA/auth/logon.aspx", nil)))
+	assert.False(t, exchange.Matches(httptest.NewRequest("GET", "/index.php", nil)))
+	assert.True(t, confluence.Matches(httptest.NewRequest("GET", "/index.php", nil)), "an emulation without paths matches every request")
+
+	resp := llm.JSONResponse{Headers: map[string]string{"server": "nginx", "Content-Type": "text/html"}}
+	exchange.Apply(&resp)
+	assert.Equal(t, "Microsoft-IIS/10.0", resp.Headers["Server"])
+	assert.Equal(t, "15.1.2176.2", resp.Headers["X-OWA-Version"])
+	assert.Equal(t, "text/html", resp.Headers["Content-Type"])
+	assert.NotContains(t, resp.Headers, "server")
+}
+
+func TestCreateMessageContentEmulations(t *testing.T) {
+	cfg := &config.Config{
+		SystemPrompt: "system prompt",
+		UserPrompt:   "request: %q",
+		Emulations:   []config.EmulationConfig{{Name: "f5-bigip"}},
+	}
+
+	messages, err := llm.CreateMessageContent(httptest.NewRequest("POST", "/mgmt/tm/util/bash", nil), cfg, "openai", nil)
+	require.NoError(t, err)
+	systemPrompt := fmt.Sprint(messages[0].Parts[0])
+	assert.Contains(t, systemPrompt, "F5 BIG-IP 15.1.0")
+	assert.Contains(t, systemPrompt, "CVE-2022-1388")
+
+	messages, err = llm.CreateMessageContent(httptest.NewRequest("GET", "/", nil), cfg, "openai", nil)
+	require.NoError(t, err)
+	assert.NotContains(t, fmt.Sprint(messages[0].Parts[0]), "BIG-IP")
+}
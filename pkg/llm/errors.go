@@ -0,0 +1,294 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrProviderResponse is returned when the provider (or a gateway in
+	// front of it) returned an error page or error envelope instead of the
+	// model output.
+	ErrProviderResponse = errors.New("providerResponse: unexpected response from the llm provider")
+	// ErrRateLimited is returned when the provider rejected the request
+	// because of rate limiting.
+	ErrRateLimited = errors.New("rateLimited: the llm provider rate limited the request")
+	// ErrQuotaExhausted is returned when the provider account has run out of
+	// quota or credits.
+	ErrQuotaExhausted = errors.New("quotaExhausted: the llm provider quota is exhausted")
+	// ErrTransport is returned when the request to the provider failed
+	// because of a network error or a server-side (5xx) error.
+	ErrTransport = errors.New("transportError: the request to the llm provider failed")
+	// ErrRefusal is returned when the model refused to generate a response.
+	ErrRefusal = errors.New("refusal: the model refused to generate a response")
+	// ErrEmptyResponse is returned when the model returned no content.
+	ErrEmptyResponse = errors.New("emptyLLMResponse")
+	// ErrInvalidJSON is returned when the model output is not a valid
+	// JSONResponse.
+	ErrInvalidJSON = errors.New("invalidJSONResponse")
+	// ErrInsufficientDeadline is returned when the remaining time before the
+	// request deadline is shorter than the typical generation latency.
+	ErrInsufficientDeadline = errors.New("insufficientDeadline: not enough time left to generate a response")
+	// ErrTimeout is returned when the provider didn't respond within the
+	// configured timeout.
+	ErrTimeout = errors.New("llmTimeout: the llm provider did not respond in time")
+	// ErrGeneration is returned when the provider client failed with an
+	// error of none of the other kinds. The error of the client is wrapped,
+	// e.g. context.Canceled.
+	ErrGeneration = errors.New("contentGenerationError")
+	// ErrUnsupportedProvider is returned when the configured provider isn't
+	// supported.
+	ErrUnsupportedProvider = errors.New("unsupported llm provider")
+	// ErrNoProviders is returned when a chain has no providers.
+	ErrNoProviders = errors.New("no llm providers configured")
+)
+
+// Error kinds used to configure how each type of failure is handled.
+const (
+	ErrorKindQuotaExhausted   = "quota_exhausted"
+	ErrorKindRateLimited      = "rate_limited"
+	ErrorKindTransport        = "transport_error"
+	ErrorKindRefusal          = "refusal"
+	ErrorKindProviderResponse = "provider_response"
+	ErrorKindNonJSONStream    = "non_json_stream"
+	ErrorKindCostCeiling      = "cost_ceiling"
+	ErrorKindInvalidJSON      = "invalid_json"
+	ErrorKindEmptyResponse    = "empty_response"
+	ErrorKindDeadline         = "insufficient_deadline"
+	ErrorKindTokenRateLimit   = "token_rate_limited"
+	ErrorKindCircuitOpen      = "circuit_open"
+	ErrorKindBudgetExceeded   = "budget_exceeded"
+	ErrorKindTimeout          = "llm_timeout"
+	ErrorKindGeneration       = "generation_error"
+)
+
+var errorKinds = []struct {
+	err  error
+	kind string
+}{
+	{ErrQuotaExhausted, ErrorKindQuotaExhausted},
+	{ErrRateLimited, ErrorKindRateLimited},
+	{ErrTransport, ErrorKindTransport},
+	{ErrRefusal, ErrorKindRefusal},
+	{ErrProviderResponse, ErrorKindProviderResponse},
+	{ErrNonJSONStream, ErrorKindNonJSONStream},
+	{ErrCostCeiling, ErrorKindCostCeiling},
+	{ErrInvalidJSON, ErrorKindInvalidJSON},
+	{ErrEmptyResponse, ErrorKindEmptyResponse},
+	{ErrInsufficientDeadline, ErrorKindDeadline},
+	{ErrTokenRateLimit, ErrorKindTokenRateLimit},
+	{ErrCircuitOpen, ErrorKindCircuitOpen},
+	{ErrBudgetExceeded, ErrorKindBudgetExceeded},
+	{ErrTimeout, ErrorKindTimeout},
+}
+
+// ErrorKind returns the kind of a generation error, or ErrorKindGeneration
+// if it isn't one of the typed errors.
+func ErrorKind(err error) string {
+	for _, k := range errorKinds {
+		if errors.Is(err, k.err) {
+			return k.kind
+		}
+	}
+	return ErrorKindGeneration
+}
+
+// Handling of the model outputs that are HTML documents instead of the JSON
+// response.
+const (
+	HTMLContentInvalidJSON   = "invalid_json"
+	HTMLContentBody          = "body"
+	HTMLContentProviderError = "provider_error"
+)
+
+// CheckHTMLContent checks the handling of the model outputs that are HTML
+// documents: invalid_json (the default) handles them like the other invalid
+// JSON, corrected by the model; body serves them as the body of a text/html
+// response; provider_error returns ErrProviderResponse, for the gateways
+// returning their error pages as the model output. The HTML error pages
+// failing the provider client are always ErrProviderResponse.
+func CheckHTMLContent(mode string) error {
+	switch mode {
+	case "", HTMLContentInvalidJSON, HTMLContentBody, HTMLContentProviderError:
+		return nil
+	}
+	return fmt.Errorf("unknown HTML content handling %q, expected invalid_json, body or provider_error", mode)
+}
+
+// maxRawBodySize is the maximum size of a raw provider body kept in errors.
+const maxRawBodySize = 512
+
+// Phrases in provider error messages, checked in order.
+var (
+	quotaPhrases = []string{
+		"insufficient_quota",
+		"exceeded your current quota",
+		"credit balance is too low",
+	}
+	rateLimitPhrases = []string{
+		"status code: 429",
+		"statuscode: 429",
+		"error 429",
+		"rate limit",
+		"rate_limit",
+		"too many requests",
+		"resource_exhausted",
+		"resource has been exhausted",
+	}
+	transportPhrases = []string{
+		"connection refused",
+		"connection reset",
+		"broken pipe",
+		"no such host",
+		"i/o timeout",
+		"tls handshake timeout",
+		"unexpected eof",
+		"status code: 500",
+		"status code: 502",
+		"status code: 503",
+		"status code: 504",
+		"500 internal server error",
+		"502 bad gateway",
+		"503 service unavailable",
+		"504 gateway timeout",
+		"overloaded",
+	}
+)
+
+// Prefixes of common model refusals.
+var refusalPrefixes = []string{
+	"i'm sorry",
+	"i’m sorry",
+	"i am sorry",
+	"i apologize",
+	"i cannot",
+	"i can't",
+	"i can’t",
+	"i'm unable",
+	"i am unable",
+	"as an ai",
+}
+
+// httpStatusError is implemented by the provider client errors carrying the
+// status code of the response, e.g. those of the AWS SDK. Quota errors share
+// the status code of rate limiting, so the quota phrases are checked first.
+type httpStatusError interface {
+	HTTPStatusCode() int
+}
+
+// classifyProviderError returns the typed error matching the provider
+// client error, or nil if it isn't recognized.
+func classifyProviderError(err error) error {
+	msg := strings.ToLower(err.Error())
+	for _, p := range quotaPhrases {
+		if strings.Contains(msg, p) {
+			return ErrQuotaExhausted
+		}
+	}
+	var statusErr httpStatusError
+	if errors.As(err, &statusErr) {
+		switch code := statusErr.HTTPStatusCode(); {
+		case code == http.StatusTooManyRequests:
+			return ErrRateLimited
+		case code >= http.StatusInternalServerError:
+			return ErrTransport
+		}
+	}
+	for _, p := range rateLimitPhrases {
+		if strings.Contains(msg, p) {
+			return ErrRateLimited
+		}
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrTransport
+	}
+	for _, p := range transportPhrases {
+		if strings.Contains(msg, p) {
+			return ErrTransport
+		}
+	}
+	return nil
+}
+
+// isRefusal reports whether the model output looks like a refusal.
+func isRefusal(content string) bool {
+	lower := strings.ToLower(strings.TrimSpace(content))
+	for _, p := range refusalPrefixes {
+		if strings.HasPrefix(lower, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// providerResponseError checks whether the content looks like a provider
+// error rather than the model's intended JSON, and returns an error wrapping
+// ErrProviderResponse with the truncated raw body if so. An HTML document is
+// only a provider error with the provider_error handling of the HTML content,
+// as it is otherwise a plausible response of the model.
+func providerResponseError(content, htmlContent string) error {
+	trimmed := strings.TrimSpace(content)
+	if htmlContent == HTMLContentProviderError && isHTMLDocument(trimmed) || isErrorEnvelope(trimmed) {
+		return fmt.Errorf("%w: %s", ErrProviderResponse, truncate(trimmed, maxRawBodySize))
+	}
+	return nil
+}
+
+// isHTMLClientError reports whether a provider client failed because it got
+// an HTML page (e.g. from a gateway) instead of the provider's API response.
+func isHTMLClientError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "<html") ||
+		strings.Contains(msg, "<!doctype html") ||
+		strings.Contains(msg, "invalid character '<' looking for beginning of value")
+}
+
+// htmlResponse returns the response serving the HTML document output by the
+// model.
+func htmlResponse(document string) JSONResponse {
+	resp := JSONResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "text/html; charset=utf-8"},
+		Body:       document,
+	}
+	Normalize(&resp)
+	return resp
+}
+
+func isHTMLDocument(s string) bool {
+	lower := strings.ToLower(s)
+	return strings.HasPrefix(lower, "<!doctype html") || strings.HasPrefix(lower, "<html")
+}
+
+// isErrorEnvelope reports whether s is a JSON object with an "error" member
+// and none of the fields of a JSONResponse.
+func isErrorEnvelope(s string) bool {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &envelope); err != nil {
+		return false
+	}
+	for key := range envelope {
+		switch strings.ToLower(key) {
+		case "headers", "body":
+			return false
+		}
+	}
+	_, ok := envelope["error"]
+	return ok
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "...(truncated)"
+}
@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// exampleMessages returns the few-shot examples for the persona as pairs of
+// user and model messages. The example requests are presented with the same
+// user prompt as actual requests.
+func exampleMessages(examples []config.ExampleConfig, persona, userPrompt string, profile *ServerProfile) ([]llms.MessageContent, error) {
+	var messages []llms.MessageContent
+	for _, ex := range examples {
+		if ex.Persona != "" && ex.Persona != persona {
+			continue
+		}
+
+		request := strings.TrimSpace(ex.Request)
+		data := PromptData{Request: request, Persona: persona}
+		if r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(request + "\r\n\r\n"))); err == nil {
+			data = newPromptData(r, request, profile, persona)
+		}
+		prompt, err := renderUserPrompt(userPrompt, data)
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := json.Marshal(JSONResponse{
+			StatusCode: ex.Response.StatusCode,
+			Headers:    ex.Response.Headers,
+			Encoding:   ex.Response.Encoding,
+			Body:       ex.Response.Body,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding the example response: %s", err)
+		}
+
+		messages = append(messages,
+			llms.TextParts(llms.ChatMessageTypeHuman, prompt),
+			llms.TextParts(llms.ChatMessageTypeAI, string(response)),
+		)
+	}
+	return messages, nil
+}
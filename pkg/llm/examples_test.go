@@ -0,0 +1,72 @@
+package llm_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestCreateMessageContentExamples(t *testing.T) {
+	cfg := &config.Config{
+		SystemPrompt:  "system prompt",
+		UserPrompt:    "{{.Method}} {{.Path}}",
+		ServerProfile: config.ServerProfileConfig{Name: "nginx-php"},
+		Examples: []config.ExampleConfig{
+			{
+				Request: "GET /robots.txt HTTP/1.1\nHost: example.com",
+				Response: config.ExampleResponseConfig{
+					Headers: map[string]string{"Content-Type": "text/plain"},
+					Body:    "User-agent: *",
+				},
+			},
+			{
+				Persona:  "apache-php",
+				Request:  "GET /server-status HTTP/1.1",
+				Response: config.ExampleResponseConfig{Body: "Apache Server Status"},
+			},
+			{
+				Persona: "nginx-php",
+				Request: "GET /admin HTTP/1.1",
+				Response: config.ExampleResponseConfig{
+					StatusCode: 302,
+					Headers:    map[string]string{"Location": "/login"},
+					Body:       "Found",
+				},
+			},
+		},
+	}
+	r := httptest.NewRequest("GET", "/index.php", nil)
+
+	messages, err := llm.CreateMessageContent(r, cfg, "openai", nil)
+	require.NoError(t, err)
+	require.Len(t, messages, 6)
+
+	wantRoles := []llms.ChatMessageType{
+		llms.ChatMessageTypeSystem,
+		llms.ChatMessageTypeHuman, llms.ChatMessageTypeAI,
+		llms.ChatMessageTypeHuman, llms.ChatMessageTypeAI,
+		llms.ChatMessageTypeHuman,
+	}
+	for i, m := range messages {
+		assert.Equal(t, wantRoles[i], m.Role)
+	}
+	text := func(i int) string { return messages[i].Parts[0].(llms.TextContent).Text }
+	assert.Equal(t, "GET /robots.txt", text(1))
+	assert.JSONEq(t, `{"headers": {"Content-Type": "text/plain"}, "body": "User-agent: *"}`, text(2))
+	assert.Equal(t, "GET /admin", text(3))
+	assert.JSONEq(t, `{"status_code": 302, "headers": {"Location": "/login"}, "body": "Found"}`, text(4))
+	assert.Equal(t, "GET /index.php", text(5))
+
+	// Without system prompt support, it is prepended to the first example.
+	messages, err = llm.CreateMessageContent(r, cfg, "googleai", nil)
+	require.NoError(t, err)
+	require.Len(t, messages, 5)
+	assert.True(t, strings.HasPrefix(messages[0].Parts[0].(llms.TextContent).Text, "system prompt"))
+	assert.Equal(t, llms.ChatMessageTypeAI, messages[1].Role)
+}
@@ -0,0 +1,142 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Fixture is a recorded interaction that can be replayed in tests.
+type Fixture struct {
+	Request     string           `json:"request"`
+	Messages    []FixtureMessage `json:"messages"`
+	RawResponse string           `json:"rawResponse"`
+	Response    *JSONResponse    `json:"response,omitempty"`
+}
+
+// FixtureMessage is the text content of a message sent to the LLM.
+type FixtureMessage struct {
+	Role string `json:"role"`
+	Text string `json:"text"`
+}
+
+// NewFixture captures the request, the assembled messages, and the raw
+// generated response. The validated response is included if the raw
+// response passes validation.
+func NewFixture(r *http.Request, messages []llms.MessageContent, rawResponse string) (*Fixture, error) {
+	httpReq, err := httputil.DumpRequest(r, true)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fixture{
+		Request:     string(httpReq),
+		RawResponse: rawResponse,
+	}
+	for _, m := range messages {
+		var parts []string
+		for _, p := range m.Parts {
+			if text, ok := p.(llms.TextContent); ok {
+				parts = append(parts, text.Text)
+			}
+		}
+		f.Messages = append(f.Messages, FixtureMessage{
+			Role: string(m.Role),
+			Text: strings.Join(parts, "\n"),
+		})
+	}
+
+	cleaned := cleanResponse(rawResponse)
+	if ValidateJSON(cleaned) == nil {
+		var resp JSONResponse
+		if err := json.Unmarshal([]byte(cleaned), &resp); err == nil {
+			f.Response = &resp
+		}
+	}
+
+	return f, nil
+}
+
+// WriteFixture serializes the fixture to the given file.
+func WriteFixture(path string, f *Fixture) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ReadFixture reads a fixture from the given file.
+func ReadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("error unmarshalling fixture: %s", err)
+	}
+	return &f, nil
+}
+
+// HTTPRequest parses the recorded request.
+func (f *Fixture) HTTPRequest() (*http.Request, error) {
+	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(f.Request)))
+	if err != nil {
+		return nil, err
+	}
+	// Dumped server requests don't carry a Content-Length header, so the
+	// body is everything after the header block.
+	if _, body, found := strings.Cut(f.Request, "\r\n\r\n"); found && req.ContentLength <= 0 {
+		req.Body = io.NopCloser(strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+	return req, nil
+}
+
+// MessageContent returns the recorded messages as LLM message content.
+func (f *Fixture) MessageContent() []llms.MessageContent {
+	messages := make([]llms.MessageContent, 0, len(f.Messages))
+	for _, m := range f.Messages {
+		messages = append(messages, llms.TextParts(llms.ChatMessageType(m.Role), m.Text))
+	}
+	return messages
+}
+
+// ReplayModel is an llms.Model that returns the raw response of a fixture.
+type ReplayModel struct {
+	Fixture *Fixture
+}
+
+// GenerateContent returns the recorded raw response.
+func (m *ReplayModel) GenerateContent(ctx context.Context, _ []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	if m.Fixture == nil {
+		return nil, errors.New("replay model has no fixture")
+	}
+	var opts llms.CallOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	if opts.StreamingFunc != nil {
+		if err := opts.StreamingFunc(ctx, []byte(m.Fixture.RawResponse)); err != nil {
+			return nil, err
+		}
+	}
+	return &llms.ContentResponse{
+		Choices: []*llms.ContentChoice{{Content: m.Fixture.RawResponse}},
+	}, nil
+}
+
+// Call returns the recorded raw response.
+func (m *ReplayModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
@@ -0,0 +1,54 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixtureRoundTrip(t *testing.T) {
+	cfg := &config.Config{
+		SystemPrompt: "system prompt",
+		UserPrompt:   "request: %q",
+	}
+	r := httptest.NewRequest("POST", "/login.php", strings.NewReader("user=admin&pass=admin"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	messages, err := llm.CreateMessageContent(r, cfg, "openai", nil)
+	require.NoError(t, err)
+	raw := "```json\n{\"headers\": {\"Server\": \"Apache/2.4.38\"}, \"body\": \"<html>Welcome admin</html>\"}\n```"
+
+	fixture, err := llm.NewFixture(r, messages, raw)
+	require.NoError(t, err)
+	require.NotNil(t, fixture.Response)
+
+	path := filepath.Join(t.TempDir(), "login.json")
+	require.NoError(t, llm.WriteFixture(path, fixture))
+	loaded, err := llm.ReadFixture(path)
+	require.NoError(t, err)
+	assert.Equal(t, fixture, loaded)
+
+	req, err := loaded.HTTPRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "POST", req.Method)
+	assert.Equal(t, "/login.php", req.URL.Path)
+
+	replayed, err := llm.CreateMessageContent(req, cfg, "openai", nil)
+	require.NoError(t, err)
+	assert.Equal(t, loaded.MessageContent(), replayed)
+
+	model := &llm.ReplayModel{Fixture: loaded}
+	resp, err := llm.GenerateLLMResponse(context.Background(), model, llm.Config{}, loaded.MessageContent())
+	require.NoError(t, err)
+	var got llm.JSONResponse
+	require.NoError(t, json.Unmarshal([]byte(resp), &got))
+	assert.Equal(t, *loaded.Response, got)
+}
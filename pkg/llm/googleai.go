@@ -8,6 +8,15 @@ import (
 	"github.com/tmc/langchaingo/llms/googleai"
 )
 
+// harmThresholds are the safety thresholds of the Gemini models, blocking the
+// content of their probability of harm and above, by name.
+var harmThresholds = map[string]googleai.HarmBlockThreshold{
+	"block_low_and_above":    googleai.HarmBlockLowAndAbove,
+	"block_medium_and_above": googleai.HarmBlockMediumAndAbove,
+	"block_only_high":        googleai.HarmBlockOnlyHigh,
+	"block_none":             googleai.HarmBlockNone,
+}
+
 func initGoogleAIClient(ctx context.Context, config Config) (llms.Model, error) {
 	if config.APIKey == "" {
 		return nil, fmt.Errorf("API key is required")
@@ -16,9 +25,27 @@ func initGoogleAIClient(ctx context.Context, config Config) (llms.Model, error)
 		googleai.WithDefaultModel(config.Model),
 		googleai.WithAPIKey(config.APIKey),
 	}
-	m, err := googleai.New(ctx, opts...)
+	safety, err := safetyOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	m, err := googleai.New(ctx, append(opts, safety...)...)
 	if err != nil {
 		return nil, err
 	}
 	return m, nil
 }
+
+// safetyOptions returns the options of the safety threshold of the
+// configuration, applied to all the harm categories, or none for the
+// client's default (block_only_high).
+func safetyOptions(config Config) ([]googleai.Option, error) {
+	if config.SafetyThreshold == "" {
+		return nil, nil
+	}
+	threshold, ok := harmThresholds[config.SafetyThreshold]
+	if !ok {
+		return nil, fmt.Errorf("unknown safety threshold %q", config.SafetyThreshold)
+	}
+	return []googleai.Option{googleai.WithHarmThreshold(threshold)}, nil
+}
@@ -0,0 +1,19 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoogleAISafetyThreshold(t *testing.T) {
+	config := llm.Config{Provider: "googleai", Model: "gemini-1.5-flash", APIKey: "test", SafetyThreshold: "block_none"}
+	_, err := llm.New(context.Background(), config)
+	assert.NoError(t, err)
+
+	config.SafetyThreshold = "block_everything"
+	_, err = llm.New(context.Background(), config)
+	assert.ErrorContains(t, err, `unknown safety threshold "block_everything"`)
+}
@@ -0,0 +1,241 @@
+package llm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluele/gcache"
+)
+
+const (
+	defaultHistoryMaxSources = 10_000
+	defaultHistoryExcerpt    = 200
+)
+
+// HistoryConfig holds configuration settings for the request history.
+// SessionCookies are the names of the cookies identifying a session, tracked
+// separately from the other requests of its source IP. Excerpt is the
+// maximum length of the request and response body excerpts included in the
+// history (200 by default, -1 to leave them out).
+type HistoryConfig struct {
+	Size           int
+	TTL            time.Duration
+	MaxSources     int
+	SessionCookies []string
+	Excerpt        int
+}
+
+// History keeps a bounded ring buffer of recent requests, and the responses
+// served to them, per session: the value of a session cookie if the request
+// has one, or its source IP otherwise. The number of tracked sessions is
+// capped, and the least recently active sessions are evicted first.
+type History struct {
+	mu      sync.Mutex
+	sources gcache.Cache
+	size    int
+	ttl     time.Duration
+	cookies []string
+	excerpt int
+}
+
+type historyEntry struct {
+	time    time.Time
+	summary string
+}
+
+// NewHistory creates a new History instance with the specified configuration.
+func NewHistory(conf HistoryConfig) *History {
+	if conf.MaxSources <= 0 {
+		conf.MaxSources = defaultHistoryMaxSources
+	}
+	builder := gcache.New(conf.MaxSources).LRU()
+	if conf.TTL > 0 {
+		builder = builder.Expiration(conf.TTL)
+	}
+	if conf.Excerpt == 0 {
+		conf.Excerpt = defaultHistoryExcerpt
+	}
+	return &History{
+		sources: builder.Build(),
+		size:    conf.Size,
+		ttl:     conf.TTL,
+		cookies: conf.SessionCookies,
+		excerpt: conf.Excerpt,
+	}
+}
+
+// Record adds a summary of the request to the history of its session.
+func (h *History) Record(r *http.Request) {
+	h.record(r, nil)
+}
+
+// RecordResponse adds a summary of the request and of the response served
+// to it to the history of its session.
+func (h *History) RecordResponse(r *http.Request, resp JSONResponse) {
+	h.record(r, &resp)
+}
+
+func (h *History) record(r *http.Request, resp *JSONResponse) {
+	summary := h.summarizeRequest(r)
+	if resp != nil {
+		summary += " -> " + h.summarizeResponse(*resp)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key, entries := h.session(r)
+	entries = append(entries, historyEntry{
+		time:    time.Now(),
+		summary: summary,
+	})
+	if len(entries) > h.size {
+		entries = entries[len(entries)-h.size:]
+	}
+	// The cache is bounded and safe for concurrent use; the mutex only
+	// guards the read-modify-write of a single session's entries.
+	_ = h.sources.Set(key, entries)
+}
+
+// Recent returns the summaries of the unexpired recent requests from the
+// given source IP, oldest first.
+func (h *History) Recent(src string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return summaries(h.entries(src))
+}
+
+// RecentFor returns the summaries of the unexpired recent requests of the
+// request's session, oldest first.
+func (h *History) RecentFor(r *http.Request) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, entries := h.session(r)
+	return summaries(entries)
+}
+
+// session returns the key and the entries of the request's session. A new
+// cookie session starts with the history of its source IP, so the requests
+// made before the cookie was set are kept.
+func (h *History) session(r *http.Request) (string, []historyEntry) {
+	src := SourceIP(r)
+	for _, name := range h.cookies {
+		c, err := r.Cookie(name)
+		if err != nil || c.Value == "" {
+			continue
+		}
+		key := "cookie:" + name + "=" + c.Value
+		if _, err := h.sources.Get(key); err == nil {
+			return key, h.entries(key)
+		}
+		return key, h.entries(src)
+	}
+	return src, h.entries(src)
+}
+
+func summaries(entries []historyEntry) []string {
+	summaries := make([]string, 0, len(entries))
+	for _, e := range entries {
+		summaries = append(summaries, e.summary)
+	}
+	return summaries
+}
+
+// entries returns a copy of the unexpired entries for the source.
+func (h *History) entries(src string) []historyEntry {
+	val, err := h.sources.Get(src)
+	if err != nil {
+		return nil
+	}
+	stored, ok := val.([]historyEntry)
+	if !ok {
+		return nil
+	}
+
+	entries := make([]historyEntry, 0, len(stored)+1)
+	for _, e := range stored {
+		if h.ttl > 0 && time.Since(e.time) > h.ttl {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func (h *History) summarizeRequest(r *http.Request) string {
+	summary := fmt.Sprintf("%s %s", r.Method, r.URL.RequestURI())
+	if r.ContentLength > 0 {
+		summary += fmt.Sprintf(" (%d byte body)", r.ContentLength)
+	}
+	if h.excerpt < 0 || r.Body == nil {
+		return summary
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err == nil && len(body) > 0 {
+		summary += ": " + excerpt(string(body), h.excerpt)
+	}
+	return summary
+}
+
+// historyHeaders are the response headers included in the history.
+var historyHeaders = []string{"Content-Type", "Location", "Set-Cookie"}
+
+func (h *History) summarizeResponse(resp JSONResponse) string {
+	status := resp.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	summary := fmt.Sprint(status)
+	for _, name := range historyHeaders {
+		for key, value := range resp.Headers {
+			if http.CanonicalHeaderKey(key) == name {
+				summary += fmt.Sprintf(" %s: %s;", name, value)
+			}
+		}
+	}
+	summary = strings.TrimSuffix(summary, ";")
+	if h.excerpt >= 0 && resp.Encoding == "" && resp.Body != "" {
+		summary += fmt.Sprintf(", body: %q", excerpt(resp.Body, h.excerpt))
+	}
+	return summary
+}
+
+// excerpt collapses the whitespace of s and cuts it to n bytes, on a UTF-8
+// character boundary.
+func excerpt(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= n {
+		return s
+	}
+	return s[:runeBoundary(s, n)] + "..."
+}
+
+func historyPrompt(summaries []string) string {
+	var b strings.Builder
+	b.WriteString("Previous requests from the same client and the responses served to them, oldest first. Keep the response consistent with them (e.g. the same application, users, sessions and data):\n")
+	for _, s := range summaries {
+		b.WriteString("- ")
+		b.WriteString(s)
+		b.WriteString("\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// SourceIP returns the IP address part of the request's remote address, the
+// address of the client once the server resolved it behind trusted proxies.
+func SourceIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
@@ -0,0 +1,136 @@
+package llm_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateMessageContentHistory(t *testing.T) {
+	cfg := &config.Config{
+		SystemPrompt: "system prompt",
+		UserPrompt:   "request: %q",
+	}
+	history := llm.NewHistory(llm.HistoryConfig{Size: 2, TTL: time.Minute, MaxSources: 10})
+
+	for _, path := range []string{"/first", "/wp-login.php", "/admin"} {
+		r := httptest.NewRequest("GET", path, nil)
+		r.RemoteAddr = "192.0.2.1:4321"
+		history.Record(r)
+	}
+	other := httptest.NewRequest("POST", "/other-source", nil)
+	other.RemoteAddr = "198.51.100.7:1234"
+	history.Record(other)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		contains   []string
+		excludes   []string
+	}{
+		{
+			name:       "sameSource",
+			remoteAddr: "192.0.2.1:5555",
+			contains:   []string{"GET /wp-login.php", "GET /admin"},
+			excludes:   []string{"GET /first", "/other-source"},
+		},
+		{
+			name:       "differentSource",
+			remoteAddr: "203.0.113.9:5555",
+			excludes:   []string{"Previous requests", "/admin", "/other-source"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/current", nil)
+			r.RemoteAddr = tt.remoteAddr
+
+			messages, err := llm.CreateMessageContent(r, cfg, "openai", history)
+			assert.NoError(t, err)
+			userPrompt := fmt.Sprint(messages[len(messages)-1].Parts[0])
+			for _, s := range tt.contains {
+				assert.Contains(t, userPrompt, s)
+			}
+			for _, s := range tt.excludes {
+				assert.NotContains(t, userPrompt, s)
+			}
+		})
+	}
+}
+
+func TestHistoryBounds(t *testing.T) {
+	history := llm.NewHistory(llm.HistoryConfig{Size: 3, TTL: 50 * time.Millisecond, MaxSources: 2})
+
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = fmt.Sprintf("192.0.2.%d:80", i)
+		history.Record(r)
+	}
+	// Only the two most recently active sources are kept.
+	assert.Empty(t, history.Recent("192.0.2.0"))
+	assert.Len(t, history.Recent("192.0.2.2"), 1)
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Empty(t, history.Recent("192.0.2.2"))
+}
+
+func TestHistorySessions(t *testing.T) {
+	history := llm.NewHistory(llm.HistoryConfig{Size: 5, TTL: time.Minute, SessionCookies: []string{"PHPSESSID"}, Excerpt: 20})
+
+	login := httptest.NewRequest("POST", "/login.php", strings.NewReader("user=admin&pass=hunter2"))
+	login.RemoteAddr = "192.0.2.1:4321"
+	history.RecordResponse(login, llm.JSONResponse{
+		StatusCode: 302,
+		Headers:    map[string]string{"Location": "/admin.php", "set-cookie": "PHPSESSID=abc", "Server": "nginx"},
+		Body:       "   Redirecting\n\n to the   admin panel now",
+	})
+
+	// The body of the recorded request can still be read.
+	body, err := io.ReadAll(login.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "user=admin&pass=hunter2", string(body))
+
+	// A new cookie session starts with the history of its source IP.
+	admin := httptest.NewRequest("GET", "/admin.php", nil)
+	admin.RemoteAddr = "192.0.2.1:4322"
+	admin.AddCookie(&http.Cookie{Name: "PHPSESSID", Value: "abc"})
+	recent := history.RecentFor(admin)
+	require.Len(t, recent, 1)
+	assert.Equal(t, `POST /login.php (23 byte body): user=admin&pass=hunt... -> 302 Location: /admin.php; Set-Cookie: PHPSESSID=abc, body: "Redirecting to the a..."`, recent[0])
+	history.RecordResponse(admin, llm.JSONResponse{Body: "Welcome"})
+
+	// The session is tracked separately from its source IP.
+	assert.Len(t, history.RecentFor(admin), 2)
+	assert.Len(t, history.Recent("192.0.2.1"), 1)
+
+	// The same session from another source IP.
+	admin.RemoteAddr = "198.51.100.7:1234"
+	assert.Len(t, history.RecentFor(admin), 2)
+}
+
+func TestSourceIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"192.0.2.1:4321", "192.0.2.1"},
+		{"[2001:db8::1]:4321", "2001:db8::1"},
+		{"192.0.2.1:0", "192.0.2.1"},
+		{"192.0.2.1", "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		assert.Equal(t, tt.want, llm.SourceIP(r), tt.remoteAddr)
+	}
+}
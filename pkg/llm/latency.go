@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// latencyWeight is the weight of a new observation in the moving average.
+const latencyWeight = 0.2
+
+// LatencyEstimator keeps an exponentially weighted moving average of the
+// generation latency of each provider and model.
+type LatencyEstimator struct {
+	mu        sync.Mutex
+	estimates map[string]time.Duration
+}
+
+// NewLatencyEstimator returns an empty latency estimator.
+func NewLatencyEstimator() *LatencyEstimator {
+	return &LatencyEstimator{estimates: make(map[string]time.Duration)}
+}
+
+func latencyKey(config Config) string {
+	return config.Provider + "/" + config.Model
+}
+
+// Observe records the latency of a generation.
+func (e *LatencyEstimator) Observe(config Config, d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := latencyKey(config)
+	prev, ok := e.estimates[key]
+	if !ok {
+		e.estimates[key] = d
+		return
+	}
+	e.estimates[key] = prev + time.Duration(latencyWeight*float64(d-prev))
+}
+
+// Estimate returns the typical latency of the provider and model, or 0 if no
+// generation has been observed yet.
+func (e *LatencyEstimator) Estimate(config Config) time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.estimates[latencyKey(config)]
+}
+
+// CheckDeadline returns ErrInsufficientDeadline if ctx has a deadline that
+// leaves less time than the typical latency of the provider and model.
+func (e *LatencyEstimator) CheckDeadline(ctx context.Context, config Config) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	estimate := e.Estimate(config)
+	if remaining := time.Until(deadline); estimate > 0 && remaining < estimate {
+		return fmt.Errorf("%w (%s remaining, typical latency %s)", ErrInsufficientDeadline, remaining.Round(time.Millisecond), estimate.Round(time.Millisecond))
+	}
+	return nil
+}
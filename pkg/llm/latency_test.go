@@ -0,0 +1,43 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyEstimator(t *testing.T) {
+	e := llm.NewLatencyEstimator()
+	openai := llm.Config{Provider: "openai", Model: "gpt-4o"}
+	ollama := llm.Config{Provider: "ollama", Model: "llama3"}
+
+	assert.Zero(t, e.Estimate(openai))
+
+	e.Observe(openai, 2*time.Second)
+	assert.Equal(t, 2*time.Second, e.Estimate(openai))
+	e.Observe(openai, 7*time.Second)
+	assert.Equal(t, 3*time.Second, e.Estimate(openai))
+	assert.Zero(t, e.Estimate(ollama))
+}
+
+func TestCheckDeadline(t *testing.T) {
+	e := llm.NewLatencyEstimator()
+	config := llm.Config{Provider: "openai", Model: "gpt-4o"}
+
+	short, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, e.CheckDeadline(short, config), "unknown latency should not skip generation")
+
+	e.Observe(config, 3*time.Second)
+	err := e.CheckDeadline(short, config)
+	assert.ErrorIs(t, err, llm.ErrInsufficientDeadline)
+	assert.Equal(t, llm.ErrorKindDeadline, llm.ErrorKind(err))
+
+	long, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.NoError(t, e.CheckDeadline(long, config))
+	assert.NoError(t, e.CheckDeadline(context.Background(), config))
+}
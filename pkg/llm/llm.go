@@ -2,41 +2,226 @@ package llm
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"net/http/httputil"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/0x4d31/galah/internal/config"
 	"github.com/go-playground/validator"
 	"github.com/tmc/langchaingo/llms"
 )
 
-// Config holds configuration settings for the LLM.
+// Config holds configuration settings for the LLM. Seed (none if 0) and TopP
+// (the provider's default if 0) are passed to the providers supporting them,
+// to generate the same responses to the same prompts, as are the
+// FrequencyPenalty and PresencePenalty (the provider's default if 0) and the
+// StopSequences ending the generation. SafetyThreshold is the threshold of the
+// safety filters of the Gemini models (e.g. block_none), the client's default
+// if empty. KeepAlive and NumCtx are the keep-alive duration of the model and
+// its context window of the Ollama server (see initOllamaClient). HTMLContent
+// is the handling of the outputs that are HTML documents instead of the JSON
+// response (see CheckHTMLContent).
 type Config struct {
-	APIKey        string
-	CloudLocation string
-	CloudProject  string
-	Model         string
-	Provider      string
-	ServerURL     string
-	Temperature   float64
+	APIKey               string
+	APIVersion           string
+	CloudLocation        string
+	CloudProject         string
+	Deployment           string
+	FrequencyPenalty     float64
+	Headers              map[string]string
+	HTMLContent          string
+	JSONCorrections      int
+	KeepAlive            string
+	MaxRequestCost       float64
+	MaxTokens            int
+	Model                string
+	NumCtx               int
+	PresencePenalty      float64
+	Provider             string
+	SafetyThreshold      string
+	Seed                 int
+	ServerURL            string
+	StopSequences        []string
+	Stream               bool
+	StreamAbortThreshold int
+	Temperature          float64
+	Timeout              time.Duration
+	ToolCalling          bool
+	TopP                 float64
 }
 
-// JSONResponse defines the expected JSON response from the LLM.
+// JSONResponse defines the expected JSON response from the LLM. The status
+// code is optional, responses without one are sent with 200 OK. Binary bodies
+// (e.g. images) are base64 encoded, with Encoding set to "base64". The body is
+// required, except for the status codes of the responses usually without one
+// (see emptyBodyAllowed).
 type JSONResponse struct {
-	Headers map[string]string `json:"headers" validate:"required"`
-	Body    string            `json:"body" validate:"required"`
+	StatusCode int               `json:"status_code,omitempty" validate:"omitempty,min=200,max=599"`
+	Headers    map[string]string `json:"headers" validate:"required"`
+	Encoding   string            `json:"encoding,omitempty" validate:"omitempty,oneof=base64"`
+	Body       string            `json:"body"`
 }
 
+// emptyBodyAllowed reports whether the responses with the status code may
+// have an empty body: the responses without content and the redirects.
+func emptyBodyAllowed(status int) bool {
+	switch status {
+	case http.StatusNoContent, http.StatusResetContent, http.StatusNotModified,
+		http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// validateJSONResponse requires the body of the responses whose status code
+// doesn't allow an empty one.
+func validateJSONResponse(sl validator.StructLevel) {
+	resp := sl.Current().Interface().(JSONResponse)
+	if resp.Body == "" && !emptyBodyAllowed(resp.StatusCode) {
+		sl.ReportError(resp.Body, "Body", "Body", "required", "")
+	}
+}
+
+// EncodingBase64 is the encoding of base64 encoded bodies.
+const EncodingBase64 = "base64"
+
+// DecodedBody returns the body, decoded if it is encoded.
+func (r JSONResponse) DecodedBody() ([]byte, error) {
+	if r.Encoding != EncodingBase64 {
+		return []byte(r.Body), nil
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(r.Body))
+}
+
+// validate is shared across calls; it caches struct metadata and is safe for
+// concurrent use.
+var validate = func() *validator.Validate {
+	v := validator.New()
+	v.RegisterStructValidation(validateJSONResponse, JSONResponse{})
+	return v
+}()
+
 var supportsSystemPrompt = map[string]bool{
-	"openai":    true,
-	"anthropic": true,
-	"ollama":    true,
-	"cohere":    true,
+	"openai":       true,
+	"azure-openai": true,
+	"anthropic":    true,
+	"ollama":       true,
+	"cohere":       true,
+	"mistral":      true,
+	// Chat completions servers accept system messages, but JSON mode support
+	// varies, so it is not requested.
+	"openai-compatible": true,
+}
+
+var supportsJSONMode = map[string]bool{
+	"openai":       true,
+	"azure-openai": true,
+	"ollama":       true,
+	"mistral":      true,
+}
+
+// supportsSeed, supportsTopP, supportsPenalties and supportsStop are the
+// providers whose clients pass the seed, the top_p, the frequency and presence
+// penalties and the stop sequences of the sampling to their APIs.
+var supportsSeed = map[string]bool{
+	"openai":            true,
+	"azure-openai":      true,
+	"openai-compatible": true,
+	"ollama":            true,
+	"mistral":           true,
+}
+
+var supportsTopP = map[string]bool{
+	"anthropic":  true,
+	"googleai":   true,
+	"gcp-vertex": true,
+	"bedrock":    true,
+	"ollama":     true,
+}
+
+var supportsPenalties = map[string]bool{
+	"openai":            true,
+	"azure-openai":      true,
+	"openai-compatible": true,
+	"ollama":            true,
+}
+
+var supportsStop = map[string]bool{
+	"openai":            true,
+	"azure-openai":      true,
+	"openai-compatible": true,
+	"anthropic":         true,
+	"googleai":          true,
+	"gcp-vertex":        true,
+	"bedrock":           true,
+	"ollama":            true,
+}
+
+// jsonInstruction is appended to the prompt for providers without a native
+// JSON mode.
+const jsonInstruction = "Return only the JSON object, without markdown code blocks or any text outside the JSON structure."
+
+// expectContinueInstruction is appended to the prompt for requests sent with
+// "Expect: 100-continue".
+const expectContinueInstruction = "The client sent \"Expect: 100-continue\" and the server has already replied with an interim \"100 Continue\". Generate the final response to the complete request."
+
+// Capabilities describes the optional features supported by a provider.
+type Capabilities struct {
+	JSONMode     bool
+	SystemPrompt bool
+	ToolCalling  bool
+	Seed         bool
+	TopP         bool
+	Penalties    bool
+	Stop         bool
+}
+
+// CapabilitiesFor returns the capabilities of the given provider.
+func CapabilitiesFor(provider string) Capabilities {
+	return Capabilities{
+		JSONMode:     supportsJSONMode[provider],
+		SystemPrompt: supportsSystemPrompt[provider],
+		ToolCalling:  supportsToolCalling[provider],
+		Seed:         supportsSeed[provider],
+		TopP:         supportsTopP[provider],
+		Penalties:    supportsPenalties[provider],
+		Stop:         supportsStop[provider],
+	}
+}
+
+// samplingOptions returns the call options of the sampling settings and the
+// maximum tokens of the configuration, without the settings its provider
+// doesn't support.
+func samplingOptions(config Config) []llms.CallOption {
+	opts := []llms.CallOption{llms.WithTemperature(config.Temperature)}
+	caps := CapabilitiesFor(config.Provider)
+	if config.Seed != 0 && caps.Seed {
+		opts = append(opts, llms.WithSeed(config.Seed))
+	}
+	if config.TopP > 0 && caps.TopP {
+		opts = append(opts, llms.WithTopP(config.TopP))
+	}
+	if caps.Penalties {
+		if config.FrequencyPenalty != 0 {
+			opts = append(opts, llms.WithFrequencyPenalty(config.FrequencyPenalty))
+		}
+		if config.PresencePenalty != 0 {
+			opts = append(opts, llms.WithPresencePenalty(config.PresencePenalty))
+		}
+	}
+	if len(config.StopSequences) > 0 && caps.Stop {
+		opts = append(opts, llms.WithStopWords(config.StopSequences))
+	}
+	if config.MaxTokens > 0 {
+		opts = append(opts, llms.WithMaxTokens(config.MaxTokens))
+	}
+	return opts
 }
 
 // New initializes the LLM client based on the provided configuration.
@@ -44,6 +229,8 @@ func New(ctx context.Context, config Config) (llms.Model, error) {
 	switch config.Provider {
 	case "openai":
 		return initOpenAIClient(config)
+	case "azure-openai":
+		return initAzureOpenAIClient(config)
 	case "googleai":
 		return initGoogleAIClient(ctx, config)
 	case "gcp-vertex":
@@ -54,60 +241,233 @@ func New(ctx context.Context, config Config) (llms.Model, error) {
 		return initCohereClient(config)
 	case "ollama":
 		return initOllamaClient(config)
+	case "bedrock":
+		return initBedrockClient(ctx, config)
+	case "mistral":
+		return initMistralClient(config)
+	case "openai-compatible":
+		return initOpenAICompatibleClient(config)
 	default:
-		return nil, errors.New("unsupported llm provider")
+		return nil, ErrUnsupportedProvider
 	}
 }
 
 // GenerateLLMResponse generates a response from the LLM using the input message.
-func GenerateLLMResponse(ctx context.Context, model llms.Model, temperature float64, messages []llms.MessageContent) (string, error) {
-	response, err := model.GenerateContent(
-		ctx,
-		messages,
-		llms.WithJSONMode(),
-		llms.WithTemperature(temperature),
-	)
+func GenerateLLMResponse(ctx context.Context, model llms.Model, config Config, messages []llms.MessageContent) (string, error) {
+	raw, _, err := generateResponse(ctx, model, config, messages)
+	return raw, err
+}
+
+// generateResponse generates a response like GenerateLLMResponse, and returns
+// the raw output of the model along with the response it decodes to.
+func generateResponse(ctx context.Context, model llms.Model, config Config, messages []llms.MessageContent) (string, JSONResponse, error) {
+	opts := samplingOptions(config)
+	caps := CapabilitiesFor(config.Provider)
+	toolCalling := config.ToolCalling && caps.ToolCalling
+	switch {
+	case toolCalling:
+		opts = append(opts, toolCallOptions()...)
+	case caps.JSONMode:
+		opts = append(opts, llms.WithJSONMode())
+	}
+
+	callCtx := ctx
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	pricing, priced := PricingFor(config.Model)
+	costCeiling := config.MaxRequestCost > 0 && priced
+	var promptTokens int
+	if costCeiling {
+		promptTokens = estimateMessagesTokens(messages)
+		if cost := pricing.Cost(promptTokens, 0); cost >= config.MaxRequestCost {
+			return "", JSONResponse{}, fmt.Errorf("%w: the prompt alone costs $%.6f", ErrCostCeiling, cost)
+		}
+		// Without streaming, the output is capped to the tokens left under
+		// the ceiling.
+		if tokens, ok := maxTokensUnder(config.MaxRequestCost, pricing, promptTokens); ok && !config.Stream && (config.MaxTokens <= 0 || tokens < config.MaxTokens) {
+			opts = append(opts, llms.WithMaxTokens(tokens))
+		}
+	}
+
+	var guard *streamGuard
+	if config.Stream {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithCancel(callCtx)
+		defer cancel()
+
+		// The HTML outputs served as the body don't abort the stream.
+		threshold := config.StreamAbortThreshold
+		if config.HTMLContent == HTMLContentBody {
+			threshold = 0
+		}
+		guard = newStreamGuard(threshold, cancel)
+		if costCeiling {
+			guard.withCostCeiling(config.MaxRequestCost, pricing, promptTokens)
+		}
+	}
+	if body := bodyStreamFrom(ctx); body != nil || guard != nil {
+		if body != nil {
+			body.begin()
+		}
+		opts = append(opts, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			if guard != nil {
+				if err := guard.consume(ctx, chunk); err != nil {
+					return err
+				}
+			}
+			if body != nil {
+				body.consume(chunk)
+			}
+			return nil
+		}))
+	}
+
+	response, err := model.GenerateContent(callCtx, messages, opts...)
+	if guard != nil {
+		switch abortErr := guard.abortErr(); {
+		case errors.Is(abortErr, ErrNonJSONStream):
+			return guard.partial(), JSONResponse{}, fmt.Errorf("%w after %d bytes", ErrNonJSONStream, guard.size())
+		case errors.Is(abortErr, ErrCostCeiling):
+			return guard.partial(), JSONResponse{}, fmt.Errorf("%w ($%.6f after %d bytes)", ErrCostCeiling, guard.cost(), guard.size())
+		}
+	}
 	if err != nil {
-		return "", fmt.Errorf("contentGenerationError: %s", err)
+		if errors.Is(err, ErrTokenRateLimit) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrBudgetExceeded) {
+			return "", JSONResponse{}, err
+		}
+		if config.Timeout > 0 && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+			return "", JSONResponse{}, fmt.Errorf("%w after %s: %w", ErrTimeout, config.Timeout, err)
+		}
+		if isHTMLClientError(err) {
+			return "", JSONResponse{}, fmt.Errorf("%w: %s", ErrProviderResponse, truncate(err.Error(), maxRawBodySize))
+		}
+		if classified := classifyProviderError(err); classified != nil {
+			return "", JSONResponse{}, fmt.Errorf("%w: %w", classified, err)
+		}
+		return "", JSONResponse{}, fmt.Errorf("%w: %w", ErrGeneration, err)
 	}
 	if response == nil {
-		return "", errors.New("emptyLLMResponse: response is nil")
+		return "", JSONResponse{}, fmt.Errorf("%w: response is nil", ErrEmptyResponse)
 	}
 	if len(response.Choices) == 0 {
-		return "", errors.New("emptyLLMResponse: no choices available")
+		return "", JSONResponse{}, fmt.Errorf("%w: no choices available", ErrEmptyResponse)
+	}
+	// The arguments of the response tool are JSON, they don't need cleaning.
+	if args, ok := toolCallArguments(response.Choices[0]); toolCalling && ok {
+		recordOutput(ctx, args)
+		args, parsed, err := parseRepairedJSON(args)
+		if err != nil {
+			return args, JSONResponse{}, fmt.Errorf("%w: %s", ErrInvalidJSON, err)
+		}
+		return args, parsed, nil
 	}
 	content := response.Choices[0].Content
+	recordOutput(ctx, content)
 	if content == "" {
-		return "", errors.New("emptyLLMResponse: content of first choice is empty")
+		return "", JSONResponse{}, fmt.Errorf("%w: content of first choice is empty", ErrEmptyResponse)
+	}
+	if err := providerResponseError(content, config.HTMLContent); err != nil {
+		return content, JSONResponse{}, err
+	}
+	// The HTML document is returned in the JSON response it is served with.
+	if trimmed := strings.TrimSpace(content); config.HTMLContent == HTMLContentBody && isHTMLDocument(trimmed) {
+		resp := htmlResponse(trimmed)
+		raw, err := json.Marshal(resp)
+		return string(raw), resp, err
 	}
-	resp := cleanResponse(content)
-	if err := ValidateJSON(resp); err != nil {
-		return resp, fmt.Errorf("invalidJSONResponse: %s", err)
+	resp, parsed, err := parseRepairedJSON(cleanResponse(content))
+	if err != nil {
+		if isRefusal(resp) {
+			return resp, JSONResponse{}, fmt.Errorf("%w: %s", ErrRefusal, truncate(resp, maxRawBodySize))
+		}
+		return resp, JSONResponse{}, fmt.Errorf("%w: %s", ErrInvalidJSON, err)
 	}
 
-	return resp, nil
+	return resp, parsed, nil
 }
 
 // CreateMessageContent creates the message content to be processed by the LLM.
-func CreateMessageContent(r *http.Request, cfg *config.Config, provider string) ([]llms.MessageContent, error) {
-	httpReq, err := httputil.DumpRequest(r, true)
+// The request body is presented according to its content type (see
+// dumpRequest), and truncated to the configured maximum number of tokens. The
+// user prompt is either a format string for the request
+// dump or a text/template rendered with the PromptData of the request. The
+// configured few-shot examples for the persona precede the request.
+// If history is not nil, recent requests from the same session are included in
+// the user prompt, as is the state of the session cookie of the request, if
+// any (see WithSessionState).
+func CreateMessageContent(r *http.Request, cfg *config.Config, provider string, history *History) ([]llms.MessageContent, error) {
+	httpReq, err := dumpRequest(r, cfg.MaxRequestTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := ResolveServerProfile(cfg.ServerProfile)
 	if err != nil {
 		return nil, err
 	}
 
-	userPrompt := fmt.Sprintf(cfg.UserPrompt, strings.TrimSpace(string(httpReq)))
+	dump := strings.TrimSpace(httpReq)
+	if cfg.PromptInjection.Strip {
+		dump = stripInjection(dump)
+	}
+	if cfg.PromptInjection.Delimit {
+		dump = delimitRequest(dump)
+	}
+	data := newPromptData(r, dump, profile, cfg.ServerProfile.Name)
+	userPrompt, err := renderUserPrompt(cfg.UserPrompt, data)
+	if err != nil {
+		return nil, err
+	}
+	if history != nil {
+		if recent := history.RecentFor(r); len(recent) > 0 {
+			userPrompt += "\n" + historyPrompt(recent)
+		}
+	}
+	if st := SessionStateFrom(r.Context()); st != nil {
+		userPrompt += "\n" + st.prompt()
+	}
+	if strings.EqualFold(r.Header.Get("Expect"), "100-continue") {
+		userPrompt += "\n" + expectContinueInstruction
+	}
 	systemPrompt := cfg.SystemPrompt
+	if profile != nil {
+		systemPrompt += "\n" + profile.prompt()
+	}
+	emulations, err := emulationsPrompt(cfg.Emulations, r)
+	if err != nil {
+		return nil, err
+	}
+	if emulations != "" {
+		systemPrompt += "\n" + emulations
+	}
+	if cfg.PromptInjection.Delimit {
+		systemPrompt += "\n" + delimitInstruction
+	}
 
-	if supportsSystemPrompt[provider] {
-		return []llms.MessageContent{
-			llms.TextParts(llms.ChatMessageTypeSystem, systemPrompt),
-			llms.TextParts(llms.ChatMessageTypeHuman, userPrompt),
-		}, nil
+	caps := CapabilitiesFor(provider)
+	if !caps.JSONMode {
+		userPrompt += "\n" + jsonInstruction
 	}
 
-	return []llms.MessageContent{
-		llms.TextParts(llms.ChatMessageTypeHuman, systemPrompt+"\n"+userPrompt),
-	}, nil
+	examples, err := exampleMessages(cfg.Examples, cfg.ServerProfile.Name, cfg.UserPrompt, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	if caps.SystemPrompt {
+		messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeSystem, systemPrompt)}
+		messages = append(messages, examples...)
+		return append(messages, llms.TextParts(llms.ChatMessageTypeHuman, userPrompt)), nil
+	}
+
+	// Without a system prompt, it is prepended to the first user message.
+	messages := append(examples, llms.TextParts(llms.ChatMessageTypeHuman, userPrompt))
+	messages[0] = llms.TextParts(llms.ChatMessageTypeHuman, systemPrompt+"\n"+messages[0].Parts[0].(llms.TextContent).Text)
+	return messages, nil
 }
 
 func cleanResponse(input string) string {
@@ -120,21 +480,31 @@ func cleanResponse(input string) string {
 
 // ValidateJSON validates the JSON structure of the input.
 func ValidateJSON(jsonStr string) error {
+	_, err := ParseJSONResponse(jsonStr)
+	return err
+}
+
+// ParseJSONResponse decodes and validates the JSON-encoded response, and
+// normalizes its headers (see Normalize).
+func ParseJSONResponse(jsonStr string) (JSONResponse, error) {
 	jsonBytes := []byte(jsonStr)
 	// Check if the JSON format is correct
 	if !json.Valid(jsonBytes) {
-		return fmt.Errorf("input is not valid JSON")
+		return JSONResponse{}, fmt.Errorf("input is not valid JSON")
 	}
 	// Try to unmarshal the JSON into the struct
 	var resp JSONResponse
 	if err := json.Unmarshal(jsonBytes, &resp); err != nil {
-		return fmt.Errorf("error unmarshalling JSON: %s", err)
+		return JSONResponse{}, fmt.Errorf("error unmarshalling JSON: %s", err)
 	}
 	// Validate the struct using the `validator` package
-	validate := validator.New()
 	if err := validate.Struct(resp); err != nil {
-		return fmt.Errorf("validation error: %s", err)
+		return JSONResponse{}, fmt.Errorf("validation error: %s", err)
 	}
+	if _, err := resp.DecodedBody(); err != nil {
+		return JSONResponse{}, fmt.Errorf("validation error: invalid %s body: %s", resp.Encoding, err)
+	}
+	Normalize(&resp)
 
-	return nil
+	return resp, nil
 }
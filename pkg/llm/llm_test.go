@@ -2,12 +2,19 @@ package llm_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/0x4d31/galah/pkg/llm"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/tmc/langchaingo/llms"
+	"golang.org/x/sync/errgroup"
 )
 
 type MockModel struct {
@@ -71,7 +78,7 @@ func TestGenerateLLMResponse(t *testing.T) {
 				llms.TextParts(llms.ChatMessageTypeHuman, "test message"),
 			}
 
-			_, err := llm.GenerateLLMResponse(context.Background(), model, 1.0, messages)
+			_, err := llm.GenerateLLMResponse(context.Background(), model, llm.Config{Temperature: 1.0}, messages)
 			if tt.wantError {
 				assert.Error(t, err)
 				assert.Contains(t, tt.errorMessage, err.Error())
@@ -106,6 +113,50 @@ func TestValidateJSON(t *testing.T) {
 			expectErr: true,
 			errMsg:    "error unmarshalling JSON",
 		},
+		{
+			name:      "validStatusCode",
+			input:     `{"status_code": 301, "headers": {"Location": "/login"}, "body": "Moved"}`,
+			expectErr: false,
+		},
+		{
+			name:      "validationErrorStatusCodeOutOfRange",
+			input:     `{"status_code": 999, "headers": {"headerName1": "headerValue1"}, "body": "httpBody"}`,
+			expectErr: true,
+			errMsg:    "validation error",
+		},
+		{
+			name:      "validBase64Body",
+			input:     `{"headers": {"Content-Type": "image/x-icon"}, "encoding": "base64", "body": "AAABAAEAEBA="}`,
+			expectErr: false,
+		},
+		{
+			name:      "validationErrorUnknownEncoding",
+			input:     `{"headers": {"Content-Type": "image/x-icon"}, "encoding": "hex", "body": "0000"}`,
+			expectErr: true,
+			errMsg:    "validation error",
+		},
+		{
+			name:      "validationErrorInvalidBase64",
+			input:     `{"headers": {"Content-Type": "image/x-icon"}, "encoding": "base64", "body": "not base64!"}`,
+			expectErr: true,
+			errMsg:    "invalid base64 body",
+		},
+		{
+			name:      "emptyBodyNoContent",
+			input:     `{"status_code": 204, "headers": {"Server": "nginx"}, "body": ""}`,
+			expectErr: false,
+		},
+		{
+			name:      "emptyBodyRedirect",
+			input:     `{"status_code": 302, "headers": {"Location": "/login"}}`,
+			expectErr: false,
+		},
+		{
+			name:      "validationErrorMissingBody",
+			input:     `{"status_code": 200, "headers": {"Server": "nginx"}, "body": ""}`,
+			expectErr: true,
+			errMsg:    "validation error",
+		},
 		{
 			name:      "validationErrorMissingHeaders",
 			input:     `{"body": "httpBody"}`,
@@ -126,3 +177,484 @@ func TestValidateJSON(t *testing.T) {
 		})
 	}
 }
+
+// streamingModel returns a mock that streams the chunks, counting how many
+// were sent before the generation was cancelled.
+func streamingModel(chunks []string, streamed *int) *MockModel {
+	return &MockModel{
+		GenerateContentFunc: func(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+			var o llms.CallOptions
+			for _, opt := range opts {
+				opt(&o)
+			}
+			var content string
+			for _, chunk := range chunks {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				*streamed++
+				if o.StreamingFunc == nil {
+					content += chunk
+					continue
+				}
+				if err := o.StreamingFunc(ctx, []byte(chunk)); err != nil {
+					return nil, err
+				}
+				content += chunk
+			}
+			return &llms.ContentResponse{
+				Choices: []*llms.ContentChoice{{Content: content}},
+			}, nil
+		},
+	}
+}
+
+func TestGenerateLLMResponseStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		chunks     []string
+		threshold  int
+		wantErr    error
+		wantChunks int
+	}{
+		{
+			name:       "proseStreamAbortsEarly",
+			chunks:     []string{"Sure", "! Here", " is a", " realistic", " HTTP", " response", " for", " the", " request", ":"},
+			threshold:  16,
+			wantErr:    llm.ErrNonJSONStream,
+			wantChunks: 4,
+		},
+		{
+			name:       "fencedJSONStreamCompletes",
+			chunks:     []string{"```json\n", `{"headers": {"Server": "nginx"},`, ` "body": "ok"}`, "\n```"},
+			threshold:  4,
+			wantChunks: 4,
+		},
+		{
+			name:       "fencedProseStreamAbortsEarly",
+			chunks:     []string{"```", "Sure", "! Here", " is a", " realistic", " HTTP", " response", " for", " the", " request"},
+			threshold:  16,
+			wantErr:    llm.ErrNonJSONStream,
+			wantChunks: 5,
+		},
+		{
+			name:       "inlineFencedJSONStreamCompletes",
+			chunks:     []string{"``", "`js", "on", `{"headers": {"Server": "nginx"},`, ` "body": "ok"}`, "```"},
+			threshold:  4,
+			wantChunks: 6,
+		},
+		{
+			name:       "abortDisabled",
+			chunks:     []string{"Sure", "! Here", " is a", " response"},
+			threshold:  0,
+			wantErr:    errors.New("invalidJSONResponse: input is not valid JSON"),
+			wantChunks: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var streamed int
+			model := streamingModel(tt.chunks, &streamed)
+			messages := []llms.MessageContent{
+				llms.TextParts(llms.ChatMessageTypeHuman, "test message"),
+			}
+			config := llm.Config{Temperature: 1.0, Stream: true, StreamAbortThreshold: tt.threshold}
+
+			_, err := llm.GenerateLLMResponse(context.Background(), model, config, messages)
+			switch {
+			case tt.wantErr == nil:
+				assert.NoError(t, err)
+			case errors.Is(tt.wantErr, llm.ErrNonJSONStream):
+				assert.ErrorIs(t, err, llm.ErrNonJSONStream)
+			default:
+				assert.EqualError(t, err, tt.wantErr.Error())
+			}
+			assert.Equal(t, tt.wantChunks, streamed)
+		})
+	}
+}
+
+func TestGenerateLLMResponseProviderError(t *testing.T) {
+	gatewayPage := `<!DOCTYPE html>
+<html>
+<head><title>502 Bad Gateway</title></head>
+<body>
+<center><h1>502 Bad Gateway</h1></center>
+<hr><center>cloudflare</center>
+</body>
+</html>`
+
+	tests := []struct {
+		name        string
+		content     string
+		err         error
+		htmlContent string
+		wantType    error
+		contains    string
+	}{
+		{
+			name:        "htmlGatewayBody",
+			content:     gatewayPage,
+			htmlContent: llm.HTMLContentProviderError,
+			wantType:    llm.ErrProviderResponse,
+			contains:    "502 Bad Gateway",
+		},
+		{
+			name:     "htmlModelContent",
+			content:  gatewayPage,
+			wantType: llm.ErrInvalidJSON,
+		},
+		{
+			name:     "errorEnvelope",
+			content:  `{"error": {"code": 429, "message": "Resource has been exhausted", "status": "RESOURCE_EXHAUSTED"}}`,
+			wantType: llm.ErrProviderResponse,
+			contains: "RESOURCE_EXHAUSTED",
+		},
+		{
+			name:     "htmlDecodeError",
+			err:      errors.New("invalid character '<' looking for beginning of value"),
+			wantType: llm.ErrProviderResponse,
+		},
+		{
+			name:        "truncatedRawBody",
+			content:     "<html>" + strings.Repeat("A", 2048) + "</html>",
+			htmlContent: llm.HTMLContentProviderError,
+			wantType:    llm.ErrProviderResponse,
+			contains:    "...(truncated)",
+		},
+		{
+			name:     "rateLimitError",
+			err:      errors.New("API returned unexpected status code: 429: Rate limit reached for requests"),
+			wantType: llm.ErrRateLimited,
+		},
+		{
+			name:     "typedRateLimitError",
+			err:      fmt.Errorf("operation error Bedrock Runtime: InvokeModel: %w", statusError{code: 429}),
+			wantType: llm.ErrRateLimited,
+		},
+		{
+			name:     "unanchoredStatusCode",
+			err:      errors.New("read 429 bytes: unknown field in the billing section"),
+			wantType: llm.ErrGeneration,
+			contains: "read 429 bytes",
+		},
+		{
+			name:     "serverError",
+			err:      errors.New("API returned unexpected status code: 503: The server is overloaded"),
+			wantType: llm.ErrTransport,
+		},
+		{
+			name:     "networkError",
+			err:      &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connect: connection refused")},
+			wantType: llm.ErrTransport,
+		},
+		{
+			name:     "otherClientError",
+			err:      errors.New("unexpected field in the request"),
+			wantType: llm.ErrGeneration,
+			contains: "unexpected field in the request",
+		},
+		{
+			name:    "jsonResponseWithHTMLBody",
+			content: `{"headers": {"Content-Type": "text/html"}, "body": "<!DOCTYPE html><html></html>", "error": "none"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &MockModel{
+				GenerateContentFunc: func(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &llms.ContentResponse{
+						Choices: []*llms.ContentChoice{{Content: tt.content}},
+					}, nil
+				},
+			}
+			messages := []llms.MessageContent{
+				llms.TextParts(llms.ChatMessageTypeHuman, "test message"),
+			}
+
+			_, err := llm.GenerateLLMResponse(context.Background(), model, llm.Config{HTMLContent: tt.htmlContent}, messages)
+			if tt.wantType == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantType)
+			if tt.wantType != llm.ErrInvalidJSON {
+				assert.NotContains(t, err.Error(), "invalidJSONResponse")
+			}
+			assert.Contains(t, err.Error(), tt.contains)
+			assert.Less(t, len(err.Error()), 700)
+		})
+	}
+}
+
+func TestGenerateLLMResponseWrapsClientError(t *testing.T) {
+	model := &MockModel{
+		GenerateContentFunc: func(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+			return nil, fmt.Errorf("API returned unexpected status code: 429: %w", context.Canceled)
+		},
+	}
+	_, err := llm.GenerateLLMResponse(context.Background(), model, llm.Config{}, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "test")})
+	assert.ErrorIs(t, err, llm.ErrRateLimited)
+	assert.ErrorIs(t, err, context.Canceled, "the error of the client should be wrapped")
+}
+
+func TestGenerateLLMResponseHTMLBody(t *testing.T) {
+	page := "<!DOCTYPE html>\n<html><body><h1>Sign In</h1></body></html>\n"
+	model := &MockModel{
+		GenerateContentFunc: func(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+			return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: page}}}, nil
+		},
+	}
+	raw, err := llm.GenerateLLMResponse(context.Background(), model, llm.Config{HTMLContent: llm.HTMLContentBody}, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "test")})
+	assert.NoError(t, err)
+	resp, err := llm.ParseJSONResponse(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Headers["Content-Type"])
+	assert.Equal(t, strings.TrimSpace(page), resp.Body)
+}
+
+func TestCheckHTMLContent(t *testing.T) {
+	for _, mode := range []string{"", llm.HTMLContentInvalidJSON, llm.HTMLContentBody, llm.HTMLContentProviderError} {
+		assert.NoError(t, llm.CheckHTMLContent(mode))
+	}
+	assert.Error(t, llm.CheckHTMLContent("serve"))
+}
+
+func TestGenerateLLMResponseCostCeiling(t *testing.T) {
+	// Each chunk is ~100 tokens, i.e. $0.0015 of gpt-4o output.
+	chunks := []string{`{"headers": {}, "body": "`}
+	for i := 0; i < 20; i++ {
+		chunks = append(chunks, strings.Repeat("x", 400))
+	}
+	chunks = append(chunks, `"}`)
+
+	tests := []struct {
+		name       string
+		model      string
+		ceiling    float64
+		prompt     string
+		wantErr    bool
+		wantChunks int
+	}{
+		{
+			name:       "cancelledNearCeiling",
+			model:      "gpt-4o-2024-05-13",
+			ceiling:    0.01,
+			wantErr:    true,
+			wantChunks: 8,
+		},
+		{
+			name:       "underCeiling",
+			model:      "gpt-4o-mini",
+			ceiling:    0.01,
+			wantChunks: len(chunks),
+		},
+		{
+			name:       "unknownModelPricing",
+			model:      "llama3",
+			ceiling:    0.01,
+			wantChunks: len(chunks),
+		},
+		{
+			// ~2500 tokens, i.e. $0.0125 of gpt-4o input.
+			name:    "promptOverCeiling",
+			model:   "gpt-4o",
+			ceiling: 0.01,
+			prompt:  strings.Repeat("x", 10000),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var streamed int
+			model := streamingModel(chunks, &streamed)
+			prompt := tt.prompt
+			if prompt == "" {
+				prompt = "test message"
+			}
+			messages := []llms.MessageContent{
+				llms.TextParts(llms.ChatMessageTypeHuman, prompt),
+			}
+			config := llm.Config{Model: tt.model, MaxRequestCost: tt.ceiling, Stream: true}
+
+			_, err := llm.GenerateLLMResponse(context.Background(), model, config, messages)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, llm.ErrCostCeiling)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantChunks, streamed)
+		})
+	}
+}
+
+func TestGenerateLLMResponseCostCeilingMaxTokens(t *testing.T) {
+	var opts llms.CallOptions
+	model := &MockModel{
+		GenerateContentFunc: func(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+			for _, opt := range options {
+				opt(&opts)
+			}
+			return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: `{"headers": {}, "body": "ok"}`}}}, nil
+		},
+	}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "test message")}
+
+	// $0.01 is ~666 tokens of gpt-4o output, less the prompt.
+	_, err := llm.GenerateLLMResponse(context.Background(), model, llm.Config{Model: "gpt-4o", MaxRequestCost: 0.01}, messages)
+	assert.NoError(t, err)
+	assert.Nil(t, opts.StreamingFunc, "the cost ceiling shouldn't stream the generation")
+	assert.InDelta(t, 666, opts.MaxTokens, 2)
+
+	opts = llms.CallOptions{}
+	_, err = llm.GenerateLLMResponse(context.Background(), model, llm.Config{Model: "gpt-4o", MaxRequestCost: 0.01, MaxTokens: 100}, messages)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, opts.MaxTokens)
+}
+
+func TestValidateJSONConcurrent(t *testing.T) {
+	inputs := map[string]bool{
+		`{"headers": {"Server": "nginx"}, "body": "ok"}`: true,
+		`{"body": "missing headers"}`:                    false,
+		`{"headers": {"Server": "nginx"}}`:               false,
+	}
+
+	var g errgroup.Group
+	for i := 0; i < 50; i++ {
+		for input, valid := range inputs {
+			input, valid := input, valid
+			g.Go(func() error {
+				if err := llm.ValidateJSON(input); (err == nil) != valid {
+					return fmt.Errorf("ValidateJSON(%s) error = %v, valid %v", input, err, valid)
+				}
+				return nil
+			})
+		}
+	}
+	assert.NoError(t, g.Wait())
+}
+
+func BenchmarkValidateJSON(b *testing.B) {
+	input := `{"headers": {"Content-Type": "text/html", "Server": "nginx"}, "body": "<html><body>ok</body></html>"}`
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := llm.ValidateJSON(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestGenerateLLMResponseMaxTokens(t *testing.T) {
+	for _, maxTokens := range []int{0, 512} {
+		var got int
+		model := &MockModel{
+			GenerateContentFunc: func(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+				var o llms.CallOptions
+				for _, opt := range opts {
+					opt(&o)
+				}
+				got = o.MaxTokens
+				return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: `{"headers": {}, "body": "ok"}`}}}, nil
+			},
+		}
+		config := llm.Config{Provider: "openai", MaxTokens: maxTokens}
+		_, err := llm.GenerateLLMResponse(context.Background(), model, config, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, maxTokens, got)
+	}
+}
+
+func TestGenerateLLMResponseTimeout(t *testing.T) {
+	model := &MockModel{
+		GenerateContentFunc: func(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	config := llm.Config{Provider: "openai", Timeout: 10 * time.Millisecond}
+
+	_, err := llm.GenerateLLMResponse(context.Background(), model, config, nil)
+	assert.ErrorIs(t, err, llm.ErrTimeout)
+	assert.Equal(t, llm.ErrorKindTimeout, llm.ErrorKind(err))
+
+	// A request canceled by the client is not a provider timeout.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = llm.GenerateLLMResponse(ctx, model, config, nil)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, llm.ErrTimeout)
+}
+
+func TestGenerateLLMResponseSampling(t *testing.T) {
+	tests := []struct {
+		provider  string
+		seed      int
+		topP      float64
+		penalties bool
+		stop      []string
+	}{
+		{provider: "openai", seed: 42, penalties: true, stop: []string{"\n\n\n"}},
+		{provider: "ollama", seed: 42, topP: 0.9, penalties: true, stop: []string{"\n\n\n"}},
+		{provider: "anthropic", topP: 0.9, stop: []string{"\n\n\n"}},
+		{provider: "cohere"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			var got llms.CallOptions
+			model := &MockModel{
+				GenerateContentFunc: func(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+					for _, opt := range opts {
+						opt(&got)
+					}
+					return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: `{"headers": {}, "body": "ok"}`}}}, nil
+				},
+			}
+			// The settings not supported by the provider are not passed.
+			config := llm.Config{
+				Provider:         tt.provider,
+				Temperature:      0.5,
+				Seed:             42,
+				TopP:             0.9,
+				FrequencyPenalty: 0.5,
+				PresencePenalty:  0.3,
+				StopSequences:    []string{"\n\n\n"},
+				MaxTokens:        500,
+			}
+			_, err := llm.GenerateLLMResponse(context.Background(), model, config, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, 0.5, got.Temperature)
+			assert.Equal(t, tt.seed, got.Seed)
+			assert.Equal(t, tt.topP, got.TopP)
+			assert.Equal(t, tt.stop, got.StopWords)
+			assert.Equal(t, 500, got.MaxTokens)
+			if tt.penalties {
+				assert.Equal(t, 0.5, got.FrequencyPenalty)
+				assert.Equal(t, 0.3, got.PresencePenalty)
+			} else {
+				assert.Zero(t, got.FrequencyPenalty)
+				assert.Zero(t, got.PresencePenalty)
+			}
+		})
+	}
+}
+
+// statusError is a provider client error carrying the status code of the
+// response.
+type statusError struct {
+	code int
+}
+
+func (e statusError) Error() string {
+	return "https response error: ThrottlingException"
+}
+
+func (e statusError) HTTPStatusCode() int {
+	return e.code
+}
@@ -0,0 +1,34 @@
+package llm
+
+import (
+	"fmt"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// defaultMistralURL is the base URL of Mistral's hosted API.
+const defaultMistralURL = "https://api.mistral.ai/v1"
+
+// initMistralClient initializes a client for Mistral's hosted API. The API is
+// compatible with OpenAI's chat completions, including the JSON mode
+// response_format, so the OpenAI client is used.
+func initMistralClient(config Config) (llms.Model, error) {
+	if config.APIKey == "" {
+		return nil, fmt.Errorf("API key is required")
+	}
+	serverURL := config.ServerURL
+	if serverURL == "" {
+		serverURL = defaultMistralURL
+	}
+	opts := []openai.Option{
+		openai.WithBaseURL(serverURL),
+		openai.WithModel(config.Model),
+		openai.WithToken(config.APIKey),
+	}
+	m, err := openai.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,45 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestMistralProvider(t *testing.T) {
+	var gotPath, gotAuth string
+	var gotBody struct {
+		Model          string `json:"model"`
+		ResponseFormat struct {
+			Type string `json:"type"`
+		} `json:"response_format"`
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{\"headers\": {\"Server\": \"nginx\"}, \"body\": \"ok\"}"}, "finish_reason": "stop"}]}`))
+	}))
+	defer ts.Close()
+
+	config := llm.Config{Provider: "mistral", Model: "mistral-small-latest", APIKey: "secret", ServerURL: ts.URL}
+	model, err := llm.New(context.Background(), config)
+	require.NoError(t, err)
+
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+	resp, err := llm.GenerateLLMResponse(context.Background(), model, config, messages)
+	require.NoError(t, err)
+	assert.Equal(t, `{"headers": {"Server": "nginx"}, "body": "ok"}`, resp)
+	assert.Equal(t, "/chat/completions", gotPath)
+	assert.Equal(t, "Bearer secret", gotAuth)
+	assert.Equal(t, "mistral-small-latest", gotBody.Model)
+	assert.Equal(t, "json_object", gotBody.ResponseFormat.Type, "JSON mode should be requested")
+	assert.True(t, llm.CapabilitiesFor("mistral").JSONMode)
+}
@@ -0,0 +1,223 @@
+package llm
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+)
+
+// Checks of the moderation of the generated responses.
+const (
+	// ModerationSelfIdentification finds the model identifying itself as an
+	// AI or a language model.
+	ModerationSelfIdentification = "self_identification"
+	// ModerationSecrets finds the secrets in the formats of the common
+	// providers: private keys, AWS, GitHub, Slack, Google, Stripe, OpenAI and
+	// Anthropic keys.
+	ModerationSecrets = "secrets"
+	// ModerationAPIKeys finds the API keys of the operator, and the
+	// configured patterns of its keys.
+	ModerationAPIKeys = "api_keys"
+	// ModerationHostnames finds the internal host names.
+	ModerationHostnames = "hostnames"
+)
+
+// moderationHost replaces the internal host names in the patched responses.
+const moderationHost = "localhost"
+
+// minModeratedKey is the minimum length of the API keys checked, as shorter
+// ones would match ordinary words.
+const minModeratedKey = 8
+
+// selfIdentificationPatterns match the model talking about itself.
+var selfIdentificationPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bas an? (?:ai|artificial intelligence|large language model|language model)(?: (?:language )?model| assistant)?\b,?\s*`),
+	regexp.MustCompile(`(?i)\bI(?:'m|’m| am) (?:an? )?(?:ai(?: language model| assistant| model)?|artificial intelligence|large language model|language model|chatgpt|claude|gemini|llama)\b[.,]?\s*`),
+	regexp.MustCompile(`(?i)\b(?:created|developed|trained) by (?:openai|anthropic|google deepmind|meta ai|mistral ai)\b[.,]?\s*`),
+	regexp.MustCompile(`(?i)\bmy (?:training data|knowledge cutoff)\b`),
+}
+
+// secretPatterns match the secrets in the formats of the common providers.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36}\b`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+	regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}\b`),
+	regexp.MustCompile(`\bsk-(?:proj-|ant-)?[A-Za-z0-9_-]{20,}`),
+}
+
+// moderationChecks describe the checks in the prompt of the regeneration.
+var moderationChecks = map[string]string{
+	ModerationSelfIdentification: "statements about being an AI or a language model",
+	ModerationSecrets:            "real secrets",
+	ModerationAPIKeys:            "API keys",
+	ModerationHostnames:          "internal host names",
+}
+
+// ModerationConfig configures a Moderator: the Checks made, all of them if
+// empty, the operator's APIKeys and Patterns (regular expressions) of its
+// keys, and the internal Hostnames.
+type ModerationConfig struct {
+	Checks    []string
+	APIKeys   []string
+	Patterns  []string
+	Hostnames []string
+}
+
+// ModerationFinding is a match of a check in a generated response.
+type ModerationFinding struct {
+	Check string
+	Match string
+}
+
+type moderationRule struct {
+	check string
+	re    *regexp.Regexp
+	patch func(match string) string
+}
+
+// Moderator finds the leaks in the generated responses, the secrets, the
+// internal host names and the model identifying itself, and patches them.
+type Moderator struct {
+	rules []moderationRule
+}
+
+// NewModerator returns the Moderator of the configuration.
+func NewModerator(cfg ModerationConfig) (*Moderator, error) {
+	checks := make(map[string]bool)
+	for _, c := range cfg.Checks {
+		if _, ok := moderationChecks[c]; !ok {
+			return nil, fmt.Errorf("unknown moderation check %q", c)
+		}
+		checks[c] = true
+	}
+	enabled := func(check string) bool {
+		return len(checks) == 0 || checks[check]
+	}
+
+	m := &Moderator{}
+	if enabled(ModerationSelfIdentification) {
+		for _, re := range selfIdentificationPatterns {
+			m.rules = append(m.rules, moderationRule{ModerationSelfIdentification, re, func(string) string { return "" }})
+		}
+	}
+	if enabled(ModerationSecrets) {
+		for _, re := range secretPatterns {
+			m.rules = append(m.rules, moderationRule{ModerationSecrets, re, scrambleSecret})
+		}
+	}
+	if enabled(ModerationAPIKeys) {
+		for _, key := range cfg.APIKeys {
+			if len(key) >= minModeratedKey {
+				m.rules = append(m.rules, moderationRule{ModerationAPIKeys, regexp.MustCompile(regexp.QuoteMeta(key)), scrambleSecret})
+			}
+		}
+		for _, p := range cfg.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid moderation pattern %q: %w", p, err)
+			}
+			m.rules = append(m.rules, moderationRule{ModerationAPIKeys, re, scrambleSecret})
+		}
+	}
+	if enabled(ModerationHostnames) {
+		for _, host := range cfg.Hostnames {
+			if host == "" || strings.EqualFold(host, moderationHost) {
+				continue
+			}
+			re := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(host) + `\b`)
+			m.rules = append(m.rules, moderationRule{ModerationHostnames, re, func(string) string { return moderationHost }})
+		}
+	}
+	return m, nil
+}
+
+// Scan returns the findings in the body and the headers of the response.
+// The base64-encoded bodies aren't scanned.
+func (m *Moderator) Scan(resp JSONResponse) []ModerationFinding {
+	var findings []ModerationFinding
+	m.apply(&resp, func(rule moderationRule, s string) string {
+		for _, match := range rule.re.FindAllString(s, -1) {
+			findings = append(findings, ModerationFinding{Check: rule.check, Match: match})
+		}
+		return s
+	})
+	return findings
+}
+
+// Patch patches the findings in the response and returns them: the secrets
+// and the API keys are replaced with random ones in the same format, the
+// internal host names with localhost, and the self-identifications removed.
+func (m *Moderator) Patch(resp *JSONResponse) []ModerationFinding {
+	var findings []ModerationFinding
+	m.apply(resp, func(rule moderationRule, s string) string {
+		return rule.re.ReplaceAllStringFunc(s, func(match string) string {
+			findings = append(findings, ModerationFinding{Check: rule.check, Match: match})
+			return rule.patch(match)
+		})
+	})
+	return findings
+}
+
+// apply replaces the body and the header values of the response with the
+// results of f for each rule.
+func (m *Moderator) apply(resp *JSONResponse, f func(rule moderationRule, s string) string) {
+	for _, rule := range m.rules {
+		if resp.Encoding != EncodingBase64 {
+			resp.Body = f(rule, resp.Body)
+		}
+		for key, value := range resp.Headers {
+			resp.Headers[key] = f(rule, value)
+		}
+	}
+}
+
+// ModerationPrompt returns the prompt asking the model to generate the
+// response again without the findings.
+func ModerationPrompt(findings []ModerationFinding) string {
+	var kinds []string
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		if !seen[f.Check] {
+			seen[f.Check] = true
+			kinds = append(kinds, moderationChecks[f.Check])
+		}
+	}
+	return fmt.Sprintf("Your previous response contained %s. Generate the response again without them, only as the emulated server would.", strings.Join(kinds, " and "))
+}
+
+// scrambleSecret returns a random secret in the format of the secret: the
+// letters and digits after its first four characters are replaced with
+// random ones of the same case, and the lines of the PEM blocks are kept.
+func scrambleSecret(secret string) string {
+	if strings.HasPrefix(secret, "-----BEGIN ") {
+		lines := strings.Split(secret, "\n")
+		for i, line := range lines {
+			if !strings.HasPrefix(line, "-----") {
+				lines[i] = scramble(line, 0)
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	return scramble(secret, 4)
+}
+
+// scramble replaces the letters and digits of s after the first keep bytes
+// with random ones of the same class.
+func scramble(s string, keep int) string {
+	b := []byte(s)
+	for i := keep; i < len(b); i++ {
+		switch c := b[i]; {
+		case c >= 'a' && c <= 'z':
+			b[i] = byte('a' + rand.Intn(26))
+		case c >= 'A' && c <= 'Z':
+			b[i] = byte('A' + rand.Intn(26))
+		case c >= '0' && c <= '9':
+			b[i] = byte('0' + rand.Intn(10))
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,362 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// Date layouts that models commonly use instead of the HTTP date format.
+var fallbackDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC3339,
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// Normalize fixes or strips malformed header values generated by the LLM.
+func Normalize(resp *JSONResponse) {
+	for key, value := range resp.Headers {
+		switch http.CanonicalHeaderKey(key) {
+		case "Etag":
+			normalizeHeader(resp.Headers, key, normalizeETag(value))
+		case "Last-Modified", "Date", "Expires":
+			normalizeHeader(resp.Headers, key, normalizeHTTPDate(value))
+		case "Www-Authenticate":
+			normalizeHeader(resp.Headers, key, normalizeChallenge(value))
+		}
+	}
+}
+
+func normalizeHeader(headers map[string]string, key, value string) {
+	if value == "" {
+		delete(headers, key)
+		return
+	}
+	headers[key] = value
+}
+
+// normalizeETag returns a well-formed entity tag, quoting a bare opaque tag
+// if needed, or an empty string if the value can't be fixed.
+func normalizeETag(value string) string {
+	value = strings.TrimSpace(value)
+	weak := strings.HasPrefix(value, "W/")
+	tag := strings.TrimPrefix(value, "W/")
+
+	if len(tag) >= 2 && strings.HasPrefix(tag, `"`) && strings.HasSuffix(tag, `"`) {
+		tag = tag[1 : len(tag)-1]
+	} else if strings.Contains(tag, `"`) {
+		return ""
+	}
+	if tag == "" || !isETagChars(tag) {
+		return ""
+	}
+
+	etag := `"` + tag + `"`
+	if weak {
+		etag = "W/" + etag
+	}
+	return etag
+}
+
+// isETagChars reports whether s only contains valid etagc characters
+// (RFC 7232, section 2.3).
+func isETagChars(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c <= 0x20 || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeHTTPDate returns the value formatted as an HTTP date, or an empty
+// string if it can't be parsed.
+func normalizeHTTPDate(value string) string {
+	value = strings.TrimSpace(value)
+	if t, err := http.ParseTime(value); err == nil {
+		return t.UTC().Format(http.TimeFormat)
+	}
+	for _, layout := range fallbackDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC().Format(http.TimeFormat)
+		}
+	}
+	return ""
+}
+
+// framingHeaders are the headers of the framing of the messages and of the
+// connection, set by the server.
+var framingHeaders = []string{
+	"Content-Length",
+	"Transfer-Encoding",
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Upgrade",
+	"Te",
+	"Trailer",
+}
+
+// statusHeaders are the headers only meaningful with some status codes.
+var statusHeaders = map[string]func(status int) bool{
+	"Location":         func(status int) bool { return status == http.StatusCreated || (status >= 300 && status < 400) },
+	"Www-Authenticate": func(status int) bool { return status == http.StatusUnauthorized },
+	"Retry-After": func(status int) bool {
+		return status == http.StatusServiceUnavailable || status == http.StatusTooManyRequests || (status >= 300 && status < 400)
+	},
+	"Content-Range": func(status int) bool {
+		return status == http.StatusPartialContent || status == http.StatusRequestedRangeNotSatisfiable
+	},
+}
+
+// SanitizeHeaders enforces the invariants of the headers generated by the
+// LLM: the headers with invalid names or values are stripped, the headers
+// repeated with another case are merged under their canonical name, the
+// framing headers are left to the server, the headers contradicting the
+// status code are stripped, as is a Content-Encoding the body isn't encoded
+// with.
+func SanitizeHeaders(resp *JSONResponse) {
+	status := resp.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	keys := make([]string, 0, len(resp.Headers))
+	for key := range resp.Headers {
+		keys = append(keys, key)
+	}
+	// The canonical names, then the first of the others in order, are kept.
+	sort.Slice(keys, func(i, j int) bool {
+		ci, cj := keys[i] == http.CanonicalHeaderKey(keys[i]), keys[j] == http.CanonicalHeaderKey(keys[j])
+		if ci != cj {
+			return ci
+		}
+		return keys[i] < keys[j]
+	})
+
+	headers := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value := strings.TrimSpace(resp.Headers[key])
+		name := http.CanonicalHeaderKey(strings.TrimSpace(key))
+		if !httpguts.ValidHeaderFieldName(name) || !httpguts.ValidHeaderFieldValue(value) {
+			continue
+		}
+		if _, ok := headers[name]; ok {
+			continue
+		}
+		if allowed, ok := statusHeaders[name]; ok && !allowed(status) {
+			continue
+		}
+		headers[name] = value
+	}
+	for _, name := range framingHeaders {
+		delete(headers, name)
+	}
+	if encoding, ok := headers["Content-Encoding"]; ok && !encodedBody(resp, encoding) {
+		delete(headers, "Content-Encoding")
+	}
+	resp.Headers = headers
+}
+
+// encodedBody reports whether the body is compressed with the content
+// coding, judging by the header of the gzip or zlib (deflate) data. The other
+// codings can't be checked.
+func encodedBody(resp *JSONResponse, coding string) bool {
+	if resp.Encoding != EncodingBase64 {
+		return false
+	}
+	body, err := resp.DecodedBody()
+	if err != nil || len(body) < 2 {
+		return false
+	}
+	switch strings.ToLower(coding) {
+	case "gzip", "x-gzip":
+		return body[0] == 0x1f && body[1] == 0x8b
+	case "deflate":
+		return body[0]&0x0f == 8 && (uint16(body[0])<<8|uint16(body[1]))%31 == 0
+	}
+	return false
+}
+
+// Elements whose content is left untouched by NormalizeWhitespace.
+var preservedElements = []string{"pre", "textarea", "code", "script", "style"}
+
+// NormalizeWhitespace trims trailing whitespace on each line and collapses
+// runs of blank lines in HTML bodies. Content inside elements where
+// whitespace is significant (e.g. <pre>) is preserved, and non-HTML bodies
+// are left unchanged.
+func NormalizeWhitespace(resp *JSONResponse) {
+	if !isHTMLResponse(resp) {
+		return
+	}
+
+	var b strings.Builder
+	body := resp.Body
+	for {
+		start, end := nextPreservedElement(body)
+		if start == -1 {
+			b.WriteString(collapseWhitespace(body, true))
+			break
+		}
+		b.WriteString(collapseWhitespace(body[:start], false))
+		b.WriteString(body[start:end])
+		body = body[end:]
+	}
+
+	normalized := strings.TrimLeft(b.String(), " \t\r\n")
+	if strings.HasSuffix(resp.Body, "\n") && !strings.HasSuffix(normalized, "\n") {
+		normalized += "\n"
+	}
+	resp.Body = normalized
+}
+
+func isHTMLResponse(resp *JSONResponse) bool {
+	if resp.Encoding != "" {
+		return false
+	}
+	for key, value := range resp.Headers {
+		if http.CanonicalHeaderKey(key) == "Content-Type" {
+			return strings.Contains(strings.ToLower(value), "html")
+		}
+	}
+	return false
+}
+
+// nextPreservedElement returns the offsets of the first preserved element in
+// s, or -1 if there is none. An unclosed element extends to the end of s.
+func nextPreservedElement(s string) (int, int) {
+	lower := strings.ToLower(s)
+	start, name := -1, ""
+	for _, el := range preservedElements {
+		for offset := 0; ; {
+			i := strings.Index(lower[offset:], "<"+el)
+			if i == -1 {
+				break
+			}
+			i += offset
+			next := i + len(el) + 1
+			// Make sure we matched the whole tag name (e.g. not <prefix>).
+			if next == len(lower) || strings.ContainsRune(" \t\r\n/>", rune(lower[next])) {
+				if start == -1 || i < start {
+					start, name = i, el
+				}
+				break
+			}
+			offset = next
+		}
+	}
+	if start == -1 {
+		return -1, -1
+	}
+
+	closing := "</" + name
+	end := strings.Index(lower[start:], closing)
+	if end == -1 {
+		return start, len(s)
+	}
+	end += start
+	if gt := strings.IndexByte(lower[end:], '>'); gt != -1 {
+		return start, end + gt + 1
+	}
+	return start, len(s)
+}
+
+// collapseWhitespace trims trailing whitespace of every complete line and
+// allows at most one blank line in a row. If final is true, s is the end of
+// the body and its trailing whitespace is removed as well.
+func collapseWhitespace(s string, final bool) string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	blank := 0
+	for i, line := range lines {
+		last := i == len(lines)-1
+		if !last || final {
+			line = strings.TrimRight(line, " \t\r")
+		}
+		// The first line continues the content before s, so it's never blank.
+		if line == "" && i > 0 && !last {
+			blank++
+			if blank > 1 {
+				continue
+			}
+		} else {
+			blank = 0
+		}
+		out = append(out, line)
+	}
+	if final {
+		return strings.TrimRight(strings.Join(out, "\n"), " \t\r\n")
+	}
+	return strings.Join(out, "\n")
+}
+
+// JSON body formats.
+const (
+	JSONFormatCompact = "compact"
+	JSONFormatPretty  = "pretty"
+)
+
+// FormatJSONBody re-serializes a JSON body in the given format, compact or
+// pretty (indented with two spaces), overriding the model's formatting. Key
+// order and number formatting are kept. Non-JSON bodies are left unchanged.
+func FormatJSONBody(resp *JSONResponse, format string) {
+	if resp.Encoding != "" {
+		return
+	}
+	body := strings.TrimSpace(resp.Body)
+	if !strings.HasPrefix(body, "{") && !strings.HasPrefix(body, "[") {
+		return
+	}
+	if !json.Valid([]byte(body)) {
+		return
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case JSONFormatCompact:
+		if err := json.Compact(&buf, []byte(body)); err != nil {
+			return
+		}
+	case JSONFormatPretty:
+		if err := json.Indent(&buf, []byte(body), "", "  "); err != nil {
+			return
+		}
+		buf.WriteByte('\n')
+	default:
+		return
+	}
+	resp.Body = buf.String()
+}
+
+// TruncateBody truncates a body longer than max bytes, on a UTF-8 character
+// boundary. Encoded bodies are truncated to max decoded bytes. It reports
+// whether the body was truncated.
+func TruncateBody(resp *JSONResponse, max int) bool {
+	if max <= 0 || len(resp.Body) <= max {
+		return false
+	}
+	if resp.Encoding == EncodingBase64 {
+		data, err := resp.DecodedBody()
+		if err != nil || len(data) <= max {
+			return false
+		}
+		resp.Body = base64.StdEncoding.EncodeToString(data[:max])
+		return true
+	}
+	end := max
+	for end > 0 && !utf8.RuneStart(resp.Body[end]) {
+		end--
+	}
+	resp.Body = resp.Body[:end]
+	return true
+}
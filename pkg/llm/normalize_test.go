@@ -0,0 +1,265 @@
+package llm_test
+
+import (
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    map[string]string
+	}{
+		{
+			name: "validCachingHeaders",
+			headers: map[string]string{
+				"ETag":          `"33a64df551425fcc55e4d42a148795d9f25f89d4"`,
+				"Last-Modified": "Wed, 21 Oct 2015 07:28:00 GMT",
+				"Date":          "Sun, 26 May 2024 16:37:26 GMT",
+			},
+			want: map[string]string{
+				"ETag":          `"33a64df551425fcc55e4d42a148795d9f25f89d4"`,
+				"Last-Modified": "Wed, 21 Oct 2015 07:28:00 GMT",
+				"Date":          "Sun, 26 May 2024 16:37:26 GMT",
+			},
+		},
+		{
+			name:    "weakETag",
+			headers: map[string]string{"ETag": `W/"0815"`},
+			want:    map[string]string{"ETag": `W/"0815"`},
+		},
+		{
+			name:    "unquotedETagIsQuoted",
+			headers: map[string]string{"etag": "5f3e-1a2b"},
+			want:    map[string]string{"etag": `"5f3e-1a2b"`},
+		},
+		{
+			name: "malformedETagIsStripped",
+			headers: map[string]string{
+				"ETag":         `"abc"def"`,
+				"Content-Type": "text/html",
+			},
+			want: map[string]string{"Content-Type": "text/html"},
+		},
+		{
+			name: "malformedChallengeIsStripped",
+			headers: map[string]string{
+				"WWW-Authenticate": `Digest realm="admin"`,
+				"Content-Type":     "text/html",
+			},
+			want: map[string]string{"Content-Type": "text/html"},
+		},
+		{
+			name: "fixableDatesAreReformatted",
+			headers: map[string]string{
+				"Last-Modified": "2024-05-26T16:37:26Z",
+				"Date":          "Sunday, 26-May-24 16:37:26 GMT",
+			},
+			want: map[string]string{
+				"Last-Modified": "Sun, 26 May 2024 16:37:26 GMT",
+				"Date":          "Sun, 26 May 2024 16:37:26 GMT",
+			},
+		},
+		{
+			name: "malformedDatesAreStripped",
+			headers: map[string]string{
+				"Last-Modified": "yesterday",
+				"Date":          "Sun, 32 May 2024 99:00:00 GMT",
+				"Server":        "nginx",
+			},
+			want: map[string]string{"Server": "nginx"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := llm.JSONResponse{Headers: tt.headers, Body: "body"}
+			llm.Normalize(&resp)
+			assert.Equal(t, tt.want, resp.Headers)
+		})
+	}
+}
+
+func TestNormalizeWhitespace(t *testing.T) {
+	html := map[string]string{"Content-Type": "text/html; charset=utf-8"}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		body    string
+		want    string
+	}{
+		{
+			name:    "trailingWhitespacePerLine",
+			headers: html,
+			body:    "<html>  \n<body>\t\n<p>hi</p>   \n</body>\n</html>\n",
+			want:    "<html>\n<body>\n<p>hi</p>\n</body>\n</html>\n",
+		},
+		{
+			name:    "excessiveBlankLines",
+			headers: html,
+			body:    "\n\n  <html>\n\n\n\n<body></body>\n\n\n</html>\n\n\n",
+			want:    "<html>\n\n<body></body>\n\n</html>\n",
+		},
+		{
+			name:    "preservedElements",
+			headers: html,
+			body:    "<div>   \n<PRE>line one   \n\n\n\n  indented  </PRE>   \n<textarea>a  \n\n\nb</textarea>\n\n\n<prefix>  \n</div>",
+			want:    "<div>\n<PRE>line one   \n\n\n\n  indented  </PRE>\n<textarea>a  \n\n\nb</textarea>\n\n<prefix>\n</div>",
+		},
+		{
+			name:    "unclosedPreservedElement",
+			headers: html,
+			body:    "<p>x</p>   \n<pre>  keep  \n\n\n",
+			want:    "<p>x</p>\n<pre>  keep  \n\n\n",
+		},
+		{
+			name:    "nonHTMLUntouched",
+			headers: map[string]string{"Content-Type": "text/plain"},
+			body:    "key = value   \n\n\n\nother = 1  \n",
+			want:    "key = value   \n\n\n\nother = 1  \n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := llm.JSONResponse{Headers: tt.headers, Body: tt.body}
+			llm.NormalizeWhitespace(&resp)
+			assert.Equal(t, tt.want, resp.Body)
+		})
+	}
+}
+
+func TestFormatJSONBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		body   string
+		want   string
+	}{
+		{
+			name:   "compact",
+			format: llm.JSONFormatCompact,
+			body:   "{\n  \"status\": \"ok\",\n  \"users\": [1, 2.50]\n}",
+			want:   `{"status":"ok","users":[1,2.50]}`,
+		},
+		{
+			name:   "pretty",
+			format: llm.JSONFormatPretty,
+			body:   `{"status":"ok","users":[{"id":1,"name":"admin"}]}`,
+			want:   "{\n  \"status\": \"ok\",\n  \"users\": [\n    {\n      \"id\": 1,\n      \"name\": \"admin\"\n    }\n  ]\n}\n",
+		},
+		{
+			name:   "nonJSONBodyIsUnchanged",
+			format: llm.JSONFormatCompact,
+			body:   "<html>\n  <body>{ }</body>\n</html>",
+			want:   "<html>\n  <body>{ }</body>\n</html>",
+		},
+		{
+			name:   "invalidJSONIsUnchanged",
+			format: llm.JSONFormatPretty,
+			body:   `{"status": "ok",}`,
+			want:   `{"status": "ok",}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := llm.JSONResponse{Headers: map[string]string{"Content-Type": "application/json"}, Body: tt.body}
+			llm.FormatJSONBody(&resp, tt.format)
+			assert.Equal(t, tt.want, resp.Body)
+		})
+	}
+}
+
+func TestTruncateBody(t *testing.T) {
+	resp := llm.JSONResponse{Body: "héllo"}
+	assert.False(t, llm.TruncateBody(&resp, 0))
+	assert.False(t, llm.TruncateBody(&resp, 6))
+	assert.Equal(t, "héllo", resp.Body)
+
+	// "é" is two bytes, it is not split.
+	assert.True(t, llm.TruncateBody(&resp, 2))
+	assert.Equal(t, "h", resp.Body)
+}
+
+func TestTruncateBodyBase64(t *testing.T) {
+	resp := llm.JSONResponse{Encoding: llm.EncodingBase64, Body: "AAECAwQFBgcICQ=="}
+	assert.True(t, llm.TruncateBody(&resp, 4))
+	data, err := resp.DecodedBody()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 2, 3}, data)
+}
+
+func TestSanitizeHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		resp llm.JSONResponse
+		want map[string]string
+	}{
+		{
+			name: "framing",
+			resp: llm.JSONResponse{Headers: map[string]string{
+				"Content-Length":    "12",
+				"Transfer-Encoding": "chunked",
+				"Connection":        "keep-alive",
+				"Keep-Alive":        "timeout=5",
+				"Content-Type":      "text/html",
+			}},
+			want: map[string]string{"Content-Type": "text/html"},
+		},
+		{
+			name: "invalid",
+			resp: llm.JSONResponse{Headers: map[string]string{
+				"HTTP/1.1":   "200 OK",
+				"X Bad Name": "1",
+				"X-Newline":  "a\nb",
+				" server ":   " nginx ",
+			}},
+			want: map[string]string{"Server": "nginx"},
+		},
+		{
+			name: "duplicates",
+			resp: llm.JSONResponse{Headers: map[string]string{
+				"content-type":    "text/plain",
+				"Content-Type":    "text/html",
+				"x-frame-options": "DENY",
+				"X-FRAME-OPTIONS": "SAMEORIGIN",
+			}},
+			want: map[string]string{"Content-Type": "text/html", "X-Frame-Options": "SAMEORIGIN"},
+		},
+		{
+			name: "status",
+			resp: llm.JSONResponse{StatusCode: 200, Headers: map[string]string{
+				"Location":         "/login",
+				"WWW-Authenticate": `Basic realm="admin"`,
+				"Content-Range":    "bytes 0-10/100",
+			}},
+			want: map[string]string{},
+		},
+		{
+			name: "redirect",
+			resp: llm.JSONResponse{StatusCode: 302, Headers: map[string]string{"Location": "/login"}},
+			want: map[string]string{"Location": "/login"},
+		},
+		{
+			name: "encoding",
+			resp: llm.JSONResponse{Headers: map[string]string{"Content-Encoding": "gzip"}, Body: "<html></html>"},
+			want: map[string]string{},
+		},
+		{
+			name: "gzip",
+			resp: llm.JSONResponse{Headers: map[string]string{"Content-Encoding": "gzip"}, Encoding: llm.EncodingBase64, Body: "H4sIAAAAAAAA/8pIzcnJBwQAAP//hqYQNgUAAAA="},
+			want: map[string]string{"Content-Encoding": "gzip"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm.SanitizeHeaders(&tt.resp)
+			assert.Equal(t, tt.want, tt.resp.Headers)
+		})
+	}
+}
@@ -1,12 +1,21 @@
 package llm
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/ollama"
 )
 
+// initOllamaClient initializes the client of the Ollama server. The model
+// stays loaded for the KeepAlive of the configuration after each request (the
+// server's default, 5m, if empty; indefinitely if negative), and its context
+// window is NumCtx tokens (the server's default if 0).
 func initOllamaClient(config Config) (llms.Model, error) {
 	if config.ServerURL == "" {
 		return nil, fmt.Errorf("Server URL is required")
@@ -15,9 +24,43 @@ func initOllamaClient(config Config) (llms.Model, error) {
 		ollama.WithServerURL(config.ServerURL),
 		ollama.WithModel(config.Model),
 	}
+	if config.KeepAlive != "" {
+		opts = append(opts, ollama.WithKeepAlive(config.KeepAlive))
+	}
+	if config.NumCtx > 0 {
+		opts = append(opts, ollama.WithRunnerNumCtx(config.NumCtx))
+	}
 	m, err := ollama.New(opts...)
 	if err != nil {
 		return nil, err
 	}
 	return m, nil
 }
+
+// PreloadOllama loads the model of the configuration into the memory of the
+// Ollama server, for its KeepAlive, so that the first request doesn't wait
+// for the model to load. It returns once the model is loaded.
+func PreloadOllama(ctx context.Context, config Config) error {
+	payload, err := json.Marshal(struct {
+		Model     string `json:"model"`
+		KeepAlive string `json:"keep_alive,omitempty"`
+	}{Model: config.Model, KeepAlive: config.KeepAlive})
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(config.ServerURL, "/") + "/api/generate"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
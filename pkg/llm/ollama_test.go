@@ -0,0 +1,49 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestOllamaKeepAlive(t *testing.T) {
+	type request struct {
+		Model     string `json:"model"`
+		KeepAlive string `json:"keep_alive"`
+		Options   struct {
+			NumCtx int `json:"num_ctx"`
+		} `json:"options"`
+	}
+	got := make(map[string]request)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		got[r.URL.Path] = req
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/chat" {
+			_, _ = w.Write([]byte(`{"model": "llama3", "message": {"role": "assistant", "content": "{\"headers\": {}, \"body\": \"ok\"}"}, "done": true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"model": "llama3", "response": "", "done": true}`))
+	}))
+	defer ts.Close()
+
+	config := llm.Config{Provider: "ollama", Model: "llama3", ServerURL: ts.URL, KeepAlive: "-1", NumCtx: 8192}
+	require.NoError(t, llm.PreloadOllama(context.Background(), config))
+	assert.Equal(t, request{Model: "llama3", KeepAlive: "-1"}, got["/api/generate"])
+
+	model, err := llm.New(context.Background(), config)
+	require.NoError(t, err)
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+	_, err = llm.GenerateLLMResponse(context.Background(), model, config, messages)
+	require.NoError(t, err)
+	assert.Equal(t, "-1", got["/api/chat"].KeepAlive)
+	assert.Equal(t, 8192, got["/api/chat"].Options.NumCtx)
+}
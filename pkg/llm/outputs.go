@@ -0,0 +1,41 @@
+package llm
+
+import (
+	"context"
+	"sync"
+)
+
+type outputsKey struct{}
+
+type modelOutputs struct {
+	mu      sync.Mutex
+	outputs []string
+}
+
+// WithOutputs returns a copy of ctx that records the outputs of the model for
+// the responses generated with it, before their cleaning and repair, see
+// OutputsFrom.
+func WithOutputs(ctx context.Context) context.Context {
+	return context.WithValue(ctx, outputsKey{}, &modelOutputs{})
+}
+
+// OutputsFrom returns the outputs of the model recorded by ctx, in the order
+// of the generations (e.g. the invalid outputs before their corrections).
+func OutputsFrom(ctx context.Context) []string {
+	mo, ok := ctx.Value(outputsKey{}).(*modelOutputs)
+	if !ok {
+		return nil
+	}
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+	return append([]string(nil), mo.outputs...)
+}
+
+// recordOutput records the output of the model in ctx, if it records them.
+func recordOutput(ctx context.Context, output string) {
+	if mo, ok := ctx.Value(outputsKey{}).(*modelOutputs); ok {
+		mo.mu.Lock()
+		mo.outputs = append(mo.outputs, output)
+		mo.mu.Unlock()
+	}
+}
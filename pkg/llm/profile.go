@@ -0,0 +1,147 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/0x4d31/galah/internal/config"
+)
+
+// ServerProfile describes the technology stack of the emulated server.
+type ServerProfile struct {
+	Description string
+	Headers     map[string]string
+}
+
+// Headers that identify the server's technology stack. Model-generated values
+// of these headers are replaced by the profile's.
+var stackHeaders = []string{
+	"Server",
+	"X-Powered-By",
+	"X-AspNet-Version",
+	"X-AspNetMvc-Version",
+	"X-Generator",
+	"X-Runtime",
+}
+
+// ServerProfiles contains the built-in technology profiles.
+var ServerProfiles = map[string]ServerProfile{
+	"nginx-php": {
+		Description: "nginx 1.18.0 on Ubuntu serving PHP 7.4 applications through PHP-FPM",
+		Headers: map[string]string{
+			"Server":       "nginx/1.18.0 (Ubuntu)",
+			"X-Powered-By": "PHP/7.4.3",
+		},
+	},
+	"apache-php": {
+		Description: "Apache 2.4.38 on Debian with mod_php and PHP 7.3",
+		Headers: map[string]string{
+			"Server":       "Apache/2.4.38 (Debian)",
+			"X-Powered-By": "PHP/7.3.31",
+		},
+	},
+	"apache-mod_wsgi": {
+		Description: "Apache 2.4.41 on Ubuntu serving a Python 3.8 Django application through mod_wsgi",
+		Headers: map[string]string{
+			"Server": "Apache/2.4.41 (Ubuntu) mod_wsgi/4.6.8 Python/3.8",
+		},
+	},
+	"iis-aspnet": {
+		Description: "Microsoft IIS 10.0 on Windows Server serving ASP.NET 4 applications",
+		Headers: map[string]string{
+			"Server":           "Microsoft-IIS/10.0",
+			"X-Powered-By":     "ASP.NET",
+			"X-AspNet-Version": "4.0.30319",
+		},
+	},
+	"nginx-express": {
+		Description: "nginx 1.22.1 reverse proxy in front of a Node.js Express application",
+		Headers: map[string]string{
+			"Server":       "nginx/1.22.1",
+			"X-Powered-By": "Express",
+		},
+	},
+	"tomcat": {
+		Description: "Apache Tomcat 9.0 serving Java servlet and JSP applications",
+		Headers: map[string]string{
+			"Server": "Apache-Coyote/1.1",
+		},
+	},
+}
+
+// ResolveServerProfile returns the profile selected in the configuration.
+// Headers and description set in the configuration override those of the
+// named built-in profile. It returns nil if no profile is configured.
+func ResolveServerProfile(pc config.ServerProfileConfig) (*ServerProfile, error) {
+	if pc.Name == "" && len(pc.Headers) == 0 {
+		return nil, nil
+	}
+
+	profile := ServerProfile{Headers: make(map[string]string)}
+	if pc.Name != "" {
+		builtin, ok := ServerProfiles[pc.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown server profile %q", pc.Name)
+		}
+		profile.Description = builtin.Description
+		for k, v := range builtin.Headers {
+			profile.Headers[k] = v
+		}
+	}
+	if pc.Description != "" {
+		profile.Description = pc.Description
+	}
+	for k, v := range pc.Headers {
+		profile.Headers[http.CanonicalHeaderKey(k)] = v
+	}
+
+	return &profile, nil
+}
+
+// Apply replaces the stack-identifying headers generated by the model with
+// the profile's headers.
+func (p *ServerProfile) Apply(resp *JSONResponse) {
+	if resp.Headers == nil {
+		resp.Headers = make(map[string]string)
+	}
+	for key := range resp.Headers {
+		if isStackHeader(key) || p.header(key) != "" {
+			delete(resp.Headers, key)
+		}
+	}
+	for k, v := range p.Headers {
+		resp.Headers[k] = v
+	}
+}
+
+// prompt returns the instruction describing the profile to the model.
+func (p *ServerProfile) prompt() string {
+	var headers string
+	for _, h := range stackHeaders {
+		if v := p.header(h); v != "" {
+			headers += fmt.Sprintf(" %s: %s.", h, v)
+		}
+	}
+	return fmt.Sprintf("The emulated server runs %s.%s Keep the response body consistent with this technology stack (e.g. file extensions, error pages, and framework names).", p.Description, headers)
+}
+
+// header returns the profile's value for the header, matched
+// case-insensitively.
+func (p *ServerProfile) header(name string) string {
+	for k, v := range p.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+func isStackHeader(name string) bool {
+	for _, h := range stackHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
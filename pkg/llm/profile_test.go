@@ -0,0 +1,94 @@
+package llm_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerProfileApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  config.ServerProfileConfig
+		headers map[string]string
+		want    map[string]string
+	}{
+		{
+			name:   "profileHeadersApplied",
+			config: config.ServerProfileConfig{Name: "nginx-php"},
+			headers: map[string]string{
+				"Content-Type": "text/html",
+			},
+			want: map[string]string{
+				"Content-Type": "text/html",
+				"Server":       "nginx/1.18.0 (Ubuntu)",
+				"X-Powered-By": "PHP/7.4.3",
+			},
+		},
+		{
+			name:   "conflictingHeadersReconciled",
+			config: config.ServerProfileConfig{Name: "nginx-php"},
+			headers: map[string]string{
+				"server":           "Microsoft-IIS/10.0",
+				"X-Powered-By":     "ASP.NET",
+				"X-AspNet-Version": "4.0.30319",
+				"Content-Type":     "text/html",
+			},
+			want: map[string]string{
+				"Content-Type": "text/html",
+				"Server":       "nginx/1.18.0 (Ubuntu)",
+				"X-Powered-By": "PHP/7.4.3",
+			},
+		},
+		{
+			name: "customOverrides",
+			config: config.ServerProfileConfig{
+				Name:    "apache-mod_wsgi",
+				Headers: map[string]string{"server": "Apache/2.4.57 (Debian) mod_wsgi/4.9.4 Python/3.11"},
+			},
+			headers: map[string]string{"X-Powered-By": "PHP/8.1.2"},
+			want: map[string]string{
+				"Server": "Apache/2.4.57 (Debian) mod_wsgi/4.9.4 Python/3.11",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := llm.ResolveServerProfile(tt.config)
+			require.NoError(t, err)
+			resp := llm.JSONResponse{Headers: tt.headers, Body: "body"}
+			profile.Apply(&resp)
+			assert.Equal(t, tt.want, resp.Headers)
+		})
+	}
+}
+
+func TestResolveServerProfile(t *testing.T) {
+	profile, err := llm.ResolveServerProfile(config.ServerProfileConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, profile)
+
+	_, err = llm.ResolveServerProfile(config.ServerProfileConfig{Name: "lighttpd-cobol"})
+	assert.Error(t, err)
+}
+
+func TestCreateMessageContentServerProfile(t *testing.T) {
+	cfg := &config.Config{
+		SystemPrompt:  "system prompt",
+		UserPrompt:    "request: %q",
+		ServerProfile: config.ServerProfileConfig{Name: "iis-aspnet"},
+	}
+
+	messages, err := llm.CreateMessageContent(httptest.NewRequest("GET", "/", nil), cfg, "openai", nil)
+	require.NoError(t, err)
+	systemPrompt := fmt.Sprint(messages[0].Parts[0])
+	assert.Contains(t, systemPrompt, "Microsoft IIS 10.0")
+	assert.Contains(t, systemPrompt, "Server: Microsoft-IIS/10.0")
+	assert.Contains(t, systemPrompt, "consistent with this technology stack")
+}
@@ -0,0 +1,109 @@
+package llm
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// PromptData is the data available to user prompt templates.
+type PromptData struct {
+	// Request is the dump of the HTTP request, as included by the "%q" verb
+	// of non-template prompts.
+	Request  string
+	Method   string
+	Path     string
+	Query    string
+	Host     string
+	Headers  http.Header
+	ClientIP string
+	// Port is the port the request was received on.
+	Port string
+	// Persona is the name of the emulated server profile, if any, and
+	// PersonaDescription its description.
+	Persona            string
+	PersonaDescription string
+}
+
+var promptFuncs = template.FuncMap{
+	"quote":     strconv.Quote,
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"contains":  strings.Contains,
+	"hasPrefix": strings.HasPrefix,
+}
+
+// promptTemplates caches the parsed user prompt templates by their text.
+var promptTemplates sync.Map
+
+// isPromptTemplate reports whether the user prompt is a text/template rather
+// than a format string with a single "%q" verb.
+func isPromptTemplate(prompt string) bool {
+	return strings.Contains(prompt, "{{")
+}
+
+// renderUserPrompt renders the user prompt for the request. Prompts that are
+// not templates are formatted with the request dump, for compatibility with
+// the "%q" prompts.
+func renderUserPrompt(prompt string, data PromptData) (string, error) {
+	if !isPromptTemplate(prompt) {
+		return fmt.Sprintf(prompt, data.Request), nil
+	}
+
+	var tmpl *template.Template
+	if cached, ok := promptTemplates.Load(prompt); ok {
+		tmpl = cached.(*template.Template)
+	} else {
+		var err error
+		tmpl, err = ParseTemplate("user_prompt", prompt)
+		if err != nil {
+			return "", fmt.Errorf("error parsing the user prompt template: %s", err)
+		}
+		promptTemplates.Store(prompt, tmpl)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("error rendering the user prompt template: %s", err)
+	}
+	return b.String(), nil
+}
+
+// NewPromptData returns the template data of the request, without the
+// request dump, e.g. to render response templates.
+func NewPromptData(r *http.Request, profile *ServerProfile, persona string) PromptData {
+	return newPromptData(r, "", profile, persona)
+}
+
+// ParseTemplate parses a template with the functions of the user prompt
+// templates.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(promptFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// newPromptData returns the prompt data of the request.
+func newPromptData(r *http.Request, dump string, profile *ServerProfile, persona string) PromptData {
+	data := PromptData{
+		Request:  dump,
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Query:    r.URL.RawQuery,
+		Host:     r.Host,
+		Headers:  r.Header,
+		ClientIP: SourceIP(r),
+		Persona:  persona,
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if _, port, err := net.SplitHostPort(addr.String()); err == nil {
+			data.Port = port
+		}
+	}
+	if profile != nil {
+		data.PersonaDescription = profile.Description
+	}
+	return data
+}
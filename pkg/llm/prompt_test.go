@@ -0,0 +1,45 @@
+package llm_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateMessageContentTemplate(t *testing.T) {
+	cfg := &config.Config{
+		SystemPrompt:  "system prompt",
+		UserPrompt:    `{{.Method}} {{.Path}}?{{.Query}} from {{.ClientIP}}{{if eq (lower (.Headers.Get "User-Agent")) "curl/8.0"}} (curl){{end}} as {{.Persona}}: {{quote .Request}}`,
+		ServerProfile: config.ServerProfileConfig{Name: "nginx-php"},
+	}
+	r := httptest.NewRequest("GET", "/admin?debug=1", nil)
+	r.RemoteAddr = "203.0.113.7:4444"
+	r.Header.Set("User-Agent", "Curl/8.0")
+
+	messages, err := llm.CreateMessageContent(r, cfg, "openai", nil)
+	require.NoError(t, err)
+
+	prompt := fmt.Sprint(messages[1].Parts[0])
+	assert.True(t, strings.HasPrefix(prompt, `GET /admin?debug=1 from 203.0.113.7 (curl) as nginx-php: "GET /admin?debug=1 HTTP/1.1`), prompt)
+}
+
+func TestCreateMessageContentFormatPrompt(t *testing.T) {
+	cfg := &config.Config{SystemPrompt: "system prompt", UserPrompt: "request: %q"}
+	r := httptest.NewRequest("GET", "/", nil)
+
+	messages, err := llm.CreateMessageContent(r, cfg, "openai", nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(fmt.Sprint(messages[1].Parts[0]), `request: "GET / HTTP/1.1`))
+}
+
+func TestCreateMessageContentInvalidTemplate(t *testing.T) {
+	cfg := &config.Config{UserPrompt: "{{.Method"}
+	_, err := llm.CreateMessageContent(httptest.NewRequest("GET", "/", nil), cfg, "openai", nil)
+	assert.ErrorContains(t, err, "user prompt template")
+}
@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ErrTokenRateLimit is returned when a generation couldn't start before the
+// request was canceled because of the tokens-per-minute limit.
+var ErrTokenRateLimit = errors.New("tokenRateLimited: the tokens per minute limit was reached")
+
+const (
+	tokenWindow = time.Minute
+	// calibrationWeight is the weight of a new observation in the moving
+	// averages used to calibrate the token estimates.
+	calibrationWeight = 0.2
+)
+
+// TokenLimiter throttles generations so that the estimated number of tokens
+// consumed per minute by each model stays under a limit. Estimates are
+// calibrated with the token usage reported by the provider.
+type TokenLimiter struct {
+	tpm    int
+	mu     sync.Mutex
+	models map[string]*tokenWindowState
+}
+
+// tokenWindowState holds the token reservations of a model in the last
+// minute and its calibration.
+type tokenWindowState struct {
+	reservations []*tokenReservation
+	// ratio is the ratio of reported to estimated prompt tokens.
+	ratio float64
+	// output is the average number of completion tokens.
+	output float64
+}
+
+type tokenReservation struct {
+	at     time.Time
+	tokens int
+}
+
+// NewTokenLimiter returns a limiter allowing tpm tokens per minute per model.
+func NewTokenLimiter(tpm int) *TokenLimiter {
+	return &TokenLimiter{
+		tpm:    tpm,
+		models: make(map[string]*tokenWindowState),
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wrap returns a model whose generations are throttled by the limiter.
+func (l *TokenLimiter) Wrap(model llms.Model, name string) llms.Model {
+	return &tokenLimitedModel{Model: model, limiter: l, name: name}
+}
+
+func (l *TokenLimiter) state(model string) *tokenWindowState {
+	st, ok := l.models[model]
+	if !ok {
+		st = &tokenWindowState{ratio: 1}
+		l.models[model] = st
+	}
+	return st
+}
+
+// reserve blocks until the estimated tokens fit in the model's window, and
+// returns the reservation and the calibrated prompt estimate.
+func (l *TokenLimiter) reserve(ctx context.Context, model string, promptTokens int) (*tokenReservation, error) {
+	for {
+		l.mu.Lock()
+		st := l.state(model)
+		now := time.Now()
+		used := st.prune(now)
+		need := int(float64(promptTokens)*st.ratio + st.output)
+		// A generation larger than the limit is allowed once the window is empty.
+		if used+need <= l.tpm || used == 0 {
+			res := &tokenReservation{at: now, tokens: need}
+			st.reservations = append(st.reservations, res)
+			l.mu.Unlock()
+			return res, nil
+		}
+		delay := st.reservations[0].at.Add(tokenWindow).Sub(now)
+		l.mu.Unlock()
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, fmt.Errorf("%w (%d tokens used, %d needed): %s", ErrTokenRateLimit, used, need, err)
+		}
+	}
+}
+
+// settle replaces the reserved estimate with the usage reported by the
+// provider and calibrates the estimates of the model.
+func (l *TokenLimiter) settle(model string, res *tokenReservation, promptTokens int, resp *llms.ContentResponse) {
+	in, out, ok := Usage(resp)
+	if !ok {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := l.state(model)
+	res.tokens = in + out
+	if promptTokens > 0 {
+		st.ratio += calibrationWeight * (float64(in)/float64(promptTokens) - st.ratio)
+	}
+	if st.output == 0 {
+		st.output = float64(out)
+	} else {
+		st.output += calibrationWeight * (float64(out) - st.output)
+	}
+}
+
+// prune drops the reservations older than the window and returns the number
+// of tokens used in the window.
+func (st *tokenWindowState) prune(now time.Time) int {
+	i := 0
+	for i < len(st.reservations) && now.Sub(st.reservations[i].at) >= tokenWindow {
+		i++
+	}
+	st.reservations = st.reservations[i:]
+
+	var used int
+	for _, r := range st.reservations {
+		used += r.tokens
+	}
+	return used
+}
+
+type tokenLimitedModel struct {
+	llms.Model
+	limiter *TokenLimiter
+	name    string
+}
+
+func (m *tokenLimitedModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	promptTokens := estimateMessagesTokens(messages)
+	res, err := m.limiter.reserve(ctx, m.name, promptTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.Model.GenerateContent(ctx, messages, options...)
+	if err == nil {
+		m.limiter.settle(m.name, res, promptTokens, resp)
+	}
+	return resp, err
+}
@@ -0,0 +1,71 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// usageModel returns a fixed response reporting the given token usage.
+type usageModel struct {
+	promptTokens, completionTokens int
+	calls                          int
+}
+
+func (m *usageModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.calls++
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		Content: `{"headers": {"Server": "nginx"}, "body": "ok"}`,
+		GenerationInfo: map[string]any{
+			"PromptTokens":     m.promptTokens,
+			"CompletionTokens": m.completionTokens,
+		},
+	}}}, nil
+}
+
+func (m *usageModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return "", nil
+}
+
+func TestTokenLimiter(t *testing.T) {
+	limiter := llm.NewTokenLimiter(1000)
+	inner := &usageModel{promptTokens: 500, completionTokens: 400}
+	model := limiter.Wrap(inner, "gpt-4o")
+	config := llm.Config{Provider: "openai", Model: "gpt-4o"}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+
+	_, err := llm.GenerateLLMResponse(context.Background(), model, config, messages)
+	require.NoError(t, err)
+
+	// The reported usage (900 tokens) leaves no room for another generation
+	// in the same minute.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = llm.GenerateLLMResponse(ctx, model, config, messages)
+	assert.ErrorIs(t, err, llm.ErrTokenRateLimit)
+	assert.Equal(t, llm.ErrorKindTokenRateLimit, llm.ErrorKind(err))
+	assert.Equal(t, 1, inner.calls, "throttled generation should not reach the provider")
+
+	// Other models have their own budget.
+	other := &usageModel{promptTokens: 500, completionTokens: 400}
+	_, err = llm.GenerateLLMResponse(context.Background(), limiter.Wrap(other, "gpt-4o-mini"), config, messages)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, other.calls)
+}
+
+func TestUsage(t *testing.T) {
+	in, out, ok := llm.Usage(&llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		GenerationInfo: map[string]any{"InputTokens": 12, "OutputTokens": 34},
+	}}})
+	assert.True(t, ok)
+	assert.Equal(t, 12, in)
+	assert.Equal(t, 34, out)
+
+	_, _, ok = llm.Usage(&llms.ContentResponse{Choices: []*llms.ContentChoice{{}}})
+	assert.False(t, ok)
+}
@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// defaultEndpoints are the API endpoints of the providers without a server
+// URL in their configuration.
+var defaultEndpoints = map[string]string{
+	"openai":    "https://api.openai.com",
+	"googleai":  "https://generativelanguage.googleapis.com",
+	"anthropic": "https://api.anthropic.com",
+	"cohere":    "https://api.cohere.ai",
+	"ollama":    "http://localhost:11434",
+	"mistral":   defaultMistralURL,
+}
+
+// Endpoint returns the URL of the API of the provider, the server URL of the
+// configuration if set.
+func Endpoint(config Config) (string, error) {
+	if config.ServerURL != "" {
+		return config.ServerURL, nil
+	}
+	switch config.Provider {
+	case "gcp-vertex":
+		if config.CloudLocation != "" {
+			return "https://" + config.CloudLocation + "-aiplatform.googleapis.com", nil
+		}
+	case "bedrock":
+		if config.CloudLocation != "" {
+			return "https://bedrock-runtime." + config.CloudLocation + ".amazonaws.com", nil
+		}
+	default:
+		if endpoint, ok := defaultEndpoints[config.Provider]; ok {
+			return endpoint, nil
+		}
+	}
+	return "", fmt.Errorf("unknown endpoint of the %s provider", config.Provider)
+}
+
+// CheckReachable checks that the API of the provider accepts connections,
+// without generating (and paying for) a response.
+func CheckReachable(ctx context.Context, config Config) error {
+	endpoint, err := Endpoint(config)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint of the %s provider: %w", config.Provider, err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,42 @@
+package llm
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		config Config
+		want   string
+	}{
+		{Config{Provider: "openai"}, "https://api.openai.com"},
+		{Config{Provider: "ollama", ServerURL: "http://ollama:11434"}, "http://ollama:11434"},
+		{Config{Provider: "bedrock", CloudLocation: "us-east-1"}, "https://bedrock-runtime.us-east-1.amazonaws.com"},
+		{Config{Provider: "gcp-vertex", CloudLocation: "europe-west4"}, "https://europe-west4-aiplatform.googleapis.com"},
+	}
+	for _, tt := range tests {
+		if got, err := Endpoint(tt.config); err != nil || got != tt.want {
+			t.Errorf("Endpoint(%+v) = %q, %v, want %q", tt.config, got, err, tt.want)
+		}
+	}
+	if _, err := Endpoint(Config{Provider: "openai-compatible"}); err == nil {
+		t.Error("Expected an error for a provider without a server URL")
+	}
+}
+
+func TestCheckReachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	if err := CheckReachable(context.Background(), Config{Provider: "ollama", ServerURL: "http://" + addr}); err != nil {
+		t.Errorf("CheckReachable() error = %v", err)
+	}
+	ln.Close()
+	if err := CheckReachable(context.Background(), Config{Provider: "ollama", ServerURL: "http://" + addr}); err == nil {
+		t.Error("Expected an error for a closed port")
+	}
+}
@@ -0,0 +1,157 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RepairJSON repairs the common defects of the JSON objects generated by the
+// smaller models: the text around the object, the trailing commas, the
+// single-quoted strings, the unescaped control characters (e.g. newlines) in
+// the strings, and the output truncated before the end of the object, whose
+// open string, key and brackets are closed. It returns the repaired object,
+// and false if s has no object or needed no repair.
+func RepairJSON(s string) (string, bool) {
+	start := strings.IndexByte(s, '{')
+	if start == -1 {
+		return "", false
+	}
+
+	var b strings.Builder
+	var (
+		stack    []byte
+		quote    rune
+		escaped  bool
+		key      bool // a key string was closed, but not followed by its colon
+		colon    bool // the colon of the current member of the object was seen
+		complete bool
+	)
+scan:
+	for _, c := range s[start:] {
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+				// The apostrophes don't need escaping in JSON strings.
+				if c == '\'' {
+					b.WriteRune(c)
+				} else {
+					b.WriteByte('\\')
+					b.WriteRune(c)
+				}
+			case c == '\\':
+				escaped = true
+			case c == quote:
+				quote = 0
+				b.WriteByte('"')
+				if len(stack) > 0 && stack[len(stack)-1] == '{' && !colon {
+					key = true
+				}
+			case c == '"':
+				b.WriteString(`\"`)
+			case c == '\n':
+				b.WriteString(`\n`)
+			case c == '\r':
+				b.WriteString(`\r`)
+			case c == '\t':
+				b.WriteString(`\t`)
+			case c < 0x20:
+				fmt.Fprintf(&b, `\u%04x`, c)
+			default:
+				b.WriteRune(c)
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			quote = c
+			b.WriteByte('"')
+			continue
+		case ':':
+			key, colon = false, true
+		case ',':
+			colon = false
+		case '{', '[':
+			stack = append(stack, byte(c))
+			colon = false
+		case '}', ']':
+			open := byte('{')
+			if c == ']' {
+				open = '['
+			}
+			if len(stack) == 0 || stack[len(stack)-1] != open {
+				continue
+			}
+			trimTrailingComma(&b)
+			stack = stack[:len(stack)-1]
+			// The member of the enclosing object is complete.
+			colon = len(stack) > 0 && stack[len(stack)-1] == '{'
+			b.WriteRune(c)
+			// The text after the object is left out.
+			if complete = len(stack) == 0; complete {
+				break scan
+			}
+			continue
+		}
+		b.WriteRune(c)
+	}
+
+	if !complete {
+		// The output is truncated: the open string, member and brackets are
+		// closed.
+		if quote != 0 {
+			b.WriteByte('"')
+			if len(stack) > 0 && stack[len(stack)-1] == '{' && !colon {
+				key = true
+			}
+		}
+		trimTrailingComma(&b)
+		switch out := b.String(); {
+		case key:
+			b.WriteString(`: ""`)
+		case strings.HasSuffix(out, ":"):
+			b.WriteString(` ""`)
+		}
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i] == '{' {
+				b.WriteByte('}')
+			} else {
+				b.WriteByte(']')
+			}
+		}
+	}
+
+	repaired := b.String()
+	if repaired == strings.TrimSpace(s) {
+		return "", false
+	}
+	return repaired, true
+}
+
+// parseRepairedJSON decodes the response like ParseJSONResponse, repairing it
+// first if it is invalid (see RepairJSON). It returns the response as decoded,
+// or the error of the response before the repair.
+func parseRepairedJSON(s string) (string, JSONResponse, error) {
+	resp, err := ParseJSONResponse(s)
+	if err == nil {
+		return s, resp, nil
+	}
+	if repaired, ok := RepairJSON(s); ok {
+		if resp, rerr := ParseJSONResponse(repaired); rerr == nil {
+			return repaired, resp, nil
+		}
+	}
+	return s, JSONResponse{}, err
+}
+
+// trimTrailingComma removes the whitespace and the comma at the end of b.
+func trimTrailingComma(b *strings.Builder) {
+	out := strings.TrimRight(b.String(), " \t\r\n")
+	out = strings.TrimSuffix(out, ",")
+	out = strings.TrimRight(out, " \t\r\n")
+	if out != b.String() {
+		b.Reset()
+		b.WriteString(out)
+	}
+}
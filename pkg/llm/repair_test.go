@@ -0,0 +1,78 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "trailingCommas",
+			input: `{"headers": {"Server": "nginx",}, "body": "ok",}`,
+			want:  `{"headers": {"Server": "nginx"}, "body": "ok"}`,
+		},
+		{
+			name:  "singleQuotes",
+			input: `{'headers': {'Server': 'nginx'}, 'body': 'it\'s "ok"'}`,
+			want:  `{"headers": {"Server": "nginx"}, "body": "it's \"ok\""}`,
+		},
+		{
+			name:  "unescapedNewlines",
+			input: "{\"headers\": {}, \"body\": \"<html>\n\t<body></body>\n</html>\"}",
+			want:  `{"headers": {}, "body": "<html>\n\t<body></body>\n</html>"}`,
+		},
+		{
+			name:  "truncatedString",
+			input: `{"headers": {"Content-Type": "text/html"}, "body": "<html><body>Index of /`,
+			want:  `{"headers": {"Content-Type": "text/html"}, "body": "<html><body>Index of /"}`,
+		},
+		{
+			name:  "truncatedKey",
+			input: `{"headers": {"Server": "nginx", "X-Pow`,
+			want:  `{"headers": {"Server": "nginx", "X-Pow": ""}}`,
+		},
+		{
+			name:  "truncatedAfterColon",
+			input: `{"body": "ok", "headers": [`,
+			want:  `{"body": "ok", "headers": []}`,
+		},
+		{
+			name:  "textAround",
+			input: `Here is the response: {"headers": {}, "body": "ok"} Let me know if you need anything else.`,
+			want:  `{"headers": {}, "body": "ok"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := llm.RepairJSON(tt.input)
+			require.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, ok := llm.RepairJSON(`{"headers": {}, "body": "ok"}`)
+	assert.False(t, ok, "valid JSON needs no repair")
+	_, ok = llm.RepairJSON("I'm sorry, I can't help with that.")
+	assert.False(t, ok)
+}
+
+func TestGenerateLLMResponseRepairsJSON(t *testing.T) {
+	model := &correctingModel{outputs: []string{"{'headers': {'Server': 'nginx'}, 'body': 'line 1\nline 2',}"}}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+
+	resp, raw, err := llm.GenerateJSONResponse(context.Background(), model, llm.Config{Provider: "ollama", JSONCorrections: 2}, messages)
+	require.NoError(t, err)
+	assert.Equal(t, "line 1\nline 2", resp.Body)
+	assert.Equal(t, `{"headers": {"Server": "nginx"}, "body": "line 1\nline 2"}`, raw)
+	assert.Len(t, model.messages, 1, "a repaired response shouldn't be corrected")
+}
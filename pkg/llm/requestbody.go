@@ -0,0 +1,40 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+)
+
+// RequestBody describes how the body of a request was read before it was
+// presented: the Content-Encoding it was decoded from, whether it was sent
+// chunked and whether it was truncated at Size bytes.
+type RequestBody struct {
+	Encoding  string `json:"encoding,omitempty"`
+	Chunked   bool   `json:"chunked,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Size      int    `json:"size"`
+}
+
+// Marker returns the note about the truncation of the body, or "" if it
+// isn't truncated.
+func (b RequestBody) Marker() string {
+	if !b.Truncated {
+		return ""
+	}
+	return fmt.Sprintf("[... request body truncated at %d bytes ...]", b.Size)
+}
+
+type requestBodyKey struct{}
+
+// WithRequestBody returns a copy of ctx recording how the body of the request
+// was read.
+func WithRequestBody(ctx context.Context, b RequestBody) context.Context {
+	return context.WithValue(ctx, requestBodyKey{}, b)
+}
+
+// RequestBodyFrom returns how the body of the request was read, and false if
+// ctx doesn't record it.
+func RequestBodyFrom(ctx context.Context) (RequestBody, bool) {
+	b, ok := ctx.Value(requestBodyKey{}).(RequestBody)
+	return b, ok
+}
@@ -0,0 +1,21 @@
+package llm
+
+import (
+	"hash/fnv"
+)
+
+// CandidateIndex deterministically picks one of n candidate responses by
+// hashing the source IP and the request signature (e.g. the cache key), so
+// the same source consistently sees the same variant while different sources
+// see different ones. It returns 0 if there is at most one candidate.
+func CandidateIndex(n int, srcIP, signature string) int {
+	if n <= 1 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(srcIP))
+	h.Write([]byte{0})
+	h.Write([]byte(signature))
+
+	return int(h.Sum64() % uint64(n))
+}
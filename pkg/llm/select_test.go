@@ -0,0 +1,35 @@
+package llm_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandidateIndex(t *testing.T) {
+	signature := "8080_/admin/login.php"
+
+	t.Run("consistentPerSource", func(t *testing.T) {
+		first := llm.CandidateIndex(4, "192.0.2.1", signature)
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, first, llm.CandidateIndex(4, "192.0.2.1", signature))
+		}
+	})
+
+	t.Run("variedAcrossSources", func(t *testing.T) {
+		seen := make(map[int]bool)
+		for i := 0; i < 50; i++ {
+			index := llm.CandidateIndex(4, fmt.Sprintf("198.51.100.%d", i), signature)
+			assert.True(t, index >= 0 && index < 4)
+			seen[index] = true
+		}
+		assert.Greater(t, len(seen), 1)
+	})
+
+	t.Run("singleCandidate", func(t *testing.T) {
+		assert.Zero(t, llm.CandidateIndex(1, "192.0.2.1", signature))
+		assert.Zero(t, llm.CandidateIndex(0, "192.0.2.1", signature))
+	})
+}
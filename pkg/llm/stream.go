@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrNonJSONStream is returned when a streamed generation is aborted
+	// because the partial output can no longer become a valid JSON response.
+	ErrNonJSONStream = errors.New("nonJSONStream: streamed output is not JSON")
+	// ErrCostCeiling is returned when the estimated cost of a generation
+	// reached the per-request ceiling: before the call if the prompt alone
+	// reaches it, or while the generation is streamed.
+	ErrCostCeiling = errors.New("costCeiling: estimated cost reached the per-request ceiling")
+)
+
+// streamGuard accumulates streamed chunks and cancels the generation as soon
+// as the output is definitively not a JSON object, or its estimated cost
+// crosses the ceiling.
+type streamGuard struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	threshold int
+	cancel    context.CancelFunc
+	err       error
+
+	pricing     Pricing
+	promptCost  float64
+	costCeiling float64
+}
+
+func newStreamGuard(threshold int, cancel context.CancelFunc) *streamGuard {
+	return &streamGuard{
+		threshold: threshold,
+		cancel:    cancel,
+	}
+}
+
+// withCostCeiling enables the cost ceiling, given the model pricing and the
+// estimated number of prompt tokens.
+func (g *streamGuard) withCostCeiling(ceiling float64, pricing Pricing, promptTokens int) {
+	g.costCeiling = ceiling
+	g.pricing = pricing
+	g.promptCost = pricing.Cost(promptTokens, 0)
+}
+
+// maxTokensUnder returns the number of output tokens keeping the cost of the
+// generation under the ceiling, given the estimated number of prompt tokens,
+// or false if the output is free.
+func maxTokensUnder(ceiling float64, pricing Pricing, promptTokens int) (int, bool) {
+	if pricing.Output <= 0 {
+		return 0, false
+	}
+	left := ceiling - pricing.Cost(promptTokens, 0)
+	return max(1, int(left*1_000_000/pricing.Output)), true
+}
+
+// consume is used as the streaming function of the generation call.
+func (g *streamGuard) consume(_ context.Context, chunk []byte) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.buf.Write(chunk)
+	switch {
+	case g.threshold > 0 && isNonJSONPrefix(g.buf.Bytes(), g.threshold):
+		g.err = ErrNonJSONStream
+	case g.costCeiling > 0 && g.costLocked() >= g.costCeiling:
+		g.err = ErrCostCeiling
+	default:
+		return nil
+	}
+	g.cancel()
+	return g.err
+}
+
+// abortErr returns the reason the stream was aborted, if any.
+func (g *streamGuard) abortErr() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+func (g *streamGuard) partial() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.buf.String()
+}
+
+func (g *streamGuard) size() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.buf.Len()
+}
+
+// cost returns the estimated cost of the generation so far.
+func (g *streamGuard) cost() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.costLocked()
+}
+
+func (g *streamGuard) costLocked() float64 {
+	return g.promptCost + g.pricing.Cost(0, (g.buf.Len()+3)/4)
+}
+
+// isNonJSONPrefix reports whether the partial output has reached the
+// threshold without starting a JSON object. Leading whitespace and a markdown
+// code fence with its optional json tag are ignored, since cleanResponse
+// strips them later.
+func isNonJSONPrefix(partial []byte, threshold int) bool {
+	trimmed := bytes.TrimLeft(partial, " \t\r\n")
+	if rest, ok := bytes.CutPrefix(trimmed, []byte("```")); ok {
+		if len(rest) < len("json") && bytes.HasPrefix([]byte("json"), rest) {
+			// The tag may still be streaming.
+			return false
+		}
+		rest = bytes.TrimPrefix(rest, []byte("json"))
+		trimmed = bytes.TrimLeft(rest, " \t\r\n")
+	}
+	if len(trimmed) == 0 || trimmed[0] == '{' {
+		return false
+	}
+	return len(trimmed) >= threshold
+}
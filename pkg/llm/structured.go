@@ -0,0 +1,48 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// correctionPrompt asks the model to fix a response that failed validation.
+const correctionPrompt = `Your previous response is invalid (%s). Respond again with only a JSON object of the form {"headers": {"<headerName>": "<headerValue>"}, "body": "<body>"}, with both fields set and no text outside the JSON object.`
+
+// GenerateStructured generates a response and validates it against the
+// JSONResponse schema. If validation fails, the invalid output and the
+// validation error are fed back to the model for up to config.JSONCorrections
+// correction rounds. It works the same way for providers with and without a
+// native JSON mode.
+func GenerateStructured(ctx context.Context, model llms.Model, config Config, messages []llms.MessageContent) (string, error) {
+	_, raw, err := GenerateJSONResponse(ctx, model, config, messages)
+	return raw, err
+}
+
+// GenerateJSONResponse generates a response like GenerateStructured, and
+// returns it decoded and normalized (see ParseJSONResponse) along with the raw
+// output of the model, which is also returned on error.
+func GenerateJSONResponse(ctx context.Context, model llms.Model, config Config, messages []llms.MessageContent) (JSONResponse, string, error) {
+	raw, resp, err := generateResponse(ctx, model, config, messages)
+	for round := 0; round < config.JSONCorrections && errors.Is(err, ErrInvalidJSON); round++ {
+		if ctx.Err() != nil {
+			break
+		}
+		messages = correctionMessages(messages, raw, fmt.Sprintf(correctionPrompt, err))
+		raw, resp, err = generateResponse(ctx, model, config, messages)
+	}
+	return resp, raw, err
+}
+
+// correctionMessages returns a copy of messages followed by the invalid
+// response and the prompt asking to correct it.
+func correctionMessages(messages []llms.MessageContent, resp, prompt string) []llms.MessageContent {
+	corrected := make([]llms.MessageContent, 0, len(messages)+2)
+	corrected = append(corrected, messages...)
+	if resp != "" {
+		corrected = append(corrected, llms.TextParts(llms.ChatMessageTypeAI, resp))
+	}
+	return append(corrected, llms.TextParts(llms.ChatMessageTypeHuman, prompt))
+}
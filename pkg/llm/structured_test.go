@@ -0,0 +1,120 @@
+package llm_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// correctingModel returns the outputs in order and records the messages of
+// each call.
+type correctingModel struct {
+	outputs  []string
+	messages [][]llms.MessageContent
+}
+
+func (m *correctingModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+	out := m.outputs[len(m.messages)%len(m.outputs)]
+	m.messages = append(m.messages, messages)
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: out}}}, nil
+}
+
+func (m *correctingModel) Call(ctx context.Context, prompt string, opts ...llms.CallOption) (string, error) {
+	return "", nil
+}
+
+func TestGenerateStructured(t *testing.T) {
+	const valid = `{"headers": {"Server": "nginx"}, "body": "ok"}`
+
+	tests := []struct {
+		name      string
+		provider  string
+		outputs   []string
+		wantCalls int
+	}{
+		{
+			name:      "jsonModeProvider",
+			provider:  "openai",
+			outputs:   []string{`{"headers": {"Server": "nginx"}}`, valid},
+			wantCalls: 2,
+		},
+		{
+			name:      "systemPromptWithoutJSONMode",
+			provider:  "anthropic",
+			outputs:   []string{`Here is the response: {"body": "ok"}`, "```json\n" + valid + "\n```"},
+			wantCalls: 2,
+		},
+		{
+			name:      "noSystemPromptNoJSONMode",
+			provider:  "googleai",
+			outputs:   []string{`{"headers": "Server: nginx", "body": "ok"}`, `{"body": "ok"}`, valid},
+			wantCalls: 3,
+		},
+		{
+			name:      "validOnFirstAttempt",
+			provider:  "cohere",
+			outputs:   []string{valid},
+			wantCalls: 1,
+		},
+	}
+
+	cfg := &config.Config{SystemPrompt: "system prompt", UserPrompt: "%q"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &correctingModel{outputs: tt.outputs}
+			messages, err := llm.CreateMessageContent(httptest.NewRequest("GET", "/", nil), cfg, tt.provider, nil)
+			require.NoError(t, err)
+
+			resp, err := llm.GenerateStructured(context.Background(), model, llm.Config{Provider: tt.provider, JSONCorrections: 2}, messages)
+			require.NoError(t, err)
+			assert.Equal(t, valid, resp)
+			require.Len(t, model.messages, tt.wantCalls)
+
+			for i := 1; i < tt.wantCalls; i++ {
+				round := model.messages[i]
+				assert.Len(t, round, len(messages)+2*i)
+				last := fmt.Sprint(round[len(round)-1].Parts[0])
+				assert.Contains(t, last, "Your previous response is invalid (invalidJSONResponse: ")
+				assert.Equal(t, llms.ChatMessageTypeAI, round[len(round)-2].Role)
+			}
+			assert.Len(t, messages, len(model.messages[0]), "the original messages should not be modified")
+		})
+	}
+}
+
+func TestGenerateStructuredBounded(t *testing.T) {
+	model := &correctingModel{outputs: []string{`{"headers": {}}`}}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+
+	_, err := llm.GenerateStructured(context.Background(), model, llm.Config{Provider: "openai", JSONCorrections: 2}, messages)
+	assert.ErrorIs(t, err, llm.ErrInvalidJSON)
+	assert.Len(t, model.messages, 3)
+
+	model = &correctingModel{outputs: []string{`{"headers": {}}`}}
+	_, err = llm.GenerateStructured(context.Background(), model, llm.Config{Provider: "openai"}, messages)
+	assert.ErrorIs(t, err, llm.ErrInvalidJSON)
+	assert.Len(t, model.messages, 1, "corrections should be disabled by default")
+}
+
+func TestGenerateJSONResponse(t *testing.T) {
+	model := &correctingModel{outputs: []string{`{"headers": {}}`, "```json\n" + `{"headers": {"content-type": "text/html", "etag": "abc"}, "body": "ok"}` + "\n```"}}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+
+	resp, raw, err := llm.GenerateJSONResponse(context.Background(), model, llm.Config{Provider: "openai", JSONCorrections: 1}, messages)
+	require.NoError(t, err)
+	assert.Equal(t, llm.JSONResponse{Headers: map[string]string{"content-type": "text/html", "etag": `"abc"`}, Body: "ok"}, resp, "the response should be normalized")
+	assert.Equal(t, `{"headers": {"content-type": "text/html", "etag": "abc"}, "body": "ok"}`, raw)
+
+	model = &correctingModel{outputs: []string{`{"headers": {}}`}}
+	resp, raw, err = llm.GenerateJSONResponse(context.Background(), model, llm.Config{Provider: "openai"}, messages)
+	assert.ErrorIs(t, err, llm.ErrInvalidJSON)
+	assert.Equal(t, `{"headers": {}}`, raw, "the invalid output should be returned")
+	assert.Equal(t, llm.JSONResponse{}, resp)
+}
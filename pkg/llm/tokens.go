@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"crypto/sha256"
+
+	"github.com/bluele/gcache"
+)
+
+// defaultTokenCacheSize is the number of distinct prompts whose token counts
+// are cached by default.
+const defaultTokenCacheSize = 16
+
+// systemPromptTokens caches the token count of system prompts, which rarely
+// change between requests.
+var systemPromptTokens = NewTokenCounter(EstimateTokens, defaultTokenCacheSize)
+
+// TokenCounter caches token counts keyed on the hash of the text, so the
+// count is only computed again when the text changes.
+type TokenCounter struct {
+	count func(string) int
+	cache gcache.Cache
+}
+
+// NewTokenCounter returns a counter that caches the counts computed by count
+// for up to size distinct texts.
+func NewTokenCounter(count func(string) int, size int) *TokenCounter {
+	if size <= 0 {
+		size = defaultTokenCacheSize
+	}
+	return &TokenCounter{
+		count: count,
+		cache: gcache.New(size).LRU().Build(),
+	}
+}
+
+// Count returns the number of tokens in text.
+func (c *TokenCounter) Count(text string) int {
+	key := sha256.Sum256([]byte(text))
+	if v, err := c.cache.Get(key); err == nil {
+		return v.(int)
+	}
+
+	n := c.count(text)
+	_ = c.cache.Set(key, n)
+	return n
+}
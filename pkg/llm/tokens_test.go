@@ -0,0 +1,25 @@
+package llm_test
+
+import (
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenCounter(t *testing.T) {
+	var calls int
+	counter := llm.NewTokenCounter(func(text string) int {
+		calls++
+		return llm.EstimateTokens(text)
+	}, 4)
+
+	prompt := "Your task is to analyze the headers and body of an HTTP request."
+	assert.Equal(t, llm.EstimateTokens(prompt), counter.Count(prompt))
+	assert.Equal(t, llm.EstimateTokens(prompt), counter.Count(prompt))
+	assert.Equal(t, 1, calls, "count should be computed once and reused")
+
+	changed := prompt + " Emulate the targeted application closely."
+	assert.Equal(t, llm.EstimateTokens(changed), counter.Count(changed))
+	assert.Equal(t, 2, calls, "count should be recomputed when the prompt changes")
+}
@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"github.com/tmc/langchaingo/llms"
+)
+
+// responseToolName is the name of the function the model calls with the
+// response when tool calling is enabled.
+const responseToolName = "send_http_response"
+
+var supportsToolCalling = map[string]bool{
+	"openai":       true,
+	"azure-openai": true,
+}
+
+// responseSchema is the JSON schema of the arguments of the response tool,
+// matching JSONResponse.
+var responseSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"status_code": map[string]any{
+			"type":        "integer",
+			"description": "The HTTP status code, if not 200.",
+			"minimum":     200,
+			"maximum":     599,
+		},
+		"headers": map[string]any{
+			"type":                 "object",
+			"description":          "The HTTP response headers.",
+			"additionalProperties": map[string]any{"type": "string"},
+		},
+		"encoding": map[string]any{
+			"type":        "string",
+			"description": "Set to base64 if the body is base64 encoded binary content.",
+			"enum":        []string{EncodingBase64},
+		},
+		"body": map[string]any{
+			"type":        "string",
+			"description": "The HTTP response body.",
+		},
+	},
+	"required": []string{"headers", "body"},
+}
+
+// toolCallOptions returns the options forcing the model to call the response
+// tool, so that the response is returned as the tool arguments.
+func toolCallOptions() []llms.CallOption {
+	return []llms.CallOption{
+		llms.WithTools([]llms.Tool{{
+			Type: "function",
+			Function: &llms.FunctionDefinition{
+				Name:        responseToolName,
+				Description: "Send the HTTP response to the client.",
+				Parameters:  responseSchema,
+			},
+		}}),
+		llms.WithToolChoice(llms.ToolChoice{
+			Type:     "function",
+			Function: &llms.FunctionReference{Name: responseToolName},
+		}),
+	}
+}
+
+// toolCallArguments returns the arguments of the response tool call, if the
+// model called it.
+func toolCallArguments(choice *llms.ContentChoice) (string, bool) {
+	for _, call := range choice.ToolCalls {
+		if call.FunctionCall != nil && call.FunctionCall.Name == responseToolName {
+			return call.FunctionCall.Arguments, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,63 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestGenerateLLMResponseToolCalling(t *testing.T) {
+	const args = `{"headers": {"Server": "nginx"}, "body": "ok"}`
+
+	var o llms.CallOptions
+	model := &MockModel{
+		GenerateContentFunc: func(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+			o = llms.CallOptions{}
+			for _, opt := range opts {
+				opt(&o)
+			}
+			if len(o.Tools) == 0 {
+				return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "```json\n" + args + "\n```"}}}, nil
+			}
+			return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+				ToolCalls: []llms.ToolCall{{
+					Type:         "function",
+					FunctionCall: &llms.FunctionCall{Name: o.Tools[0].Function.Name, Arguments: args},
+				}},
+			}}}, nil
+		},
+	}
+
+	resp, err := llm.GenerateLLMResponse(context.Background(), model, llm.Config{Provider: "openai", ToolCalling: true}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, args, resp)
+	require.Len(t, o.Tools, 1)
+	assert.False(t, o.JSONMode, "JSON mode should not be requested with tool calling")
+	assert.Equal(t, llms.ToolChoice{Type: "function", Function: &llms.FunctionReference{Name: o.Tools[0].Function.Name}}, o.ToolChoice)
+
+	// Providers without tool calling use JSON mode.
+	resp, err = llm.GenerateLLMResponse(context.Background(), model, llm.Config{Provider: "ollama", ToolCalling: true}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, args, resp)
+	assert.Empty(t, o.Tools)
+	assert.True(t, o.JSONMode)
+}
+
+func TestGenerateLLMResponseInvalidToolArguments(t *testing.T) {
+	model := &MockModel{
+		GenerateContentFunc: func(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+			return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+				ToolCalls: []llms.ToolCall{{
+					FunctionCall: &llms.FunctionCall{Name: "send_http_response", Arguments: `{"body": "ok"}`},
+				}},
+			}}}, nil
+		},
+	}
+
+	_, err := llm.GenerateLLMResponse(context.Background(), model, llm.Config{Provider: "openai", ToolCalling: true}, nil)
+	assert.ErrorIs(t, err, llm.ErrInvalidJSON)
+}
@@ -0,0 +1,176 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ModelUsage is the token usage and estimated cost of a number of
+// generations. The cost of models missing from ModelPricing is 0.
+type ModelUsage struct {
+	Generations      int     `json:"generations"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	Cost             float64 `json:"estimatedCost"`
+}
+
+func (u *ModelUsage) add(in, out int, cost float64) {
+	u.Generations++
+	u.PromptTokens += in
+	u.CompletionTokens += out
+	u.Cost += cost
+}
+
+// UsageTotals is the running total of the usage, overall and per model.
+type UsageTotals struct {
+	ModelUsage
+	Models map[string]ModelUsage `json:"models"`
+}
+
+// RequestUsage is the usage of the generations made for a single request,
+// including retries, corrections and fallbacks. Estimated is set when a
+// provider didn't report its token counts. TotalCost is the running total
+// cost of all requests at the time of the last generation.
+type RequestUsage struct {
+	ModelUsage
+	Estimated bool    `json:"estimated,omitempty"`
+	TotalCost float64 `json:"totalCost"`
+}
+
+// UsageTracker accounts the tokens used by the wrapped models. Token counts
+// are taken from the provider's response, or estimated when not reported.
+type UsageTracker struct {
+	mu     sync.Mutex
+	totals UsageTotals
+}
+
+// NewUsageTracker returns an empty usage tracker.
+func NewUsageTracker() *UsageTracker {
+	return &UsageTracker{totals: UsageTotals{Models: map[string]ModelUsage{}}}
+}
+
+// Wrap returns a model whose usage is accounted under the given model name.
+func (t *UsageTracker) Wrap(model llms.Model, name string) llms.Model {
+	return &usageTrackedModel{Model: model, tracker: t, name: name}
+}
+
+// Totals returns a snapshot of the running totals.
+func (t *UsageTracker) Totals() UsageTotals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshot := t.totals
+	snapshot.Models = make(map[string]ModelUsage, len(t.totals.Models))
+	for name, u := range t.totals.Models {
+		snapshot.Models[name] = u
+	}
+	return snapshot
+}
+
+// record adds the usage of a generation and returns the total cost so far.
+func (t *UsageTracker) record(name string, in, out int, cost float64) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.totals.add(in, out, cost)
+	u := t.totals.Models[name]
+	u.add(in, out, cost)
+	t.totals.Models[name] = u
+	return t.totals.Cost
+}
+
+type usageKey struct{}
+
+type requestUsage struct {
+	mu    sync.Mutex
+	usage RequestUsage
+}
+
+// WithUsage returns a copy of ctx that collects the usage of the generations
+// made with it, see UsageFrom.
+func WithUsage(ctx context.Context) context.Context {
+	return context.WithValue(ctx, usageKey{}, &requestUsage{})
+}
+
+// UsageFrom returns the usage collected by ctx and whether any generation was
+// made with it.
+func UsageFrom(ctx context.Context) (RequestUsage, bool) {
+	ru, ok := ctx.Value(usageKey{}).(*requestUsage)
+	if !ok {
+		return RequestUsage{}, false
+	}
+	ru.mu.Lock()
+	defer ru.mu.Unlock()
+	return ru.usage, ru.usage.Generations > 0
+}
+
+type usageTrackedModel struct {
+	llms.Model
+	tracker *UsageTracker
+	name    string
+}
+
+func (m *usageTrackedModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	resp, in, out, reported, counted, err := generateCounted(ctx, m.Model, messages, options)
+	if !counted {
+		return resp, err
+	}
+
+	pricing, _ := PricingFor(m.name)
+	cost := pricing.Cost(in, out)
+	total := m.tracker.record(m.name, in, out, cost)
+
+	if ru, ok := ctx.Value(usageKey{}).(*requestUsage); ok {
+		ru.mu.Lock()
+		ru.usage.add(in, out, cost)
+		ru.usage.Estimated = ru.usage.Estimated || !reported
+		ru.usage.TotalCost = total
+		ru.mu.Unlock()
+	}
+	return resp, err
+}
+
+// generateCounted generates the content with the model and returns the token
+// counts of the generation, estimated if not reported by the provider. A
+// generation failing after the provider streamed some output, e.g. when
+// cancelled or aborted by the stream guard, is counted from the output
+// streamed so far. counted is false if there is nothing to account.
+func generateCounted(ctx context.Context, model llms.Model, messages []llms.MessageContent, options []llms.CallOption) (resp *llms.ContentResponse, in, out int, reported, counted bool, err error) {
+	var opts llms.CallOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	var (
+		mu       sync.Mutex
+		streamed strings.Builder
+	)
+	if stream := opts.StreamingFunc; stream != nil {
+		options = append(options[:len(options):len(options)], llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			mu.Lock()
+			streamed.Write(chunk)
+			mu.Unlock()
+			return stream(ctx, chunk)
+		}))
+	}
+
+	resp, err = model.GenerateContent(ctx, messages, options...)
+	if resp != nil && len(resp.Choices) > 0 {
+		in, out, reported = Usage(resp)
+		if !reported {
+			in = estimateMessagesTokens(messages)
+			out = EstimateTokens(resp.Choices[0].Content)
+		}
+		return resp, in, out, reported, true, err
+	}
+
+	mu.Lock()
+	partial := streamed.String()
+	mu.Unlock()
+	if err == nil || partial == "" {
+		return resp, 0, 0, false, false, err
+	}
+	return resp, estimateMessagesTokens(messages), EstimateTokens(partial), false, true, err
+}
@@ -0,0 +1,83 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestUsageTracker(t *testing.T) {
+	tracker := llm.NewUsageTracker()
+	config := llm.Config{Provider: "openai", Model: "gpt-4o"}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+
+	model := tracker.Wrap(&usageModel{promptTokens: 1000, completionTokens: 200}, "gpt-4o")
+	ctx := llm.WithUsage(context.Background())
+	for i := 0; i < 2; i++ {
+		_, err := llm.GenerateLLMResponse(ctx, model, config, messages)
+		require.NoError(t, err)
+	}
+
+	usage, ok := llm.UsageFrom(ctx)
+	require.True(t, ok)
+	assert.Equal(t, 2, usage.Generations)
+	assert.Equal(t, 2000, usage.PromptTokens)
+	assert.Equal(t, 400, usage.CompletionTokens)
+	assert.False(t, usage.Estimated)
+	// gpt-4o: $5 per million input tokens, $15 per million output tokens.
+	assert.InDelta(t, 0.016, usage.Cost, 1e-9)
+	assert.InDelta(t, 0.016, usage.TotalCost, 1e-9)
+
+	// Token counts not reported by the provider are estimated.
+	other := tracker.Wrap(&usageModel{}, "llama3")
+	ctx = llm.WithUsage(context.Background())
+	_, err := llm.GenerateLLMResponse(ctx, other, llm.Config{Provider: "ollama", Model: "llama3"}, messages)
+	require.NoError(t, err)
+	usage, ok = llm.UsageFrom(ctx)
+	require.True(t, ok)
+	assert.True(t, usage.Estimated)
+	assert.Positive(t, usage.PromptTokens)
+	assert.Zero(t, usage.Cost)
+
+	totals := tracker.Totals()
+	assert.Equal(t, 3, totals.Generations)
+	assert.InDelta(t, 0.016, totals.Cost, 1e-9)
+	assert.Equal(t, 2, totals.Models["gpt-4o"].Generations)
+	assert.Equal(t, 1, totals.Models["llama3"].Generations)
+}
+
+func TestUsageTrackerAbortedStream(t *testing.T) {
+	tracker := llm.NewUsageTracker()
+	budget := llm.NewBudget(llm.BudgetConfig{MonthlyTokens: 1 << 20}, nil)
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "GET / HTTP/1.1")}
+	config := llm.Config{Provider: "openai", Model: "gpt-4o", Stream: true, StreamAbortThreshold: 16}
+
+	var streamed int
+	chunks := []string{"Sure", "! Here", " is a", " realistic", " HTTP", " response"}
+	model := budget.Wrap(tracker.Wrap(streamingModel(chunks, &streamed), "gpt-4o"), "gpt-4o")
+	ctx := llm.WithUsage(context.Background())
+	_, err := llm.GenerateLLMResponse(ctx, model, config, messages)
+	require.ErrorIs(t, err, llm.ErrNonJSONStream)
+
+	// The output streamed before the abort is accounted.
+	usage, ok := llm.UsageFrom(ctx)
+	require.True(t, ok)
+	assert.Equal(t, 1, usage.Generations)
+	assert.True(t, usage.Estimated)
+	assert.Positive(t, usage.PromptTokens)
+	assert.Positive(t, usage.CompletionTokens)
+	assert.Positive(t, usage.Cost)
+	assert.Equal(t, 1, tracker.Totals().Generations)
+	assert.Equal(t, usage.PromptTokens+usage.CompletionTokens, budget.Status().Month.Tokens)
+}
+
+func TestUsageFromWithoutGenerations(t *testing.T) {
+	_, ok := llm.UsageFrom(context.Background())
+	assert.False(t, ok)
+	_, ok = llm.UsageFrom(llm.WithUsage(context.Background()))
+	assert.False(t, ok)
+}
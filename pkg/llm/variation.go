@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Headers that carry product versions, e.g. "Apache/2.4.38".
+var versionedHeaders = []string{"Server", "X-Powered-By", "X-AspNet-Version"}
+
+var productVersionRe = regexp.MustCompile(`([A-Za-z][A-Za-z0-9_.-]*/\d+\.\d+\.)(\d+)`)
+
+// maxPatchShift is the largest change applied to a patch version.
+const maxPatchShift = 3
+
+// Variation introduces small, plausible differences into responses so that
+// different instances don't return byte-identical responses. The changes are
+// derived from the seed and the original values, so an instance stays
+// consistent with itself while differing from instances with other seeds.
+//
+// Header order is not varied: net/http always writes headers sorted by key.
+type Variation struct {
+	seed int64
+}
+
+// NewVariation creates a new Variation instance with the given seed.
+func NewVariation(seed int64) *Variation {
+	return &Variation{seed: seed}
+}
+
+// Apply varies the product versions in the response headers and the
+// trailing whitespace of the body.
+func (v *Variation) Apply(resp *JSONResponse) {
+	for key, value := range resp.Headers {
+		for _, h := range versionedHeaders {
+			if http.CanonicalHeaderKey(key) == h {
+				resp.Headers[key] = v.varyVersions(value)
+			}
+		}
+	}
+
+	if isHTMLResponse(resp) {
+		trimmed := strings.TrimRight(resp.Body, "\r\n")
+		if v.hash("body-newline")%2 == 0 {
+			resp.Body = trimmed + "\n"
+		} else {
+			resp.Body = trimmed
+		}
+	}
+}
+
+// varyVersions shifts the patch component of each product version, without
+// going below zero.
+func (v *Variation) varyVersions(value string) string {
+	return productVersionRe.ReplaceAllStringFunc(value, func(match string) string {
+		m := productVersionRe.FindStringSubmatch(match)
+		patch, err := strconv.Atoi(m[2])
+		if err != nil {
+			return match
+		}
+		shift := int(v.hash(m[1])%(2*maxPatchShift+1)) - maxPatchShift
+		if patch+shift < 0 {
+			shift = -shift
+		}
+		return m[1] + strconv.Itoa(patch+shift)
+	})
+}
+
+func (v *Variation) hash(s string) uint64 {
+	h := fnv.New64a()
+	var seed [8]byte
+	binary.LittleEndian.PutUint64(seed[:], uint64(v.seed))
+	h.Write(seed[:])
+	h.Write([]byte(s))
+	return h.Sum64()
+}
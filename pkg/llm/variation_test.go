@@ -0,0 +1,71 @@
+package llm_test
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func newVariationResponse() llm.JSONResponse {
+	return llm.JSONResponse{
+		Headers: map[string]string{
+			"Content-Type": "text/html; charset=utf-8",
+			"Server":       "Apache/2.4.38 (Debian) OpenSSL/1.1.1",
+			"X-Powered-By": "PHP/7.4.3",
+		},
+		Body: "<html><body>It works!</body></html>\n",
+	}
+}
+
+func TestVariationApply(t *testing.T) {
+	versionRe := regexp.MustCompile(`^Apache/2\.4\.\d+ \(Debian\) OpenSSL/1\.1\.\d+$`)
+
+	t.Run("reproducibleWithSeed", func(t *testing.T) {
+		a, b := newVariationResponse(), newVariationResponse()
+		llm.NewVariation(42).Apply(&a)
+		llm.NewVariation(42).Apply(&b)
+		assert.Equal(t, a, b)
+	})
+
+	t.Run("consistentWithinInstance", func(t *testing.T) {
+		v := llm.NewVariation(7)
+		a, b := newVariationResponse(), newVariationResponse()
+		v.Apply(&a)
+		v.Apply(&b)
+		assert.Equal(t, a, b)
+	})
+
+	t.Run("variesAcrossInstances", func(t *testing.T) {
+		seen := make(map[string]bool)
+		bodies := make(map[string]bool)
+		for seed := int64(1); seed <= 20; seed++ {
+			resp := newVariationResponse()
+			llm.NewVariation(seed).Apply(&resp)
+			seen[resp.Headers["Server"]+resp.Headers["X-Powered-By"]] = true
+			bodies[resp.Body] = true
+
+			// The structure stays valid.
+			assert.Regexp(t, versionRe, resp.Headers["Server"])
+			assert.Regexp(t, `^PHP/7\.4\.\d+$`, resp.Headers["X-Powered-By"])
+			assert.Equal(t, "text/html; charset=utf-8", resp.Headers["Content-Type"])
+			data, err := json.Marshal(resp)
+			assert.NoError(t, err)
+			assert.NoError(t, llm.ValidateJSON(string(data)))
+		}
+		assert.Greater(t, len(seen), 1)
+		assert.Len(t, bodies, 2)
+	})
+
+	t.Run("unversionedHeadersUntouched", func(t *testing.T) {
+		resp := llm.JSONResponse{
+			Headers: map[string]string{"Server": "nginx", "Content-Type": "application/json"},
+			Body:    `{"status": "ok"}`,
+		}
+		llm.NewVariation(3).Apply(&resp)
+		assert.Equal(t, "nginx", resp.Headers["Server"])
+		assert.Equal(t, `{"status": "ok"}`, resp.Body)
+	})
+}
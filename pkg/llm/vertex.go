@@ -18,7 +18,11 @@ func initVertexClient(ctx context.Context, config Config) (llms.Model, error) {
 		googleai.WithCloudProject(config.CloudProject),
 		googleai.WithCloudLocation(config.CloudLocation),
 	}
-	m, err := vertex.New(ctx, opts...)
+	safety, err := safetyOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	m, err := vertex.New(ctx, append(opts, safety...)...)
 	if err != nil {
 		return nil, err
 	}
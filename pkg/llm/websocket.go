@@ -0,0 +1,128 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// maxWebSocketTranscript is the number of most recent messages of a WebSocket
+// session included in the prompt.
+const maxWebSocketTranscript = 20
+
+const webSocketInstruction = `The client upgraded the HTTP request below to a WebSocket connection, and the session transcript follows it. Reply to the last message of the client as the WebSocket endpoint of the emulated server would, consistently with the earlier messages. Return a JSON object of the form {"messages": ["..."]} with the text messages to send back, in order; it may be empty if the endpoint wouldn't reply. Return only the JSON object.`
+
+// webSocketCorrectionPrompt asks the model to fix replies that failed to
+// decode.
+const webSocketCorrectionPrompt = `Your previous response is invalid (%s). Respond again with only a JSON object of the form {"messages": ["..."]}, with no text outside the JSON object.`
+
+// WebSocketMessage is a text message of a WebSocket session.
+type WebSocketMessage struct {
+	FromClient bool
+	Data       string
+}
+
+type webSocketReply struct {
+	Messages []string `json:"messages"`
+}
+
+// CreateWebSocketMessages creates the messages asking the model for the
+// replies to the last message of the transcript of the WebSocket session
+// opened by the request.
+func CreateWebSocketMessages(r *http.Request, cfg *config.Config, transcript []WebSocketMessage) ([]llms.MessageContent, error) {
+	dump, err := dumpRequest(r, cfg.MaxRequestTokens)
+	if err != nil {
+		return nil, err
+	}
+	if len(transcript) > maxWebSocketTranscript {
+		transcript = transcript[len(transcript)-maxWebSocketTranscript:]
+	}
+
+	var b strings.Builder
+	for _, m := range transcript {
+		from := "server"
+		if m.FromClient {
+			from = "client"
+		}
+		fmt.Fprintf(&b, "%s: %q\n", from, m.Data)
+	}
+	session := strings.TrimSpace(dump) + "\n\nWebSocket session:\n" + b.String()
+	if cfg.PromptInjection.Strip {
+		session = stripInjection(session)
+	}
+
+	systemPrompt := cfg.SystemPrompt
+	profile, err := ResolveServerProfile(cfg.ServerProfile)
+	if err != nil {
+		return nil, err
+	}
+	if profile != nil {
+		systemPrompt += "\n" + profile.prompt()
+	}
+	if cfg.PromptInjection.Delimit {
+		session = delimitRequest(session)
+		systemPrompt += "\n" + delimitInstruction
+	}
+
+	return []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, systemPrompt),
+		llms.TextParts(llms.ChatMessageTypeHuman, webSocketInstruction+"\n\n"+session),
+	}, nil
+}
+
+// GenerateWebSocketReplies generates the replies to the last message of a
+// WebSocket session. Invalid replies are fed back to the model with the
+// decoding error for up to config.JSONCorrections correction rounds, like
+// the responses of GenerateStructured.
+func GenerateWebSocketReplies(ctx context.Context, model llms.Model, config Config, messages []llms.MessageContent) ([]string, error) {
+	content, replies, err := generateWebSocketReplies(ctx, model, config, messages)
+	for round := 0; round < config.JSONCorrections && errors.Is(err, ErrInvalidJSON); round++ {
+		if ctx.Err() != nil {
+			break
+		}
+		messages = correctionMessages(messages, content, fmt.Sprintf(webSocketCorrectionPrompt, err))
+		content, replies, err = generateWebSocketReplies(ctx, model, config, messages)
+	}
+	return replies, err
+}
+
+// generateWebSocketReplies generates the replies once, and returns them along
+// with the output of the model.
+func generateWebSocketReplies(ctx context.Context, model llms.Model, config Config, messages []llms.MessageContent) (string, []string, error) {
+	opts := samplingOptions(config)
+	if CapabilitiesFor(config.Provider).JSONMode {
+		opts = append(opts, llms.WithJSONMode())
+	}
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	resp, err := model.GenerateContent(ctx, messages, opts...)
+	if err != nil {
+		if classified := classifyProviderError(err); classified != nil {
+			return "", nil, fmt.Errorf("%w: %w", classified, err)
+		}
+		return "", nil, fmt.Errorf("%w: %w", ErrGeneration, err)
+	}
+	if resp == nil || len(resp.Choices) == 0 || resp.Choices[0].Content == "" {
+		return "", nil, ErrEmptyResponse
+	}
+
+	content := cleanResponse(resp.Choices[0].Content)
+	var reply webSocketReply
+	if err := json.Unmarshal([]byte(content), &reply); err != nil {
+		repaired, ok := RepairJSON(content)
+		if !ok || json.Unmarshal([]byte(repaired), &reply) != nil {
+			return content, nil, fmt.Errorf("%w: %s", ErrInvalidJSON, err)
+		}
+	}
+	return content, reply.Messages, nil
+}
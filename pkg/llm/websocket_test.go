@@ -0,0 +1,60 @@
+package llm_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x4d31/galah/internal/config"
+	"github.com/0x4d31/galah/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestWebSocketReplies(t *testing.T) {
+	r := httptest.NewRequest("GET", "/socket.io/?EIO=4&transport=websocket", nil)
+	cfg := &config.Config{SystemPrompt: "system prompt", PromptInjection: config.PromptInjectionConfig{Delimit: true}}
+	transcript := []llm.WebSocketMessage{
+		{FromClient: true, Data: "40"},
+		{Data: `40{"sid":"-2bSAVhEhFRuAAAB"}`},
+		{FromClient: true, Data: `42["chat","hello"]`},
+	}
+
+	messages, err := llm.CreateWebSocketMessages(r, cfg, transcript)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	prompt := fmt.Sprint(messages[1].Parts[0])
+	assert.Contains(t, prompt, "GET /socket.io/?EIO=4&transport=websocket")
+	assert.Contains(t, prompt, `client: "42[\"chat\",\"hello\"]"`)
+	assert.Contains(t, prompt, "<untrusted_request>")
+
+	model := &MockModel{GenerateContentFunc: func(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+		return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "```json\n{\"messages\": [\"42[\\\"chat\\\",\\\"hi there\\\"]\"]}\n```"}}}, nil
+	}}
+	replies, err := llm.GenerateWebSocketReplies(context.Background(), model, llm.Config{Provider: "openai"}, messages)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`42["chat","hi there"]`}, replies)
+
+	model.GenerateContentFunc = func(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+		return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "not json"}}}, nil
+	}
+	_, err = llm.GenerateWebSocketReplies(context.Background(), model, llm.Config{Provider: "openai"}, messages)
+	assert.True(t, errors.Is(err, llm.ErrInvalidJSON))
+}
+
+func TestWebSocketRepliesCorrection(t *testing.T) {
+	model := &correctingModel{outputs: []string{`{"messages": "pong"}`, `{"messages": ["pong"]}`}}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "client: \"ping\"")}
+
+	replies, err := llm.GenerateWebSocketReplies(context.Background(), model, llm.Config{Provider: "ollama", JSONCorrections: 1}, messages)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pong"}, replies)
+	require.Len(t, model.messages, 2)
+	round := model.messages[1]
+	require.Len(t, round, 3)
+	assert.Equal(t, `{"messages": "pong"}`, fmt.Sprint(round[1].Parts[0]))
+	assert.Contains(t, fmt.Sprint(round[2].Parts[0]), `Your previous response is invalid (invalidJSONResponse: `)
+}